@@ -0,0 +1,231 @@
+// Package freeon runs FREEON ceremonies from inside another program, the way the freeon command does from a shell.
+//
+// Every method returns its result, or an error, rather than printing it and exiting, and takes a context that stops
+// it waiting on the coordinator. Any number of ceremonies can run at once, from one Client or several.
+//
+// Requests and ceremonies time out the way the config's "timeouts" say, or after 30 seconds and an hour. A context
+// with an earlier deadline gives up sooner. Connections, timeouts, and the API token belong to each Client, so two
+// Clients in one process don't step on each other. Nothing is printed: anything worth knowing that doesn't stop a
+// ceremony goes to Options.OnWarning. Giving up on a ceremony that's still waiting for people to join gives our seat
+// back, so it isn't left waiting on us.
+//
+// Shares, journals, and the identity key live where the freeon command keeps them: in $FREEON_HOME, or ~/.freeon.
+// They're shared by every Client in the process, and with the freeon command, so a ceremony interrupted here can be
+// picked back up with freeon resume, and vice versa.
+package freeon
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/soatok/freeon/client/internal"
+)
+
+// What a Client needs to know
+type Options struct {
+	// The coordinator, as hostname:port or a URL
+	Host string
+	// The age identity our shares are encrypted to. Creating, listing, terminating, and archiving work without one.
+	IdentityFile string
+	// Sent to the endpoints that take one, for proposing and administering without being in the group
+	APIToken string
+	// Hears about anything that went wrong without stopping a ceremony, like a party that sent us a bad share
+	OnWarning func(string)
+}
+
+// A connection to one coordinator, on behalf of one identity
+type Client struct {
+	host         string
+	identityFile string
+	session      *internal.Session
+}
+
+func New(opts Options) (*Client, error) {
+	if opts.Host == "" {
+		return nil, errors.New("freeon: a coordinator host is required")
+	}
+	session := internal.NewSession(opts.OnWarning)
+	if err := session.ConfigureTimeouts(0, 0); err != nil {
+		return nil, err
+	}
+	session.SetApiToken(opts.APIToken)
+	return &Client{host: opts.Host, identityFile: opts.IdentityFile, session: session}, nil
+}
+
+// A key group, or our share of one
+type Group = internal.GroupResult
+
+// A signing ceremony, and the signature it made if it's done
+type Ceremony = internal.CeremonyResult
+
+// Who a party blamed for a ceremony failing, and why
+type Blame = internal.FreeonBlame
+
+// What relaying an offline client's bundle got done
+type Relayed = internal.RelayResult
+
+// The formats a ceremony can sign in
+const (
+	FormatRaw     = internal.SignatureFormatRaw
+	FormatSSHSIG  = internal.SignatureFormatSSHSIG
+	FormatSSHCert = internal.SignatureFormatSSHCert
+)
+
+// We hold a share, but weren't one of the parties picked to sign
+var ErrNotASigner = internal.ErrNotASigner
+
+// The coordinator turned a request down
+type CoordinatorError = internal.CoordinatorError
+
+// Our signing policy wouldn't let us sign
+type PolicyViolation = internal.PolicyViolation
+
+// The ceremony was aborted, and these are the parties that were blamed
+type CeremonyAbortedError = internal.CeremonyAbortedError
+
+// Everything that goes into proposing a message for a group to sign
+type Proposal struct {
+	GroupID string
+	Message []byte
+	// Make an SSHSIG signature in this namespace, rather than a raw Ed25519 one
+	OpenSSH   bool
+	Namespace string
+	// Only these parties may sign. Anyone in the group may, if it's empty.
+	Signers []uint16
+	// How long the ceremony stays open. The coordinator decides, if it's zero.
+	Deadline time.Duration
+	// Leave the message with the coordinator for signers to download, in the clear or sealed to them
+	Publish bool
+	Seal    bool
+}
+
+// How a reshare should leave the group
+type Reshare struct {
+	// The size and threshold of the new group
+	Participants uint16
+	Threshold    uint16
+	// Hex-encoded identity keys of the newcomers who'll get a share. When proposing, these are the only ones who can
+	// join; otherwise, we check that the reshare was proposed for exactly these.
+	Newcomers []string
+	// Hand our share over without taking part in the new group
+	Leave bool
+}
+
+// Run everything under ctx with this Client's settings
+func (c *Client) with(ctx context.Context) context.Context {
+	return internal.WithSession(ctx, c.session)
+}
+
+func (c *Client) needIdentity() error {
+	if c.identityFile == "" {
+		return errors.New("freeon: this needs an identity file")
+	}
+	return nil
+}
+
+// Start a keygen ceremony for participants parties, threshold of whom will be needed to sign
+func (c *Client) CreateGroup(ctx context.Context, participants, threshold uint16, deadline time.Duration) (Group, error) {
+	return internal.CreateKeyGenCeremony(c.with(ctx), c.host, participants, threshold, deadline)
+}
+
+// Take part in a keygen ceremony, and keep our share of the key it makes. If we've taken part before and been cut
+// off, we pick up where we left off. members are the other members' identity keys, if we know them; the group has to
+// be made of exactly them. Without them, we can't tell if the coordinator swapped one out, and warn as much.
+func (c *Client) JoinGroup(ctx context.Context, groupID string, members ...string) (Group, error) {
+	ctx, cancel := internal.CeremonyContext(c.with(ctx))
+	defer cancel()
+	if err := c.needIdentity(); err != nil {
+		return Group{}, err
+	}
+	if j, err := internal.LoadJournal(groupID); err == nil && j.Kind == internal.JournalKeygen {
+		return internal.ResumeKeyGen(ctx, j, c.identityFile)
+	}
+	recipient, err := internal.IdentityRecipient(c.identityFile)
+	if err != nil {
+		return Group{}, err
+	}
+	return internal.RunKeyGenCeremony(ctx, c.host, groupID, recipient, members)
+}
+
+// The groups we hold shares for, on any coordinator
+func (c *Client) Groups() ([]Group, error) {
+	list, err := internal.LocalGroups()
+	if err != nil {
+		return nil, err
+	}
+	return list.Groups, nil
+}
+
+// The hex-encoded identity key coordinators know us by. Newcomers give this to whoever proposes a reshare.
+func (c *Client) IdentityKey() (string, error) {
+	return internal.IdentityPublicKey(c.with(context.Background()))
+}
+
+// Refresh our share of a group's key, along with every other holder
+func (c *Client) Refresh(ctx context.Context, groupID string) (Group, error) {
+	ctx, cancel := internal.CeremonyContext(c.with(ctx))
+	defer cancel()
+	if err := c.needIdentity(); err != nil {
+		return Group{}, err
+	}
+	recipient, err := internal.IdentityRecipient(c.identityFile)
+	if err != nil {
+		return Group{}, err
+	}
+	return internal.RefreshShares(ctx, c.host, groupID, c.identityFile, recipient)
+}
+
+// Take part in a reshare of a group's key
+func (c *Client) Reshare(ctx context.Context, groupID string, r Reshare) (Group, error) {
+	ctx, cancel := internal.CeremonyContext(c.with(ctx))
+	defer cancel()
+	if err := c.needIdentity(); err != nil {
+		return Group{}, err
+	}
+	recipient, err := internal.IdentityRecipient(c.identityFile)
+	if err != nil {
+		return Group{}, err
+	}
+	return internal.ReshareShares(ctx, c.host, groupID, c.identityFile, recipient, r.Participants, r.Threshold, r.Newcomers, r.Leave)
+}
+
+// Start a signing ceremony
+func (c *Client) Propose(ctx context.Context, p Proposal) (Ceremony, error) {
+	namespace := p.Namespace
+	if p.OpenSSH && namespace == "" {
+		namespace = "file"
+	}
+	return internal.CreateSignCeremony(c.with(ctx), c.host, p.GroupID, p.Message, p.OpenSSH, namespace, p.Signers, p.Deadline, p.Publish, p.Seal)
+}
+
+// The most recent signing ceremonies for a group
+func (c *Client) Ceremonies(ctx context.Context, groupID string, limit, offset int64) ([]Ceremony, error) {
+	list, err := internal.ListSignCeremonies(c.with(ctx), c.host, groupID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return list.Ceremonies, nil
+}
+
+// The signature a ceremony made
+func (c *Client) Signature(ctx context.Context, ceremonyID string) (Ceremony, error) {
+	return internal.FetchSignature(c.with(ctx), ceremonyID, c.host)
+}
+
+// Pull the plug on a signing ceremony
+func (c *Client) Terminate(ctx context.Context, ceremonyID string) error {
+	_, err := internal.TerminateCeremony(c.with(ctx), c.host, ceremonyID)
+	return err
+}
+
+// Retire a group for good
+func (c *Client) Archive(ctx context.Context, groupID string) error {
+	_, err := internal.ArchiveKeyGroup(c.with(ctx), c.host, groupID)
+	return err
+}
+
+// Deliver an offline client's outbound bundle to the coordinator, and write the inbound bundle it needs next
+func (c *Client) Relay(ctx context.Context, outboundFile, inboundFile string) (Relayed, error) {
+	return internal.Relay(c.with(ctx), c.host, outboundFile, inboundFile)
+}
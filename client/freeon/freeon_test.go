@@ -0,0 +1,139 @@
+package freeon_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/soatok/freeon/client/freeon"
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// A coordinator with one ceremony, whose proposer published what it signs
+func proposalServer(t *testing.T, message []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sign/poll":
+			json.NewEncoder(w).Encode(internal.PollSignResponse{
+				GroupID:      "test-group",
+				Threshold:    2,
+				OtherParties: []uint16{3},
+				Status:       "open",
+				Proposer:     "release-bot",
+				OpenSSH:      true,
+				Namespace:    "git",
+			})
+		case "/sign/proposal":
+			json.NewEncoder(w).Encode(internal.SignProposal{
+				Hash:      internal.HashMessageForSanity(message, "test-group"),
+				Message:   hex.EncodeToString(message),
+				OpenSSH:   true,
+				Namespace: "git",
+			})
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestNew(t *testing.T) {
+	_, err := freeon.New(freeon.Options{})
+	assert.Error(t, err)
+
+	client, err := freeon.New(freeon.Options{Host: "localhost:8462"})
+	assert.NoError(t, err)
+	// Signing and joining need to know whose shares to use
+	_, err = client.OpenSignSession(context.Background(), "test-ceremony", []byte("hello"))
+	assert.Error(t, err)
+	_, err = client.JoinGroup(context.Background(), "test-group")
+	assert.Error(t, err)
+}
+
+func TestOpenSignSession(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+	message := []byte("release v1.2.3\n")
+	server := proposalServer(t, message)
+	defer server.Close()
+
+	client, err := freeon.New(freeon.Options{Host: server.URL, IdentityFile: filepath.Join(t.TempDir(), "identity.txt")})
+	assert.NoError(t, err)
+
+	// With no message of our own, we sign the one that was proposed
+	session, err := client.OpenSignSession(context.Background(), "test-ceremony", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-ceremony", session.ID())
+	review := session.Review()
+	assert.Equal(t, "test-group", review.GroupID)
+	assert.Equal(t, "release-bot", review.Proposer)
+	assert.Equal(t, message, review.Message)
+	assert.Equal(t, freeon.FormatSSHSIG, review.Format)
+	assert.Equal(t, "git", review.Namespace)
+	assert.Equal(t, uint16(2), review.Threshold)
+	assert.Equal(t, []uint16{3}, review.Joined)
+	assert.Contains(t, review.Describe(), "Proposed by: release-bot")
+	assert.Contains(t, review.Describe(), "release v1.2.3")
+
+	// Each session keeps its own review
+	other, err := client.OpenSignSession(context.Background(), "test-ceremony", []byte("something else"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("something else"), other.Review().Message)
+	assert.Equal(t, message, session.Review().Message)
+}
+
+func TestOpenSignSessionTamperedProposal(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sign/poll":
+			json.NewEncoder(w).Encode(internal.PollSignResponse{GroupID: "test-group", Threshold: 2})
+		case "/sign/proposal":
+			json.NewEncoder(w).Encode(internal.SignProposal{
+				Hash:    internal.HashMessageForSanity([]byte("what was proposed"), "test-group"),
+				Message: hex.EncodeToString([]byte("what we're served")),
+			})
+		}
+	}))
+	defer server.Close()
+
+	client, err := freeon.New(freeon.Options{Host: server.URL, IdentityFile: "identity.txt"})
+	assert.NoError(t, err)
+	_, err = client.OpenSignSession(context.Background(), "test-ceremony", nil)
+	assert.ErrorContains(t, err, "does not match")
+}
+
+func TestClientsKeepTheirOwnSettings(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode(internal.VapidResponse{Status: "OK"})
+	}))
+	defer server.Close()
+
+	alice, err := freeon.New(freeon.Options{Host: server.URL, APIToken: "alice-token"})
+	assert.NoError(t, err)
+	bob, err := freeon.New(freeon.Options{Host: server.URL, APIToken: "bob-token"})
+	assert.NoError(t, err)
+
+	// Bob's token doesn't replace Alice's
+	assert.NoError(t, alice.Terminate(context.Background(), "test-ceremony"))
+	assert.NoError(t, bob.Terminate(context.Background(), "test-ceremony"))
+	assert.NoError(t, alice.Terminate(context.Background(), "test-ceremony"))
+	assert.Equal(t, []string{"Bearer alice-token", "Bearer bob-token", "Bearer alice-token"}, tokens)
+}
+
+func TestRelayReturnsErrors(t *testing.T) {
+	client, err := freeon.New(freeon.Options{Host: "localhost:8462"})
+	assert.NoError(t, err)
+
+	// A bundle that isn't there is our caller's problem to report, not a reason to exit
+	dir := t.TempDir()
+	_, err = client.Relay(context.Background(), filepath.Join(dir, "missing.json"), filepath.Join(dir, "inbound.json"))
+	assert.Error(t, err)
+}
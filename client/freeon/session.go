@@ -0,0 +1,100 @@
+package freeon
+
+import (
+	"context"
+
+	"github.com/soatok/freeon/client/internal"
+)
+
+// One signing ceremony, from looking at what it signs to signing it.
+//
+// Nothing is signed until Sign is called, so there's time to check the Review first. Our signing policy is checked
+// either way.
+type SignSession struct {
+	client *Client
+	review internal.SignReview
+}
+
+// What a ceremony signs, and who's asking
+type Review struct {
+	CeremonyID string
+	GroupID    string
+	// Who created the ceremony, if the coordinator knows
+	Proposer string
+	// The message, or for a certificate ceremony, the certificate
+	Message   []byte
+	Format    string
+	Namespace string
+	Threshold uint16
+	// Parties that joined before we did
+	Joined []uint16
+
+	describe func() string
+}
+
+// What freeon sign join shows before asking whether to sign
+func (r Review) Describe() string {
+	return r.describe()
+}
+
+// Look at a signing ceremony, to sign message with it. If message is nil, we sign what the ceremony was proposed
+// with: the certificate it issues, or the message the proposer left with the coordinator.
+func (c *Client) OpenSignSession(ctx context.Context, ceremonyID string, message []byte) (*SignSession, error) {
+	if err := c.needIdentity(); err != nil {
+		return nil, err
+	}
+	ctx = c.with(ctx)
+	var review internal.SignReview
+	var err error
+	if message == nil {
+		review, err = internal.ReviewProposedCeremony(ctx, c.host, ceremonyID)
+	} else {
+		review, err = internal.ReviewSignCeremony(ctx, c.host, ceremonyID, message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SignSession{client: c, review: review}, nil
+}
+
+func (s *SignSession) ID() string {
+	return s.review.CeremonyID
+}
+
+func (s *SignSession) Review() Review {
+	format := FormatRaw
+	switch {
+	case s.review.SSHCertificate:
+		format = FormatSSHCert
+	case s.review.OpenSSH:
+		format = FormatSSHSIG
+	}
+	return Review{
+		CeremonyID: s.review.CeremonyID,
+		GroupID:    s.review.GroupID,
+		Proposer:   s.review.Proposer,
+		Message:    s.review.Message,
+		Format:     format,
+		Namespace:  s.review.Namespace,
+		Threshold:  s.review.Threshold,
+		Joined:     s.review.Joined,
+		describe:   s.review.Describe,
+	}
+}
+
+// Contribute our share, and wait for the group's signature. If we've tried before and been cut off, we pick up where
+// we left off. Returns ErrNotASigner if we weren't picked to sign.
+func (s *SignSession) Sign(ctx context.Context) (Ceremony, error) {
+	c := s.client
+	ctx, cancel := internal.CeremonyContext(c.with(ctx))
+	defer cancel()
+	if j, err := internal.LoadJournal(s.review.CeremonyID); err == nil && j.Kind == internal.JournalSign {
+		return internal.ResumeSignCeremony(ctx, j, c.identityFile)
+	}
+	// The review was the caller's to approve, and they've called Sign
+	approved := func(internal.SignReview) error { return nil }
+	if s.review.SSHCertificate {
+		return internal.RunSSHCertCeremony(ctx, s.review.CeremonyID, c.host, c.identityFile, approved)
+	}
+	return internal.RunSignCeremony(ctx, s.review.CeremonyID, c.host, c.identityFile, s.review.Message, approved)
+}
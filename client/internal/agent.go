@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// An ssh-agent whose keys are the group keys we hold shares of.
+//
+// Every signature is a signing ceremony, so a sign request blocks until enough other holders join. The keys come from
+// the local config, so they can't be added or removed through the agent.
+type ThresholdAgent struct {
+	identityFile string
+
+	mu         sync.Mutex
+	passphrase []byte
+}
+
+var errAgentReadOnly = errors.New("freeon agent keys are managed with freeon keygen")
+var errAgentLocked = errors.New("agent is locked")
+
+func NewThresholdAgent(identityFile string) *ThresholdAgent {
+	return &ThresholdAgent{identityFile: identityFile}
+}
+
+// One key per group, no matter how many epochs we have shares from
+func (a *ThresholdAgent) shares() ([]Shares, error) {
+	config, err := LoadUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	var shares []Shares
+	seen := make(map[string]struct{})
+	for _, s := range config.Shares {
+		if _, ok := seen[s.GroupID]; ok {
+			continue
+		}
+		seen[s.GroupID] = struct{}{}
+		shares = append(shares, s)
+	}
+	return shares, nil
+}
+
+func (a *ThresholdAgent) locked() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.passphrase != nil
+}
+
+func (a *ThresholdAgent) List() ([]*agent.Key, error) {
+	if a.locked() {
+		return nil, nil
+	}
+	shares, err := a.shares()
+	if err != nil {
+		return nil, err
+	}
+	var keys []*agent.Key
+	for _, s := range shares {
+		pubKey, err := hex.DecodeString(s.PublicKey)
+		if err != nil || len(pubKey) != ed25519.PublicKeySize {
+			continue
+		}
+		sshKey, err := ssh.NewPublicKey(ed25519.PublicKey(pubKey))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &agent.Key{
+			Format:  sshKey.Type(),
+			Blob:    sshKey.Marshal(),
+			Comment: "freeon:" + s.GroupID,
+		})
+	}
+	return keys, nil
+}
+
+func (a *ThresholdAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	if a.locked() {
+		return nil, errAgentLocked
+	}
+	if key.Type() != ssh.KeyAlgoED25519 {
+		return nil, errors.New("only Ed25519 keys are supported")
+	}
+	pubKey, err := parseSSHKeyBlob(key.Marshal())
+	if err != nil {
+		return nil, err
+	}
+	shares, err := a.shares()
+	if err != nil {
+		return nil, err
+	}
+	var share Shares
+	for _, s := range shares {
+		if s.PublicKey == hex.EncodeToString(pubKey) {
+			share = s
+		}
+	}
+	if share.GroupID == "" {
+		return nil, errors.New("no local share for this key")
+	}
+
+	// Nobody's at a prompt to interrupt us, so the ceremony timeout is all that stops a ceremony nobody else joins
+	ctx, cancel := CeremonyContext(context.Background())
+	defer cancel()
+	// Leave the message with the coordinator, so the other holders don't need a copy of our SSH session to join
+	res, err := DuctInitSignCeremony(ctx, share.Host, InitSignRequest{
+		GroupID:     share.GroupID,
+		MessageHash: HashMessageForSanity(data, share.GroupID),
+		Message:     hex.EncodeToString(data),
+		MyPartyID:   &share.MyPartyID,
+		Publish:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	session := sessionFrom(ctx)
+	session.warnf("Sign request for group %s, ceremony %s\nOther holders can join with:\n\tfreeon sign join --fetch -h %s -c %s", share.GroupID, res.CeremonyID, share.Host, res.CeremonyID)
+
+	sigHex, err := SignWithCeremony(ctx, res.CeremonyID, share.Host, a.identityFile, data)
+	if err != nil {
+		session.warnf("Ceremony %s failed: %s", res.CeremonyID, err.Error())
+		return nil, err
+	}
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(pubKey, data, sig) {
+		return nil, errors.New("ceremony produced an invalid signature")
+	}
+	session.warnf("Ceremony %s complete", res.CeremonyID)
+	return &ssh.Signature{Format: ssh.KeyAlgoED25519, Blob: sig}, nil
+}
+
+func (a *ThresholdAgent) Add(key agent.AddedKey) error {
+	return errAgentReadOnly
+}
+
+func (a *ThresholdAgent) Remove(key ssh.PublicKey) error {
+	return errAgentReadOnly
+}
+
+func (a *ThresholdAgent) RemoveAll() error {
+	return errAgentReadOnly
+}
+
+func (a *ThresholdAgent) Lock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.passphrase != nil {
+		return errAgentLocked
+	}
+	h := sha512.Sum512(passphrase)
+	a.passphrase = h[:]
+	return nil
+}
+
+func (a *ThresholdAgent) Unlock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.passphrase == nil {
+		return errors.New("agent is not locked")
+	}
+	h := sha512.Sum512(passphrase)
+	if subtle.ConstantTimeCompare(h[:], a.passphrase) != 1 {
+		return errors.New("incorrect passphrase")
+	}
+	a.passphrase = nil
+	return nil
+}
+
+// Our keys never leave the ceremony, so there's nothing to hand out here
+func (a *ThresholdAgent) Signers() ([]ssh.Signer, error) {
+	return nil, errAgentReadOnly
+}
+
+// Serve the agent on a Unix socket until we're interrupted.
+// Without a socket path, we make one in a private temporary directory, like ssh-agent does.
+func RunAgent(socketPath, identityFile string) {
+	if identityFile == "" {
+		Fail(UsageError(errors.New("an age identity file is required to decrypt shares")))
+	}
+	if socketPath == "" {
+		dir, err := os.MkdirTemp("", "freeon-agent-")
+		if err != nil {
+			Fail(err)
+		}
+		defer os.RemoveAll(dir)
+		socketPath = filepath.Join(dir, "agent.sock")
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		Fail(err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		Fail(err)
+	}
+
+	// Clean up the socket on the way out
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	// Same output as ssh-agent, so this can be eval'd
+	printResult(fmt.Sprintf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", socketPath), AgentResult{Socket: socketPath})
+	a := NewThresholdAgent(identityFile)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			agent.ServeAgent(a, conn)
+		}()
+	}
+}
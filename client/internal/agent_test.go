@@ -0,0 +1,56 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestThresholdAgent(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+	cfg, err := internal.NewUserConfig()
+	assert.NoError(t, err)
+	groupKey, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.AddShare("localhost", "grp_abc123", hex.EncodeToString(groupKey), "share", nil, 1, nil))
+
+	server, conn := net.Pipe()
+	defer conn.Close()
+	go agent.ServeAgent(internal.NewThresholdAgent("keys.txt"), server)
+	client := agent.NewClient(conn)
+
+	// Every group we hold a share of is an identity
+	keys, err := client.List()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, internal.OpenSSHPublicKey(groupKey)+" freeon:grp_abc123", keys[0].String())
+
+	// Keys can't be managed through the agent
+	_, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	assert.Error(t, client.Add(agent.AddedKey{PrivateKey: priv}))
+	assert.Error(t, client.RemoveAll())
+
+	// We can't sign with somebody else's key
+	other, err := ssh.NewPublicKey(priv.Public())
+	assert.NoError(t, err)
+	_, err = client.Sign(other, []byte("data"))
+	assert.Error(t, err)
+
+	// Locking hides the keys until it's unlocked with the same passphrase
+	assert.NoError(t, client.Lock([]byte("hunter2")))
+	keys, err = client.List()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Error(t, client.Unlock([]byte("wrong")))
+	assert.NoError(t, client.Unlock([]byte("hunter2")))
+	keys, err = client.List()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
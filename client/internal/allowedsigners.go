@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// One line of an allowed_signers file, as described in ssh-keygen(1).
+//
+// We only understand Ed25519 keys. Lines for other key types, or marked cert-authority, are skipped rather than
+// rejected, so a file shared with plain ssh-keygen still works.
+type AllowedSigner struct {
+	Principals  string
+	Namespaces  string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	PublicKey   []byte
+}
+
+// Read an allowed_signers file
+func ReadAllowedSigners(path string) ([]AllowedSigner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAllowedSigners(f)
+}
+
+func ParseAllowedSigners(r io.Reader) ([]AllowedSigner, error) {
+	var signers []AllowedSigner
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		signer, ok, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("allowed signers line %d: %w", lineNo, err)
+		}
+		if ok {
+			signers = append(signers, signer)
+		}
+	}
+	return signers, scanner.Err()
+}
+
+func parseAllowedSigner(line string) (AllowedSigner, bool, error) {
+	principals, rest := nextAllowedSignersField(line)
+	if rest == "" {
+		return AllowedSigner{}, false, errors.New("missing public key")
+	}
+	signer := AllowedSigner{Principals: strings.Trim(principals, `"`)}
+
+	// Options are optional, so anything that isn't a key type must be them
+	if !isSSHKeyType(rest) {
+		var options string
+		options, rest = nextAllowedSignersField(rest)
+		for _, opt := range splitAllowedSignersOptions(options) {
+			name, value, _ := strings.Cut(opt, "=")
+			value = strings.Trim(value, `"`)
+			var err error
+			switch strings.ToLower(name) {
+			case "cert-authority":
+				return AllowedSigner{}, false, nil
+			case "namespaces":
+				signer.Namespaces = value
+			case "valid-after":
+				signer.ValidAfter, err = ParseSSHTime(value)
+			case "valid-before":
+				signer.ValidBefore, err = ParseSSHTime(value)
+			default:
+				err = fmt.Errorf("unknown option: %s", name)
+			}
+			if err != nil {
+				return AllowedSigner{}, false, err
+			}
+		}
+	}
+	if !strings.HasPrefix(rest, "ssh-ed25519 ") {
+		return AllowedSigner{}, false, nil
+	}
+	pubKey, err := ParseOpenSSHPublicKey(rest)
+	if err != nil {
+		return AllowedSigner{}, false, err
+	}
+	signer.PublicKey = pubKey
+	return signer, true, nil
+}
+
+func isSSHKeyType(s string) bool {
+	for _, prefix := range []string{"ssh-", "ecdsa-", "sk-"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Split off the next whitespace-delimited field, which may contain quoted whitespace
+func nextAllowedSignersField(s string) (string, string) {
+	quoted := false
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case (c == ' ' || c == '\t') && !quoted:
+			return s[:i], strings.TrimSpace(s[i:])
+		}
+	}
+	return s, ""
+}
+
+// Split comma-separated options, leaving commas inside quotes alone
+func splitAllowedSignersOptions(s string) []string {
+	var opts []string
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			opts = append(opts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(opts, s[start:])
+}
+
+// Parse a time in the YYYYMMDD[HHMM[SS]][Z] format OpenSSH uses. Without the Z, it's local time.
+func ParseSSHTime(s string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(s, "Z") || strings.HasSuffix(s, "z") {
+		s = s[:len(s)-1]
+		loc = time.UTC
+	}
+	layouts := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(s)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time: %s", s)
+	}
+	return time.ParseInLocation(layout, s, loc)
+}
+
+// Is this key allowed to sign as this principal, in this namespace, at this time?
+func (a AllowedSigner) Allows(principal, namespace string, pubKey []byte, at time.Time) bool {
+	if !bytes.Equal(a.PublicKey, pubKey) || !a.ValidAt(at) {
+		return false
+	}
+	if a.Namespaces != "" && !MatchPatternList(namespace, a.Namespaces) {
+		return false
+	}
+	return MatchPatternList(principal, a.Principals)
+}
+
+func (a AllowedSigner) ValidAt(at time.Time) bool {
+	if !a.ValidAfter.IsZero() && at.Before(a.ValidAfter) {
+		return false
+	}
+	if !a.ValidBefore.IsZero() && !at.Before(a.ValidBefore) {
+		return false
+	}
+	return true
+}
+
+// Match against a comma-separated list of patterns, like OpenSSH does.
+// Patterns may use * and ?, and a pattern starting with ! vetoes the match.
+func MatchPatternList(s, list string) bool {
+	matched := false
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchPattern(s, negated) {
+				return false
+			}
+		} else if matchPattern(s, pattern) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func matchPattern(s, pattern string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(s[i:], pattern[1:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		s = s[1:]
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,59 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowedSigners(t *testing.T) {
+	release, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	other, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	file := "# Release signing\n" +
+		"\n" +
+		`release@example.com,*@release.example.com namespaces="git,file",valid-after="20240101" ` + internal.OpenSSHPublicKey(release) + " grp_abc123\n" +
+		"old@example.com valid-before=20200101Z " + internal.OpenSSHPublicKey(other) + "\n" +
+		"ca@example.com cert-authority " + internal.OpenSSHPublicKey(other) + "\n" +
+		"rsa@example.com ssh-rsa AAAAB3NzaC1yc2E\n"
+	signers, err := internal.ParseAllowedSigners(strings.NewReader(file))
+	assert.NoError(t, err)
+	assert.Len(t, signers, 2)
+
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	assert.True(t, signers[0].Allows("release@example.com", "git", release, now))
+	assert.True(t, signers[0].Allows("ci@release.example.com", "file", release, now))
+	assert.False(t, signers[0].Allows("mallory@example.com", "git", release, now))
+	assert.False(t, signers[0].Allows("release@example.com", "email", release, now))
+	assert.False(t, signers[0].Allows("release@example.com", "git", other, now))
+	assert.False(t, signers[0].Allows("release@example.com", "git", release, now.AddDate(-2, 0, 0)))
+	assert.False(t, signers[1].ValidAt(now))
+
+	_, err = internal.ParseAllowedSigners(strings.NewReader("bad@example.com bogus=1 " + internal.OpenSSHPublicKey(release)))
+	assert.Error(t, err)
+}
+
+func TestMatchPatternList(t *testing.T) {
+	assert.True(t, internal.MatchPatternList("git", "git"))
+	assert.True(t, internal.MatchPatternList("alice@example.com", "bob@example.com,*@example.com"))
+	assert.True(t, internal.MatchPatternList("a1", "a?"))
+	assert.False(t, internal.MatchPatternList("a12", "a?"))
+	assert.False(t, internal.MatchPatternList("root@example.com", "*@example.com,!root@*"))
+}
+
+func TestParseSSHTime(t *testing.T) {
+	ts, err := internal.ParseSSHTime("20240102030405Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ts)
+	ts, err = internal.ParseSSHTime("20240102Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), ts)
+	_, err = internal.ParseSSHTime("2024")
+	assert.Error(t, err)
+}
@@ -0,0 +1,356 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The command line's side of each ceremony: run it, then print what happened and exit.
+//
+// Everything these call returns its result instead, for anyone who wants to run ceremonies without exiting when
+// they're done.
+
+// Stop when someone hits Ctrl-C, or the process is told to terminate. Only the first one is ours to handle; after
+// that, signals do what they normally do, so a second Ctrl-C gets out no matter what.
+func InterruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if sig, ok := <-signals; ok {
+			signal.Stop(signals)
+			cancel(interruptedError{sig})
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(signals)
+		cancel(nil)
+	}
+}
+
+// The context a command runs in: interruptible, and giving up once the ceremony timeout has passed
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, stopInterrupts := InterruptContext()
+	ctx, cancel := CeremonyContext(ctx)
+	return ctx, func() {
+		cancel()
+		stopInterrupts()
+	}
+}
+
+// Initialize a keygen ceremony with the coordinator
+func InitKeyGenCeremony(host string, participants uint16, threshold uint16, deadline time.Duration) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := CreateKeyGenCeremony(ctx, host, participants, threshold, deadline)
+	if err != nil {
+		Fail(err)
+	}
+	Succeed(fmt.Sprintf("Distributed key generation ceremony created! Group ID:\n%s\n", result.GroupID), result)
+}
+
+// Kick off a signing ceremony
+func InitSignCeremony(host, groupID string, message []byte, openssh bool, namespace string, signers []uint16, deadline time.Duration, publish, seal bool) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := CreateSignCeremony(ctx, host, groupID, message, openssh, namespace, signers, deadline, publish, seal)
+	if err != nil {
+		Fail(err)
+	}
+	Succeed(fmt.Sprintf("Key signing ceremony created!\n%s\n", result.CeremonyID), result)
+}
+
+// Join a keygen ceremony
+func JoinKeyGenCeremony(host, groupID, recipient string, members []string) {
+	ctx, stop := commandContext()
+	defer stop()
+	succeedWithGroupKey(RunKeyGenCeremony(ctx, host, groupID, recipient, members))
+}
+
+// Print the key a keygen ceremony made, and exit
+func succeedWithGroupKey(result GroupResult, err error) {
+	if err != nil {
+		exitIfWaitingForRelay(err)
+		Fail(err)
+	}
+	reportUndelivered()
+	Succeed(fmt.Sprintf("Group public key:\n%s\n", result.PublicKey), result)
+}
+
+// Refresh our share of a group's key, along with every other holder
+func RefreshKeyGroup(host, groupID, identityFile, recipient string) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := RefreshShares(ctx, host, groupID, identityFile, recipient)
+	if err != nil {
+		Fail(err)
+	}
+	Succeed(fmt.Sprintf("Shares refreshed! Group %s is now at epoch %d\n", groupID, *result.Epoch), result)
+}
+
+// Abort the refresh in progress for a group
+func AbortRefresh(host, groupID string) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := CancelRefresh(ctx, host, groupID)
+	if err != nil {
+		Fail(err)
+	}
+	Succeed("Refresh aborted.\n", result)
+}
+
+// Take part in a reshare of a group's key
+func ReshareKeyGroup(host, groupID, identityFile, recipient string, partySize, threshold uint16, newcomers []string, leave bool) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := ReshareShares(ctx, host, groupID, identityFile, recipient, partySize, threshold, newcomers, leave)
+	if err != nil {
+		Fail(err)
+	}
+	if result.Status == "left" {
+		Succeed(fmt.Sprintf("Reshare complete! You are no longer a member of group %s\n", groupID), result)
+	}
+	Succeed(fmt.Sprintf("Reshare complete! You are party %d in a %d-of-%d group at epoch %d\n", result.PartyID, result.Threshold, result.Participants, *result.Epoch), result)
+}
+
+// Abort the reshare in progress for a group
+func AbortReshare(host, groupID string) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := CancelReshare(ctx, host, groupID)
+	if err != nil {
+		Fail(err)
+	}
+	Succeed("Reshare aborted.\n", result)
+}
+
+// List local key shares and groups
+func ListKeyGen(openssh bool) {
+	list, err := LocalGroups()
+	if err != nil {
+		Fail(err)
+	}
+	if len(list.Groups) < 1 {
+		Succeed("No local key shares/groups found", list)
+	}
+	var text strings.Builder
+	if openssh {
+		// One line per group, ready for a key file or allowed_signers
+		seen := make(map[string]struct{})
+		for _, group := range list.Groups {
+			if _, ok := seen[group.GroupID]; ok {
+				continue
+			}
+			seen[group.GroupID] = struct{}{}
+			fmt.Fprintf(&text, "%s %s\n", group.OpenSSHPublicKey, group.GroupID)
+		}
+		Succeed(text.String(), list)
+	}
+	// List shares
+	fmt.Fprintf(&text, "Group ID\tPublic Key\tEpoch\n")
+	for _, group := range list.Groups {
+		fmt.Fprintf(&text, "%s\t%s\t%d\n", group.GroupID, group.PublicKey, *group.Epoch)
+	}
+	Succeed(text.String(), list)
+}
+
+// Ask whoever's at the keyboard, unless autoConfirm says not to bother
+func confirmOnStdin(autoConfirm bool) func(SignReview) error {
+	return func(review SignReview) error {
+		return review.Confirm(os.Stderr, os.Stdin, autoConfirm)
+	}
+}
+
+// Join a signing ceremony, once the user has approved what it signs
+func JoinSignCeremony(ceremonyID, host, identityFile string, message []byte, autoConfirm bool) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := RunSignCeremony(ctx, ceremonyID, host, identityFile, message, confirmOnStdin(autoConfirm))
+	succeedWithSignature(ceremonyID, result, err)
+}
+
+// Join a signing ceremony whose message we download from the coordinator
+func JoinProposedSignCeremony(ceremonyID, host, identityFile string, autoConfirm bool) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := RunProposedSignCeremony(ctx, ceremonyID, host, identityFile, confirmOnStdin(autoConfirm))
+	succeedWithSignature(ceremonyID, result, err)
+}
+
+// Print the signature a ceremony made, and exit
+func succeedWithSignature(ceremonyID string, result CeremonyResult, err error) {
+	if err != nil {
+		exitIfWaitingForRelay(err)
+		exitIfNotASigner(ceremonyID, err)
+		Fail(err)
+	}
+	reportUndelivered()
+	Succeed(signatureText(result), result)
+}
+
+// The signature, and a warning if nobody but its signer checked it
+func signatureText(result CeremonyResult) string {
+	text := fmt.Sprintf("Signature:\n%s\n", result.Signature)
+	if result.Unverified {
+		text += "Unverified: the message was sealed, so the coordinator couldn't check this signature. Check it with freeon verify.\n"
+	}
+	return text
+}
+
+// Not being picked to sign isn't a failure, so tell the user and exit cleanly
+func exitIfNotASigner(ceremonyID string, err error) {
+	if !errors.Is(err, ErrNotASigner) {
+		return
+	}
+	Succeed(ErrNotASigner.Error()+"\n", CeremonyResult{CeremonyID: ceremonyID, Status: "not-a-signer"})
+}
+
+// Propose a certificate for the group to sign.
+//
+// The CA key comes from caKeyFile if one is given, otherwise from our own share of the group.
+func InitSSHCertCeremony(host, groupID, caKeyFile string, cert SSHCertificate) {
+	ctx, stop := commandContext()
+	defer stop()
+	var err error
+	cert.SignatureKey, err = certificateAuthorityKey(groupID, caKeyFile)
+	if err != nil {
+		Fail(err)
+	}
+	result, err := CreateSSHCertCeremony(ctx, host, groupID, cert)
+	if err != nil {
+		Fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "%s", cert.Describe())
+	Succeed(fmt.Sprintf("Certificate signing ceremony created!\n%s\n", result.CeremonyID), result)
+}
+
+// Join a certificate ceremony, once we've seen what the certificate says and approved it
+func JoinSSHCertCeremony(ceremonyID, host, identityFile string, autoConfirm bool) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := RunSSHCertCeremony(ctx, ceremonyID, host, identityFile, confirmOnStdin(autoConfirm))
+	if err != nil {
+		Fail(err)
+	}
+	Succeed(fmt.Sprintf("Certificate:\n%s\n", result.Signature), result)
+}
+
+// List the most recent signing ceremonies
+func ListSign(host, groupID string, limit, offset int64) {
+	ctx, stop := commandContext()
+	defer stop()
+	list, err := ListSignCeremonies(ctx, host, groupID, limit, offset)
+	if err != nil {
+		Fail(err)
+	}
+	count := len(list.Ceremonies)
+	if count < 1 {
+		Succeed("No ceremonies found.", list)
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Listing the most recent %d ceremonies:\n\n", count)
+	fmt.Fprintf(&text, "\tCeremony ID\tHash\tFormat\tOpen?\n")
+	fmt.Fprintf(&text, "\t-------------------------------------------------------------------------------\n")
+	for _, ceremony := range list.Ceremonies {
+		var format string
+		switch ceremony.Format {
+		case SignatureFormatSSHCert:
+			format = "SSH Cert"
+		case SignatureFormatSSHSIG:
+			format = "OpeenSSH"
+		default:
+			format = "Raw"
+		}
+		var status string
+		switch ceremony.Status {
+		case "open":
+			status = "Open"
+		case "expired":
+			status = "Expired"
+		case "aborted":
+			status = "Aborted"
+		case "disputed":
+			status = "Disputed"
+		default:
+			status = " -- "
+		}
+		fmt.Fprintf(&text, "\t%s\t%s\t%s\t%s\n", ceremony.CeremonyID, ceremony.Hash, format, status)
+		printBlame(&text, ceremony.Blame)
+	}
+	fmt.Fprintf(&text, "\n")
+	Succeed(text.String(), list)
+}
+
+// Fetch a signature from the coordinator for a given ceremony
+func GetSignSignature(ceremonyID, host string) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := FetchSignature(ctx, ceremonyID, host)
+	if err != nil {
+		Fail(err)
+	}
+	Succeed(signatureText(result), result)
+}
+
+// Tell the coordinator to pull the plug on a signing ceremony
+func TerminateSignCeremony(host, ceremonyID string) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := TerminateCeremony(ctx, host, ceremonyID)
+	if err != nil {
+		Fail(err)
+	}
+	Succeed("Ceremony terminated.\n", result)
+}
+
+// Retire a group for good
+func ArchiveGroup(host, groupID string) {
+	ctx, stop := commandContext()
+	defer stop()
+	result, err := ArchiveKeyGroup(ctx, host, groupID)
+	if err != nil {
+		Fail(err)
+	}
+	Succeed("Group archived.\n", result)
+}
+
+// Print the identity key coordinators know us by, or a certificate signing request for it
+func ShowIdentity(csr bool) {
+	publicKey, err := IdentityPublicKey(context.Background())
+	if err != nil {
+		Fail(err)
+	}
+	if !csr {
+		Succeed(publicKey+"\n", IdentityResult{IdentityKey: publicKey})
+	}
+	request, err := IdentityCSR(context.Background())
+	if err != nil {
+		Fail(err)
+	}
+	Succeed(request, IdentityResult{IdentityKey: publicKey, CSR: request})
+}
+
+// Pick up a ceremony where we left off, after a crash or a lost connection
+func ResumeCeremony(id, identityFile string) {
+	ctx, stop := commandContext()
+	defer stop()
+	j, err := LoadJournal(id)
+	if err != nil {
+		Fail(err)
+	}
+	switch j.Kind {
+	case JournalKeygen:
+		succeedWithGroupKey(ResumeKeyGen(ctx, j, identityFile))
+	case JournalSign:
+		result, err := ResumeSignCeremony(ctx, j, identityFile)
+		succeedWithSignature(id, result, err)
+	}
+}
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"slices"
+
+	"github.com/bytemare/dkg"
+	secretsharing "github.com/bytemare/secret-sharing"
+)
+
+// Check every round 2 share we received against its dealer's round 1 commitment.
+// Returns the party IDs of every dealer whose share is invalid, or who never committed, in ascending order.
+func FindInvalidDealers(myPartyID uint16, r1Data []*dkg.Round1Data, r2Data []*dkg.Round2Data) []uint16 {
+	g := dkg.Edwards25519Sha512.Group()
+	commitments := make(map[uint16]*dkg.Round1Data)
+	for _, r1 := range r1Data {
+		commitments[r1.SenderIdentifier] = r1
+	}
+
+	var dealers []uint16
+	for _, r2 := range r2Data {
+		r1, ok := commitments[r2.SenderIdentifier]
+		if !ok || r2.RecipientIdentifier != myPartyID {
+			dealers = append(dealers, r2.SenderIdentifier)
+			continue
+		}
+		pk := g.Base().Multiply(r2.SecretShare)
+		if !secretsharing.Verify(g, myPartyID, pk, r1.Commitment) {
+			dealers = append(dealers, r2.SenderIdentifier)
+		}
+	}
+	slices.Sort(dealers)
+	return dealers
+}
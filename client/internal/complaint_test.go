@@ -0,0 +1,36 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/bytemare/dkg"
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindInvalidDealers(t *testing.T) {
+	var participants []*dkg.Participant
+	var r1Data []*dkg.Round1Data
+	for id := uint16(1); id <= 3; id++ {
+		p, err := dkg.Edwards25519Sha512.NewParticipant(id, 2, 3)
+		assert.NoError(t, err)
+		participants = append(participants, p)
+		r1Data = append(r1Data, p.Start())
+	}
+
+	// Collect the shares dealt to party 1
+	var r2Data []*dkg.Round2Data
+	for _, p := range participants[1:] {
+		r2, err := p.Continue(r1Data)
+		assert.NoError(t, err)
+		r2Data = append(r2Data, r2[1])
+	}
+	assert.Empty(t, internal.FindInvalidDealers(1, r1Data, r2Data))
+
+	// Party 3 deals a share that doesn't match its commitment
+	r2Data[1].SecretShare.Add(dkg.Edwards25519Sha512.Group().NewScalar().One())
+	assert.Equal(t, []uint16{3}, internal.FindInvalidDealers(1, r1Data, r2Data))
+
+	// A share with no commitment behind it is just as bad
+	assert.Equal(t, []uint16{2, 3}, internal.FindInvalidDealers(1, r1Data[2:], r2Data))
+}
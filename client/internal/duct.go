@@ -10,35 +10,261 @@ package internal
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
-var httpClient *http.Client = nil
+// Requests are signed, and the signature is sent in this header: the time we signed it (in Unix seconds), a random
+// nonce, and the hex-encoded signature, separated by dots. The coordinator only accepts each nonce once.
+const SignatureHeader = "Freeon-Signature"
 
-func InitializeHttpClient() error {
-	if httpClient == nil {
-		jar, err := cookiejar.New(nil)
+// Domain separation for request signatures
+var requestSignaturePrefix = []byte("FREEON Request v2")
+
+// The coordinator answered, but not with what we asked for
+type CoordinatorError struct {
+	Status int
+	// Empty if the response didn't say why
+	Message string
+}
+
+func (e CoordinatorError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("request failed with status code: %d", e.Status)
+	}
+	return fmt.Sprintf("request failed: %s", e.Message)
+}
+
+// Make sure the context's session can reach coordinators
+func InitializeHttpClient(ctx context.Context) error {
+	_, err := sessionFrom(ctx).client()
+	return err
+}
+
+// How the session reaches coordinators, set up the first time it's needed
+func (s *Session) client() (*http.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.httpClient == nil {
+		client, err := s.newHttpClient(true)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		httpClient = &http.Client{
-			Jar: jar,
+		s.httpClient = client
+	}
+	return s.httpClient, nil
+}
+
+// An HTTP client that trusts coordinators the way ~/.freeon.json says to
+func (s *Session) newHttpClient(clientCerts bool) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		config, err := s.coordinatorTLSConfig(addr, clientCerts)
+		if err != nil {
+			return nil, err
+		}
+		dialer := &tls.Dialer{Config: config}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return &http.Client{
+		Jar:       jar,
+		Transport: transport,
+	}, nil
+}
+
+// Our identity key, loaded the first time it's needed
+func (s *Session) identity() (ed25519.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.identityKey == nil {
+		key, err := LoadIdentityKey()
+		if err != nil {
+			return nil, err
 		}
+		s.identityKey = key
+	}
+	return s.identityKey, nil
+}
+
+// The hex-encoded public key the coordinator will know us by
+func IdentityPublicKey(ctx context.Context) (string, error) {
+	identityKey, err := sessionFrom(ctx).identity()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(identityKey.Public().(ed25519.PublicKey)), nil
+}
+
+// The bytes that are actually signed for a request. This must match the coordinator.
+func RequestSigningPayload(path string, signedAt int64, nonce string, body []byte) []byte {
+	payload := make([]byte, 0, len(requestSignaturePrefix)+len(path)+len(nonce)+len(body)+24)
+	payload = append(payload, requestSignaturePrefix...)
+	payload = append(payload, 0)
+	payload = append(payload, []byte(path)...)
+	payload = append(payload, 0)
+	payload = strconv.AppendInt(payload, signedAt, 10)
+	payload = append(payload, 0)
+	payload = append(payload, []byte(nonce)...)
+	payload = append(payload, 0)
+	payload = append(payload, body...)
+	return payload
+}
+
+// POST a JSON body
+func post(ctx context.Context, uri string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client, err := sessionFrom(ctx).client()
+	if err != nil {
+		return nil, err
 	}
+	return do(client, req)
+}
+
+// POST a JSON body that only asks the coordinator something. Asking twice is harmless, so if the first try fails in
+// a way that might not last, we try again.
+func postQuery(ctx context.Context, uri string, body []byte) (*http.Response, error) {
+	return retry(ctx, func() (*http.Response, error) {
+		return post(ctx, uri, body)
+	})
+}
+
+// POST a JSON body, signed with our identity key
+func postSigned(ctx context.Context, uri string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if err := signRequest(req, body); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client, err := sessionFrom(ctx).client()
+	if err != nil {
+		return nil, err
+	}
+	return do(client, req)
+}
+
+func signRequest(req *http.Request, body []byte) error {
+	identityKey, err := sessionFrom(req.Context()).identity()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	signedAt := time.Now().Unix()
+	nonceHex := hex.EncodeToString(nonce)
+	signature := ed25519.Sign(identityKey, RequestSigningPayload(req.URL.Path, signedAt, nonceHex, body))
+	req.Header.Set(SignatureHeader, fmt.Sprintf("%d.%s.%s", signedAt, nonceHex, hex.EncodeToString(signature)))
 	return nil
 }
 
-// If we change the backend API, we will change this function to accomodate it
-func GetApiEndpoint(host string, feature string) (string, error) {
+// Vouch for the age recipient in one of our round 1 envelopes
+func signAgeRecipient(ctx context.Context, e *KeygenEnvelope, ceremonyID string) error {
+	identityKey, err := sessionFrom(ctx).identity()
+	if err != nil {
+		return err
+	}
+	e.SignAgeRecipient(ceremonyID, identityKey)
+	return nil
+}
+
+// POST a JSON body to an endpoint that takes an API token. Members sign the request as well, so the coordinator can
+// check their role instead.
+func postAuthorized(ctx context.Context, uri string, body []byte, member bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if member {
+		if err := signRequest(req, body); err != nil {
+			return nil, err
+		}
+	}
+	s := sessionFrom(ctx)
+	if s.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiToken)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	return do(client, req)
+}
+
+// For relaying requests that were signed elsewhere. It never presents our client certificate, since the coordinator
+// would expect the request to be signed with our key.
+func (s *Session) relay() (*http.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.relayClient == nil {
+		client, err := s.newHttpClient(false)
+		if err != nil {
+			return nil, err
+		}
+		s.relayClient = client
+	}
+	return s.relayClient, nil
+}
+
+// POST a body that was signed elsewhere, on behalf of an offline client
+func postPresigned(ctx context.Context, host, path string, body []byte, signature string) (*http.Response, error) {
+	client, err := sessionFrom(ctx).relay()
+	if err != nil {
+		return nil, err
+	}
+	u, err := apiBase(host)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+	return do(client, req)
+}
+
+func apiBase(host string) (*url.URL, error) {
 	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
-		host = "http://" + host
+		// Plain HTTP, unless we have TLS settings for this coordinator
+		if _, ok := coordinatorSettings(host); ok {
+			host = "https://" + host
+		} else {
+			host = "http://" + host
+		}
 	}
-	u, err := url.Parse(host)
+	return url.Parse(host)
+}
+
+// If we change the backend API, we will change this function to accomodate it
+func GetApiEndpoint(host string, feature string) (string, error) {
+	u, err := apiBase(host)
 	if err != nil {
 		return "", err
 	}
@@ -48,32 +274,82 @@ func GetApiEndpoint(host string, feature string) (string, error) {
 		u.Path = "/keygen/create"
 	case "JoinKeyGenCeremony":
 		u.Path = "/keygen/join"
+	case "LeaveKeyGenCeremony":
+		u.Path = "/keygen/leave"
 	case "PollKeyGenCeremony":
 		u.Path = "/keygen/poll"
 	case "SendKeygenMessage":
 		u.Path = "/keygen/send"
 	case "GetKeygenMessages":
 		u.Path = "/keygen/get-messages"
+	case "KeygenComplaint":
+		u.Path = "/keygen/complaint"
+	case "KeygenEvents":
+		u.Path = "/keygen/events"
 	case "FinalizeKeygenMessage":
 		u.Path = "/keygen/finalize"
+	case "JoinRefresh":
+		u.Path = "/keygen/refresh/join"
+	case "LeaveRefresh":
+		u.Path = "/keygen/refresh/leave"
+	case "PollRefresh":
+		u.Path = "/keygen/refresh/poll"
+	case "SendRefreshMessage":
+		u.Path = "/keygen/refresh/send"
+	case "GetRefreshMessages":
+		u.Path = "/keygen/refresh/get-messages"
+	case "ConfirmRefresh":
+		u.Path = "/keygen/refresh/confirm"
+	case "AbortRefresh":
+		u.Path = "/keygen/refresh/abort"
+	case "RefreshEvents":
+		u.Path = "/keygen/refresh/events"
+	case "InitReshare":
+		u.Path = "/keygen/reshare/create"
+	case "JoinReshare":
+		u.Path = "/keygen/reshare/join"
+	case "LeaveReshare":
+		u.Path = "/keygen/reshare/leave"
+	case "PollReshare":
+		u.Path = "/keygen/reshare/poll"
+	case "SendReshareMessage":
+		u.Path = "/keygen/reshare/send"
+	case "GetReshareMessages":
+		u.Path = "/keygen/reshare/get-messages"
+	case "ConfirmReshare":
+		u.Path = "/keygen/reshare/confirm"
+	case "AbortReshare":
+		u.Path = "/keygen/reshare/abort"
+	case "ReshareEvents":
+		u.Path = "/keygen/reshare/events"
 	case "InitSignCeremony":
 		u.Path = "/sign/create"
 	case "PollSignCeremony":
 		u.Path = "/sign/poll"
+	case "GetSignProposal":
+		u.Path = "/sign/proposal"
 	case "JoinSignCeremony":
 		u.Path = "/sign/join"
+	case "LeaveSignCeremony":
+		u.Path = "/sign/leave"
 	case "ListSignCeremony":
 		u.Path = "/sign/list"
 	case "SendSignMessage":
 		u.Path = "/sign/send"
 	case "GetSignMessages":
 		u.Path = "/sign/get-messages"
+	case "SignEvents":
+		u.Path = "/sign/events"
 	case "FinalizeSignMessage":
 		u.Path = "/sign/finalize"
 	case "GetSignature":
 		u.Path = "/sign/get"
+	case "BlameSignCeremony":
+		u.Path = "/sign/blame"
 	case "TerminateSignCeremony":
 		u.Path = "/terminate"
+	case "ArchiveGroup":
+		u.Path = "/archive"
 	default:
 		return "", fmt.Errorf("unknown feature: %s", feature)
 	}
@@ -82,8 +358,8 @@ func GetApiEndpoint(host string, feature string) (string, error) {
 }
 
 // The network handler for creating a key ceremony
-func DuctInitKeyGenCeremony(host string, req InitKeyGenRequest) (InitKeyGenResponse, error) {
-	err := InitializeHttpClient()
+func DuctInitKeyGenCeremony(ctx context.Context, host string, req InitKeyGenRequest) (InitKeyGenResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return InitKeyGenResponse{}, err
 	}
@@ -92,7 +368,7 @@ func DuctInitKeyGenCeremony(host string, req InitKeyGenRequest) (InitKeyGenRespo
 		return InitKeyGenResponse{}, err
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := post(ctx, uri, body)
 	if err != nil {
 		return InitKeyGenResponse{}, err
 	}
@@ -101,9 +377,9 @@ func DuctInitKeyGenCeremony(host string, req InitKeyGenRequest) (InitKeyGenRespo
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return InitKeyGenResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return InitKeyGenResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return InitKeyGenResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return InitKeyGenResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 
 	var response InitKeyGenResponse
@@ -115,8 +391,8 @@ func DuctInitKeyGenCeremony(host string, req InitKeyGenRequest) (InitKeyGenRespo
 }
 
 // The network handler for joining a key ceremony
-func DuctJoinKeyGenCeremony(host string, req JoinKeyGenRequest) (JoinKeyGenResponse, error) {
-	err := InitializeHttpClient()
+func DuctJoinKeyGenCeremony(ctx context.Context, host string, req JoinKeyGenRequest) (JoinKeyGenResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return JoinKeyGenResponse{}, err
 	}
@@ -125,7 +401,7 @@ func DuctJoinKeyGenCeremony(host string, req JoinKeyGenRequest) (JoinKeyGenRespo
 		return JoinKeyGenResponse{}, err
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postSigned(ctx, uri, body)
 	if err != nil {
 		return JoinKeyGenResponse{}, err
 	}
@@ -134,9 +410,9 @@ func DuctJoinKeyGenCeremony(host string, req JoinKeyGenRequest) (JoinKeyGenRespo
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return JoinKeyGenResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return JoinKeyGenResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return JoinKeyGenResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return JoinKeyGenResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 
 	var response JoinKeyGenResponse
@@ -147,9 +423,39 @@ func DuctJoinKeyGenCeremony(host string, req JoinKeyGenRequest) (JoinKeyGenRespo
 	return response, nil
 }
 
+// Give up our seat in a keygen ceremony
+func DuctLeaveKeyGenCeremony(ctx context.Context, host string, req LeaveKeyGenRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "LeaveKeyGenCeremony")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+	return nil
+}
+
 // Poll a keygen ceremony until enough participants have joined
-func DuctPollKeyGenCeremony(host string, req PollKeyGenRequest) (PollKeyGenResponse, error) {
-	err := InitializeHttpClient()
+func DuctPollKeyGenCeremony(ctx context.Context, host string, req PollKeyGenRequest) (PollKeyGenResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return PollKeyGenResponse{}, err
 	}
@@ -158,7 +464,7 @@ func DuctPollKeyGenCeremony(host string, req PollKeyGenRequest) (PollKeyGenRespo
 		return PollKeyGenResponse{}, err
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postQuery(ctx, uri, body)
 	if err != nil {
 		return PollKeyGenResponse{}, err
 	}
@@ -167,9 +473,9 @@ func DuctPollKeyGenCeremony(host string, req PollKeyGenRequest) (PollKeyGenRespo
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return PollKeyGenResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return PollKeyGenResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return PollKeyGenResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return PollKeyGenResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 
 	var response PollKeyGenResponse
@@ -181,8 +487,8 @@ func DuctPollKeyGenCeremony(host string, req PollKeyGenRequest) (PollKeyGenRespo
 }
 
 // We're kicking off a signing ceremony
-func DuctInitSignCeremony(host string, req InitSignRequest) (InitSignResponse, error) {
-	err := InitializeHttpClient()
+func DuctInitSignCeremony(ctx context.Context, host string, req InitSignRequest) (InitSignResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return InitSignResponse{}, err
 	}
@@ -191,7 +497,7 @@ func DuctInitSignCeremony(host string, req InitSignRequest) (InitSignResponse, e
 		return InitSignResponse{}, err
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postAuthorized(ctx, uri, body, req.MyPartyID != nil)
 	if err != nil {
 		return InitSignResponse{}, err
 	}
@@ -200,9 +506,9 @@ func DuctInitSignCeremony(host string, req InitSignRequest) (InitSignResponse, e
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return InitSignResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return InitSignResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return InitSignResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return InitSignResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 	var response InitSignResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
@@ -212,8 +518,8 @@ func DuctInitSignCeremony(host string, req InitSignRequest) (InitSignResponse, e
 	return response, nil
 }
 
-func DuctJoinSignCeremony(host string, req JoinSignRequest) (JoinSignResponse, error) {
-	err := InitializeHttpClient()
+func DuctJoinSignCeremony(ctx context.Context, host string, req JoinSignRequest) (JoinSignResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return JoinSignResponse{}, err
 	}
@@ -223,7 +529,7 @@ func DuctJoinSignCeremony(host string, req JoinSignRequest) (JoinSignResponse, e
 	}
 	body, _ := json.Marshal(req)
 
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postSigned(ctx, uri, body)
 	if err != nil {
 		return JoinSignResponse{}, err
 	}
@@ -232,9 +538,9 @@ func DuctJoinSignCeremony(host string, req JoinSignRequest) (JoinSignResponse, e
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return JoinSignResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return JoinSignResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return JoinSignResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return JoinSignResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 	var response JoinSignResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
@@ -244,8 +550,38 @@ func DuctJoinSignCeremony(host string, req JoinSignRequest) (JoinSignResponse, e
 	return response, nil
 }
 
-func DuctPollSignCeremony(host string, req PollSignRequest) (PollSignResponse, error) {
-	err := InitializeHttpClient()
+// Give up our seat in a signing ceremony
+func DuctLeaveSignCeremony(ctx context.Context, host string, req LeaveSignRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "LeaveSignCeremony")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+	return nil
+}
+
+func DuctPollSignCeremony(ctx context.Context, host string, req PollSignRequest) (PollSignResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return PollSignResponse{}, err
 	}
@@ -254,7 +590,7 @@ func DuctPollSignCeremony(host string, req PollSignRequest) (PollSignResponse, e
 		return PollSignResponse{}, err
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postQuery(ctx, uri, body)
 	if err != nil {
 		return PollSignResponse{}, err
 	}
@@ -263,9 +599,9 @@ func DuctPollSignCeremony(host string, req PollSignRequest) (PollSignResponse, e
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return PollSignResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return PollSignResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return PollSignResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return PollSignResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 	var response PollSignResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
@@ -275,8 +611,39 @@ func DuctPollSignCeremony(host string, req PollSignRequest) (PollSignResponse, e
 	return response, nil
 }
 
-func DuctSignList(host string, req ListSignRequest) (ListSignResponse, error) {
-	err := InitializeHttpClient()
+func DuctGetSignProposal(ctx context.Context, host string, req GetProposalRequest) (SignProposal, error) {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return SignProposal{}, err
+	}
+	uri, err := GetApiEndpoint(host, "GetSignProposal")
+	if err != nil {
+		return SignProposal{}, err
+	}
+	body, _ := json.Marshal(req)
+	resp, err := postQuery(ctx, uri, body)
+	if err != nil {
+		return SignProposal{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return SignProposal{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return SignProposal{}, CoordinatorError{Status: resp.StatusCode}
+	}
+	var response SignProposal
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return SignProposal{}, err
+	}
+	return response, nil
+}
+
+func DuctSignList(ctx context.Context, host string, req ListSignRequest) (ListSignResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return ListSignResponse{}, err
 	}
@@ -288,7 +655,7 @@ func DuctSignList(host string, req ListSignRequest) (ListSignResponse, error) {
 	if err != nil {
 		return ListSignResponse{}, err
 	}
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postQuery(ctx, uri, body)
 	if err != nil {
 		return ListSignResponse{}, err
 	}
@@ -297,9 +664,9 @@ func DuctSignList(host string, req ListSignRequest) (ListSignResponse, error) {
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return ListSignResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return ListSignResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return ListSignResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return ListSignResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 	var response ListSignResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
@@ -310,8 +677,8 @@ func DuctSignList(host string, req ListSignRequest) (ListSignResponse, error) {
 }
 
 // Get keygen protocol messages
-func DuctKeygenGetMessages(host string, groupID string, myPartyID uint16, lastSeen int64) (KeyGenMessageResponse, error) {
-	err := InitializeHttpClient()
+func DuctKeygenGetMessages(ctx context.Context, host string, groupID string, myPartyID uint16, lastSeen int64) (KeyGenMessageResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return KeyGenMessageResponse{}, err
 	}
@@ -325,7 +692,7 @@ func DuctKeygenGetMessages(host string, groupID string, myPartyID uint16, lastSe
 		LastSeen:  lastSeen,
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postQuery(ctx, uri, body)
 	if err != nil {
 		return KeyGenMessageResponse{}, err
 	}
@@ -334,9 +701,9 @@ func DuctKeygenGetMessages(host string, groupID string, myPartyID uint16, lastSe
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return KeyGenMessageResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return KeyGenMessageResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return KeyGenMessageResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return KeyGenMessageResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 	var response KeyGenMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
@@ -347,8 +714,8 @@ func DuctKeygenGetMessages(host string, groupID string, myPartyID uint16, lastSe
 }
 
 // Send keygen protocol messages
-func DuctKeygenProtocolMessage(host string, req KeyGenMessageRequest) (KeyGenMessageResponse, error) {
-	err := InitializeHttpClient()
+func DuctKeygenProtocolMessage(ctx context.Context, host string, req KeyGenMessageRequest) (KeyGenMessageResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return KeyGenMessageResponse{}, err
 	}
@@ -357,7 +724,7 @@ func DuctKeygenProtocolMessage(host string, req KeyGenMessageRequest) (KeyGenMes
 		return KeyGenMessageResponse{}, err
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postSigned(ctx, uri, body)
 	if err != nil {
 		return KeyGenMessageResponse{}, err
 	}
@@ -366,9 +733,9 @@ func DuctKeygenProtocolMessage(host string, req KeyGenMessageRequest) (KeyGenMes
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return KeyGenMessageResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return KeyGenMessageResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return KeyGenMessageResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return KeyGenMessageResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 	var response KeyGenMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
@@ -379,8 +746,8 @@ func DuctKeygenProtocolMessage(host string, req KeyGenMessageRequest) (KeyGenMes
 }
 
 // Get sign protocol messages
-func DuctSignGetMessages(host string, ceremonyID string, myPartyID uint16, lastSeen int64) (SignMessageResponse, error) {
-	err := InitializeHttpClient()
+func DuctSignGetMessages(ctx context.Context, host string, ceremonyID string, myPartyID uint16, lastSeen int64) (SignMessageResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return SignMessageResponse{}, err
 	}
@@ -394,7 +761,7 @@ func DuctSignGetMessages(host string, ceremonyID string, myPartyID uint16, lastS
 		LastSeen:   lastSeen,
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postQuery(ctx, uri, body)
 	if err != nil {
 		return SignMessageResponse{}, err
 	}
@@ -403,9 +770,9 @@ func DuctSignGetMessages(host string, ceremonyID string, myPartyID uint16, lastS
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return SignMessageResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return SignMessageResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return SignMessageResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return SignMessageResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 	var response SignMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
@@ -416,8 +783,8 @@ func DuctSignGetMessages(host string, ceremonyID string, myPartyID uint16, lastS
 }
 
 // Send sign protocol messages
-func DuctSignProtocolMessage(host string, req SignMessageRequest) (SignMessageResponse, error) {
-	err := InitializeHttpClient()
+func DuctSignProtocolMessage(ctx context.Context, host string, req SignMessageRequest) (SignMessageResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return SignMessageResponse{}, err
 	}
@@ -426,7 +793,7 @@ func DuctSignProtocolMessage(host string, req SignMessageRequest) (SignMessageRe
 		return SignMessageResponse{}, err
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postSigned(ctx, uri, body)
 	if err != nil {
 		return SignMessageResponse{}, err
 	}
@@ -435,9 +802,9 @@ func DuctSignProtocolMessage(host string, req SignMessageRequest) (SignMessageRe
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return SignMessageResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return SignMessageResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return SignMessageResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return SignMessageResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 	var response SignMessageResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
@@ -447,8 +814,37 @@ func DuctSignProtocolMessage(host string, req SignMessageRequest) (SignMessageRe
 	return response, nil
 }
 
-func DuctKeygenFinalize(host string, req KeygenFinalRequest) error {
-	err := InitializeHttpClient()
+func DuctKeygenComplaint(ctx context.Context, host string, req KeygenComplaintRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "KeygenComplaint")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+	return nil
+}
+
+func DuctKeygenFinalize(ctx context.Context, host string, req KeygenFinalRequest) error {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -460,7 +856,7 @@ func DuctKeygenFinalize(host string, req KeygenFinalRequest) error {
 	if err != nil {
 		return err
 	}
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postSigned(ctx, uri, body)
 	if err != nil {
 		return err
 	}
@@ -469,15 +865,15 @@ func DuctKeygenFinalize(host string, req KeygenFinalRequest) error {
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return fmt.Errorf("request failed: %s", errResp.Error)
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return CoordinatorError{Status: resp.StatusCode}
 	}
 	return nil
 }
 
-func DuctSignFinalize(host string, req SignFinalRequest) error {
-	err := InitializeHttpClient()
+func DuctSignFinalize(ctx context.Context, host string, req SignFinalRequest) error {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -489,7 +885,7 @@ func DuctSignFinalize(host string, req SignFinalRequest) error {
 	if err != nil {
 		return err
 	}
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postSigned(ctx, uri, body)
 	if err != nil {
 		return err
 	}
@@ -498,15 +894,15 @@ func DuctSignFinalize(host string, req SignFinalRequest) error {
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return fmt.Errorf("request failed: %s", errResp.Error)
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return CoordinatorError{Status: resp.StatusCode}
 	}
 	return nil
 }
 
-func DuctGetSignature(host string, req GetSignRequest) (GetSignResponse, error) {
-	err := InitializeHttpClient()
+func DuctGetSignature(ctx context.Context, host string, req GetSignRequest) (GetSignResponse, error) {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return GetSignResponse{}, err
 	}
@@ -515,7 +911,7 @@ func DuctGetSignature(host string, req GetSignRequest) (GetSignResponse, error)
 		return GetSignResponse{}, err
 	}
 	body, _ := json.Marshal(req)
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postQuery(ctx, uri, body)
 	if err != nil {
 		return GetSignResponse{}, err
 	}
@@ -524,9 +920,9 @@ func DuctGetSignature(host string, req GetSignRequest) (GetSignResponse, error)
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return GetSignResponse{}, fmt.Errorf("request failed: %s", errResp.Error)
+			return GetSignResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return GetSignResponse{}, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return GetSignResponse{}, CoordinatorError{Status: resp.StatusCode}
 	}
 
 	var response GetSignResponse
@@ -537,8 +933,46 @@ func DuctGetSignature(host string, req GetSignRequest) (GetSignResponse, error)
 	return response, nil
 }
 
-func DuctTerminateSignCeremony(host string, req TerminateRequest) error {
-	err := InitializeHttpClient()
+func DuctSignBlame(ctx context.Context, host string, req BlameRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "BlameSignCeremony")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response VapidResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "OK" {
+		return fmt.Errorf("blame report failed: %s", response.Status)
+	}
+	return nil
+}
+
+func DuctTerminateSignCeremony(ctx context.Context, host string, req TerminateRequest) error {
+	err := InitializeHttpClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -550,7 +984,7 @@ func DuctTerminateSignCeremony(host string, req TerminateRequest) error {
 	if err != nil {
 		return err
 	}
-	resp, err := httpClient.Post(uri, "application/json", bytes.NewReader(body))
+	resp, err := postAuthorized(ctx, uri, body, req.MyPartyID != 0)
 	if err != nil {
 		return err
 	}
@@ -559,9 +993,9 @@ func DuctTerminateSignCeremony(host string, req TerminateRequest) error {
 	if resp.StatusCode != http.StatusOK {
 		var errResp ResponseErrorPage
 		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
-			return fmt.Errorf("request failed: %s", errResp.Error)
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
 		}
-		return fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+		return CoordinatorError{Status: resp.StatusCode}
 	}
 
 	var response VapidResponse
@@ -574,3 +1008,577 @@ func DuctTerminateSignCeremony(host string, req TerminateRequest) error {
 	}
 	return nil
 }
+
+func DuctArchiveGroup(ctx context.Context, host string, req ArchiveRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "ArchiveGroup")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postAuthorized(ctx, uri, body, req.MyPartyID != 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response VapidResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "OK" {
+		return fmt.Errorf("archiving failed: %s", response.Status)
+	}
+	return nil
+}
+
+// Join (or start) a refresh of a group's shares
+func DuctJoinRefresh(ctx context.Context, host string, req RefreshJoinRequest) (RefreshJoinResponse, error) {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return RefreshJoinResponse{}, err
+	}
+	uri, err := GetApiEndpoint(host, "JoinRefresh")
+	if err != nil {
+		return RefreshJoinResponse{}, err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return RefreshJoinResponse{}, err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return RefreshJoinResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return RefreshJoinResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return RefreshJoinResponse{}, CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response RefreshJoinResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return RefreshJoinResponse{}, err
+	}
+	return response, nil
+}
+
+func DuctPollRefresh(ctx context.Context, host string, req PollRefreshRequest) (PollRefreshResponse, error) {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return PollRefreshResponse{}, err
+	}
+	uri, err := GetApiEndpoint(host, "PollRefresh")
+	if err != nil {
+		return PollRefreshResponse{}, err
+	}
+	body, _ := json.Marshal(req)
+	resp, err := postQuery(ctx, uri, body)
+	if err != nil {
+		return PollRefreshResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return PollRefreshResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return PollRefreshResponse{}, CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response PollRefreshResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return PollRefreshResponse{}, err
+	}
+	return response, nil
+}
+
+// Get refresh protocol messages
+func DuctRefreshGetMessages(ctx context.Context, host string, refreshID string, myPartyID uint16, lastSeen int64) (RefreshMessageResponse, error) {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return RefreshMessageResponse{}, err
+	}
+	uri, err := GetApiEndpoint(host, "GetRefreshMessages")
+	if err != nil {
+		return RefreshMessageResponse{}, err
+	}
+	req := RefreshMessageRequest{
+		RefreshID: refreshID,
+		MyPartyID: myPartyID,
+		LastSeen:  lastSeen,
+	}
+	body, _ := json.Marshal(req)
+	resp, err := postQuery(ctx, uri, body)
+	if err != nil {
+		return RefreshMessageResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return RefreshMessageResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return RefreshMessageResponse{}, CoordinatorError{Status: resp.StatusCode}
+	}
+	var response RefreshMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return RefreshMessageResponse{}, err
+	}
+	return response, nil
+}
+
+// Send refresh protocol messages
+func DuctRefreshProtocolMessage(ctx context.Context, host string, req RefreshMessageRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "SendRefreshMessage")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response VapidResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "OK" {
+		return fmt.Errorf("refresh message failed: %s", response.Status)
+	}
+	return nil
+}
+
+func DuctRefreshConfirm(ctx context.Context, host string, req RefreshConfirmRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "ConfirmRefresh")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response VapidResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "OK" {
+		return fmt.Errorf("refresh confirmation failed: %s", response.Status)
+	}
+	return nil
+}
+
+// Give up our seat in a refresh
+func DuctLeaveRefresh(ctx context.Context, host string, req RefreshLeaveRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "LeaveRefresh")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+	return nil
+}
+
+func DuctRefreshAbort(ctx context.Context, host string, req RefreshAbortRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "AbortRefresh")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response VapidResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "OK" {
+		return fmt.Errorf("refresh abort failed: %s", response.Status)
+	}
+	return nil
+}
+
+// Propose a reshare for a group
+func DuctInitReshare(ctx context.Context, host string, req InitReshareRequest) (InitReshareResponse, error) {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return InitReshareResponse{}, err
+	}
+	uri, err := GetApiEndpoint(host, "InitReshare")
+	if err != nil {
+		return InitReshareResponse{}, err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return InitReshareResponse{}, err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return InitReshareResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return InitReshareResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return InitReshareResponse{}, CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response InitReshareResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return InitReshareResponse{}, err
+	}
+	return response, nil
+}
+
+// Join the reshare in progress for a group
+func DuctJoinReshare(ctx context.Context, host string, req ReshareJoinRequest) (ReshareJoinResponse, error) {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return ReshareJoinResponse{}, err
+	}
+	uri, err := GetApiEndpoint(host, "JoinReshare")
+	if err != nil {
+		return ReshareJoinResponse{}, err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return ReshareJoinResponse{}, err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return ReshareJoinResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return ReshareJoinResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return ReshareJoinResponse{}, CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response ReshareJoinResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return ReshareJoinResponse{}, err
+	}
+	return response, nil
+}
+
+func DuctPollReshare(ctx context.Context, host string, req PollReshareRequest) (PollReshareResponse, error) {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return PollReshareResponse{}, err
+	}
+	uri, err := GetApiEndpoint(host, "PollReshare")
+	if err != nil {
+		return PollReshareResponse{}, err
+	}
+	body, _ := json.Marshal(req)
+	resp, err := postQuery(ctx, uri, body)
+	if err != nil {
+		return PollReshareResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return PollReshareResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return PollReshareResponse{}, CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response PollReshareResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return PollReshareResponse{}, err
+	}
+	return response, nil
+}
+
+// Get reshare protocol messages
+func DuctReshareGetMessages(ctx context.Context, host string, reshareID string, myPartyID uint16, lastSeen int64) (ReshareMessageResponse, error) {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return ReshareMessageResponse{}, err
+	}
+	uri, err := GetApiEndpoint(host, "GetReshareMessages")
+	if err != nil {
+		return ReshareMessageResponse{}, err
+	}
+	req := ReshareMessageRequest{
+		ReshareID: reshareID,
+		MyPartyID: myPartyID,
+		LastSeen:  lastSeen,
+	}
+	body, _ := json.Marshal(req)
+	resp, err := postQuery(ctx, uri, body)
+	if err != nil {
+		return ReshareMessageResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return ReshareMessageResponse{}, CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return ReshareMessageResponse{}, CoordinatorError{Status: resp.StatusCode}
+	}
+	var response ReshareMessageResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return ReshareMessageResponse{}, err
+	}
+	return response, nil
+}
+
+// Send reshare protocol messages
+func DuctReshareProtocolMessage(ctx context.Context, host string, req ReshareMessageRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "SendReshareMessage")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response VapidResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "OK" {
+		return fmt.Errorf("reshare message failed: %s", response.Status)
+	}
+	return nil
+}
+
+func DuctReshareConfirm(ctx context.Context, host string, req ReshareConfirmRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "ConfirmReshare")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response VapidResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "OK" {
+		return fmt.Errorf("reshare confirmation failed: %s", response.Status)
+	}
+	return nil
+}
+
+// Give up our seat in a reshare
+func DuctLeaveReshare(ctx context.Context, host string, req ReshareLeaveRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "LeaveReshare")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+	return nil
+}
+
+func DuctReshareAbort(ctx context.Context, host string, req ReshareAbortRequest) error {
+	err := InitializeHttpClient(ctx)
+	if err != nil {
+		return err
+	}
+	uri, err := GetApiEndpoint(host, "AbortReshare")
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := postSigned(ctx, uri, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ResponseErrorPage
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			return CoordinatorError{Status: resp.StatusCode, Message: errResp.Error}
+		}
+		return CoordinatorError{Status: resp.StatusCode}
+	}
+
+	var response VapidResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+	if response.Status != "OK" {
+		return fmt.Errorf("reshare abort failed: %s", response.Status)
+	}
+	return nil
+}
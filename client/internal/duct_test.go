@@ -1,16 +1,24 @@
 package internal_test
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/soatok/freeon/client/internal"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestDuct(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case "/keygen/create":
@@ -49,8 +57,19 @@ func TestDuct(t *testing.T) {
 			resp := internal.ListSignResponse{Ceremonies: []internal.FreeonCeremonySummary{{Uid: "test-ceremony"}}}
 			json.NewEncoder(w).Encode(resp)
 		case "/keygen/send":
+			// Protocol messages must be signed by our identity key
+			body, _ := io.ReadAll(r.Body)
+			pkHex, err := internal.IdentityPublicKey(context.Background())
+			assert.NoError(t, err)
+			pk, _ := hex.DecodeString(pkHex)
+			parts := strings.Split(r.Header.Get(internal.SignatureHeader), ".")
+			assert.Len(t, parts, 3)
+			signedAt, _ := strconv.ParseInt(parts[0], 10, 64)
+			assert.InDelta(t, time.Now().Unix(), signedAt, 60)
+			sig, _ := hex.DecodeString(parts[2])
+			assert.True(t, ed25519.Verify(pk, internal.RequestSigningPayload(r.URL.Path, signedAt, parts[1], body), sig))
 			var req internal.KeyGenMessageRequest
-			json.NewDecoder(r.Body).Decode(&req)
+			json.Unmarshal(body, &req)
 			resp := internal.KeyGenMessageResponse{LatestMessageID: 1, Messages: []string{"test-message"}}
 			json.NewEncoder(w).Encode(resp)
 		case "/sign/send":
@@ -74,13 +93,13 @@ func TestDuct(t *testing.T) {
 
 	// Test DuctInitKeyGenCeremony
 	initKeyGenReq := internal.InitKeyGenRequest{Participants: 2, Threshold: 2}
-	initKeyGenResp, err := internal.DuctInitKeyGenCeremony(server.URL, initKeyGenReq)
+	initKeyGenResp, err := internal.DuctInitKeyGenCeremony(context.Background(), server.URL, initKeyGenReq)
 	assert.NoError(t, err)
 	assert.Equal(t, "test-group", initKeyGenResp.GroupID)
 
 	// Test DuctJoinKeyGenCeremony
 	joinKeyGenReq := internal.JoinKeyGenRequest{GroupID: "test-group"}
-	joinKeyGenResp, err := internal.DuctJoinKeyGenCeremony(server.URL, joinKeyGenReq)
+	joinKeyGenResp, err := internal.DuctJoinKeyGenCeremony(context.Background(), server.URL, joinKeyGenReq)
 	assert.NoError(t, err)
 	assert.True(t, joinKeyGenResp.Status)
 	assert.Equal(t, uint16(1), joinKeyGenResp.MyPartyID)
@@ -88,7 +107,7 @@ func TestDuct(t *testing.T) {
 	// Test DuctPollKeyGenCeremony
 	var partyID uint16 = 1
 	pollKeyGenReq := internal.PollKeyGenRequest{GroupID: "test-group", PartyID: &partyID}
-	pollKeyGenResp, err := internal.DuctPollKeyGenCeremony(server.URL, pollKeyGenReq)
+	pollKeyGenResp, err := internal.DuctPollKeyGenCeremony(context.Background(), server.URL, pollKeyGenReq)
 	assert.NoError(t, err)
 	assert.Equal(t, "test-group", pollKeyGenResp.GroupID)
 	assert.Equal(t, uint16(2), pollKeyGenResp.PartySize)
@@ -97,19 +116,19 @@ func TestDuct(t *testing.T) {
 
 	// Test DuctInitSignCeremony
 	initSignReq := internal.InitSignRequest{GroupID: "test-group", MessageHash: "test-hash"}
-	initSignResp, err := internal.DuctInitSignCeremony(server.URL, initSignReq)
+	initSignResp, err := internal.DuctInitSignCeremony(context.Background(), server.URL, initSignReq)
 	assert.NoError(t, err)
 	assert.Equal(t, "test-ceremony", initSignResp.CeremonyID)
 
 	// Test DuctJoinSignCeremony
 	joinSignReq := internal.JoinSignRequest{CeremonyID: "test-ceremony", MessageHash: "test-hash", MyPartyID: 1}
-	joinSignResp, err := internal.DuctJoinSignCeremony(server.URL, joinSignReq)
+	joinSignResp, err := internal.DuctJoinSignCeremony(context.Background(), server.URL, joinSignReq)
 	assert.NoError(t, err)
 	assert.True(t, joinSignResp.Status)
 
 	// Test DuctPollSignCeremony
 	pollSignReq := internal.PollSignRequest{CeremonyID: "test-ceremony", PartyID: &partyID}
-	pollSignResp, err := internal.DuctPollSignCeremony(server.URL, pollSignReq)
+	pollSignResp, err := internal.DuctPollSignCeremony(context.Background(), server.URL, pollSignReq)
 	assert.NoError(t, err)
 	assert.Equal(t, "test-group", pollSignResp.GroupID)
 	assert.Equal(t, uint16(2), pollSignResp.Threshold)
@@ -117,32 +136,32 @@ func TestDuct(t *testing.T) {
 
 	// Test DuctSignList
 	listSignReq := internal.ListSignRequest{GroupID: "test-group"}
-	listSignResp, err := internal.DuctSignList(server.URL, listSignReq)
+	listSignResp, err := internal.DuctSignList(context.Background(), server.URL, listSignReq)
 	assert.NoError(t, err)
 	assert.Len(t, listSignResp.Ceremonies, 1)
 	assert.Equal(t, "test-ceremony", listSignResp.Ceremonies[0].Uid)
 
 	// Test DuctKeygenProtocolMessage
 	keygenMsgReq := internal.KeyGenMessageRequest{GroupID: "test-group", MyPartyID: 1, Message: "test-message"}
-	keygenMsgResp, err := internal.DuctKeygenProtocolMessage(server.URL, keygenMsgReq)
+	keygenMsgResp, err := internal.DuctKeygenProtocolMessage(context.Background(), server.URL, keygenMsgReq)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), keygenMsgResp.LatestMessageID)
 	assert.Equal(t, []string{"test-message"}, keygenMsgResp.Messages)
 
 	// Test DuctSignProtocolMessage
 	signMsgReq := internal.SignMessageRequest{CeremonyID: "test-ceremony", MyPartyID: 1, Message: "test-message"}
-	signMsgResp, err := internal.DuctSignProtocolMessage(server.URL, signMsgReq)
+	signMsgResp, err := internal.DuctSignProtocolMessage(context.Background(), server.URL, signMsgReq)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), signMsgResp.LatestMessageID)
 	assert.Equal(t, []string{"test-message"}, signMsgResp.Messages)
 
 	// Test DuctKeygenFinalize
 	keygenFinalReq := internal.KeygenFinalRequest{GroupID: "test-group", MyPartyID: 1, PublicKey: "test-pk"}
-	err = internal.DuctKeygenFinalize(server.URL, keygenFinalReq)
+	err = internal.DuctKeygenFinalize(context.Background(), server.URL, keygenFinalReq)
 	assert.NoError(t, err)
 
 	// Test DuctSignFinalize
 	signFinalReq := internal.SignFinalRequest{CeremonyID: "test-ceremony", MyPartyID: 1, Signature: "test-sig"}
-	err = internal.DuctSignFinalize(server.URL, signFinalReq)
+	err = internal.DuctSignFinalize(context.Background(), server.URL, signFinalReq)
 	assert.NoError(t, err)
 }
@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"filippo.io/age"
+	"github.com/bytemare/dkg"
+	"github.com/bytemare/ecc"
+)
+
+// Every keygen protocol message is wrapped in an envelope before it is handed to the coordinator.
+// This lets us tell the message types apart, and carry the metadata needed to seal round 2 shares.
+type KeygenEnvelope struct {
+	Type      string `json:"type"`
+	Sender    uint16 `json:"sender"`
+	Recipient uint16 `json:"recipient,omitempty"`
+	// Round 1 only: the ephemeral age recipient that round 2 shares for the sender must be sealed to
+	AgeRecipient string `json:"age-recipient,omitempty"`
+	// Hex-encoded signature over the age recipient with the sender's identity key, so the coordinator can't swap in
+	// a key of its own
+	RecipientSignature string `json:"recipient-signature,omitempty"`
+	// Hex-encoded. For round 2, this is age ciphertext.
+	Payload string `json:"payload"`
+}
+
+const (
+	EnvelopeDKGRound1     = "dkg-r1"
+	EnvelopeDKGRound2     = "dkg-r2"
+	EnvelopeRefreshRound1 = "refresh-r1"
+	EnvelopeRefreshRound2 = "refresh-r2"
+	EnvelopeReshareRound1 = "reshare-r1"
+	EnvelopeReshareRound2 = "reshare-r2"
+)
+
+func (e KeygenEnvelope) Encode() []byte {
+	encoded, _ := json.Marshal(e)
+	return encoded
+}
+
+func DecodeKeygenEnvelope(data []byte) (KeygenEnvelope, error) {
+	var e KeygenEnvelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return KeygenEnvelope{}, err
+	}
+	if e.Type == "" {
+		return KeygenEnvelope{}, errors.New("envelope has no type")
+	}
+	return e, nil
+}
+
+const ageRecipientSignaturePrefix = "FREEON Age Recipient v1"
+
+// The bytes that are actually signed to vouch for an age recipient, bound to one ceremony
+func ageRecipientSigningPayload(ceremonyID string, e KeygenEnvelope) []byte {
+	payload := []byte(ageRecipientSignaturePrefix)
+	payload = append(payload, 0)
+	payload = append(payload, e.Type...)
+	payload = append(payload, 0)
+	payload = append(payload, ceremonyID...)
+	payload = append(payload, 0)
+	payload = binary.BigEndian.AppendUint16(payload, e.Sender)
+	payload = append(payload, e.AgeRecipient...)
+	return payload
+}
+
+// Sign the age recipient in a round 1 envelope with our identity key
+func (e *KeygenEnvelope) SignAgeRecipient(ceremonyID string, identity ed25519.PrivateKey) {
+	e.RecipientSignature = hex.EncodeToString(ed25519.Sign(identity, ageRecipientSigningPayload(ceremonyID, *e)))
+}
+
+// Make sure the age recipient in a round 1 envelope came from its sender, and not whoever relayed it
+func (e KeygenEnvelope) VerifyAgeRecipient(ceremonyID string, identityKeys map[uint16]string) error {
+	publicKey, err := hex.DecodeString(identityKeys[e.Sender])
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("no identity key for party %d", e.Sender)
+	}
+	signature, err := hex.DecodeString(e.RecipientSignature)
+	if err != nil || !ed25519.Verify(publicKey, ageRecipientSigningPayload(ceremonyID, e), signature) {
+		return fmt.Errorf("party %d's age recipient isn't signed by their identity key", e.Sender)
+	}
+	return nil
+}
+
+// Wrap our round 1 broadcast, advertising the ephemeral key our round 2 shares should be sealed to
+func NewRound1Envelope(r1 *dkg.Round1Data, ephemeral *age.X25519Identity) KeygenEnvelope {
+	return KeygenEnvelope{
+		Type:         EnvelopeDKGRound1,
+		Sender:       r1.SenderIdentifier,
+		AgeRecipient: ephemeral.Recipient().String(),
+		Payload:      hex.EncodeToString(r1.Encode()),
+	}
+}
+
+// Unwrap a round 1 broadcast
+func OpenRound1Envelope(e KeygenEnvelope) (*dkg.Round1Data, error) {
+	if e.Type != EnvelopeDKGRound1 {
+		return nil, fmt.Errorf("expected %s envelope, got %s", EnvelopeDKGRound1, e.Type)
+	}
+	if _, err := age.ParseX25519Recipient(e.AgeRecipient); err != nil {
+		return nil, fmt.Errorf("party %d sent an invalid age recipient: %w", e.Sender, err)
+	}
+	raw, err := hex.DecodeString(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	r1 := &dkg.Round1Data{}
+	if err := r1.Decode(raw); err != nil {
+		return nil, err
+	}
+	if r1.SenderIdentifier != e.Sender {
+		return nil, fmt.Errorf("round 1 envelope from party %d contains data for party %d", e.Sender, r1.SenderIdentifier)
+	}
+	return r1, nil
+}
+
+// Seal a round 2 share so that only its recipient can read it.
+// The coordinator only ever sees the ciphertext.
+func SealRound2(r2 *dkg.Round2Data, recipient string) (KeygenEnvelope, error) {
+	sealed, err := EncryptShare(recipient, r2.Encode())
+	if err != nil {
+		return KeygenEnvelope{}, err
+	}
+	return KeygenEnvelope{
+		Type:      EnvelopeDKGRound2,
+		Sender:    r2.SenderIdentifier,
+		Recipient: r2.RecipientIdentifier,
+		Payload:   sealed,
+	}, nil
+}
+
+// Open a round 2 share that was sealed to our ephemeral key
+func OpenRound2(e KeygenEnvelope, ephemeral *age.X25519Identity) (*dkg.Round2Data, error) {
+	if e.Type != EnvelopeDKGRound2 {
+		return nil, fmt.Errorf("expected %s envelope, got %s", EnvelopeDKGRound2, e.Type)
+	}
+	raw, err := DecryptShare(e.Payload, ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("could not open round 2 share from party %d: %w", e.Sender, err)
+	}
+	r2 := &dkg.Round2Data{}
+	if err := r2.Decode(raw); err != nil {
+		return nil, err
+	}
+	// The ciphertext is not bound to the envelope, so check the identifiers inside it
+	if r2.SenderIdentifier != e.Sender || r2.RecipientIdentifier != e.Recipient {
+		return nil, errors.New("round 2 share does not match its envelope")
+	}
+	return r2, nil
+}
+
+// Wrap our refresh commitment, advertising the ephemeral key our refresh shares should be sealed to
+func NewRefreshRound1Envelope(sender uint16, commitment []*ecc.Element, ephemeral *age.X25519Identity) KeygenEnvelope {
+	return KeygenEnvelope{
+		Type:         EnvelopeRefreshRound1,
+		Sender:       sender,
+		AgeRecipient: ephemeral.Recipient().String(),
+		Payload:      hex.EncodeToString(EncodeRefreshCommitment(commitment)),
+	}
+}
+
+// Unwrap a refresh commitment
+func OpenRefreshRound1Envelope(e KeygenEnvelope, threshold uint16) ([]*ecc.Element, error) {
+	if e.Type != EnvelopeRefreshRound1 {
+		return nil, fmt.Errorf("expected %s envelope, got %s", EnvelopeRefreshRound1, e.Type)
+	}
+	if _, err := age.ParseX25519Recipient(e.AgeRecipient); err != nil {
+		return nil, fmt.Errorf("party %d sent an invalid age recipient: %w", e.Sender, err)
+	}
+	raw, err := hex.DecodeString(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRefreshCommitment(raw, threshold)
+}
+
+// Seal a refresh share so that only its recipient can read it
+func SealRefreshShare(sender, recipient uint16, delta *ecc.Scalar, ageRecipient string) (KeygenEnvelope, error) {
+	return sealScalarShare(EnvelopeRefreshRound2, sender, recipient, delta, ageRecipient)
+}
+
+// Open a refresh share that was sealed to our ephemeral key
+func OpenRefreshShare(e KeygenEnvelope, ephemeral *age.X25519Identity) (*ecc.Scalar, error) {
+	return openScalarShare(EnvelopeRefreshRound2, e, ephemeral)
+}
+
+// Wrap our reshare round 1 broadcast.
+// Dealers include their commitment. Recipients advertise the ephemeral key their shares should be sealed to.
+func NewReshareRound1Envelope(sender uint16, commitment []*ecc.Element, ephemeral *age.X25519Identity) KeygenEnvelope {
+	return KeygenEnvelope{
+		Type:         EnvelopeReshareRound1,
+		Sender:       sender,
+		AgeRecipient: ephemeral.Recipient().String(),
+		Payload:      hex.EncodeToString(EncodeRefreshCommitment(commitment)),
+	}
+}
+
+// Unwrap a reshare round 1 broadcast. The commitment is nil if the sender isn't dealing.
+func OpenReshareRound1Envelope(e KeygenEnvelope, threshold uint16) ([]*ecc.Element, error) {
+	if e.Type != EnvelopeReshareRound1 {
+		return nil, fmt.Errorf("expected %s envelope, got %s", EnvelopeReshareRound1, e.Type)
+	}
+	if _, err := age.ParseX25519Recipient(e.AgeRecipient); err != nil {
+		return nil, fmt.Errorf("party %d sent an invalid age recipient: %w", e.Sender, err)
+	}
+	if e.Payload == "" {
+		return nil, nil
+	}
+	raw, err := hex.DecodeString(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeReshareCommitment(raw, threshold)
+}
+
+// Seal a reshare share so that only its recipient can read it
+func SealReshareShare(sender, recipient uint16, share *ecc.Scalar, ageRecipient string) (KeygenEnvelope, error) {
+	return sealScalarShare(EnvelopeReshareRound2, sender, recipient, share, ageRecipient)
+}
+
+// Open a reshare share that was sealed to our ephemeral key
+func OpenReshareShare(e KeygenEnvelope, ephemeral *age.X25519Identity) (*ecc.Scalar, error) {
+	return openScalarShare(EnvelopeReshareRound2, e, ephemeral)
+}
+
+func sealScalarShare(envelopeType string, sender, recipient uint16, share *ecc.Scalar, ageRecipient string) (KeygenEnvelope, error) {
+	sealed, err := EncryptShare(ageRecipient, EncodeRefreshShare(sender, recipient, share))
+	if err != nil {
+		return KeygenEnvelope{}, err
+	}
+	return KeygenEnvelope{
+		Type:      envelopeType,
+		Sender:    sender,
+		Recipient: recipient,
+		Payload:   sealed,
+	}, nil
+}
+
+func openScalarShare(envelopeType string, e KeygenEnvelope, ephemeral *age.X25519Identity) (*ecc.Scalar, error) {
+	if e.Type != envelopeType {
+		return nil, fmt.Errorf("expected %s envelope, got %s", envelopeType, e.Type)
+	}
+	raw, err := DecryptShare(e.Payload, ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s share from party %d: %w", envelopeType, e.Sender, err)
+	}
+	sender, recipient, share, err := DecodeRefreshShare(raw)
+	if err != nil {
+		return nil, err
+	}
+	// The ciphertext is not bound to the envelope, so check the identifiers inside it
+	if sender != e.Sender || recipient != e.Recipient {
+		return nil, fmt.Errorf("%s share does not match its envelope", envelopeType)
+	}
+	return share, nil
+}
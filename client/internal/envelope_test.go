@@ -0,0 +1,71 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/bytemare/dkg"
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeygenEnvelopes(t *testing.T) {
+	p1, err := dkg.Edwards25519Sha512.NewParticipant(1, 2, 2)
+	assert.NoError(t, err)
+	p2, err := dkg.Edwards25519Sha512.NewParticipant(2, 2, 2)
+	assert.NoError(t, err)
+	eph1, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	eph2, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+
+	// Round 1 survives an encode/decode cycle and carries the ephemeral key
+	r1 := p1.Start()
+	env, err := internal.DecodeKeygenEnvelope(internal.NewRound1Envelope(r1, eph1).Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, eph1.Recipient().String(), env.AgeRecipient)
+	opened1, err := internal.OpenRound1Envelope(env)
+	assert.NoError(t, err)
+	assert.Equal(t, r1.Encode(), opened1.Encode())
+
+	// The age recipient is vouched for by the sender's identity key, for this ceremony only
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	identityKeys := map[uint16]string{1: hex.EncodeToString(pk)}
+	assert.Error(t, env.VerifyAgeRecipient("g_test", identityKeys))
+	env.SignAgeRecipient("g_test", sk)
+	assert.NoError(t, env.VerifyAgeRecipient("g_test", identityKeys))
+	assert.Error(t, env.VerifyAgeRecipient("g_other", identityKeys))
+	swapped := env
+	swapped.AgeRecipient = eph2.Recipient().String()
+	assert.Error(t, swapped.VerifyAgeRecipient("g_test", identityKeys))
+	assert.Error(t, env.VerifyAgeRecipient("g_test", map[uint16]string{2: hex.EncodeToString(pk)}))
+
+	// Round 2 shares are sealed to the recipient's ephemeral key
+	r2, err := p1.Continue([]*dkg.Round1Data{r1, p2.Start()})
+	assert.NoError(t, err)
+	sealed, err := internal.SealRound2(r2[2], eph2.Recipient().String())
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), sealed.Sender)
+	assert.Equal(t, uint16(2), sealed.Recipient)
+
+	// The plaintext share must not appear in what the coordinator sees
+	assert.False(t, strings.Contains(string(sealed.Encode()), r2[2].SecretShare.Hex()))
+
+	opened2, err := internal.OpenRound2(sealed, eph2)
+	assert.NoError(t, err)
+	assert.Equal(t, r2[2].Encode(), opened2.Encode())
+
+	// Nobody else can open it
+	_, err = internal.OpenRound2(sealed, eph1)
+	assert.Error(t, err)
+
+	// Tampering with the envelope's routing information is detected
+	sealed.Recipient = 3
+	_, err = internal.OpenRound2(sealed, eph2)
+	assert.Error(t, err)
+}
@@ -0,0 +1,429 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long to wait between requests when the coordinator can't stream events to us
+var pollInterval = time.Second
+
+// A feed of events for one ceremony.
+//
+// Protocol messages are queued in the order the coordinator received them, and each one is handed out exactly once.
+// The ceremony state (what the poll endpoint returns) is tracked separately, since only the latest one matters.
+//
+// The coordinator pushes events to us with Server-Sent Events. If it can't, or the stream breaks, we fall back to
+// polling it every pollInterval.
+//
+// Each feed is opened with a context. When the context is done, the feed closes itself, and anyone waiting on it gets
+// the context's error.
+type Feed struct {
+	mu           sync.Mutex
+	cond         *sync.Cond
+	messages     [][]byte
+	state        json.RawMessage
+	stateVersion int
+	stateSeen    int
+	err          error
+	closed       bool
+	body         io.Closer
+	// Everything we've been sent so far, for journaling
+	received [][]byte
+	lastSeen int64
+	// Stops the feed from closing when its context is done
+	stop func() bool
+}
+
+// Where a feed got to, so a new one can pick up from there.
+// Messages in the transcript are handed out again, in order, before anything new.
+type FeedCheckpoint struct {
+	LastSeen   int64    `json:"last-seen"`
+	Transcript []string `json:"transcript"`
+}
+
+// Where a feed gets its events from
+type feedSource struct {
+	host    string
+	feature string
+	query   url.Values
+	from    FeedCheckpoint
+	// Fallbacks for when streaming is unavailable
+	pollMessages func(lastSeen int64) ([]string, int64, error)
+	pollState    func() (any, error)
+}
+
+// Follow the events for a keygen ceremony
+func OpenKeygenFeed(ctx context.Context, host, groupID string, myPartyID uint16) *Feed {
+	return OpenKeygenFeedFrom(ctx, host, groupID, myPartyID, FeedCheckpoint{})
+}
+
+// Follow the events for a keygen ceremony, starting from a checkpoint
+func OpenKeygenFeedFrom(ctx context.Context, host, groupID string, myPartyID uint16, from FeedCheckpoint) *Feed {
+	query := url.Values{}
+	query.Set("group-id", groupID)
+	query.Set("party-id", strconv.FormatUint(uint64(myPartyID), 10))
+	return openFeed(ctx, feedSource{
+		host:    host,
+		feature: "KeygenEvents",
+		query:   query,
+		from:    from,
+		pollMessages: func(lastSeen int64) ([]string, int64, error) {
+			resp, err := DuctKeygenGetMessages(ctx, host, groupID, myPartyID, lastSeen)
+			return resp.Messages, resp.LatestMessageID, err
+		},
+		pollState: func() (any, error) {
+			return DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: groupID, PartyID: &myPartyID})
+		},
+	})
+}
+
+// Follow the events for a signing ceremony
+func OpenSignFeed(ctx context.Context, host, ceremonyID string, myPartyID uint16) *Feed {
+	return OpenSignFeedFrom(ctx, host, ceremonyID, myPartyID, FeedCheckpoint{})
+}
+
+// Follow the events for a signing ceremony, starting from a checkpoint
+func OpenSignFeedFrom(ctx context.Context, host, ceremonyID string, myPartyID uint16, from FeedCheckpoint) *Feed {
+	query := url.Values{}
+	query.Set("ceremony-id", ceremonyID)
+	query.Set("party-id", strconv.FormatUint(uint64(myPartyID), 10))
+	return openFeed(ctx, feedSource{
+		host:    host,
+		feature: "SignEvents",
+		query:   query,
+		from:    from,
+		pollMessages: func(lastSeen int64) ([]string, int64, error) {
+			resp, err := DuctSignGetMessages(ctx, host, ceremonyID, myPartyID, lastSeen)
+			return resp.Messages, resp.LatestMessageID, err
+		},
+		pollState: func() (any, error) {
+			return DuctPollSignCeremony(ctx, host, PollSignRequest{CeremonyID: ceremonyID, PartyID: &myPartyID})
+		},
+	})
+}
+
+// Follow the events for a share refresh
+func OpenRefreshFeed(ctx context.Context, host, refreshID string, myPartyID uint16) *Feed {
+	query := url.Values{}
+	query.Set("refresh-id", refreshID)
+	query.Set("party-id", strconv.FormatUint(uint64(myPartyID), 10))
+	return openFeed(ctx, feedSource{
+		host:    host,
+		feature: "RefreshEvents",
+		query:   query,
+		pollMessages: func(lastSeen int64) ([]string, int64, error) {
+			resp, err := DuctRefreshGetMessages(ctx, host, refreshID, myPartyID, lastSeen)
+			return resp.Messages, resp.LatestMessageID, err
+		},
+		pollState: func() (any, error) {
+			return DuctPollRefresh(ctx, host, PollRefreshRequest{RefreshID: refreshID})
+		},
+	})
+}
+
+// Follow the events for a reshare
+func OpenReshareFeed(ctx context.Context, host, reshareID string, myPartyID uint16) *Feed {
+	query := url.Values{}
+	query.Set("reshare-id", reshareID)
+	query.Set("party-id", strconv.FormatUint(uint64(myPartyID), 10))
+	return openFeed(ctx, feedSource{
+		host:    host,
+		feature: "ReshareEvents",
+		query:   query,
+		pollMessages: func(lastSeen int64) ([]string, int64, error) {
+			resp, err := DuctReshareGetMessages(ctx, host, reshareID, myPartyID, lastSeen)
+			return resp.Messages, resp.LatestMessageID, err
+		},
+		pollState: func() (any, error) {
+			return DuctPollReshare(ctx, host, PollReshareRequest{ReshareID: reshareID})
+		},
+	})
+}
+
+func openFeed(ctx context.Context, source feedSource) *Feed {
+	f := &Feed{lastSeen: source.from.LastSeen}
+	f.cond = sync.NewCond(&f.mu)
+	for _, m := range source.from.Transcript {
+		if msg, err := hex.DecodeString(m); err == nil {
+			f.messages = append(f.messages, msg)
+			f.received = append(f.received, msg)
+		}
+	}
+	f.stop = context.AfterFunc(ctx, func() {
+		f.closeWith(context.Cause(ctx))
+	})
+	go f.run(ctx, source)
+	return f
+}
+
+// Wait for the next protocol message
+func (f *Feed) NextMessage() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.messages) == 0 && f.err == nil {
+		f.cond.Wait()
+	}
+	if len(f.messages) == 0 {
+		return nil, f.err
+	}
+	m := f.messages[0]
+	f.messages = f.messages[1:]
+	return m, nil
+}
+
+// Wait for the ceremony state to change, then decode the latest state into v
+func (f *Feed) NextState(v any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.stateVersion == f.stateSeen && f.err == nil {
+		f.cond.Wait()
+	}
+	if f.stateVersion == f.stateSeen {
+		return f.err
+	}
+	f.stateSeen = f.stateVersion
+	return json.Unmarshal(f.state, v)
+}
+
+// Wait until the ceremony state satisfies done, decoding each state into v. The latest state is checked first, even
+// if it's been seen before, so one wait can pick up where another left off.
+func (f *Feed) WaitForState(v any, done func() bool) error {
+	f.mu.Lock()
+	state := f.state
+	f.mu.Unlock()
+	if state != nil {
+		if err := json.Unmarshal(state, v); err != nil {
+			return err
+		}
+		if done() {
+			return nil
+		}
+	}
+	for {
+		if err := f.NextState(v); err != nil {
+			return err
+		}
+		if done() {
+			return nil
+		}
+	}
+}
+
+// Everything the feed has been sent so far, including messages nobody has asked for yet
+func (f *Feed) Checkpoint() FeedCheckpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	transcript := make([]string, len(f.received))
+	for i, m := range f.received {
+		transcript[i] = hex.EncodeToString(m)
+	}
+	return FeedCheckpoint{LastSeen: f.lastSeen, Transcript: transcript}
+}
+
+// Stop following the ceremony
+func (f *Feed) Close() {
+	f.stop()
+	f.closeWith(errors.New("feed closed"))
+}
+
+// Stop following the ceremony, and hand err to anyone still waiting
+func (f *Feed) closeWith(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.body != nil {
+		f.body.Close()
+	}
+	if f.err == nil {
+		f.err = err
+	}
+	f.cond.Broadcast()
+}
+
+func (f *Feed) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// Queue a batch of messages, which runs up to the message with ID lastSeen
+func (f *Feed) pushMessages(batch [][]byte, lastSeen int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, batch...)
+	f.received = append(f.received, batch...)
+	if lastSeen > f.lastSeen {
+		f.lastSeen = lastSeen
+	}
+	f.cond.Broadcast()
+}
+
+func (f *Feed) pushState(state []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if bytes.Equal(state, f.state) {
+		return
+	}
+	f.state = state
+	f.stateVersion++
+	f.cond.Broadcast()
+}
+
+func (f *Feed) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+	f.cond.Broadcast()
+}
+
+func (f *Feed) run(ctx context.Context, source feedSource) {
+	if link := sessionFrom(ctx).offline; link != nil {
+		f.replayBundle(link, source)
+		return
+	}
+	lastSeen, err := f.stream(ctx, source, source.from.LastSeen)
+	if f.isClosed() {
+		return
+	}
+	if err != nil {
+		// Not fatal; we can still poll
+		f.pollFrom(ctx, source, lastSeen)
+	}
+}
+
+// Read Server-Sent Events until the stream ends.
+// Returns the ID of the last message we got, so polling can pick up where the stream left off.
+func (f *Feed) stream(ctx context.Context, source feedSource, lastSeen int64) (int64, error) {
+	client, err := sessionFrom(ctx).client()
+	if err != nil {
+		return lastSeen, err
+	}
+	uri, err := GetApiEndpoint(source.host, source.feature)
+	if err != nil {
+		return lastSeen, err
+	}
+	query := url.Values{}
+	for k, v := range source.query {
+		query[k] = v
+	}
+	if lastSeen > 0 {
+		query.Set("last-seen", strconv.FormatInt(lastSeen, 10))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri+"?"+query.Encode(), nil)
+	if err != nil {
+		return lastSeen, err
+	}
+	// The stream stays open for as long as the ceremony does, so the request timeout doesn't apply
+	resp, err := client.Do(req)
+	if err != nil {
+		return lastSeen, err
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body.Close()
+		return lastSeen, fmt.Errorf("event stream unavailable: status code %d", resp.StatusCode)
+	}
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		resp.Body.Close()
+		return lastSeen, nil
+	}
+	f.body = resp.Body
+	f.mu.Unlock()
+	defer resp.Body.Close()
+
+	var id, event string
+	var data []string
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return lastSeen, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			// Accumulate fields until we reach the blank line that ends an event
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "id":
+				id = value
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			}
+			continue
+		}
+
+		payload := strings.Join(data, "\n")
+		switch event {
+		case "message":
+			if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+				lastSeen = n
+			}
+			msg, err := hex.DecodeString(payload)
+			if err == nil {
+				f.pushMessages([][]byte{msg}, lastSeen)
+			}
+		case "state":
+			f.pushState([]byte(payload))
+		case "error":
+			var message string
+			json.Unmarshal([]byte(payload), &message)
+			f.fail(fmt.Errorf("coordinator error: %s", message))
+			return lastSeen, nil
+		}
+		id, event, data = "", "", nil
+	}
+}
+
+// Ask the coordinator for new messages and the latest state, every pollInterval
+func (f *Feed) pollFrom(ctx context.Context, source feedSource, lastSeen int64) {
+	for !f.isClosed() {
+		messages, latest, err := source.pollMessages(lastSeen)
+		if err != nil {
+			f.fail(err)
+			return
+		}
+		var batch [][]byte
+		for _, m := range messages {
+			msg, err := hex.DecodeString(m)
+			if err == nil {
+				batch = append(batch, msg)
+			}
+		}
+		f.pushMessages(batch, latest)
+		lastSeen = latest
+
+		state, err := source.pollState()
+		if err != nil {
+			f.fail(err)
+			return
+		}
+		encoded, err := json.Marshal(state)
+		if err == nil {
+			f.pushState(encoded)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
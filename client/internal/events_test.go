@@ -0,0 +1,166 @@
+package internal_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignFeedStreaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sign/events":
+			assert.Equal(t, "test-ceremony", r.URL.Query().Get("ceremony-id"))
+			assert.Equal(t, "1", r.URL.Query().Get("party-id"))
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: state\ndata: {\"group-id\":\"test-group\",\"parties\":[2]}\n\n")
+			fmt.Fprintf(w, ": keepalive\n\n")
+			fmt.Fprintf(w, "id: 1\nevent: message\ndata: %s\n\n", hex.EncodeToString([]byte("first")))
+			fmt.Fprintf(w, "id: 2\nevent: message\ndata: %s\n\n", hex.EncodeToString([]byte("second")))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	feed := internal.OpenSignFeed(context.Background(), server.URL, "test-ceremony", 1)
+	defer feed.Close()
+
+	var state internal.PollSignResponse
+	assert.NoError(t, feed.NextState(&state))
+	assert.Equal(t, "test-group", state.GroupID)
+	assert.Equal(t, []uint16{2}, state.OtherParties)
+
+	msg, err := feed.NextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("first"), msg)
+	msg, err = feed.NextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("second"), msg)
+}
+
+func TestSignFeedPollingFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sign/events":
+			// An older coordinator without streaming
+			http.NotFound(w, r)
+		case "/sign/get-messages":
+			var req internal.SignMessageRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			resp := internal.SignMessageResponse{LatestMessageID: 2}
+			if req.LastSeen < 2 {
+				resp.Messages = []string{hex.EncodeToString([]byte("first")), hex.EncodeToString([]byte("second"))}
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/sign/poll":
+			resp := internal.PollSignResponse{GroupID: "test-group", Threshold: 2, OtherParties: []uint16{2}}
+			json.NewEncoder(w).Encode(resp)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	feed := internal.OpenSignFeed(context.Background(), server.URL, "test-ceremony", 1)
+	defer feed.Close()
+
+	var state internal.PollSignResponse
+	assert.NoError(t, feed.NextState(&state))
+	assert.Equal(t, uint16(2), state.Threshold)
+
+	// Each message is only handed out once, even though we keep polling
+	for _, expected := range []string{"first", "second"} {
+		msg, err := feed.NextMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(expected), msg)
+	}
+}
+
+func TestSignFeedResumesFromCheckpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sign/events":
+			// We only get what we haven't seen yet
+			assert.Equal(t, "2", r.URL.Query().Get("last-seen"))
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "id: 3\nevent: message\ndata: %s\n\n", hex.EncodeToString([]byte("third")))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	from := internal.FeedCheckpoint{
+		LastSeen:   2,
+		Transcript: []string{hex.EncodeToString([]byte("first")), hex.EncodeToString([]byte("second"))},
+	}
+	feed := internal.OpenSignFeedFrom(context.Background(), server.URL, "test-ceremony", 1, from)
+	defer feed.Close()
+
+	// Everything we'd already received comes back first, in order
+	for _, expected := range []string{"first", "second", "third"} {
+		msg, err := feed.NextMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(expected), msg)
+	}
+	checkpoint := feed.Checkpoint()
+	assert.Equal(t, int64(3), checkpoint.LastSeen)
+	assert.Len(t, checkpoint.Transcript, 3)
+}
+
+func TestFeedWaitForState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: state\ndata: {\"group-id\":\"test-group\",\"t\":2,\"parties\":[2]}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	feed := internal.OpenSignFeed(context.Background(), server.URL, "test-ceremony", 1)
+	defer feed.Close()
+
+	var state internal.PollSignResponse
+	assert.NoError(t, feed.NextState(&state))
+
+	// A state someone else already looked at still counts
+	var again internal.PollSignResponse
+	err := feed.WaitForState(&again, func() bool {
+		return len(again.OtherParties)+1 >= int(again.Threshold)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "test-group", again.GroupID)
+}
+
+func TestFeedContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	feed := internal.OpenSignFeed(ctx, server.URL, "test-ceremony", 1)
+	defer feed.Close()
+
+	// Nobody ever sends anything, so only the context can end the wait
+	go cancel()
+	_, err := feed.NextMessage()
+	assert.ErrorIs(t, err, context.Canceled)
+}
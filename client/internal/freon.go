@@ -1,329 +1,1521 @@
 package internal
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"hash"
-	"os"
+	"io"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
+	"filippo.io/age"
 	"github.com/bytemare/dkg"
 	"github.com/bytemare/ecc"
 	"github.com/bytemare/frost"
+	secretsharing "github.com/bytemare/secret-sharing"
 	"github.com/bytemare/secret-sharing/keys"
 )
 
-// The default timeout for the FROST protocol.
-// 1 hour is eventually to allow complex key ceremonies involving airgapped machines.
-var timeout time.Duration = time.Hour
-
-// The ID of the last message seen. Sent with HTTP requests to fetch more messages.
-var lastMessageIdSeen int64
-
-// Used for determining which party should report the final result to the ceremony
-var ceremonyHash hash.Hash
-
-// Two prefixes for initializing the ceremony Hash state
-var ceremonyKeyGen = []byte("FREON KeyGen Ceremony v1")
+// Prefix for the hash that elects which player reports a ceremony's signature
 var ceremonySign = []byte("FREON Sign Ceremony v1")
 
 // Initialize a keygen ceremony with the coordinator
-func InitKeyGenCeremony(host string, participants uint16, threshold uint16) {
+func CreateKeyGenCeremony(ctx context.Context, host string, participants uint16, threshold uint16, deadline time.Duration) (GroupResult, error) {
 	req := InitKeyGenRequest{
 		Participants: participants,
 		Threshold:    threshold,
+		Deadline:     int64(deadline / time.Second),
 	}
-	res, err := DuctInitKeyGenCeremony(host, req)
+	res, err := DuctInitKeyGenCeremony(ctx, host, req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s", err.Error())
-		os.Exit(1)
+		return GroupResult{}, err
 	}
-	fmt.Printf("Distributed key generation ceremony created! Group ID:\n%s\n", res.GroupID)
-	os.Exit(0)
+	return GroupResult{
+		GroupID:      res.GroupID,
+		Status:       "created",
+		Threshold:    threshold,
+		Participants: participants,
+	}, nil
 }
 
-// Kicking off a key-signing ceremony
-func InitSignCeremony(host, groupID string, message []byte, openssh bool, namespace string) {
+// Kicking off a key-signing ceremony.
+// With publish, signers can download the message from the coordinator. With seal, they can too, but it's encrypted to
+// the group's members first.
+func CreateSignCeremony(ctx context.Context, host, groupID string, message []byte, openssh bool, namespace string, signers []uint16, deadline time.Duration, publish, seal bool) (CeremonyResult, error) {
 	req := InitSignRequest{
 		GroupID:     groupID,
 		MessageHash: HashMessageForSanity(message, groupID),
+		Message:     hex.EncodeToString(message),
 		OpenSSH:     openssh,
 		Namespace:   namespace,
+		Signers:     signers,
+		Deadline:    int64(deadline / time.Second),
+		MyPartyID:   proposeAs(ctx, groupID),
+		Publish:     publish,
+	}
+	if seal {
+		group, err := DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: groupID})
+		if err != nil {
+			return CeremonyResult{}, err
+		}
+		req.SealedMessage, err = SealMessage(message, group.IdentityKeys)
+		if err != nil {
+			return CeremonyResult{}, err
+		}
+		req.Message = ""
+	}
+	res, err := DuctInitSignCeremony(ctx, host, req)
+	if err != nil {
+		return CeremonyResult{}, err
+	}
+	return CeremonyResult{
+		CeremonyID: res.CeremonyID,
+		GroupID:    groupID,
+		Status:     "created",
+		Format:     ceremonyFormat(openssh, false),
+		Namespace:  namespace,
+	}, nil
+}
+
+// Who we propose signing ceremonies as: a member if we hold a share for the group, unless we were given an API token
+func proposeAs(ctx context.Context, groupID string) *uint16 {
+	if sessionFrom(ctx).apiToken != "" {
+		return nil
 	}
-	res, err := DuctInitSignCeremony(host, req)
+	myPartyID, err := localPartyID(groupID)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s", err.Error())
-		os.Exit(1)
+		return nil
 	}
-	fmt.Printf("Key signing ceremony created!\n%s\n", res.CeremonyID)
-	os.Exit(0)
+	return &myPartyID
 }
 
-func joinCeremonyAndPoll(host, groupID string) (uint16, uint16, uint16, []uint16, error) {
+// Our party ID in a group we hold a share for
+func localPartyID(groupID string) (uint16, error) {
+	config, err := LoadUserConfig()
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range config.Shares {
+		if s.GroupID == groupID {
+			return s.MyPartyID, nil
+		}
+	}
+	return 0, fmt.Errorf("you do not hold a share for group %s", groupID)
+}
+
+// Join a keygen ceremony. Returns our party ID, the threshold, and the party size.
+func joinKeyGen(ctx context.Context, host, groupID string) (uint16, uint16, uint16, error) {
 	pollRequest := PollKeyGenRequest{
 		GroupID: groupID,
 		PartyID: nil,
 	}
-	pollResponse, err := DuctPollKeyGenCeremony(host, pollRequest)
+	pollResponse, err := DuctPollKeyGenCeremony(ctx, host, pollRequest)
 	if err != nil {
-		return 0, 0, 0, nil, err
+		return 0, 0, 0, err
 	}
 
+	// Register our long-term key, which authenticates everything we send from here on out
+	publicKey, err := IdentityPublicKey(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
 	joinRequest := JoinKeyGenRequest{
-		GroupID: groupID,
+		GroupID:   groupID,
+		PublicKey: publicKey,
 	}
-	joinResponse, err := DuctJoinKeyGenCeremony(host, joinRequest)
+	joinResponse, err := DuctJoinKeyGenCeremony(ctx, host, joinRequest)
 	if err != nil {
-		return 0, 0, 0, nil, err
+		return 0, 0, 0, err
 	}
-	ceremonyHash = sha512.New384()
-	ceremonyHash.Write(ceremonyKeyGen)
+	return joinResponse.MyPartyID, pollResponse.Threshold, pollResponse.PartySize, nil
+}
 
-	myPartyID := joinResponse.MyPartyID
-	threshold := pollResponse.Threshold
-	partySize := pollResponse.PartySize
-	pollRequest.PartyID = &myPartyID
+// Wait for everyone else to join a keygen ceremony. Returns every party, starting with us, and their identity keys.
+func waitForKeygenParties(feed *Feed, myPartyID, partySize uint16) ([]uint16, map[uint16]string, error) {
+	var pollResponse PollKeyGenResponse
+	everyone := func() bool {
+		return uint16(len(pollResponse.OtherParties))+1 == partySize
+	}
+	err := feed.WaitForState(&pollResponse, func() bool {
+		return everyone() || pollResponse.Status != "open"
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if !everyone() {
+		return nil, nil, ceremonyEnded("key generation %s before everyone joined", pollResponse.Status)
+	}
 
-	for {
-		pollResponse, err = DuctPollKeyGenCeremony(host, pollRequest)
+	partyMembers := []uint16{myPartyID}
+	partyMembers = append(partyMembers, pollResponse.OtherParties...)
+	return partyMembers, pollResponse.IdentityKeys, nil
+}
+
+// Make sure the coordinator didn't slip a key of its own into a keygen ceremony. The identity keys are what we check
+// everyone's age recipient against, so they're only worth anything if they're the ones the members actually hold.
+// members are the other members' identity keys, as they gave them to us; the group has to be exactly them. With no
+// members to go on, all we can do is show the keys, so somebody can compare them with what each member's
+// "freeon identity" prints.
+func CheckKeygenMembers(identityKeys map[uint16]string, myPartyID uint16, myKey string, members []string) error {
+	if identityKeys[myPartyID] != myKey {
+		return fmt.Errorf("the coordinator has a different identity key for us (party %d)", myPartyID)
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	var expected, got []string
+	for _, m := range members {
+		expected = append(expected, strings.ToLower(m))
+	}
+	for id, key := range identityKeys {
+		if id != myPartyID {
+			got = append(got, key)
+		}
+	}
+	slices.Sort(expected)
+	slices.Sort(got)
+	if !slices.Equal(expected, got) {
+		return errors.New("the group's identity keys aren't the members we were told to expect")
+	}
+	return nil
+}
+
+// Check everyone's identity keys before we trust anything they sign
+func checkKeygenMembers(ctx context.Context, j *Journal, identityKeys map[uint16]string) error {
+	myKey, err := IdentityPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+	if err := CheckKeygenMembers(identityKeys, j.MyPartyID, myKey, j.Members); err != nil {
+		return err
+	}
+	if len(j.Members) > 0 {
+		return nil
+	}
+	var ids []uint16
+	for id := range identityKeys {
+		if id != j.MyPartyID {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	var keys strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&keys, "\n  party %d: %s", id, identityKeys[id])
+	}
+	sessionFrom(ctx).warnf("nobody vouched for the other members' identity keys (see --member); check them with each member:%s", keys.String())
+	return nil
+}
+
+func performDKGRound1(ctx context.Context, j *Journal, feed *Feed, participant *dkg.Participant, proofNonce *ecc.Scalar, partyMembers []uint16, identityKeys map[uint16]string, ephemeral *age.X25519Identity) ([]*dkg.Round1Data, map[uint16]string, error) {
+	host, groupID, myPartyID := j.Host, j.GroupID, j.MyPartyID
+	// With the same nonce, a resumed ceremony sends exactly the same message
+	r1Message := participant.StartWithRandom(proofNonce)
+	if !j.Reached(RoundDKG1) {
+		envelope := NewRound1Envelope(r1Message, ephemeral)
+		if err := signAgeRecipient(ctx, &envelope, groupID); err != nil {
+			return nil, nil, err
+		}
+		r1Bytes := envelope.Encode()
+		_, err := DuctKeygenProtocolMessage(ctx, host, KeyGenMessageRequest{
+			GroupID:   groupID,
+			Message:   hex.EncodeToString(r1Bytes),
+			MyPartyID: myPartyID,
+		})
 		if err != nil {
-			return 0, 0, 0, nil, err
+			return nil, nil, fmt.Errorf("failed to send r1 message: %w", err)
 		}
-		found := uint16(len(pollResponse.OtherParties))
-		if found+1 == partySize {
-			break
+		if err := j.Record(RoundDKG1, feed); err != nil {
+			return nil, nil, err
 		}
-		time.Sleep(time.Second)
 	}
 
-	partyMembers := []uint16{myPartyID}
-	partyMembers = append(partyMembers, pollResponse.OtherParties...)
-	return myPartyID, threshold, partySize, partyMembers, nil
+	// Each peer's round 1 message tells us which key to seal their round 2 share to
+	peerRecipients := make(map[uint16]string)
+	r1Messages := make(map[uint16]*dkg.Round1Data)
+	r1Messages[myPartyID] = r1Message
+	for len(r1Messages) < len(partyMembers) {
+		msgBytes, err := feed.NextMessage()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to wait for r1 messages: %w", err)
+		}
+		envelope, err := DecodeKeygenEnvelope(msgBytes)
+		if err != nil || envelope.Type != EnvelopeDKGRound1 {
+			continue
+		}
+		msg, err := OpenRound1Envelope(envelope)
+		if err != nil {
+			continue
+		}
+		if err := envelope.VerifyAgeRecipient(groupID, identityKeys); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := r1Messages[msg.SenderIdentifier]; !ok {
+			r1Messages[msg.SenderIdentifier] = msg
+			peerRecipients[msg.SenderIdentifier] = envelope.AgeRecipient
+		}
+	}
+	// Everyone uses the same round 1 messages in the same order, no matter when they arrived
+	var r1Data []*dkg.Round1Data
+	for _, id := range slices.Sorted(maps.Keys(r1Messages)) {
+		r1Data = append(r1Data, r1Messages[id])
+	}
+	return r1Data, peerRecipients, nil
+}
+
+// Returns the round 2 shares we could open, and the parties whose shares we could not
+func performDKGRound2(ctx context.Context, j *Journal, feed *Feed, participant *dkg.Participant, r1Data []*dkg.Round1Data, peerRecipients map[uint16]string, ephemeral *age.X25519Identity) ([]*dkg.Round2Data, []uint16, error) {
+	host, groupID, myPartyID, partySize := j.Host, j.GroupID, j.MyPartyID, j.PartySize
+	r2Messages, err := participant.Continue(r1Data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to continue dkg: %w", err)
+	}
+	if j.Reached(RoundDKG2) {
+		// Already sent
+		r2Messages = nil
+	}
+	for peer, msg := range r2Messages {
+		// Seal each share to its recipient so the coordinator only relays ciphertext
+		recipient, ok := peerRecipients[peer]
+		if !ok {
+			return nil, nil, fmt.Errorf("no round 2 key for party %d", peer)
+		}
+		envelope, err := SealRound2(msg, recipient)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to seal r2 message for party %d: %w", peer, err)
+		}
+		msgBytes := envelope.Encode()
+		_, err = DuctKeygenProtocolMessage(ctx, host, KeyGenMessageRequest{
+			GroupID:   groupID,
+			Message:   hex.EncodeToString(msgBytes),
+			MyPartyID: myPartyID,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to send r2 message: %w", err)
+		}
+	}
+	if !j.Reached(RoundDKG2) {
+		if err := j.Record(RoundDKG2, feed); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	myR2Messages := make(map[uint16]*dkg.Round2Data)
+	unreadable := make(map[uint16]struct{})
+	for len(myR2Messages)+len(unreadable) < int(partySize)-1 {
+		msgBytes, err := feed.NextMessage()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to wait for r2 messages: %w", err)
+		}
+		envelope, err := DecodeKeygenEnvelope(msgBytes)
+		if err != nil || envelope.Type != EnvelopeDKGRound2 || envelope.Recipient != myPartyID {
+			continue
+		}
+		if _, ok := myR2Messages[envelope.Sender]; ok {
+			continue
+		}
+		if _, ok := unreadable[envelope.Sender]; ok {
+			continue
+		}
+		msg, err := OpenRound2(envelope, ephemeral)
+		if err != nil {
+			// Don't bail out; this goes in our complaint
+			sessionFrom(ctx).warnf("%s", err)
+			unreadable[envelope.Sender] = struct{}{}
+			continue
+		}
+		myR2Messages[msg.SenderIdentifier] = msg
+	}
+	var r2Data []*dkg.Round2Data
+	for _, m := range myR2Messages {
+		r2Data = append(r2Data, m)
+	}
+	var unreadableParties []uint16
+	for p := range unreadable {
+		unreadableParties = append(unreadableParties, p)
+	}
+	return r2Data, unreadableParties, nil
+}
+
+// Report any bad round 2 shares to the coordinator, then wait for everyone else to do the same.
+//
+// If anyone complains, the coordinator aborts the ceremony and records a verdict. To back up a complaint, we reveal
+// our ephemeral key for this ceremony, which lets the coordinator open the disputed share. That key is worthless once
+// the ceremony is aborted.
+func performComplaintRound(ctx context.Context, j *Journal, feed *Feed, accused []uint16, ephemeral *age.X25519Identity) error {
+	host, groupID, myPartyID, partySize := j.Host, j.GroupID, j.MyPartyID, j.PartySize
+	complaint := KeygenComplaintRequest{
+		GroupID:   groupID,
+		MyPartyID: myPartyID,
+		Accused:   accused,
+	}
+	if len(accused) > 0 {
+		complaint.Evidence = ephemeral.String()
+	}
+	// If we were interrupted, we might have filed our report already
+	filed := j.Reached(RoundComplaint)
+	if !filed && j.Reached(RoundDKG2) {
+		state, err := DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: groupID, PartyID: &myPartyID})
+		if err != nil {
+			return err
+		}
+		filed = slices.Contains(state.Reporters, myPartyID)
+	}
+	if !filed {
+		err := DuctKeygenComplaint(ctx, host, complaint)
+		if err != nil {
+			return fmt.Errorf("failed to file complaint report: %w", err)
+		}
+		if err := j.Record(RoundComplaint, feed); err != nil {
+			return err
+		}
+	}
+
+	var pollResponse PollKeyGenResponse
+	err := feed.WaitForState(&pollResponse, func() bool {
+		return pollResponse.Status == "aborted" || pollResponse.Status == "expired" || pollResponse.Reports >= partySize
+	})
+	if err != nil {
+		return err
+	}
+	if pollResponse.Status == "aborted" || pollResponse.Status == "expired" {
+		verdict := "no verdict recorded"
+		if pollResponse.Verdict != nil {
+			verdict = *pollResponse.Verdict
+		}
+		return ceremonyEnded("key generation %s: %s", pollResponse.Status, verdict)
+	}
+	return nil
 }
 
-func performDKGRound1(host, groupID string, myPartyID, threshold, partySize uint16, partyMembers []uint16) (*dkg.Participant, []*dkg.Round1Data, error) {
-	participant, err := dkg.Edwards25519Sha512.NewParticipant(myPartyID, threshold, partySize)
+// Store our share, then confirm the group public key with everyone else. Returns the group public key.
+func finalizeAndStoreKeys(ctx context.Context, j *Journal, feed *Feed, partyMembers []uint16, identityKeys map[uint16]string, participant *dkg.Participant, r1Data []*dkg.Round1Data, r2Data []*dkg.Round2Data) (string, error) {
+	host, groupID, myPartyID := j.Host, j.GroupID, j.MyPartyID
+	keyShare, err := participant.Finalize(r1Data, r2Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to finalize dkg: %w", err)
+	}
+
+	var allCommitments [][]*ecc.Element
+	for _, d := range r1Data {
+		allCommitments = append(allCommitments, d.Commitment)
+	}
+
+	publicShares := make(map[string]string)
+	for _, pID := range partyMembers {
+		pubKey, err := dkg.ComputeParticipantPublicKey(dkg.Edwards25519Sha512, pID, allCommitments)
+		if err != nil {
+			return "", fmt.Errorf("failed to compute public key for party %d: %w", pID, err)
+		}
+		pubKeyBytes := pubKey.Encode()
+		publicShares[Uint16ToHexBE(pID)] = hex.EncodeToString(pubKeyBytes)
+	}
+
+	groupKeyBytes := keyShare.VerificationKey.Encode()
+	groupKeyHex := hex.EncodeToString(groupKeyBytes)
+
+	config, err := LoadUserConfig()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to start dkg: %w", err)
+		return "", err
+	}
+	// We might have stored it before we were interrupted
+	if _, ok := config.FindShare(groupID, 0); !ok {
+		secretShareBytes := keyShare.Secret.Encode()
+		encryptedShare, err := EncryptShare(j.Recipient, secretShareBytes)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt share: %w", err)
+		}
+		err = config.AddShare(host, groupID, groupKeyHex, encryptedShare, publicShares, myPartyID, identityKeys)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	r1Message := participant.Start()
-	r1Bytes := r1Message.Encode()
-	_, err = DuctKeygenProtocolMessage(host, KeyGenMessageRequest{
+	// Everyone confirms the key they ended up with. The coordinator only accepts it once they all agree.
+	confirmed := false
+	if j.Reached(RoundStored) {
+		state, err := DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: groupID, PartyID: &myPartyID})
+		if err != nil {
+			return "", err
+		}
+		confirmed = slices.Contains(state.Confirmed, myPartyID) || state.Status != "open"
+	} else if err := j.Record(RoundStored, feed); err != nil {
+		return "", err
+	}
+	if !confirmed {
+		report := KeygenFinalRequest{
+			GroupID:   groupID,
+			MyPartyID: myPartyID,
+			PublicKey: groupKeyHex,
+		}
+		if err := DuctKeygenFinalize(ctx, host, report); err != nil {
+			return "", err
+		}
+	}
+	if err := waitForGroupPublicKey(feed); err != nil {
+		// A share of a key nobody agrees on is no use to anyone
+		if errors.As(err, &ceremonyEndedError{}) {
+			if dropErr := config.ForgetGroup(groupID); dropErr != nil {
+				sessionFrom(ctx).warnf("failed to remove share: %s", dropErr)
+			}
+		}
+		return "", err
+	}
+	return groupKeyHex, nil
+}
+
+// Wait for every party to confirm the group public key
+func waitForGroupPublicKey(feed *Feed) error {
+	var pollResponse PollKeyGenResponse
+	err := feed.WaitForState(&pollResponse, func() bool {
+		return pollResponse.Status != "open"
+	})
+	if err != nil {
+		return err
+	}
+	switch pollResponse.Status {
+	case "aborted", "disputed", "expired":
+		verdict := "no verdict recorded"
+		if pollResponse.Verdict != nil {
+			verdict = *pollResponse.Verdict
+		}
+		return ceremonyEnded("key generation %s: %s", pollResponse.Status, verdict)
+	}
+	return nil
+}
+
+// Secrets for a key generation in progress
+type keygenSecrets struct {
+	// Our DKG polynomial's coefficients
+	Polynomial []string `json:"polynomial"`
+	// The nonce for our round 1 proof of knowledge
+	ProofNonce string `json:"proof-nonce"`
+	// The ephemeral age identity our round 2 shares are sealed to
+	Ephemeral string `json:"ephemeral"`
+}
+
+// Join a keygen ceremony, and see it through. Our share is encrypted to recipient. If we know the other members'
+// identity keys, the group has to be made of exactly them.
+func RunKeyGenCeremony(ctx context.Context, host, groupID, recipient string, members []string) (GroupResult, error) {
+	myPartyID, threshold, partySize, err := joinKeyGen(ctx, host, groupID)
+	if err != nil {
+		return GroupResult{}, fmt.Errorf("failed to join ceremony: %w", err)
+	}
+
+	// Every secret we need for the whole ceremony is made up front, and journaled before we send anything.
+	// Round 2 shares are sealed to a fresh key that only lives for this ceremony.
+	g := dkg.Edwards25519Sha512.Group()
+	polynomial := secretsharing.NewPolynomial(threshold)
+	secrets := keygenSecrets{}
+	for i := range polynomial {
+		polynomial[i] = g.NewScalar().Random()
+		secrets.Polynomial = append(secrets.Polynomial, polynomial[i].Hex())
+	}
+	proofNonce := g.NewScalar().Random()
+	secrets.ProofNonce = proofNonce.Hex()
+	ephemeral, err := age.GenerateX25519Identity()
+	if err != nil {
+		return GroupResult{}, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	secrets.Ephemeral = ephemeral.String()
+
+	j := &Journal{
+		Kind:      JournalKeygen,
+		ID:        groupID,
+		Host:      host,
 		GroupID:   groupID,
+		MyPartyID: myPartyID,
+		Threshold: threshold,
+		PartySize: partySize,
+		Recipient: recipient,
+		Members:   members,
+	}
+	if err := j.SetSecrets(recipient, secrets); err != nil {
+		return GroupResult{}, err
+	}
+	feed := OpenKeygenFeed(ctx, host, groupID, myPartyID)
+	defer feed.Close()
+	if err := j.Record(RoundJoined, feed); err != nil {
+		return GroupResult{}, err
+	}
+	return finishKeyGen(ctx, j, feed, polynomial, proofNonce, ephemeral)
+}
+
+// Pick up a keygen ceremony where we left off
+func ResumeKeyGen(ctx context.Context, j *Journal, identityFile string) (GroupResult, error) {
+	var secrets keygenSecrets
+	if err := j.OpenSecrets(identityFile, &secrets); err != nil {
+		return GroupResult{}, err
+	}
+	g := dkg.Edwards25519Sha512.Group()
+	var polynomial secretsharing.Polynomial
+	for _, c := range secrets.Polynomial {
+		coefficient := g.NewScalar()
+		if err := coefficient.DecodeHex(c); err != nil {
+			return GroupResult{}, fmt.Errorf("failed to decode journaled polynomial: %w", err)
+		}
+		polynomial = append(polynomial, coefficient)
+	}
+	proofNonce := g.NewScalar()
+	if err := proofNonce.DecodeHex(secrets.ProofNonce); err != nil {
+		return GroupResult{}, fmt.Errorf("failed to decode journaled nonce: %w", err)
+	}
+	ephemeral, err := age.ParseX25519Identity(secrets.Ephemeral)
+	if err != nil {
+		return GroupResult{}, fmt.Errorf("failed to decode journaled ephemeral key: %w", err)
+	}
+	feed := OpenKeygenFeedFrom(ctx, j.Host, j.GroupID, j.MyPartyID, j.Feed)
+	defer feed.Close()
+	return finishKeyGen(ctx, j, feed, polynomial, proofNonce, ephemeral)
+}
+
+// Run a keygen ceremony from wherever the journal says we got to
+func finishKeyGen(ctx context.Context, j *Journal, feed *Feed, polynomial secretsharing.Polynomial, proofNonce *ecc.Scalar, ephemeral *age.X25519Identity) (GroupResult, error) {
+	groupKeyHex, err := runKeyGen(ctx, j, feed, polynomial, proofNonce, ephemeral)
+	if err != nil {
+		// Until everyone's joined, we can bow out without holding anyone up
+		if ctx.Err() != nil && !j.Reached(RoundDKG1) && leaveKeyGen(ctx, j) {
+			j.Remove()
+			return GroupResult{}, err
+		}
+		j.Fail(err)
+		return GroupResult{}, resumable(j.ID, err)
+	}
+	j.Remove()
+	return GroupResult{
+		GroupID:      j.GroupID,
+		Status:       "complete",
+		PublicKey:    groupKeyHex,
+		PartyID:      j.MyPartyID,
+		Threshold:    j.Threshold,
+		Participants: j.PartySize,
+	}, nil
+}
+
+// Give our seat in a keygen ceremony back. The coordinator won't let us once everyone has joined.
+func leaveKeyGen(ctx context.Context, j *Journal) bool {
+	return leaveCeremony(ctx, "key generation for group "+j.GroupID, func(ctx context.Context) error {
+		return DuctLeaveKeyGenCeremony(ctx, j.Host, LeaveKeyGenRequest{GroupID: j.GroupID, MyPartyID: j.MyPartyID})
+	})
+}
+
+func runKeyGen(ctx context.Context, j *Journal, feed *Feed, polynomial secretsharing.Polynomial, proofNonce *ecc.Scalar, ephemeral *age.X25519Identity) (string, error) {
+	// 1. Wait for everyone to join.
+	partyMembers, identityKeys, err := waitForKeygenParties(feed, j.MyPartyID, j.PartySize)
+	if err != nil {
+		return "", fmt.Errorf("failed to join ceremony: %w", err)
+	}
+	if err := checkKeygenMembers(ctx, j, identityKeys); err != nil {
+		return "", err
+	}
+
+	// 2. Perform DKG Round 1.
+	participant, err := dkg.Edwards25519Sha512.NewParticipant(j.MyPartyID, j.Threshold, j.PartySize, polynomial...)
+	if err != nil {
+		return "", fmt.Errorf("failed to start dkg: %w", err)
+	}
+	r1Data, peerRecipients, err := performDKGRound1(ctx, j, feed, participant, proofNonce, partyMembers, identityKeys, ephemeral)
+	if err != nil {
+		return "", fmt.Errorf("DKG round 1 failed: %w", err)
+	}
+
+	// 3. Perform DKG Round 2.
+	r2Data, unreadable, err := performDKGRound2(ctx, j, feed, participant, r1Data, peerRecipients, ephemeral)
+	if err != nil {
+		return "", fmt.Errorf("DKG round 2 failed: %w", err)
+	}
+
+	// Check our shares against their dealers' commitments, and complain about any that don't match.
+	accused := FindInvalidDealers(j.MyPartyID, r1Data, r2Data)
+	accused = append(accused, unreadable...)
+	slices.Sort(accused)
+	for _, a := range accused {
+		sessionFrom(ctx).warnf("party %d sent us an invalid share", a)
+	}
+	err = performComplaintRound(ctx, j, feed, accused, ephemeral)
+	if err != nil {
+		return "", err
+	}
+
+	// 4. Finalize and store keys.
+	groupKeyHex, err := finalizeAndStoreKeys(ctx, j, feed, partyMembers, identityKeys, participant, r1Data, r2Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to finalize and store keys: %w", err)
+	}
+	return groupKeyHex, nil
+}
+
+// Find a share's epoch and party ID for a group, along with the coordinator's view of it
+func findCurrentShare(ctx context.Context, host, groupID string) (Shares, PollKeyGenResponse, error) {
+	pollResponse, err := DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: groupID})
+	if err != nil {
+		return Shares{}, PollKeyGenResponse{}, err
+	}
+	config, err := LoadUserConfig()
+	if err != nil {
+		return Shares{}, PollKeyGenResponse{}, err
+	}
+	share, ok := config.FindShare(groupID, pollResponse.Epoch)
+	if !ok {
+		return Shares{}, PollKeyGenResponse{}, fmt.Errorf("could not find a share for group %s at epoch %d", groupID, pollResponse.Epoch)
+	}
+	return share, pollResponse, nil
+}
+
+// The identity keys of a group's members, as we stored them with our share. Shares from before we stored them only
+// have the coordinator's word to go on.
+func memberIdentityKeys(ctx context.Context, share Shares, fromCoordinator map[uint16]string) map[uint16]string {
+	if share.IdentityKeys != nil {
+		return share.IdentityKeys
+	}
+	sessionFrom(ctx).warnf("our share of group %s has no identity keys stored with it, so we're trusting the coordinator's", share.GroupID)
+	return fromCoordinator
+}
+
+// Decrypt our share, and make sure it matches our public share
+func openShare(share Shares, identityFile string) (*ecc.Scalar, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	secretBytes, err := DecryptShareFor(share.EncryptedShare, identityFile)
+	if err != nil {
+		return nil, err
+	}
+	secretKey := g.NewScalar()
+	if err := secretKey.Decode(secretBytes); err != nil {
+		return nil, fmt.Errorf("failed to decode secret key: %w", err)
+	}
+	myPublicShare := g.NewElement()
+	if err := myPublicShare.DecodeHex(share.PublicShares[Uint16ToHexBE(share.MyPartyID)]); err != nil {
+		return nil, fmt.Errorf("failed to decode our public share: %w", err)
+	}
+	if !g.Base().Multiply(secretKey).Equal(myPublicShare) {
+		return nil, errors.New("share does not match our public share")
+	}
+	return secretKey, nil
+}
+
+// Send our refresh commitment, then collect everyone else's.
+// Returns each holder's commitment, and the key to seal their refresh share to.
+func performRefreshRound1(ctx context.Context, host, refreshID string, feed *Feed, myPartyID, threshold uint16, partyMembers []uint16, identityKeys map[uint16]string, commitment []*ecc.Element, ephemeral *age.X25519Identity) (map[uint16][]*ecc.Element, map[uint16]string, error) {
+	r1 := NewRefreshRound1Envelope(myPartyID, commitment, ephemeral)
+	if err := signAgeRecipient(ctx, &r1, refreshID); err != nil {
+		return nil, nil, err
+	}
+	r1Bytes := r1.Encode()
+	err := DuctRefreshProtocolMessage(ctx, host, RefreshMessageRequest{
+		RefreshID: refreshID,
+		MyPartyID: myPartyID,
 		Message:   hex.EncodeToString(r1Bytes),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send refresh commitment: %w", err)
+	}
+
+	commitments := make(map[uint16][]*ecc.Element)
+	commitments[myPartyID] = commitment
+	peerRecipients := make(map[uint16]string)
+	for len(commitments) < len(partyMembers) {
+		msgBytes, err := feed.NextMessage()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to wait for refresh commitments: %w", err)
+		}
+		envelope, err := DecodeKeygenEnvelope(msgBytes)
+		if err != nil || envelope.Type != EnvelopeRefreshRound1 || !slices.Contains(partyMembers, envelope.Sender) {
+			continue
+		}
+		if _, ok := commitments[envelope.Sender]; ok {
+			continue
+		}
+		c, err := OpenRefreshRound1Envelope(envelope, threshold)
+		if err != nil {
+			return nil, nil, fmt.Errorf("party %d sent an invalid refresh commitment: %w", envelope.Sender, err)
+		}
+		if err := envelope.VerifyAgeRecipient(refreshID, identityKeys); err != nil {
+			return nil, nil, err
+		}
+		commitments[envelope.Sender] = c
+		peerRecipients[envelope.Sender] = envelope.AgeRecipient
+	}
+	return commitments, peerRecipients, nil
+}
+
+// Deal our refresh shares, then collect and check the ones dealt to us.
+// Returns the sum of every share dealt to us, including our own.
+func performRefreshRound2(ctx context.Context, host, refreshID string, feed *Feed, myPartyID uint16, partyMembers []uint16, polynomial secretsharing.Polynomial, commitments map[uint16][]*ecc.Element, peerRecipients map[uint16]string, ephemeral *age.X25519Identity) (*ecc.Scalar, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	total := polynomial.Evaluate(g.NewScalar().SetUInt64(uint64(myPartyID)))
+	for _, peer := range partyMembers {
+		if peer == myPartyID {
+			continue
+		}
+		delta := polynomial.Evaluate(g.NewScalar().SetUInt64(uint64(peer)))
+		envelope, err := SealRefreshShare(myPartyID, peer, delta, peerRecipients[peer])
+		if err != nil {
+			return nil, fmt.Errorf("failed to seal refresh share for party %d: %w", peer, err)
+		}
+		err = DuctRefreshProtocolMessage(ctx, host, RefreshMessageRequest{
+			RefreshID: refreshID,
+			MyPartyID: myPartyID,
+			Message:   hex.EncodeToString(envelope.Encode()),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to send refresh share: %w", err)
+		}
+	}
+
+	received := make(map[uint16]struct{})
+	for len(received) < len(partyMembers)-1 {
+		msgBytes, err := feed.NextMessage()
+		if err != nil {
+			return nil, fmt.Errorf("failed to wait for refresh shares: %w", err)
+		}
+		envelope, err := DecodeKeygenEnvelope(msgBytes)
+		if err != nil || envelope.Type != EnvelopeRefreshRound2 || envelope.Recipient != myPartyID {
+			continue
+		}
+		commitment, ok := commitments[envelope.Sender]
+		if !ok {
+			continue
+		}
+		if _, ok := received[envelope.Sender]; ok {
+			continue
+		}
+		delta, err := OpenRefreshShare(envelope, ephemeral)
+		if err != nil || !VerifyRefreshShare(delta, myPartyID, commitment) {
+			return nil, fmt.Errorf("party %d sent party %d an invalid refresh share", envelope.Sender, myPartyID)
+		}
+		total.Add(delta)
+		received[envelope.Sender] = struct{}{}
+	}
+	return total, nil
+}
+
+// Work out everyone's public share for the new epoch
+func refreshPublicShares(publicShares map[string]string, commitments map[uint16][]*ecc.Element) (map[string]string, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	var allCommitments [][]*ecc.Element
+	for _, c := range commitments {
+		allCommitments = append(allCommitments, c)
+	}
+	refreshed := make(map[string]string)
+	for k, v := range publicShares {
+		id, err := HexBEToUint16(k)
+		if err != nil {
+			return nil, err
+		}
+		old := g.NewElement()
+		if err := old.DecodeHex(v); err != nil {
+			return nil, fmt.Errorf("failed to decode public share for party %d: %w", id, err)
+		}
+		pk, err := RefreshPublicShare(old, id, allCommitments)
+		if err != nil {
+			return nil, err
+		}
+		refreshed[k] = pk.Hex()
+	}
+	return refreshed, nil
+}
+
+// Wait for every holder to confirm the refresh, or for it to be aborted
+func waitForRefresh(feed *Feed) error {
+	for {
+		var pollResponse PollRefreshResponse
+		if err := feed.NextState(&pollResponse); err != nil {
+			return err
+		}
+		switch pollResponse.Status {
+		case "complete":
+			return nil
+		case "aborted":
+			verdict := "no verdict recorded"
+			if pollResponse.Verdict != nil {
+				verdict = *pollResponse.Verdict
+			}
+			return fmt.Errorf("refresh aborted: %s", verdict)
+		}
+	}
+}
+
+// Refresh our share of a group's key, along with every other holder.
+//
+// Every holder has to run this. Nothing changes until they've all confirmed they agree on the new public shares; after
+// that, the coordinator moves the group to the next epoch and refuses shares from older ones.
+func RefreshShares(ctx context.Context, host, groupID, identityFile, recipient string) (GroupResult, error) {
+	share, pollResponse, err := findCurrentShare(ctx, host, groupID)
+	if err != nil {
+		return GroupResult{}, err
+	}
+	if pollResponse.Status != "complete" {
+		return GroupResult{}, fmt.Errorf("key generation for group %s is not complete", groupID)
+	}
+	threshold := pollResponse.Threshold
+	if threshold < 2 {
+		return GroupResult{}, errors.New("every share of a 1-of-n group is the whole key, so there's nothing to refresh")
+	}
+	secretKey, err := openShare(share, identityFile)
+	if err != nil {
+		return GroupResult{}, err
+	}
+	myPartyID := share.MyPartyID
+	oldEpoch := share.Epoch
+
+	joinResponse, err := DuctJoinRefresh(ctx, host, RefreshJoinRequest{
+		GroupID:   groupID,
 		MyPartyID: myPartyID,
+		Epoch:     oldEpoch,
 	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to send r1 message: %w", err)
+		return GroupResult{}, fmt.Errorf("failed to join refresh: %w", err)
+	}
+	newEpoch := joinResponse.Epoch
+
+	// If anything goes wrong from here on out, don't leave everyone else hanging
+	fail := func(err error) error {
+		ctx, cancel := parting(ctx)
+		defer cancel()
+		DuctRefreshAbort(ctx, host, RefreshAbortRequest{
+			GroupID:   groupID,
+			MyPartyID: myPartyID,
+			Reason:    err.Error(),
+		})
+		return err
+	}
+
+	// Wait for every holder to join
+	feed := OpenRefreshFeed(ctx, host, joinResponse.RefreshID, myPartyID)
+	defer feed.Close()
+	var partyMembers []uint16
+	for {
+		var refreshState PollRefreshResponse
+		if err := feed.NextState(&refreshState); err != nil {
+			// Until everyone's joined, we can bow out without calling the whole thing off
+			if ctx.Err() != nil && leaveCeremony(ctx, "the refresh of group "+groupID, func(ctx context.Context) error {
+				return DuctLeaveRefresh(ctx, host, RefreshLeaveRequest{GroupID: groupID, MyPartyID: myPartyID})
+			}) {
+				return GroupResult{}, err
+			}
+			return GroupResult{}, fail(err)
+		}
+		if refreshState.Status != "open" {
+			return GroupResult{}, fail(fmt.Errorf("refresh is %s", refreshState.Status))
+		}
+		if uint16(len(refreshState.Parties)) >= refreshState.PartySize {
+			partyMembers = refreshState.Parties
+			break
+		}
+	}
+	for _, p := range partyMembers {
+		if _, ok := share.PublicShares[Uint16ToHexBE(p)]; !ok {
+			return GroupResult{}, fail(fmt.Errorf("party %d has no public share", p))
+		}
+	}
+
+	// Round 1: commit to a random polynomial with a constant term of zero
+	ephemeral, err := age.GenerateX25519Identity()
+	if err != nil {
+		return GroupResult{}, fail(err)
+	}
+	polynomial := NewRefreshPolynomial(threshold)
+	commitments, peerRecipients, err := performRefreshRound1(ctx, host, joinResponse.RefreshID, feed, myPartyID, threshold, partyMembers, memberIdentityKeys(ctx, share, pollResponse.IdentityKeys), CommitRefreshPolynomial(polynomial), ephemeral)
+	if err != nil {
+		return GroupResult{}, fail(err)
+	}
+
+	// Round 2: deal everyone their share of it
+	delta, err := performRefreshRound2(ctx, host, joinResponse.RefreshID, feed, myPartyID, partyMembers, polynomial, commitments, peerRecipients, ephemeral)
+	if err != nil {
+		return GroupResult{}, fail(err)
+	}
+	newSecret := secretKey.Copy().Add(delta)
+	publicShares, err := refreshPublicShares(share.PublicShares, commitments)
+	if err != nil {
+		return GroupResult{}, fail(err)
+	}
+	if dkg.Edwards25519Sha512.Group().Base().Multiply(newSecret).Hex() != publicShares[Uint16ToHexBE(myPartyID)] {
+		return GroupResult{}, fail(errors.New("refreshed share does not match our refreshed public share"))
+	}
+
+	// Hang on to the new share before confirming, so we can't lose it if we crash
+	encryptedShare, err := EncryptShare(recipient, newSecret.Encode())
+	if err != nil {
+		return GroupResult{}, fail(fmt.Errorf("failed to encrypt share: %w", err))
+	}
+	config, err := LoadUserConfig()
+	if err != nil {
+		return GroupResult{}, fail(err)
+	}
+	if err := config.AddRefreshedShare(share, encryptedShare, publicShares, newEpoch); err != nil {
+		return GroupResult{}, fail(err)
+	}
+	err = DuctRefreshConfirm(ctx, host, RefreshConfirmRequest{
+		RefreshID: joinResponse.RefreshID,
+		MyPartyID: myPartyID,
+		Digest:    PublicSharesDigest(publicShares),
+	})
+	if err == nil {
+		err = waitForRefresh(feed)
+	}
+	refreshErr := err
+	if err != nil {
+		fail(err)
+	}
+
+	// Keep whichever share the coordinator ended up with
+	pollResponse, err = DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: groupID})
+	if err != nil {
+		return GroupResult{}, errors.Join(refreshErr, fmt.Errorf("could not check the group's epoch, so both shares were kept: %w", err))
+	}
+	config, err = LoadUserConfig()
+	if err != nil {
+		return GroupResult{}, err
+	}
+	if err := config.DropShares(groupID, pollResponse.Epoch); err != nil {
+		return GroupResult{}, err
+	}
+	if pollResponse.Epoch != newEpoch {
+		if refreshErr == nil {
+			refreshErr = fmt.Errorf("group %s is at epoch %d, not %d", groupID, pollResponse.Epoch, newEpoch)
+		}
+		return GroupResult{}, refreshErr
+	}
+	return GroupResult{
+		GroupID:   groupID,
+		Status:    "refreshed",
+		PublicKey: share.PublicKey,
+		PartyID:   myPartyID,
+		Epoch:     epochOf(newEpoch),
+	}, nil
+}
+
+// Abort the refresh in progress for a group
+func CancelRefresh(ctx context.Context, host, groupID string) (GroupResult, error) {
+	config, err := LoadUserConfig()
+	if err != nil {
+		return GroupResult{}, err
+	}
+	var myPartyID uint16
+	for _, s := range config.Shares {
+		if s.GroupID == groupID {
+			myPartyID = s.MyPartyID
+			break
+		}
+	}
+	if myPartyID == 0 {
+		return GroupResult{}, fmt.Errorf("you do not hold a share for group %s", groupID)
+	}
+	err = DuctRefreshAbort(ctx, host, RefreshAbortRequest{
+		GroupID:   groupID,
+		MyPartyID: myPartyID,
+		Reason:    "aborted by user",
+	})
+	if err != nil {
+		return GroupResult{}, err
+	}
+	return GroupResult{GroupID: groupID, Status: "aborted", PartyID: myPartyID}, nil
+}
+
+// Send our reshare round 1 broadcast, then collect everyone else's.
+// Returns each dealer's commitment, and the key to seal each recipient's share to.
+func performReshareRound1(ctx context.Context, host, reshareID string, feed *Feed, myPartyID, threshold uint16, dealers, participants []uint16, identityKeys map[uint16]string, commitment []*ecc.Element, ephemeral *age.X25519Identity) (map[uint16][]*ecc.Element, map[uint16]string, error) {
+	r1 := NewReshareRound1Envelope(myPartyID, commitment, ephemeral)
+	if err := signAgeRecipient(ctx, &r1, reshareID); err != nil {
+		return nil, nil, err
+	}
+	r1Bytes := r1.Encode()
+	err := DuctReshareProtocolMessage(ctx, host, ReshareMessageRequest{
+		ReshareID: reshareID,
+		MyPartyID: myPartyID,
+		Message:   hex.EncodeToString(r1Bytes),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send reshare round 1 message: %w", err)
+	}
+
+	commitments := make(map[uint16][]*ecc.Element)
+	if commitment != nil {
+		commitments[myPartyID] = commitment
+	}
+	peerRecipients := make(map[uint16]string)
+	seen := map[uint16]struct{}{myPartyID: {}}
+	for len(seen) < len(participants) {
+		msgBytes, err := feed.NextMessage()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to wait for reshare round 1 messages: %w", err)
+		}
+		envelope, err := DecodeKeygenEnvelope(msgBytes)
+		if err != nil || envelope.Type != EnvelopeReshareRound1 || !slices.Contains(participants, envelope.Sender) {
+			continue
+		}
+		if _, ok := seen[envelope.Sender]; ok {
+			continue
+		}
+		c, err := OpenReshareRound1Envelope(envelope, threshold)
+		if err != nil {
+			return nil, nil, fmt.Errorf("party %d sent an invalid reshare commitment: %w", envelope.Sender, err)
+		}
+		if slices.Contains(dealers, envelope.Sender) != (c != nil) {
+			return nil, nil, fmt.Errorf("party %d sent a commitment that does not match its role", envelope.Sender)
+		}
+		if err := envelope.VerifyAgeRecipient(reshareID, identityKeys); err != nil {
+			return nil, nil, err
+		}
+		if c != nil {
+			commitments[envelope.Sender] = c
+		}
+		peerRecipients[envelope.Sender] = envelope.AgeRecipient
+		seen[envelope.Sender] = struct{}{}
+	}
+	return commitments, peerRecipients, nil
+}
+
+// Deal our shares to the recipients (if we're a dealer), then collect and check the ones dealt to us (if we're a
+// recipient). Returns our new share, or nil if we aren't getting one.
+func performReshareRound2(ctx context.Context, host, reshareID string, feed *Feed, myPartyID uint16, dealers, recipients []uint16, polynomial secretsharing.Polynomial, commitments map[uint16][]*ecc.Element, peerRecipients map[uint16]string, ephemeral *age.X25519Identity) (*ecc.Scalar, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	if polynomial != nil {
+		for _, peer := range recipients {
+			if peer == myPartyID {
+				continue
+			}
+			share := polynomial.Evaluate(g.NewScalar().SetUInt64(uint64(peer)))
+			envelope, err := SealReshareShare(myPartyID, peer, share, peerRecipients[peer])
+			if err != nil {
+				return nil, fmt.Errorf("failed to seal reshare share for party %d: %w", peer, err)
+			}
+			err = DuctReshareProtocolMessage(ctx, host, ReshareMessageRequest{
+				ReshareID: reshareID,
+				MyPartyID: myPartyID,
+				Message:   hex.EncodeToString(envelope.Encode()),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to send reshare share: %w", err)
+			}
+		}
+	}
+	if !slices.Contains(recipients, myPartyID) {
+		return nil, nil
+	}
+
+	total := g.NewScalar()
+	received := make(map[uint16]struct{})
+	if polynomial != nil {
+		total.Add(polynomial.Evaluate(g.NewScalar().SetUInt64(uint64(myPartyID))))
+		received[myPartyID] = struct{}{}
+	}
+	for len(received) < len(dealers) {
+		msgBytes, err := feed.NextMessage()
+		if err != nil {
+			return nil, fmt.Errorf("failed to wait for reshare shares: %w", err)
+		}
+		envelope, err := DecodeKeygenEnvelope(msgBytes)
+		if err != nil || envelope.Type != EnvelopeReshareRound2 || envelope.Recipient != myPartyID {
+			continue
+		}
+		commitment, ok := commitments[envelope.Sender]
+		if !ok {
+			continue
+		}
+		if _, ok := received[envelope.Sender]; ok {
+			continue
+		}
+		share, err := OpenReshareShare(envelope, ephemeral)
+		if err != nil || !VerifyReshareShare(share, myPartyID, commitment) {
+			return nil, fmt.Errorf("party %d sent party %d an invalid reshare share", envelope.Sender, myPartyID)
+		}
+		total.Add(share)
+		received[envelope.Sender] = struct{}{}
+	}
+	return total, nil
+}
+
+// Wait for every participant to confirm the reshare, or for it to be aborted
+func waitForReshare(feed *Feed) error {
+	for {
+		var pollResponse PollReshareResponse
+		if err := feed.NextState(&pollResponse); err != nil {
+			return err
+		}
+		switch pollResponse.Status {
+		case "complete":
+			return nil
+		case "aborted":
+			verdict := "no verdict recorded"
+			if pollResponse.Verdict != nil {
+				verdict = *pollResponse.Verdict
+			}
+			return fmt.Errorf("reshare aborted: %s", verdict)
+		}
+	}
+}
+
+// Take part in a reshare of a group's key.
+//
+// Current holders deal their share to the new set of participants, and get a new share themselves unless they're
+// leaving. Newcomers only get a share. If partySize is set, we propose the reshare first, which only a current holder
+// can do, for the newcomers with these identity keys. The group public key never changes.
+func ReshareShares(ctx context.Context, host, groupID, identityFile, recipient string, partySize, threshold uint16, newcomers []string, leave bool) (GroupResult, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	pollResponse, err := DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: groupID})
+	if err != nil {
+		return GroupResult{}, err
+	}
+	if pollResponse.Status != "complete" {
+		return GroupResult{}, fmt.Errorf("key generation for group %s is not complete", groupID)
+	}
+	config, err := LoadUserConfig()
+	if err != nil {
+		return GroupResult{}, err
+	}
+	share, holder := config.FindShare(groupID, pollResponse.Epoch)
+	if !holder && (partySize > 0 || leave) {
+		return GroupResult{}, fmt.Errorf("you do not hold a share for group %s, so you can only join a reshare as a new participant", groupID)
+	}
+	var secretKey *ecc.Scalar
+	var myPartyID uint16
+	if holder {
+		if identityFile == "" {
+			return GroupResult{}, UsageError(fmt.Errorf("you hold a share for group %s, so -i/--identity is required", groupID))
+		}
+		secretKey, err = openShare(share, identityFile)
+		if err != nil {
+			return GroupResult{}, err
+		}
+		myPartyID = share.MyPartyID
+	}
+
+	if partySize > 0 {
+		_, err := DuctInitReshare(ctx, host, InitReshareRequest{
+			GroupID:      groupID,
+			MyPartyID:    myPartyID,
+			Participants: partySize,
+			Threshold:    threshold,
+			Newcomers:    newcomers,
+		})
+		if err != nil {
+			return GroupResult{}, fmt.Errorf("failed to propose reshare: %w", err)
+		}
+	}
+	joinRequest := ReshareJoinRequest{
+		GroupID:   groupID,
+		MyPartyID: myPartyID,
+		Epoch:     pollResponse.Epoch,
+		Receive:   !leave,
+	}
+	if !holder {
+		// Register our long-term key, which authenticates everything we send from here on out
+		joinRequest.PublicKey, err = IdentityPublicKey(ctx)
+		if err != nil {
+			return GroupResult{}, err
+		}
+	}
+	joinResponse, err := DuctJoinReshare(ctx, host, joinRequest)
+	if err != nil {
+		return GroupResult{}, fmt.Errorf("failed to join reshare: %w", err)
+	}
+	myPartyID = joinResponse.MyPartyID
+	newEpoch := joinResponse.Epoch
+
+	// If anything goes wrong from here on out, don't leave everyone else hanging
+	fail := func(err error) error {
+		ctx, cancel := parting(ctx)
+		defer cancel()
+		DuctReshareAbort(ctx, host, ReshareAbortRequest{
+			GroupID:   groupID,
+			MyPartyID: myPartyID,
+			Reason:    err.Error(),
+		})
+		return err
+	}
+
+	// Wait until the coordinator has everyone it needs
+	feed := OpenReshareFeed(ctx, host, joinResponse.ReshareID, myPartyID)
+	defer feed.Close()
+	var state PollReshareResponse
+	for {
+		if err := feed.NextState(&state); err != nil {
+			// Until the reshare is locked, we can bow out without calling the whole thing off
+			if ctx.Err() != nil && leaveCeremony(ctx, "the reshare of group "+groupID, func(ctx context.Context) error {
+				return DuctLeaveReshare(ctx, host, ReshareLeaveRequest{GroupID: groupID, MyPartyID: myPartyID})
+			}) {
+				return GroupResult{}, err
+			}
+			return GroupResult{}, fail(err)
+		}
+		if state.Status != "open" {
+			return GroupResult{}, fail(fmt.Errorf("reshare is %s", state.Status))
+		}
+		if state.Locked {
+			break
+		}
+	}
+	if uint16(len(state.Dealers)) < state.OldThreshold || uint16(len(state.Recipients)) != state.PartySize {
+		return GroupResult{}, fail(errors.New("coordinator locked the reshare with the wrong number of participants"))
+	}
+	if holder && state.PublicKey != share.PublicKey {
+		return GroupResult{}, fail(errors.New("coordinator has a different public key for this group"))
+	}
+	// Holders know who the members are from their share. Newcomers have nothing to go on but the coordinator.
+	members := pollResponse.IdentityKeys
+	if holder {
+		members = memberIdentityKeys(ctx, share, pollResponse.IdentityKeys)
+	}
+	if err := CheckReshareParticipants(state, members, newcomers); err != nil {
+		return GroupResult{}, fail(err)
+	}
+	groupKey := g.NewElement()
+	if err := groupKey.DecodeHex(state.PublicKey); err != nil {
+		return GroupResult{}, fail(fmt.Errorf("failed to decode group key: %w", err))
+	}
+	var participants []uint16
+	for _, p := range append(state.Dealers, state.Recipients...) {
+		if !slices.Contains(participants, p) {
+			participants = append(participants, p)
+		}
+	}
+
+	// Round 1: dealers commit to a polynomial that hides their weighted share
+	ephemeral, err := age.GenerateX25519Identity()
+	if err != nil {
+		return GroupResult{}, fail(err)
 	}
-
-	r1Messages := make(map[uint16]*dkg.Round1Data)
-	r1Messages[myPartyID] = r1Message
-	for len(r1Messages) < len(partyMembers) {
-		resp, err := DuctKeygenProtocolMessage(host, KeyGenMessageRequest{
-			GroupID:   groupID,
-			MyPartyID: myPartyID,
-			LastSeen:  lastMessageIdSeen,
-		})
+	var polynomial secretsharing.Polynomial
+	var commitment []*ecc.Element
+	if slices.Contains(state.Dealers, myPartyID) {
+		polynomial, err = NewResharePolynomial(secretKey, myPartyID, state.Dealers, state.Threshold)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to poll for r1 messages: %w", err)
+			return GroupResult{}, fail(err)
 		}
-		for _, msgStr := range resp.Messages {
-			msgBytes, err := hex.DecodeString(msgStr)
-			if err != nil {
-				continue
+		commitment = CommitResharePolynomial(polynomial)
+	}
+	commitments, peerRecipients, err := performReshareRound1(ctx, host, joinResponse.ReshareID, feed, myPartyID, state.Threshold, state.Dealers, participants, state.IdentityKeys, commitment, ephemeral)
+	if err != nil {
+		return GroupResult{}, fail(err)
+	}
+	if err := CheckReshareGroupKey(commitments, groupKey); err != nil {
+		return GroupResult{}, fail(err)
+	}
+	if holder {
+		for _, d := range state.Dealers {
+			publicShare := g.NewElement()
+			if err := publicShare.DecodeHex(share.PublicShares[Uint16ToHexBE(d)]); err != nil {
+				return GroupResult{}, fail(fmt.Errorf("failed to decode public share for party %d: %w", d, err))
 			}
-			ceremonyHash.Write(msgBytes)
-			msg := &dkg.Round1Data{}
-			if err := msg.Decode(msgBytes); err == nil {
-				if _, ok := r1Messages[msg.SenderIdentifier]; !ok {
-					r1Messages[msg.SenderIdentifier] = msg
-				}
+			if err := VerifyDealerCommitment(commitments[d], d, state.Dealers, publicShare); err != nil {
+				return GroupResult{}, fail(err)
 			}
 		}
-		lastMessageIdSeen = resp.LatestMessageID
-		time.Sleep(time.Second)
-	}
-	var r1Data []*dkg.Round1Data
-	for _, m := range r1Messages {
-		r1Data = append(r1Data, m)
 	}
-	return participant, r1Data, nil
-}
 
-func performDKGRound2(host, groupID string, myPartyID, partySize uint16, participant *dkg.Participant, r1Data []*dkg.Round1Data) ([]*dkg.Round2Data, error) {
-	r2Messages, err := participant.Continue(r1Data)
+	// Round 2: dealers hand out shares of it
+	newSecret, err := performReshareRound2(ctx, host, joinResponse.ReshareID, feed, myPartyID, state.Dealers, state.Recipients, polynomial, commitments, peerRecipients, ephemeral)
 	if err != nil {
-		return nil, fmt.Errorf("failed to continue dkg: %w", err)
+		return GroupResult{}, fail(err)
 	}
-	for _, msg := range r2Messages {
-		msgBytes := msg.Encode()
-		ceremonyHash.Write(msgBytes)
-		_, err = DuctKeygenProtocolMessage(host, KeyGenMessageRequest{
-			GroupID:   groupID,
-			Message:   hex.EncodeToString(msgBytes),
-			MyPartyID: myPartyID,
-		})
+	publicShares := make(map[string]string)
+	identityKeys := make(map[uint16]string)
+	for _, r := range state.Recipients {
+		pk, err := ResharePublicShare(r, commitments)
 		if err != nil {
-			return nil, fmt.Errorf("failed to send r2 message: %w", err)
+			return GroupResult{}, fail(err)
 		}
+		publicShares[Uint16ToHexBE(r)] = pk.Hex()
+		identityKeys[r] = state.IdentityKeys[r]
 	}
 
-	myR2Messages := make(map[uint16]*dkg.Round2Data)
-	for len(myR2Messages) < int(partySize)-1 {
-		resp, err := DuctKeygenProtocolMessage(host, KeyGenMessageRequest{
-			GroupID:   groupID,
-			MyPartyID: myPartyID,
-			LastSeen:  lastMessageIdSeen,
-		})
+	// Hang on to the new share before confirming, so we can't lose it if we crash
+	if newSecret != nil {
+		if g.Base().Multiply(newSecret).Hex() != publicShares[Uint16ToHexBE(myPartyID)] {
+			return GroupResult{}, fail(errors.New("new share does not match our new public share"))
+		}
+		encryptedShare, err := EncryptShare(recipient, newSecret.Encode())
 		if err != nil {
-			return nil, fmt.Errorf("failed to poll for r2 messages: %w", err)
+			return GroupResult{}, fail(fmt.Errorf("failed to encrypt share: %w", err))
 		}
-		for _, msgStr := range resp.Messages {
-			msgBytes, err := hex.DecodeString(msgStr)
-			if err != nil {
-				continue
-			}
-			ceremonyHash.Write(msgBytes)
-			msg := &dkg.Round2Data{}
-			if err := msg.Decode(msgBytes); err == nil {
-				if msg.RecipientIdentifier == myPartyID {
-					if _, ok := myR2Messages[msg.SenderIdentifier]; !ok {
-						myR2Messages[msg.SenderIdentifier] = msg
-					}
-				}
-			}
+		config, err := LoadUserConfig()
+		if err != nil {
+			return GroupResult{}, fail(err)
+		}
+		err = config.AddPendingShare(Shares{
+			Host:           host,
+			GroupID:        groupID,
+			PublicKey:      state.PublicKey,
+			EncryptedShare: encryptedShare,
+			PublicShares:   publicShares,
+			MyPartyID:      myPartyID,
+			Epoch:          newEpoch,
+			IdentityKeys:   identityKeys,
+		})
+		if err != nil {
+			return GroupResult{}, fail(err)
 		}
-		lastMessageIdSeen = resp.LatestMessageID
-		time.Sleep(time.Second)
 	}
-	var r2Data []*dkg.Round2Data
-	for _, m := range myR2Messages {
-		r2Data = append(r2Data, m)
+	err = DuctReshareConfirm(ctx, host, ReshareConfirmRequest{
+		ReshareID: joinResponse.ReshareID,
+		MyPartyID: myPartyID,
+		Digest:    PublicSharesDigest(publicShares),
+	})
+	if err == nil {
+		err = waitForReshare(feed)
 	}
-	return r2Data, nil
-}
-
-func finalizeAndStoreKeys(host, groupID, recipient string, myPartyID uint16, partyMembers []uint16, participant *dkg.Participant, r1Data []*dkg.Round1Data, r2Data []*dkg.Round2Data) error {
-	keyShare, err := participant.Finalize(r1Data, r2Data)
+	reshareErr := err
 	if err != nil {
-		return fmt.Errorf("failed to finalize dkg: %w", err)
-	}
-
-	var allCommitments [][]*ecc.Element
-	for _, d := range r1Data {
-		allCommitments = append(allCommitments, d.Commitment)
+		fail(err)
 	}
 
-	publicShares := make(map[string]string)
-	for _, pID := range partyMembers {
-		pubKey, err := dkg.ComputeParticipantPublicKey(dkg.Edwards25519Sha512, pID, allCommitments)
-		if err != nil {
-			return fmt.Errorf("failed to compute public key for party %d: %w", pID, err)
-		}
-		pubKeyBytes := pubKey.Encode()
-		publicShares[Uint16ToHexBE(pID)] = hex.EncodeToString(pubKeyBytes)
+	// Keep whichever share the coordinator ended up with. If we left the group, that's none of them.
+	pollResponse, err = DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: groupID})
+	if err != nil {
+		return GroupResult{}, errors.Join(reshareErr, fmt.Errorf("could not check the group's epoch, so every share was kept: %w", err))
 	}
-
-	groupKeyBytes := keyShare.VerificationKey.Encode()
-	groupKeyHex := hex.EncodeToString(groupKeyBytes)
-
-	secretShareBytes := keyShare.Secret.Encode()
-	encryptedShare, err := EncryptShare(recipient, secretShareBytes)
+	config, err = LoadUserConfig()
 	if err != nil {
-		return fmt.Errorf("failed to encrypt share: %w", err)
+		return GroupResult{}, err
 	}
+	if err := config.DropShares(groupID, pollResponse.Epoch); err != nil {
+		return GroupResult{}, err
+	}
+	if pollResponse.Epoch != newEpoch {
+		if reshareErr == nil {
+			reshareErr = fmt.Errorf("group %s is at epoch %d, not %d", groupID, pollResponse.Epoch, newEpoch)
+		}
+		return GroupResult{}, reshareErr
+	}
+	if newSecret == nil {
+		return GroupResult{
+			GroupID: groupID,
+			Status:  "left",
+			Epoch:   epochOf(newEpoch),
+		}, nil
+	}
+	return GroupResult{
+		GroupID:      groupID,
+		Status:       "reshared",
+		PartyID:      myPartyID,
+		Threshold:    state.Threshold,
+		Participants: state.PartySize,
+		Epoch:        epochOf(newEpoch),
+	}, nil
+}
 
+// Abort the reshare in progress for a group
+func CancelReshare(ctx context.Context, host, groupID string) (GroupResult, error) {
 	config, err := LoadUserConfig()
 	if err != nil {
-		return err
+		return GroupResult{}, err
 	}
+	var myPartyID uint16
+	for _, s := range config.Shares {
+		if s.GroupID == groupID {
+			myPartyID = s.MyPartyID
+			break
+		}
+	}
+	if myPartyID == 0 {
+		return GroupResult{}, fmt.Errorf("you do not hold a share for group %s", groupID)
+	}
+	err = DuctReshareAbort(ctx, host, ReshareAbortRequest{
+		GroupID:   groupID,
+		MyPartyID: myPartyID,
+		Reason:    "aborted by user",
+	})
+	if err != nil {
+		return GroupResult{}, err
+	}
+	return GroupResult{GroupID: groupID, Status: "aborted", PartyID: myPartyID}, nil
+}
 
-	err = config.AddShare(host, groupID, groupKeyHex, encryptedShare, publicShares, myPartyID)
+// List local key shares and groups
+func LocalGroups() (GroupList, error) {
+	config, err := LoadUserConfig()
 	if err != nil {
-		return err
+		return GroupList{}, err
 	}
-	ch := ceremonyHash.Sum(nil)
-	if AmIElected(ch, myPartyID, partyMembers) {
-		report := KeygenFinalRequest{
-			GroupID:   groupID,
-			MyPartyID: myPartyID,
-			PublicKey: groupKeyHex,
-		}
-		err := DuctKeygenFinalize(host, report)
+	list := GroupList{Groups: []GroupResult{}}
+	for _, share := range config.Shares {
+		pubKey, err := hex.DecodeString(share.PublicKey)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			return GroupList{}, err
 		}
+		list.Groups = append(list.Groups, GroupResult{
+			GroupID:          share.GroupID,
+			PublicKey:        share.PublicKey,
+			OpenSSHPublicKey: OpenSSHPublicKey(pubKey),
+			Host:             share.Host,
+			PartyID:          share.MyPartyID,
+			Epoch:            epochOf(share.Epoch),
+		})
 	}
-	fmt.Printf("Group public key:\n%s\n", groupKeyHex)
-	os.Exit(0)
-	return nil
+	return list, nil
 }
 
-// Join a keygen ceremony
-func JoinKeyGenCeremony(host, groupID, recipient string) {
-	// This function is getting long. Let's break it down into smaller pieces.
-	// 1. Join the ceremony and get participant info.
-	// 2. Perform DKG Round 1.
-	// 3. Perform DKG Round 2.
-	// 4. Finalize and store keys.
-
-	// 1. Join the ceremony and get participant info.
-	myPartyID, threshold, partySize, partyMembers, err := joinCeremonyAndPoll(host, groupID)
+// Join a signing ceremony, once approve has seen what it signs and returned nil
+func RunSignCeremony(ctx context.Context, ceremonyID, host, identityFile string, message []byte, approve func(SignReview) error) (CeremonyResult, error) {
+	review, err := ReviewSignCeremony(ctx, host, ceremonyID, message)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to join ceremony: %s\n", err.Error())
-		os.Exit(1)
+		return CeremonyResult{}, err
 	}
-
-	// 2. Perform DKG Round 1.
-	participant, r1Data, err := performDKGRound1(host, groupID, myPartyID, threshold, partySize, partyMembers)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "DKG round 1 failed: %s\n", err.Error())
-		os.Exit(1)
+	if err := approve(review); err != nil {
+		return CeremonyResult{}, err
 	}
-
-	// 3. Perform DKG Round 2.
-	r2Data, err := performDKGRound2(host, groupID, myPartyID, partySize, participant, r1Data)
+	groupSig, err := SignWithCeremony(ctx, ceremonyID, host, identityFile, message)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "DKG round 2 failed: %s\n", err.Error())
-		os.Exit(1)
+		return CeremonyResult{}, resumable(ceremonyID, err)
 	}
+	return CeremonyResult{
+		CeremonyID: ceremonyID,
+		GroupID:    review.GroupID,
+		Status:     "complete",
+		Format:     ceremonyFormat(review.OpenSSH, review.SSHCertificate),
+		Namespace:  review.Namespace,
+		Signature:  groupSig,
+	}, nil
+}
 
-	// 4. Finalize and store keys.
-	err = finalizeAndStoreKeys(host, groupID, recipient, myPartyID, partyMembers, participant, r1Data, r2Data)
+// The coordinator settled on its signers without us
+var ErrNotASigner = errors.New("we aren't one of this ceremony's signers; sitting this one out")
+
+// Whether the signers were chosen, or have been settled on, without us
+func excludedFromSigning(ctx context.Context, host, ceremonyID string, myPartyID uint16) bool {
+	pollResponse, err := DuctPollSignCeremony(ctx, host, PollSignRequest{CeremonyID: ceremonyID, PartyID: &myPartyID})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to finalize and store keys: %s\n", err.Error())
-		os.Exit(1)
+		return false
+	}
+	if len(pollResponse.Preferred) > 0 && !slices.Contains(pollResponse.Preferred, myPartyID) {
+		return true
 	}
+	return len(pollResponse.Signers) > 0 && !slices.Contains(pollResponse.Signers, myPartyID)
 }
 
-// List local key shares and groups
-func ListKeyGen() {
-	config, err := LoadUserConfig()
+// Certificate ceremonies sign exactly what the coordinator was given, which the caller should have looked at
+func ceremonyCertificate(pollResponse PollSignResponse, message []byte) (*SSHCertificate, error) {
+	if pollResponse.SSHCertificate == "" {
+		return nil, nil
+	}
+	tbs, err := hex.DecodeString(pollResponse.SSHCertificate)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s", err.Error())
-		os.Exit(1)
+		return nil, err
 	}
-	if len(config.Shares) < 1 {
-		fmt.Printf("No local key shares/groups found")
-		os.Exit(0)
+	if !bytes.Equal(tbs, message) {
+		return nil, errors.New("this ceremony issues an SSH certificate; join it with freeon sign join --ssh-cert")
 	}
-	// List shares
-	fmt.Printf("Group ID\tPublic Key\n")
-	for _, share := range config.Shares {
-		fmt.Printf("%s\t%s\n", share.GroupID, share.PublicKey)
+	cert, err := ParseSSHCertificate(tbs)
+	if err != nil {
+		return nil, err
 	}
+	return &cert, nil
 }
 
-// Join a signing ceremony
-func JoinSignCeremony(ceremonyID, host, identityFile string, message []byte) {
+// Take part in a signing ceremony until it produces a signature, which is returned in whichever format the ceremony
+// asked for
+func SignWithCeremony(ctx context.Context, ceremonyID, host, identityFile string, message []byte) (string, error) {
 	// Let's pull in the data from the local config:
 	config, err := LoadUserConfig()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return "", err
 	}
 
 	// Before we can do anything, we need to get the GroupID from the ceremony.
@@ -332,34 +1524,39 @@ func JoinSignCeremony(ceremonyID, host, identityFile string, message []byte) {
 		CeremonyID: ceremonyID,
 		PartyID:    nil, // We don't know our party ID yet.
 	}
-	pollResponse, err := DuctPollSignCeremony(host, pollRequest)
+	pollResponse, err := DuctPollSignCeremony(ctx, host, pollRequest)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return "", err
 	}
 	groupID := pollResponse.GroupID
-	threshold := pollResponse.Threshold
-
-	var encryptedShare string
-	var publicSharesHex map[string]string
-	var publicKeyHex string
-	var myPartyID uint16
-	for _, s := range config.Shares {
-		if s.GroupID == groupID {
-			encryptedShare = s.EncryptedShare
-			publicSharesHex = s.PublicShares
-			publicKeyHex = s.PublicKey
-			myPartyID = s.MyPartyID
-			break
-		}
+	certificate, err := ceremonyCertificate(pollResponse, message)
+	if err != nil {
+		return "", err
 	}
-	if encryptedShare == "" {
-		fmt.Fprintf(os.Stderr, "could not find encrypted share for group %s\n", groupID)
-		os.Exit(1)
+
+	// Only a share from the group's current epoch will do
+	share, ok := config.FindShare(groupID, pollResponse.Epoch)
+	if !ok {
+		return "", fmt.Errorf("could not find a share for group %s at epoch %d", groupID, pollResponse.Epoch)
 	}
+	myPartyID := share.MyPartyID
 	if myPartyID == 0 {
-		fmt.Fprintf(os.Stderr, "could not find party ID for group %s\n", groupID)
-		os.Exit(1)
+		return "", fmt.Errorf("could not find party ID for group %s", groupID)
+	}
+
+	// Refuse anything our policy won't allow before the coordinator counts us in
+	err = enforcePolicy(ctx, config, PolicyRequest{
+		CeremonyID:     ceremonyID,
+		GroupID:        groupID,
+		MyPartyID:      myPartyID,
+		Message:        message,
+		OpenSSH:        pollResponse.OpenSSH,
+		Namespace:      pollResponse.Namespace,
+		SSHCertificate: certificate != nil,
+		When:           time.Now(),
+	}, false)
+	if err != nil {
+		return "", err
 	}
 
 	// Next, we need to formally join the party
@@ -368,65 +1565,221 @@ func JoinSignCeremony(ceremonyID, host, identityFile string, message []byte) {
 		CeremonyID:  ceremonyID,
 		MessageHash: hash,
 		MyPartyID:   myPartyID,
+		Epoch:       share.Epoch,
 	}
 
 	// Enlist ourselves before we begin polling
-	res, err := DuctJoinSignCeremony(host, joinRequest)
+	res, err := DuctJoinSignCeremony(ctx, host, joinRequest)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		if excludedFromSigning(ctx, host, ceremonyID, myPartyID) {
+			return "", ErrNotASigner
+		}
+		return "", err
 	}
 	if !res.Status {
-		fmt.Fprintf(os.Stderr, "An unexpected error has occurred.\n")
-		os.Exit(1)
+		return "", errors.New("an unexpected error has occurred")
 	}
-	openssh := res.OpenSSH
-	opensshNamespace := res.Namespace
 
-	// Now let's begin polling the server until enough parties join
-	for {
-		// We need to use our actual party ID for polling now
-		pollRequest.PartyID = &myPartyID
-		pollResponse, err = DuctPollSignCeremony(host, pollRequest)
+	j := &Journal{
+		Kind:      JournalSign,
+		ID:        ceremonyID,
+		Host:      host,
+		GroupID:   groupID,
+		MyPartyID: myPartyID,
+		Epoch:     share.Epoch,
+		Message:   hex.EncodeToString(message),
+		OpenSSH:   res.OpenSSH,
+		Namespace: res.Namespace,
+	}
+	feed := OpenSignFeed(ctx, host, ceremonyID, myPartyID)
+	defer feed.Close()
+	if err := j.Record(RoundJoined, feed); err != nil {
+		return "", err
+	}
+	return finishSign(ctx, j, feed, share, pollResponse.Threshold, certificate, identityFile)
+}
+
+// Pick up a signing ceremony where we left off. Returns the signature, in whichever format the ceremony asked for.
+func ResumeSign(ctx context.Context, j *Journal, identityFile string) (string, error) {
+	pollResponse, err := DuctPollSignCeremony(ctx, j.Host, PollSignRequest{CeremonyID: j.ID})
+	if err != nil {
+		return "", err
+	}
+	message, err := hex.DecodeString(j.Message)
+	if err != nil {
+		return "", err
+	}
+	certificate, err := ceremonyCertificate(pollResponse, message)
+	if err != nil {
+		return "", err
+	}
+	config, err := LoadUserConfig()
+	if err != nil {
+		return "", err
+	}
+	share, ok := config.FindShare(j.GroupID, j.Epoch)
+	if !ok {
+		return "", fmt.Errorf("could not find a share for group %s at epoch %d", j.GroupID, j.Epoch)
+	}
+	feed := OpenSignFeedFrom(ctx, j.Host, j.ID, j.MyPartyID, j.Feed)
+	defer feed.Close()
+	return finishSign(ctx, j, feed, share, pollResponse.Threshold, certificate, identityFile)
+}
+
+// Resume a signing ceremony, and say what came of it
+func ResumeSignCeremony(ctx context.Context, j *Journal, identityFile string) (CeremonyResult, error) {
+	groupSig, err := ResumeSign(ctx, j, identityFile)
+	if err != nil {
+		return CeremonyResult{}, resumable(j.ID, err)
+	}
+	format := ceremonyFormat(j.OpenSSH, false)
+	if sig, err := ParseAnySignature([]byte(groupSig)); err == nil {
+		format = sig.Format
+	}
+	return CeremonyResult{
+		CeremonyID: j.ID,
+		GroupID:    j.GroupID,
+		Status:     "complete",
+		Format:     format,
+		Namespace:  j.Namespace,
+		Signature:  groupSig,
+	}, nil
+}
+
+// Run a signing ceremony from wherever the journal says we got to
+func finishSign(ctx context.Context, j *Journal, feed *Feed, share Shares, threshold uint16, certificate *SSHCertificate, identityFile string) (string, error) {
+	groupSig, err := runSign(ctx, j, feed, share, threshold, certificate, identityFile)
+	if err != nil {
+		// Until we've committed, we can still bow out without holding anyone up
+		if ctx.Err() != nil && !j.Reached(RoundCommitted) && leaveSignCeremony(ctx, j) {
+			j.Remove()
+			return "", err
+		}
+		j.Fail(err)
+		return "", err
+	}
+	j.Remove()
+	return groupSig, nil
+}
+
+// Give our seat in a signing ceremony back, once we've stopped waiting for it, so the ceremony doesn't wait for us
+// instead. The coordinator won't let us once the signers are settled.
+func leaveSignCeremony(ctx context.Context, j *Journal) bool {
+	return leaveCeremony(ctx, "ceremony "+j.ID, func(ctx context.Context) error {
+		return DuctLeaveSignCeremony(ctx, j.Host, LeaveSignRequest{CeremonyID: j.ID, MyPartyID: j.MyPartyID})
+	})
+}
+
+// Tell the coordinator we've gone, so what stopped us doesn't hold up everyone else. False if it didn't hear us.
+func leaveCeremony(ctx context.Context, what string, leave func(context.Context) error) bool {
+	s := sessionFrom(ctx)
+	if s.offline != nil {
+		return false
+	}
+	ctx, cancel := parting(ctx)
+	defer cancel()
+	if err := leave(ctx); err != nil {
+		s.warnf("failed to leave %s: %s", what, err.Error())
+		return false
+	}
+	s.warnf("Left %s, so it won't wait for us.", what)
+	return true
+}
+
+// A context for our last words to the coordinator. Whatever stopped the ceremony doesn't get to stop these too.
+func parting(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), sessionFrom(ctx).requestTimeout)
+}
+
+// Secrets for a signing ceremony in progress
+type signSecrets struct {
+	CommitmentID uint64 `json:"commitment-id"`
+	HidingNonce  string `json:"hiding-nonce"`
+	BindingNonce string `json:"binding-nonce"`
+}
+
+func runSign(ctx context.Context, j *Journal, feed *Feed, share Shares, threshold uint16, certificate *SSHCertificate, identityFile string) (string, error) {
+	host, ceremonyID, myPartyID := j.Host, j.ID, j.MyPartyID
+	encryptedShare := share.EncryptedShare
+	publicSharesHex := share.PublicShares
+	publicKeyHex := share.PublicKey
+	if certificate != nil && hex.EncodeToString(certificate.SignatureKey) != publicKeyHex {
+		return "", errors.New("certificate is not issued by this group's key")
+	}
+	message, err := hex.DecodeString(j.Message)
+	if err != nil {
+		return "", err
+	}
+
+	policyRequest := PolicyRequest{
+		CeremonyID:     ceremonyID,
+		GroupID:        j.GroupID,
+		MyPartyID:      myPartyID,
+		Message:        message,
+		OpenSSH:        j.OpenSSH,
+		Namespace:      j.Namespace,
+		SSHCertificate: certificate != nil,
+	}
+
+	// OpenSSH signatures cover a digest of the message, bound to the namespace, rather than the message itself
+	if j.OpenSSH {
+		message = SSHSIGSignedData(j.Namespace, message)
+	}
+
+	// Now let's wait until the coordinator settles on who signs, unless we've already started.
+	// Everyone has to use exactly the same signers, or nobody's commitments will line up.
+	partyMembers := j.Signers
+	if !j.Reached(RoundCommitted) {
+		var pollResponse PollSignResponse
+		err = feed.WaitForState(&pollResponse, func() bool {
+			return len(pollResponse.Signers) > 0 || pollResponse.Status == "expired" || pollResponse.Status == "closed"
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-			os.Exit(1)
+			return "", err
 		}
-		others := uint16(len(pollResponse.OtherParties))
-		if others+1 >= threshold {
-			break
+		if pollResponse.Status == "expired" || pollResponse.Status == "closed" {
+			return "", ceremonyEnded("ceremony %s before it was signed", pollResponse.Status)
+		}
+		if !slices.Contains(pollResponse.Signers, myPartyID) {
+			return "", ceremonyEndedError{ErrNotASigner}
+		}
+		if uint16(len(pollResponse.Signers)) < threshold {
+			return "", ceremonyEnded("the coordinator chose %d signers, but %d are needed", len(pollResponse.Signers), threshold)
 		}
-		time.Sleep(time.Second)
+		partyMembers = pollResponse.Signers
+	}
+
+	// Last chance for our policy to say no, now that we know who we'd be signing with
+	config, err := LoadUserConfig()
+	if err != nil {
+		return "", err
+	}
+	policyRequest.Signers = partyMembers
+	policyRequest.When = time.Now()
+	if err := enforcePolicy(ctx, config, policyRequest, true); err != nil {
+		return "", ceremonyEndedError{err}
 	}
 
 	// Let's decrypt the local share with age
 	secretBytes, err := DecryptShareFor(encryptedShare, identityFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return "", err
 	}
 	secretKey := dkg.Edwards25519Sha512.Group().NewScalar()
 	if err := secretKey.Decode(secretBytes); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to decode secret key: %s\n", err.Error())
-		os.Exit(1)
+		return "", fmt.Errorf("failed to decode secret key: %w", err)
 	}
 
 	// Let's decode the public key and public shares
 	groupKeyBytes, err := hex.DecodeString(publicKeyHex)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to decode group key: %s\n", err.Error())
-		os.Exit(1)
+		return "", fmt.Errorf("failed to decode group key: %w", err)
 	}
 	groupKey := dkg.Edwards25519Sha512.Group().NewElement()
 	if err := groupKey.Decode(groupKeyBytes); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to decode group key: %s\n", err.Error())
-		os.Exit(1)
+		return "", fmt.Errorf("failed to decode group key: %w", err)
 	}
 
-	// Great, let's process the party members now that we're full
-	partyMembers := []uint16{myPartyID}
-	partyMembers = append(partyMembers, pollResponse.OtherParties...)
-
 	// Create a map of party members for quick lookup
 	partyMemberSet := make(map[uint16]struct{})
 	for _, p := range partyMembers {
@@ -438,21 +1791,18 @@ func JoinSignCeremony(ceremonyID, host, identityFile string, message []byte) {
 	for k, v := range publicSharesHex {
 		p16, err := HexBEToUint16(k)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-			os.Exit(1)
+			return "", err
 		}
 		if _, ok := partyMemberSet[p16]; !ok {
 			continue
 		}
 		rawEl, err := hex.DecodeString(v)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-			os.Exit(1)
+			return "", err
 		}
 		el := dkg.Edwards25519Sha512.Group().NewElement()
 		if err := el.Decode(rawEl); err != nil {
-			fmt.Fprintf(os.Stderr, "failed to decode public share for party %d: %s\n", p16, err.Error())
-			os.Exit(1)
+			return "", fmt.Errorf("failed to decode public share for party %d: %w", p16, err)
 		}
 		ps := &keys.PublicKeyShare{
 			ID:        p16,
@@ -462,16 +1812,22 @@ func JoinSignCeremony(ceremonyID, host, identityFile string, message []byte) {
 		publicShares = append(publicShares, ps)
 	}
 
+	// Party IDs aren't contiguous after a reshare, so the largest one bounds the signer set
+	var maxSigners uint16
+	for k := range publicSharesHex {
+		if p16, err := HexBEToUint16(k); err == nil && p16 > maxSigners {
+			maxSigners = p16
+		}
+	}
 	conf := &frost.Configuration{
 		Ciphersuite:           frost.Ed25519,
 		Threshold:             threshold,
-		MaxSigners:            uint16(len(partyMembers)),
+		MaxSigners:            maxSigners,
 		VerificationKey:       groupKey,
 		SignerPublicKeyShares: publicShares,
 	}
 	if err := conf.Init(); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to initialize frost config: %s\n", err.Error())
-		os.Exit(1)
+		return "", fmt.Errorf("failed to initialize frost config: %w", err)
 	}
 
 	myPublicKey := dkg.Edwards25519Sha512.Group().Base().Multiply(secretKey)
@@ -488,122 +1844,168 @@ func JoinSignCeremony(ceremonyID, host, identityFile string, message []byte) {
 
 	signer, err := conf.Signer(myKeyShare)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to create signer: %s\n", err.Error())
-		os.Exit(1)
+		return "", fmt.Errorf("failed to create signer: %w", err)
 	}
 
 	// Round 1: Commitment
-	ceremonyHash = sha512.New384()
+	// The agent can run several ceremonies at once, so this one gets its own election hash
+	ceremonyHash := sha512.New384()
 	ceremonyHash.Write(ceremonySign)
-	commitment := signer.Commit()
-	commitBytes := commitment.Encode()
-	_, err = DuctSignProtocolMessage(host, SignMessageRequest{
-		CeremonyID: ceremonyID,
-		Message:    hex.EncodeToString(commitBytes),
-		MyPartyID:  myPartyID,
-	})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to send commitment: %s\n", err.Error())
-		os.Exit(1)
+	var commitment *frost.Commitment
+	if j.Reached(RoundSigned) {
+		// Our nonces are gone by now, but we don't need them to resend our share
+		commitment = &frost.Commitment{}
+		if err := commitment.DecodeHex(j.Commitment); err != nil {
+			return "", fmt.Errorf("failed to decode journaled commitment: %w", err)
+		}
+	} else if j.Reached(RoundCommitted) {
+		// Our nonces have to match the commitment everyone else already has
+		commitment, err = restoreCommitment(j, signer, identityFile)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		commitment = signer.Commit()
+		nonce := signer.NonceCommitments[commitment.CommitmentID]
+		recipient, err := IdentityRecipient(identityFile)
+		if err != nil {
+			return "", err
+		}
+		err = j.SetSecrets(recipient, signSecrets{
+			CommitmentID: commitment.CommitmentID,
+			HidingNonce:  nonce.HidingNonce.Hex(),
+			BindingNonce: nonce.BindingNonce.Hex(),
+		})
+		if err != nil {
+			return "", err
+		}
+		j.Signers = partyMembers
+		j.Commitment = commitment.Hex()
+		if err := j.Record(RoundCommitted, feed); err != nil {
+			return "", err
+		}
+	}
+	if !j.Reached(RoundSigned) {
+		commitBytes := commitment.Encode()
+		_, err = DuctSignProtocolMessage(ctx, host, SignMessageRequest{
+			CeremonyID: ceremonyID,
+			Message:    hex.EncodeToString(commitBytes),
+			MyPartyID:  myPartyID,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to send commitment: %w", err)
+		}
 	}
 
-	// Poll for commitments from other participants
+	// Wait for commitments from other participants
 	commitments := make(map[uint16]*frost.Commitment)
 	commitments[myPartyID] = commitment
 	for len(commitments) < len(partyMembers) {
-		resp, err := DuctSignProtocolMessage(host, SignMessageRequest{
-			CeremonyID: ceremonyID,
-			MyPartyID:  myPartyID,
-			LastSeen:   lastMessageIdSeen,
-		})
+		msgBytes, err := feed.NextMessage()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to poll for commitments: %s\n", err.Error())
-			os.Exit(1)
+			return "", fmt.Errorf("failed to wait for commitments: %w", err)
 		}
-		for _, msgStr := range resp.Messages {
-			msgBytes, err := hex.DecodeString(msgStr)
-			if err != nil {
-				continue // Ignore invalid messages
+		c := &frost.Commitment{}
+		if err := c.Decode(msgBytes); err == nil {
+			if _, ok := partyMemberSet[c.SignerID]; !ok {
+				continue
 			}
-			ceremonyHash.Write(msgBytes)
-			c := &frost.Commitment{}
-			if err := c.Decode(msgBytes); err == nil {
-				if _, ok := commitments[c.SignerID]; !ok {
-					commitments[c.SignerID] = c
-				}
+			if _, ok := commitments[c.SignerID]; !ok {
+				commitments[c.SignerID] = c
 			}
 		}
-		lastMessageIdSeen = resp.LatestMessageID
-		time.Sleep(time.Second)
 	}
 
 	var commitmentList []*frost.Commitment
-	for _, c := range commitments {
-		commitmentList = append(commitmentList, c)
+	for _, id := range slices.Sorted(maps.Keys(commitments)) {
+		ceremonyHash.Write(commitments[id].Encode())
+		commitmentList = append(commitmentList, commitments[id])
 	}
 
 	// Round 2: Sign
-	sigShare, err := signer.Sign(message, commitmentList)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to sign: %s\n", err.Error())
-		os.Exit(1)
+	sigShare := &frost.SignatureShare{}
+	if j.Reached(RoundSigned) {
+		// Never sign twice with the same nonces; send the share we already made
+		if err := sigShare.DecodeHex(j.SignatureShare); err != nil {
+			return "", fmt.Errorf("failed to decode journaled signature share: %w", err)
+		}
+	} else {
+		sigShare, err = signer.Sign(message, commitmentList)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign: %w", err)
+		}
+		j.SignatureShare = sigShare.Hex()
+		j.Secrets = ""
+		if err := j.Record(RoundSigned, feed); err != nil {
+			return "", err
+		}
 	}
 	shareBytes := sigShare.Encode()
-	_, err = DuctSignProtocolMessage(host, SignMessageRequest{
+	_, err = DuctSignProtocolMessage(ctx, host, SignMessageRequest{
 		CeremonyID: ceremonyID,
 		Message:    hex.EncodeToString(shareBytes),
 		MyPartyID:  myPartyID,
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to send signature share: %s\n", err.Error())
-		os.Exit(1)
+		return "", fmt.Errorf("failed to send signature share: %w", err)
 	}
 
-	// Poll for signature shares from other participants
+	// Wait for signature shares from other participants
 	sigShares := make(map[uint16]*frost.SignatureShare)
 	sigShares[myPartyID] = sigShare
 	for len(sigShares) < len(partyMembers) {
-		resp, err := DuctSignProtocolMessage(host, SignMessageRequest{
-			CeremonyID: ceremonyID,
-			MyPartyID:  myPartyID,
-			LastSeen:   lastMessageIdSeen,
-		})
+		msgBytes, err := feed.NextMessage()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to poll for signature shares: %s\n", err.Error())
-			os.Exit(1)
+			return "", fmt.Errorf("failed to wait for signature shares: %w", err)
 		}
-		for _, msgStr := range resp.Messages {
-			msgBytes, err := hex.DecodeString(msgStr)
-			if err != nil {
-				continue // Ignore invalid messages
+		s := &frost.SignatureShare{}
+		if err := s.Decode(msgBytes); err == nil {
+			// A share from outside the signer set would count toward the total and shut out a real signer
+			if _, ok := partyMemberSet[s.SignerIdentifier]; !ok {
+				continue
 			}
-			ceremonyHash.Write(msgBytes)
-			s := &frost.SignatureShare{}
-			if err := s.Decode(msgBytes); err == nil {
-				if _, ok := sigShares[s.SignerIdentifier]; !ok {
-					sigShares[s.SignerIdentifier] = s
-				}
+			if _, ok := sigShares[s.SignerIdentifier]; !ok {
+				sigShares[s.SignerIdentifier] = s
 			}
 		}
-		lastMessageIdSeen = resp.LatestMessageID
-		time.Sleep(time.Second)
 	}
 	var signatureShares []*frost.SignatureShare
-	for _, s := range sigShares {
-		signatureShares = append(signatureShares, s)
+	for _, id := range slices.Sorted(maps.Keys(sigShares)) {
+		ceremonyHash.Write(sigShares[id].Encode())
+		signatureShares = append(signatureShares, sigShares[id])
+	}
+
+	// Check every share before aggregating, so a failure can be pinned on someone
+	cheaters := FindInvalidSignatureShares(conf, message, signatureShares, commitmentList)
+	if len(cheaters) > 0 {
+		blame := make([]FreeonBlame, 0, len(cheaters))
+		for _, c := range cheaters {
+			blame = append(blame, FreeonBlame{Reporter: myPartyID, Accused: c, Reason: "invalid signature share"})
+		}
+		err := DuctSignBlame(ctx, host, BlameRequest{
+			CeremonyID: ceremonyID,
+			MyPartyID:  myPartyID,
+			Accused:    cheaters,
+			Reason:     "invalid signature share",
+		})
+		if err != nil {
+			sessionFrom(ctx).warnf("failed to report blame: %s", err)
+		}
+		return "", ceremonyEndedError{CeremonyAbortedError{ceremonyID, blame}}
 	}
 
 	// Aggregate signatures
 	finalSignature, err := conf.AggregateSignatures(message, signatureShares, commitmentList, true)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to aggregate signatures: %s\n", err.Error())
-		os.Exit(1)
+		return "", fmt.Errorf("failed to aggregate signatures: %w", err)
 	}
 
 	finalSignatureBytes := append(finalSignature.R.Encode(), finalSignature.Z.Encode()...)
 	var groupSig string
-	if openssh {
-		groupSig = OpenSSHEncode(groupKeyBytes, finalSignatureBytes, opensshNamespace)
+	if certificate != nil {
+		groupSig = certificate.Encode(finalSignatureBytes)
+	} else if j.OpenSSH {
+		groupSig = OpenSSHEncode(groupKeyBytes, finalSignatureBytes, j.Namespace)
 	} else {
 		groupSig = hex.EncodeToString(finalSignatureBytes)
 	}
@@ -614,80 +2016,164 @@ func JoinSignCeremony(ceremonyID, host, identityFile string, message []byte) {
 			MyPartyID:  myPartyID,
 			Signature:  groupSig,
 		}
-		err := DuctSignFinalize(host, report)
+		err := DuctSignFinalize(ctx, host, report)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			sessionFrom(ctx).warnf("%s", err)
+		}
+	}
+	return groupSig, nil
+}
+
+// Put back the nonces behind the commitment we journaled
+func restoreCommitment(j *Journal, signer *frost.Signer, identityFile string) (*frost.Commitment, error) {
+	var secrets signSecrets
+	if err := j.OpenSecrets(identityFile, &secrets); err != nil {
+		return nil, err
+	}
+	g := dkg.Edwards25519Sha512.Group()
+	hidingNonce := g.NewScalar()
+	if err := hidingNonce.DecodeHex(secrets.HidingNonce); err != nil {
+		return nil, fmt.Errorf("failed to decode journaled nonce: %w", err)
+	}
+	bindingNonce := g.NewScalar()
+	if err := bindingNonce.DecodeHex(secrets.BindingNonce); err != nil {
+		return nil, fmt.Errorf("failed to decode journaled nonce: %w", err)
+	}
+	commitment := &frost.Commitment{
+		Group:                  g,
+		SignerID:               j.MyPartyID,
+		CommitmentID:           secrets.CommitmentID,
+		HidingNonceCommitment:  g.Base().Multiply(hidingNonce),
+		BindingNonceCommitment: g.Base().Multiply(bindingNonce),
+	}
+	signer.NonceCommitments[secrets.CommitmentID] = &frost.Nonce{
+		HidingNonce:  hidingNonce,
+		BindingNonce: bindingNonce,
+		Commitment:   commitment.Copy(),
+	}
+	return commitment, nil
+}
+
+// Verify each signature share against the signer's public key share.
+// Returns the party IDs of every signer whose share is invalid, in ascending order.
+func FindInvalidSignatureShares(conf *frost.Configuration, message []byte, shares []*frost.SignatureShare, commitments frost.CommitmentList) []uint16 {
+	var cheaters []uint16
+	for _, share := range shares {
+		if err := conf.VerifySignatureShare(share, message, commitments); err != nil {
+			cheaters = append(cheaters, share.SignerIdentifier)
 		}
 	}
-	fmt.Printf("Signature:\n%s\n", groupSig)
+	slices.Sort(cheaters)
+	return cheaters
+}
+
+// Print the blame reports for an aborted ceremony
+func printBlame(w io.Writer, blame []FreeonBlame) {
+	for _, b := range blame {
+		fmt.Fprintf(w, "\tParty %d blamed party %d: %s\n", b.Reporter, b.Accused, b.Reason)
+	}
 }
 
 // List the most recent signing ceremonies
-func ListSign(host, groupID string, limit, offset int64) {
+func ListSignCeremonies(ctx context.Context, host, groupID string, limit, offset int64) (CeremonyList, error) {
 	req := ListSignRequest{
 		GroupID: groupID,
 		Limit:   limit,
 		Offset:  offset,
 	}
-	res, err := DuctSignList(host, req)
+	res, err := DuctSignList(ctx, host, req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s", err.Error())
-		os.Exit(1)
+		return CeremonyList{}, err
 	}
-	count := len(res.Ceremonies)
-	if count < 1 {
-		fmt.Printf("No ceremonies found.")
-		os.Exit(1)
-	}
-
-	// Loop over the list and print the output to the console.
-	fmt.Printf("Listing the most recent %d ceremonies:\n\n", count)
-	fmt.Printf("\tCeremony ID\tHash\tFormat\tOpen?\n")
-	fmt.Printf("\t-------------------------------------------------------------------------------\n")
+	list := CeremonyList{Ceremonies: []CeremonyResult{}}
 	for _, ceremony := range res.Ceremonies {
-		var format string
-		var status string
-
-		if ceremony.OpenSSH {
-			format = "OpeenSSH"
-		} else {
-			format = "Raw"
+		result := CeremonyResult{
+			CeremonyID: ceremony.Uid,
+			GroupID:    groupID,
+			Format:     ceremonyFormat(ceremony.OpenSSH, ceremony.SSHCertificate),
+			Namespace:  ceremony.OpenSSHNamespace,
+			Hash:       ceremony.Hash,
+			Blame:      ceremony.Blame,
+		}
+		if ceremony.Signature != nil {
+			result.Signature = *ceremony.Signature
 		}
-		if ceremony.Active {
-			status = "Open"
-		} else {
-			status = " -- "
+		switch {
+		case ceremony.Active:
+			result.Status = "open"
+		case ceremony.Expired:
+			result.Status = "expired"
+		case len(ceremony.Blame) > 0:
+			result.Status = "aborted"
+		case ceremony.Verdict != nil:
+			result.Status = "disputed"
+		case result.Signature != "":
+			result.Status = "complete"
+		default:
+			result.Status = "closed"
 		}
-		fmt.Printf("\t%s\t%s\t%s\t%s\n", ceremony.Uid, ceremony.Hash, format, status)
+		list.Ceremonies = append(list.Ceremonies, result)
 	}
-	fmt.Printf("\n")
-	os.Exit(0)
+	return list, nil
 }
 
 // Fetch a signature from the coordinator for a given ceremony
-func GetSignSignature(ceremonyID, host string) {
+func FetchSignature(ctx context.Context, ceremonyID, host string) (CeremonyResult, error) {
 	req := GetSignRequest{
 		CeremonyID: ceremonyID,
 	}
-	res, err := DuctGetSignature(host, req)
+	res, err := DuctGetSignature(ctx, host, req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s", err.Error())
-		os.Exit(1)
+		return CeremonyResult{}, err
 	}
-	fmt.Printf("Signature:\n%s\n", res.Signature)
-	os.Exit(0)
+	if res.Signature == "" && len(res.Blame) > 0 {
+		return CeremonyResult{}, CeremonyAbortedError{ceremonyID, res.Blame}
+	}
+	result := CeremonyResult{CeremonyID: ceremonyID, Status: "complete", Signature: res.Signature, Unverified: res.Unverified}
+	if sig, err := ParseAnySignature([]byte(res.Signature)); err == nil {
+		result.Format = sig.Format
+	}
+	return result, nil
 }
 
 // Tell the coordinator to pull the plug on a signing ceremony
-func TerminateSignCeremony(host, ceremonyID string) {
+func TerminateCeremony(ctx context.Context, host, ceremonyID string) (CeremonyResult, error) {
 	req := TerminateRequest{
 		CeremonyID: ceremonyID,
 	}
-	err := DuctTerminateSignCeremony(host, req)
+	// Without an API token, only the group's administrators may terminate, so we need to know our party ID
+	if sessionFrom(ctx).apiToken == "" {
+		pollResponse, err := DuctPollSignCeremony(ctx, host, PollSignRequest{CeremonyID: ceremonyID})
+		if err != nil {
+			return CeremonyResult{}, err
+		}
+		req.MyPartyID, err = localPartyID(pollResponse.GroupID)
+		if err != nil {
+			return CeremonyResult{}, err
+		}
+	}
+	err := DuctTerminateSignCeremony(ctx, host, req)
+	if err != nil {
+		return CeremonyResult{}, err
+	}
+	return CeremonyResult{CeremonyID: ceremonyID, Status: "terminated"}, nil
+}
+
+// Retire a group for good. Any ceremonies it still has open are closed.
+func ArchiveKeyGroup(ctx context.Context, host, groupID string) (GroupResult, error) {
+	req := ArchiveRequest{
+		GroupID: groupID,
+	}
+	if sessionFrom(ctx).apiToken == "" {
+		var err error
+		req.MyPartyID, err = localPartyID(groupID)
+		if err != nil {
+			return GroupResult{}, err
+		}
+	}
+	err := DuctArchiveGroup(ctx, host, req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
-		os.Exit(1)
+		return GroupResult{}, err
 	}
-	fmt.Println("Ceremony terminated.")
-	os.Exit(0)
+	return GroupResult{GroupID: groupID, Status: "archived"}, nil
 }
@@ -0,0 +1,62 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/bytemare/frost"
+	"github.com/bytemare/frost/debug"
+	"github.com/bytemare/secret-sharing/keys"
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindInvalidSignatureShares(t *testing.T) {
+	message := []byte("test message")
+	secretShares, groupKey, _ := debug.TrustedDealerKeygen(frost.Ed25519, nil, 2, 3)
+	publicShares := make([]*keys.PublicKeyShare, len(secretShares))
+	for i, s := range secretShares {
+		publicShares[i] = s.Public()
+	}
+	conf := &frost.Configuration{
+		Ciphersuite:           frost.Ed25519,
+		Threshold:             2,
+		MaxSigners:            3,
+		VerificationKey:       groupKey,
+		SignerPublicKeyShares: publicShares,
+	}
+	assert.NoError(t, conf.Init())
+
+	// Parties 2 and 3 sign
+	var signers []*frost.Signer
+	var commitments frost.CommitmentList
+	for _, s := range secretShares[1:] {
+		signer, err := conf.Signer(s)
+		assert.NoError(t, err)
+		signers = append(signers, signer)
+		commitments = append(commitments, signer.Commit())
+	}
+	var shares []*frost.SignatureShare
+	for _, signer := range signers {
+		share, err := signer.Sign(message, commitments)
+		assert.NoError(t, err)
+		shares = append(shares, share)
+	}
+	assert.Empty(t, internal.FindInvalidSignatureShares(conf, message, shares, commitments))
+
+	// Party 3 cheats
+	shares[1].SignatureShare = frost.Ed25519.Group().NewScalar().Random()
+	assert.Equal(t, []uint16{3}, internal.FindInvalidSignatureShares(conf, message, shares, commitments))
+}
+
+func TestCheckKeygenMembers(t *testing.T) {
+	identityKeys := map[uint16]string{1: "aa", 2: "bb", 3: "cc"}
+	assert.NoError(t, internal.CheckKeygenMembers(identityKeys, 1, "aa", nil))
+	assert.NoError(t, internal.CheckKeygenMembers(identityKeys, 1, "aa", []string{"CC", "bb"}))
+
+	// The coordinator has us down with someone else's key
+	assert.Error(t, internal.CheckKeygenMembers(identityKeys, 1, "dd", nil))
+
+	// Somebody we weren't expecting, or somebody missing
+	assert.Error(t, internal.CheckKeygenMembers(identityKeys, 1, "aa", []string{"bb", "dd"}))
+	assert.Error(t, internal.CheckKeygenMembers(identityKeys, 1, "aa", []string{"bb"}))
+}
@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"filippo.io/age"
+)
+
+// Kinds of ceremony we can resume
+const (
+	JournalKeygen = "keygen"
+	JournalSign   = "sign"
+)
+
+// Steps through each kind of ceremony, in order. A journal records the last one it finished.
+//
+// Every secret a step needs is journaled before anything derived from it is sent, so a resumed ceremony always picks
+// up the same secrets rather than making new ones.
+const (
+	RoundJoined    = "joined"
+	RoundDKG1      = "dkg-round1"
+	RoundDKG2      = "dkg-round2"
+	RoundComplaint = "complaint"
+	RoundStored    = "stored"
+	RoundCommitted = "committed"
+	RoundSigned    = "signed"
+)
+
+var journalRounds = map[string][]string{
+	JournalKeygen: {RoundJoined, RoundDKG1, RoundDKG2, RoundComplaint, RoundStored},
+	JournalSign:   {RoundJoined, RoundCommitted, RoundSigned},
+}
+
+// Ceremony IDs end up in file names, so they had better look like ceremony IDs
+var journalIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Our progress through one ceremony, saved to disk after every step so freeon resume can pick up where we left off
+type Journal struct {
+	Kind      string `json:"kind"`
+	ID        string `json:"id"`
+	Host      string `json:"host"`
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Round     string `json:"round"`
+	// Where the ceremony's feed got to
+	Feed FeedCheckpoint `json:"feed"`
+	// In-progress secrets, encrypted with age
+	Secrets string `json:"secrets,omitempty"`
+
+	// Key generation
+	Threshold uint16 `json:"threshold,omitempty"`
+	PartySize uint16 `json:"party-size,omitempty"`
+	Recipient string `json:"recipient,omitempty"`
+	// The other members' identity keys, if we were told them
+	Members []string `json:"members,omitempty"`
+
+	// Signing
+	Epoch     uint64 `json:"epoch,omitempty"`
+	Message   string `json:"message,omitempty"`
+	OpenSSH   bool   `json:"openssh,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Who we committed to signing with. Signing again with anyone else would reuse our nonces.
+	Signers []uint16 `json:"signers,omitempty"`
+	// The commitment we sent them
+	Commitment string `json:"commitment,omitempty"`
+	// Our signature share, once we've made it. The nonces are gone by then.
+	SignatureShare string `json:"signature-share,omitempty"`
+}
+
+func getJournalDir() (string, error) {
+	homeDir, err := getHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".freeon-journal"), nil
+}
+
+func journalPath(id string) (string, error) {
+	if !journalIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid ceremony ID: %q", id)
+	}
+	dir, err := getJournalDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// Is there anything to resume for a ceremony or key group?
+func HasJournal(id string) bool {
+	_, err := LoadJournal(id)
+	return err == nil
+}
+
+// Load the journal for a ceremony or key group
+func LoadJournal(id string) (*Journal, error) {
+	path, err := journalPath(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("nothing to resume for %s", id)
+		}
+		return nil, err
+	}
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	if _, ok := journalRounds[j.Kind]; !ok {
+		return nil, fmt.Errorf("unknown ceremony kind: %q", j.Kind)
+	}
+	return &j, nil
+}
+
+// Has the ceremony finished this step?
+func (j *Journal) Reached(round string) bool {
+	rounds := journalRounds[j.Kind]
+	have := slices.Index(rounds, j.Round)
+	want := slices.Index(rounds, round)
+	return want >= 0 && have >= want
+}
+
+// Finish a step, and save everything the feed has received so far along with it
+func (j *Journal) Record(round string, feed *Feed) error {
+	if !slices.Contains(journalRounds[j.Kind], round) {
+		return fmt.Errorf("%s ceremonies have no %q step", j.Kind, round)
+	}
+	j.Round = round
+	if feed != nil {
+		j.Feed = feed.Checkpoint()
+	}
+	return j.Save()
+}
+
+func (j *Journal) Save() error {
+	path, err := journalPath(j.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(j, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// Forget the ceremony, once it's over one way or another
+func (j *Journal) Remove() error {
+	path, err := journalPath(j.ID)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Encrypt the in-progress secrets to an age recipient
+func (j *Journal) SetSecrets(recipient string, secrets any) error {
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	if j.Secrets, err = EncryptShare(recipient, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Decrypt the in-progress secrets with our age identity
+func (j *Journal) OpenSecrets(identityFile string, secrets any) error {
+	if j.Secrets == "" {
+		return errors.New("journal has no secrets")
+	}
+	data, err := DecryptShareFor(j.Secrets, identityFile)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt journal: %w", err)
+	}
+	return json.Unmarshal(data, secrets)
+}
+
+// The recipient for the first X25519 identity in an age identity file, for journaling secrets we'll need it to open
+func IdentityRecipient(identityFile string) (string, error) {
+	identities, err := ParseAgeIdentityFile(identityFile)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range identities {
+		if x, ok := id.(*age.X25519Identity); ok {
+			return x.Recipient().String(), nil
+		}
+	}
+	return "", fmt.Errorf("no X25519 identities found in %s", identityFile)
+}
+
+// A ceremony that's over, so there's no point in resuming it
+type ceremonyEndedError struct {
+	error
+}
+
+func (e ceremonyEndedError) Unwrap() error {
+	return e.error
+}
+
+func ceremonyEnded(format string, args ...any) error {
+	return ceremonyEndedError{fmt.Errorf(format, args...)}
+}
+
+// Clean up after a ceremony that failed. Only ceremonies that are still going are worth resuming.
+func (j *Journal) Fail(err error) {
+	if errors.As(err, &ceremonyEndedError{}) {
+		j.Remove()
+	}
+}
+
+// Tell the user how to pick a ceremony back up, if there's anything to pick up
+func PrintResumeHint(id string) {
+	j, err := LoadJournal(id)
+	if err != nil || j.Round == "" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "To pick up where you left off, run:\n\tfreeon resume -i [identity-file] %s\n", id)
+}
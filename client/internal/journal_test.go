@@ -0,0 +1,61 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("FREEON_HOME", home)
+
+	identity := mustIdentity(t)
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	assert.NoError(t, os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600))
+	recipient, err := internal.IdentityRecipient(identityFile)
+	assert.NoError(t, err)
+	assert.Equal(t, identity.Recipient().String(), recipient)
+
+	_, err = internal.LoadJournal("cer_missing")
+	assert.Error(t, err)
+	_, err = internal.LoadJournal("../config")
+	assert.Error(t, err)
+
+	j := &internal.Journal{Kind: internal.JournalSign, ID: "cer_abc123", Host: "localhost", GroupID: "grp_abc123", MyPartyID: 2}
+	assert.False(t, j.Reached(internal.RoundJoined))
+	assert.NoError(t, j.Record(internal.RoundJoined, nil))
+	assert.Error(t, j.Record(internal.RoundDKG1, nil))
+
+	// Secrets are only readable with our identity, even on disk
+	type secrets struct {
+		Nonce string `json:"nonce"`
+	}
+	assert.NoError(t, j.SetSecrets(recipient, secrets{Nonce: "deadbeef"}))
+	j.Signers = []uint16{2, 3}
+	assert.NoError(t, j.Record(internal.RoundCommitted, nil))
+	data, err := os.ReadFile(filepath.Join(home, ".freeon-journal", "cer_abc123.json"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "deadbeef")
+
+	loaded, err := internal.LoadJournal("cer_abc123")
+	assert.NoError(t, err)
+	assert.True(t, loaded.Reached(internal.RoundJoined))
+	assert.True(t, loaded.Reached(internal.RoundCommitted))
+	assert.False(t, loaded.Reached(internal.RoundSigned))
+	assert.Equal(t, []uint16{2, 3}, loaded.Signers)
+	var opened secrets
+	assert.NoError(t, loaded.OpenSecrets(identityFile, &opened))
+	assert.Equal(t, "deadbeef", opened.Nonce)
+
+	otherFile := filepath.Join(t.TempDir(), "other.txt")
+	assert.NoError(t, os.WriteFile(otherFile, []byte(mustIdentity(t).String()+"\n"), 0600))
+	assert.Error(t, loaded.OpenSecrets(otherFile, &opened))
+
+	assert.NoError(t, loaded.Remove())
+	_, err = internal.LoadJournal("cer_abc123")
+	assert.Error(t, err)
+}
@@ -0,0 +1,375 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Ceremonies for share holders whose machines never touch the network.
+//
+// An offline client doesn't make any requests. Whatever it would have asked the coordinator is answered from an
+// inbound bundle, and whatever it would have sent (already signed with its identity key) goes into an outbound
+// bundle. `freeon relay`, on a machine that can reach the coordinator, delivers the outbound bundle and writes the
+// next inbound one. When the offline client needs something the inbound bundle doesn't have yet, it journals its
+// progress and stops; running the same command with the next inbound bundle picks up where it left off.
+
+// The inbound bundle has run dry
+var errWaitingForRelay = errors.New("waiting for the coordinator")
+
+// Everything an offline client wants delivered to the coordinator
+type OutboundBundle struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	// Zero until we know it
+	PartyID  uint16           `json:"party-id,omitempty"`
+	Requests []BundledRequest `json:"requests"`
+	// Everything the coordinator has already answered, over every trip so far. The relay ignores it; it's how we
+	// remember not to send something twice, since the inbound bundle only has the answers from the latest trip.
+	Delivered []BundledResponse `json:"delivered,omitempty"`
+}
+
+// A request, exactly as the offline client would have sent it
+type BundledRequest struct {
+	Path      string `json:"path"`
+	Body      string `json:"body"`
+	Signature string `json:"signature"`
+}
+
+// Everything the coordinator had to say, as of the last time the relay asked
+type InboundBundle struct {
+	Kind    string `json:"kind"`
+	ID      string `json:"id"`
+	PartyID uint16 `json:"party-id,omitempty"`
+	// What the poll endpoint returned, asking as PartyID
+	State json.RawMessage `json:"state,omitempty"`
+	// Every protocol message in the ceremony so far, in order
+	Messages  []string          `json:"messages"`
+	LastSeen  int64             `json:"last-seen"`
+	Responses []BundledResponse `json:"responses"`
+}
+
+// How the coordinator answered a bundled request
+type BundledResponse struct {
+	Path     string `json:"path"`
+	Body     string `json:"body"`
+	Status   int    `json:"status"`
+	Response string `json:"response"`
+}
+
+// Requests we can't carry on without an answer to
+var offlineNeedsAnswer = []string{"/keygen/join", "/sign/join"}
+
+// Stands in for the coordinator while we're offline
+type offlineLink struct {
+	inbound      InboundBundle
+	outbound     OutboundBundle
+	inboundFile  string
+	outboundFile string
+}
+
+// Take a ceremony offline: from here on, the coordinator is only reachable through bundles
+func (s *Session) GoOffline(kind, id, inboundFile, outboundFile string) error {
+	if _, ok := journalRounds[kind]; !ok {
+		return fmt.Errorf("unknown ceremony kind: %q", kind)
+	}
+	link := &offlineLink{
+		inbound:      InboundBundle{Kind: kind, ID: id},
+		outbound:     OutboundBundle{Kind: kind, ID: id, Requests: []BundledRequest{}},
+		inboundFile:  inboundFile,
+		outboundFile: outboundFile,
+	}
+	// Before our first trip to the relay, there's nothing to read yet
+	data, err := os.ReadFile(inboundFile)
+	if err == nil {
+		if err := json.Unmarshal(data, &link.inbound); err != nil {
+			return fmt.Errorf("failed to read %s: %w", inboundFile, err)
+		}
+		if link.inbound.Kind != kind || link.inbound.ID != id {
+			return fmt.Errorf("%s is for %s %s, not %s %s", inboundFile, link.inbound.Kind, link.inbound.ID, kind, id)
+		}
+		link.outbound.PartyID = link.inbound.PartyID
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	// Whatever was delivered on earlier trips is only written down in the last outbound bundle
+	data, err = os.ReadFile(outboundFile)
+	if err == nil {
+		var previous OutboundBundle
+		if err := json.Unmarshal(data, &previous); err != nil {
+			return fmt.Errorf("failed to read %s: %w", outboundFile, err)
+		}
+		// A bundle left over from some other ceremony has nothing to tell us
+		if previous.Kind == kind && previous.ID == id {
+			link.outbound.Delivered = previous.Delivered
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	for _, r := range link.inbound.Responses {
+		if _, ok := link.delivered(r.Path, r.Body); !ok {
+			link.outbound.Delivered = append(link.outbound.Delivered, r)
+		}
+	}
+	// Whatever happens, the relay needs to know what to ask for next time
+	if err := link.save(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.offline = link
+	s.httpClient = &http.Client{Transport: link}
+	s.mu.Unlock()
+	return nil
+}
+
+// Take the freeon command's ceremony offline
+func GoOffline(kind, id, inboundFile, outboundFile string) error {
+	return commandSession.GoOffline(kind, id, inboundFile, outboundFile)
+}
+
+// How the coordinator answered a request, if it ever got it
+func (l *offlineLink) delivered(path, body string) (BundledResponse, bool) {
+	for _, r := range l.outbound.Delivered {
+		if r.Path == path && r.Body == body {
+			return r, true
+		}
+	}
+	return BundledResponse{}, false
+}
+
+func (l *offlineLink) save() error {
+	data, err := json.MarshalIndent(l.outbound, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(l.outboundFile, data, 0600)
+}
+
+// Answer a request from the inbound bundle, or queue it for the relay
+func (l *offlineLink) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	path := req.URL.Path
+
+	// Whoever we say we are, the relay should ask as
+	var about struct {
+		PartyID *uint16 `json:"party-id"`
+	}
+	json.Unmarshal(body, &about)
+	if about.PartyID != nil && *about.PartyID != l.outbound.PartyID {
+		l.outbound.PartyID = *about.PartyID
+		if err := l.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	signature := req.Header.Get(SignatureHeader)
+	if signature != "" {
+		if r, ok := l.delivered(path, string(body)); ok {
+			return offlineResponse(req, r.Status, []byte(r.Response)), nil
+		}
+		l.outbound.Requests = append(l.outbound.Requests, BundledRequest{Path: path, Body: string(body), Signature: signature})
+		if err := l.save(); err != nil {
+			return nil, err
+		}
+		if slices.Contains(offlineNeedsAnswer, path) {
+			return nil, errWaitingForRelay
+		}
+		// The relay will find out if the coordinator had a problem with it
+		return offlineResponse(req, http.StatusOK, []byte("{}")), nil
+	}
+
+	if strings.HasSuffix(path, "/poll") {
+		// The state looks different depending on who's asking
+		if l.inbound.State == nil || (about.PartyID != nil && *about.PartyID != l.inbound.PartyID) {
+			return nil, errWaitingForRelay
+		}
+		return offlineResponse(req, http.StatusOK, l.inbound.State), nil
+	}
+	return nil, fmt.Errorf("%s is not available offline", path)
+}
+
+func offlineResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// Offline, a feed gets everything it's going to get this time around all at once
+func (f *Feed) replayBundle(offline *offlineLink, source feedSource) {
+	f.mu.Lock()
+	have := len(f.received)
+	f.mu.Unlock()
+	// The transcript we started with is always a prefix of the ceremony's messages
+	var batch [][]byte
+	for _, m := range offline.inbound.Messages[min(have, len(offline.inbound.Messages)):] {
+		msg, err := hex.DecodeString(m)
+		if err == nil {
+			batch = append(batch, msg)
+		}
+	}
+	f.pushMessages(batch, offline.inbound.LastSeen)
+
+	state, err := source.pollState()
+	if err != nil {
+		f.fail(err)
+		return
+	}
+	encoded, err := json.Marshal(state)
+	if err == nil {
+		f.pushState(encoded)
+	}
+	f.fail(errWaitingForRelay)
+}
+
+// If we stopped because the inbound bundle ran dry, tell the user what to carry where, and exit
+func exitIfWaitingForRelay(err error) {
+	offline := commandSession.offline
+	if offline == nil || !errors.Is(err, errWaitingForRelay) {
+		return
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "Waiting for the coordinator. Take %s to a machine that can reach it, and run:\n", offline.outboundFile)
+	fmt.Fprintf(&text, "\tfreeon relay -h [host] --outbound %s --inbound %s\n", offline.outboundFile, offline.inboundFile)
+	fmt.Fprintf(&text, "Then bring %s back here and run this command again.\n", offline.inboundFile)
+	Succeed(text.String(), OfflineResult{
+		Status:   "waiting-for-relay",
+		Outbound: offline.outboundFile,
+		Inbound:  offline.inboundFile,
+	})
+}
+
+// We're done, but the coordinator might still be waiting to hear from us
+func reportUndelivered() {
+	offline := commandSession.offline
+	if offline == nil || len(offline.outbound.Requests) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Take %s to the relay one last time, to deliver our final messages.\n", offline.outboundFile)
+}
+
+// Deliver an offline client's outbound bundle to the coordinator, then write the next inbound bundle for it
+func Relay(ctx context.Context, host, outboundFile, inboundFile string) (RelayResult, error) {
+	inbound, err := RelayBundle(ctx, host, outboundFile)
+	if err != nil {
+		return RelayResult{}, err
+	}
+	data, err := json.MarshalIndent(inbound, "", "    ")
+	if err != nil {
+		return RelayResult{}, err
+	}
+	if err := writeFileAtomic(inboundFile, data, 0600); err != nil {
+		return RelayResult{}, err
+	}
+	for _, r := range inbound.Responses {
+		if r.Status != http.StatusOK {
+			sessionFrom(ctx).warnf("%s failed with status code %d: %s", r.Path, r.Status, strings.TrimSpace(r.Response))
+		}
+	}
+	return RelayResult{
+		Delivered: len(inbound.Responses),
+		Messages:  len(inbound.Messages),
+		Inbound:   inboundFile,
+	}, nil
+}
+
+// Deliver an outbound bundle, and collect everything the offline client will want to know next
+func RelayBundle(ctx context.Context, host, outboundFile string) (InboundBundle, error) {
+	data, err := os.ReadFile(outboundFile)
+	if err != nil {
+		return InboundBundle{}, err
+	}
+	var outbound OutboundBundle
+	if err := json.Unmarshal(data, &outbound); err != nil {
+		return InboundBundle{}, fmt.Errorf("failed to read %s: %w", outboundFile, err)
+	}
+	if err := InitializeHttpClient(ctx); err != nil {
+		return InboundBundle{}, err
+	}
+
+	inbound := InboundBundle{Kind: outbound.Kind, ID: outbound.ID, PartyID: outbound.PartyID, Responses: []BundledResponse{}}
+	for _, r := range outbound.Requests {
+		resp, err := postPresigned(ctx, host, r.Path, []byte(r.Body), r.Signature)
+		if err != nil {
+			return InboundBundle{}, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return InboundBundle{}, err
+		}
+		inbound.Responses = append(inbound.Responses, BundledResponse{
+			Path:     r.Path,
+			Body:     r.Body,
+			Status:   resp.StatusCode,
+			Response: string(body),
+		})
+		// Once we've joined, the state should be from our point of view
+		if r.Path == "/keygen/join" && resp.StatusCode == http.StatusOK && inbound.PartyID == 0 {
+			var joined JoinKeyGenResponse
+			if json.Unmarshal(body, &joined) == nil {
+				inbound.PartyID = joined.MyPartyID
+			}
+		}
+	}
+
+	var partyID *uint16
+	if inbound.PartyID != 0 {
+		partyID = &inbound.PartyID
+	}
+	var state any
+	switch outbound.Kind {
+	case JournalKeygen:
+		state, err = DuctPollKeyGenCeremony(ctx, host, PollKeyGenRequest{GroupID: outbound.ID, PartyID: partyID})
+		if err != nil {
+			return InboundBundle{}, err
+		}
+		messages, err := DuctKeygenGetMessages(ctx, host, outbound.ID, inbound.PartyID, 0)
+		if err != nil {
+			return InboundBundle{}, err
+		}
+		inbound.Messages, inbound.LastSeen = messages.Messages, messages.LatestMessageID
+	case JournalSign:
+		state, err = DuctPollSignCeremony(ctx, host, PollSignRequest{CeremonyID: outbound.ID, PartyID: partyID})
+		if err != nil {
+			return InboundBundle{}, err
+		}
+		messages, err := DuctSignGetMessages(ctx, host, outbound.ID, inbound.PartyID, 0)
+		if err != nil {
+			return InboundBundle{}, err
+		}
+		inbound.Messages, inbound.LastSeen = messages.Messages, messages.LatestMessageID
+	default:
+		return InboundBundle{}, fmt.Errorf("unknown ceremony kind: %q", outbound.Kind)
+	}
+	if inbound.State, err = json.Marshal(state); err != nil {
+		return InboundBundle{}, err
+	}
+	if inbound.Messages == nil {
+		inbound.Messages = []string{}
+	}
+	return inbound, nil
+}
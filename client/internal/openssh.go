@@ -2,15 +2,62 @@ package internal
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
 )
 
+// See PROTOCOL.sshsig in the OpenSSH source tree for the format
+const sshsigMagic = "SSHSIG"
+const sshsigHashAlgorithm = "sha512"
+const sshsigBegin = "-----BEGIN SSH SIGNATURE-----"
+const sshsigEnd = "-----END SSH SIGNATURE-----"
+
 func putString(buf *bytes.Buffer, s []byte) {
 	binary.Write(buf, binary.BigEndian, uint32(len(s)))
 	buf.Write(s)
 }
 
+// Read a length-prefixed string, returning it and whatever comes after
+func readString(buf []byte) ([]byte, []byte, error) {
+	if len(buf) < 4 {
+		return nil, nil, errors.New("truncated SSH string")
+	}
+	n := binary.BigEndian.Uint32(buf)
+	if uint64(len(buf)-4) < uint64(n) {
+		return nil, nil, errors.New("truncated SSH string")
+	}
+	return buf[4 : 4+n], buf[4+n:], nil
+}
+
+// The data that actually gets signed for an OpenSSH signature.
+// It commits to the namespace, so a signature for one purpose (e.g. "git") can't be replayed for another.
+func SSHSIGSignedData(namespace string, message []byte) []byte {
+	h := sha512.Sum512(message)
+	var buf bytes.Buffer
+	buf.WriteString(sshsigMagic)
+	putString(&buf, []byte(namespace))
+	// reserved (empty string)
+	putString(&buf, []byte{})
+	putString(&buf, []byte(sshsigHashAlgorithm))
+	putString(&buf, h[:])
+	return buf.Bytes()
+}
+
+// The wire encoding of an Ed25519 public key
+func sshPublicKeyBlob(pubKey []byte) []byte {
+	var pkBlob bytes.Buffer
+	putString(&pkBlob, []byte("ssh-ed25519"))
+	putString(&pkBlob, pubKey)
+	return pkBlob.Bytes()
+}
+
+// Armor an Ed25519 signature over SSHSIGSignedData(namespace, message), so ssh-keygen -Y verify accepts it
 func OpenSSHEncode(pubKey []byte, rawSig []byte, namespace string) string {
 	if len(pubKey) != 32 {
 		panic("Ed25519 public key must be 32 bytes")
@@ -21,14 +68,11 @@ func OpenSSHEncode(pubKey []byte, rawSig []byte, namespace string) string {
 
 	var buf bytes.Buffer
 	// "SSHSIG" v1
-	putString(&buf, []byte("SSHSIG"))
+	buf.WriteString(sshsigMagic)
 	binary.Write(&buf, binary.BigEndian, uint32(1))
 
 	// public key blob
-	var pkBlob bytes.Buffer
-	putString(&pkBlob, []byte("ssh-ed25519"))
-	putString(&pkBlob, pubKey)
-	putString(&buf, pkBlob.Bytes())
+	putString(&buf, sshPublicKeyBlob(pubKey))
 
 	// namespace
 	putString(&buf, []byte(namespace))
@@ -36,8 +80,8 @@ func OpenSSHEncode(pubKey []byte, rawSig []byte, namespace string) string {
 	// reserved (empty string)
 	putString(&buf, []byte{})
 
-	// signature algorithm
-	putString(&buf, []byte("ssh-ed25519"))
+	// hash algorithm
+	putString(&buf, []byte(sshsigHashAlgorithm))
 
 	// signature blob
 	var sigBlob bytes.Buffer
@@ -58,7 +102,131 @@ func OpenSSHEncode(pubKey []byte, rawSig []byte, namespace string) string {
 		wrapped.WriteString(b64[i:end] + "\n")
 	}
 
-	return "-----BEGIN SSH SIGNATURE-----\n" +
+	return sshsigBegin + "\n" +
 		wrapped.String() +
-		"-----END SSH SIGNATURE-----\n"
+		sshsigEnd + "\n"
+}
+
+// A parsed OpenSSH signature. Only Ed25519 keys are supported.
+type SSHSignature struct {
+	PublicKey     []byte
+	Namespace     string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// Parse an armored OpenSSH signature
+func OpenSSHDecode(armored []byte) (SSHSignature, error) {
+	text := strings.TrimSpace(string(armored))
+	if !strings.HasPrefix(text, sshsigBegin) || !strings.HasSuffix(text, sshsigEnd) {
+		return SSHSignature{}, errors.New("not an SSH signature")
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, sshsigBegin), sshsigEnd)
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return SSHSignature{}, fmt.Errorf("invalid SSH signature encoding: %w", err)
+	}
+
+	if len(raw) < 10 || string(raw[:6]) != sshsigMagic {
+		return SSHSignature{}, errors.New("not an SSH signature")
+	}
+	if binary.BigEndian.Uint32(raw[6:10]) != 1 {
+		return SSHSignature{}, errors.New("unsupported SSH signature version")
+	}
+	fields := make([][]byte, 5)
+	rest := raw[10:]
+	for i := range fields {
+		fields[i], rest, err = readString(rest)
+		if err != nil {
+			return SSHSignature{}, err
+		}
+	}
+	if len(rest) != 0 {
+		return SSHSignature{}, errors.New("trailing data after SSH signature")
+	}
+	pubKey, err := parseSSHKeyBlob(fields[0])
+	if err != nil {
+		return SSHSignature{}, err
+	}
+	sigType, rawSig, err := readString(fields[4])
+	if err != nil {
+		return SSHSignature{}, err
+	}
+	rawSig, trailing, err := readString(rawSig)
+	if err != nil {
+		return SSHSignature{}, err
+	}
+	if string(sigType) != "ssh-ed25519" || len(rawSig) != ed25519.SignatureSize || len(trailing) != 0 {
+		return SSHSignature{}, errors.New("only Ed25519 signatures are supported")
+	}
+	return SSHSignature{
+		PublicKey:     pubKey,
+		Namespace:     string(fields[1]),
+		HashAlgorithm: string(fields[3]),
+		Signature:     rawSig,
+	}, nil
+}
+
+// Check the signature over a message. This says nothing about whether the key should be trusted.
+func (s SSHSignature) Verify(message []byte) error {
+	var h []byte
+	switch s.HashAlgorithm {
+	case "sha512":
+		sum := sha512.Sum512(message)
+		h = sum[:]
+	case "sha256":
+		sum := sha256.Sum256(message)
+		h = sum[:]
+	default:
+		return fmt.Errorf("unsupported hash algorithm: %s", s.HashAlgorithm)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(sshsigMagic)
+	putString(&buf, []byte(s.Namespace))
+	putString(&buf, []byte{})
+	putString(&buf, []byte(s.HashAlgorithm))
+	putString(&buf, h)
+	if !ed25519.Verify(s.PublicKey, buf.Bytes(), s.Signature) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+func parseSSHKeyBlob(blob []byte) ([]byte, error) {
+	keyType, rest, err := readString(blob)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, rest, err := readString(rest)
+	if err != nil {
+		return nil, err
+	}
+	if string(keyType) != "ssh-ed25519" || len(pubKey) != ed25519.PublicKeySize || len(rest) != 0 {
+		return nil, errors.New("only Ed25519 keys are supported")
+	}
+	return pubKey, nil
+}
+
+// An Ed25519 public key in the format used by authorized_keys and allowed_signers
+func OpenSSHPublicKey(pubKey []byte) string {
+	return "ssh-ed25519 " + base64.StdEncoding.EncodeToString(sshPublicKeyBlob(pubKey))
+}
+
+// Parse an Ed25519 public key from the format used by authorized_keys, ignoring any comment
+func ParseOpenSSHPublicKey(line string) ([]byte, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "ssh-ed25519" {
+		return nil, errors.New("only Ed25519 keys are supported")
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH public key encoding: %w", err)
+	}
+	return parseSSHKeyBlob(blob)
+}
+
+// The fingerprint ssh-keygen prints for a key
+func SSHFingerprint(pubKey []byte) string {
+	h := sha256.Sum256(sshPublicKeyBlob(pubKey))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(h[:])
 }
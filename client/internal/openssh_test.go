@@ -1,6 +1,7 @@
 package internal_test
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/sha512"
@@ -37,10 +38,10 @@ func TestOpenSSHEncode(t *testing.T) {
 	encoded2 := internal.OpenSSHEncode(pk2, sig2, namespace)
 	assert.NotEmpty(t, encoded2)
 	const expected = `-----BEGIN SSH SIGNATURE-----
-AAAABlNTSFNJRwAAAAEAAAAzAAAAC3NzaC1lZDI1NTE5AAAAIEWbPXw3NFqPht+qbUzQeU
-ot2rnHXclITN0UivggnYz5AAAABHRlc3QAAAAAAAAAC3NzaC1lZDI1NTE5AAAAUwAAAAtz
-c2gtZWQyNTUxOQAAAEAn5PrscAKy4X4bzwdTN19iOi+Tb3UJYRJU9z/U6Jb+qtX3kF5ZYH
-6eVkXFIipre97XzH+lojn92vOx7elXLe/Y
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgRZs9fDc0Wo+G36ptTNB5Si3auc
+ddyUhM3RSK+CCdjPkAAAAEdGVzdAAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEAn5PrscAKy4X4bzwdTN19iOi+Tb3UJYRJU9z/U6Jb+qtX3kF5ZYH6eVkXFIipre9
+7XzH+lojn92vOx7elXLe/Y
 -----END SSH SIGNATURE-----
 `
     left := strings.ReplaceAll(expected, "\r", "")
@@ -49,3 +50,39 @@ c2gtZWQyNTUxOQAAAEAn5PrscAKy4X4bzwdTN19iOi+Tb3UJYRJU9z/U6Jb+qtX3kF5ZYH
     right = strings.ReplaceAll(right, "\\n", "\n")
 	assert.Equal(t, left, right)
 }
+
+func TestOpenSSHRoundTrip(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	message := []byte("object 1234\ntype commit\ntag v1.0.0\n")
+	sig := ed25519.Sign(sk, internal.SSHSIGSignedData("git", message))
+
+	decoded, err := internal.OpenSSHDecode([]byte(internal.OpenSSHEncode(pk, sig, "git")))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(pk), decoded.PublicKey)
+	assert.Equal(t, "git", decoded.Namespace)
+	assert.Equal(t, "sha512", decoded.HashAlgorithm)
+	assert.NoError(t, decoded.Verify(message))
+	assert.Error(t, decoded.Verify([]byte("something else")))
+
+	// The namespace is part of what was signed
+	decoded.Namespace = "file"
+	assert.Error(t, decoded.Verify(message))
+
+	_, err = internal.OpenSSHDecode([]byte("-----BEGIN SSH SIGNATURE-----\nAAAA\n-----END SSH SIGNATURE-----\n"))
+	assert.Error(t, err)
+}
+
+func TestOpenSSHPublicKey(t *testing.T) {
+	pk, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	line := internal.OpenSSHPublicKey(pk)
+	assert.True(t, strings.HasPrefix(line, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5"))
+
+	parsed, err := internal.ParseOpenSSHPublicKey(line + " grp_abc123\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(pk), parsed)
+	_, err = internal.ParseOpenSSHPublicKey("ssh-rsa AAAAB3NzaC1yc2E")
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(internal.SSHFingerprint(pk), "SHA256:"))
+}
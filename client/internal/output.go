@@ -0,0 +1,345 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Every command prints its result for people to read, or, with --output json, as a single JSON document on stdout
+// for scripts. Failures go to stderr either way: in JSON, as an object with a code that scripts can match on.
+
+// Exit statuses. Every command uses these, so scripts don't need to know which command they ran.
+const (
+	// It worked. Offline, that includes stopping to wait for the relay.
+	ExitOK = 0
+	// It didn't work: the coordinator said no, the ceremony failed, the signature is bad...
+	ExitFailure = 1
+	// It couldn't be tried, because the command line doesn't make sense. It's also what freeon verify exits with when
+	// a signature can't be checked at all.
+	ExitUsage = 2
+	// Our signing policy, or the person at the keyboard, wouldn't sign
+	ExitRefused = 3
+)
+
+// Error codes, for the "code" of a JSON error
+const (
+	ErrorCodeUsage         = "usage"
+	ErrorCodeNetwork       = "network"
+	ErrorCodeUnauthorized  = "unauthorized"
+	ErrorCodeNotFound      = "not-found"
+	ErrorCodeCoordinator   = "coordinator"
+	ErrorCodePolicyRefused = "policy-refused"
+	ErrorCodeNotApproved   = "not-approved"
+	ErrorCodeCeremonyEnded = "ceremony-ended"
+	ErrorCodeBadSignature  = "bad-signature"
+	ErrorCodeTimeout       = "timeout"
+	ErrorCodeInterrupted   = "interrupted"
+	ErrorCodeUnknown       = "error"
+)
+
+const (
+	OutputFormatText = "text"
+	OutputFormatJSON = "json"
+)
+
+var outputJSON = false
+
+// Choose how results and errors are printed: "text" or "json"
+func SetOutputFormat(format string) error {
+	switch format {
+	case OutputFormatText:
+		outputJSON = false
+	case OutputFormatJSON:
+		outputJSON = true
+	default:
+		return UsageError(fmt.Errorf("unknown output format %q (use text or json)", format))
+	}
+	return nil
+}
+
+// The output format FREEON_OUTPUT asks for, if any
+func OutputFormatFromEnvironment() string {
+	return os.Getenv("FREEON_OUTPUT")
+}
+
+func OutputJSON() bool {
+	return outputJSON
+}
+
+// An error that says how it should be reported. An empty Code, or an Exit of zero, is filled in from Err.
+type CommandError struct {
+	Code string
+	Exit int
+	Err  error
+}
+
+func (e CommandError) Error() string {
+	return e.Err.Error()
+}
+
+func (e CommandError) Unwrap() error {
+	return e.Err
+}
+
+// The command line doesn't make sense
+func UsageError(err error) error {
+	return CommandError{Code: ErrorCodeUsage, Exit: ExitUsage, Err: err}
+}
+
+// A ceremony that can be picked back up with freeon resume, if it got far enough to have a journal
+type resumableError struct {
+	id  string
+	err error
+}
+
+func (e resumableError) Error() string {
+	return e.err.Error()
+}
+
+func (e resumableError) Unwrap() error {
+	return e.err
+}
+
+func resumable(id string, err error) error {
+	return resumableError{id, err}
+}
+
+// A ceremony that was aborted, and who was blamed for it
+type CeremonyAbortedError struct {
+	CeremonyID string
+	Blame      []FreeonBlame
+}
+
+func (e CeremonyAbortedError) Error() string {
+	return fmt.Sprintf("ceremony %s was aborted", e.CeremonyID)
+}
+
+// Someone hit Ctrl-C, or the process was told to terminate
+type interruptedError struct {
+	signal os.Signal
+}
+
+func (e interruptedError) Error() string {
+	return fmt.Sprintf("interrupted (%s)", e.signal)
+}
+
+func (e interruptedError) Unwrap() error {
+	return context.Canceled
+}
+
+// What --output json prints to stderr when a command fails
+type ErrorDocument struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// The coordinator's HTTP status, when it's the one that said no
+	Status int `json:"status,omitempty"`
+	// The signing policy rule that refused
+	Rule string `json:"rule,omitempty"`
+	// Who was blamed for an aborted ceremony
+	Blame []FreeonBlame `json:"blame,omitempty"`
+	// The command that picks the ceremony back up, if it can be
+	Resume string `json:"resume,omitempty"`
+}
+
+// Work out the code and exit status an error is reported with
+func ClassifyError(err error) (string, int) {
+	code, exit := classifyError(err)
+	var cmdErr CommandError
+	if errors.As(err, &cmdErr) {
+		if cmdErr.Code != "" {
+			code = cmdErr.Code
+		}
+		if cmdErr.Exit != 0 {
+			exit = cmdErr.Exit
+		}
+	}
+	return code, exit
+}
+
+func classifyError(err error) (string, int) {
+	var violation PolicyViolation
+	var coordErr CoordinatorError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &violation):
+		return ErrorCodePolicyRefused, ExitRefused
+	case errors.Is(err, errNotApproved):
+		return ErrorCodeNotApproved, ExitRefused
+	case errors.Is(err, ErrBadSignature):
+		return ErrorCodeBadSignature, ExitFailure
+	case errors.As(err, &CeremonyAbortedError{}), errors.As(err, &ceremonyEndedError{}):
+		return ErrorCodeCeremonyEnded, ExitFailure
+	case errors.As(err, &interruptedError{}):
+		return ErrorCodeInterrupted, ExitFailure
+	case errors.As(err, &ceremonyTimedOutError{}):
+		return ErrorCodeTimeout, ExitFailure
+	case errors.As(err, &coordErr):
+		switch coordErr.Status {
+		case http.StatusForbidden:
+			return ErrorCodeUnauthorized, ExitFailure
+		case http.StatusNotFound:
+			return ErrorCodeNotFound, ExitFailure
+		}
+		return ErrorCodeCoordinator, ExitFailure
+	case errors.As(err, &netErr):
+		return ErrorCodeNetwork, ExitFailure
+	}
+	return ErrorCodeUnknown, ExitFailure
+}
+
+// Everything --output json says about an error
+func DescribeError(err error) ErrorDocument {
+	code, _ := ClassifyError(err)
+	detail := ErrorDetail{Code: code, Message: err.Error()}
+	var coordErr CoordinatorError
+	if errors.As(err, &coordErr) {
+		detail.Status = coordErr.Status
+	}
+	var violation PolicyViolation
+	if errors.As(err, &violation) {
+		detail.Rule = violation.Rule
+	}
+	var aborted CeremonyAbortedError
+	if errors.As(err, &aborted) {
+		detail.Blame = aborted.Blame
+	}
+	var resume resumableError
+	if errors.As(err, &resume) {
+		if j, loadErr := LoadJournal(resume.id); loadErr == nil && j.Round != "" {
+			detail.Resume = fmt.Sprintf("freeon resume -i [identity-file] %s", resume.id)
+		}
+	}
+	return ErrorDocument{Error: detail}
+}
+
+// Report an error the way the output format calls for, and exit with the status for its kind of failure
+func Fail(err error) {
+	_, exit := ClassifyError(err)
+	if outputJSON {
+		json.NewEncoder(os.Stderr).Encode(DescribeError(err))
+		os.Exit(exit)
+	}
+	var cmdErr CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == ErrorCodeUsage {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+	} else {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+	}
+	var aborted CeremonyAbortedError
+	if errors.As(err, &aborted) {
+		printBlame(os.Stderr, aborted.Blame)
+	}
+	var resume resumableError
+	if errors.As(err, &resume) {
+		PrintResumeHint(resume.id)
+	}
+	os.Exit(exit)
+}
+
+// Print a command's result, and exit. People get text; --output json gets doc.
+func Succeed(text string, doc any) {
+	printResult(text, doc)
+	os.Exit(ExitOK)
+}
+
+func printResult(text string, doc any) {
+	if !outputJSON {
+		fmt.Print(text)
+		return
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(doc); err != nil {
+		Fail(err)
+	}
+}
+
+// What keygen commands, keygen list, and archive print about a group
+type GroupResult struct {
+	GroupID string `json:"group-id"`
+	// created, complete, refreshed, reshared, left, aborted, or archived
+	Status string `json:"status,omitempty"`
+	// Hex-encoded Ed25519
+	PublicKey        string  `json:"public-key,omitempty"`
+	OpenSSHPublicKey string  `json:"openssh-public-key,omitempty"`
+	Host             string  `json:"host,omitempty"`
+	PartyID          uint16  `json:"party-id,omitempty"`
+	Threshold        uint16  `json:"threshold,omitempty"`
+	Participants     uint16  `json:"participants,omitempty"`
+	Epoch            *uint64 `json:"epoch,omitempty"`
+}
+
+type GroupList struct {
+	Groups []GroupResult `json:"groups"`
+}
+
+// What sign commands, sign list, resume, and terminate print about a ceremony
+type CeremonyResult struct {
+	CeremonyID string `json:"ceremony-id"`
+	GroupID    string `json:"group-id,omitempty"`
+	// created, complete, not-a-signer, or terminated; or, from sign list, the coordinator's status
+	Status string `json:"status,omitempty"`
+	// raw, sshsig, or ssh-cert
+	Format    string `json:"format,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// The hash the coordinator keeps of the message
+	Hash string `json:"hash,omitempty"`
+	// Hex for raw signatures, armored for sshsig, and a certificate line for ssh-cert
+	Signature string `json:"signature,omitempty"`
+	// Nobody but the signer who reported it checked the signature, because the coordinator never saw the message
+	Unverified bool          `json:"unverified,omitempty"`
+	Blame      []FreeonBlame `json:"blame,omitempty"`
+}
+
+type CeremonyList struct {
+	Ceremonies []CeremonyResult `json:"ceremonies"`
+}
+
+// What an offline command prints when it stops to wait for the relay
+type OfflineResult struct {
+	Status   string `json:"status"`
+	Outbound string `json:"outbound"`
+	Inbound  string `json:"inbound"`
+}
+
+// What freeon relay prints
+type RelayResult struct {
+	// How many requests from the outbound bundle were delivered
+	Delivered int `json:"delivered"`
+	// How many messages the inbound bundle carries
+	Messages int    `json:"messages"`
+	Inbound  string `json:"inbound"`
+}
+
+// What freeon identity prints
+type IdentityResult struct {
+	IdentityKey string `json:"identity-key"`
+	CSR         string `json:"csr,omitempty"`
+}
+
+// What freeon agent prints, before it starts serving
+type AgentResult struct {
+	Socket string `json:"socket"`
+}
+
+// The signature format a ceremony makes
+func ceremonyFormat(openssh bool, sshCertificate bool) string {
+	switch {
+	case sshCertificate:
+		return SignatureFormatSSHCert
+	case openssh:
+		return SignatureFormatSSHSIG
+	}
+	return SignatureFormatRaw
+}
+
+func epochOf(epoch uint64) *uint64 {
+	return &epoch
+}
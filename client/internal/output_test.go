@@ -0,0 +1,65 @@
+package internal_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err  error
+		code string
+		exit int
+	}{
+		{errors.New("something broke"), internal.ErrorCodeUnknown, internal.ExitFailure},
+		{internal.UsageError(errors.New("-h/--host is required")), internal.ErrorCodeUsage, internal.ExitUsage},
+		{internal.CoordinatorError{Status: 403, Message: "unauthorized"}, internal.ErrorCodeUnauthorized, internal.ExitFailure},
+		{fmt.Errorf("failed to join ceremony: %w", internal.CoordinatorError{Status: 404}), internal.ErrorCodeNotFound, internal.ExitFailure},
+		{internal.CoordinatorError{Status: 500, Message: "ceremony is closed"}, internal.ErrorCodeCoordinator, internal.ExitFailure},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, internal.ErrorCodeNetwork, internal.ExitFailure},
+		{internal.PolicyViolation{Rule: "namespaces", Reason: "nope"}, internal.ErrorCodePolicyRefused, internal.ExitRefused},
+		{fmt.Errorf("%w: wrong namespace", internal.ErrBadSignature), internal.ErrorCodeBadSignature, internal.ExitFailure},
+		// The exit status can be overridden without losing the code
+		{internal.CommandError{Exit: internal.VerifyError, Err: errors.New("no such file")}, internal.ErrorCodeUnknown, internal.VerifyError},
+	}
+	for _, c := range cases {
+		code, exit := internal.ClassifyError(c.err)
+		assert.Equal(t, c.code, code, c.err.Error())
+		assert.Equal(t, c.exit, exit, c.err.Error())
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	doc := internal.DescribeError(fmt.Errorf("refused: %w", internal.PolicyViolation{Rule: "cosigners", Reason: "too few"}))
+	encoded, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"error": {
+		"code": "policy-refused",
+		"message": "refused: refused by signing policy (cosigners): too few",
+		"rule": "cosigners"
+	}}`, string(encoded))
+
+	doc = internal.DescribeError(internal.CoordinatorError{Status: 403, Message: "not an administrator"})
+	assert.Equal(t, 403, doc.Error.Status)
+	assert.Equal(t, "request failed: not an administrator", doc.Error.Message)
+	assert.Equal(t, "request failed with status code: 502", internal.CoordinatorError{Status: 502}.Error())
+}
+
+func TestSetOutputFormat(t *testing.T) {
+	defer internal.SetOutputFormat(internal.OutputFormatText)
+	assert.NoError(t, internal.SetOutputFormat("json"))
+	assert.True(t, internal.OutputJSON())
+	assert.NoError(t, internal.SetOutputFormat("text"))
+	assert.False(t, internal.OutputJSON())
+
+	err := internal.SetOutputFormat("yaml")
+	code, exit := internal.ClassifyError(err)
+	assert.Equal(t, internal.ErrorCodeUsage, code)
+	assert.Equal(t, internal.ExitUsage, exit)
+}
@@ -1,26 +1,45 @@
 package internal
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
-func getConfigFile() (string, error) {
+// Ceremonies can run side by side in one process, so changes to the config are made one at a time
+var configMu sync.Mutex
+
+func getHomeDir() (string, error) {
 	homeDir := os.Getenv("FREEON_HOME")
-	var err error
-	if homeDir == "" {
-		homeDir, err = os.UserHomeDir()
-		if err != nil {
-			return "", err
-		}
+	if homeDir != "" {
+		return homeDir, nil
 	}
+	return os.UserHomeDir()
+}
+
+func getConfigFile() (string, error) {
+	homeDir, err := getHomeDir()
 	if err != nil {
 		return "", err
 	}
 	return filepath.Join(homeDir, ".freeon.json"), nil
 }
 
+// Our identity key lives on its own, so it isn't rewritten with every change to the config
+func getIdentityFile() (string, error) {
+	homeDir, err := getHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".freeon-identity"), nil
+}
+
 // Default user config
 func NewUserConfig() (FreeonConfig, error) {
 	config := FreeonConfig{
@@ -62,19 +81,28 @@ func (cfg FreeonConfig) Save() error {
 	if err != nil {
 		return err
 	}
-
-	file, err := os.Create(configPath)
+	data, err := json.MarshalIndent(cfg, "", "    ") // pretty-print
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	// Shares and TLS settings are nobody else's business either
+	return writeFileAtomic(configPath, append(data, '\n'), 0600)
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "    ") // pretty-print
-	return encoder.Encode(cfg)
+// Change the shares in the config as it is on disk now, rather than as cfg has it. A ceremony can take a while, and
+// saving a config it loaded at the start would lose any shares another one stored in the meantime.
+func updateShares(change func([]Shares) []Shares) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	cfg, err := LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	cfg.Shares = change(cfg.Shares)
+	return cfg.Save()
 }
 
-func (cfg FreeonConfig) AddShare(host, groupID, publicKey, share string, otherShares map[string]string, myPartyID uint16) error {
+func (cfg FreeonConfig) AddShare(host, groupID, publicKey, share string, otherShares map[string]string, myPartyID uint16, identityKeys map[uint16]string) error {
 	s := Shares{
 		Host:           host,
 		GroupID:        groupID,
@@ -82,7 +110,122 @@ func (cfg FreeonConfig) AddShare(host, groupID, publicKey, share string, otherSh
 		EncryptedShare: share,
 		PublicShares:   otherShares,
 		MyPartyID:      myPartyID,
+		IdentityKeys:   identityKeys,
 	}
-	cfg.Shares = append(cfg.Shares, s)
-	return cfg.Save()
+	return cfg.AddPendingShare(s)
+}
+
+// Find our share for a group at a given epoch
+func (cfg FreeonConfig) FindShare(groupID string, epoch uint64) (Shares, bool) {
+	for _, s := range cfg.Shares {
+		if s.GroupID == groupID && s.Epoch == epoch {
+			return s, true
+		}
+	}
+	return Shares{}, false
+}
+
+// Store the share we got from a refresh, next to the one it replaces.
+// The old one is kept until the coordinator says the refresh is complete.
+func (cfg FreeonConfig) AddRefreshedShare(old Shares, share string, publicShares map[string]string, epoch uint64) error {
+	s := old
+	s.EncryptedShare = share
+	s.PublicShares = publicShares
+	s.Epoch = epoch
+	return cfg.AddPendingShare(s)
+}
+
+// Store a share for an epoch the group hasn't reached yet.
+// It's only any use once the coordinator moves the group to that epoch; see DropShares.
+func (cfg FreeonConfig) AddPendingShare(s Shares) error {
+	return updateShares(func(shares []Shares) []Shares {
+		return append(shares, s)
+	})
+}
+
+// Forget every share for a group except the one from the given epoch
+func (cfg FreeonConfig) DropShares(groupID string, keep uint64) error {
+	return updateShares(func(shares []Shares) []Shares {
+		var kept []Shares
+		for _, s := range shares {
+			if s.GroupID != groupID || s.Epoch == keep {
+				kept = append(kept, s)
+			}
+		}
+		return kept
+	})
+}
+
+// Forget every share for a group, such as one whose key generation was disputed
+func (cfg FreeonConfig) ForgetGroup(groupID string) error {
+	return updateShares(func(shares []Shares) []Shares {
+		var kept []Shares
+		for _, s := range shares {
+			if s.GroupID != groupID {
+				kept = append(kept, s)
+			}
+		}
+		return kept
+	})
+}
+
+// Load the long-term key used to authenticate to coordinators.
+// A new key is generated and saved the first time this is called.
+func LoadIdentityKey() (ed25519.PrivateKey, error) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	identityPath, err := getIdentityFile()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := os.ReadFile(identityPath)
+	if os.IsNotExist(err) {
+		encoded, err = newIdentityKey(identityPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", identityPath, err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s: identity key is the wrong size", identityPath)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Save a new identity key, or move the one older versions kept in the config to its own file
+func newIdentityKey(identityPath string) ([]byte, error) {
+	cfg, err := LoadUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	encoded := cfg.IdentityKey
+	if encoded == "" {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		}
+		encoded = hex.EncodeToString(seed)
+	}
+	if err := writeFileAtomic(identityPath, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	if cfg.IdentityKey != "" {
+		cfg.IdentityKey = ""
+		if err := cfg.Save(); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(encoded), nil
+}
+
+// Write the new file next to the old one, so a crash never leaves us with half of each
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
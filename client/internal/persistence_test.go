@@ -1,11 +1,17 @@
 package internal_test
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/soatok/freeon/client/internal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPersistence(t *testing.T) {
@@ -28,7 +34,7 @@ func TestPersistence(t *testing.T) {
 	assert.Equal(t, cfg, loadedCfg)
 
 	// Test AddShare
-	err = loadedCfg.AddShare("localhost", "group1", "pk1", "share1", nil, 1)
+	err = loadedCfg.AddShare("localhost", "group1", "pk1", "share1", nil, 1, map[uint16]string{1: "aa", 2: "bb"})
 	assert.NoError(t, err)
 
 	// Load the config again to check if the share was added
@@ -39,4 +45,70 @@ func TestPersistence(t *testing.T) {
 	assert.Equal(t, "group1", reloadedCfg.Shares[0].GroupID)
 	assert.Equal(t, "pk1", reloadedCfg.Shares[0].PublicKey)
 	assert.Equal(t, "share1", reloadedCfg.Shares[0].EncryptedShare)
+	assert.Equal(t, map[uint16]string{1: "aa", 2: "bb"}, reloadedCfg.Shares[0].IdentityKeys)
+}
+
+func TestLoadIdentityKey(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+
+	// The first call generates a key; subsequent calls must return the same one
+	key1, err := internal.LoadIdentityKey()
+	assert.NoError(t, err)
+	assert.Len(t, key1, 64)
+
+	key2, err := internal.LoadIdentityKey()
+	assert.NoError(t, err)
+	assert.Equal(t, key1, key2)
+
+	// It's kept out of the config, where only we can read it
+	cfg, err := internal.LoadUserConfig()
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.IdentityKey)
+	info, err := os.Stat(filepath.Join(os.Getenv("FREEON_HOME"), ".freeon-identity"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestLoadIdentityKeyFromConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("FREEON_HOME", home)
+
+	// Older versions kept the seed in the config
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	config := fmt.Sprintf(`{"identity-key": %q, "shares": []}`, hex.EncodeToString(seed))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".freeon.json"), []byte(config), 0600))
+
+	key, err := internal.LoadIdentityKey()
+	require.NoError(t, err)
+	assert.Equal(t, ed25519.NewKeyFromSeed(seed), key)
+
+	// It's moved to its own file, and stays the same from then on
+	cfg, err := internal.LoadUserConfig()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.IdentityKey)
+	key, err = internal.LoadIdentityKey()
+	require.NoError(t, err)
+	assert.Equal(t, ed25519.NewKeyFromSeed(seed), key)
+}
+
+func TestAddShareKeepsConcurrentChanges(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+
+	// Two ceremonies load the config before either one finishes
+	first, err := internal.LoadUserConfig()
+	assert.NoError(t, err)
+	second, err := internal.LoadUserConfig()
+	assert.NoError(t, err)
+
+	assert.NoError(t, first.AddShare("localhost", "group1", "pk1", "share1", nil, 1, nil))
+	assert.NoError(t, second.AddShare("localhost", "group2", "pk2", "share2", nil, 2, nil))
+
+	// Neither one's share is lost
+	cfg, err := internal.LoadUserConfig()
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Shares, 2)
+	_, ok := cfg.FindShare("group1", 0)
+	assert.True(t, ok)
+	_, ok = cfg.FindShare("group2", 0)
+	assert.True(t, ok)
 }
@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Share holders can set rules, per group, for what their client is willing to sign. The rules are checked before we
+// join a ceremony, and again once we know who the signers are, right before the share is decrypted. Every decision is
+// appended to ~/.freeon-policy.log.
+
+// What a share holder will sign with a group's key. Every rule that's set has to pass.
+type SigningPolicy struct {
+	// Only make SSHSIG signatures, in one of these namespaces
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Only sign messages whose SHA-256 is listed in this file, in the format sha256sum writes
+	Manifest string `json:"manifest,omitempty"`
+	// Only sign alongside these parties...
+	Cosigners []uint16 `json:"cosigners,omitempty"`
+	// ...or at least this many of them. Zero means all of them.
+	MinCosigners int `json:"min-cosigners,omitempty"`
+	// Never sign during these times of day, like "22:00-06:00"
+	ForbiddenHours []string `json:"forbidden-hours,omitempty"`
+	// The time zone ForbiddenHours are in, like "Europe/Berlin" (default: the system's)
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Everything a policy gets to look at
+type PolicyRequest struct {
+	CeremonyID string
+	GroupID    string
+	MyPartyID  uint16
+	// The message itself, before it's wrapped for an SSHSIG signature
+	Message        []byte
+	OpenSSH        bool
+	Namespace      string
+	SSHCertificate bool
+	// Nil until the coordinator has settled on who signs
+	Signers []uint16
+	When    time.Time
+}
+
+// A ceremony our policy won't let us sign
+type PolicyViolation struct {
+	Rule   string
+	Reason string
+}
+
+func (v PolicyViolation) Error() string {
+	return fmt.Sprintf("refused by signing policy (%s): %s", v.Rule, v.Reason)
+}
+
+// Find the policy for a group, if there is one
+func (cfg FreeonConfig) PolicyFor(groupID string) (SigningPolicy, bool) {
+	policy, ok := cfg.Policies[groupID]
+	return policy, ok
+}
+
+// See whether a policy lets us sign. Rules that are set wrong refuse everything, rather than nothing.
+func (p SigningPolicy) Check(req PolicyRequest) error {
+	if len(p.Namespaces) > 0 {
+		switch {
+		case req.SSHCertificate:
+			return PolicyViolation{"namespaces", "this ceremony issues an SSH certificate, not an SSHSIG signature"}
+		case !req.OpenSSH:
+			return PolicyViolation{"namespaces", "this ceremony makes a raw Ed25519 signature, not an SSHSIG signature"}
+		case !slices.Contains(p.Namespaces, req.Namespace):
+			return PolicyViolation{"namespaces", fmt.Sprintf("namespace %q is not one of %s", req.Namespace, strings.Join(p.Namespaces, ", "))}
+		}
+	}
+
+	if p.Manifest != "" {
+		listed, err := readManifest(p.Manifest)
+		if err != nil {
+			return PolicyViolation{"manifest", err.Error()}
+		}
+		digest := sha256.Sum256(req.Message)
+		if !listed[hex.EncodeToString(digest[:])] {
+			return PolicyViolation{"manifest", fmt.Sprintf("SHA-256 %x is not listed in %s", digest, p.Manifest)}
+		}
+	}
+
+	if len(p.Cosigners) > 0 && req.Signers != nil {
+		var cosigners []uint16
+		for _, party := range p.Cosigners {
+			if party != req.MyPartyID {
+				cosigners = append(cosigners, party)
+			}
+		}
+		need := p.MinCosigners
+		if need == 0 {
+			need = len(cosigners)
+		}
+		var have int
+		for _, party := range cosigners {
+			if slices.Contains(req.Signers, party) {
+				have++
+			}
+		}
+		if have < need {
+			return PolicyViolation{"cosigners", fmt.Sprintf("%d of parties %v are signing, but %d are required", have, cosigners, need)}
+		}
+	}
+
+	if len(p.ForbiddenHours) > 0 {
+		loc := time.Local
+		if p.Timezone != "" {
+			var err error
+			loc, err = time.LoadLocation(p.Timezone)
+			if err != nil {
+				return PolicyViolation{"forbidden-hours", err.Error()}
+			}
+		}
+		now := req.When.In(loc)
+		minute := now.Hour()*60 + now.Minute()
+		for _, hours := range p.ForbiddenHours {
+			from, until, err := parseHours(hours)
+			if err != nil {
+				return PolicyViolation{"forbidden-hours", err.Error()}
+			}
+			// Ranges that go past midnight wrap around
+			inside := minute >= from && minute < until
+			if from > until {
+				inside = minute >= from || minute < until
+			}
+			if inside {
+				return PolicyViolation{"forbidden-hours", fmt.Sprintf("it's %s, within %s", now.Format("15:04 MST"), hours)}
+			}
+		}
+	}
+	return nil
+}
+
+// Parse "HH:MM-HH:MM" into minutes since midnight
+func parseHours(hours string) (int, int, error) {
+	fromText, untilText, ok := strings.Cut(hours, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not a range like 22:00-06:00", hours)
+	}
+	from, err := time.Parse("15:04", strings.TrimSpace(fromText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q is not a range like 22:00-06:00", hours)
+	}
+	until, err := time.Parse("15:04", strings.TrimSpace(untilText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%q is not a range like 22:00-06:00", hours)
+	}
+	return from.Hour()*60 + from.Minute(), until.Hour()*60 + until.Minute(), nil
+}
+
+// Read the digests out of a sha256sum-style manifest. File names, if there are any, are ignored.
+func readManifest(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	listed := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		digest := strings.ToLower(fields[0])
+		if raw, err := hex.DecodeString(digest); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("%s has a line that doesn't start with a SHA-256 digest", path)
+		}
+		listed[digest] = true
+	}
+	return listed, scanner.Err()
+}
+
+// Check a ceremony against our policy for its group, if we have one. Refusals are always logged; approvals only when
+// final is set, since that's when we're about to sign.
+func enforcePolicy(ctx context.Context, cfg FreeonConfig, req PolicyRequest, final bool) error {
+	policy, ok := cfg.PolicyFor(req.GroupID)
+	if !ok {
+		return nil
+	}
+	err := policy.Check(req)
+	if err != nil || final {
+		if logErr := logPolicyDecision(req, err); logErr != nil {
+			sessionFrom(ctx).warnf("failed to log signing policy decision: %s", logErr)
+		}
+	}
+	return err
+}
+
+// One line of ~/.freeon-policy.log
+type policyDecision struct {
+	Time       string `json:"time"`
+	CeremonyID string `json:"ceremony-id"`
+	GroupID    string `json:"group-id"`
+	SHA256     string `json:"sha256"`
+	Decision   string `json:"decision"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+func logPolicyDecision(req PolicyRequest, refusal error) error {
+	homeDir, err := getHomeDir()
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(req.Message)
+	entry := policyDecision{
+		Time:       req.When.UTC().Format(time.RFC3339),
+		CeremonyID: req.CeremonyID,
+		GroupID:    req.GroupID,
+		SHA256:     hex.EncodeToString(digest[:]),
+		Decision:   "allowed",
+	}
+	if refusal != nil {
+		entry.Decision = "refused"
+		entry.Reason = refusal.Error()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(homeDir, ".freeon-policy.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
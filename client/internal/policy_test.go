@@ -0,0 +1,87 @@
+package internal_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func requireViolation(t *testing.T, err error, rule string) {
+	t.Helper()
+	var violation internal.PolicyViolation
+	if assert.ErrorAs(t, err, &violation) {
+		assert.Equal(t, rule, violation.Rule)
+	}
+}
+
+func TestPolicyNamespaces(t *testing.T) {
+	policy := internal.SigningPolicy{Namespaces: []string{"git"}}
+	assert.NoError(t, policy.Check(internal.PolicyRequest{OpenSSH: true, Namespace: "git"}))
+	requireViolation(t, policy.Check(internal.PolicyRequest{OpenSSH: true, Namespace: "file"}), "namespaces")
+	requireViolation(t, policy.Check(internal.PolicyRequest{}), "namespaces")
+	requireViolation(t, policy.Check(internal.PolicyRequest{SSHCertificate: true}), "namespaces")
+
+	// No rules, no refusals
+	assert.NoError(t, internal.SigningPolicy{}.Check(internal.PolicyRequest{}))
+}
+
+func TestPolicyManifest(t *testing.T) {
+	listed := []byte("release v1.2.3")
+	digest := sha256.Sum256(listed)
+	manifest := filepath.Join(t.TempDir(), "SHA256SUMS")
+	contents := "# Releases we've agreed to sign\n" + hex.EncodeToString(digest[:]) + "  release.txt\n"
+	assert.NoError(t, os.WriteFile(manifest, []byte(contents), 0644))
+
+	policy := internal.SigningPolicy{Manifest: manifest}
+	assert.NoError(t, policy.Check(internal.PolicyRequest{Message: listed}))
+	requireViolation(t, policy.Check(internal.PolicyRequest{Message: []byte("something else")}), "manifest")
+
+	// A manifest we can't read refuses everything
+	assert.NoError(t, os.WriteFile(manifest, []byte("not a digest\n"), 0644))
+	requireViolation(t, policy.Check(internal.PolicyRequest{Message: listed}), "manifest")
+	policy.Manifest = filepath.Join(t.TempDir(), "missing")
+	requireViolation(t, policy.Check(internal.PolicyRequest{Message: listed}), "manifest")
+}
+
+func TestPolicyCosigners(t *testing.T) {
+	policy := internal.SigningPolicy{Cosigners: []uint16{1, 2, 3}}
+	// Until the signers are settled, there's nothing to check
+	assert.NoError(t, policy.Check(internal.PolicyRequest{MyPartyID: 1}))
+	// We don't count as our own cosigner
+	assert.NoError(t, policy.Check(internal.PolicyRequest{MyPartyID: 1, Signers: []uint16{1, 2, 3}}))
+	requireViolation(t, policy.Check(internal.PolicyRequest{MyPartyID: 1, Signers: []uint16{1, 2, 4}}), "cosigners")
+
+	policy.MinCosigners = 1
+	assert.NoError(t, policy.Check(internal.PolicyRequest{MyPartyID: 1, Signers: []uint16{1, 2, 4}}))
+	requireViolation(t, policy.Check(internal.PolicyRequest{MyPartyID: 1, Signers: []uint16{1, 4, 5}}), "cosigners")
+}
+
+func TestPolicyForbiddenHours(t *testing.T) {
+	policy := internal.SigningPolicy{ForbiddenHours: []string{"22:00-06:00", "12:00-13:00"}, Timezone: "UTC"}
+	at := func(hour, minute int) internal.PolicyRequest {
+		return internal.PolicyRequest{When: time.Date(2026, 1, 1, hour, minute, 0, 0, time.UTC)}
+	}
+	assert.NoError(t, policy.Check(at(9, 0)))
+	assert.NoError(t, policy.Check(at(13, 0)))
+	assert.NoError(t, policy.Check(at(6, 0)))
+	requireViolation(t, policy.Check(at(23, 30)), "forbidden-hours")
+	requireViolation(t, policy.Check(at(2, 0)), "forbidden-hours")
+	requireViolation(t, policy.Check(at(12, 59)), "forbidden-hours")
+
+	// Times are read in the policy's time zone
+	policy.Timezone = "America/New_York"
+	assert.NoError(t, policy.Check(at(2, 0)))
+	requireViolation(t, policy.Check(at(17, 0)), "forbidden-hours")
+
+	policy.ForbiddenHours = []string{"after dinner"}
+	requireViolation(t, policy.Check(at(9, 0)), "forbidden-hours")
+	policy.ForbiddenHours = []string{"22:00-06:00"}
+	policy.Timezone = "Mars/Olympus_Mons"
+	requireViolation(t, policy.Check(at(9, 0)), "forbidden-hours")
+}
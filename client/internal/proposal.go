@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+// Proposers can hand the message to the coordinator along with the ceremony, so signers don't need some other way to
+// get a copy. A published message goes to anyone who knows the ceremony ID. A sealed one is encrypted to the identity
+// keys of the group's members, so the coordinator only ever sees ciphertext (and can't check the final signature).
+
+// Encrypt a message to the identity keys of a group's members
+func SealMessage(message []byte, identityKeys map[uint16]string) (string, error) {
+	if len(identityKeys) == 0 {
+		return "", errors.New("the group has no members to seal the message to")
+	}
+	var recipients []age.Recipient
+	for _, partyID := range slices.Sorted(maps.Keys(identityKeys)) {
+		pubKey, err := hex.DecodeString(identityKeys[partyID])
+		if err != nil || len(pubKey) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("party %d has an invalid identity key", partyID)
+		}
+		sshKey, err := ssh.NewPublicKey(ed25519.PublicKey(pubKey))
+		if err != nil {
+			return "", err
+		}
+		recipient, err := agessh.NewEd25519Recipient(sshKey)
+		if err != nil {
+			return "", err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	var sealed bytes.Buffer
+	w, err := age.Encrypt(&sealed, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create age writer: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return "", fmt.Errorf("failed to write data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to close age writer: %w", err)
+	}
+	return hex.EncodeToString(sealed.Bytes()), nil
+}
+
+// Decrypt a sealed message with our identity key
+func OpenSealedMessage(sealedHex string, identityKey ed25519.PrivateKey) ([]byte, error) {
+	identity, err := agessh.NewEd25519Identity(identityKey)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptShare(sealedHex, identity)
+}
+
+// Download the message a ceremony was asked to sign, and check it against the hash it was proposed with
+func FetchProposedMessage(ctx context.Context, host, ceremonyID, groupID string) ([]byte, SignProposal, error) {
+	proposal, err := DuctGetSignProposal(ctx, host, GetProposalRequest{CeremonyID: ceremonyID})
+	if err != nil {
+		return nil, SignProposal{}, err
+	}
+	var message []byte
+	if proposal.SealedMessage != "" {
+		identityKey, err := LoadIdentityKey()
+		if err != nil {
+			return nil, SignProposal{}, err
+		}
+		message, err = OpenSealedMessage(proposal.SealedMessage, identityKey)
+		if err != nil {
+			return nil, SignProposal{}, fmt.Errorf("could not open the sealed message: %w", err)
+		}
+	} else {
+		message, err = hex.DecodeString(proposal.Message)
+		if err != nil {
+			return nil, SignProposal{}, err
+		}
+	}
+	if subtle.ConstantTimeCompare([]byte(HashMessageForSanity(message, groupID)), []byte(proposal.Hash)) != 1 {
+		return nil, SignProposal{}, errors.New("the coordinator's copy of the message does not match the hash it was proposed with")
+	}
+	return message, proposal, nil
+}
+
+// Join a signing ceremony whose message we download from the coordinator
+func RunProposedSignCeremony(ctx context.Context, ceremonyID, host, identityFile string, approve func(SignReview) error) (CeremonyResult, error) {
+	pollResponse, err := DuctPollSignCeremony(ctx, host, PollSignRequest{CeremonyID: ceremonyID})
+	if err != nil {
+		return CeremonyResult{}, err
+	}
+	if pollResponse.SSHCertificate != "" {
+		return CeremonyResult{}, UsageError(fmt.Errorf("Ceremony %s issues an SSH certificate; join it with freeon sign join --ssh-cert", ceremonyID))
+	}
+	message, _, err := FetchProposedMessage(ctx, host, ceremonyID, pollResponse.GroupID)
+	if err != nil {
+		return CeremonyResult{}, err
+	}
+	return RunSignCeremony(ctx, ceremonyID, host, identityFile, message, approve)
+}
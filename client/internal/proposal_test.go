@@ -0,0 +1,41 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealMessage(t *testing.T) {
+	pub1, secret1, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	pub2, secret2, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	_, outsider, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	message := []byte("release v1.2.3")
+
+	sealed, err := internal.SealMessage(message, map[uint16]string{
+		1: hex.EncodeToString(pub1),
+		2: hex.EncodeToString(pub2),
+	})
+	assert.NoError(t, err)
+
+	// Every member can open it, and nobody else
+	for _, secret := range []ed25519.PrivateKey{secret1, secret2} {
+		opened, err := internal.OpenSealedMessage(sealed, secret)
+		assert.NoError(t, err)
+		assert.Equal(t, message, opened)
+	}
+	_, err = internal.OpenSealedMessage(sealed, outsider)
+	assert.Error(t, err)
+
+	_, err = internal.SealMessage(message, nil)
+	assert.Error(t, err)
+	_, err = internal.SealMessage(message, map[uint16]string{1: "not a key"})
+	assert.Error(t, err)
+}
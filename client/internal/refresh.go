@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/bytemare/dkg"
+	"github.com/bytemare/ecc"
+	secretsharing "github.com/bytemare/secret-sharing"
+)
+
+// Proactive share refresh.
+//
+// Every holder deals a random polynomial whose constant term is zero, and adds everyone's evaluations at its party ID
+// to its share. The shares all change, but they still interpolate to the same secret, so the group public key stays
+// the same. Old shares don't combine with new ones, so a share that leaked before the refresh is useless afterwards.
+
+// Domain separation for the public shares digest
+var refreshDigestPrefix = []byte("FREEON Refresh v1")
+
+// A random polynomial with a constant term of zero
+func NewRefreshPolynomial(threshold uint16) secretsharing.Polynomial {
+	g := dkg.Edwards25519Sha512.Group()
+	p := secretsharing.NewPolynomial(threshold)
+	p[0] = g.NewScalar()
+	for i := 1; i < int(threshold); i++ {
+		p[i] = g.NewScalar().Random()
+	}
+	return p
+}
+
+// Commit to a refresh polynomial.
+// The constant term is left out: it's zero by construction, and everyone adds it back in as the identity element.
+func CommitRefreshPolynomial(p secretsharing.Polynomial) []*ecc.Element {
+	return secretsharing.Commit(dkg.Edwards25519Sha512.Group(), p[1:])
+}
+
+// Concatenate the elements of a commitment
+func EncodeRefreshCommitment(commitment []*ecc.Element) []byte {
+	var out []byte
+	for _, c := range commitment {
+		out = append(out, c.Encode()...)
+	}
+	return out
+}
+
+// Decode a refresh commitment, which must have exactly threshold-1 elements
+func DecodeRefreshCommitment(data []byte, threshold uint16) ([]*ecc.Element, error) {
+	commitment, err := decodeElements(data, int(threshold)-1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refresh commitment: %w", err)
+	}
+	return commitment, nil
+}
+
+// Decode exactly count concatenated group elements
+func decodeElements(data []byte, count int) ([]*ecc.Element, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	size := g.ElementLength()
+	if len(data) != size*count {
+		return nil, fmt.Errorf("wrong length: %d", len(data))
+	}
+	var elements []*ecc.Element
+	for i := 0; i < len(data); i += size {
+		e := g.NewElement()
+		if err := e.Decode(data[i : i+size]); err != nil {
+			return nil, err
+		}
+		elements = append(elements, e)
+	}
+	return elements, nil
+}
+
+// The full VSS commitment for a refresh polynomial, including the zero constant term
+func fullRefreshCommitment(commitment []*ecc.Element) []*ecc.Element {
+	g := dkg.Edwards25519Sha512.Group()
+	return append([]*ecc.Element{g.NewElement()}, commitment...)
+}
+
+// Check a share we were dealt against its dealer's commitment
+func VerifyRefreshShare(delta *ecc.Scalar, me uint16, commitment []*ecc.Element) bool {
+	g := dkg.Edwards25519Sha512.Group()
+	return secretsharing.Verify(g, me, g.Base().Multiply(delta), fullRefreshCommitment(commitment))
+}
+
+// Our share is only meaningful alongside the dealer's and recipient's IDs, so they're sealed in with it
+func EncodeRefreshShare(sender, recipient uint16, delta *ecc.Scalar) []byte {
+	out := binary.BigEndian.AppendUint16(nil, sender)
+	out = binary.BigEndian.AppendUint16(out, recipient)
+	return append(out, delta.Encode()...)
+}
+
+func DecodeRefreshShare(data []byte) (uint16, uint16, *ecc.Scalar, error) {
+	if len(data) < 4 {
+		return 0, 0, nil, errors.New("refresh share is too short")
+	}
+	delta := dkg.Edwards25519Sha512.Group().NewScalar()
+	if err := delta.Decode(data[4:]); err != nil {
+		return 0, 0, nil, err
+	}
+	return binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:]), delta, nil
+}
+
+// Move a public share to the new epoch, by adding every dealer's commitment evaluated at its party ID
+func RefreshPublicShare(old *ecc.Element, id uint16, commitments [][]*ecc.Element) (*ecc.Element, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	pk := old.Copy()
+	for _, c := range commitments {
+		delta, err := secretsharing.PubKeyForCommitment(g, id, fullRefreshCommitment(c))
+		if err != nil {
+			return nil, err
+		}
+		pk.Add(delta)
+	}
+	return pk, nil
+}
+
+// Hash the public shares, so every holder can confirm they ended up with the same ones
+func PublicSharesDigest(publicShares map[string]string) string {
+	var ids []string
+	for id := range publicShares {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	h := sha512.New384()
+	h.Write(refreshDigestPrefix)
+	for _, id := range ids {
+		h.Write([]byte(id))
+		h.Write([]byte(publicShares[id]))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
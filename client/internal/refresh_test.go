@@ -0,0 +1,106 @@
+package internal_test
+
+import (
+	"testing"
+
+	"filippo.io/age"
+	"github.com/bytemare/ecc"
+	"github.com/bytemare/frost"
+	"github.com/bytemare/frost/debug"
+	secretsharing "github.com/bytemare/secret-sharing"
+	"github.com/bytemare/secret-sharing/keys"
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefresh(t *testing.T) {
+	g := frost.Ed25519.Group()
+	secretShares, groupKey, _ := debug.TrustedDealerKeygen(frost.Ed25519, nil, 2, 3)
+
+	// Every holder deals a zero-sum polynomial, and publishes their commitment through an envelope
+	var polynomials []secretsharing.Polynomial
+	var commitments [][]*ecc.Element
+	for _, s := range secretShares {
+		p := internal.NewRefreshPolynomial(2)
+		eph, err := age.GenerateX25519Identity()
+		assert.NoError(t, err)
+		env := internal.NewRefreshRound1Envelope(s.ID, internal.CommitRefreshPolynomial(p), eph)
+		c, err := internal.OpenRefreshRound1Envelope(env, 2)
+		assert.NoError(t, err)
+		polynomials = append(polynomials, p)
+		commitments = append(commitments, c)
+	}
+
+	var refreshed []*keys.KeyShare
+	for _, s := range secretShares {
+		delta := g.NewScalar()
+		for i, p := range polynomials {
+			d := p.Evaluate(g.NewScalar().SetUInt64(uint64(s.ID)))
+			assert.True(t, internal.VerifyRefreshShare(d, s.ID, commitments[i]))
+			delta.Add(d)
+		}
+		newSecret := s.Secret.Copy().Add(delta)
+		assert.False(t, newSecret.Equal(s.Secret))
+
+		// Everyone can work out the new public shares from the commitments alone
+		pk, err := internal.RefreshPublicShare(s.PublicKey, s.ID, commitments)
+		assert.NoError(t, err)
+		assert.True(t, g.Base().Multiply(newSecret).Equal(pk))
+
+		refreshed = append(refreshed, &keys.KeyShare{
+			Secret:          newSecret,
+			VerificationKey: groupKey,
+			PublicKeyShare:  keys.PublicKeyShare{ID: s.ID, PublicKey: pk, Group: g},
+		})
+	}
+
+	// Any two new shares still make the same key, but an old share doesn't mix with a new one
+	secret, err := secretsharing.RecoverFromKeyShares(refreshed[1:])
+	assert.NoError(t, err)
+	assert.True(t, g.Base().Multiply(secret).Equal(groupKey))
+	mixed, err := secretsharing.RecoverFromKeyShares([]*keys.KeyShare{secretShares[0], refreshed[1]})
+	assert.NoError(t, err)
+	assert.False(t, g.Base().Multiply(mixed).Equal(groupKey))
+
+	// A corrupted share is caught
+	bad := polynomials[2].Evaluate(g.NewScalar().SetUInt64(1))
+	bad.Add(g.NewScalar().One())
+	assert.False(t, internal.VerifyRefreshShare(bad, 1, commitments[2]))
+
+	// The commitment must have exactly t-1 elements
+	env := internal.NewRefreshRound1Envelope(1, commitments[0], mustIdentity(t))
+	_, err = internal.OpenRefreshRound1Envelope(env, 3)
+	assert.Error(t, err)
+}
+
+func TestRefreshShareEnvelope(t *testing.T) {
+	g := frost.Ed25519.Group()
+	eph := mustIdentity(t)
+	delta := g.NewScalar().Random()
+
+	sealed, err := internal.SealRefreshShare(1, 2, delta, eph.Recipient().String())
+	assert.NoError(t, err)
+	opened, err := internal.OpenRefreshShare(sealed, eph)
+	assert.NoError(t, err)
+	assert.True(t, delta.Equal(opened))
+
+	_, err = internal.OpenRefreshShare(sealed, mustIdentity(t))
+	assert.Error(t, err)
+	sealed.Sender = 3
+	_, err = internal.OpenRefreshShare(sealed, eph)
+	assert.Error(t, err)
+}
+
+func TestPublicSharesDigest(t *testing.T) {
+	a := internal.PublicSharesDigest(map[string]string{"0001": "aa", "0002": "bb"})
+	b := internal.PublicSharesDigest(map[string]string{"0002": "bb", "0001": "aa"})
+	c := internal.PublicSharesDigest(map[string]string{"0001": "aa", "0002": "cc"})
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
+
+func mustIdentity(t *testing.T) *age.X25519Identity {
+	id, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	return id
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bytemare/dkg"
+	"github.com/bytemare/ecc"
+	secretsharing "github.com/bytemare/secret-sharing"
+)
+
+// Resharing.
+//
+// At least t current holders (the dealers) each deal a fresh polynomial for the new threshold, whose constant term is
+// their share weighted by its Lagrange coefficient among the dealers. Those constant terms add up to the group's
+// secret, so each recipient's sum of what they were dealt is a share of the same secret, under the new threshold.
+//
+// Every dealer commits to their whole polynomial, so anyone can check that the constant terms add up to the group
+// public key, without learning anything about the secret.
+
+// The Lagrange coefficient for a dealer, at zero, among the given set of dealers
+func ReshareCoefficient(me uint16, dealers []uint16) (*ecc.Scalar, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	ids := secretsharing.NewPolynomialFromIntegers(g, dealers)
+	return ids.DeriveInterpolatingValue(g, g.NewScalar().SetUInt64(uint64(me)))
+}
+
+// A random polynomial for the new threshold, whose constant term is our weighted share
+func NewResharePolynomial(secret *ecc.Scalar, me uint16, dealers []uint16, threshold uint16) (secretsharing.Polynomial, error) {
+	if !slices.Contains(dealers, me) {
+		return nil, fmt.Errorf("party %d is not a dealer", me)
+	}
+	lambda, err := ReshareCoefficient(me, dealers)
+	if err != nil {
+		return nil, err
+	}
+	g := dkg.Edwards25519Sha512.Group()
+	p := secretsharing.NewPolynomial(threshold)
+	p[0] = secret.Copy().Multiply(lambda)
+	for i := 1; i < int(threshold); i++ {
+		p[i] = g.NewScalar().Random()
+	}
+	return p, nil
+}
+
+func CommitResharePolynomial(p secretsharing.Polynomial) []*ecc.Element {
+	return secretsharing.Commit(dkg.Edwards25519Sha512.Group(), p)
+}
+
+// Decode a reshare commitment, which must have exactly one element per coefficient
+func DecodeReshareCommitment(data []byte, threshold uint16) ([]*ecc.Element, error) {
+	commitment, err := decodeElements(data, int(threshold))
+	if err != nil {
+		return nil, fmt.Errorf("invalid reshare commitment: %w", err)
+	}
+	return commitment, nil
+}
+
+// Check that a dealer's constant term really is their weighted share, using their current public share.
+// Only current holders know everyone's public shares; newcomers rely on CheckReshareGroupKey instead.
+func VerifyDealerCommitment(commitment []*ecc.Element, dealer uint16, dealers []uint16, publicShare *ecc.Element) error {
+	lambda, err := ReshareCoefficient(dealer, dealers)
+	if err != nil {
+		return err
+	}
+	if !publicShare.Copy().Multiply(lambda).Equal(commitment[0]) {
+		return fmt.Errorf("party %d did not deal their own share", dealer)
+	}
+	return nil
+}
+
+// Check that the dealers' constant terms add up to the group's public key
+func CheckReshareGroupKey(commitments map[uint16][]*ecc.Element, groupKey *ecc.Element) error {
+	g := dkg.Edwards25519Sha512.Group()
+	sum := g.NewElement()
+	for _, c := range commitments {
+		sum.Add(c[0])
+	}
+	if !sum.Equal(groupKey) {
+		return errors.New("the dealers' shares do not add up to the group public key")
+	}
+	return nil
+}
+
+// Check a share we were dealt against its dealer's commitment
+func VerifyReshareShare(share *ecc.Scalar, me uint16, commitment []*ecc.Element) bool {
+	g := dkg.Edwards25519Sha512.Group()
+	return secretsharing.Verify(g, me, g.Base().Multiply(share), commitment)
+}
+
+// A recipient's public share in the new group, which is every dealer's commitment evaluated at its party ID
+func ResharePublicShare(id uint16, commitments map[uint16][]*ecc.Element) (*ecc.Element, error) {
+	g := dkg.Edwards25519Sha512.Group()
+	pk := g.NewElement()
+	for _, c := range commitments {
+		share, err := secretsharing.PubKeyForCommitment(g, id, c)
+		if err != nil {
+			return nil, err
+		}
+		pk.Add(share)
+	}
+	return pk, nil
+}
+
+// Make sure the coordinator locked a reshare with the participants it was proposed for, before we deal anything.
+// members are the group's current identity keys, by party ID. If we named the newcomers ourselves, the proposal has to
+// be for exactly those.
+func CheckReshareParticipants(state PollReshareResponse, members map[uint16]string, newcomers []string) error {
+	if len(newcomers) > 0 {
+		var expected []string
+		for _, n := range newcomers {
+			expected = append(expected, strings.ToLower(n))
+		}
+		proposed := slices.Clone(state.Newcomers)
+		slices.Sort(expected)
+		slices.Sort(proposed)
+		if !slices.Equal(expected, proposed) {
+			return errors.New("the reshare was proposed for different newcomers")
+		}
+	}
+	for _, d := range state.Dealers {
+		if key, ok := members[d]; !ok || key != state.IdentityKeys[d] {
+			return fmt.Errorf("dealer %d is not a member of the group", d)
+		}
+	}
+	var joined []string
+	for _, r := range state.Recipients {
+		key := state.IdentityKeys[r]
+		if member, ok := members[r]; ok {
+			if key != member {
+				return fmt.Errorf("recipient %d has a different identity key than the group member", r)
+			}
+			continue
+		}
+		if !slices.Contains(state.Newcomers, key) || slices.Contains(joined, key) {
+			return fmt.Errorf("recipient %d is not one of the newcomers the reshare was proposed for", r)
+		}
+		joined = append(joined, key)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/bytemare/ecc"
+	"github.com/bytemare/frost"
+	"github.com/bytemare/frost/debug"
+	secretsharing "github.com/bytemare/secret-sharing"
+	"github.com/bytemare/secret-sharing/keys"
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReshare(t *testing.T) {
+	g := frost.Ed25519.Group()
+	secretShares, groupKey, _ := debug.TrustedDealerKeygen(frost.Ed25519, nil, 2, 3)
+
+	// Parties 1 and 2 deal a 3-of-4 group to themselves and two newcomers
+	dealers := []uint16{1, 2}
+	recipients := []uint16{1, 2, 4, 5}
+	polynomials := make(map[uint16]secretsharing.Polynomial)
+	commitments := make(map[uint16][]*ecc.Element)
+	for _, s := range secretShares[:2] {
+		p, err := internal.NewResharePolynomial(s.Secret, s.ID, dealers, 3)
+		assert.NoError(t, err)
+		env := internal.NewReshareRound1Envelope(s.ID, internal.CommitResharePolynomial(p), mustIdentity(t))
+		c, err := internal.OpenReshareRound1Envelope(env, 3)
+		assert.NoError(t, err)
+		assert.NoError(t, internal.VerifyDealerCommitment(c, s.ID, dealers, s.PublicKey))
+		polynomials[s.ID] = p
+		commitments[s.ID] = c
+	}
+	assert.NoError(t, internal.CheckReshareGroupKey(commitments, groupKey))
+
+	// Party 3 isn't dealing, and a newcomer's round 1 has no commitment
+	_, err := internal.NewResharePolynomial(secretShares[2].Secret, 3, dealers, 3)
+	assert.Error(t, err)
+	c, err := internal.OpenReshareRound1Envelope(internal.NewReshareRound1Envelope(4, nil, mustIdentity(t)), 3)
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	var reshared []*keys.KeyShare
+	for _, r := range recipients {
+		secret := g.NewScalar()
+		for d, p := range polynomials {
+			share := p.Evaluate(g.NewScalar().SetUInt64(uint64(r)))
+			assert.True(t, internal.VerifyReshareShare(share, r, commitments[d]))
+			secret.Add(share)
+		}
+		pk, err := internal.ResharePublicShare(r, commitments)
+		assert.NoError(t, err)
+		assert.True(t, g.Base().Multiply(secret).Equal(pk))
+		reshared = append(reshared, &keys.KeyShare{
+			Secret:          secret,
+			VerificationKey: groupKey,
+			PublicKeyShare:  keys.PublicKeyShare{ID: r, PublicKey: pk, Group: g},
+		})
+	}
+
+	// Any three new shares make the same key, but two no longer do
+	secret, err := secretsharing.RecoverFromKeyShares(reshared[1:])
+	assert.NoError(t, err)
+	assert.True(t, g.Base().Multiply(secret).Equal(groupKey))
+	secret, err = secretsharing.RecoverFromKeyShares(reshared[2:])
+	assert.NoError(t, err)
+	assert.False(t, g.Base().Multiply(secret).Equal(groupKey))
+}
+
+func TestReshareCheating(t *testing.T) {
+	g := frost.Ed25519.Group()
+	secretShares, groupKey, _ := debug.TrustedDealerKeygen(frost.Ed25519, nil, 2, 3)
+	dealers := []uint16{1, 2}
+
+	// Party 2 deals a share that isn't theirs
+	honest, err := internal.NewResharePolynomial(secretShares[0].Secret, 1, dealers, 2)
+	assert.NoError(t, err)
+	cheat, err := internal.NewResharePolynomial(g.NewScalar().Random(), 2, dealers, 2)
+	assert.NoError(t, err)
+	commitments := map[uint16][]*ecc.Element{
+		1: internal.CommitResharePolynomial(honest),
+		2: internal.CommitResharePolynomial(cheat),
+	}
+	assert.Error(t, internal.VerifyDealerCommitment(commitments[2], 2, dealers, secretShares[1].PublicKey))
+	assert.Error(t, internal.CheckReshareGroupKey(commitments, groupKey))
+
+	// A corrupted share is caught
+	bad := honest.Evaluate(g.NewScalar().SetUInt64(3))
+	bad.Add(g.NewScalar().One())
+	assert.False(t, internal.VerifyReshareShare(bad, 3, commitments[1]))
+
+	// So is a share sealed for somebody else
+	eph := mustIdentity(t)
+	sealed, err := internal.SealReshareShare(1, 3, honest.Evaluate(g.NewScalar().SetUInt64(3)), eph.Recipient().String())
+	assert.NoError(t, err)
+	_, err = internal.OpenReshareShare(sealed, mustIdentity(t))
+	assert.Error(t, err)
+	opened, err := internal.OpenReshareShare(sealed, eph)
+	assert.NoError(t, err)
+	assert.True(t, internal.VerifyReshareShare(opened, 3, commitments[1]))
+}
+
+func TestCheckReshareParticipants(t *testing.T) {
+	members := map[uint16]string{1: "aa", 2: "bb", 3: "cc"}
+	state := internal.PollReshareResponse{
+		Dealers:      []uint16{1, 2},
+		Recipients:   []uint16{1, 2, 4},
+		Newcomers:    []string{"dd"},
+		IdentityKeys: map[uint16]string{1: "aa", 2: "bb", 4: "dd"},
+	}
+	assert.NoError(t, internal.CheckReshareParticipants(state, members, nil))
+	assert.NoError(t, internal.CheckReshareParticipants(state, members, []string{"DD"}))
+
+	// We named somebody else
+	assert.Error(t, internal.CheckReshareParticipants(state, members, []string{"ee"}))
+
+	// A recipient nobody proposed
+	state.IdentityKeys[4] = "ee"
+	assert.Error(t, internal.CheckReshareParticipants(state, members, nil))
+	state.IdentityKeys[4] = "dd"
+
+	// A member with the wrong key, or the same newcomer twice
+	state.IdentityKeys[2] = "ee"
+	assert.Error(t, internal.CheckReshareParticipants(state, members, nil))
+	state.IdentityKeys[2] = "bb"
+	state.Recipients = []uint16{1, 2, 4, 5}
+	state.IdentityKeys[5] = "dd"
+	assert.Error(t, internal.CheckReshareParticipants(state, members, nil))
+}
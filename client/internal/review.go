@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Before a share is ever decrypted, the person holding it gets to see what they're about to sign, and say yes.
+
+// How much of a message to show before asking whether to sign it
+const previewLimit = 1024
+
+// The user said no, or wasn't around to say yes
+var errNotApproved = errors.New("not approved; pass --auto-confirm to sign without a prompt")
+
+// Everything a signer should know about a ceremony before joining it
+type SignReview struct {
+	CeremonyID string
+	GroupID    string
+	// Who created the ceremony, if the coordinator knows
+	Proposer  string
+	Message   []byte
+	OpenSSH   bool
+	Namespace string
+	// Set for ceremonies that issue an SSH certificate, which is what Message holds
+	SSHCertificate bool
+	Threshold      uint16
+	// Parties that joined before we did
+	Joined []uint16
+}
+
+// Gather what there is to know about a ceremony, to sign the given message with it
+func ReviewSignCeremony(ctx context.Context, host, ceremonyID string, message []byte) (SignReview, error) {
+	pollResponse, err := DuctPollSignCeremony(ctx, host, PollSignRequest{CeremonyID: ceremonyID})
+	if err != nil {
+		return SignReview{}, err
+	}
+	return newSignReview(ceremonyID, pollResponse, message), nil
+}
+
+// Gather what there is to know about a ceremony, along with the message it signs: the certificate, for a ceremony
+// that issues one, or whatever the proposer published or sealed for us
+func ReviewProposedCeremony(ctx context.Context, host, ceremonyID string) (SignReview, error) {
+	pollResponse, err := DuctPollSignCeremony(ctx, host, PollSignRequest{CeremonyID: ceremonyID})
+	if err != nil {
+		return SignReview{}, err
+	}
+	if pollResponse.SSHCertificate != "" {
+		tbs, err := hex.DecodeString(pollResponse.SSHCertificate)
+		if err != nil {
+			return SignReview{}, err
+		}
+		if _, err := ParseSSHCertificate(tbs); err != nil {
+			return SignReview{}, err
+		}
+		return newSignReview(ceremonyID, pollResponse, tbs), nil
+	}
+	message, _, err := FetchProposedMessage(ctx, host, ceremonyID, pollResponse.GroupID)
+	if err != nil {
+		return SignReview{}, err
+	}
+	return newSignReview(ceremonyID, pollResponse, message), nil
+}
+
+func newSignReview(ceremonyID string, pollResponse PollSignResponse, message []byte) SignReview {
+	return SignReview{
+		CeremonyID:     ceremonyID,
+		GroupID:        pollResponse.GroupID,
+		Proposer:       pollResponse.Proposer,
+		Message:        message,
+		OpenSSH:        pollResponse.OpenSSH,
+		Namespace:      pollResponse.Namespace,
+		SSHCertificate: pollResponse.SSHCertificate != "",
+		Threshold:      pollResponse.Threshold,
+		Joined:         pollResponse.OtherParties,
+	}
+}
+
+// Lay out the ceremony, followed by the message in whatever form is easiest to read
+func (r SignReview) Describe() string {
+	var b strings.Builder
+	digest := sha256.Sum256(r.Message)
+	fmt.Fprintf(&b, "Ceremony: %s\n", r.CeremonyID)
+	fmt.Fprintf(&b, "Group: %s\n", r.GroupID)
+	proposer := r.Proposer
+	if proposer == "" {
+		proposer = "(unknown)"
+	}
+	fmt.Fprintf(&b, "Proposed by: %s\n", proposer)
+	switch {
+	case r.SSHCertificate:
+		fmt.Fprintf(&b, "Format: OpenSSH certificate\n")
+	case r.OpenSSH:
+		fmt.Fprintf(&b, "Format: SSHSIG, namespace %q\n", r.Namespace)
+	default:
+		fmt.Fprintf(&b, "Format: Ed25519 signature\n")
+	}
+	fmt.Fprintf(&b, "Size: %d bytes\n", len(r.Message))
+	fmt.Fprintf(&b, "SHA-256: %x\n", digest)
+	if len(r.Joined) == 0 {
+		fmt.Fprintf(&b, "Joined: nobody yet (%d signers needed)\n", r.Threshold)
+	} else {
+		joined := make([]string, len(r.Joined))
+		for i, p := range r.Joined {
+			joined[i] = strconv.Itoa(int(p))
+		}
+		fmt.Fprintf(&b, "Joined: parties %s (%d signers needed)\n", strings.Join(joined, ", "), r.Threshold)
+	}
+	b.WriteString("\n")
+
+	if r.SSHCertificate {
+		if cert, err := ParseSSHCertificate(r.Message); err == nil {
+			b.WriteString(cert.Describe())
+			return b.String()
+		}
+	}
+	if described, ok := DescribeGitObject(r.Message); ok {
+		b.WriteString(described)
+		return b.String()
+	}
+	b.WriteString(PreviewMessage(r.Message))
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Show the review on out, and wait for an explicit yes. With autoConfirm, the review is shown but nobody is asked.
+func (r SignReview) Confirm(out io.Writer, answers io.Reader, autoConfirm bool) error {
+	fmt.Fprintf(out, "%s\n", r.Describe())
+	if autoConfirm {
+		fmt.Fprintf(out, "Signing without confirmation (--auto-confirm).\n")
+		return nil
+	}
+	fmt.Fprintf(out, "Sign this? [y/N] ")
+	answer, _ := bufio.NewReader(answers).ReadString('\n')
+	// Nobody echoes an answer that didn't come from a terminal, so finish the prompt's line ourselves
+	if f, ok := answers.(*os.File); !ok || !isTerminal(f) {
+		fmt.Fprintf(out, "\n")
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return errNotApproved
+	}
+	return nil
+}
+
+// Show the start of a message: as text if it's printable, and as a hex dump otherwise
+func PreviewMessage(message []byte) string {
+	preview := message
+	if len(preview) > previewLimit {
+		preview = preview[:previewLimit]
+	}
+	text := string(preview)
+	binary := strings.ContainsFunc(text, func(r rune) bool {
+		return r == utf8.RuneError || (!unicode.IsPrint(r) && !unicode.IsSpace(r))
+	})
+	if binary {
+		text = hex.Dump(preview)
+	}
+	if len(preview) < len(message) {
+		text += fmt.Sprintf("\n... (%d more bytes)", len(message)-len(preview))
+	}
+	return text
+}
+
+// Object IDs are SHA-1 or SHA-256, depending on the repository
+var gitObjectID = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// Identities look like "Name <email> 1700000000 +0100"
+var gitIdentity = regexp.MustCompile(`^(.*) (\d+) ([+-]\d{4})$`)
+
+// git signs commit and tag objects exactly as it stores them, which is readable enough, but easy to misread
+func DescribeGitObject(message []byte) (string, bool) {
+	if !utf8.Valid(message) {
+		return "", false
+	}
+	header, body, _ := strings.Cut(string(message), "\n\n")
+	var kind string
+	switch {
+	case strings.HasPrefix(header, "tree "):
+		kind = "commit"
+	case strings.HasPrefix(header, "object "):
+		kind = "tag"
+	default:
+		return "", false
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Git %s\n", kind)
+	for _, line := range strings.Split(header, "\n") {
+		// Continuation lines belong to a multi-line header (an embedded signature, say)
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return "", false
+		}
+		switch key {
+		case "tree", "parent", "object":
+			if !gitObjectID.MatchString(value) {
+				return "", false
+			}
+		case "author", "committer", "tagger":
+			value = formatGitIdentity(value)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", strings.ToUpper(key[:1])+key[1:], value)
+	}
+	if body != "" {
+		b.WriteString("\n")
+		for _, line := range strings.Split(strings.TrimRight(PreviewMessage([]byte(body)), "\n"), "\n") {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+	return b.String(), true
+}
+
+func formatGitIdentity(value string) string {
+	m := gitIdentity.FindStringSubmatch(value)
+	if m == nil {
+		return value
+	}
+	seconds, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return value
+	}
+	offset, err := time.Parse("-0700", m[3])
+	if err != nil {
+		return value
+	}
+	_, zone := offset.Zone()
+	when := time.Unix(seconds, 0).In(time.FixedZone(m[3], zone))
+	return fmt.Sprintf("%s, %s", m[1], when.Format("2006-01-02 15:04:05 -0700"))
+}
+
+// Whether a file is a terminal, rather than a file or a pipe
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,78 @@
+package internal_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewMessage(t *testing.T) {
+	assert.Equal(t, "hello\nworld\n", internal.PreviewMessage([]byte("hello\nworld\n")))
+
+	// Binary gets a hex dump
+	preview := internal.PreviewMessage([]byte{0x00, 0x01, 0xff})
+	assert.Contains(t, preview, "00 01 ff")
+
+	// Long messages are cut short
+	preview = internal.PreviewMessage([]byte(strings.Repeat("a", 2000)))
+	assert.True(t, strings.HasSuffix(preview, "(976 more bytes)"))
+}
+
+func TestDescribeGitObject(t *testing.T) {
+	commit := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 8f1e2d3c4b5a69788796a5b4c3d2e1f00112233a\n" +
+		"author Alice <alice@example.com> 1700000000 +0100\n" +
+		"committer Bob <bob@example.com> 1700000100 -0500\n" +
+		"\n" +
+		"Release v1.2.3\n\nWith a longer description.\n"
+	described, ok := internal.DescribeGitObject([]byte(commit))
+	assert.True(t, ok)
+	assert.Contains(t, described, "Git commit\n")
+	assert.Contains(t, described, "Parent: 8f1e2d3c4b5a69788796a5b4c3d2e1f00112233a\n")
+	assert.Contains(t, described, "Author: Alice <alice@example.com>, 2023-11-14 23:13:20 +0100\n")
+	assert.Contains(t, described, "Committer: Bob <bob@example.com>, 2023-11-14 17:15:00 -0500\n")
+	assert.Contains(t, described, "    Release v1.2.3\n")
+
+	tag := "object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\ntype commit\ntag v1.2.3\n" +
+		"tagger Alice <alice@example.com> 1700000000 +0000\n\nv1.2.3\n"
+	described, ok = internal.DescribeGitObject([]byte(tag))
+	assert.True(t, ok)
+	assert.Contains(t, described, "Git tag\n")
+	assert.Contains(t, described, "Tag: v1.2.3\n")
+
+	// Anything else is just a message
+	for _, message := range []string{"tree of life\n\nhello", "hello world", "tree 1234\n\nshort id"} {
+		_, ok = internal.DescribeGitObject([]byte(message))
+		assert.False(t, ok, message)
+	}
+}
+
+func TestSignReview(t *testing.T) {
+	review := internal.SignReview{
+		CeremonyID: "c_abc",
+		GroupID:    "g_def",
+		Proposer:   `API token "ci"`,
+		Message:    []byte("hello"),
+		OpenSSH:    true,
+		Namespace:  "git",
+		Threshold:  2,
+		Joined:     []uint16{1, 3},
+	}
+	described := review.Describe()
+	assert.Contains(t, described, `Proposed by: API token "ci"`)
+	assert.Contains(t, described, `Format: SSHSIG, namespace "git"`)
+	assert.Contains(t, described, "Size: 5 bytes")
+	assert.Contains(t, described, "SHA-256: 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+	assert.Contains(t, described, "Joined: parties 1, 3")
+	assert.True(t, strings.HasSuffix(described, "\nhello\n"))
+
+	// Only an explicit yes will do, unless nobody is there to ask
+	assert.NoError(t, review.Confirm(io.Discard, strings.NewReader("y\n"), false))
+	assert.NoError(t, review.Confirm(io.Discard, strings.NewReader("YES\n"), false))
+	assert.Error(t, review.Confirm(io.Discard, strings.NewReader("n\n"), false))
+	assert.Error(t, review.Confirm(io.Discard, strings.NewReader(""), false))
+	assert.NoError(t, review.Confirm(io.Discard, strings.NewReader(""), true))
+}
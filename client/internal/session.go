@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Everything one client keeps to itself: how it reaches coordinators, who it is to them, how long it waits, and who
+// hears about anything that goes wrong without stopping the ceremony.
+//
+// The freeon command has one for the whole process. Programs that use the freeon package get one per Client, so two
+// Clients in one process don't overwrite each other's settings. Whichever session a context carries is the one that
+// gets used; a context without one gets the freeon command's.
+type Session struct {
+	// Guards the connections and the identity key, which are set up the first time they're needed. Ceremonies can run
+	// side by side, and any of them might be first.
+	mu          sync.Mutex
+	httpClient  *http.Client
+	relayClient *http.Client
+	// Our long-term key, used to sign requests so the coordinator knows who sent them
+	identityKey       ed25519.PrivateKey
+	clientCertificate *tls.Certificate
+
+	// For those who propose or administer ceremonies without being a member of the group
+	apiToken string
+	// Set once the coordinator is only reachable through bundles
+	offline *offlineLink
+
+	requestTimeout  time.Duration
+	ceremonyTimeout time.Duration
+
+	warn func(string)
+}
+
+// A session with the default timeouts. warn gets anything worth telling a person that doesn't stop the ceremony; if
+// it's nil, nobody hears about it.
+func NewSession(warn func(string)) *Session {
+	if warn == nil {
+		warn = func(string) {}
+	}
+	return &Session{
+		requestTimeout:  defaultRequestTimeout,
+		ceremonyTimeout: defaultCeremonyTimeout,
+		warn:            warn,
+	}
+}
+
+// The freeon command's session, which tells the user on stderr
+var commandSession = NewSession(func(message string) {
+	fmt.Fprintf(os.Stderr, "%s\n", message)
+})
+
+type sessionKey struct{}
+
+// Run everything under ctx in this session
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+func sessionFrom(ctx context.Context) *Session {
+	if s, ok := ctx.Value(sessionKey{}).(*Session); ok {
+		return s
+	}
+	return commandSession
+}
+
+func (s *Session) warnf(format string, args ...any) {
+	s.warn(fmt.Sprintf(format, args...))
+}
+
+// Send this API token to the endpoints that take one
+func (s *Session) SetApiToken(token string) {
+	s.apiToken = token
+}
+
+// Send this API token to the endpoints that take one, from the freeon command
+func SetApiToken(token string) {
+	commandSession.SetApiToken(token)
+}
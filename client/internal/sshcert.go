@@ -0,0 +1,541 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenSSH certificates, issued by the group key acting as a CA.
+// See PROTOCOL.certkeys in the OpenSSH source tree for the format.
+const sshCertType = "ssh-ed25519-cert-v01@openssh.com"
+
+const (
+	SSHUserCert uint32 = 1
+	SSHHostCert uint32 = 2
+)
+
+// Certificates valid forever use the largest timestamp
+const sshCertForever = math.MaxUint64
+
+// What ssh-keygen grants user certificates unless told otherwise
+var sshDefaultExtensions = []string{
+	"permit-X11-forwarding",
+	"permit-agent-forwarding",
+	"permit-port-forwarding",
+	"permit-pty",
+	"permit-user-rc",
+}
+
+type SSHCertOption struct {
+	Name  string
+	Value string
+}
+
+// An Ed25519 certificate for an Ed25519 key, minus the CA's signature
+type SSHCertificate struct {
+	Nonce           []byte
+	PublicKey       []byte
+	Serial          uint64
+	CertType        uint32
+	KeyID           string
+	Principals      []string
+	ValidAfter      uint64
+	ValidBefore     uint64
+	CriticalOptions []SSHCertOption
+	Extensions      []SSHCertOption
+	SignatureKey    []byte
+}
+
+// Start a certificate for a key, with a fresh nonce and the default extensions for its type
+func NewSSHCertificate(pubKey, caKey []byte, certType uint32) (SSHCertificate, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return SSHCertificate{}, err
+	}
+	cert := SSHCertificate{
+		Nonce:        nonce,
+		PublicKey:    pubKey,
+		CertType:     certType,
+		ValidBefore:  sshCertForever,
+		SignatureKey: caKey,
+	}
+	if certType == SSHUserCert {
+		for _, ext := range sshDefaultExtensions {
+			cert.Extensions = append(cert.Extensions, SSHCertOption{Name: ext})
+		}
+	}
+	return cert, nil
+}
+
+// Options are sorted by name, and values are themselves wrapped in a string
+func encodeSSHCertOptions(opts []SSHCertOption) []byte {
+	sorted := slices.Clone(opts)
+	slices.SortFunc(sorted, func(a, b SSHCertOption) int { return strings.Compare(a.Name, b.Name) })
+	var buf bytes.Buffer
+	for _, o := range sorted {
+		putString(&buf, []byte(o.Name))
+		if o.Value == "" {
+			putString(&buf, nil)
+		} else {
+			var value bytes.Buffer
+			putString(&value, []byte(o.Value))
+			putString(&buf, value.Bytes())
+		}
+	}
+	return buf.Bytes()
+}
+
+func decodeSSHCertOptions(buf []byte) ([]SSHCertOption, error) {
+	var opts []SSHCertOption
+	for len(buf) > 0 {
+		name, rest, err := readString(buf)
+		if err != nil {
+			return nil, err
+		}
+		data, rest, err := readString(rest)
+		if err != nil {
+			return nil, err
+		}
+		opt := SSHCertOption{Name: string(name)}
+		if len(data) > 0 {
+			value, trailing, err := readString(data)
+			if err != nil {
+				return nil, err
+			}
+			if len(trailing) != 0 {
+				return nil, fmt.Errorf("malformed value for option %s", name)
+			}
+			opt.Value = string(value)
+		}
+		opts = append(opts, opt)
+		buf = rest
+	}
+	return opts, nil
+}
+
+// The data the CA signs: every field of the certificate except the signature
+func (c SSHCertificate) SignedData() []byte {
+	var principals bytes.Buffer
+	for _, p := range c.Principals {
+		putString(&principals, []byte(p))
+	}
+	var buf bytes.Buffer
+	putString(&buf, []byte(sshCertType))
+	putString(&buf, c.Nonce)
+	putString(&buf, c.PublicKey)
+	binary.Write(&buf, binary.BigEndian, c.Serial)
+	binary.Write(&buf, binary.BigEndian, c.CertType)
+	putString(&buf, []byte(c.KeyID))
+	putString(&buf, principals.Bytes())
+	binary.Write(&buf, binary.BigEndian, c.ValidAfter)
+	binary.Write(&buf, binary.BigEndian, c.ValidBefore)
+	putString(&buf, encodeSSHCertOptions(c.CriticalOptions))
+	putString(&buf, encodeSSHCertOptions(c.Extensions))
+	// reserved (empty string)
+	putString(&buf, nil)
+	putString(&buf, sshPublicKeyBlob(c.SignatureKey))
+	return buf.Bytes()
+}
+
+// Parse what SignedData produces
+func ParseSSHCertificate(tbs []byte) (SSHCertificate, error) {
+	c, rest, err := parseSSHCertificate(tbs)
+	if err != nil {
+		return c, err
+	}
+	if len(rest) != 0 {
+		return c, errors.New("trailing data after certificate")
+	}
+	return c, nil
+}
+
+// Parse a finished certificate, as Encode writes it.
+// Returns the certificate, the data the CA signed, and the CA's signature.
+func ParseSignedSSHCertificate(line string) (SSHCertificate, []byte, []byte, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != sshCertType {
+		return SSHCertificate{}, nil, nil, errors.New("not an Ed25519 SSH certificate")
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return SSHCertificate{}, nil, nil, fmt.Errorf("invalid certificate encoding: %w", err)
+	}
+	c, rest, err := parseSSHCertificate(blob)
+	if err != nil {
+		return c, nil, nil, err
+	}
+	tbs := blob[:len(blob)-len(rest)]
+	sigBlob, trailing, err := readString(rest)
+	if err != nil {
+		return c, nil, nil, err
+	}
+	sigType, rawSig, err := readString(sigBlob)
+	if err != nil {
+		return c, nil, nil, err
+	}
+	rawSig, sigTrailing, err := readString(rawSig)
+	if err != nil {
+		return c, nil, nil, err
+	}
+	if string(sigType) != "ssh-ed25519" || len(rawSig) != ed25519.SignatureSize || len(sigTrailing) != 0 || len(trailing) != 0 {
+		return c, nil, nil, errors.New("only Ed25519 certificate signatures are supported")
+	}
+	return c, tbs, rawSig, nil
+}
+
+// Parse the fields the CA signs, returning whatever comes after them
+func parseSSHCertificate(blob []byte) (SSHCertificate, []byte, error) {
+	var c SSHCertificate
+	certType, rest, err := readString(blob)
+	if err != nil {
+		return c, nil, err
+	}
+	if string(certType) != sshCertType {
+		return c, nil, fmt.Errorf("unsupported certificate type: %q", certType)
+	}
+	if c.Nonce, rest, err = readString(rest); err != nil {
+		return c, nil, err
+	}
+	if c.PublicKey, rest, err = readString(rest); err != nil {
+		return c, nil, err
+	}
+	if len(rest) < 12 {
+		return c, nil, errors.New("truncated certificate")
+	}
+	c.Serial = binary.BigEndian.Uint64(rest)
+	c.CertType = binary.BigEndian.Uint32(rest[8:])
+	rest = rest[12:]
+	keyID, rest, err := readString(rest)
+	if err != nil {
+		return c, nil, err
+	}
+	c.KeyID = string(keyID)
+	principals, rest, err := readString(rest)
+	if err != nil {
+		return c, nil, err
+	}
+	for len(principals) > 0 {
+		var p []byte
+		if p, principals, err = readString(principals); err != nil {
+			return c, nil, err
+		}
+		c.Principals = append(c.Principals, string(p))
+	}
+	if len(rest) < 16 {
+		return c, nil, errors.New("truncated certificate")
+	}
+	c.ValidAfter = binary.BigEndian.Uint64(rest)
+	c.ValidBefore = binary.BigEndian.Uint64(rest[8:])
+	rest = rest[16:]
+
+	fields := make([][]byte, 4)
+	for i := range fields {
+		if fields[i], rest, err = readString(rest); err != nil {
+			return c, nil, err
+		}
+	}
+	if c.CriticalOptions, err = decodeSSHCertOptions(fields[0]); err != nil {
+		return c, nil, err
+	}
+	if c.Extensions, err = decodeSSHCertOptions(fields[1]); err != nil {
+		return c, nil, err
+	}
+	if c.SignatureKey, err = parseSSHKeyBlob(fields[3]); err != nil {
+		return c, nil, err
+	}
+	return c, rest, nil
+}
+
+// The finished certificate, in the format ssh-keygen writes to *-cert.pub
+func (c SSHCertificate) Encode(rawSig []byte) string {
+	var sigBlob bytes.Buffer
+	putString(&sigBlob, []byte("ssh-ed25519"))
+	putString(&sigBlob, rawSig)
+
+	buf := bytes.NewBuffer(c.SignedData())
+	putString(buf, sigBlob.Bytes())
+	return sshCertType + " " + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func formatSSHCertTime(t uint64) string {
+	switch t {
+	case 0:
+		return "always"
+	case sshCertForever:
+		return "forever"
+	}
+	if t > math.MaxInt64 {
+		return strconv.FormatUint(t, 10)
+	}
+	return time.Unix(int64(t), 0).Format("2006-01-02T15:04:05")
+}
+
+// Lay out every field, the way ssh-keygen -L does, so signers know what they're agreeing to
+func (c SSHCertificate) Describe() string {
+	var b strings.Builder
+	certType := "user"
+	if c.CertType == SSHHostCert {
+		certType = "host"
+	}
+	fmt.Fprintf(&b, "Type: %s %s certificate\n", sshCertType, certType)
+	fmt.Fprintf(&b, "Public key: ED25519-CERT %s\n", SSHFingerprint(c.PublicKey))
+	fmt.Fprintf(&b, "Signing CA: ED25519 %s\n", SSHFingerprint(c.SignatureKey))
+	fmt.Fprintf(&b, "Key ID: %q\n", c.KeyID)
+	fmt.Fprintf(&b, "Serial: %d\n", c.Serial)
+	if c.ValidAfter == 0 && c.ValidBefore == sshCertForever {
+		fmt.Fprintf(&b, "Valid: forever\n")
+	} else {
+		fmt.Fprintf(&b, "Valid: from %s to %s\n", formatSSHCertTime(c.ValidAfter), formatSSHCertTime(c.ValidBefore))
+	}
+	fmt.Fprintf(&b, "Principals:")
+	if len(c.Principals) == 0 {
+		fmt.Fprintf(&b, " (none)")
+	}
+	for _, p := range c.Principals {
+		fmt.Fprintf(&b, "\n        %s", p)
+	}
+	for _, section := range []struct {
+		name string
+		opts []SSHCertOption
+	}{{"Critical Options", c.CriticalOptions}, {"Extensions", c.Extensions}} {
+		fmt.Fprintf(&b, "\n%s:", section.name)
+		if len(section.opts) == 0 {
+			fmt.Fprintf(&b, " (none)")
+		}
+		for _, o := range section.opts {
+			if o.Value == "" {
+				fmt.Fprintf(&b, "\n        %s", o.Name)
+			} else {
+				fmt.Fprintf(&b, "\n        %s %s", o.Name, o.Value)
+			}
+		}
+	}
+	return b.String() + "\n"
+}
+
+// Parse a time for -V: "always", "forever", a time relative to now (+1h30m, -5m), or an absolute YYYYMMDD[HHMM[SS]][Z]
+func parseSSHCertTime(s string, now time.Time) (uint64, error) {
+	switch strings.ToLower(s) {
+	case "always":
+		return 0, nil
+	case "forever":
+		return sshCertForever, nil
+	}
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		d, err := parseSSHDuration(s[1:])
+		if err != nil {
+			return 0, err
+		}
+		if s[0] == '-' {
+			d = -d
+		}
+		return uint64(now.Add(d).Unix()), nil
+	}
+	t, err := ParseSSHTime(s)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(t.Unix()), nil
+}
+
+// Durations like sshd_config(5) writes them: 90, 1h30m, 4w
+func parseSSHDuration(s string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		's': time.Second, 'S': time.Second,
+		'm': time.Minute, 'M': time.Minute,
+		'h': time.Hour, 'H': time.Hour,
+		'd': 24 * time.Hour, 'D': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour, 'W': 7 * 24 * time.Hour,
+	}
+	if s == "" {
+		return 0, errors.New("empty duration")
+	}
+	var total time.Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		unit := time.Second
+		if i < len(s) {
+			u, ok := units[s[i]]
+			if !ok {
+				return 0, fmt.Errorf("invalid duration unit: %c", s[i])
+			}
+			unit = u
+			i++
+		}
+		total += time.Duration(n) * unit
+		s = s[i:]
+	}
+	return total, nil
+}
+
+// Parse a validity interval, as ssh-keygen -V takes it: "from:to", or just "to" for a certificate valid from now
+func ParseSSHValidity(s string, now time.Time) (uint64, uint64, error) {
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		from, to = "", s
+	}
+	validAfter := uint64(now.Unix())
+	var err error
+	if from != "" {
+		if validAfter, err = parseSSHCertTime(from, now); err != nil {
+			return 0, 0, err
+		}
+	}
+	validBefore, err := parseSSHCertTime(to, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	if validAfter >= validBefore {
+		return 0, 0, errors.New("validity interval is empty")
+	}
+	return validAfter, validBefore, nil
+}
+
+// Apply one ssh-keygen -O certificate option
+func (c *SSHCertificate) ApplyOption(opt string) error {
+	name, value, hasValue := strings.Cut(opt, "=")
+	lower := strings.ToLower(name)
+
+	setOption := func(opts *[]SSHCertOption, name, value string) {
+		*opts = slices.DeleteFunc(*opts, func(o SSHCertOption) bool { return o.Name == name })
+		*opts = append(*opts, SSHCertOption{Name: name, Value: value})
+	}
+	if c.CertType == SSHHostCert && lower != "clear" {
+		return errors.New("host certificates don't take options")
+	}
+	switch {
+	case lower == "clear":
+		c.CriticalOptions = nil
+		c.Extensions = nil
+	case lower == "force-command" || lower == "source-address":
+		if !hasValue || value == "" {
+			return fmt.Errorf("%s needs a value", name)
+		}
+		setOption(&c.CriticalOptions, lower, value)
+	case lower == "verify-required":
+		setOption(&c.CriticalOptions, lower, "")
+	case lower == "no-touch-required":
+		setOption(&c.Extensions, lower, "")
+	case strings.HasPrefix(lower, "critical:"):
+		setOption(&c.CriticalOptions, name[len("critical:"):], value)
+	case strings.HasPrefix(lower, "extension:"):
+		setOption(&c.Extensions, name[len("extension:"):], value)
+	default:
+		// permit-* and no-* toggle the default extensions
+		for _, ext := range sshDefaultExtensions {
+			suffix := strings.ToLower(strings.TrimPrefix(ext, "permit-"))
+			switch lower {
+			case "permit-" + suffix:
+				setOption(&c.Extensions, ext, "")
+				return nil
+			case "no-" + suffix:
+				c.Extensions = slices.DeleteFunc(c.Extensions, func(o SSHCertOption) bool { return o.Name == ext })
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown certificate option: %s", opt)
+	}
+	return nil
+}
+
+// The key a certificate ceremony for a group is signed with: the one in caKeyFile if one is given, otherwise our own
+// share's group key
+func certificateAuthorityKey(groupID, caKeyFile string) ([]byte, error) {
+	if caKeyFile != "" {
+		caKey, err := os.ReadFile(caKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseOpenSSHPublicKey(string(caKey))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", caKeyFile, err)
+		}
+		return key, nil
+	}
+	config, err := LoadUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range config.Shares {
+		if s.GroupID == groupID {
+			return hex.DecodeString(s.PublicKey)
+		}
+	}
+	return nil, UsageError(fmt.Errorf("You don't hold a share for group %s, so pass its public key with -s", groupID))
+}
+
+// Propose a certificate for the group to sign. Its SignatureKey has to be the group's public key.
+func CreateSSHCertCeremony(ctx context.Context, host, groupID string, cert SSHCertificate) (CeremonyResult, error) {
+	tbs := cert.SignedData()
+	res, err := DuctInitSignCeremony(ctx, host, InitSignRequest{
+		GroupID:        groupID,
+		MessageHash:    HashMessageForSanity(tbs, groupID),
+		SSHCertificate: hex.EncodeToString(tbs),
+		MyPartyID:      proposeAs(ctx, groupID),
+	})
+	if err != nil {
+		return CeremonyResult{}, err
+	}
+	return CeremonyResult{
+		CeremonyID: res.CeremonyID,
+		GroupID:    groupID,
+		Status:     "created",
+		Format:     SignatureFormatSSHCert,
+	}, nil
+}
+
+// Join a certificate ceremony, once approve has seen what the certificate says and returned nil
+func RunSSHCertCeremony(ctx context.Context, ceremonyID, host, identityFile string, approve func(SignReview) error) (CeremonyResult, error) {
+	pollResponse, err := DuctPollSignCeremony(ctx, host, PollSignRequest{CeremonyID: ceremonyID})
+	if err != nil {
+		return CeremonyResult{}, err
+	}
+	if pollResponse.SSHCertificate == "" {
+		return CeremonyResult{}, UsageError(fmt.Errorf("Ceremony %s does not issue an SSH certificate", ceremonyID))
+	}
+	tbs, err := hex.DecodeString(pollResponse.SSHCertificate)
+	if err != nil {
+		return CeremonyResult{}, err
+	}
+	if _, err := ParseSSHCertificate(tbs); err != nil {
+		return CeremonyResult{}, err
+	}
+	if err := approve(newSignReview(ceremonyID, pollResponse, tbs)); err != nil {
+		return CeremonyResult{}, err
+	}
+
+	certLine, err := SignWithCeremony(ctx, ceremonyID, host, identityFile, tbs)
+	if err != nil {
+		return CeremonyResult{}, err
+	}
+	return CeremonyResult{
+		CeremonyID: ceremonyID,
+		GroupID:    pollResponse.GroupID,
+		Status:     "complete",
+		Format:     SignatureFormatSSHCert,
+		Signature:  certLine,
+	}, nil
+}
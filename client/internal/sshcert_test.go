@@ -0,0 +1,92 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHCertificate(t *testing.T) {
+	caPub, caSecret, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	subject, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	cert, err := internal.NewSSHCertificate(subject, caPub, internal.SSHUserCert)
+	assert.NoError(t, err)
+	cert.KeyID = "alice@example.com"
+	cert.Serial = 42
+	cert.Principals = []string{"alice", "deploy"}
+	cert.ValidAfter, cert.ValidBefore, err = internal.ParseSSHValidity("-5m:+1h", now)
+	assert.NoError(t, err)
+	assert.NoError(t, cert.ApplyOption("no-pty"))
+	assert.NoError(t, cert.ApplyOption("force-command=/usr/bin/deploy"))
+	assert.Error(t, cert.ApplyOption("permit-everything"))
+
+	// What the signers see is what the proposer asked for
+	tbs := cert.SignedData()
+	parsed, err := internal.ParseSSHCertificate(tbs)
+	assert.NoError(t, err)
+	assert.Equal(t, tbs, parsed.SignedData())
+	assert.Equal(t, cert.Principals, parsed.Principals)
+	assert.Contains(t, parsed.Describe(), "force-command /usr/bin/deploy")
+	assert.NotContains(t, parsed.Describe(), "permit-pty")
+
+	// OpenSSH agrees it's a valid certificate
+	line := cert.Encode(ed25519.Sign(caSecret, tbs))
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	assert.NoError(t, err)
+	sshCert, ok := key.(*ssh.Certificate)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(42), sshCert.Serial)
+	assert.Equal(t, "/usr/bin/deploy", sshCert.CriticalOptions["force-command"])
+	assert.NotContains(t, sshCert.Extensions, "permit-pty")
+
+	caKey, err := ssh.NewPublicKey(caPub)
+	assert.NoError(t, err)
+	checker := ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(caKey.Marshal())
+		},
+		SupportedCriticalOptions: []string{"force-command"},
+	}
+	assert.NoError(t, checker.CheckCert("deploy", sshCert))
+	assert.Error(t, checker.CheckCert("root", sshCert))
+
+	// A signature from the wrong key doesn't pass
+	_, otherSecret, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	forged, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cert.Encode(ed25519.Sign(otherSecret, tbs))))
+	assert.NoError(t, err)
+	assert.Error(t, checker.CheckCert("deploy", forged.(*ssh.Certificate)))
+}
+
+func TestParseSSHValidity(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	from, to, err := internal.ParseSSHValidity("+1h30m", now)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(now.Unix()), from)
+	assert.Equal(t, uint64(now.Add(90*time.Minute).Unix()), to)
+
+	from, to, err = internal.ParseSSHValidity("always:forever", now)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), from)
+	assert.Equal(t, uint64(1<<64-1), to)
+
+	from, to, err = internal.ParseSSHValidity("20260101Z:20260201Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Unix()), from)
+	assert.Equal(t, uint64(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC).Unix()), to)
+
+	_, _, err = internal.ParseSSHValidity("+1h:-1h", now)
+	assert.Error(t, err)
+	_, _, err = internal.ParseSSHValidity("+1y", now)
+	assert.Error(t, err)
+}
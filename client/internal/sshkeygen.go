@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ssh-keygen -Y compatibility.
+//
+// git (and anything else that speaks SSHSIG) shells out to ssh-keygen with a fixed calling convention. These
+// implement the operations it uses, so the group key can be used anywhere an SSH signing key can.
+
+// Find the local share whose group key matches an OpenSSH public key file
+func findShareForSSHKey(keyFile string) (Shares, error) {
+	keyBytes, err := os.ReadFile(keyFile)
+	if err != nil {
+		return Shares{}, err
+	}
+	pubKey, err := ParseOpenSSHPublicKey(string(keyBytes))
+	if err != nil {
+		return Shares{}, fmt.Errorf("%s: %w", keyFile, err)
+	}
+	config, err := LoadUserConfig()
+	if err != nil {
+		return Shares{}, err
+	}
+	for _, s := range config.Shares {
+		if s.PublicKey == hex.EncodeToString(pubKey) {
+			return s, nil
+		}
+	}
+	return Shares{}, fmt.Errorf("no local share for key %s", SSHFingerprint(pubKey))
+}
+
+// Join the open ceremony for this message if somebody already started one, or start one ourselves
+func startOrJoinSSHCeremony(ctx context.Context, host, groupID, namespace string, message []byte) (string, error) {
+	hash := HashMessageForSanity(message, groupID)
+	list, err := DuctSignList(ctx, host, ListSignRequest{GroupID: groupID, Limit: 100})
+	if err != nil {
+		return "", err
+	}
+	for _, c := range list.Ceremonies {
+		if c.Active && c.Hash == hash && c.OpenSSH && c.OpenSSHNamespace == namespace {
+			return c.Uid, nil
+		}
+	}
+	// Leave the message with the coordinator, so the other holders don't need their own copy of it to join
+	res, err := DuctInitSignCeremony(ctx, host, InitSignRequest{
+		GroupID:     groupID,
+		MessageHash: hash,
+		Message:     hex.EncodeToString(message),
+		OpenSSH:     true,
+		Namespace:   namespace,
+		MyPartyID:   proposeAs(ctx, groupID),
+		Publish:     true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.CeremonyID, nil
+}
+
+// Sign a message with the group key, waiting for enough other holders to join
+func signSSHMessage(ctx context.Context, share Shares, identityFile, namespace string, message []byte) (string, error) {
+	ctx, cancel := CeremonyContext(ctx)
+	defer cancel()
+	ceremonyID, err := startOrJoinSSHCeremony(ctx, share.Host, share.GroupID, namespace, message)
+	if err != nil {
+		return "", err
+	}
+	// stdout may be where the signature goes, so keep this out of it
+	sessionFrom(ctx).warnf("Waiting for other signers. They can join with:\n\tfreeon sign join --fetch -h %s -c %s", share.Host, ceremonyID)
+	return SignWithCeremony(ctx, ceremonyID, share.Host, identityFile, message)
+}
+
+// ssh-keygen -Y sign -f <key> -n <namespace> [file ...]
+//
+// Each file is signed to file.sig. With no files, standard input is signed to standard output.
+func SSHKeygenSign(keyFile, namespace, identityFile string, files []string) {
+	if identityFile == "" {
+		Fail(UsageError(errors.New("set FREEON_IDENTITY to the age identity file that decrypts your share")))
+	}
+	share, err := findShareForSSHKey(keyFile)
+	if err != nil {
+		Fail(err)
+	}
+
+	ctx, stop := InterruptContext()
+	defer stop()
+	if len(files) == 0 {
+		message, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			Fail(err)
+		}
+		sig, err := signSSHMessage(ctx, share, identityFile, namespace, message)
+		if err != nil {
+			Fail(fmt.Errorf("signing failed: %w", err))
+		}
+		fmt.Print(sig)
+		os.Exit(ExitOK)
+	}
+	for _, file := range files {
+		message, err := os.ReadFile(file)
+		if err != nil {
+			Fail(err)
+		}
+		sig, err := signSSHMessage(ctx, share, identityFile, namespace, message)
+		if err != nil {
+			Fail(fmt.Errorf("signing %s failed: %w", file, err))
+		}
+		if err := os.WriteFile(file+".sig", []byte(sig), 0644); err != nil {
+			Fail(err)
+		}
+		sessionFrom(ctx).warnf("Write signature to %s.sig", file)
+	}
+	os.Exit(ExitOK)
+}
+
+// Read a signature file, and check it against standard input
+func readAndCheckSSHSignature(namespace, signatureFile string) (SSHSignature, error) {
+	armored, err := os.ReadFile(signatureFile)
+	if err != nil {
+		return SSHSignature{}, err
+	}
+	sig, err := OpenSSHDecode(armored)
+	if err != nil {
+		return SSHSignature{}, err
+	}
+	if sig.Namespace != namespace {
+		return SSHSignature{}, fmt.Errorf("signature namespace %q does not match %q", sig.Namespace, namespace)
+	}
+	message, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return SSHSignature{}, err
+	}
+	if err := sig.Verify(message); err != nil {
+		return SSHSignature{}, err
+	}
+	return sig, nil
+}
+
+// ssh-keygen -Y verify -f <allowed_signers> -I <principal> -n <namespace> -s <file>
+func SSHKeygenVerify(allowedSignersFile, principal, namespace, signatureFile string, verifyTime time.Time) {
+	sig, err := readAndCheckSSHSignature(namespace, signatureFile)
+	if err == nil {
+		err = checkAllowedSigner(allowedSignersFile, principal, namespace, sig.PublicKey, verifyTime)
+	}
+	if err != nil {
+		Fail(fmt.Errorf("%w\nCould not verify signature.", err))
+	}
+	fmt.Printf("Good %q signature for %s with ED25519 key %s\n", namespace, principal, SSHFingerprint(sig.PublicKey))
+	os.Exit(ExitOK)
+}
+
+func checkAllowedSigner(allowedSignersFile, principal, namespace string, pubKey []byte, verifyTime time.Time) error {
+	signers, err := ReadAllowedSigners(allowedSignersFile)
+	if err != nil {
+		return err
+	}
+	for _, s := range signers {
+		if s.Allows(principal, namespace, pubKey, verifyTime) {
+			return nil
+		}
+	}
+	return errors.New("key is not an allowed signer for this principal")
+}
+
+// ssh-keygen -Y check-novalidate -n <namespace> -s <file>
+//
+// Only checks the signature itself, not who made it.
+func SSHKeygenCheckNovalidate(namespace, signatureFile string) {
+	sig, err := readAndCheckSSHSignature(namespace, signatureFile)
+	if err != nil {
+		Fail(fmt.Errorf("%w\nCould not verify signature.", err))
+	}
+	fmt.Printf("Good %q signature with ED25519 key %s\n", namespace, SSHFingerprint(sig.PublicKey))
+	os.Exit(ExitOK)
+}
+
+// ssh-keygen -Y find-principals -f <allowed_signers> -s <file>
+func SSHKeygenFindPrincipals(allowedSignersFile, signatureFile string, verifyTime time.Time) {
+	armored, err := os.ReadFile(signatureFile)
+	if err != nil {
+		Fail(err)
+	}
+	sig, err := OpenSSHDecode(armored)
+	if err != nil {
+		Fail(err)
+	}
+	signers, err := ReadAllowedSigners(allowedSignersFile)
+	if err != nil {
+		Fail(err)
+	}
+	found := false
+	for _, s := range signers {
+		if bytes.Equal(s.PublicKey, sig.PublicKey) && s.ValidAt(verifyTime) {
+			fmt.Println(s.Principals)
+			found = true
+		}
+	}
+	if !found {
+		Fail(errors.New("No principal matched."))
+	}
+	os.Exit(ExitOK)
+}
+
+// ssh-keygen -l -f <key>
+func SSHKeygenFingerprint(keyFile string) {
+	keyBytes, err := os.ReadFile(keyFile)
+	if err != nil {
+		Fail(err)
+	}
+	pubKey, err := ParseOpenSSHPublicKey(string(keyBytes))
+	if err != nil {
+		Fail(fmt.Errorf("%s: %w", keyFile, err))
+	}
+	comment := "no comment"
+	if fields := strings.Fields(string(keyBytes)); len(fields) > 2 {
+		comment = strings.Join(fields[2:], " ")
+	}
+	fmt.Printf("256 %s %s (ED25519)\n", SSHFingerprint(pubKey), comment)
+	os.Exit(ExitOK)
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Nothing waits on the coordinator forever. Each request has a timeout, and so does each ceremony, from joining it to
+// getting the result; both can be set in the config, or with --request-timeout and --ceremony-timeout.
+//
+// Requests that only ask the coordinator something are retried, with a growing delay between tries, if they fail in a
+// way that might not last: a dropped connection, a timeout, or a coordinator that's restarting. Anything that changes
+// something is only ever sent once.
+
+const (
+	defaultRequestTimeout = 30 * time.Second
+	// Long enough for complex key ceremonies involving airgapped machines
+	defaultCeremonyTimeout = time.Hour
+)
+
+// How many times to try a request before giving up, and how long to wait before trying again. The wait doubles each
+// time, up to retryMaxDelay, and a random part of it is left off so clients that failed together don't retry together.
+const (
+	retryAttempts  = 5
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+)
+
+// Set how long to wait for the coordinator: for a zero argument, whatever the config says, or the default
+func (s *Session) ConfigureTimeouts(request, ceremony time.Duration) error {
+	requestTimeout, ceremonyTimeout := defaultRequestTimeout, defaultCeremonyTimeout
+	timeouts, err := configuredTimeouts()
+	if err != nil {
+		return err
+	}
+	if timeouts.Request != "" {
+		if requestTimeout, err = parseTimeout("request", timeouts.Request); err != nil {
+			return err
+		}
+	}
+	if timeouts.Ceremony != "" {
+		if ceremonyTimeout, err = parseTimeout("ceremony", timeouts.Ceremony); err != nil {
+			return err
+		}
+	}
+	if request > 0 {
+		requestTimeout = request
+	}
+	if ceremony > 0 {
+		ceremonyTimeout = ceremony
+	}
+	s.requestTimeout, s.ceremonyTimeout = requestTimeout, ceremonyTimeout
+	return nil
+}
+
+// Set how long the freeon command waits for the coordinator
+func ConfigureTimeouts(request, ceremony time.Duration) error {
+	return commandSession.ConfigureTimeouts(request, ceremony)
+}
+
+// The timeouts in the config, without creating one if there isn't one yet
+func configuredTimeouts() (Timeouts, error) {
+	configPath, err := getConfigFile()
+	if err != nil {
+		return Timeouts{}, err
+	}
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return Timeouts{}, nil
+	} else if err != nil {
+		return Timeouts{}, err
+	}
+	var config FreeonConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Timeouts{}, err
+	}
+	if config.Timeouts == nil {
+		return Timeouts{}, nil
+	}
+	return *config.Timeouts, nil
+}
+
+func parseTimeout(name, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s timeout in config: %q", name, value)
+	}
+	return d, nil
+}
+
+// A ceremony took longer than we were willing to wait
+type ceremonyTimedOutError struct {
+	after time.Duration
+}
+
+func (e ceremonyTimedOutError) Error() string {
+	return fmt.Sprintf("gave up on the ceremony after %s", e.after)
+}
+
+func (e ceremonyTimedOutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// A context for running one ceremony, which gives up once the ceremony timeout has passed
+func CeremonyContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ceremonyTimeout := sessionFrom(parent).ceremonyTimeout
+	return context.WithTimeoutCause(parent, ceremonyTimeout, ceremonyTimedOutError{ceremonyTimeout})
+}
+
+// Send a request, giving up if it takes longer than the request timeout. Reading the response counts, so the clock
+// only stops once the body is closed.
+func do(client *http.Client, req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), sessionFrom(req.Context()).requestTimeout)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		// Say why we stopped, rather than that the request was canceled
+		if req.Context().Err() != nil {
+			return nil, context.Cause(req.Context())
+		}
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// Send a request until it works, it fails in a way that will last, or we run out of tries
+func retry(ctx context.Context, send func() (*http.Response, error)) (*http.Response, error) {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := send()
+		// Offline, the relay answers for the coordinator, and it's never in a hurry
+		if attempt == retryAttempts || sessionFrom(ctx).offline != nil || ctx.Err() != nil || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		wait := delay/2 + rand.N(delay/2)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, context.Cause(ctx)
+		case <-timer.C:
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// Whether a request that failed might work if we tried again
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var opErr *net.OpError
+		var netErr net.Error
+		return errors.As(err, &opErr) ||
+			(errors.As(err, &netErr) && netErr.Timeout()) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
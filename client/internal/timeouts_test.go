@@ -0,0 +1,124 @@
+package internal_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// Put the timeouts back the way every other test expects them
+func resetTimeouts(t *testing.T) {
+	t.Cleanup(func() {
+		internal.ConfigureTimeouts(30*time.Second, time.Hour)
+	})
+}
+
+func TestConfigureTimeouts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("FREEON_HOME", home)
+	resetTimeouts(t)
+	remaining := func() time.Duration {
+		ctx, cancel := internal.CeremonyContext(context.Background())
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return time.Until(deadline)
+	}
+
+	// No config, no flags
+	assert.NoError(t, internal.ConfigureTimeouts(0, 0))
+	assert.InDelta(t, time.Hour, remaining(), float64(time.Minute))
+
+	config := internal.FreeonConfig{Timeouts: &internal.Timeouts{Request: "10s", Ceremony: "2h"}}
+	data, _ := json.Marshal(config)
+	assert.NoError(t, os.WriteFile(filepath.Join(home, ".freeon.json"), data, 0600))
+	assert.NoError(t, internal.ConfigureTimeouts(0, 0))
+	assert.InDelta(t, 2*time.Hour, remaining(), float64(time.Minute))
+
+	// Flags win
+	assert.NoError(t, internal.ConfigureTimeouts(0, 3*time.Hour))
+	assert.InDelta(t, 3*time.Hour, remaining(), float64(time.Minute))
+
+	config.Timeouts.Ceremony = "soon"
+	data, _ = json.Marshal(config)
+	assert.NoError(t, os.WriteFile(filepath.Join(home, ".freeon.json"), data, 0600))
+	assert.ErrorContains(t, internal.ConfigureTimeouts(0, 0), "invalid ceremony timeout")
+}
+
+func TestRetry(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+	var polls, creates atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sign/poll":
+			// The coordinator is restarting, then it isn't
+			if polls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			json.NewEncoder(w).Encode(internal.PollSignResponse{GroupID: "test-group", Threshold: 2})
+		case "/sign/create":
+			creates.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	resp, err := internal.DuctPollSignCeremony(context.Background(), server.URL, internal.PollSignRequest{CeremonyID: "test-ceremony"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test-group", resp.GroupID)
+	assert.Equal(t, int32(3), polls.Load())
+
+	// Creating a ceremony twice would make two ceremonies
+	_, err = internal.DuctInitSignCeremony(context.Background(), server.URL, internal.InitSignRequest{GroupID: "test-group"})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), creates.Load())
+
+	// Nothing is retried once we've given up
+	polls.Store(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = internal.DuctPollSignCeremony(ctx, server.URL, internal.PollSignRequest{CeremonyID: "test-ceremony"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, polls.Load())
+}
+
+func TestTimeouts(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+	resetTimeouts(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	// A request that takes too long gives up on its own
+	assert.NoError(t, internal.ConfigureTimeouts(50*time.Millisecond, 0))
+	start := time.Now()
+	_, err := internal.DuctInitSignCeremony(context.Background(), server.URL, internal.InitSignRequest{GroupID: "test-group"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	code, _ := internal.ClassifyError(err)
+	assert.Equal(t, internal.ErrorCodeNetwork, code)
+
+	// So does a ceremony, and it says so
+	assert.NoError(t, internal.ConfigureTimeouts(time.Minute, 50*time.Millisecond))
+	ctx, cancel := internal.CeremonyContext(context.Background())
+	defer cancel()
+	_, err = internal.DuctInitSignCeremony(ctx, server.URL, internal.InitSignRequest{GroupID: "test-group"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "gave up on the ceremony after 50ms")
+	code, _ = internal.ClassifyError(err)
+	assert.Equal(t, internal.ErrorCodeTimeout, code)
+}
@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Talking to coordinators over TLS.
+//
+// By default, a coordinator's certificate has to chain to a CA the system trusts. A coordinator with a self-signed
+// certificate can be pinned instead, by the hash of its public key or of the certificate itself, under "coordinators"
+// in ~/.freeon.json. Coordinators that ask for a client certificate get one for our identity key, which is the same
+// key that signs our requests: self-signed, or issued by the coordinator's client CA if we were given one.
+
+// Our TLS settings for a coordinator, without creating ~/.freeon.json if it isn't there
+func coordinatorSettings(host string) (CoordinatorTLS, bool) {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host = strings.TrimSuffix(host, "/")
+	configPath, err := getConfigFile()
+	if err != nil {
+		return CoordinatorTLS{}, false
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return CoordinatorTLS{}, false
+	}
+	var config FreeonConfig
+	if json.Unmarshal(data, &config) != nil {
+		return CoordinatorTLS{}, false
+	}
+	if settings, ok := config.Coordinators[host]; ok {
+		return settings, true
+	}
+	// Whoever wrote the config might have left off the default port
+	if h, port, err := net.SplitHostPort(host); err == nil && port == "443" {
+		settings, ok := config.Coordinators[h]
+		return settings, ok
+	}
+	return CoordinatorTLS{}, false
+}
+
+// How to connect to the coordinator at addr (hostname:port)
+func (s *Session) coordinatorTLSConfig(addr string, clientCerts bool) (*tls.Config, error) {
+	serverName, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		serverName = addr
+	}
+	config := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	settings, ok := coordinatorSettings(addr)
+	if !ok {
+		return config, nil
+	}
+
+	if settings.PinSPKI != "" || settings.PinCert != "" {
+		spkiPin, err := parsePin(settings.PinSPKI)
+		if err != nil {
+			return nil, fmt.Errorf("pin-spki for %s: %w", addr, err)
+		}
+		certPin, err := parsePin(settings.PinCert)
+		if err != nil {
+			return nil, fmt.Errorf("pin-cert for %s: %w", addr, err)
+		}
+		// The pin replaces the usual chain of trust, so self-signed certificates work
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("coordinator sent no certificate")
+			}
+			return checkPins(cs.PeerCertificates[0], spkiPin, certPin)
+		}
+	}
+	if clientCerts && settings.ClientCertFile != "" {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.issuedCertificate(settings.ClientCertFile)
+		}
+	} else if clientCerts && settings.ClientCert {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.identityCertificate()
+		}
+	}
+	return config, nil
+}
+
+// Pins are hex, but openssl likes to print them with colons
+func parsePin(pin string) ([]byte, error) {
+	if pin == "" {
+		return nil, nil
+	}
+	raw, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != sha256.Size {
+		return nil, errors.New("must be a SHA-256 hash")
+	}
+	return raw, nil
+}
+
+func checkPins(cert *x509.Certificate, spkiPin, certPin []byte) error {
+	if spkiPin != nil {
+		spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if subtle.ConstantTimeCompare(spki[:], spkiPin) != 1 {
+			return fmt.Errorf("coordinator's public key doesn't match its pin (SPKI hash %x)", spki)
+		}
+	}
+	if certPin != nil {
+		hash := sha256.Sum256(cert.Raw)
+		if subtle.ConstantTimeCompare(hash[:], certPin) != 1 {
+			return fmt.Errorf("coordinator's certificate doesn't match its pin (hash %x)", hash)
+		}
+	}
+	return nil
+}
+
+// A self-signed certificate for our identity key. Nobody checks who signed it; the coordinator only cares that the
+// key matches the one our requests are signed with.
+func (s *Session) identityCertificate() (*tls.Certificate, error) {
+	s.mu.Lock()
+	cert := s.clientCertificate
+	s.mu.Unlock()
+	if cert != nil {
+		return cert, nil
+	}
+	identityKey, err := s.identity()
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: identityCommonName(identityKey)},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, identityKey.Public(), identityKey)
+	if err != nil {
+		return nil, err
+	}
+	// If another connection beat us to it, either certificate will do
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientCertificate = &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  identityKey,
+	}
+	return s.clientCertificate, nil
+}
+
+// What our certificates say they're for
+func identityCommonName(identityKey ed25519.PrivateKey) string {
+	return "freeon " + hex.EncodeToString(identityKey.Public().(ed25519.PublicKey))
+}
+
+// A certificate for our identity key that somebody else issued, along with whatever chain came with it
+func (s *Session) issuedCertificate(certFile string) (*tls.Certificate, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	identityKey, err := s.identity()
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{PrivateKey: identityKey}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", certFile)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", certFile, err)
+	}
+	// The coordinator would turn it away anyway, but this is a lot easier to figure out
+	publicKey, ok := leaf.PublicKey.(ed25519.PublicKey)
+	if !ok || !publicKey.Equal(identityKey.Public()) {
+		return nil, fmt.Errorf("%s is not a certificate for our identity key", certFile)
+	}
+	cert.Leaf = leaf
+	return cert, nil
+}
+
+// A PEM-encoded certificate signing request for our identity key, for a coordinator's client CA to sign
+func IdentityCSR(ctx context.Context) (string, error) {
+	identityKey, err := sessionFrom(ctx).identity()
+	if err != nil {
+		return "", err
+	}
+	template := x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: identityCommonName(identityKey)},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, identityKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
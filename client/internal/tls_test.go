@@ -0,0 +1,121 @@
+package internal_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinnedCoordinator(t *testing.T) {
+	t.Setenv("FREEON_HOME", t.TempDir())
+	var presented ed25519.PublicKey
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented = nil
+		if len(r.TLS.PeerCertificates) > 0 {
+			presented, _ = r.TLS.PeerCertificates[0].PublicKey.(ed25519.PublicKey)
+		}
+		json.NewEncoder(w).Encode(internal.InitKeyGenResponse{GroupID: "g_test"})
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	// Settings only apply to new connections
+	server.Config.SetKeepAlivesEnabled(false)
+	server.StartTLS()
+	defer server.Close()
+	host := server.Listener.Addr().String()
+
+	trust := func(settings internal.CoordinatorTLS) {
+		config, err := internal.LoadUserConfig()
+		assert.NoError(t, err)
+		config.Coordinators = map[string]internal.CoordinatorTLS{host: settings}
+		assert.NoError(t, config.Save())
+	}
+	req := internal.InitKeyGenRequest{Participants: 2, Threshold: 2}
+
+	// httptest's CA isn't one the system trusts
+	_, err := internal.DuctInitKeyGenCeremony(context.Background(), "https://"+host, req)
+	assert.Error(t, err)
+
+	// With a pin, it doesn't have to be
+	spki := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+	trust(internal.CoordinatorTLS{PinSPKI: hex.EncodeToString(spki[:])})
+	res, err := internal.DuctInitKeyGenCeremony(context.Background(), host, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "g_test", res.GroupID)
+	assert.Nil(t, presented)
+
+	// The whole certificate can be pinned instead, in openssl's notation
+	cert := sha256.Sum256(server.Certificate().Raw)
+	var colons []string
+	for _, b := range cert {
+		colons = append(colons, strings.ToUpper(hex.EncodeToString([]byte{b})))
+	}
+	trust(internal.CoordinatorTLS{PinCert: strings.Join(colons, ":"), ClientCert: true})
+	_, err = internal.DuctInitKeyGenCeremony(context.Background(), host, req)
+	assert.NoError(t, err)
+	// We showed the coordinator our identity key
+	identity, err := internal.IdentityPublicKey(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, identity, hex.EncodeToString(presented))
+
+	// Or a certificate somebody else issued for it, from the request we'd give them
+	caPub, caKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	csrPEM, err := internal.IdentityCSR(context.Background())
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(csrPEM))
+	assert.NotNil(t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	assert.NoError(t, err)
+	assert.NoError(t, csr.CheckSignature())
+	issue := func(publicKey any) string {
+		template := x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      csr.Subject,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		ca := &x509.Certificate{Subject: pkix.Name{CommonName: "test CA"}, PublicKey: caPub}
+		der, err := x509.CreateCertificate(rand.Reader, &template, ca, publicKey, caKey)
+		assert.NoError(t, err)
+		certFile := filepath.Join(t.TempDir(), "client.pem")
+		assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+		return certFile
+	}
+	pin := hex.EncodeToString(spki[:])
+	trust(internal.CoordinatorTLS{PinSPKI: pin, ClientCertFile: issue(csr.PublicKey)})
+	_, err = internal.DuctInitKeyGenCeremony(context.Background(), host, req)
+	assert.NoError(t, err)
+	assert.Equal(t, identity, hex.EncodeToString(presented))
+	// A certificate for some other key is no good to us
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	trust(internal.CoordinatorTLS{PinSPKI: pin, ClientCertFile: issue(otherPub)})
+	_, err = internal.DuctInitKeyGenCeremony(context.Background(), host, req)
+	assert.ErrorContains(t, err, "not a certificate for our identity key")
+
+	trust(internal.CoordinatorTLS{PinSPKI: strings.Repeat("ab", 32)})
+	_, err = internal.DuctInitKeyGenCeremony(context.Background(), host, req)
+	assert.ErrorContains(t, err, "doesn't match its pin")
+	trust(internal.CoordinatorTLS{PinSPKI: "not a hash"})
+	_, err = internal.DuctInitKeyGenCeremony(context.Background(), host, req)
+	assert.Error(t, err)
+}
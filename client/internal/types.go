@@ -8,17 +8,55 @@ type Shares struct {
 	MyPartyID      uint16            `json:"my-party-id"`
 	EncryptedShare string            `json:"encrypted-share"`
 	PublicShares   map[string]string `json:"public-shares"`
+	// Bumped by every refresh. Only shares from the group's current epoch can sign.
+	Epoch uint64 `json:"epoch"`
+	// Every member's identity key, by party ID, as they were when we got this share. Refreshes and reshares are
+	// checked against these, rather than whatever the coordinator says at the time.
+	IdentityKeys map[uint16]string `json:"identity-keys,omitempty"`
 }
 
 // This may expand in future versions
 type FreeonConfig struct {
-	Shares []Shares `json:"shares"`
+	// Hex-encoded Ed25519 seed used to sign requests to the coordinator. It's kept in its own file now, and this is
+	// only read to move it there.
+	IdentityKey string   `json:"identity-key,omitempty"`
+	Shares      []Shares `json:"shares"`
+	// TLS settings for each coordinator, by hostname:port. Coordinators listed here are spoken to over HTTPS.
+	Coordinators map[string]CoordinatorTLS `json:"coordinators,omitempty"`
+	// What we're willing to sign, by group ID
+	Policies map[string]SigningPolicy `json:"policies,omitempty"`
+	// How long to wait for the coordinator. --request-timeout and --ceremony-timeout take precedence.
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
 }
 
-//------- Request/Response --------//
+// Durations, written the way Go writes them: "30s", "1h30m"
+type Timeouts struct {
+	// For one request, including reading the response
+	Request string `json:"request,omitempty"`
+	// For a whole ceremony, from joining it to getting the result
+	Ceremony string `json:"ceremony,omitempty"`
+}
+
+// How to trust a coordinator, and whether to show it who we are
+type CoordinatorTLS struct {
+	// Hex-encoded SHA-256 hash of the coordinator's SubjectPublicKeyInfo. If this or PinCert is set, a certificate
+	// that matches is trusted even if it's self-signed, and nothing else is.
+	PinSPKI string `json:"pin-spki,omitempty"`
+	// Hex-encoded SHA-256 hash of the coordinator's whole certificate
+	PinCert string `json:"pin-cert,omitempty"`
+	// Present a certificate for our identity key, if the coordinator asks for one
+	ClientCert bool `json:"client-cert,omitempty"`
+	// A PEM file with a certificate for our identity key, issued by the coordinator's client CA. It's presented
+	// instead of a self-signed one, for coordinators that won't take anything else.
+	ClientCertFile string `json:"client-cert-file,omitempty"`
+}
+
+// ------- Request/Response --------//
 type InitKeyGenRequest struct {
 	Participants uint16 `json:"n"`
 	Threshold    uint16 `json:"t"`
+	// Seconds until key generation expires; zero for the coordinator's default
+	Deadline int64 `json:"deadline,omitempty"`
 }
 type InitKeyGenResponse struct {
 	GroupID string `json:"group-id"`
@@ -34,18 +72,61 @@ type PollKeyGenResponse struct {
 	OtherParties []uint16 `json:"parties"`
 	Threshold    uint16   `json:"t"`
 	PartySize    uint16   `json:"n"`
+	Status       string   `json:"status"`
+	Verdict      *string  `json:"verdict,omitempty"`
+	Reports      uint16   `json:"reports"`
+	Reporters    []uint16 `json:"reporters"`
+	Confirmed    []uint16 `json:"confirmed"`
+	Epoch        uint64   `json:"epoch"`
+	// Seconds left before key generation expires
+	ExpiresIn *int64 `json:"expires-in,omitempty"`
+	// Each participant's identity key, by party ID
+	IdentityKeys map[uint16]string `json:"identity-keys,omitempty"`
 }
 
 type InitSignRequest struct {
 	GroupID     string `json:"group-id"`
 	MessageHash string `json:"hash"`
-	OpenSSH     bool   `json:"openssh"`
-	Namespace   string `json:"openssh-namespace"`
+	// Hex-encoded message, so the coordinator can check the final signature
+	Message   string `json:"message"`
+	OpenSSH   bool   `json:"openssh"`
+	Namespace string `json:"openssh-namespace"`
+	// Hex-encoded to-be-signed OpenSSH certificate, to issue a certificate instead of signing a message
+	SSHCertificate string `json:"ssh-certificate,omitempty"`
+	// Only these parties may sign, if any are given
+	Signers []uint16 `json:"signers,omitempty"`
+	// Seconds until the ceremony expires; zero for the coordinator's default
+	Deadline int64 `json:"deadline,omitempty"`
+	// Set when we propose as a member of the group, rather than with an API token
+	MyPartyID *uint16 `json:"party-id,omitempty"`
+	// Let signers download the message from the coordinator
+	Publish bool `json:"publish,omitempty"`
+	// Hex-encoded age ciphertext of the message, sealed to the group's members. Sent instead of Message.
+	SealedMessage string `json:"sealed-message,omitempty"`
 }
 type InitSignResponse struct {
 	CeremonyID string `json:"ceremony-id"`
 }
 
+type GetProposalRequest struct {
+	CeremonyID string `json:"ceremony-id"`
+}
+
+// The message a signing ceremony was asked to sign, if the proposer shared it.
+// Exactly one of Message and SealedMessage is set, both hex-encoded.
+type SignProposal struct {
+	Hash          string `json:"hash"`
+	Message       string `json:"message,omitempty"`
+	SealedMessage string `json:"sealed-message,omitempty"`
+	OpenSSH       bool   `json:"openssh"`
+	Namespace     string `json:"openssh-namespace,omitempty"`
+}
+
+type LeaveSignRequest struct {
+	CeremonyID string `json:"ceremony-id"`
+	MyPartyID  uint16 `json:"party-id"`
+}
+
 type PollSignRequest struct {
 	CeremonyID string  `json:"ceremony-id"`
 	PartyID    *uint16 `json:"party-id"`
@@ -55,10 +136,32 @@ type PollSignResponse struct {
 	MyPartyID    uint16   `json:"party-id"`
 	Threshold    uint16   `json:"t"`
 	OtherParties []uint16 `json:"parties"`
+	Epoch        uint64   `json:"epoch"`
+	// The to-be-signed certificate, hex-encoded, if this ceremony issues one
+	SSHCertificate string `json:"ssh-certificate,omitempty"`
+	// Exactly who signs, once enough parties have joined
+	Signers []uint16 `json:"signers"`
+	// If the requester chose who may sign
+	Preferred []uint16 `json:"preferred,omitempty"`
+	// "open", "complete", "expired", "disputed", or "closed"
+	Status string `json:"status"`
+	// Why the ceremony is disputed
+	Verdict *string `json:"verdict,omitempty"`
+	// Seconds left before the ceremony expires
+	ExpiresIn *int64 `json:"expires-in,omitempty"`
+	// Who created the ceremony, if the coordinator knows
+	Proposer  string `json:"proposer,omitempty"`
+	OpenSSH   bool   `json:"openssh"`
+	Namespace string `json:"openssh-namespace,omitempty"`
 }
 
 type JoinKeyGenRequest struct {
-	GroupID string `json:"group-id"`
+	GroupID   string `json:"group-id"`
+	PublicKey string `json:"public-key"`
+}
+type LeaveKeyGenRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
 }
 type JoinKeyGenResponse struct {
 	Status    bool   `json:"status"`
@@ -69,6 +172,7 @@ type JoinSignRequest struct {
 	CeremonyID  string `json:"ceremony-id"`
 	MessageHash string `json:"hash"`
 	MyPartyID   uint16 `json:"party-id"`
+	Epoch       uint64 `json:"epoch"`
 }
 type JoinSignResponse struct {
 	Status    bool   `json:"status"`
@@ -109,6 +213,142 @@ type SignMessageResponse struct {
 	Messages        []string `json:"messages"`
 }
 
+type KeygenComplaintRequest struct {
+	GroupID   string   `json:"group-id"`
+	MyPartyID uint16   `json:"party-id"`
+	Accused   []uint16 `json:"accused"`
+	Evidence  string   `json:"evidence,omitempty"`
+}
+
+type RefreshJoinRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Epoch     uint64 `json:"epoch"`
+}
+type RefreshJoinResponse struct {
+	RefreshID string `json:"refresh-id"`
+	Epoch     uint64 `json:"epoch"`
+}
+
+type PollRefreshRequest struct {
+	RefreshID string `json:"refresh-id"`
+}
+type PollRefreshResponse struct {
+	RefreshID string   `json:"refresh-id"`
+	GroupID   string   `json:"group-id"`
+	Epoch     uint64   `json:"epoch"`
+	Threshold uint16   `json:"t"`
+	PartySize uint16   `json:"n"`
+	Parties   []uint16 `json:"parties"`
+	Confirmed uint16   `json:"confirmed"`
+	Status    string   `json:"status"`
+	Verdict   *string  `json:"verdict,omitempty"`
+}
+
+type RefreshMessageRequest struct {
+	RefreshID string `json:"refresh-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Message   string `json:"message"`
+	LastSeen  int64  `json:"last-seen"`
+}
+type RefreshMessageResponse struct {
+	LatestMessageID int64    `json:"last-seen"`
+	Messages        []string `json:"messages"`
+}
+
+type RefreshConfirmRequest struct {
+	RefreshID string `json:"refresh-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Digest    string `json:"digest"`
+}
+
+type RefreshLeaveRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+}
+
+type RefreshAbortRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Reason    string `json:"reason"`
+}
+
+type InitReshareRequest struct {
+	GroupID      string `json:"group-id"`
+	MyPartyID    uint16 `json:"party-id"`
+	Participants uint16 `json:"n"`
+	Threshold    uint16 `json:"t"`
+	// Hex-encoded identity keys of the newcomers who may join to receive a share
+	Newcomers []string `json:"newcomers,omitempty"`
+}
+type InitReshareResponse struct {
+	ReshareID string `json:"reshare-id"`
+}
+
+type ReshareJoinRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	PublicKey string `json:"public-key,omitempty"`
+	Epoch     uint64 `json:"epoch"`
+	Receive   bool   `json:"receive"`
+}
+type ReshareJoinResponse struct {
+	ReshareID string `json:"reshare-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Epoch     uint64 `json:"epoch"`
+}
+
+type PollReshareRequest struct {
+	ReshareID string `json:"reshare-id"`
+}
+type PollReshareResponse struct {
+	ReshareID    string   `json:"reshare-id"`
+	GroupID      string   `json:"group-id"`
+	PublicKey    string   `json:"public-key"`
+	Epoch        uint64   `json:"epoch"`
+	OldThreshold uint16   `json:"old-t"`
+	Threshold    uint16   `json:"t"`
+	PartySize    uint16   `json:"n"`
+	Dealers      []uint16 `json:"dealers"`
+	Recipients   []uint16 `json:"recipients"`
+	// The identity keys of the newcomers the reshare was proposed for
+	Newcomers []string `json:"newcomers,omitempty"`
+	// Each dealer's and recipient's identity key, by party ID
+	IdentityKeys map[uint16]string `json:"identity-keys,omitempty"`
+	Locked       bool              `json:"locked"`
+	Confirmed    uint16            `json:"confirmed"`
+	Status       string            `json:"status"`
+	Verdict      *string           `json:"verdict,omitempty"`
+}
+
+type ReshareMessageRequest struct {
+	ReshareID string `json:"reshare-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Message   string `json:"message"`
+	LastSeen  int64  `json:"last-seen"`
+}
+type ReshareMessageResponse struct {
+	LatestMessageID int64    `json:"last-seen"`
+	Messages        []string `json:"messages"`
+}
+
+type ReshareConfirmRequest struct {
+	ReshareID string `json:"reshare-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Digest    string `json:"digest"`
+}
+
+type ReshareLeaveRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+}
+
+type ReshareAbortRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Reason    string `json:"reason"`
+}
+
 type KeygenFinalRequest struct {
 	GroupID   string `json:"group-id"`
 	MyPartyID uint16 `json:"party-id"`
@@ -127,10 +367,34 @@ type GetSignRequest struct {
 
 type GetSignResponse struct {
 	Signature string `json:"signature"`
+	// The message was sealed, so the coordinator couldn't check the signature
+	Unverified bool          `json:"unverified,omitempty"`
+	Blame      []FreeonBlame `json:"blame,omitempty"`
+}
+
+type BlameRequest struct {
+	CeremonyID string   `json:"ceremony-id"`
+	MyPartyID  uint16   `json:"party-id"`
+	Accused    []uint16 `json:"accused"`
+	Reason     string   `json:"reason"`
 }
 
+// Who reported whom for aborting a signing ceremony
+type FreeonBlame struct {
+	Reporter uint16 `json:"reporter"`
+	Accused  uint16 `json:"accused"`
+	Reason   string `json:"reason"`
+}
+
+// Administrators send these as a member, or with an API token and no party ID
 type TerminateRequest struct {
 	CeremonyID string `json:"ceremony-id"`
+	MyPartyID  uint16 `json:"party-id,omitempty"`
+}
+
+type ArchiveRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id,omitempty"`
 }
 
 type ResponseErrorPage struct {
@@ -148,6 +412,10 @@ type FreeonCeremonySummary struct {
 	Signature        *string
 	OpenSSH          bool
 	OpenSSHNamespace string
+	SSHCertificate   bool
+	Expired          bool
+	Blame            []FreeonBlame
+	Verdict          *string
 }
 type ListSignRequest struct {
 	GroupID string `json:"group-id"`
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Exit statuses for freeon verify. Anything that keeps a signature from being checked at all is VerifyError.
+const (
+	VerifyGood  = ExitOK
+	VerifyBad   = ExitFailure
+	VerifyError = ExitUsage
+)
+
+// What freeon verify prints about a good signature
+type VerifyResult struct {
+	Valid  bool   `json:"valid"`
+	Format string `json:"format"`
+	// The signer's key, as a SHA256 fingerprint and hex-encoded
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"public-key"`
+	// The principals the key is trusted for, from an allowed_signers file
+	Principals string `json:"principals,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	// The certificate's key ID, for ssh-cert
+	KeyID string `json:"key-id,omitempty"`
+}
+
+// The signature didn't check out, as opposed to us being unable to check it
+var ErrBadSignature = errors.New("bad signature")
+
+// Signature formats the client emits
+const (
+	SignatureFormatRaw     = "raw"
+	SignatureFormatSSHSIG  = "sshsig"
+	SignatureFormatSSHCert = "ssh-cert"
+)
+
+// A signature in any of the formats we emit
+type AnySignature struct {
+	Format string
+	// Raw R || z, for the raw format and certificates
+	Raw    []byte
+	SSHSIG SSHSignature
+	// Certificates carry the data they sign
+	Certificate    SSHCertificate
+	CertSignedData []byte
+}
+
+// Figure out which format a signature is in, and parse it
+func ParseAnySignature(data []byte) (AnySignature, error) {
+	text := strings.TrimSpace(string(data))
+	switch {
+	case strings.HasPrefix(text, sshsigBegin):
+		sig, err := OpenSSHDecode(data)
+		if err != nil {
+			return AnySignature{}, err
+		}
+		return AnySignature{Format: SignatureFormatSSHSIG, SSHSIG: sig}, nil
+	case strings.HasPrefix(text, sshCertType+" "):
+		cert, tbs, raw, err := ParseSignedSSHCertificate(text)
+		if err != nil {
+			return AnySignature{}, err
+		}
+		return AnySignature{Format: SignatureFormatSSHCert, Raw: raw, Certificate: cert, CertSignedData: tbs}, nil
+	}
+	raw, err := hex.DecodeString(text)
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return AnySignature{}, errors.New("unrecognized signature format")
+	}
+	return AnySignature{Format: SignatureFormatRaw, Raw: raw}, nil
+}
+
+// Does the signature need the message? Certificates don't.
+func (s AnySignature) NeedsMessage() bool {
+	return s.Format != SignatureFormatSSHCert
+}
+
+// Check a signature against a set of trusted keys, returning the one that made it.
+//
+// Trusted keys use the allowed_signers rules, so they can be limited to some principals, namespaces, or a validity
+// window. An empty principal matches any key. Namespaces only apply to SSHSIG signatures. Failures that come down to
+// the signature are wrapped in ErrBadSignature.
+func CheckSignature(sig AnySignature, message []byte, namespace, principal string, trusted []AllowedSigner, at time.Time) (AllowedSigner, error) {
+	candidates := func(pubKey []byte, namespace string) []AllowedSigner {
+		var found []AllowedSigner
+		for _, t := range trusted {
+			if pubKey != nil && !bytes.Equal(t.PublicKey, pubKey) {
+				continue
+			}
+			if !t.ValidAt(at) || (principal != "" && !MatchPatternList(principal, t.Principals)) {
+				continue
+			}
+			if namespace != "" && t.Namespaces != "" && !MatchPatternList(namespace, t.Namespaces) {
+				continue
+			}
+			found = append(found, t)
+		}
+		return found
+	}
+
+	switch sig.Format {
+	case SignatureFormatRaw:
+		for _, t := range candidates(nil, "") {
+			if ed25519.Verify(t.PublicKey, message, sig.Raw) {
+				return t, nil
+			}
+		}
+		return AllowedSigner{}, fmt.Errorf("%w: not made by a trusted key", ErrBadSignature)
+	case SignatureFormatSSHSIG:
+		if sig.SSHSIG.Namespace != namespace {
+			return AllowedSigner{}, fmt.Errorf("%w: namespace is %q, not %q", ErrBadSignature, sig.SSHSIG.Namespace, namespace)
+		}
+		if err := sig.SSHSIG.Verify(message); err != nil {
+			return AllowedSigner{}, fmt.Errorf("%w: %s", ErrBadSignature, err.Error())
+		}
+		found := candidates(sig.SSHSIG.PublicKey, namespace)
+		if len(found) == 0 {
+			return AllowedSigner{}, fmt.Errorf("%w: key %s is not trusted", ErrBadSignature, SSHFingerprint(sig.SSHSIG.PublicKey))
+		}
+		return found[0], nil
+	case SignatureFormatSSHCert:
+		if !ed25519.Verify(sig.Certificate.SignatureKey, sig.CertSignedData, sig.Raw) {
+			return AllowedSigner{}, fmt.Errorf("%w: certificate signature verification failed", ErrBadSignature)
+		}
+		found := candidates(sig.Certificate.SignatureKey, "")
+		if len(found) == 0 {
+			return AllowedSigner{}, fmt.Errorf("%w: CA key %s is not trusted", ErrBadSignature, SSHFingerprint(sig.Certificate.SignatureKey))
+		}
+		return found[0], nil
+	}
+	return AllowedSigner{}, fmt.Errorf("unknown signature format: %s", sig.Format)
+}
+
+// Where freeon verify gets its trusted keys from. Exactly one should be set.
+type VerifyKeySource struct {
+	GroupID            string
+	PublicKey          string
+	AllowedSignersFile string
+}
+
+func (k VerifyKeySource) load() ([]AllowedSigner, error) {
+	switch {
+	case k.GroupID != "":
+		config, err := LoadUserConfig()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range config.Shares {
+			if s.GroupID == k.GroupID {
+				pubKey, err := hex.DecodeString(s.PublicKey)
+				if err != nil {
+					return nil, err
+				}
+				return []AllowedSigner{{Principals: s.GroupID, PublicKey: pubKey}}, nil
+			}
+		}
+		return nil, fmt.Errorf("no local share for group %s", k.GroupID)
+	case k.PublicKey != "":
+		var pubKey []byte
+		var err error
+		if strings.HasPrefix(k.PublicKey, "ssh-ed25519 ") {
+			pubKey, err = ParseOpenSSHPublicKey(k.PublicKey)
+		} else {
+			pubKey, err = hex.DecodeString(k.PublicKey)
+			if err == nil && len(pubKey) != ed25519.PublicKeySize {
+				err = errors.New("public key must be 32 bytes")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []AllowedSigner{{PublicKey: pubKey}}, nil
+	case k.AllowedSignersFile != "":
+		return ReadAllowedSigners(k.AllowedSignersFile)
+	}
+	return nil, errors.New("no key to verify against")
+}
+
+// Verify a signature in any format, and exit with VerifyGood, VerifyBad, or VerifyError
+func Verify(signature, message []byte, keys VerifyKeySource, namespace, principal string) {
+	sig, err := ParseAnySignature(signature)
+	if err != nil {
+		Fail(CommandError{Exit: VerifyError, Err: err})
+	}
+	if sig.NeedsMessage() && message == nil {
+		Fail(UsageError(fmt.Errorf("a message is required to verify a %s signature", sig.Format)))
+	}
+	trusted, err := keys.load()
+	if err != nil {
+		Fail(CommandError{Exit: VerifyError, Err: err})
+	}
+
+	signer, err := CheckSignature(sig, message, namespace, principal, trusted, time.Now())
+	if errors.Is(err, ErrBadSignature) {
+		Fail(CommandError{Exit: VerifyBad, Err: err})
+	} else if err != nil {
+		Fail(CommandError{Exit: VerifyError, Err: err})
+	}
+
+	var what string
+	result := VerifyResult{
+		Valid:       true,
+		Format:      sig.Format,
+		Fingerprint: SSHFingerprint(signer.PublicKey),
+		PublicKey:   hex.EncodeToString(signer.PublicKey),
+		Principals:  signer.Principals,
+	}
+	switch sig.Format {
+	case SignatureFormatRaw:
+		what = "Good signature"
+	case SignatureFormatSSHSIG:
+		what = fmt.Sprintf("Good %q signature", namespace)
+		result.Namespace = namespace
+	case SignatureFormatSSHCert:
+		what = fmt.Sprintf("Good certificate %q", sig.Certificate.KeyID)
+		result.KeyID = sig.Certificate.KeyID
+	}
+	if signer.Principals != "" {
+		what += " for " + signer.Principals
+	}
+	Succeed(fmt.Sprintf("%s with ED25519 key %s\n", what, result.Fingerprint), result)
+}
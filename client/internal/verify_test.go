@@ -0,0 +1,70 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/client/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSignature(t *testing.T) {
+	pub, secret, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	trusted := []internal.AllowedSigner{{Principals: "release@example.com", PublicKey: pub}}
+	untrusted := []internal.AllowedSigner{{PublicKey: otherPub}}
+	message := []byte("release v1.2.3")
+	now := time.Now()
+
+	// Raw R || z
+	raw, err := internal.ParseAnySignature([]byte(hex.EncodeToString(ed25519.Sign(secret, message)) + "\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, internal.SignatureFormatRaw, raw.Format)
+	signer, err := internal.CheckSignature(raw, message, "", "", trusted, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "release@example.com", signer.Principals)
+	_, err = internal.CheckSignature(raw, []byte("tampered"), "", "", trusted, now)
+	assert.ErrorIs(t, err, internal.ErrBadSignature)
+	_, err = internal.CheckSignature(raw, message, "", "", untrusted, now)
+	assert.ErrorIs(t, err, internal.ErrBadSignature)
+	_, err = internal.CheckSignature(raw, message, "", "someone@example.com", trusted, now)
+	assert.ErrorIs(t, err, internal.ErrBadSignature)
+
+	// SSHSIG
+	armored := internal.OpenSSHEncode(pub, ed25519.Sign(secret, internal.SSHSIGSignedData("git", message)), "git")
+	sshsig, err := internal.ParseAnySignature([]byte(armored))
+	assert.NoError(t, err)
+	assert.Equal(t, internal.SignatureFormatSSHSIG, sshsig.Format)
+	_, err = internal.CheckSignature(sshsig, message, "git", "release@example.com", trusted, now)
+	assert.NoError(t, err)
+	_, err = internal.CheckSignature(sshsig, message, "file", "", trusted, now)
+	assert.ErrorIs(t, err, internal.ErrBadSignature)
+	_, err = internal.CheckSignature(sshsig, message, "git", "", untrusted, now)
+	assert.ErrorIs(t, err, internal.ErrBadSignature)
+
+	// Certificates don't need the message
+	cert, err := internal.NewSSHCertificate(otherPub, pub, internal.SSHUserCert)
+	assert.NoError(t, err)
+	cert.KeyID = "alice"
+	cert.Principals = []string{"alice"}
+	line := cert.Encode(ed25519.Sign(secret, cert.SignedData()))
+	sshcert, err := internal.ParseAnySignature([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, internal.SignatureFormatSSHCert, sshcert.Format)
+	assert.False(t, sshcert.NeedsMessage())
+	_, err = internal.CheckSignature(sshcert, nil, "", "", trusted, now)
+	assert.NoError(t, err)
+	_, err = internal.CheckSignature(sshcert, nil, "", "", untrusted, now)
+	assert.ErrorIs(t, err, internal.ErrBadSignature)
+
+	// Not a signature at all
+	_, err = internal.ParseAnySignature([]byte("hello"))
+	assert.Error(t, err)
+	_, err = internal.ParseAnySignature([]byte(hex.EncodeToString(message)))
+	assert.Error(t, err)
+}
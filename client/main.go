@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/soatok/freeon/client/internal"
 )
@@ -14,13 +18,55 @@ import (
 func main() {
 	flag.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
 
-	if len(os.Args) == 1 {
-		flag.Usage()
-		os.Exit(1)
+	// Installed as (or symlinked to) freeon-ssh-keygen, we answer to ssh-keygen's calling convention, so tools like git
+	// can be pointed straight at us
+	if strings.HasPrefix(filepath.Base(os.Args[0]), "freeon-ssh-keygen") {
+		FreeonSSHKeygen(os.Args[1:])
 	}
 
 	args := os.Args[1:]
 
+	// Options for every command come before the command
+	outputFormat := internal.OutputFormatFromEnvironment()
+	var requestTimeout, ceremonyTimeout string
+	for len(args) > 0 {
+		var value *string
+		name, given, hasValue := strings.Cut(args[0], "=")
+		switch name {
+		case "--output", "-o":
+			value = &outputFormat
+		case "--request-timeout":
+			value = &requestTimeout
+		case "--ceremony-timeout":
+			value = &ceremonyTimeout
+		}
+		if value == nil {
+			break
+		}
+		if hasValue {
+			args = args[1:]
+		} else if len(args) < 2 {
+			usageError(flag.Usage, "%s requires an argument", name)
+		} else {
+			given = args[1]
+			args = args[2:]
+		}
+		*value = given
+	}
+	if outputFormat != "" {
+		if err := internal.SetOutputFormat(outputFormat); err != nil {
+			internal.Fail(err)
+		}
+	}
+	if err := internal.ConfigureTimeouts(parseTimeout("--request-timeout", requestTimeout), parseTimeout("--ceremony-timeout", ceremonyTimeout)); err != nil {
+		internal.Fail(err)
+	}
+
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(internal.ExitUsage)
+	}
+
 	// This is where commands are processed.
 	// Note that the first verb after `freeon` is case insensitive.
 	command := strings.ToLower(args[0])
@@ -28,9 +74,7 @@ func main() {
 	switch command {
 	case "keygen":
 		if len(subArgs) == 0 {
-			fmt.Fprintf(os.Stderr, "Error: keygen requires a subcommand\n\n")
-			fmt.Fprintf(os.Stderr, "%s\n", keygenUsage)
-			os.Exit(1)
+			usageError(printUsage("\n"+keygenUsage), "keygen requires a subcommand")
 		}
 
 		subcommand := subArgs[0]
@@ -41,17 +85,17 @@ func main() {
 			FreeonKeygenJoin(subArgs[1:])
 		case "list":
 			FreeonKeygenList(subArgs[1:])
+		case "refresh":
+			FreeonKeygenRefresh(subArgs[1:])
+		case "reshare":
+			FreeonKeygenReshare(subArgs[1:])
 		default:
-			fmt.Fprintf(os.Stderr, "Error: unknown keygen subcommand: %s\n\n", subcommand)
-			fmt.Fprintf(os.Stderr, "%s\n", keygenUsage)
-			os.Exit(1)
+			usageError(printUsage("\n"+keygenUsage), "unknown keygen subcommand: %s", subcommand)
 		}
 
 	case "sign":
 		if len(subArgs) == 0 {
-			fmt.Fprintf(os.Stderr, "Error: sign requires a subcommand\n\n")
-			fmt.Fprintf(os.Stderr, "%s\n", signUsage)
-			os.Exit(1)
+			usageError(printUsage("\n"+signUsage), "sign requires a subcommand")
 		}
 
 		subcommand := subArgs[0]
@@ -64,15 +108,36 @@ func main() {
 			FreeonSignJoin(subArgs[1:])
 		case "get":
 			FreeonSignGet(subArgs[1:])
+		case "ssh-cert":
+			FreeonSignSSHCert(subArgs[1:])
 		default:
-			fmt.Fprintf(os.Stderr, "Error: unknown sign subcommand: %s\n\n", subcommand)
-			fmt.Fprintf(os.Stderr, "%s\n", signUsage)
-			os.Exit(1)
+			usageError(printUsage("\n"+signUsage), "unknown sign subcommand: %s", subcommand)
 		}
 
 	case "terminate":
 		FreeonTerminate(subArgs)
 
+	case "archive":
+		FreeonArchive(subArgs)
+
+	case "ssh-keygen":
+		FreeonSSHKeygen(subArgs)
+
+	case "agent":
+		FreeonAgent(subArgs)
+
+	case "verify":
+		FreeonVerify(subArgs)
+
+	case "resume":
+		FreeonResume(subArgs)
+
+	case "relay":
+		FreeonRelay(subArgs)
+
+	case "identity":
+		FreeonIdentity(subArgs)
+
 	case "help":
 		if len(subArgs) == 0 {
 			flag.Usage()
@@ -85,17 +150,56 @@ func main() {
 				fmt.Fprintf(os.Stderr, "%s\n", signUsage)
 			case "terminate":
 				fmt.Fprintf(os.Stderr, "%s\n", terminateUsage)
+			case "archive":
+				fmt.Fprintf(os.Stderr, "%s\n", archiveUsage)
+			case "ssh-keygen":
+				fmt.Fprintf(os.Stderr, "%s\n", sshKeygenUsage)
+			case "agent":
+				fmt.Fprintf(os.Stderr, "%s\n", agentUsage)
+			case "verify":
+				fmt.Fprintf(os.Stderr, "%s\n", verifyUsage)
+			case "resume":
+				fmt.Fprintf(os.Stderr, "%s\n", resumeUsage)
+			case "relay":
+				fmt.Fprintf(os.Stderr, "%s\n", relayUsage)
+			case "identity":
+				fmt.Fprintf(os.Stderr, "%s\n", identityUsage)
 			default:
-				fmt.Fprintf(os.Stderr, "No help available for: %s\n", subArgs[0])
-				os.Exit(1)
+				usageError(nil, "no help available for: %s", subArgs[0])
 			}
 		}
 
 	default:
-		fmt.Fprintf(os.Stderr, "Error: unknown command: %s\n\n", command)
-		flag.Usage()
-		os.Exit(1)
+		usageError(printUsage("\n"+usage), "unknown command: %s", command)
+	}
+}
+
+// Complain about the command line, show how it should have looked, and exit with internal.ExitUsage.
+// With --output json, there's only the complaint.
+func usageError(usage func(), format string, args ...any) {
+	err := internal.UsageError(fmt.Errorf(format, args...))
+	if usage == nil || internal.OutputJSON() {
+		internal.Fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+	usage()
+	os.Exit(internal.ExitUsage)
+}
+
+// A duration from the command line, or zero if there wasn't one
+func parseTimeout(name, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		usageError(flag.Usage, "%s takes a duration, like 30s or 1h", name)
 	}
+	return d
+}
+
+func printUsage(text string) func() {
+	return func() { fmt.Fprintf(os.Stderr, "%s\n", text) }
 }
 
 // Handle file inputs for shell scripting arguments.
@@ -136,6 +240,7 @@ func FreeonKeygenCreate(args []string) {
 	thresholdLong := fs.Int("threshold", 0, "Minimum shares required for signing")
 	recipient := fs.String("r", "", "Age/SSH public key to encrypt share")
 	recipientLong := fs.String("recipient", "", "Age/SSH public key to encrypt share")
+	deadline := fs.Duration("deadline", 0, "How long key generation may take (default: the coordinator's)")
 	fs.Parse(args)
 
 	// Merge short/long flags
@@ -154,32 +259,27 @@ func FreeonKeygenCreate(args []string) {
 
 	// Validate required flags
 	if *host == "" {
-		fmt.Fprintf(os.Stderr, "Error: -h/--host is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-h/--host is required")
 	}
 	if *participants == 0 {
-		fmt.Fprintf(os.Stderr, "Error: -n/--participants is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-n/--participants is required")
 	}
 	if *threshold == 0 {
-		fmt.Fprintf(os.Stderr, "Error: -t/--threshold is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-t/--threshold is required")
 	}
 	if *participants < 2 || *participants > 255 {
-		fmt.Fprintf(os.Stderr, "Error: participants must be between 2 and 255\n")
-		os.Exit(1)
+		usageError(nil, "participants must be between 2 and 255")
 	}
 	if *threshold > *participants {
-		fmt.Fprintf(os.Stderr, "Error: threshold cannot exceed participants\n")
-		os.Exit(1)
+		usageError(nil, "threshold cannot exceed participants")
+	}
+	if *deadline < 0 {
+		usageError(nil, "--deadline must be positive")
 	}
 
 	// Now that we have a configuration, let's initialize the ceremony
 	// The actual logic is implemented here:
-	internal.InitKeyGenCeremony(*host, uint16(*participants), uint16(*threshold))
+	internal.InitKeyGenCeremony(*host, uint16(*participants), uint16(*threshold), *deadline)
 }
 
 // CMD: `freeon keygen join ...`
@@ -193,6 +293,13 @@ func FreeonKeygenJoin(args []string) {
 	groupIDLong := fs.String("group", "", "Group ID from ceremony creator")
 	recipient := fs.String("r", "", "Age/SSH public key to encrypt share")
 	recipientLong := fs.String("recipient", "", "Age/SSH public key to encrypt share")
+	identity := fs.String("i", "", "Path to age secret keys file")
+	identityLong := fs.String("identity", "", "Path to age secret keys file")
+	offline := fs.Bool("offline", false, "Exchange messages through bundle files instead of the network")
+	inbound := fs.String("inbound", "freeon-inbound.json", "Bundle file to read from (with --offline)")
+	outbound := fs.String("outbound", "freeon-outbound.json", "Bundle file to write to (with --offline)")
+	var members stringList
+	fs.Var(&members, "member", "Identity key of another member of the group (may be repeated)")
 	fs.Parse(args)
 
 	// Merge short/long flags
@@ -205,32 +312,169 @@ func FreeonKeygenJoin(args []string) {
 	if *recipientLong != "" {
 		*recipient = *recipientLong
 	}
+	if *identityLong != "" {
+		*identity = *identityLong
+	}
 
 	// Data validation
-	if *host == "" {
-		fmt.Fprintf(os.Stderr, "Error: -h/--host is required\n")
-		fs.Usage()
-		os.Exit(1)
+	if *host == "" && !*offline {
+		usageError(fs.Usage, "-h/--host is required")
 	}
 	if *groupID == "" {
-		fmt.Fprintf(os.Stderr, "Error: -g/--group is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-g/--group is required")
 	}
 	if *recipient == "" {
-		fmt.Fprintf(os.Stderr, "Error: -r/--recipient is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-r/--recipient is required")
+	}
+
+	if *offline {
+		// Every trip to the relay after the first resumes the ceremony, which takes our identity
+		if *identity == "" {
+			usageError(fs.Usage, "-i/--identity is required with --offline")
+		}
+		if err := internal.GoOffline(internal.JournalKeygen, *groupID, *inbound, *outbound); err != nil {
+			internal.Fail(err)
+		}
+		if internal.HasJournal(*groupID) {
+			internal.ResumeCeremony(*groupID, *identity)
+		}
 	}
 
 	// The actual logic is implemented here:
-	internal.JoinKeyGenCeremony(*host, *groupID, *recipient)
+	internal.JoinKeyGenCeremony(*host, *groupID, *recipient, members)
 }
 
 // CMD: `freeon keygen list ...`
 func FreeonKeygenList(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("keygen list", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", keygenListUsage) }
+	openssh := fs.Bool("openssh", false, "Print group public keys in OpenSSH format")
+	fs.Parse(args)
+
 	// The actual logic is implemented here:
-	internal.ListKeyGen()
+	internal.ListKeyGen(*openssh)
+}
+
+// CMD: `freeon keygen refresh ...`
+func FreeonKeygenRefresh(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("keygen refresh", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", keygenRefreshUsage) }
+	host := fs.String("h", "", "Coordinator hostname:port")
+	hostLong := fs.String("host", "", "Coordinator hostname:port")
+	groupID := fs.String("g", "", "Group ID from DKG ceremony")
+	groupIDLong := fs.String("group", "", "Group ID from DKG ceremony")
+	identity := fs.String("i", "", "Path to age secret keys file")
+	identityLong := fs.String("identity", "", "Path to age secret keys file")
+	recipient := fs.String("r", "", "Age/SSH public key to encrypt the new share")
+	recipientLong := fs.String("recipient", "", "Age/SSH public key to encrypt the new share")
+	abort := fs.Bool("abort", false, "Abort the refresh in progress")
+	fs.Parse(args)
+
+	// Merge short/long flags
+	if *hostLong != "" {
+		*host = *hostLong
+	}
+	if *groupIDLong != "" {
+		*groupID = *groupIDLong
+	}
+	if *identityLong != "" {
+		*identity = *identityLong
+	}
+	if *recipientLong != "" {
+		*recipient = *recipientLong
+	}
+
+	// Data validation
+	if *host == "" {
+		usageError(fs.Usage, "-h/--host is required")
+	}
+	if *groupID == "" {
+		usageError(fs.Usage, "-g/--group is required")
+	}
+	if *abort {
+		internal.AbortRefresh(*host, *groupID)
+	}
+	if *identity == "" {
+		usageError(fs.Usage, "-i/--identity is required")
+	}
+	if *recipient == "" {
+		usageError(fs.Usage, "-r/--recipient is required")
+	}
+
+	// The actual logic is implemented here:
+	internal.RefreshKeyGroup(*host, *groupID, *identity, *recipient)
+}
+
+// CMD: `freeon keygen reshare ...`
+func FreeonKeygenReshare(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("keygen reshare", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", keygenReshareUsage) }
+	host := fs.String("h", "", "Coordinator hostname:port")
+	hostLong := fs.String("host", "", "Coordinator hostname:port")
+	groupID := fs.String("g", "", "Group ID from DKG ceremony")
+	groupIDLong := fs.String("group", "", "Group ID from DKG ceremony")
+	identity := fs.String("i", "", "Path to age secret keys file")
+	identityLong := fs.String("identity", "", "Path to age secret keys file")
+	recipient := fs.String("r", "", "Age/SSH public key to encrypt the new share")
+	recipientLong := fs.String("recipient", "", "Age/SSH public key to encrypt the new share")
+	participants := fs.Uint("n", 0, "Propose a reshare with this many participants")
+	participantsLong := fs.Uint("participants", 0, "Propose a reshare with this many participants")
+	threshold := fs.Uint("t", 0, "Threshold for the proposed reshare")
+	thresholdLong := fs.Uint("threshold", 0, "Threshold for the proposed reshare")
+	var newcomers stringList
+	fs.Var(&newcomers, "newcomer", "Identity key of a newcomer to the group (may be repeated)")
+	leave := fs.Bool("leave", false, "Deal your share, but leave the group")
+	abort := fs.Bool("abort", false, "Abort the reshare in progress")
+	fs.Parse(args)
+
+	// Merge short/long flags
+	if *hostLong != "" {
+		*host = *hostLong
+	}
+	if *groupIDLong != "" {
+		*groupID = *groupIDLong
+	}
+	if *identityLong != "" {
+		*identity = *identityLong
+	}
+	if *recipientLong != "" {
+		*recipient = *recipientLong
+	}
+	if *participantsLong != 0 {
+		*participants = *participantsLong
+	}
+	if *thresholdLong != 0 {
+		*threshold = *thresholdLong
+	}
+
+	// Data validation
+	if *host == "" {
+		usageError(fs.Usage, "-h/--host is required")
+	}
+	if *groupID == "" {
+		usageError(fs.Usage, "-g/--group is required")
+	}
+	if *abort {
+		internal.AbortReshare(*host, *groupID)
+	}
+	if (*participants == 0) != (*threshold == 0) {
+		usageError(fs.Usage, "-n/--participants and -t/--threshold must be given together")
+	}
+	if *participants > 255 {
+		usageError(nil, "participants must be between 1 and 255")
+	}
+	if *threshold > *participants {
+		usageError(nil, "threshold cannot exceed participants")
+	}
+	if *recipient == "" && !*leave {
+		usageError(fs.Usage, "-r/--recipient is required unless you are leaving the group")
+	}
+
+	// The actual logic is implemented here:
+	internal.ReshareKeyGroup(*host, *groupID, *identity, *recipient, uint16(*participants), uint16(*threshold), newcomers, *leave)
 }
 
 // CMD: `freeon sign create ...`
@@ -244,6 +488,11 @@ func FreeonSignCreate(args []string) {
 	hostLong := fs.String("host", "", "Coordinator hostname:port")
 	openssh := fs.Bool("openssh", false, "Return OpenSSH-compatible signature format")
 	namespace := fs.String("namespace", "", `Specify a namespace for OpenSSH (default: "file")`)
+	signerList := fs.String("signers", "", "Comma-separated party IDs that may sign")
+	deadline := fs.Duration("deadline", 0, "How long the ceremony may take (default: the coordinator's)")
+	token := fs.String("token", os.Getenv("FREEON_API_TOKEN"), "API token")
+	publish := fs.Bool("publish", false, "Let signers download the message from the coordinator")
+	seal := fs.Bool("seal", false, "Let signers download the message, encrypted to the group's members")
 	fs.Parse(args)
 
 	// Merge short/long flags
@@ -256,9 +505,23 @@ func FreeonSignCreate(args []string) {
 
 	// Data validation
 	if *groupID == "" {
-		fmt.Fprintf(os.Stderr, "Error: -g/--group is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-g/--group is required")
+	}
+	if *publish && *seal {
+		usageError(nil, "--publish and --seal can't be used together")
+	}
+	var signers []uint16
+	if *signerList != "" {
+		for _, p := range strings.Split(*signerList, ",") {
+			partyID, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+			if err != nil || partyID == 0 {
+				usageError(nil, "--signers: %q is not a party ID", p)
+			}
+			signers = append(signers, uint16(partyID))
+		}
+	}
+	if *deadline < 0 {
+		usageError(nil, "--deadline must be positive")
 	}
 	if *openssh {
 		// Default to "file"
@@ -266,9 +529,7 @@ func FreeonSignCreate(args []string) {
 			*namespace = "file"
 		}
 	} else if *namespace != "" {
-		fmt.Printf("--namespace can only be used with --openssh")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "--namespace can only be used with --openssh")
 	}
 
 	// Get message file from remaining args
@@ -279,13 +540,12 @@ func FreeonSignCreate(args []string) {
 	}
 	message, err := readInput(messageFile)
 	if err != nil {
-		fmt.Printf("A message file is required")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "a message file is required")
 	}
 
 	// The actual logic is implemented here:
-	internal.InitSignCeremony(*host, *groupID, message, *openssh, *namespace)
+	internal.SetApiToken(*token)
+	internal.InitSignCeremony(*host, *groupID, message, *openssh, *namespace, signers, *deadline, *publish, *seal)
 }
 
 // CMD: `freeon sign join ...`
@@ -299,7 +559,12 @@ func FreeonSignJoin(args []string) {
 	hostLong := fs.String("host", "", "Coordinator hostname:port")
 	identity := fs.String("i", "", "Path to age secret keys file")
 	identityLong := fs.String("identity", "", "Path to age secret keys file")
-	// autoConfirm := fs.Bool("auto-confirm", false, "Skip message confirmation prompt")
+	sshCert := fs.Bool("ssh-cert", false, "Review and sign the certificate the ceremony was created with")
+	fetch := fs.Bool("fetch", false, "Review and sign the message the proposer shared with the coordinator")
+	offline := fs.Bool("offline", false, "Exchange messages through bundle files instead of the network")
+	inbound := fs.String("inbound", "freeon-inbound.json", "Bundle file to read from (with --offline)")
+	outbound := fs.String("outbound", "freeon-outbound.json", "Bundle file to write to (with --offline)")
+	autoConfirm := fs.Bool("auto-confirm", false, "Sign without asking, for unattended automation")
 	fs.Parse(args)
 
 	// Merge short/long flags
@@ -312,20 +577,50 @@ func FreeonSignJoin(args []string) {
 	if *identityLong != "" {
 		*identity = *identityLong
 	}
+
+	// Certificate ceremonies carry their own message, which we review instead of bringing
+	if *sshCert {
+		internal.JoinSSHCertCeremony(*ceremonyID, *host, *identity, *autoConfirm)
+	}
+	if *fetch {
+		internal.JoinProposedSignCeremony(*ceremonyID, *host, *identity, *autoConfirm)
+		os.Exit(0)
+	}
 	remainingArgs := fs.Args()
 	var messageFile string = ""
 	if len(remainingArgs) > 0 {
 		messageFile = remainingArgs[0]
 	}
 	message, err := readInput(messageFile)
+	if err != nil && messageFile == "" && !*offline {
+		// Without a copy of our own, download the one the proposer shared
+		internal.JoinProposedSignCeremony(*ceremonyID, *host, *identity, *autoConfirm)
+		os.Exit(0)
+	}
 	if err != nil {
-		fmt.Printf("A message file is required")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "a message file is required")
+	}
+	// The message came in on stdin, so the answer to the prompt has to come from the terminal
+	if messageFile == "" && !*autoConfirm {
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			os.Stdin = tty
+		}
+	}
+
+	if *offline {
+		if *sshCert {
+			usageError(nil, "--offline can't be used with --ssh-cert")
+		}
+		if err := internal.GoOffline(internal.JournalSign, *ceremonyID, *inbound, *outbound); err != nil {
+			internal.Fail(err)
+		}
+		if internal.HasJournal(*ceremonyID) {
+			internal.ResumeCeremony(*ceremonyID, *identity)
+		}
 	}
 
 	// The actual logic is implemented here:
-	internal.JoinSignCeremony(*ceremonyID, *host, *identity, message)
+	internal.JoinSignCeremony(*ceremonyID, *host, *identity, message, *autoConfirm)
 }
 
 func FreeonSignList(args []string) {
@@ -349,14 +644,10 @@ func FreeonSignList(args []string) {
 	}
 
 	if *host == "" {
-		fmt.Fprintf(os.Stderr, "Error: -h/--host is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-h/--host is required")
 	}
 	if *groupID == "" {
-		fmt.Fprintf(os.Stderr, "Error: -g/--group is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-g/--group is required")
 	}
 	internal.ListSign(*host, *groupID, *limit, *offset)
 }
@@ -380,20 +671,131 @@ func FreeonSignGet(args []string) {
 		*host = *hostLong
 	}
 	if *host == "" {
-		fmt.Fprintf(os.Stderr, "Error: -h/--host is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-h/--host is required")
 	}
 	if *ceremonyID == "" {
-		fmt.Fprintf(os.Stderr, "Error: -c/--ceremony is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-c/--ceremony is required")
 	}
 
 	// The actual logic is implemented here:
 	internal.GetSignSignature(*ceremonyID, *host)
 }
 
+// A flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// CMD: `freeon sign ssh-cert ...`
+func FreeonSignSSHCert(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("sign ssh-cert", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", signSSHCertUsage) }
+	groupID := fs.String("g", "", "Group ID from DKG ceremony")
+	groupIDLong := fs.String("group", "", "Group ID from DKG ceremony")
+	host := fs.String("h", "", "Coordinator hostname:port")
+	hostLong := fs.String("host", "", "Coordinator hostname:port")
+	caKey := fs.String("s", "", "The group's OpenSSH public key")
+	caKeyLong := fs.String("ca", "", "The group's OpenSSH public key")
+	keyID := fs.String("I", "", "Certificate key ID")
+	keyIDLong := fs.String("key-id", "", "Certificate key ID")
+	principals := fs.String("n", "", "Comma-separated principals")
+	principalsLong := fs.String("principals", "", "Comma-separated principals")
+	validity := fs.String("V", "", "Validity interval")
+	validityLong := fs.String("validity", "", "Validity interval")
+	serial := fs.Uint64("z", 0, "Serial number")
+	serialLong := fs.Uint64("serial", 0, "Serial number")
+	hostCert := fs.Bool("host-certificate", false, "Issue a host certificate instead of a user certificate")
+	var options stringList
+	fs.Var(&options, "O", "Certificate option (may be repeated)")
+	fs.Var(&options, "option", "Certificate option (may be repeated)")
+	token := fs.String("token", os.Getenv("FREEON_API_TOKEN"), "API token")
+	fs.Parse(args)
+
+	// Merge short/long flags
+	if *groupIDLong != "" {
+		*groupID = *groupIDLong
+	}
+	if *hostLong != "" {
+		*host = *hostLong
+	}
+	if *caKeyLong != "" {
+		*caKey = *caKeyLong
+	}
+	if *keyIDLong != "" {
+		*keyID = *keyIDLong
+	}
+	if *principalsLong != "" {
+		*principals = *principalsLong
+	}
+	if *validityLong != "" {
+		*validity = *validityLong
+	}
+	if *serialLong != 0 {
+		*serial = *serialLong
+	}
+
+	// Data validation
+	if *groupID == "" {
+		usageError(fs.Usage, "-g/--group is required")
+	}
+	if *keyID == "" {
+		usageError(fs.Usage, "-I/--key-id is required")
+	}
+	// A certificate without principals is good for any user or host, which is never what anyone wants from a CA
+	if *principals == "" {
+		usageError(fs.Usage, "-n/--principals is required")
+	}
+	if *validity == "" {
+		usageError(fs.Usage, "-V/--validity is required (use always:forever for a certificate that never expires)")
+	}
+	if len(fs.Args()) != 1 {
+		usageError(fs.Usage, "exactly one public key to certify is required")
+	}
+	keyBytes, err := os.ReadFile(fs.Args()[0])
+	if err != nil {
+		internal.Fail(err)
+	}
+	subject, err := internal.ParseOpenSSHPublicKey(string(keyBytes))
+	if err != nil {
+		usageError(nil, "%s: %s", fs.Args()[0], err.Error())
+	}
+
+	certType := internal.SSHUserCert
+	if *hostCert {
+		certType = internal.SSHHostCert
+	}
+	cert, err := internal.NewSSHCertificate(subject, nil, certType)
+	if err != nil {
+		internal.Fail(err)
+	}
+	cert.KeyID = *keyID
+	cert.Serial = *serial
+	for _, p := range strings.Split(*principals, ",") {
+		cert.Principals = append(cert.Principals, strings.TrimSpace(p))
+	}
+	cert.ValidAfter, cert.ValidBefore, err = internal.ParseSSHValidity(*validity, time.Now())
+	if err != nil {
+		usageError(nil, "-V: %s", err.Error())
+	}
+	for _, opt := range options {
+		if err := cert.ApplyOption(opt); err != nil {
+			usageError(nil, "-O: %s", err.Error())
+		}
+	}
+
+	// The actual logic is implemented here:
+	internal.SetApiToken(*token)
+	internal.InitSSHCertCeremony(*host, *groupID, *caKey, cert)
+}
+
 // CMD: `freeon terminate ...`
 func FreeonTerminate(args []string) {
 	// Parse CLI arguments:
@@ -403,6 +805,7 @@ func FreeonTerminate(args []string) {
 	ceremonyIDLong := fs.String("ceremony", "", "Ceremony ID")
 	host := fs.String("h", "", "Coordinator hostname:port")
 	hostLong := fs.String("host", "", "Coordinator hostname:port")
+	token := fs.String("token", os.Getenv("FREEON_API_TOKEN"), "API token")
 	fs.Parse(args)
 
 	// Merge short/long flags
@@ -415,16 +818,352 @@ func FreeonTerminate(args []string) {
 
 	// Input validation
 	if *host == "" {
-		fmt.Fprintf(os.Stderr, "Error: -h/--host is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-h/--host is required")
 	}
 	if *ceremonyID == "" {
-		fmt.Fprintf(os.Stderr, "Error: -c/--ceremony is required\n")
-		fs.Usage()
-		os.Exit(1)
+		usageError(fs.Usage, "-c/--ceremony is required")
 	}
 
 	// The actual logic is implemented here:
+	internal.SetApiToken(*token)
 	internal.TerminateSignCeremony(*host, *ceremonyID)
 }
+
+// CMD: `freeon archive ...`
+func FreeonArchive(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", archiveUsage) }
+	groupID := fs.String("g", "", "Group ID")
+	groupIDLong := fs.String("group", "", "Group ID")
+	host := fs.String("h", "", "Coordinator hostname:port")
+	hostLong := fs.String("host", "", "Coordinator hostname:port")
+	token := fs.String("token", os.Getenv("FREEON_API_TOKEN"), "API token")
+	fs.Parse(args)
+
+	// Merge short/long flags
+	if *groupIDLong != "" {
+		*groupID = *groupIDLong
+	}
+	if *hostLong != "" {
+		*host = *hostLong
+	}
+
+	// Input validation
+	if *host == "" {
+		usageError(fs.Usage, "-h/--host is required")
+	}
+	if *groupID == "" {
+		usageError(fs.Usage, "-g/--group is required")
+	}
+
+	// The actual logic is implemented here:
+	internal.SetApiToken(*token)
+	internal.ArchiveGroup(*host, *groupID)
+}
+
+// CMD: `freeon resume ...`
+func FreeonResume(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", resumeUsage) }
+	identity := fs.String("i", "", "Path to age secret keys file")
+	identityLong := fs.String("identity", "", "Path to age secret keys file")
+	fs.Parse(args)
+
+	// Merge short/long flags
+	if *identityLong != "" {
+		*identity = *identityLong
+	}
+
+	// Input validation
+	if *identity == "" {
+		usageError(fs.Usage, "-i/--identity is required")
+	}
+	if fs.NArg() != 1 {
+		usageError(fs.Usage, "a ceremony or group ID is required")
+	}
+
+	// The actual logic is implemented here:
+	internal.ResumeCeremony(fs.Arg(0), *identity)
+}
+
+// CMD: `freeon identity`
+func FreeonIdentity(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("identity", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", identityUsage) }
+	csr := fs.Bool("csr", false, "Print a certificate signing request instead")
+	fs.Parse(args)
+
+	// Input validation
+	if fs.NArg() != 0 {
+		usageError(fs.Usage, "identity takes no arguments")
+	}
+
+	// The actual logic is implemented here:
+	internal.ShowIdentity(*csr)
+}
+
+// CMD: `freeon relay ...`
+func FreeonRelay(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("relay", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", relayUsage) }
+	host := fs.String("h", "", "Coordinator hostname:port")
+	hostLong := fs.String("host", "", "Coordinator hostname:port")
+	outbound := fs.String("outbound", "freeon-outbound.json", "Bundle file from the offline machine")
+	inbound := fs.String("inbound", "freeon-inbound.json", "Bundle file to take back to the offline machine")
+	fs.Parse(args)
+
+	// Merge short/long flags
+	if *hostLong != "" {
+		*host = *hostLong
+	}
+
+	// Input validation
+	if *host == "" {
+		usageError(fs.Usage, "-h/--host is required")
+	}
+
+	// The actual logic is implemented here:
+	ctx, stop := internal.InterruptContext()
+	defer stop()
+	result, err := internal.Relay(ctx, *host, *outbound, *inbound)
+	if err != nil {
+		internal.Fail(err)
+	}
+	text := fmt.Sprintf("Delivered %d request(s); %d message(s) so far.\n", result.Delivered, result.Messages)
+	text += fmt.Sprintf("Take %s back to the offline machine.\n", result.Inbound)
+	internal.Succeed(text, result)
+}
+
+// CMD: `freeon agent ...`
+func FreeonAgent(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", agentUsage) }
+	socket := fs.String("a", "", "Path to the agent socket")
+	socketLong := fs.String("socket", "", "Path to the agent socket")
+	identity := fs.String("i", os.Getenv("FREEON_IDENTITY"), "Path to age secret keys file")
+	identityLong := fs.String("identity", "", "Path to age secret keys file")
+	fs.Parse(args)
+
+	// Merge short/long flags
+	if *socketLong != "" {
+		*socket = *socketLong
+	}
+	if *identityLong != "" {
+		*identity = *identityLong
+	}
+
+	// Data validation
+	if *identity == "" {
+		usageError(fs.Usage, "-i/--identity or FREEON_IDENTITY is required")
+	}
+
+	// The actual logic is implemented here:
+	internal.RunAgent(*socket, *identity)
+}
+
+// CMD: `freeon verify ...`
+//
+// Exits 0 for a good signature, 1 for a bad one, and 2 if it couldn't be checked at all.
+func FreeonVerify(args []string) {
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", verifyUsage) }
+	signature := fs.String("s", "", "Signature file, or a hex-encoded signature")
+	signatureLong := fs.String("signature", "", "Signature file, or a hex-encoded signature")
+	groupID := fs.String("g", "", "Group ID of a local share")
+	groupIDLong := fs.String("group", "", "Group ID of a local share")
+	publicKey := fs.String("k", "", "Hex-encoded or OpenSSH public key")
+	publicKeyLong := fs.String("key", "", "Hex-encoded or OpenSSH public key")
+	allowedSigners := fs.String("f", "", "OpenSSH allowed_signers file")
+	allowedSignersLong := fs.String("allowed-signers", "", "OpenSSH allowed_signers file")
+	principal := fs.String("I", "", "Principal the signer must be allowed to sign as")
+	principalLong := fs.String("principal", "", "Principal the signer must be allowed to sign as")
+	namespace := fs.String("n", "file", "Namespace of an OpenSSH signature")
+	namespaceLong := fs.String("namespace", "", "Namespace of an OpenSSH signature")
+	fs.Parse(args)
+
+	// Merge short/long flags
+	if *signatureLong != "" {
+		*signature = *signatureLong
+	}
+	if *groupIDLong != "" {
+		*groupID = *groupIDLong
+	}
+	if *publicKeyLong != "" {
+		*publicKey = *publicKeyLong
+	}
+	if *allowedSignersLong != "" {
+		*allowedSigners = *allowedSignersLong
+	}
+	if *principalLong != "" {
+		*principal = *principalLong
+	}
+	if *namespaceLong != "" {
+		*namespace = *namespaceLong
+	}
+
+	// Data validation
+	if *signature == "" {
+		usageError(fs.Usage, "-s/--signature is required")
+	}
+	sources := 0
+	for _, s := range []string{*groupID, *publicKey, *allowedSigners} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		usageError(fs.Usage, "exactly one of -g/--group, -k/--key, or -f/--allowed-signers is required")
+	}
+	if *principal != "" && *allowedSigners == "" {
+		usageError(fs.Usage, "-I/--principal can only be used with -f/--allowed-signers")
+	}
+
+	// Short enough to be a raw signature? Then it is one. Otherwise, it's a file.
+	var sigBytes []byte
+	if _, err := hex.DecodeString(*signature); err == nil && len(*signature) == 128 {
+		sigBytes = []byte(*signature)
+	} else {
+		var err error
+		sigBytes, err = os.ReadFile(*signature)
+		if err != nil {
+			internal.Fail(internal.CommandError{Exit: internal.VerifyError, Err: err})
+		}
+	}
+
+	// Certificates don't need a message, so a missing one is only an error later
+	var messageFile string
+	if len(fs.Args()) > 0 {
+		messageFile = fs.Args()[0]
+	}
+	message, err := readInput(messageFile)
+	if err != nil && messageFile != "" {
+		internal.Fail(internal.CommandError{Exit: internal.VerifyError, Err: err})
+	}
+
+	// The actual logic is implemented here:
+	keys := internal.VerifyKeySource{
+		GroupID:            *groupID,
+		PublicKey:          *publicKey,
+		AllowedSignersFile: *allowedSigners,
+	}
+	internal.Verify(sigBytes, message, keys, *namespace, *principal)
+}
+
+// CMD: `freeon ssh-keygen ...`
+//
+// This takes ssh-keygen's arguments, not ours, so it can't use the flag package: ssh-keygen allows options to be
+// glued to their values (e.g. -Overify-time=20240101).
+func FreeonSSHKeygen(args []string) {
+	var op, keyFile, namespace, principal, signatureFile string
+	var options []string
+	fingerprint := false
+	var files []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' {
+			files = append(files, arg)
+			continue
+		}
+		if arg == "--help" {
+			fmt.Fprintf(os.Stderr, "%s\n", sshKeygenUsage)
+			os.Exit(0)
+		}
+		for j := 1; j < len(arg); j++ {
+			var target *string
+			switch arg[j] {
+			case 'l':
+				fingerprint = true
+				continue
+			case 'q', 'U':
+				// Quiet mode and agent keys don't mean anything for us
+				continue
+			case 'Y':
+				target = &op
+			case 'f':
+				target = &keyFile
+			case 'n':
+				target = &namespace
+			case 'I':
+				target = &principal
+			case 's':
+				target = &signatureFile
+			case 'O':
+				target = new(string)
+			default:
+				fmt.Fprintf(os.Stderr, "Error: unsupported option: -%c\n\n%s\n", arg[j], sshKeygenUsage)
+				os.Exit(1)
+			}
+			// Everything after an option that takes a value is the value, or else it's the next argument
+			if j+1 < len(arg) {
+				*target = arg[j+1:]
+			} else if i+1 < len(args) {
+				i++
+				*target = args[i]
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: -%c requires an argument\n", arg[j])
+				os.Exit(1)
+			}
+			if arg[j] == 'O' {
+				options = append(options, *target)
+			}
+			break
+		}
+	}
+
+	// git passes -Overify-time when checking an old signature
+	verifyTime := time.Now()
+	for _, opt := range options {
+		if value, ok := strings.CutPrefix(opt, "verify-time="); ok {
+			t, err := internal.ParseSSHTime(value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+				os.Exit(1)
+			}
+			verifyTime = t
+		}
+	}
+
+	if fingerprint {
+		if keyFile == "" {
+			fmt.Fprintf(os.Stderr, "Error: -f is required\n")
+			os.Exit(1)
+		}
+		internal.SSHKeygenFingerprint(keyFile)
+	}
+	required := map[string][]string{
+		"sign":             {"-f", "-n"},
+		"verify":           {"-f", "-I", "-n", "-s"},
+		"check-novalidate": {"-n", "-s"},
+		"find-principals":  {"-f", "-s"},
+	}
+	given := map[string]string{"-f": keyFile, "-I": principal, "-n": namespace, "-s": signatureFile}
+	flags, ok := required[op]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unsupported operation: -Y %s\n\n%s\n", op, sshKeygenUsage)
+		os.Exit(1)
+	}
+	for _, f := range flags {
+		if given[f] == "" {
+			fmt.Fprintf(os.Stderr, "Error: %s is required for -Y %s\n", f, op)
+			os.Exit(1)
+		}
+	}
+
+	// The actual logic is implemented here:
+	switch op {
+	case "sign":
+		internal.SSHKeygenSign(keyFile, namespace, os.Getenv("FREEON_IDENTITY"), files)
+	case "verify":
+		internal.SSHKeygenVerify(keyFile, principal, namespace, signatureFile, verifyTime)
+	case "check-novalidate":
+		internal.SSHKeygenCheckNovalidate(namespace, signatureFile)
+	case "find-principals":
+		internal.SSHKeygenFindPrincipals(keyFile, signatureFile, verifyTime)
+	}
+}
@@ -16,19 +16,66 @@ OPTIONS:
     -h, --help       Print help information
     -V, --version    Print version information
     -v, --verbose    Enable verbose output
+    -o, --output <FORMAT>
+                     How to print results and errors: text (default) or
+                     json. Also read from FREEON_OUTPUT.
+    --request-timeout <DURATION>
+                     Give up on a request to the coordinator after this
+                     long (default: 30s)
+    --ceremony-timeout <DURATION>
+                     Give up on a ceremony after this long (default: 1h)
 
 COMMANDS:
     keygen       Distributed key generation ceremonies
     sign         Signature generation ceremonies  
     terminate    Terminate incomplete ceremonies
+    archive      Retire a group for good
+    ssh-keygen   Sign and verify with ssh-keygen's calling convention
+    agent        Serve group keys to SSH clients as an ssh-agent
+    verify       Check a signature or certificate made by a group
+    resume       Pick up a ceremony that was interrupted
+    relay        Carry bundles between an offline machine and the coordinator
+    identity     Print your identity key
     help         Print this message or the help of the given subcommand(s)
 
 Use 'freeon <COMMAND> --help' for more information on a specific command.
 
+OUTPUT:
+    With --output json, a command that succeeds prints exactly one JSON
+    object to stdout: {"group-id": ...} for key generation and archive,
+    {"ceremony-id": ..., "format": ..., "signature": ...} for signing
+    ceremonies, {"groups": [...]} and {"ceremonies": [...]} for lists,
+    {"identity-key": ...} for identity, and {"valid": true, ...} for
+    verify. Failures print one JSON object to stderr instead:
+
+        {"error": {"code": "not-approved", "message": "..."}}
+
+    Codes are usage, network, unauthorized, not-found, coordinator,
+    policy-refused, not-approved, ceremony-ended, bad-signature, timeout,
+    interrupted, and error. Prompts, reviews, and progress still go to
+    stderr as text. freeon ssh-keygen always prints what ssh-keygen would.
+
+EXIT STATUS:
+    0    Success, including waiting offline for the relay and not being
+         chosen as a signer
+    1    Failure: the coordinator refused, the ceremony failed, or the
+         signature is bad
+    2    Bad command line (and, for verify, a signature that could not be
+         checked at all)
+    3    Refused to sign, by a signing policy or at the review prompt
+
+TIMEOUTS:
+    Both timeouts can also be set in ~/.freeon.json, as
+    "timeouts": {"request": "30s", "ceremony": "1h"}. Requests that only
+    read from the coordinator are retried, with backoff, if they fail in
+    a way that might not last. Ctrl-C stops a ceremony; if it's still
+    waiting for people to join, we give our seat back before exiting.
+
 EXAMPLES:
     freeon keygen create -h coordinator:8080 -n 5 -t 3
     freeon sign create -g abc123 message.txt
     freeon sign join -c ceremony456
+    freeon --output json sign list -h coordinator:8080 -g abc123
 
 `
 
@@ -42,6 +89,8 @@ SUBCOMMANDS:
     create    Initialize a new DKG ceremony
     join      Join an existing DKG ceremony
     list      List local key shares and groups
+    refresh   Re-randomize the shares of an existing group
+    reshare   Change the members or threshold of an existing group
     help      Print this message or the help of the given subcommand(s)
 `
 
@@ -59,11 +108,14 @@ OPTIONS:
     -n, --participants <NUM>       Total number of participants (2-255)
     -t, --threshold <NUM>          Minimum signatures required (1 to n)
     -r, --recipient <PUBKEY>       Age/SSH public key to encrypt share
+        --deadline <DURATION>      How long key generation may take, e.g. 2h
+                                   (default: set by the coordinator)
         --help                     Print help information
 
 EXAMPLES:
     freeon keygen create -h coord.example.com:8080 -n 7 -t 3
     freeon keygen create -h 192.168.1.100:8080 -n 5 -t 3 -r age1abc...
+    freeon keygen create -h coord.example.com:8080 -n 3 -t 2 --deadline 72h
 
 `
 
@@ -77,15 +129,107 @@ DESCRIPTION:
     Join an existing DKG ceremony using the Group ID from the creator.
     Maintains connection until all participants join and key is generated.
 
+    Name every other member's identity key with --member (members can print
+    theirs with "freeon identity"), and the client refuses a group made of
+    anyone else. Without --member, it prints the keys the coordinator
+    handed out, and you should compare them with each member.
+
 OPTIONS:
     -h, --host <HOST>         Coordinator hostname:port  
     -g, --group <GROUP_ID>    Group ID from ceremony creator
     -r, --recipient <PUBKEY>  Age/SSH public key to encrypt share
+        --member <KEY>        Identity key of another member (may be repeated)
+    -i, --identity <FILE>     Path to age secret keys file (with --offline)
+        --offline             Read from and write to bundle files instead of
+                              the network; see freeon help relay
+        --inbound <FILE>      Bundle to read (default: freeon-inbound.json)
+        --outbound <FILE>     Bundle to write (default: freeon-outbound.json)
         --help                Print help information
 
 EXAMPLES:
     freeon keygen join -h coord.example.com:8080 -g grp_abc123def456
     freeon keygen join -h coord.example.com:8080 -g grp_xyz789 -r ~/.ssh/id_ed25519.pub
+    freeon keygen join -h coord.example.com:8080 -g grp_xyz789 -r age1abc... --member 5f1c... --member 9a07...
+    freeon keygen join --offline -g grp_xyz789 -r age1abc... -i ~/.age/keys.txt
+
+`
+
+const keygenListUsage = `freeon KEYGEN LIST - List local key shares and groups
+
+USAGE:
+    freeon keygen list [OPTIONS]
+
+OPTIONS:
+        --openssh    Print each group's public key in OpenSSH format
+        --help       Print help information
+
+EXAMPLES:
+    freeon keygen list
+    freeon keygen list --openssh
+
+`
+
+const keygenRefreshUsage = `freeon KEYGEN REFRESH - Proactively refresh key shares
+
+USAGE:
+    freeon keygen refresh [OPTIONS] -h <HOST> -g <GROUP_ID> -i <FILE> -r <PUBKEY>
+
+DESCRIPTION:
+    Replace your share of a group's key with a fresh one, without changing
+    the group public key. Every current holder must run this command. Once
+    they have all confirmed, the group moves to a new epoch, and shares
+    from older epochs can no longer be used to sign.
+
+OPTIONS:
+    -h, --host <HOST>         Coordinator hostname:port
+    -g, --group <GROUP_ID>    Group ID from DKG ceremony
+    -i, --identity <FILE>     Path to age secret keys file
+    -r, --recipient <PUBKEY>  Age/SSH public key to encrypt the new share
+        --abort               Abort the refresh in progress for the group
+        --help                Print help information
+
+EXAMPLES:
+    freeon keygen refresh -h coord.example.com:8080 -g grp_abc123 -i ~/.age/keys.txt -r age1abc...
+    freeon keygen refresh -h coord.example.com:8080 -g grp_abc123 --abort
+
+`
+
+const keygenReshareUsage = `freeon KEYGEN RESHARE - Change group membership and threshold
+
+USAGE:
+    freeon keygen reshare [OPTIONS] -h <HOST> -g <GROUP_ID> -r <PUBKEY>
+
+DESCRIPTION:
+    Hand a group's key to a new set of participants, with a new threshold,
+    without changing the group public key. A current holder proposes the
+    reshare with -n and -t, naming each newcomer's identity key with
+    --newcomer (newcomers can print theirs with "freeon identity"). Then at
+    least t current holders (by the old threshold) join to deal their
+    shares, and exactly n participants join to receive new ones. Newcomers
+    run this command without a share, and only the ones named can join.
+    Holders who pass --newcomer too won't deal unless the reshare was
+    proposed for exactly those newcomers.
+
+    Once everyone has confirmed, the group moves to a new epoch, and
+    shares from older epochs can no longer be used to sign.
+
+OPTIONS:
+    -h, --host <HOST>         Coordinator hostname:port
+    -g, --group <GROUP_ID>    Group ID from DKG ceremony
+    -i, --identity <FILE>     Path to age secret keys file (current holders)
+    -r, --recipient <PUBKEY>  Age/SSH public key to encrypt the new share
+    -n, --participants <NUM>  Propose a reshare with this many participants
+    -t, --threshold <NUM>     Minimum signatures required after the reshare
+        --newcomer <KEY>      Identity key of a newcomer (may be repeated)
+        --leave               Deal your share, but leave the group
+        --abort               Abort the reshare in progress for the group
+        --help                Print help information
+
+EXAMPLES:
+    freeon keygen reshare -h coord.example.com:8080 -g grp_abc123 -i ~/.age/keys.txt -r age1abc... -n 5 -t 3 --newcomer 3b6a27bc...
+    freeon keygen reshare -h coord.example.com:8080 -g grp_abc123 -r age1xyz...
+    freeon keygen reshare -h coord.example.com:8080 -g grp_abc123 -i ~/.age/keys.txt --leave
+    freeon keygen reshare -h coord.example.com:8080 -g grp_abc123 --abort
 
 `
 
@@ -98,6 +242,7 @@ SUBCOMMANDS:
     create    Initialize a new signature ceremony
     join      Join an existing signature ceremony
     list      List recent signing ceremonies
+    ssh-cert  Issue an OpenSSH certificate with the group key as the CA
     help      Print this message or the help of the given subcommand(s)
 
 `
@@ -109,8 +254,9 @@ USAGE:
 
 DESCRIPTION:
     Creates a new signature ceremony for the specified group and message.
-    Returns a Ceremony ID that participants use to join. Does not require
-    holding a key share (useful for CI/CD automation).
+    Returns a Ceremony ID that participants use to join. Members of the
+    group propose as themselves. Anyone else, such as a CI/CD pipeline,
+    needs an API token from the coordinator's operator.
 
 ARGUMENTS:
     [MESSAGE]    File containing message to sign (use '-' for stdin)
@@ -121,11 +267,25 @@ OPTIONS:
         --help                Print help information
     --openssh                 Return an OpenSSH formatted signature
     --namespace <NAMESPACE>   Specify a namespace for OpenSSH (default: "file")
+    --signers <PARTY_IDS>     Comma-separated party IDs that may sign; the first
+                              threshold-many of them to join are the signers
+                              (default: whoever joins first)
+    --deadline <DURATION>     How long the ceremony may take, e.g. 30m
+                              (default: set by the coordinator)
+    --token <TOKEN>           API token to propose with, instead of as a
+                              member (default: $FREEON_API_TOKEN)
+    --publish                 Let signers download the message from the
+                              coordinator, so they don't need their own copy
+    --seal                    Like --publish, but encrypt the message to the
+                              group's members so the coordinator can't read it.
+                              The coordinator can't check the final signature.
 
 EXAMPLES:
     freeon sign create -g grp_abc123 message.txt
     echo "Hello World" | freeon sign create -g grp_abc123 -
     freeon sign create -g grp_abc123  --openssh --namespace git release.tar.gz
+    freeon sign create -g grp_abc123 --signers 1,3 message.txt
+    freeon sign create -g grp_abc123 --seal message.txt
 
 `
 
@@ -160,7 +320,25 @@ USAGE:
 
 DESCRIPTION:
     Join an existing signature ceremony. The message must match what was
-    specified during ceremony creation (used for verification).
+    specified during ceremony creation (used for verification). Once
+    threshold-many parties have joined, they are the ceremony's signers;
+    anyone else who joins sits this one out.
+
+    Before anything is signed, the ceremony is shown for review: who
+    proposed it, the message's size, SHA-256 digest, and format (with the
+    OpenSSH namespace, if any), who has already joined, and a preview of
+    the message. SSH certificates and git commits or tags are laid out
+    field by field; other messages are shown as text, or as a hex dump.
+    Nothing is signed without an explicit "y", read from stdin (or from
+    the terminal, if the message came in on stdin).
+
+    Ceremonies that break the signing policy for their group (see the
+    policies section of ~/.freeon.json) are refused, whatever the answer.
+    Either kind of refusal exits with status 3.
+
+    With --fetch, or when no message is given at a terminal, the message
+    the proposer published or sealed is downloaded from the coordinator
+    and checked against the hash it was proposed with before review.
 
 ARGUMENTS:
     [MESSAGE]    File containing message to sign (use '-' for stdin)
@@ -169,12 +347,70 @@ OPTIONS:
     -c, --ceremony <CEREMONY_ID>    Ceremony ID from sign create
     -h, --host <HOST>               Coordinator hostname:port
     -i, --identity <FILE>           Path to age secret keys file
+        --ssh-cert                  Join a certificate ceremony from sign ssh-cert,
+                                    reviewing its certificate instead of reading
+                                    a message
+        --fetch                     Download the message the proposer published
+                                    or sealed, instead of reading one
+        --auto-confirm              Sign without asking after the review. Only for
+                                    unattended automation.
+        --offline                   Read from and write to bundle files instead
+                                    of the network; see freeon help relay
+        --inbound <FILE>            Bundle to read (default: freeon-inbound.json)
+        --outbound <FILE>           Bundle to write (default: freeon-outbound.json)
         --help                      Print help information
 
 EXAMPLES:
     freeon sign join -c cer_def456 message.txt
     echo "Hello World" | freeon sign join -c cer_def456 -
     freeon sign join -c cer_def456 -i ~/.age/keys.txt message.txt
+    freeon sign join --fetch -c cer_def456 -i ~/.age/keys.txt
+    freeon sign join --ssh-cert -c cer_def456 -i ~/.age/keys.txt
+    freeon sign join --offline -c cer_def456 -i ~/.age/keys.txt message.txt
+    freeon sign join --auto-confirm -c cer_def456 message.txt
+
+`
+
+const signSSHCertUsage = `freeon SIGN SSH-CERT - Issue an OpenSSH certificate
+
+USAGE:
+    freeon sign ssh-cert [OPTIONS] -g <GROUP_ID> -I <KEY_ID> -n <PRINCIPALS> -V <INTERVAL> <PUBLIC_KEY>
+
+DESCRIPTION:
+    Creates a signing ceremony that issues an OpenSSH certificate for an
+    Ed25519 public key, with the group key as the certificate authority.
+    Signers join with "freeon sign join --ssh-cert", which shows them
+    every field of the certificate before they approve it. Each signer
+    gets the finished certificate, and so does "freeon sign get".
+
+ARGUMENTS:
+    <PUBLIC_KEY>    OpenSSH public key file to certify
+
+OPTIONS:
+    -g, --group <GROUP_ID>         Group ID from DKG ceremony
+    -h, --host <HOST>              Coordinator hostname:port
+    -s, --ca <FILE>                The group's OpenSSH public key (default:
+                                   from your share of the group)
+    -I, --key-id <KEY_ID>          Key ID, which is logged when the
+                                   certificate is used
+    -n, --principals <LIST>        Comma-separated user or host names
+    -V, --validity <INTERVAL>      Validity interval, as for ssh-keygen -V:
+                                   [FROM:]TO, where each end is +/-1h30m,
+                                   YYYYMMDD[HHMM[SS]][Z], always, or forever
+    -O, --option <OPTION>          Certificate option, as for ssh-keygen -O
+                                   (may be repeated): clear, no-pty,
+                                   permit-pty, force-command=...,
+                                   source-address=..., verify-required,
+                                   critical:NAME[=VALUE], extension:NAME[=VALUE]
+    -z, --serial <NUM>             Serial number (default: 0)
+        --host-certificate         Issue a host certificate
+        --token <TOKEN>            API token to propose with, if you aren't
+                                   a member (default: $FREEON_API_TOKEN)
+        --help                     Print help information
+
+EXAMPLES:
+    freeon sign ssh-cert -g grp_abc123 -I alice@example.com -n alice -V +8h id_ed25519.pub
+    freeon sign ssh-cert -g grp_abc123 -I web01 -n web01.example.com -V +52w --host-certificate ssh_host_ed25519_key.pub
 
 `
 
@@ -185,7 +421,8 @@ USAGE:
 
 DESCRIPTION:
     Query the coordinator for the final signature for a concluded
-    ceremony.
+    ceremony. If the ceremony was aborted because of an invalid
+    signature share, the parties blamed for it are shown instead.
 
 OPTIONS:
     -c, --ceremony <CEREMONY_ID>    Ceremony ID from sign create
@@ -201,19 +438,244 @@ EXAMPLES:
 const terminateUsage = `freeon TERMINATE - Terminate ceremonies
 
 USAGE:
-    freeon terminate <CEREMONY_ID>
+    freeon terminate [OPTIONS] -c <CEREMONY_ID>
+
+DESCRIPTION:
+    Terminate an incomplete signature ceremony. Only the group's
+    administrators may do this: either a member the coordinator's operator
+    made an administrator, whose request is signed with their identity key,
+    or someone holding an administrator API token.
+
+OPTIONS:
+    -c, --ceremony <CEREMONY_ID>    Ceremony ID to terminate
+    -h, --host <HOST>               Coordinator hostname:port
+        --token <TOKEN>             Administrator API token
+                                    (default: $FREEON_API_TOKEN)
+        --help                      Print help information
+
+EXAMPLES:
+    freeon terminate -h coord.example.com:8080 -c cer_def456
+
+`
+
+const archiveUsage = `freeon ARCHIVE - Retire a group
+
+USAGE:
+    freeon archive [OPTIONS] -g <GROUP_ID>
 
 DESCRIPTION:
-    Terminate an incomplete signature ceremony. Does not require
-    privileged access - any user can terminate any ceremony.
+    Archive a group once its key is no longer in use. Any ceremonies it
+    still has open are closed, and nobody can sign, refresh, or reshare
+    with it again. Only the group's administrators may do this, as with
+    "freeon terminate".
+
+OPTIONS:
+    -g, --group <GROUP_ID>    Group ID to archive
+    -h, --host <HOST>         Coordinator hostname:port
+        --token <TOKEN>       Administrator API token
+                              (default: $FREEON_API_TOKEN)
+        --help                Print help information
+
+EXAMPLES:
+    freeon archive -h coord.example.com:8080 -g grp_abc123
+
+`
+
+const sshKeygenUsage = `freeon SSH-KEYGEN - ssh-keygen compatible signing
+
+USAGE:
+    freeon ssh-keygen -Y sign -f <KEY_FILE> -n <NAMESPACE> [FILE ...]
+    freeon ssh-keygen -Y verify -f <ALLOWED_SIGNERS> -I <PRINCIPAL> -n <NAMESPACE> -s <SIG_FILE>
+    freeon ssh-keygen -Y check-novalidate -n <NAMESPACE> -s <SIG_FILE>
+    freeon ssh-keygen -Y find-principals -f <ALLOWED_SIGNERS> -s <SIG_FILE>
+    freeon ssh-keygen -l -f <KEY_FILE>
+
+DESCRIPTION:
+    Accepts the same arguments as ssh-keygen -Y, so anything that signs
+    with SSH keys (like git) can use a group key instead. The same thing
+    happens if this binary is run as (or symlinked to) freeon-ssh-keygen.
+
+    KEY_FILE is the group's public key in OpenSSH format, as printed by
+    freeon keygen list --openssh. Signing starts a signing ceremony on the
+    group's coordinator, or joins one that is already open for the same
+    message, and waits for enough other holders to join. Each FILE is
+    signed to FILE.sig; with no files, standard input is signed to
+    standard output. Messages to verify are read from standard input.
+
+ENVIRONMENT:
+    FREEON_IDENTITY    Path to the age secret keys file that decrypts your share
+
+OPTIONS:
+    -Y <OPERATION>    sign, verify, check-novalidate, or find-principals
+    -f <FILE>         Group public key (sign), or allowed signers file (verify)
+    -n <NAMESPACE>    Signature namespace, e.g. "git" or "file"
+    -I <PRINCIPAL>    Principal to verify the signature for
+    -s <FILE>         Signature file to verify
+    -O <OPTION>       Only verify-time=<TIMESTAMP> is understood
+    -l                Print the fingerprint of the key in -f
+        --help        Print help information
+
+EXAMPLES:
+    git config gpg.format ssh
+    git config gpg.ssh.program freeon-ssh-keygen
+    git config user.signingkey "$(freeon keygen list --openssh | grep grp_abc123)"
+    FREEON_IDENTITY=~/.age/keys.txt git tag -s v1.0.0
+
+`
+
+const agentUsage = `freeon AGENT - Threshold ssh-agent
+
+USAGE:
+    freeon agent [OPTIONS] -i <FILE>
+
+DESCRIPTION:
+    Speak the OpenSSH agent protocol on a Unix socket, offering the public
+    key of every group you hold a share of as an ssh-ed25519 identity.
+
+    Each sign request opens a signing ceremony on the group's coordinator,
+    and blocks until enough other holders join it. The message is left
+    with the coordinator, and the ceremony ID is logged so it can be passed
+    along; other holders join with "freeon sign join --fetch".
+
+    Prints SSH_AUTH_SOCK in the same format as ssh-agent, then runs until
+    interrupted.
+
+OPTIONS:
+    -a, --socket <PATH>      Path to the agent socket (default: a new
+                             private temporary directory)
+    -i, --identity <FILE>    Path to age secret keys file (default:
+                             $FREEON_IDENTITY)
+        --help               Print help information
+
+EXAMPLES:
+    freeon agent -i ~/.age/keys.txt
+    freeon agent -a /run/user/1000/freeon.sock -i ~/.age/keys.txt
+    SSH_AUTH_SOCK=/run/user/1000/freeon.sock ssh -A deploy@bastion
+
+`
+
+const verifyUsage = `freeon VERIFY - Check a signature
+
+USAGE:
+    freeon verify [OPTIONS] -s <SIGNATURE> (-g <GROUP_ID> | -k <KEY> | -f <FILE>) [MESSAGE]
+
+DESCRIPTION:
+    Verify a signature made by a group, in any format the client emits:
+    raw hex (R || z), OpenSSH SSHSIG armor, or an OpenSSH certificate.
+    The format is detected automatically. Certificates carry what they
+    sign, so they don't need a message.
+
+ARGUMENTS:
+    [MESSAGE]    File containing the signed message (default: stdin)
+
+OPTIONS:
+    -s, --signature <SIG>           Signature file, or a hex-encoded signature
+    -g, --group <GROUP_ID>          Trust the key of a group you hold a share of
+    -k, --key <KEY>                 Trust a hex-encoded or OpenSSH public key
+    -f, --allowed-signers <FILE>    Trust the keys in an OpenSSH allowed_signers file
+    -I, --principal <PRINCIPAL>     With -f, the principal the key must belong to
+    -n, --namespace <NAMESPACE>     Namespace an SSHSIG signature must have
+                                    (default: "file")
+        --help                      Print help information
+
+EXIT STATUS:
+    0    The signature is good
+    1    The signature is bad, or not from a trusted key
+    2    The signature could not be checked (bad arguments, unreadable or
+         malformed input)
+
+EXAMPLES:
+    freeon verify -g grp_abc123 -s 3f9a...c2 message.txt
+    freeon verify -k "ssh-ed25519 AAAA..." -n git -s tag.txt.sig tag.txt
+    freeon verify -f allowed_signers -I release@example.com -s release.tar.gz.sig release.tar.gz
+    freeon verify -g grp_abc123 -s id_ed25519-cert.pub
+
+`
+
+const resumeUsage = `freeon RESUME - Pick up an interrupted ceremony
+
+USAGE:
+    freeon resume -i <IDENTITY_FILE> <ID>
+
+DESCRIPTION:
+    Continue a key generation or signing ceremony after the client crashed
+    or lost its connection. Progress is journaled in ~/.freeon-journal
+    after every round, along with the ceremony's secrets (encrypted with
+    age), so a resumed ceremony sends exactly what it would have sent.
+
+    Signing ceremonies never reuse nonces: once a commitment is sent, a
+    resumed signer only signs with the same set of parties, and once a
+    signature share is made, it is resent rather than made again.
 
 ARGUMENTS:
-    <CEREMONY_ID>    Ceremony ID to terminate
+    <ID>    Group ID (for key generation) or ceremony ID (for signing)
+
+OPTIONS:
+    -i, --identity <FILE>    Path to age secret keys file; for key
+                             generation, it must match the recipient
+                             the ceremony was joined with
+        --help               Print help information
+
+EXAMPLES:
+    freeon resume -i ~/.age/keys.txt grp_abc123
+    freeon resume -i ~/.age/keys.txt cer_def456
+
+`
+
+const identityUsage = `freeon IDENTITY - Print your identity key
+
+USAGE:
+    freeon identity [OPTIONS]
+
+DESCRIPTION:
+    Print the hex-encoded Ed25519 key that signs everything you send to a
+    coordinator, creating it first if you don't have one yet. Give it to
+    whoever proposes a reshare that you're joining as a newcomer.
+
+    A coordinator with a client CA only lets in clients with a certificate
+    it issued. --csr prints a certificate signing request for your identity
+    key; have the coordinator's operator sign it, and point client-cert-file
+    in ~/.freeon.json at the certificate you get back.
 
 OPTIONS:
+        --csr     Print a certificate signing request instead
         --help    Print help information
 
 EXAMPLES:
-    freeon terminate cer_def456
+    freeon identity
+    freeon identity --csr > freeon.csr
+
+`
+
+const relayUsage = `freeon RELAY - Carry bundles for an offline machine
+
+USAGE:
+    freeon relay [OPTIONS] -h <HOST>
+
+DESCRIPTION:
+    Share holders whose machines never touch the network can join key
+    generation and signing ceremonies with --offline. Instead of talking to
+    the coordinator, the offline client reads an inbound bundle and writes
+    an outbound bundle, which you carry (on a USB stick, say) to a machine
+    that can reach the coordinator.
+
+    The relay delivers the requests in the outbound bundle, which were
+    already signed on the offline machine, then writes an inbound bundle
+    with the ceremony's latest state and messages. Take it back to the
+    offline machine and run the same join command again. Repeat until the
+    ceremony finishes.
+
+OPTIONS:
+    -h, --host <HOST>      Coordinator hostname:port
+        --outbound <FILE>  Bundle from the offline machine
+                           (default: freeon-outbound.json)
+        --inbound <FILE>   Bundle to take back to the offline machine
+                           (default: freeon-inbound.json)
+        --help             Print help information
+
+EXAMPLES:
+    freeon sign join --offline -c cer_def456 -i ~/.age/keys.txt message.txt
+    freeon relay -h coord.example.com:8080
+    freeon sign join --offline -c cer_def456 -i ~/.age/keys.txt message.txt
 
 `
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/soatok/freeon/coordinator/internal"
+)
+
+const adminUsage = `Usage: coordinator admin <command> [options]
+
+Manage who may do what to a key group. This works on the coordinator's database directly, so only whoever runs the
+coordinator can do it.
+
+Commands:
+  grant         Make a member an administrator of their group
+  revoke        Take a member's administrator role away
+  token         Issue an API token; it is printed once and never stored
+  revoke-token  Revoke an API token
+  list          List a group's administrators and API tokens
+
+Options:
+  -g, --group   Group ID (required)
+  -p, --party   Party ID of a member (grant, revoke)
+  -l, --label   A name for the API token, unique within the group (token, revoke-token)
+  -r, --role    proposer or admin (token; default: proposer)
+
+Members can always propose signing ceremonies. Proposer tokens can only propose, so a CI pipeline can queue ceremonies
+without being able to terminate them. Administrators can terminate ceremonies and archive the group.`
+
+// CMD: `coordinator admin ...`
+func runAdmin(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "%s\n", adminUsage)
+		return 1
+	}
+	command := args[0]
+
+	// Parse CLI arguments:
+	fs := flag.NewFlagSet("admin "+command, flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", adminUsage) }
+	groupID := fs.String("g", "", "Group ID")
+	groupIDLong := fs.String("group", "", "Group ID")
+	partyID := fs.Uint("p", 0, "Party ID")
+	partyIDLong := fs.Uint("party", 0, "Party ID")
+	label := fs.String("l", "", "Token label")
+	labelLong := fs.String("label", "", "Token label")
+	role := fs.String("r", internal.RoleProposer, "Token role")
+	roleLong := fs.String("role", "", "Token role")
+	fs.Parse(args[1:])
+
+	// Merge short/long flags
+	if *groupIDLong != "" {
+		*groupID = *groupIDLong
+	}
+	if *partyIDLong != 0 {
+		*partyID = *partyIDLong
+	}
+	if *labelLong != "" {
+		*label = *labelLong
+	}
+	if *roleLong != "" {
+		*role = *roleLong
+	}
+
+	// Input validation
+	if *groupID == "" {
+		fmt.Fprintf(os.Stderr, "Error: -g/--group is required\n")
+		fs.Usage()
+		return 1
+	}
+	if (command == "grant" || command == "revoke") && (*partyID == 0 || *partyID > 65535) {
+		fmt.Fprintf(os.Stderr, "Error: -p/--party must be a party ID\n")
+		return 1
+	}
+
+	var err error
+	switch command {
+	case "grant":
+		err = internal.GrantMemberRole(db, *groupID, uint16(*partyID), internal.RoleAdmin)
+		if err == nil {
+			fmt.Printf("Party %d is now an administrator of %s.\n", *partyID, *groupID)
+		}
+	case "revoke":
+		err = internal.RevokeMemberRole(db, *groupID, uint16(*partyID), internal.RoleAdmin)
+		if err == nil {
+			fmt.Printf("Party %d is no longer an administrator of %s.\n", *partyID, *groupID)
+		}
+	case "token":
+		var token string
+		token, err = internal.IssueApiToken(db, *groupID, *label, *role)
+		if err == nil {
+			fmt.Println(token)
+		}
+	case "revoke-token":
+		err = internal.RevokeApiToken(db, *groupID, *label)
+		if err == nil {
+			fmt.Printf("Revoked token %q.\n", *label)
+		}
+	case "list":
+		var members []internal.FreeonMemberRole
+		var tokens []internal.FreeonApiToken
+		members, tokens, err = internal.GetGroupRoles(db, *groupID)
+		if err == nil {
+			for _, m := range members {
+				fmt.Printf("party %d\t%s\n", m.PartyID, m.Role)
+			}
+			for _, t := range tokens {
+				fmt.Printf("token %q\t%s\tissued %s\n", t.Label, t.Role, time.Unix(t.Created, 0).Format(time.RFC3339))
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown admin command: %s\n\n", command)
+		fs.Usage()
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
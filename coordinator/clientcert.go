@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/soatok/freeon/coordinator/internal"
+)
+
+// Clients that present a certificate have to sign their requests with the certificate's key, and the handlers check
+// that key against the participant the request claims to be from. Unsigned requests pass straight through, and so do
+// clients without a certificate, unless client-ca says everyone needs one (in which case TLS already turned them away).
+func bindClientCertificates(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature := r.Header.Get(internal.SignatureHeader)
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 || signature == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, err)
+			return
+		}
+		if err := internal.VerifyClientCertificate(r.TLS.PeerCertificates[0], r.URL.Path, body, signature); err != nil {
+			sendError(w, err)
+			return
+		}
+		// The handler still has to read it
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Clients sign every request body with the key they registered at /keygen/join.
+//
+// The header holds when the request was signed (in Unix seconds), a random nonce, and the hex-encoded signature,
+// separated by dots. Each nonce is only accepted once, and only within ReplayWindow of when it was signed, so a
+// request someone captured can't be sent again.
+const SignatureHeader = "Freeon-Signature"
+
+// Long enough for an offline client's requests to make it to the relay
+const ReplayWindow = 24 * time.Hour
+
+// How far ahead of ours a client's clock can be
+const maxClockSkew = 5 * time.Minute
+
+// Domain separation for request signatures
+var requestSignaturePrefix = []byte("FREEON Request v2")
+
+// Returned when a request cannot be tied to a registered participant
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Returned when a signed request has already been seen
+var ErrReplayed = fmt.Errorf("%w: request was already used", ErrUnauthorized)
+
+// The bytes that are actually signed for a request.
+//
+// The path is included so that a signed body for one endpoint cannot be replayed against another.
+func RequestSigningPayload(path string, signedAt int64, nonce string, body []byte) []byte {
+	payload := make([]byte, 0, len(requestSignaturePrefix)+len(path)+len(nonce)+len(body)+24)
+	payload = append(payload, requestSignaturePrefix...)
+	payload = append(payload, 0)
+	payload = append(payload, []byte(path)...)
+	payload = append(payload, 0)
+	payload = strconv.AppendInt(payload, signedAt, 10)
+	payload = append(payload, 0)
+	payload = append(payload, []byte(nonce)...)
+	payload = append(payload, 0)
+	payload = append(payload, body...)
+	return payload
+}
+
+// What a client put in the signature header
+type requestSignature struct {
+	signedAt  int64
+	nonce     string
+	signature []byte
+}
+
+func parseSignatureHeader(header string) (requestSignature, error) {
+	if header == "" {
+		return requestSignature{}, fmt.Errorf("%w: missing %s header", ErrUnauthorized, SignatureHeader)
+	}
+	parts := strings.Split(header, ".")
+	if len(parts) != 3 {
+		return requestSignature{}, fmt.Errorf("%w: malformed signature", ErrUnauthorized)
+	}
+	signedAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return requestSignature{}, fmt.Errorf("%w: malformed signature", ErrUnauthorized)
+	}
+	// 128 bits of randomness, hex-encoded
+	if nonce, err := hex.DecodeString(parts[1]); err != nil || len(nonce) < 16 {
+		return requestSignature{}, fmt.Errorf("%w: malformed nonce", ErrUnauthorized)
+	}
+	signature, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return requestSignature{}, fmt.Errorf("%w: malformed signature", ErrUnauthorized)
+	}
+	return requestSignature{signedAt: signedAt, nonce: parts[1], signature: signature}, nil
+}
+
+// Parse a hex-encoded Ed25519 public key
+func ParsePublicKey(publicKeyHex string) (ed25519.PublicKey, error) {
+	raw, err := hex.DecodeString(publicKeyHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key: must be 32 bytes")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Verify a request signature against a hex-encoded Ed25519 public key, and make sure it's recent.
+// This doesn't use up the nonce; see AuthenticateRequest.
+func VerifyRequestSignature(publicKeyHex, path string, body []byte, header string) error {
+	publicKey, err := ParsePublicKey(publicKeyHex)
+	if err != nil {
+		return err
+	}
+	sig, err := parseSignatureHeader(header)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, RequestSigningPayload(path, sig.signedAt, sig.nonce, body), sig.signature) {
+		return fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+	}
+	signedAt := time.Unix(sig.signedAt, 0)
+	now := time.Now()
+	if signedAt.Before(now.Add(-ReplayWindow)) || signedAt.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("%w: request was signed at %s, too far from now", ErrUnauthorized, signedAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Verify a request signature, and use up its nonce so the request can't be sent again
+func AuthenticateRequest(db Storage, publicKeyHex, path string, body []byte, header string) error {
+	if err := VerifyRequestSignature(publicKeyHex, path, body, header); err != nil {
+		return err
+	}
+	// Only a verified signature gets to take up space
+	sig, _ := parseSignatureHeader(header)
+	return db.UseNonce(sig.nonce, time.Unix(sig.signedAt, 0).Add(ReplayWindow))
+}
+
+// Make sure a request was signed by the participant it claims to come from
+func AuthenticateParticipant(db Storage, groupUid string, myPartyID uint16, path string, body []byte, signature string) error {
+	publicKey, err := db.GetParticipantPublicKey(groupUid, myPartyID)
+	if err != nil {
+		return fmt.Errorf("%w: unknown participant %d", ErrUnauthorized, myPartyID)
+	}
+	return AuthenticateRequest(db, publicKey, path, body, signature)
+}
+
+// Like AuthenticateParticipant, but the group is looked up from a signing ceremony
+func AuthenticateCeremonyParticipant(db Storage, ceremonyUid string, myPartyID uint16, path string, body []byte, signature string) error {
+	ceremony, err := db.GetCeremonyData(ceremonyUid)
+	if err != nil {
+		return err
+	}
+	group, err := db.GetGroupByID(ceremony.GroupID)
+	if err != nil {
+		return err
+	}
+	return AuthenticateParticipant(db, group.Uid, myPartyID, path, body, signature)
+}
+
+// Like AuthenticateParticipant, but the group is looked up from a refresh
+func AuthenticateRefreshParticipant(db Storage, refreshUid string, myPartyID uint16, path string, body []byte, signature string) error {
+	refresh, err := db.GetRefreshData(refreshUid)
+	if err != nil {
+		return err
+	}
+	group, err := db.GetGroupByID(refresh.GroupID)
+	if err != nil {
+		return err
+	}
+	return AuthenticateParticipant(db, group.Uid, myPartyID, path, body, signature)
+}
+
+// Like AuthenticateParticipant, but for anyone who has joined a reshare.
+// Newcomers aren't group members until the reshare is complete, so the group's participant list won't do.
+func AuthenticateReshareParticipant(db Storage, reshareUid string, myPartyID uint16, path string, body []byte, signature string) error {
+	resharer, err := getResharer(db, reshareUid, myPartyID)
+	if err != nil {
+		return fmt.Errorf("%w: unknown participant %d", ErrUnauthorized, myPartyID)
+	}
+	return AuthenticateRequest(db, resharer.PublicKey, path, body, signature)
+}
@@ -0,0 +1,107 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeypair(t *testing.T) (string, ed25519.PrivateKey) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	return hex.EncodeToString(pk), sk
+}
+
+func newTestPublicKey(t *testing.T) string {
+	pk, _ := newTestKeypair(t)
+	return pk
+}
+
+func signTestRequest(sk ed25519.PrivateKey, path string, body []byte) string {
+	return signTestRequestAt(sk, path, body, time.Now())
+}
+
+func signTestRequestAt(sk ed25519.PrivateKey, path string, body []byte, signedAt time.Time) string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	nonceHex := hex.EncodeToString(nonce)
+	sig := ed25519.Sign(sk, internal.RequestSigningPayload(path, signedAt.Unix(), nonceHex, body))
+	return fmt.Sprintf("%d.%s.%s", signedAt.Unix(), nonceHex, hex.EncodeToString(sig))
+}
+
+func TestVerifyRequestSignature(t *testing.T) {
+	pk, sk := newTestKeypair(t)
+	body := []byte(`{"group-id":"g_test"}`)
+	sig := signTestRequest(sk, "/keygen/send", body)
+
+	assert.NoError(t, internal.VerifyRequestSignature(pk, "/keygen/send", body, sig))
+
+	// Different path, body, or key must all fail
+	assert.ErrorIs(t, internal.VerifyRequestSignature(pk, "/sign/send", body, sig), internal.ErrUnauthorized)
+	assert.ErrorIs(t, internal.VerifyRequestSignature(pk, "/keygen/send", []byte(`{}`), sig), internal.ErrUnauthorized)
+	assert.ErrorIs(t, internal.VerifyRequestSignature(newTestPublicKey(t), "/keygen/send", body, sig), internal.ErrUnauthorized)
+	assert.ErrorIs(t, internal.VerifyRequestSignature(pk, "/keygen/send", body, ""), internal.ErrUnauthorized)
+
+	// Malformed public keys are rejected outright
+	assert.Error(t, internal.VerifyRequestSignature("abcd", "/keygen/send", body, sig))
+
+	// So are stale requests, and ones from too far in the future
+	stale := signTestRequestAt(sk, "/keygen/send", body, time.Now().Add(-internal.ReplayWindow-time.Minute))
+	assert.ErrorIs(t, internal.VerifyRequestSignature(pk, "/keygen/send", body, stale), internal.ErrUnauthorized)
+	early := signTestRequestAt(sk, "/keygen/send", body, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, internal.VerifyRequestSignature(pk, "/keygen/send", body, early), internal.ErrUnauthorized)
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	db := setupTestDBForSign(t)
+	pk, sk := newTestKeypair(t)
+	body := []byte(`{"group-id":"g_test"}`)
+	sig := signTestRequest(sk, "/keygen/send", body)
+
+	// A signed request can only be used once
+	assert.NoError(t, internal.AuthenticateRequest(db, pk, "/keygen/send", body, sig))
+	assert.ErrorIs(t, internal.AuthenticateRequest(db, pk, "/keygen/send", body, sig), internal.ErrReplayed)
+	assert.NoError(t, internal.AuthenticateRequest(db, pk, "/keygen/send", body, signTestRequest(sk, "/keygen/send", body)))
+
+	// Bad signatures don't burn the nonce
+	forged := signTestRequest(sk, "/keygen/send", body)
+	assert.ErrorIs(t, internal.AuthenticateRequest(db, pk, "/sign/send", body, forged), internal.ErrUnauthorized)
+	assert.NoError(t, internal.AuthenticateRequest(db, pk, "/keygen/send", body, forged))
+}
+
+func TestAuthenticateParticipant(t *testing.T) {
+	db := setupTestDBForKeygen(t)
+	g_uid, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+
+	pk1, sk1 := newTestKeypair(t)
+	_, sk2 := newTestKeypair(t)
+	p1, err := internal.AddParticipant(db, g_uid, pk1)
+	assert.NoError(t, err)
+
+	body := []byte(`{"message":"hello"}`)
+	err = internal.AuthenticateParticipant(db, g_uid, p1.PartyID, "/keygen/send", body, signTestRequest(sk1, "/keygen/send", body))
+	assert.NoError(t, err)
+
+	// Someone else cannot claim to be party 1
+	err = internal.AuthenticateParticipant(db, g_uid, p1.PartyID, "/keygen/send", body, signTestRequest(sk2, "/keygen/send", body))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+
+	// Nor can they claim a party ID that was never registered
+	err = internal.AuthenticateParticipant(db, g_uid, 2, "/keygen/send", body, signTestRequest(sk2, "/keygen/send", body))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+
+	// The same checks apply through a signing ceremony
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+	err = internal.AuthenticateCeremonyParticipant(db, c_uid, p1.PartyID, "/sign/send", body, signTestRequest(sk1, "/sign/send", body))
+	assert.NoError(t, err)
+	err = internal.AuthenticateCeremonyParticipant(db, c_uid, p1.PartyID, "/sign/send", body, signTestRequest(sk2, "/sign/send", body))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+}
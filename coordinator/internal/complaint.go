@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/bytemare/dkg"
+	secretsharing "github.com/bytemare/secret-sharing"
+)
+
+// The coordinator normally just relays keygen messages. It only opens them to settle complaints.
+// This mirrors the envelope the client wraps every keygen message in.
+type keygenEnvelope struct {
+	Type         string `json:"type"`
+	Sender       uint16 `json:"sender"`
+	Recipient    uint16 `json:"recipient,omitempty"`
+	AgeRecipient string `json:"age-recipient,omitempty"`
+	Payload      string `json:"payload"`
+}
+
+const (
+	envelopeDKGRound1 = "dkg-r1"
+	envelopeDKGRound2 = "dkg-r2"
+)
+
+// File a party's complaint report for the DKG.
+//
+// Every party files exactly one report once it has checked its round 2 shares, even if it has nothing to complain
+// about. Each complaint comes with the complainer's ephemeral age identity for this ceremony, so the coordinator can
+// open the disputed share and decide who is lying. Any complaint aborts the ceremony with a verdict.
+func FileComplaint(db Storage, groupUid string, myPartyID uint16, accused []uint16, evidence string) error {
+	group, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return err
+	}
+	if group.Status == GroupStatusComplete {
+		return errors.New("key generation is already complete")
+	}
+	reporter, err := db.GetParticipantID(groupUid, myPartyID)
+	if err != nil {
+		return err
+	}
+	reporters, err := db.GetComplaintReporters(groupUid)
+	if err != nil {
+		return err
+	}
+	for _, r := range reporters {
+		if r == myPartyID {
+			return errors.New("complaint report already filed")
+		}
+	}
+
+	if len(accused) == 0 {
+		_, err = db.InsertComplaint(FreeonComplaint{
+			GroupID:  group.DbId,
+			Reporter: reporter,
+		})
+		return err
+	}
+
+	var findings []string
+	for _, a := range accused {
+		if a == myPartyID {
+			return errors.New("parties cannot complain about themselves")
+		}
+		accusedID, err := db.GetParticipantID(groupUid, a)
+		if err != nil {
+			return fmt.Errorf("party %d is not a participant in this group", a)
+		}
+		finding, err := AdjudicateComplaint(db, groupUid, myPartyID, a, evidence)
+		if err != nil {
+			return err
+		}
+		_, err = db.InsertComplaint(FreeonComplaint{
+			GroupID:  group.DbId,
+			Reporter: reporter,
+			Accused:  &accusedID,
+			Evidence: &evidence,
+		})
+		if err != nil {
+			return err
+		}
+		findings = append(findings, finding)
+	}
+
+	verdict := strings.Join(findings, "; ")
+	if group.Verdict != nil {
+		verdict = *group.Verdict + "; " + verdict
+	}
+	return db.AbortGroup(group, verdict)
+}
+
+// Decide whether the accused dealer sent the accuser a bad share, or the accuser is lying.
+// Returns a human-readable finding that names the guilty party.
+func AdjudicateComplaint(db Storage, groupUid string, accuser, accused uint16, evidence string) (string, error) {
+	identity, err := age.ParseX25519Identity(evidence)
+	if err != nil {
+		return fmt.Sprintf("party %d complained about party %d without revealing a valid round 2 key", accuser, accused), nil
+	}
+
+	// The revealed key must be the one the accuser advertised, or they could frame anyone
+	accuserMessages, err := db.GetKeygenMessagesFrom(groupUid, accuser)
+	if err != nil {
+		return "", err
+	}
+	accuserR1, err := firstEnvelope(accuserMessages, envelopeDKGRound1, accuser, 0)
+	if err != nil || accuserR1.AgeRecipient != identity.Recipient().String() {
+		return fmt.Sprintf("party %d complained about party %d with a key that does not match their round 1 message", accuser, accused), nil
+	}
+
+	accusedMessages, err := db.GetKeygenMessagesFrom(groupUid, accused)
+	if err != nil {
+		return "", err
+	}
+	guilty := func(what string) (string, error) {
+		return fmt.Sprintf("party %d %s to party %d", accused, what, accuser), nil
+	}
+	r1Envelope, err := firstEnvelope(accusedMessages, envelopeDKGRound1, accused, 0)
+	if err != nil {
+		return guilty("sent no round 1 commitment")
+	}
+	r1Raw, err := hex.DecodeString(r1Envelope.Payload)
+	if err != nil {
+		return guilty("sent a malformed round 1 commitment")
+	}
+	r1 := &dkg.Round1Data{}
+	if err := r1.Decode(r1Raw); err != nil || r1.SenderIdentifier != accused {
+		return guilty("sent a malformed round 1 commitment")
+	}
+
+	r2Envelope, err := firstEnvelope(accusedMessages, envelopeDKGRound2, accused, accuser)
+	if err != nil {
+		return guilty("sent no round 2 share")
+	}
+	sealed, err := hex.DecodeString(r2Envelope.Payload)
+	if err != nil {
+		return guilty("sent a round 2 share that could not be decrypted")
+	}
+	r, err := age.Decrypt(bytes.NewReader(sealed), identity)
+	if err != nil {
+		return guilty("sent a round 2 share that could not be decrypted")
+	}
+	r2Raw, err := io.ReadAll(r)
+	if err != nil {
+		return guilty("sent a round 2 share that could not be decrypted")
+	}
+	r2 := &dkg.Round2Data{}
+	if err := r2.Decode(r2Raw); err != nil || r2.SenderIdentifier != accused || r2.RecipientIdentifier != accuser {
+		return guilty("sent a malformed round 2 share")
+	}
+
+	g := dkg.Edwards25519Sha512.Group()
+	pk := g.Base().Multiply(r2.SecretShare)
+	if !secretsharing.Verify(g, accuser, pk, r1.Commitment) {
+		return guilty("sent an invalid round 2 share")
+	}
+	return fmt.Sprintf("party %d filed a false complaint about party %d", accuser, accused), nil
+}
+
+// Find the first envelope of a given type from a sender, in the order the coordinator received them.
+// For round 2, only envelopes addressed to the recipient are considered.
+func firstEnvelope(messages []FreeonKeygenMessage, envelopeType string, sender, recipient uint16) (keygenEnvelope, error) {
+	for _, m := range messages {
+		var e keygenEnvelope
+		if err := json.Unmarshal(m.Message, &e); err != nil {
+			continue
+		}
+		if e.Type != envelopeType || e.Sender != sender || e.Recipient != recipient {
+			continue
+		}
+		return e, nil
+	}
+	return keygenEnvelope{}, fmt.Errorf("no %s envelope from party %d", envelopeType, sender)
+}
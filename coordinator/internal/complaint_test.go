@@ -0,0 +1,136 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/bytemare/dkg"
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run both DKG rounds for a 2-of-3 group through the coordinator's message queue.
+// If cheat is set, party 3 sends party 1 a corrupted share.
+func setupComplaintGroup(t *testing.T, cheat bool) (internal.Storage, string, []*age.X25519Identity) {
+	db := setupTestDBForKeygen(t)
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
+	assert.NoError(t, err)
+
+	var participants []*dkg.Participant
+	var ephemeral []*age.X25519Identity
+	var r1Data []*dkg.Round1Data
+	for i := 0; i < 3; i++ {
+		p, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+		assert.NoError(t, err)
+		participant, err := dkg.Edwards25519Sha512.NewParticipant(p.PartyID, 2, 3)
+		assert.NoError(t, err)
+		eph, err := age.GenerateX25519Identity()
+		assert.NoError(t, err)
+		participants = append(participants, participant)
+		ephemeral = append(ephemeral, eph)
+
+		r1 := participant.Start()
+		r1Data = append(r1Data, r1)
+		sendTestEnvelope(t, db, g_uid, p.PartyID, map[string]any{
+			"type":          "dkg-r1",
+			"sender":        p.PartyID,
+			"age-recipient": eph.Recipient().String(),
+			"payload":       hex.EncodeToString(r1.Encode()),
+		})
+	}
+
+	for _, participant := range participants {
+		r2, err := participant.Continue(r1Data)
+		assert.NoError(t, err)
+		for peer, msg := range r2 {
+			if cheat && msg.SenderIdentifier == 3 && peer == 1 {
+				msg.SecretShare.Add(dkg.Edwards25519Sha512.Group().NewScalar().One())
+			}
+			var sealed bytes.Buffer
+			w, err := age.Encrypt(&sealed, ephemeral[peer-1].Recipient())
+			assert.NoError(t, err)
+			_, err = w.Write(msg.Encode())
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+			sendTestEnvelope(t, db, g_uid, msg.SenderIdentifier, map[string]any{
+				"type":      "dkg-r2",
+				"sender":    msg.SenderIdentifier,
+				"recipient": peer,
+				"payload":   hex.EncodeToString(sealed.Bytes()),
+			})
+		}
+	}
+	return db, g_uid, ephemeral
+}
+
+func sendTestEnvelope(t *testing.T, db internal.Storage, groupUid string, sender uint16, envelope map[string]any) {
+	encoded, err := json.Marshal(envelope)
+	assert.NoError(t, err)
+	_, err = internal.AddKeyGenMessage(db, groupUid, sender, encoded)
+	assert.NoError(t, err)
+}
+
+func TestFileComplaintNoComplaints(t *testing.T) {
+	db, g_uid, _ := setupComplaintGroup(t, false)
+	for p := uint16(1); p <= 3; p++ {
+		err := internal.FileComplaint(db, g_uid, p, nil, "")
+		assert.NoError(t, err)
+	}
+	reporters, err := db.GetComplaintReporters(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 3}, reporters)
+
+	// Only one report per party
+	err = internal.FileComplaint(db, g_uid, 1, nil, "")
+	assert.Error(t, err)
+
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusOpen, group.Status)
+	assert.Nil(t, group.Verdict)
+
+	err = internal.SetGroupPublicKey(db, g_uid, "test_pk")
+	assert.NoError(t, err)
+	group, err = db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusComplete, group.Status)
+}
+
+func TestFileComplaintInvalidShare(t *testing.T) {
+	db, g_uid, ephemeral := setupComplaintGroup(t, true)
+	err := internal.FileComplaint(db, g_uid, 1, []uint16{3}, ephemeral[0].String())
+	assert.NoError(t, err)
+
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusAborted, group.Status)
+	assert.Equal(t, "party 3 sent an invalid round 2 share to party 1", *group.Verdict)
+
+	// Aborted groups cannot be finalized, and take no more messages
+	err = internal.SetGroupPublicKey(db, g_uid, "test_pk")
+	assert.Error(t, err)
+	_, err = internal.AddKeyGenMessage(db, g_uid, 2, testEnvelope(2))
+	assert.Error(t, err)
+}
+
+func TestFileComplaintFalseAccusation(t *testing.T) {
+	db, g_uid, ephemeral := setupComplaintGroup(t, false)
+
+	// Party 2's share to party 1 is fine
+	err := internal.FileComplaint(db, g_uid, 1, []uint16{2}, ephemeral[0].String())
+	assert.NoError(t, err)
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusAborted, group.Status)
+	assert.Equal(t, "party 1 filed a false complaint about party 2", *group.Verdict)
+
+	// Party 3 cannot reveal someone else's key to frame party 2
+	err = internal.FileComplaint(db, g_uid, 3, []uint16{2}, ephemeral[0].String())
+	assert.NoError(t, err)
+	group, err = db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Contains(t, *group.Verdict, "party 3 complained about party 2 with a key that does not match their round 1 message")
+}
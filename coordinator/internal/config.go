@@ -2,14 +2,47 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // This may expand in future versions
 type CoordinatorConfig struct {
 	Hostname string `json:"hostname"`
 	Database string `json:"database"`
+	// How long key generation and signing ceremonies stay open, unless whoever creates one asks otherwise
+	Deadline string `json:"deadline,omitempty"`
+	// The longest anyone can ask for
+	MaxDeadline string `json:"max-deadline,omitempty"`
+	// How long to keep the messages from an expired ceremony, after its deadline
+	Retention string `json:"retention,omitempty"`
+	// PEM files for serving HTTPS. Without them, the coordinator speaks plain HTTP, and belongs on a private network.
+	TLSCert string `json:"tls-cert,omitempty"`
+	TLSKey  string `json:"tls-key,omitempty"`
+	// Generate a self-signed certificate into tls-cert and tls-key, if they don't exist yet
+	TLSSelfSigned bool `json:"tls-self-signed,omitempty"`
+	// Ask clients for a certificate. Whoever presents one has to sign their requests with the same key.
+	ClientCerts bool `json:"client-certs,omitempty"`
+	// A PEM file of the CAs that issue client certificates. With it, every client has to present a certificate one of
+	// them signed, and still sign their requests with its key.
+	ClientCA string `json:"client-ca,omitempty"`
+}
+
+// Time limits, as read from the config
+type Deadlines struct {
+	Default   time.Duration
+	Max       time.Duration
+	Retention time.Duration
+}
+
+// Defaults for configs that predate deadlines
+var defaultDeadlines = Deadlines{
+	Default:   24 * time.Hour,
+	Max:       7 * 24 * time.Hour,
+	Retention: 7 * 24 * time.Hour,
 }
 
 func getConfigFile() (string, error) {
@@ -26,8 +59,11 @@ func getConfigFile() (string, error) {
 // Default user config
 func NewServerConfig() (CoordinatorConfig, error) {
 	config := CoordinatorConfig{
-		Hostname: "localhost:8462",
-		Database: "./database.sqlite",
+		Hostname:    "localhost:8462",
+		Database:    "./database.sqlite",
+		Deadline:    defaultDeadlines.Default.String(),
+		MaxDeadline: defaultDeadlines.Max.String(),
+		Retention:   defaultDeadlines.Retention.String(),
 	}
 	err := config.Save()
 	if err != nil {
@@ -75,3 +111,47 @@ func (cfg CoordinatorConfig) Save() error {
 	encoder.SetIndent("", "    ") // pretty-print
 	return encoder.Encode(cfg)
 }
+
+// Parse the config's time limits (e.g. "24h"), falling back to the defaults for any that aren't set
+func (cfg CoordinatorConfig) Deadlines() (Deadlines, error) {
+	d := defaultDeadlines
+	for _, field := range []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{
+		{"deadline", cfg.Deadline, &d.Default},
+		{"max-deadline", cfg.MaxDeadline, &d.Max},
+		{"retention", cfg.Retention, &d.Retention},
+	} {
+		if field.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(field.value)
+		if err != nil {
+			return Deadlines{}, fmt.Errorf("%s: %w", field.name, err)
+		}
+		if parsed <= 0 {
+			return Deadlines{}, fmt.Errorf("%s must be positive", field.name)
+		}
+		*field.into = parsed
+	}
+	if d.Default > d.Max {
+		return Deadlines{}, errors.New("deadline cannot exceed max-deadline")
+	}
+	return d, nil
+}
+
+// How long a new ceremony gets, given what its creator asked for (in seconds; zero for the default)
+func (d Deadlines) For(requested int64) (time.Duration, error) {
+	if requested < 0 {
+		return 0, errors.New("deadline must be positive")
+	}
+	if requested == 0 {
+		return d.Default, nil
+	}
+	if requested > int64(d.Max/time.Second) {
+		return 0, fmt.Errorf("deadline cannot be more than %s", d.Max)
+	}
+	return time.Duration(requested) * time.Second, nil
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/soatok/freeon/coordinator/internal"
 	"github.com/stretchr/testify/assert"
@@ -45,3 +46,34 @@ func TestServerConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, loadedConfig, savedConfig)
 }
+
+func TestServerConfigDeadlines(t *testing.T) {
+	// Configs from before deadlines existed get the defaults
+	d, err := internal.CoordinatorConfig{}.Deadlines()
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, d.Default)
+	assert.Equal(t, 7*24*time.Hour, d.Max)
+	assert.Equal(t, 7*24*time.Hour, d.Retention)
+
+	d, err = internal.CoordinatorConfig{Deadline: "1h", MaxDeadline: "2h", Retention: "30m"}.Deadlines()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, d.Default)
+	assert.Equal(t, 30*time.Minute, d.Retention)
+
+	_, err = internal.CoordinatorConfig{Deadline: "tomorrow"}.Deadlines()
+	assert.Error(t, err)
+	_, err = internal.CoordinatorConfig{Deadline: "3h", MaxDeadline: "2h"}.Deadlines()
+	assert.Error(t, err)
+
+	// What a ceremony's creator asks for, in seconds
+	deadline, err := d.For(0)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, deadline)
+	deadline, err = d.For(600)
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, deadline)
+	_, err = d.For(3 * 60 * 60)
+	assert.Error(t, err)
+	_, err = d.For(-1)
+	assert.Error(t, err)
+}
@@ -1,9 +1,19 @@
 package internal
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/ncruces/go-sqlite3/driver"
+	_ "github.com/ncruces/go-sqlite3/embed"
 )
 
 type DBTX interface {
@@ -13,20 +23,312 @@ type DBTX interface {
 	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
-func DbEnsureTablesExist(db *sql.DB) error {
-	createTable := `
+// The SQL dialects we speak. Queries are written for SQLite, and translated for Postgres on the way out.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// How many times to run a transaction that keeps losing out to concurrent ones
+const maxTransactionAttempts = 10
+
+// A Storage backed by a SQL database.
+// Inside a transaction, db is the transaction and root is nil.
+type sqlStorage struct {
+	root    *sql.DB
+	db      DBTX
+	dialect dialect
+}
+
+// Store everything in a SQLite database, creating any tables that don't exist yet
+func NewSQLiteStorage(db *sql.DB) (Storage, error) {
+	return newSQLStorage(db, dialectSQLite)
+}
+
+// Store everything in a Postgres database, creating any tables that don't exist yet.
+// db has to come from the pgx driver.
+func NewPostgresStorage(db *sql.DB) (Storage, error) {
+	return newSQLStorage(db, dialectPostgres)
+}
+
+func newSQLStorage(db *sql.DB, d dialect) (*sqlStorage, error) {
+	s := &sqlStorage{root: db, db: d.wrap(db), dialect: d}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Bring the database's schema up to date.
+//
+// A new database gets the whole schema at once. An older one gets the migrations it hasn't had yet, one transaction
+// each, and then any tables that are newer than it is. A database from a newer coordinator than this one is left alone.
+func (s *sqlStorage) migrate() error {
+	if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS schemaversion (version INTEGER NOT NULL)"); err != nil {
+		return err
+	}
+	version, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("the database is at schema version %d, but this coordinator only knows up to %d", version, len(migrations))
+	}
+	for ; version < len(migrations); version++ {
+		err := s.atomically(func(db DBTX) error {
+			if _, err := db.Exec(s.dialect.translate(migrations[version])); err != nil {
+				return fmt.Errorf("migrating the database to schema version %d: %w", version+1, err)
+			}
+			return setSchemaVersion(db, version+1)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = s.db.Exec(s.dialect.translate(schema))
+	return err
+}
+
+// Which version of the schema the database is at. One that predates versioning is at 0, and an empty one is treated
+// as already up to date, since the schema creates it that way.
+func (s *sqlStorage) schemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow("SELECT version FROM schemaversion").Scan(&version)
+	if err == nil {
+		return version, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	exists, err := s.dialect.tableExists(s.db, "keygroups")
+	if err != nil || exists {
+		return 0, err
+	}
+	return len(migrations), setSchemaVersion(s.db, len(migrations))
+}
+
+func setSchemaVersion(db DBTX, version int) error {
+	if _, err := db.Exec("DELETE FROM schemaversion"); err != nil {
+		return err
+	}
+	_, err := db.Exec("INSERT INTO schemaversion (version) VALUES (?)", version)
+	return err
+}
+
+func (s *sqlStorage) Close() error {
+	if s.root == nil {
+		return errors.New("cannot close a transaction")
+	}
+	return s.root.Close()
+}
+
+func (s *sqlStorage) Atomically(fn func(tx Storage) error) error {
+	return s.atomically(func(db DBTX) error {
+		return fn(&sqlStorage{db: db, dialect: s.dialect})
+	})
+}
+
+func (s *sqlStorage) atomically(fn func(db DBTX) error) error {
+	if s.root == nil {
+		// Already in a transaction
+		return fn(s.db)
+	}
+	var err error
+	for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+		err = s.transaction(fn)
+		if !s.dialect.shouldRetry(err) {
+			break
+		}
+	}
+	return err
+}
+
+func (s *sqlStorage) transaction(fn func(db DBTX) error) error {
+	var opts sql.TxOptions
+	if s.dialect == dialectPostgres {
+		// SQLite only lets one transaction write at a time anyway
+		opts.Isolation = sql.LevelSerializable
+	}
+	tx, err := s.root.BeginTx(context.Background(), &opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if err := fn(s.dialect.wrap(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Insert a row, and return its ID. Postgres doesn't do LastInsertId, but both of them do RETURNING.
+func (s *sqlStorage) insert(query string, args ...any) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(query+" RETURNING id", args...).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Run an UPDATE or DELETE, and fail with notFound if it didn't touch anything
+func (s *sqlStorage) change(notFound error, query string, args ...any) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// Run a query that returns a column of IDs
+func (s *sqlStorage) collectUids(query string, args ...any) ([]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var uids []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	return uids, rows.Err()
+}
+
+func (d dialect) wrap(db DBTX) DBTX {
+	if d == dialectPostgres {
+		return postgresDB{db}
+	}
+	return db
+}
+
+// Postgres spells a few column types differently; the rest of the schema works for both
+func (d dialect) translate(ddl string) string {
+	if d == dialectPostgres {
+		return strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+			"INTEGER", "BIGINT",
+		).Replace(ddl)
+	}
+	return ddl
+}
+
+func (d dialect) tableExists(db DBTX, table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if d == dialectPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	var count int
+	err := db.QueryRow(query, table).Scan(&count)
+	return count > 0, err
+}
+
+// Whether a transaction failed because of a concurrent one, and is worth running again
+func (d dialect) shouldRetry(err error) bool {
+	var pgErr *pgconn.PgError
+	if d != dialectPostgres || !errors.As(err, &pgErr) {
+		return false
+	}
+	// serialization_failure, deadlock_detected
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
+// Passes queries on to Postgres, with numbered placeholders instead of question marks
+type postgresDB struct {
+	db DBTX
+}
+
+func (p postgresDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return p.db.Exec(numberPlaceholders(query), args...)
+}
+
+func (p postgresDB) Prepare(query string) (*sql.Stmt, error) {
+	return p.db.Prepare(numberPlaceholders(query))
+}
+
+func (p postgresDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return p.db.Query(numberPlaceholders(query), args...)
+}
+
+func (p postgresDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return p.db.QueryRow(numberPlaceholders(query), args...)
+}
+
+// None of our queries have a question mark anywhere but in a placeholder
+func numberPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// Each migration takes the database from one schema version to the next, by adding columns to tables that were there
+// before. New tables don't need one: the schema creates whatever is missing after the migrations have run.
+//
+// Never change a migration once it's been released; add another one, and the same change to the schema below.
+var migrations = []string{
+	// 0 to 1: everything added since the original schema, which had no version
+	`
+	ALTER TABLE keygroups ADD COLUMN status TEXT DEFAULT 'open';
+	ALTER TABLE keygroups ADD COLUMN verdict TEXT NULL;
+	ALTER TABLE keygroups ADD COLUMN epoch INTEGER DEFAULT 0;
+	ALTER TABLE keygroups ADD COLUMN deadline INTEGER NULL;
+	ALTER TABLE participants ADD COLUMN publickey TEXT NULL;
+	ALTER TABLE participants ADD COLUMN active BOOLEAN DEFAULT TRUE;
+	ALTER TABLE ceremonies ADD COLUMN sshcert TEXT NULL;
+	ALTER TABLE ceremonies ADD COLUMN message TEXT NULL;
+	ALTER TABLE ceremonies ADD COLUMN epoch INTEGER DEFAULT 0;
+	ALTER TABLE ceremonies ADD COLUMN preferred TEXT NULL;
+	ALTER TABLE ceremonies ADD COLUMN locked BOOLEAN DEFAULT FALSE;
+	ALTER TABLE ceremonies ADD COLUMN deadline INTEGER NULL;
+	ALTER TABLE ceremonies ADD COLUMN expired BOOLEAN DEFAULT FALSE;
+	ALTER TABLE ceremonies ADD COLUMN published BOOLEAN DEFAULT FALSE;
+	ALTER TABLE ceremonies ADD COLUMN sealedmessage TEXT NULL;
+	ALTER TABLE ceremonies ADD COLUMN proposer TEXT NULL;
+	`,
+	// 1 to 2: why a ceremony was disputed
+	`
+	ALTER TABLE ceremonies ADD COLUMN verdict TEXT NULL;
+	`,
+}
+
+const schema = `
     CREATE TABLE IF NOT EXISTS keygroups (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
         uid TEXT NOT NULL,
 		participants INTEGER,
 		threshold INTEGER,
-		publickey TEXT NULL
+		publickey TEXT NULL,
+		status TEXT DEFAULT 'open',
+		verdict TEXT NULL,
+		epoch INTEGER DEFAULT 0,
+		deadline INTEGER NULL
     );
 	CREATE TABLE IF NOT EXISTS participants (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
         groupid INTEGER REFERENCES keygroups(id), 
 		uid TEXT NOT NULL,
-		partyid INTEGER
+		partyid INTEGER,
+		publickey TEXT NULL,
+		active BOOLEAN DEFAULT TRUE
 	);
 	CREATE TABLE IF NOT EXISTS ceremonies (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -35,8 +337,19 @@ func DbEnsureTablesExist(db *sql.DB) error {
 		active BOOLEAN DEFAULT TRUE,
 		openssh BOOLEAN DEFAULT FALSE,
 		opensshnamespace TEXT NULL,
+		sshcert TEXT NULL,
+		message TEXT NULL,
 		hash TEXT,
-		signature TEXT NULL
+		signature TEXT NULL,
+		epoch INTEGER DEFAULT 0,
+		preferred TEXT NULL,
+		locked BOOLEAN DEFAULT FALSE,
+		deadline INTEGER NULL,
+		expired BOOLEAN DEFAULT FALSE,
+		published BOOLEAN DEFAULT FALSE,
+		sealedmessage TEXT NULL,
+		proposer TEXT NULL,
+		verdict TEXT NULL
 	);
 	CREATE TABLE IF NOT EXISTS players (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -55,34 +368,100 @@ func DbEnsureTablesExist(db *sql.DB) error {
 		sender INTEGER REFERENCES participants(id),
 		message TEXT
 	);
-	`
-
-	_, err := db.Exec(createTable)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// Get the row ID for a given group
-func GetGroupRowId(db DBTX, groupUid string) (int, error) {
-	stmt, err := db.Prepare("SELECT id FROM keygroups WHERE uid = ?")
-	if err != nil {
-		return 0, err
-	}
-	defer stmt.Close()
-
-	var id int
-	err = stmt.QueryRow(groupUid).Scan(&id)
-	if err != nil {
-		return 0, err
-	}
-	return id, nil
-}
+	CREATE TABLE IF NOT EXISTS complaints (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		groupid INTEGER REFERENCES keygroups(id),
+		reporter INTEGER REFERENCES participants(id),
+		accused INTEGER NULL REFERENCES participants(id),
+		evidence TEXT NULL
+	);
+	CREATE TABLE IF NOT EXISTS keyconfirmations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		groupid INTEGER REFERENCES keygroups(id),
+		participantid INTEGER REFERENCES participants(id),
+		publickey TEXT
+	);
+	CREATE TABLE IF NOT EXISTS blames (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ceremonyid INTEGER REFERENCES ceremonies(id),
+		reporter INTEGER REFERENCES participants(id),
+		accused INTEGER REFERENCES participants(id),
+		reason TEXT
+	);
+	CREATE TABLE IF NOT EXISTS refreshes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		groupid INTEGER REFERENCES keygroups(id),
+		uid TEXT NOT NULL,
+		epoch INTEGER,
+		status TEXT DEFAULT 'open',
+		verdict TEXT NULL
+	);
+	CREATE TABLE IF NOT EXISTS refreshers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		refreshid INTEGER REFERENCES refreshes(id),
+		participantid INTEGER REFERENCES participants(id),
+		digest TEXT NULL
+	);
+	CREATE TABLE IF NOT EXISTS refreshmsg (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		refreshid INTEGER REFERENCES refreshes(id),
+		sender INTEGER REFERENCES participants(id),
+		message TEXT
+	);
+	CREATE TABLE IF NOT EXISTS reshares (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		groupid INTEGER REFERENCES keygroups(id),
+		uid TEXT NOT NULL,
+		epoch INTEGER,
+		participants INTEGER,
+		threshold INTEGER,
+		locked BOOLEAN DEFAULT FALSE,
+		status TEXT DEFAULT 'open',
+		verdict TEXT NULL
+	);
+	CREATE TABLE IF NOT EXISTS resharers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		reshareid INTEGER REFERENCES reshares(id),
+		participantid INTEGER REFERENCES participants(id),
+		dealer BOOLEAN,
+		recipient BOOLEAN,
+		digest TEXT NULL
+	);
+	CREATE TABLE IF NOT EXISTS reshareinvites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		reshareid INTEGER REFERENCES reshares(id),
+		publickey TEXT
+	);
+	CREATE TABLE IF NOT EXISTS resharemsg (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		reshareid INTEGER REFERENCES reshares(id),
+		sender INTEGER REFERENCES participants(id),
+		message TEXT
+	);
+	CREATE TABLE IF NOT EXISTS memberroles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		groupid INTEGER REFERENCES keygroups(id),
+		partyid INTEGER,
+		role TEXT,
+		UNIQUE(groupid, partyid, role)
+	);
+	CREATE TABLE IF NOT EXISTS apitokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		groupid INTEGER REFERENCES keygroups(id),
+		label TEXT NOT NULL,
+		role TEXT,
+		tokenhash TEXT NOT NULL UNIQUE,
+		created INTEGER,
+		UNIQUE(groupid, label)
+	);
+	CREATE TABLE IF NOT EXISTS nonces (
+		nonce TEXT PRIMARY KEY,
+		expires INTEGER
+	);
+`
 
-// Get the row ID for a given group
-func GetGroupData(db DBTX, groupUid string) (FreeonGroup, error) {
-	stmt, err := db.Prepare("SELECT id, threshold, participants, publicKey FROM keygroups WHERE uid = ?")
+func (s *sqlStorage) GetGroupData(groupUid string) (FreeonGroup, error) {
+	stmt, err := s.db.Prepare("SELECT id, threshold, participants, publicKey, status, verdict, epoch, deadline FROM keygroups WHERE uid = ?")
 	if err != nil {
 		return FreeonGroup{}, err
 	}
@@ -92,7 +471,11 @@ func GetGroupData(db DBTX, groupUid string) (FreeonGroup, error) {
 	var threshold uint16
 	var participants uint16
 	var publicKey *string
-	err = stmt.QueryRow(groupUid).Scan(&id, &threshold, &participants, &publicKey)
+	var status string
+	var verdict *string
+	var epoch uint64
+	var deadline *int64
+	err = stmt.QueryRow(groupUid).Scan(&id, &threshold, &participants, &publicKey, &status, &verdict, &epoch, &deadline)
 	if err != nil {
 		return FreeonGroup{}, err
 	}
@@ -102,10 +485,14 @@ func GetGroupData(db DBTX, groupUid string) (FreeonGroup, error) {
 		Participants: participants,
 		Threshold:    threshold,
 		PublicKey:    publicKey,
+		Status:       status,
+		Verdict:      verdict,
+		Epoch:        epoch,
+		Deadline:     deadline,
 	}, nil
 }
-func GetGroupByID(db *sql.DB, groupID int64) (FreeonGroup, error) {
-	stmt, err := db.Prepare("SELECT id, uid, threshold, participants, publicKey FROM keygroups WHERE id = ?")
+func (s *sqlStorage) GetGroupByID(groupID int64) (FreeonGroup, error) {
+	stmt, err := s.db.Prepare("SELECT id, uid, threshold, participants, publicKey, status, verdict, epoch, deadline FROM keygroups WHERE id = ?")
 	if err != nil {
 		return FreeonGroup{}, err
 	}
@@ -116,7 +503,11 @@ func GetGroupByID(db *sql.DB, groupID int64) (FreeonGroup, error) {
 	var threshold uint16
 	var participants uint16
 	var publicKey *string
-	err = stmt.QueryRow(groupID).Scan(&id, &uid, &threshold, &participants, &publicKey)
+	var status string
+	var verdict *string
+	var epoch uint64
+	var deadline *int64
+	err = stmt.QueryRow(groupID).Scan(&id, &uid, &threshold, &participants, &publicKey, &status, &verdict, &epoch, &deadline)
 	if err != nil {
 		return FreeonGroup{}, err
 	}
@@ -126,20 +517,26 @@ func GetGroupByID(db *sql.DB, groupID int64) (FreeonGroup, error) {
 		Participants: participants,
 		Threshold:    threshold,
 		PublicKey:    publicKey,
+		Status:       status,
+		Verdict:      verdict,
+		Epoch:        epoch,
+		Deadline:     deadline,
 	}, nil
 }
 
 // Get all of the participants for a group
-func GetGroupParticipants(db DBTX, groupUid string) ([]FreeonParticipant, error) {
-	stmt, err := db.Prepare(`
+func (s *sqlStorage) GetGroupParticipants(groupUid string) ([]FreeonParticipant, error) {
+	stmt, err := s.db.Prepare(`
 		SELECT
 			p.id,
 			g.id AS groupid,
 			p.uid,
-			p.partyid
+			p.partyid,
+			p.publickey
 		FROM keygroups g 
 		JOIN participants p ON p.groupid = g.id
-		WHERE g.uid = ?
+		WHERE g.uid = ? AND p.active
+		ORDER BY p.id ASC
 	`)
 	if err != nil {
 		return nil, err
@@ -157,7 +554,8 @@ func GetGroupParticipants(db DBTX, groupUid string) ([]FreeonParticipant, error)
 		var groupId int64
 		var uid string
 		var partyid uint16
-		if err := rows.Scan(&dbId, &groupId, &uid, &partyid); err != nil {
+		var publicKey *string
+		if err := rows.Scan(&dbId, &groupId, &uid, &partyid, &publicKey); err != nil {
 			return nil, err
 		}
 		p := FreeonParticipant{
@@ -166,17 +564,20 @@ func GetGroupParticipants(db DBTX, groupUid string) ([]FreeonParticipant, error)
 			Uid:     uid,
 			PartyID: partyid,
 		}
+		if publicKey != nil {
+			p.PublicKey = *publicKey
+		}
 		participants = append(participants, p)
 	}
 	return participants, nil
 }
 
-func GetParticipantID(db *sql.DB, groupUid string, myPartyID uint16) (int64, error) {
-	stmt, err := db.Prepare(`
+func (s *sqlStorage) GetParticipantID(groupUid string, myPartyID uint16) (int64, error) {
+	stmt, err := s.db.Prepare(`
 		SELECT p.id 
 		FROM participants p 
 		JOIN keygroups g ON p.groupid = g.id 
-		WHERE g.uid = ? AND p.partyid = ?
+		WHERE g.uid = ? AND p.partyid = ? AND p.active
 		`)
 	if err != nil {
 		return 0, err
@@ -191,9 +592,34 @@ func GetParticipantID(db *sql.DB, groupUid string, myPartyID uint16) (int64, err
 	return id, nil
 }
 
-func GetCeremonyData(db *sql.DB, ceremonyID string) (FreeonCeremonies, error) {
-	stmt, err := db.Prepare(`SELECT
-		id, groupid, active, hash, signature, openssh, opensshnamespace
+// Get the registered public key for a participant
+func (s *sqlStorage) GetParticipantPublicKey(groupUid string, myPartyID uint16) (string, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT p.publickey
+		FROM participants p
+		JOIN keygroups g ON p.groupid = g.id
+		WHERE g.uid = ? AND p.partyid = ? AND p.active
+		`)
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+
+	var publicKey *string
+	err = stmt.QueryRow(groupUid, myPartyID).Scan(&publicKey)
+	if err != nil {
+		return "", err
+	}
+	if publicKey == nil {
+		return "", errors.New("participant has no registered public key")
+	}
+	return *publicKey, nil
+}
+
+func (s *sqlStorage) GetCeremonyData(ceremonyID string) (FreeonCeremonies, error) {
+	stmt, err := s.db.Prepare(`SELECT
+		id, groupid, active, hash, signature, openssh, opensshnamespace, sshcert, message, epoch, preferred, locked, deadline, expired,
+		published, sealedmessage, proposer, verdict
 		FROM ceremonies
 		WHERE uid = ?`)
 	if err != nil {
@@ -208,10 +634,29 @@ func GetCeremonyData(db *sql.DB, ceremonyID string) (FreeonCeremonies, error) {
 	var signature *string
 	var openssh bool
 	var opensshnamespace *string
-	err = stmt.QueryRow(ceremonyID).Scan(&id, &groupid, &active, &hash, &signature, &openssh, &opensshnamespace)
+	var sshcert *string
+	var message *string
+	var epoch uint64
+	var preferred *string
+	var locked bool
+	var deadline *int64
+	var expired bool
+	var published bool
+	var sealedmessage *string
+	var proposer *string
+	var verdict *string
+	err = stmt.QueryRow(ceremonyID).Scan(&id, &groupid, &active, &hash, &signature, &openssh, &opensshnamespace, &sshcert, &message, &epoch, &preferred, &locked, &deadline, &expired,
+		&published, &sealedmessage, &proposer, &verdict)
 	if err != nil {
 		return FreeonCeremonies{}, err
 	}
+	var preferredSigners []uint16
+	if preferred != nil {
+		preferredSigners, err = DecodePartyList(*preferred)
+		if err != nil {
+			return FreeonCeremonies{}, err
+		}
+	}
 	return FreeonCeremonies{
 		DbId:             id,
 		GroupID:          groupid,
@@ -221,15 +666,26 @@ func GetCeremonyData(db *sql.DB, ceremonyID string) (FreeonCeremonies, error) {
 		Signature:        signature,
 		OpenSSH:          openssh,
 		OpenSSHNamespace: opensshnamespace,
+		SSHCertificate:   sshcert,
+		Message:          message,
+		Epoch:            epoch,
+		Preferred:        preferredSigners,
+		Locked:           locked,
+		Deadline:         deadline,
+		Expired:          expired,
+		Published:        published,
+		SealedMessage:    sealedmessage,
+		Proposer:         proposer,
+		Verdict:          verdict,
 	}, nil
 }
 
-func GetRecentCeremonies(db *sql.DB, groupID string, limit, offset int64) ([]FreeonCeremonySummary, error) {
-	stmt, err := db.Prepare(`SELECT
-		c.uid, c.hash, c.signature, c.openssh, c.opensshnamespace, c.active
+func (s *sqlStorage) GetRecentCeremonies(groupID string, limit, offset int64) ([]FreeonCeremonySummary, error) {
+	stmt, err := s.db.Prepare(`SELECT
+		c.uid, c.hash, c.signature, c.openssh, c.opensshnamespace, c.sshcert IS NOT NULL, c.active, c.expired, c.verdict
 		FROM ceremonies c
 		JOIN keygroups g ON c.groupid = g.id
-		WHERE c.active AND g.uid = ?
+		WHERE g.uid = ?
 		ORDER BY c.id DESC
 		LIMIT ? OFFSET ?`)
 	if err != nil {
@@ -249,8 +705,11 @@ func GetRecentCeremonies(db *sql.DB, groupID string, limit, offset int64) ([]Fre
 		var signature *string
 		var openssh bool
 		var opensshnamespace *string
+		var sshcert bool
 		var active bool
-		if err := rows.Scan(&ceremonyID, &hash, &signature, &openssh, &opensshnamespace, &active); err != nil {
+		var expired bool
+		var verdict *string
+		if err := rows.Scan(&ceremonyID, &hash, &signature, &openssh, &opensshnamespace, &sshcert, &active, &expired, &verdict); err != nil {
 			return nil, err
 		}
 		var ns string
@@ -266,14 +725,66 @@ func GetRecentCeremonies(db *sql.DB, groupID string, limit, offset int64) ([]Fre
 			Signature:        signature,
 			OpenSSH:          openssh,
 			OpenSSHNamespace: ns,
+			SSHCertificate:   sshcert,
+			Expired:          expired,
+			Verdict:          verdict,
 		}
 		results = append(results, row)
 	}
+	rows.Close()
+
+	// Attach any blame reports, so aborted ceremonies say who caused them
+	for i := range results {
+		blames, err := s.GetCeremonyBlames(results[i].Uid)
+		if err != nil {
+			return nil, err
+		}
+		results[i].Blame = blames
+	}
 	return results, nil
 }
 
-func GetCeremonyPlayers(db *sql.DB, ceremonyID string) ([]FreeonPlayers, error) {
-	stmt, err := db.Prepare(`
+func (s *sqlStorage) GetCeremonyBlames(ceremonyID string) ([]FreeonBlame, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT
+			r.partyid,
+			a.partyid,
+			b.reason
+		FROM blames b
+		JOIN participants r ON b.reporter = r.id
+		JOIN participants a ON b.accused = a.id
+		JOIN ceremonies c ON b.ceremonyid = c.id
+		WHERE c.uid = ?
+		ORDER BY b.id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(ceremonyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blames []FreeonBlame
+	for rows.Next() {
+		var reporter uint16
+		var accused uint16
+		var reason string
+		if err := rows.Scan(&reporter, &accused, &reason); err != nil {
+			return nil, err
+		}
+		blames = append(blames, FreeonBlame{
+			Reporter: reporter,
+			Accused:  accused,
+			Reason:   reason,
+		})
+	}
+	return blames, nil
+}
+
+func (s *sqlStorage) GetCeremonyPlayers(ceremonyID string) ([]FreeonPlayers, error) {
+	stmt, err := s.db.Prepare(`
 		SELECT
 			x.id,
 			x.ceremonyid,
@@ -282,7 +793,8 @@ func GetCeremonyPlayers(db *sql.DB, ceremonyID string) ([]FreeonPlayers, error)
 		FROM players x 
 		JOIN participants p ON x.participantid = p.id
 		JOIN ceremonies c ON x.ceremonyid = c.id
-		WHERE c.uid = ?`)
+		WHERE c.uid = ?
+		ORDER BY x.id ASC`)
 	if err != nil {
 		return nil, err
 	}
@@ -313,8 +825,8 @@ func GetCeremonyPlayers(db *sql.DB, ceremonyID string) ([]FreeonPlayers, error)
 	return players, nil
 }
 
-func GetKeygenMessagesSince(db *sql.DB, groupUid string, lastSeen int64) ([]FreeonKeygenMessage, error) {
-	stmt, err := db.Prepare(`
+func (s *sqlStorage) GetKeygenMessagesSince(groupUid string, lastSeen int64) ([]FreeonKeygenMessage, error) {
+	stmt, err := s.db.Prepare(`
 		SELECT
 			msg.id,
 			msg.groupid,
@@ -324,6 +836,7 @@ func GetKeygenMessagesSince(db *sql.DB, groupUid string, lastSeen int64) ([]Free
 		JOIN keygenmsg msg ON msg.groupid = g.id
 		JOIN participants p ON msg.sender = p.id
 		WHERE g.uid = ? AND msg.id > ?
+		ORDER BY msg.id ASC
 	`)
 	if err != nil {
 		return nil, err
@@ -359,194 +872,758 @@ func GetKeygenMessagesSince(db *sql.DB, groupUid string, lastSeen int64) ([]Free
 	return messages, nil
 }
 
-func GetSignMessagesSince(db *sql.DB, ceremonyUid string, lastSeen int64) ([]FreeonSignMessage, error) {
-	stmt, err := db.Prepare(`
+// Get every keygen message sent by one party, oldest first
+func (s *sqlStorage) GetKeygenMessagesFrom(groupUid string, partyID uint16) ([]FreeonKeygenMessage, error) {
+	stmt, err := s.db.Prepare(`
 		SELECT
 			msg.id,
-			msg.ceremonyid,
+			msg.groupid,
 			msg.sender,
 			msg.message
-		FROM ceremonies c
-		JOIN signmsg msg ON msg.ceremonyid = c.id
+		FROM keygroups g
+		JOIN keygenmsg msg ON msg.groupid = g.id
 		JOIN participants p ON msg.sender = p.id
-		WHERE c.uid = ? AND msg.id > ?
-	`)
+		WHERE g.uid = ? AND p.partyid = ?
+		ORDER BY msg.id ASC`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query(ceremonyUid, lastSeen)
+
+	rows, err := stmt.Query(groupUid, partyID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var messages []FreeonSignMessage
+	var messages []FreeonKeygenMessage
 	for rows.Next() {
 		var id int64
-		var ceremony int64
+		var groupId int64
 		var sender int64
 		var messageHex string
-		if err := rows.Scan(&id, &ceremony, &sender, &messageHex); err != nil {
+		if err := rows.Scan(&id, &groupId, &sender, &messageHex); err != nil {
 			return nil, err
 		}
-		messageBody, err := hex.DecodeString(messageHex)
+		message, err := hex.DecodeString(messageHex)
 		if err != nil {
 			return nil, err
 		}
-		msg := FreeonSignMessage{
-			DbId:       id,
-			CeremonyID: ceremony,
-			Sender:     sender,
-			Message:    messageBody,
-		}
-		messages = append(messages, msg)
+		messages = append(messages, FreeonKeygenMessage{
+			DbId:    id,
+			GroupID: groupId,
+			Sender:  sender,
+			Message: message,
+		})
 	}
 	return messages, nil
 }
 
-func InsertGroup(db *sql.DB, g FreeonGroup) (int64, error) {
-	stmt, err := db.Prepare(`INSERT INTO keygroups (uid, participants, threshold) VALUES (?, ?, ?)`)
-	if err != nil {
-		return 0, err
-	}
-	res, err := stmt.Exec(g.Uid, g.Participants, g.Threshold)
-	if err != nil {
-		return 0, err
-	}
-	id, err := res.LastInsertId()
+// Get the party IDs that have filed a complaint report for a group
+func (s *sqlStorage) GetComplaintReporters(groupUid string) ([]uint16, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT DISTINCT p.partyid
+		FROM complaints c
+		JOIN keygroups g ON c.groupid = g.id
+		JOIN participants p ON c.reporter = p.id
+		WHERE g.uid = ?
+		ORDER BY p.partyid ASC`)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return id, nil
-}
+	defer stmt.Close()
 
-func InsertCeremony(db *sql.DB, c FreeonCeremonies) (int64, error) {
-	stmt, err := db.Prepare(`INSERT INTO ceremonies (groupid, uid, active, hash) VALUES (?, ?, ?, ?)`)
+	rows, err := stmt.Query(groupUid)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	res, err := stmt.Exec(c.GroupID, c.Uid, c.Active, c.Hash)
+	defer rows.Close()
+
+	var reporters []uint16
+	for rows.Next() {
+		var partyId uint16
+		if err := rows.Scan(&partyId); err != nil {
+			return nil, err
+		}
+		reporters = append(reporters, partyId)
+	}
+	return reporters, nil
+}
+
+// Get every party's confirmed group public key so far
+func (s *sqlStorage) GetKeyConfirmations(groupUid string) ([]FreeonKeyConfirmation, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT k.id, k.groupid, k.participantid, p.partyid, k.publickey
+		FROM keyconfirmations k
+		JOIN keygroups g ON k.groupid = g.id
+		JOIN participants p ON k.participantid = p.id
+		WHERE g.uid = ?
+		ORDER BY p.partyid ASC`)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	id, err := res.LastInsertId()
+	defer stmt.Close()
+
+	rows, err := stmt.Query(groupUid)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return id, nil
+	defer rows.Close()
+
+	var confirmations []FreeonKeyConfirmation
+	for rows.Next() {
+		var c FreeonKeyConfirmation
+		if err := rows.Scan(&c.DbId, &c.GroupID, &c.Participant, &c.PartyID, &c.PublicKey); err != nil {
+			return nil, err
+		}
+		confirmations = append(confirmations, c)
+	}
+	return confirmations, nil
 }
 
-func InsertParticipant(db DBTX, p FreeonParticipant) (int64, error) {
-	stmt, err := db.Prepare(`INSERT INTO participants (groupid, uid, partyid) VALUES (?, ?, ?)`)
+// Get the refresh for a group that is still in progress, if there is one
+func (s *sqlStorage) GetOpenRefresh(groupUid string) (FreeonRefresh, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT r.id, r.groupid, r.uid, r.epoch, r.status, r.verdict
+		FROM refreshes r
+		JOIN keygroups g ON r.groupid = g.id
+		WHERE g.uid = ? AND r.status = 'open'
+		ORDER BY r.id DESC
+		LIMIT 1`)
 	if err != nil {
-		return 0, err
+		return FreeonRefresh{}, err
 	}
-	res, err := stmt.Exec(p.GroupID, p.Uid, p.PartyID)
+	defer stmt.Close()
+
+	var r FreeonRefresh
+	err = stmt.QueryRow(groupUid).Scan(&r.DbId, &r.GroupID, &r.Uid, &r.Epoch, &r.Status, &r.Verdict)
 	if err != nil {
-		return 0, err
+		return FreeonRefresh{}, err
 	}
-	id, err := res.LastInsertId()
+	return r, nil
+}
+
+func (s *sqlStorage) GetRefreshData(refreshUid string) (FreeonRefresh, error) {
+	stmt, err := s.db.Prepare(`SELECT id, groupid, epoch, status, verdict FROM refreshes WHERE uid = ?`)
 	if err != nil {
-		return 0, err
+		return FreeonRefresh{}, err
 	}
-	return id, nil
+	defer stmt.Close()
+
+	r := FreeonRefresh{Uid: refreshUid}
+	err = stmt.QueryRow(refreshUid).Scan(&r.DbId, &r.GroupID, &r.Epoch, &r.Status, &r.Verdict)
+	if err != nil {
+		return FreeonRefresh{}, err
+	}
+	return r, nil
 }
 
-func InsertPlayer(db *sql.DB, p FreeonPlayers) (int64, error) {
-	stmt, err := db.Prepare(`INSERT INTO players (ceremonyid, participantid) VALUES (?, ?)`)
+// Get the holders that have joined a refresh, in party ID order
+func (s *sqlStorage) GetRefreshers(refreshUid string) ([]FreeonRefresher, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT
+			x.id,
+			x.refreshid,
+			x.participantid,
+			p.partyid,
+			x.digest
+		FROM refreshers x
+		JOIN participants p ON x.participantid = p.id
+		JOIN refreshes r ON x.refreshid = r.id
+		WHERE r.uid = ?
+		ORDER BY p.partyid ASC`)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	res, err := stmt.Exec(p.CeremonyID, p.ParticipantID)
+	defer stmt.Close()
+	rows, err := stmt.Query(refreshUid)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	id, err := res.LastInsertId()
+	defer rows.Close()
+
+	var refreshers []FreeonRefresher
+	for rows.Next() {
+		var x FreeonRefresher
+		if err := rows.Scan(&x.DbId, &x.RefreshID, &x.ParticipantID, &x.PartyID, &x.Digest); err != nil {
+			return nil, err
+		}
+		refreshers = append(refreshers, x)
+	}
+	return refreshers, nil
+}
+
+func (s *sqlStorage) GetRefreshMessagesSince(refreshUid string, lastSeen int64) ([]FreeonRefreshMessage, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT
+			msg.id,
+			msg.refreshid,
+			msg.sender,
+			msg.message
+		FROM refreshes r
+		JOIN refreshmsg msg ON msg.refreshid = r.id
+		WHERE r.uid = ? AND msg.id > ?
+		ORDER BY msg.id ASC
+	`)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return id, nil
+	defer stmt.Close()
+	rows, err := stmt.Query(refreshUid, lastSeen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []FreeonRefreshMessage
+	for rows.Next() {
+		var id int64
+		var refresh int64
+		var sender int64
+		var messageHex string
+		if err := rows.Scan(&id, &refresh, &sender, &messageHex); err != nil {
+			return nil, err
+		}
+		messageBody, err := hex.DecodeString(messageHex)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, FreeonRefreshMessage{
+			DbId:      id,
+			RefreshID: refresh,
+			Sender:    sender,
+			Message:   messageBody,
+		})
+	}
+	return messages, nil
 }
 
-func InsertKeygenMessage(db *sql.DB, m FreeonKeygenMessage) (int64, error) {
-	stmt, err := db.Prepare(`INSERT INTO keygenmsg (groupid, sender, message) VALUES (?, ?, ?)`)
+// The highest party ID ever handed out in a group, including to participants who have since left
+func (s *sqlStorage) GetMaxPartyID(groupUid string) (uint16, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT COALESCE(MAX(p.partyid), 0)
+		FROM participants p
+		JOIN keygroups g ON p.groupid = g.id
+		WHERE g.uid = ?`)
 	if err != nil {
 		return 0, err
 	}
-	stateHex := hex.EncodeToString(m.Message)
-	res, err := stmt.Exec(m.GroupID, m.Sender, stateHex)
+	defer stmt.Close()
+
+	var max uint16
+	err = stmt.QueryRow(groupUid).Scan(&max)
 	if err != nil {
 		return 0, err
 	}
-	id, err := res.LastInsertId()
+	return max, nil
+}
+
+// Get the reshare for a group that is still in progress, if there is one
+func (s *sqlStorage) GetOpenReshare(groupUid string) (FreeonReshare, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT s.id, s.groupid, s.uid, s.epoch, s.participants, s.threshold, s.locked, s.status, s.verdict
+		FROM reshares s
+		JOIN keygroups g ON s.groupid = g.id
+		WHERE g.uid = ? AND s.status = 'open'
+		ORDER BY s.id DESC
+		LIMIT 1`)
+	if err != nil {
+		return FreeonReshare{}, err
+	}
+	defer stmt.Close()
+
+	var r FreeonReshare
+	err = stmt.QueryRow(groupUid).Scan(&r.DbId, &r.GroupID, &r.Uid, &r.Epoch, &r.Participants, &r.Threshold, &r.Locked, &r.Status, &r.Verdict)
 	if err != nil {
-		return 0, err
+		return FreeonReshare{}, err
 	}
-	return id, nil
+	return r, nil
 }
 
-func InsertSignMessage(db *sql.DB, m FreeonSignMessage) (int64, error) {
-	stmt, err := db.Prepare(`INSERT INTO signmsg (ceremonyid, sender, message) VALUES (?, ?, ?)`)
+func (s *sqlStorage) GetReshareData(reshareUid string) (FreeonReshare, error) {
+	stmt, err := s.db.Prepare(`SELECT id, groupid, epoch, participants, threshold, locked, status, verdict FROM reshares WHERE uid = ?`)
 	if err != nil {
-		return 0, err
+		return FreeonReshare{}, err
 	}
-	stateHex := hex.EncodeToString(m.Message)
-	res, err := stmt.Exec(m.CeremonyID, m.Sender, stateHex)
+	defer stmt.Close()
+
+	r := FreeonReshare{Uid: reshareUid}
+	err = stmt.QueryRow(reshareUid).Scan(&r.DbId, &r.GroupID, &r.Epoch, &r.Participants, &r.Threshold, &r.Locked, &r.Status, &r.Verdict)
 	if err != nil {
-		return 0, err
+		return FreeonReshare{}, err
 	}
-	id, err := res.LastInsertId()
+	return r, nil
+}
+
+// Get everyone who has joined a reshare, in party ID order.
+// New participants aren't active until the reshare is complete, so this includes them.
+func (s *sqlStorage) GetResharers(reshareUid string) ([]FreeonResharer, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT
+			x.id,
+			x.reshareid,
+			x.participantid,
+			p.partyid,
+			p.publickey,
+			x.dealer,
+			x.recipient,
+			x.digest
+		FROM resharers x
+		JOIN participants p ON x.participantid = p.id
+		JOIN reshares s ON x.reshareid = s.id
+		WHERE s.uid = ?
+		ORDER BY p.partyid ASC`)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return id, nil
+	defer stmt.Close()
+	rows, err := stmt.Query(reshareUid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resharers []FreeonResharer
+	for rows.Next() {
+		var x FreeonResharer
+		var publicKey *string
+		if err := rows.Scan(&x.DbId, &x.ReshareID, &x.ParticipantID, &x.PartyID, &publicKey, &x.Dealer, &x.Recipient, &x.Digest); err != nil {
+			return nil, err
+		}
+		if publicKey != nil {
+			x.PublicKey = *publicKey
+		}
+		resharers = append(resharers, x)
+	}
+	return resharers, nil
 }
 
-func FinalizeGroup(db *sql.DB, g FreeonGroup) error {
-	if g.PublicKey == nil {
-		return errors.New("public key is not stored in FreeonGroup struct")
+func (s *sqlStorage) GetReshareMessagesSince(reshareUid string, lastSeen int64) ([]FreeonReshareMessage, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT
+			msg.id,
+			msg.reshareid,
+			msg.sender,
+			msg.message
+		FROM reshares s
+		JOIN resharemsg msg ON msg.reshareid = s.id
+		WHERE s.uid = ? AND msg.id > ?
+		ORDER BY msg.id ASC
+	`)
+	if err != nil {
+		return nil, err
 	}
-	stmt, err := db.Prepare(`UPDATE keygroups SET publicKey = ? WHERE id = ?`)
+	defer stmt.Close()
+	rows, err := stmt.Query(reshareUid, lastSeen)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = stmt.Exec(g.PublicKey, g.DbId)
+	defer rows.Close()
+
+	var messages []FreeonReshareMessage
+	for rows.Next() {
+		var id int64
+		var reshare int64
+		var sender int64
+		var messageHex string
+		if err := rows.Scan(&id, &reshare, &sender, &messageHex); err != nil {
+			return nil, err
+		}
+		messageBody, err := hex.DecodeString(messageHex)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, FreeonReshareMessage{
+			DbId:      id,
+			ReshareID: reshare,
+			Sender:    sender,
+			Message:   messageBody,
+		})
+	}
+	return messages, nil
+}
+
+func (s *sqlStorage) GetSignMessagesSince(ceremonyUid string, lastSeen int64) ([]FreeonSignMessage, error) {
+	stmt, err := s.db.Prepare(`
+		SELECT
+			msg.id,
+			msg.ceremonyid,
+			msg.sender,
+			msg.message
+		FROM ceremonies c
+		JOIN signmsg msg ON msg.ceremonyid = c.id
+		JOIN participants p ON msg.sender = p.id
+		WHERE c.uid = ? AND msg.id > ?
+		ORDER BY msg.id ASC
+	`)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer stmt.Close()
+	rows, err := stmt.Query(ceremonyUid, lastSeen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []FreeonSignMessage
+	for rows.Next() {
+		var id int64
+		var ceremony int64
+		var sender int64
+		var messageHex string
+		if err := rows.Scan(&id, &ceremony, &sender, &messageHex); err != nil {
+			return nil, err
+		}
+		messageBody, err := hex.DecodeString(messageHex)
+		if err != nil {
+			return nil, err
+		}
+		msg := FreeonSignMessage{
+			DbId:       id,
+			CeremonyID: ceremony,
+			Sender:     sender,
+			Message:    messageBody,
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (s *sqlStorage) InsertGroup(g FreeonGroup) (int64, error) {
+	return s.insert(`INSERT INTO keygroups (uid, participants, threshold) VALUES (?, ?, ?)`, g.Uid, g.Participants, g.Threshold)
+}
+
+func (s *sqlStorage) InsertCeremony(c FreeonCeremonies) (int64, error) {
+	var preferred *string
+	if len(c.Preferred) > 0 {
+		encoded := EncodePartyList(c.Preferred)
+		preferred = &encoded
+	}
+	return s.insert(`INSERT INTO ceremonies
+		(groupid, uid, active, hash, message, openssh, opensshnamespace, sshcert, epoch, preferred, sealedmessage)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.GroupID, c.Uid, c.Active, c.Hash, c.Message, c.OpenSSH, c.OpenSSHNamespace, c.SSHCertificate, c.Epoch, preferred, c.SealedMessage)
+}
+
+func (s *sqlStorage) InsertParticipant(p FreeonParticipant) (int64, error) {
+	return s.insert(`INSERT INTO participants (groupid, uid, partyid, publickey, active) VALUES (?, ?, ?, ?, ?)`,
+		p.GroupID, p.Uid, p.PartyID, p.PublicKey, !p.Pending)
 }
 
-func FinalizeSignature(db *sql.DB, c FreeonCeremonies, sig string) error {
+func (s *sqlStorage) DeleteParticipant(participantID int64) error {
+	return s.change(ErrNotFound, `DELETE FROM participants WHERE id = ?`, participantID)
+}
+
+func (s *sqlStorage) InsertPlayer(p FreeonPlayers) (int64, error) {
+	return s.insert(`INSERT INTO players (ceremonyid, participantid) VALUES (?, ?)`, p.CeremonyID, p.ParticipantID)
+}
+
+func (s *sqlStorage) DeletePlayer(ceremonyUid string, participantID int64) error {
+	return s.change(ErrNotFound, `DELETE FROM players
+		WHERE ceremonyid = (SELECT id FROM ceremonies WHERE uid = ?) AND participantid = ?`, ceremonyUid, participantID)
+}
+
+func (s *sqlStorage) InsertKeygenMessage(m FreeonKeygenMessage) (int64, error) {
+	return s.insert(`INSERT INTO keygenmsg (groupid, sender, message) VALUES (?, ?, ?)`,
+		m.GroupID, m.Sender, hex.EncodeToString(m.Message))
+}
+
+func (s *sqlStorage) InsertSignMessage(m FreeonSignMessage) (int64, error) {
+	return s.insert(`INSERT INTO signmsg (ceremonyid, sender, message) VALUES (?, ?, ?)`,
+		m.CeremonyID, m.Sender, hex.EncodeToString(m.Message))
+}
+
+func (s *sqlStorage) InsertComplaint(c FreeonComplaint) (int64, error) {
+	return s.insert(`INSERT INTO complaints (groupid, reporter, accused, evidence) VALUES (?, ?, ?, ?)`,
+		c.GroupID, c.Reporter, c.Accused, c.Evidence)
+}
+
+func (s *sqlStorage) InsertKeyConfirmation(c FreeonKeyConfirmation) (int64, error) {
+	return s.insert(`INSERT INTO keyconfirmations (groupid, participantid, publickey) VALUES (?, ?, ?)`,
+		c.GroupID, c.Participant, c.PublicKey)
+}
+
+func (s *sqlStorage) InsertBlame(b FreeonBlameRecord) (int64, error) {
+	return s.insert(`INSERT INTO blames (ceremonyid, reporter, accused, reason) VALUES (?, ?, ?, ?)`,
+		b.CeremonyID, b.Reporter, b.Accused, b.Reason)
+}
+
+func (s *sqlStorage) InsertRefresh(r FreeonRefresh) (int64, error) {
+	return s.insert(`INSERT INTO refreshes (groupid, uid, epoch) VALUES (?, ?, ?)`, r.GroupID, r.Uid, r.Epoch)
+}
+
+func (s *sqlStorage) InsertRefresher(x FreeonRefresher) (int64, error) {
+	return s.insert(`INSERT INTO refreshers (refreshid, participantid) VALUES (?, ?)`, x.RefreshID, x.ParticipantID)
+}
+
+func (s *sqlStorage) InsertRefreshMessage(m FreeonRefreshMessage) (int64, error) {
+	return s.insert(`INSERT INTO refreshmsg (refreshid, sender, message) VALUES (?, ?, ?)`,
+		m.RefreshID, m.Sender, hex.EncodeToString(m.Message))
+}
+
+func (s *sqlStorage) InsertReshare(r FreeonReshare) (int64, error) {
+	return s.insert(`INSERT INTO reshares (groupid, uid, epoch, participants, threshold) VALUES (?, ?, ?, ?, ?)`,
+		r.GroupID, r.Uid, r.Epoch, r.Participants, r.Threshold)
+}
+
+func (s *sqlStorage) InsertResharer(x FreeonResharer) (int64, error) {
+	return s.insert(`INSERT INTO resharers (reshareid, participantid, dealer, recipient) VALUES (?, ?, ?, ?)`,
+		x.ReshareID, x.ParticipantID, x.Dealer, x.Recipient)
+}
+
+func (s *sqlStorage) InsertReshareInvite(reshareID int64, publicKey string) error {
+	_, err := s.db.Exec(`INSERT INTO reshareinvites (reshareid, publickey) VALUES (?, ?)`, reshareID, publicKey)
+	return err
+}
+
+func (s *sqlStorage) GetReshareInvites(reshareUid string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT i.publickey FROM reshareinvites i
+		JOIN reshares s ON i.reshareid = s.id
+		WHERE s.uid = ? ORDER BY i.id`, reshareUid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var invites []string
+	for rows.Next() {
+		var publicKey string
+		if err := rows.Scan(&publicKey); err != nil {
+			return nil, err
+		}
+		invites = append(invites, publicKey)
+	}
+	return invites, rows.Err()
+}
+
+func (s *sqlStorage) InsertReshareMessage(m FreeonReshareMessage) (int64, error) {
+	return s.insert(`INSERT INTO resharemsg (reshareid, sender, message) VALUES (?, ?, ?)`,
+		m.ReshareID, m.Sender, hex.EncodeToString(m.Message))
+}
+
+func (s *sqlStorage) FinalizeGroup(g FreeonGroup) error {
+	if g.PublicKey == nil {
+		return errors.New("public key is not stored in FreeonGroup struct")
+	}
+	_, err := s.db.Exec(`UPDATE keygroups SET publicKey = ?, status = 'complete' WHERE id = ?`, g.PublicKey, g.DbId)
+	return err
+}
+
+func (s *sqlStorage) DisputeGroup(g FreeonGroup, verdict string) error {
+	_, err := s.db.Exec(`UPDATE keygroups SET status = 'disputed', verdict = ? WHERE id = ?`, verdict, g.DbId)
+	return err
+}
+
+func (s *sqlStorage) AbortGroup(g FreeonGroup, verdict string) error {
+	_, err := s.db.Exec(`UPDATE keygroups SET status = 'aborted', verdict = ? WHERE id = ?`, verdict, g.DbId)
+	return err
+}
+
+func (s *sqlStorage) SetGroupStatus(groupUid, from, to string) error {
+	return s.change(ErrNotFound, `UPDATE keygroups SET status = ? WHERE uid = ? AND status = ?`, to, groupUid, from)
+}
+
+func (s *sqlStorage) SetGroupDeadline(groupUid string, deadline time.Time) error {
+	return s.change(errors.New("group not found"), `UPDATE keygroups SET deadline = ? WHERE uid = ?`, deadline.Unix(), groupUid)
+}
+
+func (s *sqlStorage) ExpireGroups(now time.Time, verdict string) ([]string, error) {
+	return s.collectUids(`UPDATE keygroups SET status = ?, verdict = ? WHERE status = 'open' AND deadline <= ? RETURNING uid`,
+		GroupStatusExpired, verdict, now.Unix())
+}
+
+func (s *sqlStorage) FinalizeSignature(c FreeonCeremonies, sig string) error {
 	if !c.Active {
 		return errors.New("group is already finalized")
 	}
-	stmt, err := db.Prepare(`UPDATE ceremonies SET signature = ?, active = FALSE WHERE id = ?`)
+	_, err := s.db.Exec(`UPDATE ceremonies SET signature = ?, active = FALSE WHERE id = ?`, sig, c.DbId)
+	return err
+}
+
+func (s *sqlStorage) DisputeCeremony(c FreeonCeremonies, verdict string) error {
+	_, err := s.db.Exec(`UPDATE ceremonies SET active = FALSE, verdict = ? WHERE id = ?`, verdict, c.DbId)
+	return err
+}
+
+func (s *sqlStorage) LockCeremony(c FreeonCeremonies) error {
+	_, err := s.db.Exec(`UPDATE ceremonies SET locked = TRUE WHERE id = ?`, c.DbId)
+	return err
+}
+
+func (s *sqlStorage) PublishMessage(ceremonyUid string) error {
+	return s.change(errors.New("no ceremony found with that UID"), `UPDATE ceremonies SET published = TRUE WHERE uid = ?`, ceremonyUid)
+}
+
+func (s *sqlStorage) SetCeremonyProposer(ceremonyUid, proposer string) error {
+	return s.change(errors.New("no ceremony found with that UID"), `UPDATE ceremonies SET proposer = ? WHERE uid = ?`, proposer, ceremonyUid)
+}
+
+func (s *sqlStorage) TerminateCeremony(ceremonyUid string) error {
+	return s.change(errors.New("no ceremony found with that UID"), `UPDATE ceremonies SET active = FALSE WHERE uid = ?`, ceremonyUid)
+}
+
+func (s *sqlStorage) CloseCeremonies(groupID int64) ([]string, error) {
+	return s.collectUids(`UPDATE ceremonies SET active = FALSE WHERE groupid = ? AND active RETURNING uid`, groupID)
+}
+
+func (s *sqlStorage) SetCeremonyDeadline(ceremonyUid string, deadline time.Time) error {
+	return s.change(errors.New("ceremony not found"), `UPDATE ceremonies SET deadline = ? WHERE uid = ?`, deadline.Unix(), ceremonyUid)
+}
+
+func (s *sqlStorage) ExpireCeremonies(now time.Time) ([]string, error) {
+	return s.collectUids(`UPDATE ceremonies SET active = FALSE, expired = TRUE WHERE active AND deadline <= ? RETURNING uid`, now.Unix())
+}
+
+func (s *sqlStorage) DeleteExpiredMessages(cutoff time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM keygenmsg WHERE groupid IN (
+		SELECT id FROM keygroups WHERE status = ? AND deadline <= ?
+	)`, GroupStatusExpired, cutoff.Unix())
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(sig, c.DbId)
+	_, err = s.db.Exec(`DELETE FROM signmsg WHERE ceremonyid IN (
+		SELECT id FROM ceremonies WHERE expired AND deadline <= ?
+	)`, cutoff.Unix())
 	return err
 }
 
-func TerminateCeremony(db *sql.DB, ceremonyUid string) error {
-	stmt, err := db.Prepare(`UPDATE ceremonies SET active = FALSE WHERE uid = ?`)
-	if err != nil {
+func (s *sqlStorage) UseNonce(nonce string, expires time.Time) error {
+	return s.change(ErrReplayed, `INSERT INTO nonces (nonce, expires) VALUES (?, ?) ON CONFLICT DO NOTHING`, nonce, expires.Unix())
+}
+
+func (s *sqlStorage) DeleteExpiredNonces(now time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM nonces WHERE expires <= ?`, now.Unix())
+	return err
+}
+
+func (s *sqlStorage) SetRefresherDigest(x FreeonRefresher, digest string) error {
+	_, err := s.db.Exec(`UPDATE refreshers SET digest = ? WHERE id = ?`, digest, x.DbId)
+	return err
+}
+
+func (s *sqlStorage) DeleteRefresher(x FreeonRefresher) error {
+	return s.change(ErrNotFound, `DELETE FROM refreshers WHERE id = ?`, x.DbId)
+}
+
+func (s *sqlStorage) AbortRefresh(r FreeonRefresh, verdict string) error {
+	_, err := s.db.Exec(`UPDATE refreshes SET status = 'aborted', verdict = ? WHERE id = ?`, verdict, r.DbId)
+	return err
+}
+
+func (s *sqlStorage) CompleteRefresh(r FreeonRefresh) error {
+	return s.atomically(func(db DBTX) error {
+		_, err := db.Exec(`UPDATE refreshes SET status = 'complete' WHERE id = ?`, r.DbId)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`UPDATE keygroups SET epoch = ? WHERE id = ?`, r.Epoch, r.GroupID)
 		return err
-	}
-	defer stmt.Close()
+	})
+}
 
-	res, err := stmt.Exec(ceremonyUid)
-	if err != nil {
+func (s *sqlStorage) LockReshare(r FreeonReshare) error {
+	_, err := s.db.Exec(`UPDATE reshares SET locked = TRUE WHERE id = ?`, r.DbId)
+	return err
+}
+
+func (s *sqlStorage) SetResharerDigest(x FreeonResharer, digest string) error {
+	_, err := s.db.Exec(`UPDATE resharers SET digest = ? WHERE id = ?`, digest, x.DbId)
+	return err
+}
+
+func (s *sqlStorage) DeleteResharer(x FreeonResharer) error {
+	return s.change(ErrNotFound, `DELETE FROM resharers WHERE id = ?`, x.DbId)
+}
+
+func (s *sqlStorage) AbortReshare(r FreeonReshare, verdict string) error {
+	_, err := s.db.Exec(`UPDATE reshares SET status = 'aborted', verdict = ? WHERE id = ?`, verdict, r.DbId)
+	return err
+}
+
+func (s *sqlStorage) CompleteReshare(r FreeonReshare) error {
+	return s.atomically(func(db DBTX) error {
+		_, err := db.Exec(`UPDATE reshares SET status = 'complete' WHERE id = ?`, r.DbId)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`UPDATE keygroups SET participants = ?, threshold = ?, epoch = ? WHERE id = ?`, r.Participants, r.Threshold, r.Epoch, r.GroupID)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`
+			UPDATE participants SET active = id IN (
+				SELECT participantid FROM resharers WHERE reshareid = ? AND recipient
+			) WHERE groupid = ?`, r.DbId, r.GroupID)
 		return err
+	})
+}
+
+func (s *sqlStorage) InsertMemberRole(groupID int64, partyID uint16, role string) error {
+	_, err := s.db.Exec(`INSERT INTO memberroles (groupid, partyid, role) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`, groupID, partyID, role)
+	return err
+}
+
+func (s *sqlStorage) DeleteMemberRole(groupUid string, partyID uint16, role string) error {
+	return s.change(ErrNotFound, `DELETE FROM memberroles
+		WHERE groupid = (SELECT id FROM keygroups WHERE uid = ?) AND partyid = ? AND role = ?`, groupUid, partyID, role)
+}
+
+func (s *sqlStorage) GetMemberRoles(groupUid string) ([]FreeonMemberRole, error) {
+	rows, err := s.db.Query(`SELECT r.partyid, r.role FROM memberroles r
+		JOIN keygroups g ON r.groupid = g.id
+		WHERE g.uid = ? ORDER BY r.partyid, r.id`, groupUid)
+	if err != nil {
+		return nil, err
 	}
-	count, err := res.RowsAffected()
+	defer rows.Close()
+	members := []FreeonMemberRole{}
+	for rows.Next() {
+		var m FreeonMemberRole
+		if err := rows.Scan(&m.PartyID, &m.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *sqlStorage) InsertApiToken(groupID int64, t FreeonApiToken, tokenHash string) error {
+	_, err := s.db.Exec(`INSERT INTO apitokens (groupid, label, role, tokenhash, created) VALUES (?, ?, ?, ?, ?)`,
+		groupID, t.Label, t.Role, tokenHash, t.Created)
+	return err
+}
+
+func (s *sqlStorage) DeleteApiToken(groupUid, label string) error {
+	return s.change(ErrNotFound, `DELETE FROM apitokens
+		WHERE groupid = (SELECT id FROM keygroups WHERE uid = ?) AND label = ?`, groupUid, label)
+}
+
+func (s *sqlStorage) GetApiTokens(groupUid string) ([]FreeonApiToken, error) {
+	rows, err := s.db.Query(`SELECT t.label, t.role, t.created FROM apitokens t
+		JOIN keygroups g ON t.groupid = g.id
+		WHERE g.uid = ? ORDER BY t.id`, groupUid)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []FreeonApiToken{}
+	for rows.Next() {
+		var t FreeonApiToken
+		if err := rows.Scan(&t.Label, &t.Role, &t.Created); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
 	}
-	if count < 1 {
-		return errors.New("no ceremony found with that UID")
+	return tokens, rows.Err()
+}
+
+func (s *sqlStorage) GetApiToken(groupUid, tokenHash string) (FreeonApiToken, error) {
+	var t FreeonApiToken
+	err := s.db.QueryRow(`SELECT t.label, t.role, t.created FROM apitokens t
+		JOIN keygroups g ON t.groupid = g.id
+		WHERE g.uid = ? AND t.tokenhash = ?`, groupUid, tokenHash).Scan(&t.Label, &t.Role, &t.Created)
+	if err != nil {
+		return FreeonApiToken{}, err
 	}
-	return nil
+	return t, nil
 }
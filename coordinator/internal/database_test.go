@@ -2,213 +2,575 @@ package internal_test
 
 import (
 	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
-	_ "github.com/ncruces/go-sqlite3/driver"
-	_ "github.com/ncruces/go-sqlite3/embed"
 	"github.com/soatok/freeon/coordinator/internal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func setupTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
-	assert.NoError(t, err)
-	t.Cleanup(func() {
-		db.Close()
-	})
-	return db
-}
+// Every storage backend has to pass the same tests. Postgres only runs if FREEON_TEST_POSTGRES is set to the URL of
+// a database we can create schemas in.
+var storageBackends = map[string]func(t *testing.T) internal.Storage{
+	"memory": func(t *testing.T) internal.Storage {
+		return internal.NewMemoryStorage()
+	},
+	"sqlite": func(t *testing.T) internal.Storage {
+		db, err := internal.OpenStorage(filepath.Join(t.TempDir(), "database.sqlite"))
+		require.NoError(t, err)
+		return db
+	},
+	"postgres": func(t *testing.T) internal.Storage {
+		database := os.Getenv("FREEON_TEST_POSTGRES")
+		if database == "" {
+			t.Skip("FREEON_TEST_POSTGRES is not set")
+		}
+		// Each test gets a schema of its own, so leftovers from earlier runs don't get in the way
+		uid, err := internal.UniqueID()
+		require.NoError(t, err)
+		schema := "freeon_test_" + uid[:16]
+		admin, err := sql.Open("pgx", database)
+		require.NoError(t, err)
+		t.Cleanup(func() { admin.Close() })
+		_, err = admin.Exec(`CREATE SCHEMA "` + schema + `"`)
+		require.NoError(t, err)
+		t.Cleanup(func() { admin.Exec(`DROP SCHEMA "` + schema + `" CASCADE`) })
 
-func TestDbEnsureTablesExist(t *testing.T) {
-	db := setupTestDB(t)
-	err := internal.DbEnsureTablesExist(db)
-	assert.NoError(t, err)
+		u, err := url.Parse(database)
+		require.NoError(t, err)
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		db, err := internal.OpenStorage(u.String())
+		require.NoError(t, err)
+		return db
+	},
+}
 
-	// Check if tables were created
-	tables := []string{
-		"keygroups",
-		"participants",
-		"ceremonies",
-		"players",
-		"keygenmsg",
-		"signmsg",
-	}
-	for _, table := range tables {
-		var name string
-		err := db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&name)
-		assert.NoError(t, err)
-		assert.Equal(t, table, name)
+// Run a test against each storage backend, starting from an empty one each time
+func forEachStorage(t *testing.T, test func(t *testing.T, db internal.Storage)) {
+	for name, open := range storageBackends {
+		t.Run(name, func(t *testing.T) {
+			db := open(t)
+			t.Cleanup(func() { db.Close() })
+			test(t, db)
+		})
 	}
 }
 
-func TestParticipantFunctions(t *testing.T) {
-	db := setupTestDB(t)
-	err := internal.DbEnsureTablesExist(db)
+func TestOpenStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.sqlite")
+	db, err := internal.OpenStorage(path)
+	require.NoError(t, err)
+	_, err = db.InsertGroup(internal.FreeonGroup{Uid: "g", Participants: 2, Threshold: 2})
 	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
 
-	// Insert a group
-	group := internal.FreeonGroup{
-		Uid:          "test_group",
-		Participants: 3,
-		Threshold:    2,
-	}
-	gid, err := internal.InsertGroup(db, group)
+	// Opening it again keeps what was there
+	db, err = internal.OpenStorage(path)
+	require.NoError(t, err)
+	defer db.Close()
+	group, err := db.GetGroupData("g")
 	assert.NoError(t, err)
+	assert.Equal(t, uint16(2), group.Threshold)
+}
 
-	// Insert a participant
-	p := internal.FreeonParticipant{
-		GroupID: gid,
-		Uid:     "test_participant",
-		PartyID: 1,
-	}
-	pid, err := internal.InsertParticipant(db, p)
-	assert.NoError(t, err)
-	assert.NotZero(t, pid)
-	p.DbId = pid
+// What a coordinator database looked like before the schema had a version
+const unversionedSchema = `
+	CREATE TABLE keygroups (id INTEGER PRIMARY KEY AUTOINCREMENT, uid TEXT NOT NULL, participants INTEGER, threshold INTEGER, publickey TEXT NULL);
+	CREATE TABLE participants (id INTEGER PRIMARY KEY AUTOINCREMENT, groupid INTEGER REFERENCES keygroups(id), uid TEXT NOT NULL, partyid INTEGER);
+	CREATE TABLE ceremonies (id INTEGER PRIMARY KEY AUTOINCREMENT, groupid INTEGER REFERENCES keygroups(id), uid TEXT NOT NULL, active BOOLEAN DEFAULT TRUE, openssh BOOLEAN DEFAULT FALSE, opensshnamespace TEXT NULL, hash TEXT, signature TEXT NULL);
+	CREATE TABLE players (id INTEGER PRIMARY KEY AUTOINCREMENT, ceremonyid INTEGER REFERENCES ceremonies(id), participantid INTEGER REFERENCES participants(id));
+	CREATE TABLE keygenmsg (id INTEGER PRIMARY KEY AUTOINCREMENT, groupid INTEGER REFERENCES keygroups(id), sender INTEGER REFERENCES participants(id), message TEXT);
+	CREATE TABLE signmsg (id INTEGER PRIMARY KEY AUTOINCREMENT, ceremonyid INTEGER REFERENCES ceremonies(id), sender INTEGER REFERENCES participants(id), message TEXT);
+	INSERT INTO keygroups (uid, participants, threshold) VALUES ('g', 3, 2);
+	INSERT INTO ceremonies (groupid, uid, hash) VALUES (1, 'c', 'abcd');
+`
 
-	// GetGroupParticipants
-	participants, err := internal.GetGroupParticipants(db, "test_group")
-	assert.NoError(t, err)
-	assert.Len(t, participants, 1)
-	assert.Equal(t, p.Uid, participants[0].Uid)
+func TestMigrateStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.sqlite")
+	raw, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = raw.Exec(unversionedSchema)
+	require.NoError(t, err)
+	require.NoError(t, raw.Close())
 
-	// GetParticipantID
-	participantID, err := internal.GetParticipantID(db, "test_group", 1)
+	// The old rows pick up the new columns' defaults, and the new tables are there
+	db, err := internal.OpenStorage(path)
+	require.NoError(t, err)
+	group, err := db.GetGroupData("g")
 	assert.NoError(t, err)
-	assert.Equal(t, pid, participantID)
+	assert.Equal(t, "open", group.Status)
+	assert.Equal(t, uint64(0), group.Epoch)
+	ceremony, err := db.GetCeremonyData("c")
+	assert.NoError(t, err)
+	assert.True(t, ceremony.Active)
+	assert.False(t, ceremony.Locked)
+	assert.Nil(t, ceremony.Verdict)
+	assert.NoError(t, db.InsertMemberRole(group.DbId, 1, internal.RoleAdmin))
+	assert.NoError(t, db.Close())
+
+	// Migrating is a one-time thing
+	db, err = internal.OpenStorage(path)
+	require.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	// A database from a newer coordinator is left alone
+	raw, err = sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = raw.Exec("UPDATE schemaversion SET version = version + 1")
+	require.NoError(t, err)
+	require.NoError(t, raw.Close())
+	_, err = internal.OpenStorage(path)
+	assert.ErrorContains(t, err, "schema version")
+}
+
+func TestParticipantFunctions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db internal.Storage) {
+		// Insert a group
+		group := internal.FreeonGroup{
+			Uid:          "test_group",
+			Participants: 3,
+			Threshold:    2,
+		}
+		gid, err := db.InsertGroup(group)
+		assert.NoError(t, err)
+
+		// Insert a participant
+		p := internal.FreeonParticipant{
+			GroupID:   gid,
+			Uid:       "test_participant",
+			PartyID:   1,
+			PublicKey: "test_key",
+		}
+		pid, err := db.InsertParticipant(p)
+		assert.NoError(t, err)
+		assert.NotZero(t, pid)
+		p.DbId = pid
+
+		// GetGroupParticipants
+		participants, err := db.GetGroupParticipants("test_group")
+		assert.NoError(t, err)
+		assert.Len(t, participants, 1)
+		assert.Equal(t, p.Uid, participants[0].Uid)
+
+		// GetParticipantID
+		participantID, err := db.GetParticipantID("test_group", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, pid, participantID)
+
+		// GetParticipantPublicKey
+		publicKey, err := db.GetParticipantPublicKey("test_group", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "test_key", publicKey)
+
+		// GetMaxPartyID
+		p3, err := db.InsertParticipant(internal.FreeonParticipant{GroupID: gid, Uid: "p3", PartyID: 3})
+		assert.NoError(t, err)
+		maxID, err := db.GetMaxPartyID("test_group")
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(3), maxID)
+
+		// DeleteParticipant
+		assert.NoError(t, db.DeleteParticipant(p3))
+		assert.ErrorIs(t, db.DeleteParticipant(p3), internal.ErrNotFound)
+		participants, err = db.GetGroupParticipants("test_group")
+		assert.NoError(t, err)
+		assert.Len(t, participants, 1)
+
+		// Unknown parties
+		_, err = db.GetParticipantID("test_group", 2)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		_, err = db.GetParticipantPublicKey("nonexistent", 1)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+	})
 }
 
 func TestCeremonyAndMessageFunctions(t *testing.T) {
-	db := setupTestDB(t)
-	err := internal.DbEnsureTablesExist(db)
-	assert.NoError(t, err)
+	forEachStorage(t, func(t *testing.T, db internal.Storage) {
+		// Insert a group and participant
+		group := internal.FreeonGroup{Uid: "g", Participants: 2, Threshold: 2}
+		gid, err := db.InsertGroup(group)
+		assert.NoError(t, err)
+		p := internal.FreeonParticipant{GroupID: gid, Uid: "p", PartyID: 1}
+		pid, err := db.InsertParticipant(p)
+		assert.NoError(t, err)
 
-	// Insert a group and participant
-	group := internal.FreeonGroup{Uid: "g", Participants: 2, Threshold: 2}
-	gid, err := internal.InsertGroup(db, group)
-	assert.NoError(t, err)
-	p := internal.FreeonParticipant{GroupID: gid, Uid: "p", PartyID: 1}
-	pid, err := internal.InsertParticipant(db, p)
-	assert.NoError(t, err)
+		// Insert a ceremony
+		c := internal.FreeonCeremonies{
+			GroupID:   gid,
+			Uid:       "c",
+			Active:    true,
+			Hash:      "hash",
+			Preferred: []uint16{1, 2},
+		}
+		cid, err := db.InsertCeremony(c)
+		assert.NoError(t, err)
+		c.DbId = cid
 
-	// Insert a ceremony
-	c := internal.FreeonCeremonies{
-		GroupID: gid,
-		Uid:     "c",
-		Active:  true,
-		Hash:    "hash",
-	}
-	cid, err := internal.InsertCeremony(db, c)
-	assert.NoError(t, err)
-	c.DbId = cid
+		// GetCeremonyData
+		cData, err := db.GetCeremonyData("c")
+		assert.NoError(t, err)
+		assert.Equal(t, c.Uid, cData.Uid)
+		assert.Equal(t, []uint16{1, 2}, cData.Preferred)
+		assert.False(t, cData.Locked)
+		assert.False(t, cData.Published)
+		assert.Nil(t, cData.SealedMessage)
+		_, err = db.GetCeremonyData("nonexistent")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
 
-	// GetCeremonyData
-	cData, err := internal.GetCeremonyData(db, "c")
-	assert.NoError(t, err)
-	assert.Equal(t, c.Uid, cData.Uid)
+		// PublishMessage
+		assert.NoError(t, db.PublishMessage("c"))
+		assert.Error(t, db.PublishMessage("nonexistent"))
+		cData, err = db.GetCeremonyData("c")
+		assert.NoError(t, err)
+		assert.True(t, cData.Published)
+		assert.Nil(t, cData.Proposer)
 
-	// Insert a player
-	player := internal.FreeonPlayers{
-		CeremonyID:    cid,
-		ParticipantID: pid,
-	}
-	_, err = internal.InsertPlayer(db, player)
-	assert.NoError(t, err)
+		// SetCeremonyProposer
+		assert.NoError(t, db.SetCeremonyProposer("c", "party 1"))
+		assert.Error(t, db.SetCeremonyProposer("nonexistent", "party 1"))
+		cData, err = db.GetCeremonyData("c")
+		assert.NoError(t, err)
+		assert.Equal(t, "party 1", *cData.Proposer)
 
-	// GetCeremonyPlayers
-	players, err := internal.GetCeremonyPlayers(db, "c")
-	assert.NoError(t, err)
-	assert.Len(t, players, 1)
-	assert.Equal(t, pid, players[0].ParticipantID)
+		// Sealed messages
+		sealed := "73656164"
+		_, err = db.InsertCeremony(internal.FreeonCeremonies{GroupID: gid, Uid: "sealed", Active: true, Hash: "hash", SealedMessage: &sealed})
+		assert.NoError(t, err)
+		cData, err = db.GetCeremonyData("sealed")
+		assert.NoError(t, err)
+		assert.Equal(t, sealed, *cData.SealedMessage)
+		assert.Nil(t, cData.Message)
 
-	// GetRecentCeremonies
-	recent, err := internal.GetRecentCeremonies(db, "g", 10, 0)
-	assert.NoError(t, err)
-	assert.Len(t, recent, 1)
-	assert.Equal(t, "c", recent[0].Uid)
+		// Insert a player
+		player := internal.FreeonPlayers{
+			CeremonyID:    cid,
+			ParticipantID: pid,
+		}
+		_, err = db.InsertPlayer(player)
+		assert.NoError(t, err)
 
-	// FinalizeSignature
-	err = internal.FinalizeSignature(db, c, "sig")
-	assert.NoError(t, err)
-	cData, err = internal.GetCeremonyData(db, "c")
-	assert.NoError(t, err)
-	assert.False(t, cData.Active)
-	assert.Equal(t, "sig", *cData.Signature)
-
-	// InsertKeygenMessage
-	km := internal.FreeonKeygenMessage{
-		GroupID: gid,
-		Sender:  pid,
-		Message: []byte("keygen message"),
-	}
-	kmid, err := internal.InsertKeygenMessage(db, km)
-	assert.NoError(t, err)
-	assert.NotZero(t, kmid)
+		// GetCeremonyPlayers
+		players, err := db.GetCeremonyPlayers("c")
+		assert.NoError(t, err)
+		assert.Len(t, players, 1)
+		assert.Equal(t, pid, players[0].ParticipantID)
+		assert.Equal(t, uint16(1), players[0].PartyID)
 
-	// GetKeygenMessagesSince
-	kms, err := internal.GetKeygenMessagesSince(db, "g", 0)
-	assert.NoError(t, err)
-	assert.Len(t, kms, 1)
-	assert.Equal(t, km.Message, kms[0].Message)
-
-	// InsertSignMessage
-	sm := internal.FreeonSignMessage{
-		CeremonyID: cid,
-		Sender:     pid,
-		Message:    []byte("sign message"),
-	}
-	smid, err := internal.InsertSignMessage(db, sm)
-	assert.NoError(t, err)
-	assert.NotZero(t, smid)
+		// DeletePlayer
+		assert.NoError(t, db.DeletePlayer("c", pid))
+		players, err = db.GetCeremonyPlayers("c")
+		assert.NoError(t, err)
+		assert.Empty(t, players)
+		assert.ErrorIs(t, db.DeletePlayer("c", pid), internal.ErrNotFound)
+		_, err = db.InsertPlayer(player)
+		assert.NoError(t, err)
 
-	// GetSignMessagesSince
-	sms, err := internal.GetSignMessagesSince(db, "c", 0)
-	assert.NoError(t, err)
-	assert.Len(t, sms, 1)
-	assert.Equal(t, sm.Message, sms[0].Message)
+		// LockCeremony
+		assert.NoError(t, db.LockCeremony(c))
+		cData, err = db.GetCeremonyData("c")
+		assert.NoError(t, err)
+		assert.True(t, cData.Locked)
+
+		// Blames show up in the ceremony list
+		_, err = db.InsertBlame(internal.FreeonBlameRecord{CeremonyID: cid, Reporter: pid, Accused: pid, Reason: "test"})
+		assert.NoError(t, err)
+
+		// GetRecentCeremonies
+		recent, err := db.GetRecentCeremonies("g", 10, 0)
+		assert.NoError(t, err)
+		assert.Len(t, recent, 2)
+		assert.Equal(t, "sealed", recent[0].Uid)
+		assert.Equal(t, "c", recent[1].Uid)
+		assert.Equal(t, []internal.FreeonBlame{{Reporter: 1, Accused: 1, Reason: "test"}}, recent[1].Blame)
+
+		// FinalizeSignature
+		err = db.FinalizeSignature(c, "sig")
+		assert.NoError(t, err)
+		cData, err = db.GetCeremonyData("c")
+		assert.NoError(t, err)
+		assert.False(t, cData.Active)
+		assert.Equal(t, "sig", *cData.Signature)
+
+		// InsertKeygenMessage
+		km := internal.FreeonKeygenMessage{
+			GroupID: gid,
+			Sender:  pid,
+			Message: []byte("keygen message"),
+		}
+		kmid, err := db.InsertKeygenMessage(km)
+		assert.NoError(t, err)
+		assert.NotZero(t, kmid)
+
+		// GetKeygenMessagesSince
+		kms, err := db.GetKeygenMessagesSince("g", 0)
+		assert.NoError(t, err)
+		assert.Len(t, kms, 1)
+		assert.Equal(t, km.Message, kms[0].Message)
+		kms, err = db.GetKeygenMessagesSince("g", kmid)
+		assert.NoError(t, err)
+		assert.Empty(t, kms)
+
+		// GetKeygenMessagesFrom
+		kms, err = db.GetKeygenMessagesFrom("g", 1)
+		assert.NoError(t, err)
+		assert.Len(t, kms, 1)
+
+		// InsertSignMessage
+		sm := internal.FreeonSignMessage{
+			CeremonyID: cid,
+			Sender:     pid,
+			Message:    []byte("sign message"),
+		}
+		smid, err := db.InsertSignMessage(sm)
+		assert.NoError(t, err)
+		assert.NotZero(t, smid)
+
+		// GetSignMessagesSince
+		sms, err := db.GetSignMessagesSince("c", 0)
+		assert.NoError(t, err)
+		assert.Len(t, sms, 1)
+		assert.Equal(t, sm.Message, sms[0].Message)
+	})
 }
 
 func TestGroupFunctions(t *testing.T) {
-	db := setupTestDB(t)
-	err := internal.DbEnsureTablesExist(db)
-	assert.NoError(t, err)
+	forEachStorage(t, func(t *testing.T, db internal.Storage) {
+		// Insert a group
+		group := internal.FreeonGroup{
+			Uid:          "test_group",
+			Participants: 3,
+			Threshold:    2,
+		}
+		id, err := db.InsertGroup(group)
+		assert.NoError(t, err)
+		assert.NotZero(t, id)
+		group.DbId = id
 
-	// Insert a group
-	group := internal.FreeonGroup{
-		Uid:          "test_group",
-		Participants: 3,
-		Threshold:    2,
-	}
-	id, err := internal.InsertGroup(db, group)
-	assert.NoError(t, err)
-	assert.NotZero(t, id)
-	group.DbId = id
+		// GetGroupData
+		groupData, err := db.GetGroupData("test_group")
+		assert.NoError(t, err)
+		assert.Equal(t, id, groupData.DbId)
+		assert.Equal(t, group.Uid, groupData.Uid)
+		assert.Equal(t, group.Participants, groupData.Participants)
+		assert.Equal(t, group.Threshold, groupData.Threshold)
+		assert.Equal(t, internal.GroupStatusOpen, groupData.Status)
+		_, err = db.GetGroupData("nonexistent")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
 
-	// GetGroupRowId
-	rowId, err := internal.GetGroupRowId(db, "test_group")
-	assert.NoError(t, err)
-	assert.Equal(t, id, int64(rowId))
+		// GetGroupByID
+		groupByID, err := db.GetGroupByID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, group.Uid, groupByID.Uid)
 
-	// GetGroupData
-	groupData, err := internal.GetGroupData(db, "test_group")
-	assert.NoError(t, err)
-	assert.Equal(t, group.Uid, groupData.Uid)
-	assert.Equal(t, group.Participants, groupData.Participants)
-	assert.Equal(t, group.Threshold, groupData.Threshold)
+		// FinalizeGroup
+		publicKey := "test_public_key"
+		group.PublicKey = &publicKey
+		err = db.FinalizeGroup(group)
+		assert.NoError(t, err)
 
-	// GetGroupByID
-	groupByID, err := internal.GetGroupByID(db, id)
-	assert.NoError(t, err)
-	assert.Equal(t, group.Uid, groupByID.Uid)
+		finalizedGroup, err := db.GetGroupData("test_group")
+		assert.NoError(t, err)
+		assert.NotNil(t, finalizedGroup.PublicKey)
+		assert.Equal(t, publicKey, *finalizedGroup.PublicKey)
+		assert.Equal(t, internal.GroupStatusComplete, finalizedGroup.Status)
 
-	// FinalizeGroup
-	publicKey := "test_public_key"
-	group.PublicKey = &publicKey
-	err = internal.FinalizeGroup(db, group)
-	assert.NoError(t, err)
+		// SetGroupStatus only moves groups that have the expected status
+		err = db.SetGroupStatus("test_group", internal.GroupStatusOpen, internal.GroupStatusArchived)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		err = db.SetGroupStatus("test_group", internal.GroupStatusComplete, internal.GroupStatusArchived)
+		assert.NoError(t, err)
+		archivedGroup, err := db.GetGroupData("test_group")
+		assert.NoError(t, err)
+		assert.Equal(t, internal.GroupStatusArchived, archivedGroup.Status)
+	})
+}
 
-	finalizedGroup, err := internal.GetGroupData(db, "test_group")
-	assert.NoError(t, err)
-	assert.NotNil(t, finalizedGroup.PublicKey)
-	assert.Equal(t, publicKey, *finalizedGroup.PublicKey)
+func TestStorageDeadlines(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db internal.Storage) {
+		now := time.Unix(1_000_000, 0)
+		gid, err := db.InsertGroup(internal.FreeonGroup{Uid: "late", Participants: 2, Threshold: 2})
+		assert.NoError(t, err)
+		_, err = db.InsertGroup(internal.FreeonGroup{Uid: "early", Participants: 2, Threshold: 2})
+		assert.NoError(t, err)
+		pid, err := db.InsertParticipant(internal.FreeonParticipant{GroupID: gid, Uid: "p", PartyID: 1})
+		assert.NoError(t, err)
+		_, err = db.InsertKeygenMessage(internal.FreeonKeygenMessage{GroupID: gid, Sender: pid, Message: []byte("m")})
+		assert.NoError(t, err)
+		assert.NoError(t, db.SetGroupDeadline("late", now.Add(-time.Minute)))
+		assert.NoError(t, db.SetGroupDeadline("early", now.Add(time.Minute)))
+		assert.Error(t, db.SetGroupDeadline("nonexistent", now))
+
+		_, err = db.InsertCeremony(internal.FreeonCeremonies{GroupID: gid, Uid: "c", Active: true, Hash: "hash"})
+		assert.NoError(t, err)
+		assert.NoError(t, db.SetCeremonyDeadline("c", now.Add(-time.Minute)))
+
+		expired, err := db.ExpireGroups(now, "too slow")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"late"}, expired)
+		group, err := db.GetGroupData("late")
+		assert.NoError(t, err)
+		assert.Equal(t, internal.GroupStatusExpired, group.Status)
+		assert.Equal(t, "too slow", *group.Verdict)
+		assert.Equal(t, now.Add(-time.Minute).Unix(), *group.Deadline)
+
+		expired, err = db.ExpireCeremonies(now)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c"}, expired)
+		ceremony, err := db.GetCeremonyData("c")
+		assert.NoError(t, err)
+		assert.False(t, ceremony.Active)
+		assert.True(t, ceremony.Expired)
+
+		// Messages are kept until the retention period is over
+		assert.NoError(t, db.DeleteExpiredMessages(now.Add(-time.Hour)))
+		msgs, err := db.GetKeygenMessagesSince("late", 0)
+		assert.NoError(t, err)
+		assert.Len(t, msgs, 1)
+		assert.NoError(t, db.DeleteExpiredMessages(now))
+		msgs, err = db.GetKeygenMessagesSince("late", 0)
+		assert.NoError(t, err)
+		assert.Empty(t, msgs)
+	})
+}
+
+func TestStorageReshare(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db internal.Storage) {
+		gid, err := db.InsertGroup(internal.FreeonGroup{Uid: "g", Participants: 2, Threshold: 2})
+		assert.NoError(t, err)
+		p1, err := db.InsertParticipant(internal.FreeonParticipant{GroupID: gid, Uid: "p1", PartyID: 1})
+		assert.NoError(t, err)
+		p2, err := db.InsertParticipant(internal.FreeonParticipant{GroupID: gid, Uid: "p2", PartyID: 2})
+		assert.NoError(t, err)
+
+		reshare := internal.FreeonReshare{GroupID: gid, Uid: "r", Epoch: 1, Participants: 2, Threshold: 1}
+		reshare.DbId, err = db.InsertReshare(reshare)
+		assert.NoError(t, err)
+		open, err := db.GetOpenReshare("g")
+		assert.NoError(t, err)
+		assert.Equal(t, "r", open.Uid)
+
+		// A new participant is pending until the reshare is complete
+		p3, err := db.InsertParticipant(internal.FreeonParticipant{GroupID: gid, Uid: "p3", PartyID: 3, Pending: true})
+		assert.NoError(t, err)
+		participants, err := db.GetGroupParticipants("g")
+		assert.NoError(t, err)
+		assert.Len(t, participants, 2)
+
+		for _, x := range []internal.FreeonResharer{
+			{ReshareID: reshare.DbId, ParticipantID: p1, Dealer: true},
+			{ReshareID: reshare.DbId, ParticipantID: p2, Dealer: true, Recipient: true},
+			{ReshareID: reshare.DbId, ParticipantID: p3, Recipient: true},
+		} {
+			_, err := db.InsertResharer(x)
+			assert.NoError(t, err)
+		}
+		resharers, err := db.GetResharers("r")
+		assert.NoError(t, err)
+		assert.Len(t, resharers, 3)
+		assert.Equal(t, uint16(3), resharers[2].PartyID)
+
+		// A newcomer who leaves takes their seat with them
+		p4, err := db.InsertParticipant(internal.FreeonParticipant{GroupID: gid, Uid: "p4", PartyID: 4, Pending: true})
+		assert.NoError(t, err)
+		_, err = db.InsertResharer(internal.FreeonResharer{ReshareID: reshare.DbId, ParticipantID: p4, Recipient: true})
+		assert.NoError(t, err)
+		resharers, err = db.GetResharers("r")
+		assert.NoError(t, err)
+		assert.Len(t, resharers, 4)
+		assert.NoError(t, db.DeleteResharer(resharers[3]))
+		assert.ErrorIs(t, db.DeleteResharer(resharers[3]), internal.ErrNotFound)
+		assert.NoError(t, db.DeleteParticipant(p4))
+		resharers, err = db.GetResharers("r")
+		assert.NoError(t, err)
+		assert.Len(t, resharers, 3)
+
+		assert.NoError(t, db.CompleteReshare(reshare))
+		_, err = db.GetOpenReshare("g")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		group, err := db.GetGroupData("g")
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(1), group.Threshold)
+		assert.Equal(t, uint64(1), group.Epoch)
+
+		// Party 1 didn't receive a share, so it's retired, but its party ID is never handed out again
+		participants, err = db.GetGroupParticipants("g")
+		assert.NoError(t, err)
+		assert.Len(t, participants, 2)
+		assert.Equal(t, uint16(2), participants[0].PartyID)
+		assert.Equal(t, uint16(3), participants[1].PartyID)
+		assert.False(t, participants[1].Pending)
+		maxID, err := db.GetMaxPartyID("g")
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(3), maxID)
+	})
+}
+
+func TestStorageRoles(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db internal.Storage) {
+		gid, err := db.InsertGroup(internal.FreeonGroup{Uid: "g", Participants: 2, Threshold: 2})
+		assert.NoError(t, err)
+
+		// Granting twice is the same as granting once
+		assert.NoError(t, db.InsertMemberRole(gid, 2, internal.RoleAdmin))
+		assert.NoError(t, db.InsertMemberRole(gid, 2, internal.RoleAdmin))
+		assert.NoError(t, db.InsertMemberRole(gid, 1, internal.RoleProposer))
+		roles, err := db.GetMemberRoles("g")
+		assert.NoError(t, err)
+		assert.Equal(t, []internal.FreeonMemberRole{
+			{PartyID: 1, Role: internal.RoleProposer},
+			{PartyID: 2, Role: internal.RoleAdmin},
+		}, roles)
+		assert.NoError(t, db.DeleteMemberRole("g", 2, internal.RoleAdmin))
+		assert.ErrorIs(t, db.DeleteMemberRole("g", 2, internal.RoleAdmin), internal.ErrNotFound)
+
+		// API tokens
+		token := internal.FreeonApiToken{Label: "ci", Role: internal.RoleProposer}
+		assert.NoError(t, db.InsertApiToken(gid, token, "hash1"))
+		assert.Error(t, db.InsertApiToken(gid, token, "hash2"))
+		found, err := db.GetApiToken("g", "hash1")
+		assert.NoError(t, err)
+		assert.Equal(t, "ci", found.Label)
+		assert.Equal(t, internal.RoleProposer, found.Role)
+		_, err = db.GetApiToken("g", "hash2")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		tokens, err := db.GetApiTokens("g")
+		assert.NoError(t, err)
+		assert.Len(t, tokens, 1)
+		assert.NoError(t, db.DeleteApiToken("g", "ci"))
+		assert.ErrorIs(t, db.DeleteApiToken("g", "ci"), internal.ErrNotFound)
+	})
+}
+
+func TestStorageAtomically(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db internal.Storage) {
+		err := db.Atomically(func(tx internal.Storage) error {
+			_, err := tx.InsertGroup(internal.FreeonGroup{Uid: "kept", Participants: 2, Threshold: 2})
+			return err
+		})
+		assert.NoError(t, err)
+
+		// Nothing sticks if the transaction fails
+		err = db.Atomically(func(tx internal.Storage) error {
+			if _, err := tx.InsertGroup(internal.FreeonGroup{Uid: "dropped", Participants: 2, Threshold: 2}); err != nil {
+				return err
+			}
+			if err := tx.SetGroupStatus("kept", internal.GroupStatusOpen, internal.GroupStatusAborted); err != nil {
+				return err
+			}
+			_, err := tx.GetGroupData("nonexistent")
+			return err
+		})
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		_, err = db.GetGroupData("dropped")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		group, err := db.GetGroupData("kept")
+		assert.NoError(t, err)
+		assert.Equal(t, internal.GroupStatusOpen, group.Status)
+	})
 }
@@ -0,0 +1,51 @@
+package internal
+
+import "sync"
+
+// Wakes up event streams whenever something changes in a key group or signing ceremony.
+//
+// Subscribers are only told that something changed, not what. They go back to the database for the details, so a
+// slow subscriber never holds anyone else up, and a missed wakeup can't lose a message.
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe to changes for a group or ceremony UID. Call the returned function to unsubscribe.
+func (h *EventHub) Subscribe(topic string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = make(map[chan struct{}]struct{})
+	}
+	h.subscribers[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers[topic], ch)
+		if len(h.subscribers[topic]) == 0 {
+			delete(h.subscribers, topic)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Wake up everyone subscribed to a group or ceremony UID
+func (h *EventHub) Notify(topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[topic] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// Already has a wakeup pending
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := internal.NewEventHub()
+	a, unsubscribeA := hub.Subscribe("g_test")
+	b, unsubscribeB := hub.Subscribe("c_test")
+	defer unsubscribeB()
+
+	// Wakeups coalesce, and only go to the right topic
+	hub.Notify("g_test")
+	hub.Notify("g_test")
+	assert.Len(t, a, 1)
+	assert.Len(t, b, 0)
+	<-a
+
+	// Nothing is delivered after unsubscribing
+	unsubscribeA()
+	hub.Notify("g_test")
+	assert.Len(t, a, 0)
+}
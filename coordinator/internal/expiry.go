@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"time"
+)
+
+// Key generation and signing ceremonies that nobody finishes shouldn't stay open forever
+
+// Whether a deadline has come and gone. The reaper might not have noticed yet.
+func PastDeadline(deadline *int64, now time.Time) bool {
+	return deadline != nil && now.Unix() >= *deadline
+}
+
+// Seconds left until a deadline, or nil if there isn't one
+func SecondsLeft(deadline *int64, now time.Time) *int64 {
+	if deadline == nil {
+		return nil
+	}
+	left := max(*deadline-now.Unix(), 0)
+	return &left
+}
+
+// Close whatever has missed its deadline, and throw away the messages of anything that expired more than `retention`
+// ago, along with request nonces too old to be replayed anyway. Returns the IDs of the key groups and ceremonies that just expired, so anyone waiting on them can be told.
+func ReapExpired(db Storage, now time.Time, retention time.Duration) ([]string, error) {
+	var expired []string
+	err := db.Atomically(func(tx Storage) error {
+		// Writing before reading keeps us from tripping over concurrent requests' locks
+		groups, err := tx.ExpireGroups(now, "key generation did not finish before its deadline")
+		if err != nil {
+			return err
+		}
+		ceremonies, err := tx.ExpireCeremonies(now)
+		if err != nil {
+			return err
+		}
+		expired = append(groups, ceremonies...)
+		if err := tx.DeleteExpiredNonces(now); err != nil {
+			return err
+		}
+		return tx.DeleteExpiredMessages(now.Add(-retention))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
@@ -0,0 +1,85 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReapExpired(t *testing.T) {
+	db := setupTestDBForSign(t)
+	now := time.Now()
+
+	// A key generation that nobody finished in time
+	stale, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	p, err := internal.AddParticipant(db, stale, newTestPublicKey(t))
+	assert.NoError(t, err)
+	_, err = internal.AddKeyGenMessage(db, stale, p.PartyID, testEnvelope(p.PartyID))
+	assert.NoError(t, err)
+	assert.NoError(t, db.SetGroupDeadline(stale, now.Add(-time.Minute)))
+
+	// Nobody can join once the deadline has passed, even before the reaper gets to it
+	_, err = internal.AddParticipant(db, stale, newTestPublicKey(t))
+	assert.Error(t, err)
+
+	// A signing ceremony that nobody finished in time, and one that still has time left
+	g_uid, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	signer, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	cosigner, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	late, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+	joinTestSigners(t, db, g_uid, late, signer.PartyID, cosigner.PartyID)
+	_, err = internal.AddSignMessage(db, late, signer.PartyID, testCommitment(signer.PartyID))
+	assert.NoError(t, err)
+	assert.NoError(t, db.SetCeremonyDeadline(late, now.Add(-time.Minute)))
+	onTime, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.SetCeremonyDeadline(onTime, now.Add(time.Hour)))
+
+	_, err = internal.JoinSignCeremony(db, late, testHash(g_uid), signer.PartyID, 0)
+	assert.Error(t, err)
+
+	expired, err := internal.ReapExpired(db, now, time.Hour)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{stale, late}, expired)
+
+	group, err := db.GetGroupData(stale)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusExpired, group.Status)
+	_, err = internal.AddKeyGenMessage(db, stale, p.PartyID, testEnvelope(p.PartyID))
+	assert.Error(t, err)
+
+	poll, err := internal.PollSignCeremony(db, late, signer.PartyID)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.CeremonyStatusExpired, poll.Status)
+	assert.Nil(t, poll.ExpiresIn)
+	poll, err = internal.PollSignCeremony(db, onTime, signer.PartyID)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.CeremonyStatusOpen, poll.Status)
+	assert.NotNil(t, poll.ExpiresIn)
+	assert.InDelta(t, time.Hour.Seconds(), *poll.ExpiresIn, 5)
+
+	// The messages stick around until the retention period is up
+	msgs, err := db.GetKeygenMessagesSince(stale, 0)
+	assert.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	signMsgs, err := db.GetSignMessagesSince(late, 0)
+	assert.NoError(t, err)
+	assert.Len(t, signMsgs, 1)
+
+	expired, err = internal.ReapExpired(db, now.Add(2*time.Hour), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{onTime}, expired)
+	msgs, err = db.GetKeygenMessagesSince(stale, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+	signMsgs, err = db.GetSignMessagesSince(late, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, signMsgs)
+}
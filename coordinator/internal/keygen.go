@@ -1,12 +1,14 @@
 package internal
 
 import (
-	"database/sql"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"time"
 )
 
 // Create a new DKG group
-func NewKeyGroup(db *sql.DB, partySize, threshold uint16) (string, error) {
+func NewKeyGroup(db Storage, partySize, threshold uint16) (string, error) {
 	// Unique ID (192 bits entropy)
 	uid, err := UniqueID()
 	if err != nil {
@@ -14,11 +16,7 @@ func NewKeyGroup(db *sql.DB, partySize, threshold uint16) (string, error) {
 	}
 	uid = "g_" + uid
 
-	stmt, err := db.Prepare(`INSERT INTO keygroups (uid, participants, threshold) VALUES (?, ?, ?)`)
-	if err != nil {
-		return "", err
-	}
-	_, err = stmt.Exec(uid, partySize, threshold)
+	_, err = db.InsertGroup(FreeonGroup{Uid: uid, Participants: partySize, Threshold: threshold})
 	if err != nil {
 		return "", err
 	}
@@ -26,72 +24,102 @@ func NewKeyGroup(db *sql.DB, partySize, threshold uint16) (string, error) {
 	return uid, nil
 }
 
-// Create a blank slate participant ID
-func AddParticipant(db *sql.DB, groupUid string) (FreeonParticipant, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return FreeonParticipant{}, err
-	}
-	defer tx.Rollback() // Rollback on error
-
-	groupData, err := GetGroupData(tx, groupUid)
-	if err != nil {
-		return FreeonParticipant{}, err
-	}
-	participants, err := GetGroupParticipants(tx, groupUid)
-	if err != nil {
+// Create a blank slate participant ID, bound to the participant's long-term public key
+func AddParticipant(db Storage, groupUid string, publicKey string) (FreeonParticipant, error) {
+	if _, err := ParsePublicKey(publicKey); err != nil {
 		return FreeonParticipant{}, err
 	}
-	if len(participants) >= int(groupData.Participants) {
-		return FreeonParticipant{}, errors.New("cannot add participant: group is full")
-	}
+	var p FreeonParticipant
+	err := db.Atomically(func(tx Storage) error {
+		groupData, err := tx.GetGroupData(groupUid)
+		if err != nil {
+			return err
+		}
+		if groupData.Status != GroupStatusOpen || PastDeadline(groupData.Deadline, time.Now()) {
+			return errors.New("cannot add participant: key generation is over")
+		}
+		participants, err := tx.GetGroupParticipants(groupUid)
+		if err != nil {
+			return err
+		}
+		if len(participants) >= int(groupData.Participants) {
+			return errors.New("cannot add participant: group is full")
+		}
 
-	// Figure out the maximum party ID for existing participants
-	var max uint16 = 0
-	for _, p := range participants {
-		if p.PartyID > max {
-			max = p.PartyID
+		// Take the lowest free party ID, so they stay within the group's size even after someone leaves
+		taken := make(map[uint16]bool, len(participants))
+		for _, p := range participants {
+			taken[p.PartyID] = true
+		}
+		var partyID uint16 = 1
+		for taken[partyID] {
+			partyID++
 		}
-	}
-	if max == 0xFFFF {
-		return FreeonParticipant{}, errors.New("cannot add participant: party ID would overflow")
-	}
-	nextMaxId := max + 1
 
-	// Get a unique participant ID
-	uid, err := UniqueID()
-	if err != nil {
-		return FreeonParticipant{}, err
-	}
-	uid = "p_" + uid
+		// Get a unique participant ID
+		uid, err := UniqueID()
+		if err != nil {
+			return err
+		}
+		uid = "p_" + uid
 
-	p := FreeonParticipant{
-		DbId:    int64(0),
-		GroupID: groupData.DbId,
-		Uid:     uid,
-		PartyID: nextMaxId,
-		State:   []byte{},
-	}
-	id, err := InsertParticipant(tx, p)
+		p = FreeonParticipant{
+			DbId:      int64(0),
+			GroupID:   groupData.DbId,
+			Uid:       uid,
+			PartyID:   partyID,
+			PublicKey: publicKey,
+			State:     []byte{},
+		}
+		p.DbId, err = tx.InsertParticipant(p)
+		return err
+	})
 	if err != nil {
 		return FreeonParticipant{}, err
 	}
-	p.DbId = id
-
-	if err = tx.Commit(); err != nil {
-		return FreeonParticipant{}, err
-	}
 
 	return p, nil
 }
 
+// Give up a seat in a keygen ceremony, so it doesn't wait on a party that's gone. Once everyone has joined, it's too
+// late: the key is being made for exactly those parties.
+func LeaveKeyGen(db Storage, groupUid string, myPartyID uint16) error {
+	return db.Atomically(func(tx Storage) error {
+		groupData, err := tx.GetGroupData(groupUid)
+		if err != nil {
+			return err
+		}
+		if groupData.Status != GroupStatusOpen {
+			return errors.New("key generation is over")
+		}
+		participants, err := tx.GetGroupParticipants(groupUid)
+		if err != nil {
+			return err
+		}
+		if len(participants) >= int(groupData.Participants) {
+			return errors.New("everyone has joined this group already; it's too late to leave")
+		}
+		participantId, err := tx.GetParticipantID(groupUid, myPartyID)
+		if err != nil {
+			return err
+		}
+		return tx.DeleteParticipant(participantId)
+	})
+}
+
 // Add a keygen message to the queue
-func AddKeyGenMessage(db *sql.DB, groupUid string, myPartyID uint16, message []byte) (FreeonKeygenMessage, error) {
-	group, err := GetGroupData(db, groupUid)
+func AddKeyGenMessage(db Storage, groupUid string, myPartyID uint16, message []byte) (FreeonKeygenMessage, error) {
+	group, err := db.GetGroupData(groupUid)
 	if err != nil {
 		return FreeonKeygenMessage{}, err
 	}
-	participant, err := GetParticipantID(db, groupUid, myPartyID)
+	if group.Status == GroupStatusAborted || group.Status == GroupStatusExpired {
+		return FreeonKeygenMessage{}, fmt.Errorf("key generation was %s", group.Status)
+	}
+	if err := checkEnvelopeSender(message, myPartyID); err != nil {
+		return FreeonKeygenMessage{}, err
+	}
+	participant, err := db.GetParticipantID(groupUid, myPartyID)
 	if err != nil {
 		return FreeonKeygenMessage{}, err
 	}
@@ -101,7 +129,7 @@ func AddKeyGenMessage(db *sql.DB, groupUid string, myPartyID uint16, message []b
 		Sender:  participant,
 		Message: message,
 	}
-	id, err := InsertKeygenMessage(db, msg)
+	id, err := db.InsertKeygenMessage(msg)
 	if err != nil {
 		return FreeonKeygenMessage{}, err
 	}
@@ -109,14 +137,87 @@ func AddKeyGenMessage(db *sql.DB, groupUid string, myPartyID uint16, message []b
 	return msg, nil
 }
 
-func SetGroupPublicKey(db *sql.DB, groupUid string, publicKey string) error {
-	group, err := GetGroupData(db, groupUid)
+func SetGroupPublicKey(db Storage, groupUid string, publicKey string) error {
+	group, err := db.GetGroupData(groupUid)
 	if err != nil {
 		return err
 	}
 	if group.PublicKey != nil {
 		return errors.New("public key is already defined")
 	}
+	if group.Status == GroupStatusAborted || group.Status == GroupStatusDisputed || group.Status == GroupStatusExpired {
+		return fmt.Errorf("key generation was %s: %s", group.Status, *group.Verdict)
+	}
 	group.PublicKey = &publicKey
-	return FinalizeGroup(db, group)
+	return db.FinalizeGroup(group)
+}
+
+// Record the group public key a party ended up with at the end of key generation.
+//
+// Once every party has confirmed, the keys are compared. If they all match, the group is complete. Otherwise somebody
+// was fed different messages than everyone else, and the group is marked as disputed instead.
+func ConfirmGroupPublicKey(db Storage, groupUid string, myPartyID uint16, publicKey string) error {
+	group, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return err
+	}
+	switch group.Status {
+	case GroupStatusAborted:
+		return fmt.Errorf("key generation was aborted: %s", *group.Verdict)
+	case GroupStatusDisputed:
+		return fmt.Errorf("key generation is disputed: %s", *group.Verdict)
+	case GroupStatusExpired:
+		return fmt.Errorf("key generation expired: %s", *group.Verdict)
+	case GroupStatusComplete:
+		return errors.New("public key is already defined")
+	}
+	pubKey, err := hex.DecodeString(publicKey)
+	if err != nil || len(pubKey) != 32 {
+		return errors.New("public key must be 32 hex-encoded bytes")
+	}
+	participant, err := db.GetParticipantID(groupUid, myPartyID)
+	if err != nil {
+		return err
+	}
+	confirmations, err := db.GetKeyConfirmations(groupUid)
+	if err != nil {
+		return err
+	}
+	for _, c := range confirmations {
+		if c.PartyID == myPartyID {
+			return errors.New("already confirmed the group public key")
+		}
+	}
+	_, err = db.InsertKeyConfirmation(FreeonKeyConfirmation{
+		GroupID:     group.DbId,
+		Participant: participant,
+		PublicKey:   hex.EncodeToString(pubKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Read them back, in case somebody else confirmed at the same time
+	confirmations, err = db.GetKeyConfirmations(groupUid)
+	if err != nil {
+		return err
+	}
+	if len(confirmations) < int(group.Participants) {
+		return nil
+	}
+	for _, c := range confirmations[1:] {
+		if c.PublicKey != confirmations[0].PublicKey {
+			verdict := fmt.Sprintf("party %d and party %d disagree about the group public key", confirmations[0].PartyID, c.PartyID)
+			return db.DisputeGroup(group, verdict)
+		}
+	}
+	err = SetGroupPublicKey(db, groupUid, confirmations[0].PublicKey)
+	if err != nil {
+		// The last two parties may both get here, but only one of them sets the key
+		group, getErr := db.GetGroupData(groupUid)
+		if getErr == nil && group.PublicKey != nil && *group.PublicKey == confirmations[0].PublicKey {
+			return nil
+		}
+	}
+	return err
 }
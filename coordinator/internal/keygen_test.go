@@ -1,20 +1,14 @@
 package internal_test
 
 import (
-	"database/sql"
 	"testing"
 
-	_ "github.com/ncruces/go-sqlite3/driver"
-	_ "github.com/ncruces/go-sqlite3/embed"
 	"github.com/soatok/freeon/coordinator/internal"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupTestDBForKeygen(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
-	assert.NoError(t, err)
-	err = internal.DbEnsureTablesExist(db)
-	assert.NoError(t, err)
+func setupTestDBForKeygen(t *testing.T) internal.Storage {
+	db := internal.NewMemoryStorage()
 	t.Cleanup(func() {
 		db.Close()
 	})
@@ -27,7 +21,7 @@ func TestNewKeyGroup(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, uid)
 
-	group, err := internal.GetGroupData(db, uid)
+	group, err := db.GetGroupData(uid)
 	assert.NoError(t, err)
 	assert.Equal(t, uint16(3), group.Participants)
 	assert.Equal(t, uint16(2), group.Threshold)
@@ -38,34 +32,64 @@ func TestAddParticipant(t *testing.T) {
 	uid, err := internal.NewKeyGroup(db, 2, 2)
 	assert.NoError(t, err)
 
-	p1, err := internal.AddParticipant(db, uid)
+	// A valid public key is required
+	_, err = internal.AddParticipant(db, uid, "not-a-key")
+	assert.Error(t, err)
+
+	p1, err := internal.AddParticipant(db, uid, newTestPublicKey(t))
 	assert.NoError(t, err)
 	assert.Equal(t, uint16(1), p1.PartyID)
 
-	p2, err := internal.AddParticipant(db, uid)
+	p2, err := internal.AddParticipant(db, uid, newTestPublicKey(t))
 	assert.NoError(t, err)
 	assert.Equal(t, uint16(2), p2.PartyID)
 
 	// Group is full
-	_, err = internal.AddParticipant(db, uid)
+	_, err = internal.AddParticipant(db, uid, newTestPublicKey(t))
 	assert.Error(t, err)
 }
 
+func TestLeaveKeyGen(t *testing.T) {
+	db := setupTestDBForKeygen(t)
+	uid, err := internal.NewKeyGroup(db, 3, 2)
+	assert.NoError(t, err)
+	p1, err := internal.AddParticipant(db, uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	_, err = internal.AddParticipant(db, uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+
+	// Party 1 leaves, and whoever turns up next takes its party ID, so IDs stay within the group's size
+	assert.NoError(t, internal.LeaveKeyGen(db, uid, p1.PartyID))
+	assert.Error(t, internal.LeaveKeyGen(db, uid, p1.PartyID))
+	p, err := internal.AddParticipant(db, uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), p.PartyID)
+	p3, err := internal.AddParticipant(db, uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(3), p3.PartyID)
+
+	// Once everyone has joined, the key is being made for exactly them
+	assert.Error(t, internal.LeaveKeyGen(db, uid, p3.PartyID))
+	participants, err := db.GetGroupParticipants(uid)
+	assert.NoError(t, err)
+	assert.Len(t, participants, 3)
+}
+
 func TestAddKeyGenMessage(t *testing.T) {
 	db := setupTestDBForKeygen(t)
 	g_uid, err := internal.NewKeyGroup(db, 2, 2)
 	assert.NoError(t, err)
-	p, err := internal.AddParticipant(db, g_uid)
+	p, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
 	assert.NoError(t, err)
 
-	msg, err := internal.AddKeyGenMessage(db, g_uid, p.PartyID, []byte("test message"))
+	msg, err := internal.AddKeyGenMessage(db, g_uid, p.PartyID, testEnvelope(p.PartyID))
 	assert.NoError(t, err)
 	assert.NotZero(t, msg.DbId)
 
-	msgs, err := internal.GetKeygenMessagesSince(db, g_uid, 0)
+	msgs, err := db.GetKeygenMessagesSince(g_uid, 0)
 	assert.NoError(t, err)
 	assert.Len(t, msgs, 1)
-	assert.Equal(t, []byte("test message"), msgs[0].Message)
+	assert.Equal(t, testEnvelope(p.PartyID), msgs[0].Message)
 }
 
 func TestSetGroupPublicKey(t *testing.T) {
@@ -76,7 +100,7 @@ func TestSetGroupPublicKey(t *testing.T) {
 	err = internal.SetGroupPublicKey(db, g_uid, "test_pk")
 	assert.NoError(t, err)
 
-	group, err := internal.GetGroupData(db, g_uid)
+	group, err := db.GetGroupData(g_uid)
 	assert.NoError(t, err)
 	assert.Equal(t, "test_pk", *group.PublicKey)
 
@@ -84,3 +108,46 @@ func TestSetGroupPublicKey(t *testing.T) {
 	err = internal.SetGroupPublicKey(db, g_uid, "test_pk_2")
 	assert.Error(t, err)
 }
+
+func TestConfirmGroupPublicKey(t *testing.T) {
+	db := setupTestDBForKeygen(t)
+	pk := "0101010101010101010101010101010101010101010101010101010101010101"
+	other := "0202020202020202020202020202020202020202020202020202020202020202"
+
+	g_uid, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	p1, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	p2, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+
+	assert.Error(t, internal.ConfirmGroupPublicKey(db, g_uid, p1.PartyID, "test_pk"))
+	assert.NoError(t, internal.ConfirmGroupPublicKey(db, g_uid, p1.PartyID, pk))
+	assert.Error(t, internal.ConfirmGroupPublicKey(db, g_uid, p1.PartyID, pk))
+
+	// Nothing is final until everyone confirms
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Nil(t, group.PublicKey)
+	assert.NoError(t, internal.ConfirmGroupPublicKey(db, g_uid, p2.PartyID, pk))
+	group, err = db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusComplete, group.Status)
+	assert.Equal(t, pk, *group.PublicKey)
+
+	// A disagreement disputes the group instead
+	g_uid, err = internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	p1, err = internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	p2, err = internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	assert.NoError(t, internal.ConfirmGroupPublicKey(db, g_uid, p1.PartyID, pk))
+	assert.NoError(t, internal.ConfirmGroupPublicKey(db, g_uid, p2.PartyID, other))
+	group, err = db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusDisputed, group.Status)
+	assert.Nil(t, group.PublicKey)
+	assert.Contains(t, *group.Verdict, "disagree")
+	assert.Error(t, internal.SetGroupPublicKey(db, g_uid, pk))
+}
@@ -0,0 +1,1195 @@
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// A Storage that keeps everything in memory, for tests. It behaves like the SQL ones, down to the order things come
+// back in, but nothing survives a restart.
+type memoryStorage struct {
+	state *memoryState
+	// Set for the Storage handed to Atomically's fn, which already holds the lock
+	inTx bool
+}
+
+type memoryState struct {
+	mu     sync.Mutex
+	tables memoryTables
+}
+
+// One slice per table. Every row gets an ID from the same counter, so IDs go up in the order rows were inserted.
+type memoryTables struct {
+	lastID        int64
+	groups        []FreeonGroup
+	participants  []memoryParticipant
+	ceremonies    []FreeonCeremonies
+	players       []FreeonPlayers
+	keygenMsgs    []FreeonKeygenMessage
+	signMsgs      []FreeonSignMessage
+	refreshMsgs   []FreeonRefreshMessage
+	reshareMsgs   []FreeonReshareMessage
+	complaints    []FreeonComplaint
+	confirmations []FreeonKeyConfirmation
+	blames        []FreeonBlameRecord
+	refreshes     []FreeonRefresh
+	refreshers    []FreeonRefresher
+	reshares      []FreeonReshare
+	resharers     []FreeonResharer
+	invites       []memoryInvite
+	memberRoles   []memoryMemberRole
+	apiTokens     []memoryApiToken
+	nonces        []memoryNonce
+}
+
+type memoryParticipant struct {
+	FreeonParticipant
+	active bool
+}
+
+type memoryMemberRole struct {
+	id      int64
+	groupID int64
+	FreeonMemberRole
+}
+
+type memoryApiToken struct {
+	groupID   int64
+	tokenHash string
+	FreeonApiToken
+}
+
+type memoryInvite struct {
+	reshareID int64
+	publicKey string
+}
+
+type memoryNonce struct {
+	nonce   string
+	expires int64
+}
+
+func NewMemoryStorage() Storage {
+	return &memoryStorage{state: &memoryState{}}
+}
+
+// Take the lock, unless we're in a transaction that already has it. Use as `defer m.lock()()`.
+func (m *memoryStorage) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.state.mu.Lock()
+	return m.state.mu.Unlock
+}
+
+func (m *memoryStorage) t() *memoryTables {
+	return &m.state.tables
+}
+
+func (m *memoryStorage) Atomically(fn func(tx Storage) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	saved := m.state.tables.clone()
+	if err := fn(&memoryStorage{state: m.state, inTx: true}); err != nil {
+		m.state.tables = saved
+		return err
+	}
+	return nil
+}
+
+func (m *memoryStorage) Close() error {
+	return nil
+}
+
+// Rows are only ever replaced, never changed in place, so copying the slices is enough to roll back
+func (t memoryTables) clone() memoryTables {
+	return memoryTables{
+		lastID:        t.lastID,
+		groups:        slices.Clone(t.groups),
+		participants:  slices.Clone(t.participants),
+		ceremonies:    slices.Clone(t.ceremonies),
+		players:       slices.Clone(t.players),
+		keygenMsgs:    slices.Clone(t.keygenMsgs),
+		signMsgs:      slices.Clone(t.signMsgs),
+		refreshMsgs:   slices.Clone(t.refreshMsgs),
+		reshareMsgs:   slices.Clone(t.reshareMsgs),
+		complaints:    slices.Clone(t.complaints),
+		confirmations: slices.Clone(t.confirmations),
+		blames:        slices.Clone(t.blames),
+		refreshes:     slices.Clone(t.refreshes),
+		refreshers:    slices.Clone(t.refreshers),
+		reshares:      slices.Clone(t.reshares),
+		resharers:     slices.Clone(t.resharers),
+		invites:       slices.Clone(t.invites),
+		memberRoles:   slices.Clone(t.memberRoles),
+		apiTokens:     slices.Clone(t.apiTokens),
+		nonces:        slices.Clone(t.nonces),
+	}
+}
+
+func (t *memoryTables) nextID() int64 {
+	t.lastID++
+	return t.lastID
+}
+
+// Helpers for looking things up by ID. The index is -1 if there's no such row.
+
+func (t *memoryTables) group(uid string) int {
+	return slices.IndexFunc(t.groups, func(g FreeonGroup) bool { return g.Uid == uid })
+}
+
+func (t *memoryTables) groupByID(id int64) int {
+	return slices.IndexFunc(t.groups, func(g FreeonGroup) bool { return g.DbId == id })
+}
+
+func (t *memoryTables) groupID(uid string) int64 {
+	if i := t.group(uid); i >= 0 {
+		return t.groups[i].DbId
+	}
+	return -1
+}
+
+func (t *memoryTables) participant(id int64) memoryParticipant {
+	i := slices.IndexFunc(t.participants, func(p memoryParticipant) bool { return p.DbId == id })
+	if i < 0 {
+		return memoryParticipant{}
+	}
+	return t.participants[i]
+}
+
+func (t *memoryTables) activeParticipant(groupUid string, partyID uint16) (memoryParticipant, error) {
+	groupID := t.groupID(groupUid)
+	for _, p := range t.participants {
+		if p.GroupID == groupID && p.PartyID == partyID && p.active {
+			return p, nil
+		}
+	}
+	return memoryParticipant{}, ErrNotFound
+}
+
+func (t *memoryTables) ceremony(uid string) int {
+	return slices.IndexFunc(t.ceremonies, func(c FreeonCeremonies) bool { return c.Uid == uid })
+}
+
+func (t *memoryTables) ceremonyID(uid string) int64 {
+	if i := t.ceremony(uid); i >= 0 {
+		return t.ceremonies[i].DbId
+	}
+	return -1
+}
+
+func (t *memoryTables) refreshID(uid string) int64 {
+	i := slices.IndexFunc(t.refreshes, func(r FreeonRefresh) bool { return r.Uid == uid })
+	if i < 0 {
+		return -1
+	}
+	return t.refreshes[i].DbId
+}
+
+func (t *memoryTables) reshareID(uid string) int64 {
+	i := slices.IndexFunc(t.reshares, func(r FreeonReshare) bool { return r.Uid == uid })
+	if i < 0 {
+		return -1
+	}
+	return t.reshares[i].DbId
+}
+
+// Key groups
+
+func (m *memoryStorage) InsertGroup(g FreeonGroup) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	id := t.nextID()
+	t.groups = append(t.groups, FreeonGroup{
+		DbId:         id,
+		Uid:          g.Uid,
+		Participants: g.Participants,
+		Threshold:    g.Threshold,
+		Status:       GroupStatusOpen,
+	})
+	return id, nil
+}
+
+func (m *memoryStorage) GetGroupData(groupUid string) (FreeonGroup, error) {
+	defer m.lock()()
+	t := m.t()
+	i := t.group(groupUid)
+	if i < 0 {
+		return FreeonGroup{}, ErrNotFound
+	}
+	return t.groups[i], nil
+}
+
+func (m *memoryStorage) GetGroupByID(groupID int64) (FreeonGroup, error) {
+	defer m.lock()()
+	t := m.t()
+	i := t.groupByID(groupID)
+	if i < 0 {
+		return FreeonGroup{}, ErrNotFound
+	}
+	return t.groups[i], nil
+}
+
+// Change a group, if there is one with that ID
+func (m *memoryStorage) updateGroup(groupID int64, update func(g *FreeonGroup)) {
+	t := m.t()
+	if i := t.groupByID(groupID); i >= 0 {
+		update(&t.groups[i])
+	}
+}
+
+func (m *memoryStorage) FinalizeGroup(g FreeonGroup) error {
+	if g.PublicKey == nil {
+		return errors.New("public key is not stored in FreeonGroup struct")
+	}
+	defer m.lock()()
+	publicKey := *g.PublicKey
+	m.updateGroup(g.DbId, func(row *FreeonGroup) {
+		row.PublicKey = &publicKey
+		row.Status = GroupStatusComplete
+	})
+	return nil
+}
+
+func (m *memoryStorage) DisputeGroup(g FreeonGroup, verdict string) error {
+	defer m.lock()()
+	m.updateGroup(g.DbId, func(row *FreeonGroup) {
+		row.Status = GroupStatusDisputed
+		row.Verdict = &verdict
+	})
+	return nil
+}
+
+func (m *memoryStorage) AbortGroup(g FreeonGroup, verdict string) error {
+	defer m.lock()()
+	m.updateGroup(g.DbId, func(row *FreeonGroup) {
+		row.Status = GroupStatusAborted
+		row.Verdict = &verdict
+	})
+	return nil
+}
+
+func (m *memoryStorage) SetGroupStatus(groupUid, from, to string) error {
+	defer m.lock()()
+	t := m.t()
+	i := t.group(groupUid)
+	if i < 0 || t.groups[i].Status != from {
+		return ErrNotFound
+	}
+	t.groups[i].Status = to
+	return nil
+}
+
+func (m *memoryStorage) SetGroupDeadline(groupUid string, deadline time.Time) error {
+	defer m.lock()()
+	t := m.t()
+	i := t.group(groupUid)
+	if i < 0 {
+		return errors.New("group not found")
+	}
+	unix := deadline.Unix()
+	t.groups[i].Deadline = &unix
+	return nil
+}
+
+func (m *memoryStorage) ExpireGroups(now time.Time, verdict string) ([]string, error) {
+	defer m.lock()()
+	t := m.t()
+	var expired []string
+	for i, g := range t.groups {
+		if g.Status == GroupStatusOpen && g.Deadline != nil && *g.Deadline <= now.Unix() {
+			t.groups[i].Status = GroupStatusExpired
+			t.groups[i].Verdict = &verdict
+			expired = append(expired, g.Uid)
+		}
+	}
+	return expired, nil
+}
+
+// Participants
+
+func (m *memoryStorage) InsertParticipant(p FreeonParticipant) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	p.DbId = t.nextID()
+	p.State = nil
+	t.participants = append(t.participants, memoryParticipant{FreeonParticipant: p, active: !p.Pending})
+	return p.DbId, nil
+}
+
+func (m *memoryStorage) GetGroupParticipants(groupUid string) ([]FreeonParticipant, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	var participants []FreeonParticipant
+	for _, p := range t.participants {
+		if p.GroupID == groupID && p.active {
+			participants = append(participants, FreeonParticipant{
+				DbId:      p.DbId,
+				GroupID:   p.GroupID,
+				Uid:       p.Uid,
+				PartyID:   p.PartyID,
+				PublicKey: p.PublicKey,
+			})
+		}
+	}
+	return participants, nil
+}
+
+func (m *memoryStorage) GetParticipantID(groupUid string, myPartyID uint16) (int64, error) {
+	defer m.lock()()
+	p, err := m.t().activeParticipant(groupUid, myPartyID)
+	if err != nil {
+		return 0, err
+	}
+	return p.DbId, nil
+}
+
+func (m *memoryStorage) GetParticipantPublicKey(groupUid string, myPartyID uint16) (string, error) {
+	defer m.lock()()
+	p, err := m.t().activeParticipant(groupUid, myPartyID)
+	if err != nil {
+		return "", err
+	}
+	return p.PublicKey, nil
+}
+
+func (m *memoryStorage) DeleteParticipant(participantID int64) error {
+	defer m.lock()()
+	t := m.t()
+	before := len(t.participants)
+	t.participants = slices.DeleteFunc(slices.Clone(t.participants), func(p memoryParticipant) bool {
+		return p.DbId == participantID
+	})
+	if len(t.participants) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *memoryStorage) GetMaxPartyID(groupUid string) (uint16, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	var max uint16
+	for _, p := range t.participants {
+		if p.GroupID == groupID && p.PartyID > max {
+			max = p.PartyID
+		}
+	}
+	return max, nil
+}
+
+// Signing ceremonies
+
+func (m *memoryStorage) InsertCeremony(c FreeonCeremonies) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	id := t.nextID()
+	row := FreeonCeremonies{
+		DbId:             id,
+		GroupID:          c.GroupID,
+		Uid:              c.Uid,
+		Active:           c.Active,
+		Hash:             c.Hash,
+		OpenSSH:          c.OpenSSH,
+		OpenSSHNamespace: c.OpenSSHNamespace,
+		SSHCertificate:   c.SSHCertificate,
+		Message:          c.Message,
+		Epoch:            c.Epoch,
+		SealedMessage:    c.SealedMessage,
+	}
+	if len(c.Preferred) > 0 {
+		row.Preferred = slices.Clone(c.Preferred)
+	}
+	t.ceremonies = append(t.ceremonies, row)
+	return id, nil
+}
+
+func (m *memoryStorage) GetCeremonyData(ceremonyUid string) (FreeonCeremonies, error) {
+	defer m.lock()()
+	t := m.t()
+	i := t.ceremony(ceremonyUid)
+	if i < 0 {
+		return FreeonCeremonies{}, ErrNotFound
+	}
+	c := t.ceremonies[i]
+	c.Preferred = slices.Clone(c.Preferred)
+	return c, nil
+}
+
+func (m *memoryStorage) GetRecentCeremonies(groupUid string, limit, offset int64) ([]FreeonCeremonySummary, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	var results []FreeonCeremonySummary
+	for i := len(t.ceremonies) - 1; i >= 0; i-- {
+		c := t.ceremonies[i]
+		if c.GroupID != groupID {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if int64(len(results)) >= limit {
+			break
+		}
+		summary := FreeonCeremonySummary{
+			Uid:            c.Uid,
+			Active:         c.Active,
+			Hash:           c.Hash,
+			Signature:      c.Signature,
+			OpenSSH:        c.OpenSSH,
+			SSHCertificate: c.SSHCertificate != nil,
+			Expired:        c.Expired,
+			Verdict:        c.Verdict,
+			Blame:          t.blamesFor(c.DbId),
+		}
+		if c.OpenSSHNamespace != nil {
+			summary.OpenSSHNamespace = *c.OpenSSHNamespace
+		}
+		results = append(results, summary)
+	}
+	return results, nil
+}
+
+// Change a ceremony, if there is one with that ID
+func (m *memoryStorage) updateCeremony(ceremonyID int64, update func(c *FreeonCeremonies)) {
+	t := m.t()
+	i := slices.IndexFunc(t.ceremonies, func(c FreeonCeremonies) bool { return c.DbId == ceremonyID })
+	if i >= 0 {
+		update(&t.ceremonies[i])
+	}
+}
+
+func (m *memoryStorage) LockCeremony(c FreeonCeremonies) error {
+	defer m.lock()()
+	m.updateCeremony(c.DbId, func(row *FreeonCeremonies) { row.Locked = true })
+	return nil
+}
+
+func (m *memoryStorage) FinalizeSignature(c FreeonCeremonies, sig string) error {
+	if !c.Active {
+		return errors.New("group is already finalized")
+	}
+	defer m.lock()()
+	m.updateCeremony(c.DbId, func(row *FreeonCeremonies) {
+		row.Signature = &sig
+		row.Active = false
+	})
+	return nil
+}
+
+func (m *memoryStorage) DisputeCeremony(c FreeonCeremonies, verdict string) error {
+	defer m.lock()()
+	m.updateCeremony(c.DbId, func(row *FreeonCeremonies) {
+		row.Active = false
+		row.Verdict = &verdict
+	})
+	return nil
+}
+
+func (m *memoryStorage) PublishMessage(ceremonyUid string) error {
+	defer m.lock()()
+	t := m.t()
+	i := t.ceremony(ceremonyUid)
+	if i < 0 {
+		return errors.New("no ceremony found with that UID")
+	}
+	t.ceremonies[i].Published = true
+	return nil
+}
+
+func (m *memoryStorage) SetCeremonyProposer(ceremonyUid, proposer string) error {
+	defer m.lock()()
+	t := m.t()
+	i := t.ceremony(ceremonyUid)
+	if i < 0 {
+		return errors.New("no ceremony found with that UID")
+	}
+	t.ceremonies[i].Proposer = &proposer
+	return nil
+}
+
+func (m *memoryStorage) TerminateCeremony(ceremonyUid string) error {
+	defer m.lock()()
+	t := m.t()
+	i := t.ceremony(ceremonyUid)
+	if i < 0 {
+		return errors.New("no ceremony found with that UID")
+	}
+	t.ceremonies[i].Active = false
+	return nil
+}
+
+func (m *memoryStorage) CloseCeremonies(groupID int64) ([]string, error) {
+	defer m.lock()()
+	t := m.t()
+	var closed []string
+	for i, c := range t.ceremonies {
+		if c.GroupID == groupID && c.Active {
+			t.ceremonies[i].Active = false
+			closed = append(closed, c.Uid)
+		}
+	}
+	return closed, nil
+}
+
+func (m *memoryStorage) SetCeremonyDeadline(ceremonyUid string, deadline time.Time) error {
+	defer m.lock()()
+	t := m.t()
+	i := t.ceremony(ceremonyUid)
+	if i < 0 {
+		return errors.New("ceremony not found")
+	}
+	unix := deadline.Unix()
+	t.ceremonies[i].Deadline = &unix
+	return nil
+}
+
+func (m *memoryStorage) ExpireCeremonies(now time.Time) ([]string, error) {
+	defer m.lock()()
+	t := m.t()
+	var expired []string
+	for i, c := range t.ceremonies {
+		if c.Active && c.Deadline != nil && *c.Deadline <= now.Unix() {
+			t.ceremonies[i].Active = false
+			t.ceremonies[i].Expired = true
+			expired = append(expired, c.Uid)
+		}
+	}
+	return expired, nil
+}
+
+// Players
+
+func (m *memoryStorage) InsertPlayer(p FreeonPlayers) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	id := t.nextID()
+	t.players = append(t.players, FreeonPlayers{DbId: id, CeremonyID: p.CeremonyID, ParticipantID: p.ParticipantID})
+	return id, nil
+}
+
+func (m *memoryStorage) GetCeremonyPlayers(ceremonyUid string) ([]FreeonPlayers, error) {
+	defer m.lock()()
+	t := m.t()
+	ceremonyID := t.ceremonyID(ceremonyUid)
+	var players []FreeonPlayers
+	for _, p := range t.players {
+		if p.CeremonyID == ceremonyID {
+			p.PartyID = t.participant(p.ParticipantID).PartyID
+			players = append(players, p)
+		}
+	}
+	return players, nil
+}
+
+func (m *memoryStorage) DeletePlayer(ceremonyUid string, participantID int64) error {
+	defer m.lock()()
+	t := m.t()
+	ceremonyID := t.ceremonyID(ceremonyUid)
+	before := len(t.players)
+	t.players = slices.DeleteFunc(slices.Clone(t.players), func(p FreeonPlayers) bool {
+		return p.CeremonyID == ceremonyID && p.ParticipantID == participantID
+	})
+	if len(t.players) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Message queues
+
+func (m *memoryStorage) InsertKeygenMessage(msg FreeonKeygenMessage) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	msg.DbId = t.nextID()
+	msg.Message = slices.Clone(msg.Message)
+	t.keygenMsgs = append(t.keygenMsgs, msg)
+	return msg.DbId, nil
+}
+
+func (m *memoryStorage) GetKeygenMessagesSince(groupUid string, lastSeen int64) ([]FreeonKeygenMessage, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	var messages []FreeonKeygenMessage
+	for _, msg := range t.keygenMsgs {
+		if msg.GroupID == groupID && msg.DbId > lastSeen {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (m *memoryStorage) GetKeygenMessagesFrom(groupUid string, partyID uint16) ([]FreeonKeygenMessage, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	var messages []FreeonKeygenMessage
+	for _, msg := range t.keygenMsgs {
+		if msg.GroupID == groupID && t.participant(msg.Sender).PartyID == partyID {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (m *memoryStorage) InsertSignMessage(msg FreeonSignMessage) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	msg.DbId = t.nextID()
+	msg.Message = slices.Clone(msg.Message)
+	t.signMsgs = append(t.signMsgs, msg)
+	return msg.DbId, nil
+}
+
+func (m *memoryStorage) GetSignMessagesSince(ceremonyUid string, lastSeen int64) ([]FreeonSignMessage, error) {
+	defer m.lock()()
+	t := m.t()
+	ceremonyID := t.ceremonyID(ceremonyUid)
+	var messages []FreeonSignMessage
+	for _, msg := range t.signMsgs {
+		if msg.CeremonyID == ceremonyID && msg.DbId > lastSeen {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (m *memoryStorage) InsertRefreshMessage(msg FreeonRefreshMessage) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	msg.DbId = t.nextID()
+	msg.Message = slices.Clone(msg.Message)
+	t.refreshMsgs = append(t.refreshMsgs, msg)
+	return msg.DbId, nil
+}
+
+func (m *memoryStorage) GetRefreshMessagesSince(refreshUid string, lastSeen int64) ([]FreeonRefreshMessage, error) {
+	defer m.lock()()
+	t := m.t()
+	refreshID := t.refreshID(refreshUid)
+	var messages []FreeonRefreshMessage
+	for _, msg := range t.refreshMsgs {
+		if msg.RefreshID == refreshID && msg.DbId > lastSeen {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (m *memoryStorage) InsertReshareMessage(msg FreeonReshareMessage) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	msg.DbId = t.nextID()
+	msg.Message = slices.Clone(msg.Message)
+	t.reshareMsgs = append(t.reshareMsgs, msg)
+	return msg.DbId, nil
+}
+
+func (m *memoryStorage) GetReshareMessagesSince(reshareUid string, lastSeen int64) ([]FreeonReshareMessage, error) {
+	defer m.lock()()
+	t := m.t()
+	reshareID := t.reshareID(reshareUid)
+	var messages []FreeonReshareMessage
+	for _, msg := range t.reshareMsgs {
+		if msg.ReshareID == reshareID && msg.DbId > lastSeen {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (m *memoryStorage) DeleteExpiredMessages(cutoff time.Time) error {
+	defer m.lock()()
+	t := m.t()
+	expired := func(deadline *int64) bool {
+		return deadline != nil && *deadline <= cutoff.Unix()
+	}
+	t.keygenMsgs = slices.DeleteFunc(slices.Clone(t.keygenMsgs), func(msg FreeonKeygenMessage) bool {
+		i := t.groupByID(msg.GroupID)
+		return i >= 0 && t.groups[i].Status == GroupStatusExpired && expired(t.groups[i].Deadline)
+	})
+	t.signMsgs = slices.DeleteFunc(slices.Clone(t.signMsgs), func(msg FreeonSignMessage) bool {
+		i := slices.IndexFunc(t.ceremonies, func(c FreeonCeremonies) bool { return c.DbId == msg.CeremonyID })
+		return i >= 0 && t.ceremonies[i].Expired && expired(t.ceremonies[i].Deadline)
+	})
+	return nil
+}
+
+// Signed requests
+
+func (m *memoryStorage) UseNonce(nonce string, expires time.Time) error {
+	defer m.lock()()
+	t := m.t()
+	if slices.ContainsFunc(t.nonces, func(n memoryNonce) bool { return n.nonce == nonce }) {
+		return ErrReplayed
+	}
+	t.nonces = append(t.nonces, memoryNonce{nonce: nonce, expires: expires.Unix()})
+	return nil
+}
+
+func (m *memoryStorage) DeleteExpiredNonces(now time.Time) error {
+	defer m.lock()()
+	t := m.t()
+	t.nonces = slices.DeleteFunc(slices.Clone(t.nonces), func(n memoryNonce) bool {
+		return n.expires <= now.Unix()
+	})
+	return nil
+}
+
+// Complaints and key confirmations
+
+func (m *memoryStorage) InsertComplaint(c FreeonComplaint) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	c.DbId = t.nextID()
+	t.complaints = append(t.complaints, c)
+	return c.DbId, nil
+}
+
+func (m *memoryStorage) GetComplaintReporters(groupUid string) ([]uint16, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	var reporters []uint16
+	for _, c := range t.complaints {
+		partyID := t.participant(c.Reporter).PartyID
+		if c.GroupID == groupID && !slices.Contains(reporters, partyID) {
+			reporters = append(reporters, partyID)
+		}
+	}
+	slices.Sort(reporters)
+	return reporters, nil
+}
+
+func (m *memoryStorage) InsertKeyConfirmation(c FreeonKeyConfirmation) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	id := t.nextID()
+	t.confirmations = append(t.confirmations, FreeonKeyConfirmation{
+		DbId:        id,
+		GroupID:     c.GroupID,
+		Participant: c.Participant,
+		PublicKey:   c.PublicKey,
+	})
+	return id, nil
+}
+
+func (m *memoryStorage) GetKeyConfirmations(groupUid string) ([]FreeonKeyConfirmation, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	var confirmations []FreeonKeyConfirmation
+	for _, c := range t.confirmations {
+		if c.GroupID == groupID {
+			c.PartyID = t.participant(c.Participant).PartyID
+			confirmations = append(confirmations, c)
+		}
+	}
+	slices.SortStableFunc(confirmations, func(a, b FreeonKeyConfirmation) int { return cmp.Compare(a.PartyID, b.PartyID) })
+	return confirmations, nil
+}
+
+// Blame reports
+
+func (m *memoryStorage) InsertBlame(b FreeonBlameRecord) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	b.DbId = t.nextID()
+	t.blames = append(t.blames, b)
+	return b.DbId, nil
+}
+
+func (m *memoryStorage) GetCeremonyBlames(ceremonyUid string) ([]FreeonBlame, error) {
+	defer m.lock()()
+	t := m.t()
+	return t.blamesFor(t.ceremonyID(ceremonyUid)), nil
+}
+
+func (t *memoryTables) blamesFor(ceremonyID int64) []FreeonBlame {
+	var blames []FreeonBlame
+	for _, b := range t.blames {
+		if b.CeremonyID == ceremonyID {
+			blames = append(blames, FreeonBlame{
+				Reporter: t.participant(b.Reporter).PartyID,
+				Accused:  t.participant(b.Accused).PartyID,
+				Reason:   b.Reason,
+			})
+		}
+	}
+	return blames
+}
+
+// Refreshes
+
+func (m *memoryStorage) InsertRefresh(r FreeonRefresh) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	id := t.nextID()
+	t.refreshes = append(t.refreshes, FreeonRefresh{
+		DbId:    id,
+		GroupID: r.GroupID,
+		Uid:     r.Uid,
+		Epoch:   r.Epoch,
+		Status:  GroupStatusOpen,
+	})
+	return id, nil
+}
+
+func (m *memoryStorage) GetOpenRefresh(groupUid string) (FreeonRefresh, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	for i := len(t.refreshes) - 1; i >= 0; i-- {
+		if r := t.refreshes[i]; r.GroupID == groupID && r.Status == GroupStatusOpen {
+			return r, nil
+		}
+	}
+	return FreeonRefresh{}, ErrNotFound
+}
+
+func (m *memoryStorage) GetRefreshData(refreshUid string) (FreeonRefresh, error) {
+	defer m.lock()()
+	t := m.t()
+	i := slices.IndexFunc(t.refreshes, func(r FreeonRefresh) bool { return r.Uid == refreshUid })
+	if i < 0 {
+		return FreeonRefresh{}, ErrNotFound
+	}
+	return t.refreshes[i], nil
+}
+
+func (m *memoryStorage) InsertRefresher(x FreeonRefresher) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	id := t.nextID()
+	t.refreshers = append(t.refreshers, FreeonRefresher{DbId: id, RefreshID: x.RefreshID, ParticipantID: x.ParticipantID})
+	return id, nil
+}
+
+func (m *memoryStorage) GetRefreshers(refreshUid string) ([]FreeonRefresher, error) {
+	defer m.lock()()
+	t := m.t()
+	refreshID := t.refreshID(refreshUid)
+	var refreshers []FreeonRefresher
+	for _, x := range t.refreshers {
+		if x.RefreshID == refreshID {
+			x.PartyID = t.participant(x.ParticipantID).PartyID
+			refreshers = append(refreshers, x)
+		}
+	}
+	slices.SortStableFunc(refreshers, func(a, b FreeonRefresher) int { return cmp.Compare(a.PartyID, b.PartyID) })
+	return refreshers, nil
+}
+
+func (m *memoryStorage) SetRefresherDigest(x FreeonRefresher, digest string) error {
+	defer m.lock()()
+	t := m.t()
+	if i := slices.IndexFunc(t.refreshers, func(r FreeonRefresher) bool { return r.DbId == x.DbId }); i >= 0 {
+		t.refreshers[i].Digest = &digest
+	}
+	return nil
+}
+
+// Change a refresh, if there is one with that ID
+func (m *memoryStorage) updateRefresh(refreshID int64, update func(r *FreeonRefresh)) {
+	t := m.t()
+	if i := slices.IndexFunc(t.refreshes, func(r FreeonRefresh) bool { return r.DbId == refreshID }); i >= 0 {
+		update(&t.refreshes[i])
+	}
+}
+
+func (m *memoryStorage) DeleteRefresher(x FreeonRefresher) error {
+	defer m.lock()()
+	t := m.t()
+	before := len(t.refreshers)
+	t.refreshers = slices.DeleteFunc(slices.Clone(t.refreshers), func(r FreeonRefresher) bool { return r.DbId == x.DbId })
+	if len(t.refreshers) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *memoryStorage) AbortRefresh(r FreeonRefresh, verdict string) error {
+	defer m.lock()()
+	m.updateRefresh(r.DbId, func(row *FreeonRefresh) {
+		row.Status = GroupStatusAborted
+		row.Verdict = &verdict
+	})
+	return nil
+}
+
+func (m *memoryStorage) CompleteRefresh(r FreeonRefresh) error {
+	defer m.lock()()
+	m.updateRefresh(r.DbId, func(row *FreeonRefresh) { row.Status = GroupStatusComplete })
+	m.updateGroup(r.GroupID, func(g *FreeonGroup) { g.Epoch = r.Epoch })
+	return nil
+}
+
+// Reshares
+
+func (m *memoryStorage) InsertReshare(r FreeonReshare) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	id := t.nextID()
+	t.reshares = append(t.reshares, FreeonReshare{
+		DbId:         id,
+		GroupID:      r.GroupID,
+		Uid:          r.Uid,
+		Epoch:        r.Epoch,
+		Participants: r.Participants,
+		Threshold:    r.Threshold,
+		Status:       GroupStatusOpen,
+	})
+	return id, nil
+}
+
+func (m *memoryStorage) GetOpenReshare(groupUid string) (FreeonReshare, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	for i := len(t.reshares) - 1; i >= 0; i-- {
+		if r := t.reshares[i]; r.GroupID == groupID && r.Status == GroupStatusOpen {
+			return r, nil
+		}
+	}
+	return FreeonReshare{}, ErrNotFound
+}
+
+func (m *memoryStorage) GetReshareData(reshareUid string) (FreeonReshare, error) {
+	defer m.lock()()
+	t := m.t()
+	i := slices.IndexFunc(t.reshares, func(r FreeonReshare) bool { return r.Uid == reshareUid })
+	if i < 0 {
+		return FreeonReshare{}, ErrNotFound
+	}
+	return t.reshares[i], nil
+}
+
+func (m *memoryStorage) InsertResharer(x FreeonResharer) (int64, error) {
+	defer m.lock()()
+	t := m.t()
+	id := t.nextID()
+	t.resharers = append(t.resharers, FreeonResharer{
+		DbId:          id,
+		ReshareID:     x.ReshareID,
+		ParticipantID: x.ParticipantID,
+		Dealer:        x.Dealer,
+		Recipient:     x.Recipient,
+	})
+	return id, nil
+}
+
+func (m *memoryStorage) GetResharers(reshareUid string) ([]FreeonResharer, error) {
+	defer m.lock()()
+	t := m.t()
+	reshareID := t.reshareID(reshareUid)
+	var resharers []FreeonResharer
+	for _, x := range t.resharers {
+		if x.ReshareID == reshareID {
+			p := t.participant(x.ParticipantID)
+			x.PartyID = p.PartyID
+			x.PublicKey = p.PublicKey
+			resharers = append(resharers, x)
+		}
+	}
+	slices.SortStableFunc(resharers, func(a, b FreeonResharer) int { return cmp.Compare(a.PartyID, b.PartyID) })
+	return resharers, nil
+}
+
+func (m *memoryStorage) InsertReshareInvite(reshareID int64, publicKey string) error {
+	defer m.lock()()
+	t := m.t()
+	t.invites = append(t.invites, memoryInvite{reshareID: reshareID, publicKey: publicKey})
+	return nil
+}
+
+func (m *memoryStorage) GetReshareInvites(reshareUid string) ([]string, error) {
+	defer m.lock()()
+	t := m.t()
+	reshareID := t.reshareID(reshareUid)
+	var invites []string
+	for _, i := range t.invites {
+		if i.reshareID == reshareID {
+			invites = append(invites, i.publicKey)
+		}
+	}
+	return invites, nil
+}
+
+// Change a reshare, if there is one with that ID
+func (m *memoryStorage) updateReshare(reshareID int64, update func(r *FreeonReshare)) {
+	t := m.t()
+	if i := slices.IndexFunc(t.reshares, func(r FreeonReshare) bool { return r.DbId == reshareID }); i >= 0 {
+		update(&t.reshares[i])
+	}
+}
+
+func (m *memoryStorage) LockReshare(r FreeonReshare) error {
+	defer m.lock()()
+	m.updateReshare(r.DbId, func(row *FreeonReshare) { row.Locked = true })
+	return nil
+}
+
+func (m *memoryStorage) SetResharerDigest(x FreeonResharer, digest string) error {
+	defer m.lock()()
+	t := m.t()
+	if i := slices.IndexFunc(t.resharers, func(r FreeonResharer) bool { return r.DbId == x.DbId }); i >= 0 {
+		t.resharers[i].Digest = &digest
+	}
+	return nil
+}
+
+func (m *memoryStorage) DeleteResharer(x FreeonResharer) error {
+	defer m.lock()()
+	t := m.t()
+	before := len(t.resharers)
+	t.resharers = slices.DeleteFunc(slices.Clone(t.resharers), func(r FreeonResharer) bool { return r.DbId == x.DbId })
+	if len(t.resharers) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *memoryStorage) AbortReshare(r FreeonReshare, verdict string) error {
+	defer m.lock()()
+	m.updateReshare(r.DbId, func(row *FreeonReshare) {
+		row.Status = GroupStatusAborted
+		row.Verdict = &verdict
+	})
+	return nil
+}
+
+func (m *memoryStorage) CompleteReshare(r FreeonReshare) error {
+	defer m.lock()()
+	t := m.t()
+	m.updateReshare(r.DbId, func(row *FreeonReshare) { row.Status = GroupStatusComplete })
+	m.updateGroup(r.GroupID, func(g *FreeonGroup) {
+		g.Participants = r.Participants
+		g.Threshold = r.Threshold
+		g.Epoch = r.Epoch
+	})
+	for i, p := range t.participants {
+		if p.GroupID != r.GroupID {
+			continue
+		}
+		t.participants[i].active = slices.ContainsFunc(t.resharers, func(x FreeonResharer) bool {
+			return x.ReshareID == r.DbId && x.ParticipantID == p.DbId && x.Recipient
+		})
+	}
+	return nil
+}
+
+// Roles
+
+func (m *memoryStorage) InsertMemberRole(groupID int64, partyID uint16, role string) error {
+	defer m.lock()()
+	t := m.t()
+	if slices.ContainsFunc(t.memberRoles, func(r memoryMemberRole) bool {
+		return r.groupID == groupID && r.PartyID == partyID && r.Role == role
+	}) {
+		return nil
+	}
+	t.memberRoles = append(t.memberRoles, memoryMemberRole{
+		id:               t.nextID(),
+		groupID:          groupID,
+		FreeonMemberRole: FreeonMemberRole{PartyID: partyID, Role: role},
+	})
+	return nil
+}
+
+func (m *memoryStorage) DeleteMemberRole(groupUid string, partyID uint16, role string) error {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	before := len(t.memberRoles)
+	t.memberRoles = slices.DeleteFunc(slices.Clone(t.memberRoles), func(r memoryMemberRole) bool {
+		return r.groupID == groupID && r.PartyID == partyID && r.Role == role
+	})
+	if len(t.memberRoles) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *memoryStorage) GetMemberRoles(groupUid string) ([]FreeonMemberRole, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	var rows []memoryMemberRole
+	for _, r := range t.memberRoles {
+		if r.groupID == groupID {
+			rows = append(rows, r)
+		}
+	}
+	slices.SortStableFunc(rows, func(a, b memoryMemberRole) int { return cmp.Compare(a.PartyID, b.PartyID) })
+	members := []FreeonMemberRole{}
+	for _, r := range rows {
+		members = append(members, r.FreeonMemberRole)
+	}
+	return members, nil
+}
+
+func (m *memoryStorage) InsertApiToken(groupID int64, token FreeonApiToken, tokenHash string) error {
+	defer m.lock()()
+	t := m.t()
+	for _, existing := range t.apiTokens {
+		if existing.groupID == groupID && existing.Label == token.Label {
+			return errors.New("an API token with that label already exists")
+		}
+		if existing.tokenHash == tokenHash {
+			return errors.New("an API token with that hash already exists")
+		}
+	}
+	t.apiTokens = append(t.apiTokens, memoryApiToken{groupID: groupID, tokenHash: tokenHash, FreeonApiToken: token})
+	return nil
+}
+
+func (m *memoryStorage) DeleteApiToken(groupUid, label string) error {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	before := len(t.apiTokens)
+	t.apiTokens = slices.DeleteFunc(slices.Clone(t.apiTokens), func(token memoryApiToken) bool {
+		return token.groupID == groupID && token.Label == label
+	})
+	if len(t.apiTokens) == before {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *memoryStorage) GetApiTokens(groupUid string) ([]FreeonApiToken, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	tokens := []FreeonApiToken{}
+	for _, token := range t.apiTokens {
+		if token.groupID == groupID {
+			tokens = append(tokens, token.FreeonApiToken)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *memoryStorage) GetApiToken(groupUid, tokenHash string) (FreeonApiToken, error) {
+	defer m.lock()()
+	t := m.t()
+	groupID := t.groupID(groupUid)
+	for _, token := range t.apiTokens {
+		if token.groupID == groupID && token.tokenHash == tokenHash {
+			return token.FreeonApiToken, nil
+		}
+	}
+	return FreeonApiToken{}, ErrNotFound
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bytemare/frost"
+)
+
+// The coordinator relays protocol messages without having to understand them, but it does check who each one says
+// it's from. Clients take a message's word for who sent it, so without this any member could speak for any other.
+
+// Make sure a keygen, refresh, or reshare message is from the party that sent it
+func checkEnvelopeSender(message []byte, myPartyID uint16) error {
+	var e keygenEnvelope
+	if err := json.Unmarshal(message, &e); err != nil || e.Type == "" {
+		return errors.New("not a protocol message")
+	}
+	if e.Sender != myPartyID {
+		return fmt.Errorf("%w: party %d sent a message from party %d", ErrUnauthorized, myPartyID, e.Sender)
+	}
+	return nil
+}
+
+// Who a signing message (a FROST commitment or signature share) is from
+func signMessageSender(message []byte) (uint16, error) {
+	commitment := &frost.Commitment{}
+	if err := commitment.Decode(message); err == nil {
+		return commitment.SignerID, nil
+	}
+	share := &frost.SignatureShare{}
+	if err := share.Decode(message); err == nil {
+		return share.SignerIdentifier, nil
+	}
+	return 0, errors.New("not a commitment or signature share")
+}
+
+// Make sure a signing message is from the party that sent it
+func checkSignMessageSender(message []byte, myPartyID uint16) error {
+	sender, err := signMessageSender(message)
+	if err != nil {
+		return err
+	}
+	if sender != myPartyID {
+		return fmt.Errorf("%w: party %d sent a message from party %d", ErrUnauthorized, myPartyID, sender)
+	}
+	return nil
+}
+
+// The participants (by database ID) that sent a signature share, and not just a commitment
+func signatureShareSenders(messages []FreeonSignMessage) map[int64]bool {
+	senders := make(map[int64]bool)
+	for _, m := range messages {
+		share := &frost.SignatureShare{}
+		if err := share.Decode(m.Message); err == nil {
+			senders[m.Sender] = true
+		}
+	}
+	return senders
+}
@@ -0,0 +1,76 @@
+package internal_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bytemare/ecc"
+	"github.com/bytemare/frost"
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// A keygen, refresh, or reshare message, as far as the coordinator cares
+func testEnvelope(sender uint16) []byte {
+	return fmt.Appendf(nil, `{"type":"dkg-r1","sender":%d,"payload":"00"}`, sender)
+}
+
+func testCommitment(signer uint16) []byte {
+	g := ecc.Edwards25519Sha512
+	c := &frost.Commitment{
+		Group:                  g,
+		CommitmentID:           1,
+		SignerID:               signer,
+		HidingNonceCommitment:  g.Base(),
+		BindingNonceCommitment: g.Base(),
+	}
+	return c.Encode()
+}
+
+func testSignatureShare(signer uint16) []byte {
+	g := ecc.Edwards25519Sha512
+	s := &frost.SignatureShare{
+		Group:            g,
+		SignerIdentifier: signer,
+		SignatureShare:   g.NewScalar().One(),
+	}
+	return s.Encode()
+}
+
+func TestMessageSenders(t *testing.T) {
+	db := setupTestDBForSign(t)
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
+	assert.NoError(t, err)
+	p1, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	p2, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	p3, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+
+	// Nobody gets to speak for anyone else
+	_, err = internal.AddKeyGenMessage(db, g_uid, p1.PartyID, testEnvelope(p1.PartyID))
+	assert.NoError(t, err)
+	_, err = internal.AddKeyGenMessage(db, g_uid, p1.PartyID, testEnvelope(p2.PartyID))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	_, err = internal.AddKeyGenMessage(db, g_uid, p1.PartyID, []byte("not an envelope"))
+	assert.Error(t, err)
+
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+	joinTestSigners(t, db, g_uid, c_uid, p1.PartyID, p2.PartyID)
+	_, err = internal.AddSignMessage(db, c_uid, p1.PartyID, testCommitment(p1.PartyID))
+	assert.NoError(t, err)
+	_, err = internal.AddSignMessage(db, c_uid, p1.PartyID, testSignatureShare(p1.PartyID))
+	assert.NoError(t, err)
+	_, err = internal.AddSignMessage(db, c_uid, p1.PartyID, testCommitment(p2.PartyID))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	_, err = internal.AddSignMessage(db, c_uid, p1.PartyID, testSignatureShare(p2.PartyID))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	_, err = internal.AddSignMessage(db, c_uid, p1.PartyID, []byte("test message"))
+	assert.Error(t, err)
+
+	// Party 3 is in the group, but not one of the signers
+	_, err = internal.AddSignMessage(db, c_uid, p3.PartyID, testCommitment(p3.PartyID))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+}
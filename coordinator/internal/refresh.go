@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Join the refresh that is in progress for a group, or start one if there isn't any.
+//
+// Every current holder has to take part, so a refresh stays open until they all join. The epoch is the one the
+// holder's share is from; there's no point refreshing a share that is already stale.
+func JoinRefresh(db Storage, groupUid string, myPartyID uint16, epoch uint64) (FreeonRefresh, error) {
+	group, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return FreeonRefresh{}, err
+	}
+	if group.Status != GroupStatusComplete {
+		return FreeonRefresh{}, errors.New("key generation is not complete")
+	}
+	if epoch != group.Epoch {
+		return FreeonRefresh{}, fmt.Errorf("share is from epoch %d, but the group is at epoch %d", epoch, group.Epoch)
+	}
+	participant, err := db.GetParticipantID(groupUid, myPartyID)
+	if err != nil {
+		return FreeonRefresh{}, err
+	}
+
+	var refresh FreeonRefresh
+	err = db.Atomically(func(tx Storage) error {
+		var err error
+		refresh, err = tx.GetOpenRefresh(groupUid)
+		if errors.Is(err, ErrNotFound) {
+			if err := refuseConcurrentChanges(tx, groupUid); err != nil {
+				return err
+			}
+			uid, err := UniqueID()
+			if err != nil {
+				return err
+			}
+			refresh = FreeonRefresh{
+				GroupID: group.DbId,
+				Uid:     "r_" + uid,
+				Epoch:   group.Epoch + 1,
+				Status:  GroupStatusOpen,
+			}
+			refresh.DbId, err = tx.InsertRefresh(refresh)
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		refreshers, err := tx.GetRefreshers(refresh.Uid)
+		if err != nil {
+			return err
+		}
+		for _, x := range refreshers {
+			if x.PartyID == myPartyID {
+				return errors.New("already joined this refresh; abort it to start over")
+			}
+		}
+		_, err = tx.InsertRefresher(FreeonRefresher{
+			RefreshID:     refresh.DbId,
+			ParticipantID: participant,
+		})
+		return err
+	})
+	if err != nil {
+		return FreeonRefresh{}, err
+	}
+	return refresh, nil
+}
+
+func PollRefresh(db Storage, refreshUid string) (PollRefreshResponse, error) {
+	refresh, err := db.GetRefreshData(refreshUid)
+	if err != nil {
+		return PollRefreshResponse{}, err
+	}
+	group, err := db.GetGroupByID(refresh.GroupID)
+	if err != nil {
+		return PollRefreshResponse{}, err
+	}
+	refreshers, err := db.GetRefreshers(refreshUid)
+	if err != nil {
+		return PollRefreshResponse{}, err
+	}
+
+	var parties []uint16
+	var confirmed uint16
+	for _, x := range refreshers {
+		parties = append(parties, x.PartyID)
+		if x.Digest != nil {
+			confirmed++
+		}
+	}
+	return PollRefreshResponse{
+		RefreshID: refresh.Uid,
+		GroupID:   group.Uid,
+		Epoch:     refresh.Epoch,
+		Threshold: group.Threshold,
+		PartySize: group.Participants,
+		Parties:   parties,
+		Confirmed: confirmed,
+		Status:    refresh.Status,
+		Verdict:   refresh.Verdict,
+	}, nil
+}
+
+// Add a refresh message to the queue
+func AddRefreshMessage(db Storage, refreshUid string, myPartyID uint16, message []byte) (FreeonRefreshMessage, error) {
+	refresh, err := db.GetRefreshData(refreshUid)
+	if err != nil {
+		return FreeonRefreshMessage{}, err
+	}
+	if refresh.Status != GroupStatusOpen {
+		return FreeonRefreshMessage{}, errors.New("refresh is no longer in progress")
+	}
+	if err := checkEnvelopeSender(message, myPartyID); err != nil {
+		return FreeonRefreshMessage{}, err
+	}
+	refresher, err := getRefresher(db, refreshUid, myPartyID)
+	if err != nil {
+		return FreeonRefreshMessage{}, err
+	}
+	msg := FreeonRefreshMessage{
+		RefreshID: refresh.DbId,
+		Sender:    refresher.ParticipantID,
+		Message:   message,
+	}
+	id, err := db.InsertRefreshMessage(msg)
+	if err != nil {
+		return FreeonRefreshMessage{}, err
+	}
+	msg.DbId = id
+	return msg, nil
+}
+
+// Record the public shares a holder ended up with, as a digest.
+//
+// Once every holder has confirmed, the digests are compared. If they all match, the group moves to the new epoch.
+// Otherwise somebody was fed different messages than everyone else, and the refresh is aborted.
+func ConfirmRefresh(db Storage, refreshUid string, myPartyID uint16, digest string) error {
+	refresh, err := db.GetRefreshData(refreshUid)
+	if err != nil {
+		return err
+	}
+	if refresh.Status != GroupStatusOpen {
+		return errors.New("refresh is no longer in progress")
+	}
+	if digest == "" {
+		return errors.New("confirmation has no digest")
+	}
+	refresher, err := getRefresher(db, refreshUid, myPartyID)
+	if err != nil {
+		return err
+	}
+	if refresher.Digest != nil {
+		return errors.New("already confirmed this refresh")
+	}
+	if err := db.SetRefresherDigest(refresher, digest); err != nil {
+		return err
+	}
+
+	group, err := db.GetGroupByID(refresh.GroupID)
+	if err != nil {
+		return err
+	}
+	refreshers, err := db.GetRefreshers(refreshUid)
+	if err != nil {
+		return err
+	}
+	if len(refreshers) < int(group.Participants) {
+		return nil
+	}
+	for _, x := range refreshers {
+		if x.Digest == nil {
+			return nil
+		}
+	}
+	for _, x := range refreshers {
+		if *x.Digest != digest {
+			return db.AbortRefresh(refresh, fmt.Sprintf("party %d and party %d disagree about the new public shares", x.PartyID, myPartyID))
+		}
+	}
+	return db.CompleteRefresh(refresh)
+}
+
+// Give up our seat in the refresh in progress for a group, so it doesn't wait on a party that's gone. Once every holder
+// has joined, it's too late, and the refresh has to be aborted instead. A refresh everyone has left is aborted, so it
+// doesn't stand in the way of a reshare. Returns the refresh we left.
+func LeaveRefresh(db Storage, groupUid string, myPartyID uint16) (FreeonRefresh, error) {
+	var refresh FreeonRefresh
+	err := db.Atomically(func(tx Storage) error {
+		var err error
+		refresh, err = tx.GetOpenRefresh(groupUid)
+		if errors.Is(err, ErrNotFound) {
+			return errors.New("no refresh in progress for this group")
+		} else if err != nil {
+			return err
+		}
+		group, err := tx.GetGroupData(groupUid)
+		if err != nil {
+			return err
+		}
+		refreshers, err := tx.GetRefreshers(refresh.Uid)
+		if err != nil {
+			return err
+		}
+		if len(refreshers) >= int(group.Participants) {
+			return errors.New("every holder has joined this refresh; abort it instead")
+		}
+		refresher, err := getRefresher(tx, refresh.Uid, myPartyID)
+		if err != nil {
+			return err
+		}
+		if len(refreshers) == 1 {
+			return tx.AbortRefresh(refresh, fmt.Sprintf("party %d left, and nobody else had joined", myPartyID))
+		}
+		return tx.DeleteRefresher(refresher)
+	})
+	if err != nil {
+		return FreeonRefresh{}, err
+	}
+	return refresh, nil
+}
+
+// Give up on the refresh in progress for a group. The group stays at its current epoch.
+// Returns the refresh that was aborted.
+func CancelRefresh(db Storage, groupUid string, myPartyID uint16, reason string) (FreeonRefresh, error) {
+	refresh, err := db.GetOpenRefresh(groupUid)
+	if errors.Is(err, ErrNotFound) {
+		return FreeonRefresh{}, errors.New("no refresh in progress for this group")
+	} else if err != nil {
+		return FreeonRefresh{}, err
+	}
+	if reason == "" {
+		reason = "no reason given"
+	}
+	verdict := fmt.Sprintf("party %d aborted the refresh: %s", myPartyID, reason)
+	if err := db.AbortRefresh(refresh, verdict); err != nil {
+		return FreeonRefresh{}, err
+	}
+	return refresh, nil
+}
+
+func getRefresher(db Storage, refreshUid string, myPartyID uint16) (FreeonRefresher, error) {
+	refreshers, err := db.GetRefreshers(refreshUid)
+	if err != nil {
+		return FreeonRefresher{}, err
+	}
+	for _, x := range refreshers {
+		if x.PartyID == myPartyID {
+			return x, nil
+		}
+	}
+	return FreeonRefresher{}, fmt.Errorf("party %d has not joined this refresh", myPartyID)
+}
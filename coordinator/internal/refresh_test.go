@@ -0,0 +1,168 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// A finished 2-of-3 key group
+func setupRefreshGroup(t *testing.T) (internal.Storage, string) {
+	db := setupTestDBForKeygen(t)
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+		assert.NoError(t, err)
+	}
+	err = internal.SetGroupPublicKey(db, g_uid, "test_pk")
+	assert.NoError(t, err)
+	return db, g_uid
+}
+
+func TestRefresh(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+
+	// Everyone joins the same refresh
+	refresh, err := internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), refresh.Epoch)
+	for p := uint16(2); p <= 3; p++ {
+		r, err := internal.JoinRefresh(db, g_uid, p, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, refresh.Uid, r.Uid)
+	}
+	_, err = internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.Error(t, err)
+
+	_, err = internal.AddRefreshMessage(db, refresh.Uid, 2, testEnvelope(2))
+	assert.NoError(t, err)
+	messages, err := db.GetRefreshMessagesSince(refresh.Uid, 0)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	// Nothing changes until the last holder confirms
+	for p := uint16(1); p <= 3; p++ {
+		group, err := db.GetGroupData(g_uid)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), group.Epoch)
+		err = internal.ConfirmRefresh(db, refresh.Uid, p, "digest")
+		assert.NoError(t, err)
+	}
+	state, err := internal.PollRefresh(db, refresh.Uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusComplete, state.Status)
+	assert.Equal(t, []uint16{1, 2, 3}, state.Parties)
+	assert.Equal(t, uint16(3), state.Confirmed)
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), group.Epoch)
+	assert.Equal(t, "test_pk", *group.PublicKey)
+
+	// Old shares can no longer sign, or be refreshed again
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), 1, 0)
+	assert.Error(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), 1, 1)
+	assert.NoError(t, err)
+	_, err = internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.Error(t, err)
+}
+
+func TestRefreshDisagreement(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+	old, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+
+	var refreshUid string
+	for p := uint16(1); p <= 3; p++ {
+		r, err := internal.JoinRefresh(db, g_uid, p, 0)
+		assert.NoError(t, err)
+		refreshUid = r.Uid
+	}
+	assert.NoError(t, internal.ConfirmRefresh(db, refreshUid, 1, "digest"))
+	assert.NoError(t, internal.ConfirmRefresh(db, refreshUid, 2, "digest"))
+	assert.NoError(t, internal.ConfirmRefresh(db, refreshUid, 3, "something else"))
+
+	state, err := internal.PollRefresh(db, refreshUid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusAborted, state.Status)
+	assert.Contains(t, *state.Verdict, "disagree")
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), group.Epoch)
+
+	// The old shares are still good, and a new refresh can start
+	_, err = internal.JoinSignCeremony(db, old, testHash(g_uid), 1, 0)
+	assert.NoError(t, err)
+	r, err := internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, refreshUid, r.Uid)
+}
+
+func TestCancelRefresh(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+	_, err := internal.CancelRefresh(db, g_uid, 1, "")
+	assert.Error(t, err)
+
+	r, err := internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.NoError(t, err)
+	_, err = internal.CancelRefresh(db, g_uid, 2, "party 3 is on vacation")
+	assert.NoError(t, err)
+
+	state, err := internal.PollRefresh(db, r.Uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusAborted, state.Status)
+	assert.Equal(t, "party 2 aborted the refresh: party 3 is on vacation", *state.Verdict)
+	_, err = internal.AddRefreshMessage(db, r.Uid, 1, testEnvelope(1))
+	assert.Error(t, err)
+}
+
+func TestLeaveRefresh(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+	_, err := internal.LeaveRefresh(db, g_uid, 1)
+	assert.Error(t, err)
+
+	r, err := internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.NoError(t, err)
+	_, err = internal.JoinRefresh(db, g_uid, 2, 0)
+	assert.NoError(t, err)
+
+	// Party 2 leaves and comes back; the refresh carries on waiting for party 3
+	_, err = internal.LeaveRefresh(db, g_uid, 2)
+	assert.NoError(t, err)
+	_, err = internal.LeaveRefresh(db, g_uid, 2)
+	assert.Error(t, err)
+	state, err := internal.PollRefresh(db, r.Uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusOpen, state.Status)
+	assert.Equal(t, []uint16{1}, state.Parties)
+	_, err = internal.JoinRefresh(db, g_uid, 2, 0)
+	assert.NoError(t, err)
+
+	// Once every holder has joined, it's too late
+	_, err = internal.JoinRefresh(db, g_uid, 3, 0)
+	assert.NoError(t, err)
+	_, err = internal.LeaveRefresh(db, g_uid, 3)
+	assert.Error(t, err)
+	state, err = internal.PollRefresh(db, r.Uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 3}, state.Parties)
+}
+
+func TestLeaveRefreshLastOneOut(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+	r, err := internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.NoError(t, err)
+	_, err = internal.LeaveRefresh(db, g_uid, 1)
+	assert.NoError(t, err)
+
+	// An empty refresh doesn't hang around to block a reshare
+	state, err := internal.PollRefresh(db, r.Uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusAborted, state.Status)
+	_, err = internal.NewReshare(db, g_uid, 1, 3, 2, nil)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,438 @@
+package internal
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Propose handing a group's key to a new set of participants, with a new party size and threshold.
+//
+// Only a current holder can propose a reshare. The public key stays the same, but the group moves to a new epoch, so
+// every share from before the reshare stops working once it's done. Newcomers are named up front by their identity
+// keys; nobody else can join to receive a share.
+func NewReshare(db Storage, groupUid string, myPartyID uint16, partySize, threshold uint16, newcomers []string) (string, error) {
+	if threshold < 1 || threshold > partySize {
+		return "", errors.New("threshold must be between 1 and the party size")
+	}
+	if len(newcomers) > int(partySize) {
+		return "", errors.New("more newcomers than the party size")
+	}
+	var invites []string
+	for _, n := range newcomers {
+		publicKey, err := ParsePublicKey(n)
+		if err != nil {
+			return "", err
+		}
+		key := hex.EncodeToString(publicKey)
+		if slices.Contains(invites, key) {
+			return "", fmt.Errorf("newcomer %s is listed twice", key)
+		}
+		invites = append(invites, key)
+	}
+	group, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return "", err
+	}
+	if group.Status != GroupStatusComplete {
+		return "", errors.New("key generation is not complete")
+	}
+	if _, err := db.GetParticipantID(groupUid, myPartyID); err != nil {
+		return "", err
+	}
+	if err := refuseConcurrentChanges(db, groupUid); err != nil {
+		return "", err
+	}
+	participants, err := db.GetGroupParticipants(groupUid)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range participants {
+		if slices.Contains(invites, p.PublicKey) {
+			return "", fmt.Errorf("newcomer %s is already party %d", p.PublicKey, p.PartyID)
+		}
+	}
+
+	uid, err := UniqueID()
+	if err != nil {
+		return "", err
+	}
+	uid = "s_" + uid
+	err = db.Atomically(func(tx Storage) error {
+		id, err := tx.InsertReshare(FreeonReshare{
+			GroupID:      group.DbId,
+			Uid:          uid,
+			Epoch:        group.Epoch + 1,
+			Participants: partySize,
+			Threshold:    threshold,
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range invites {
+			if err := tx.InsertReshareInvite(id, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return uid, nil
+}
+
+// Join the reshare in progress for a group.
+//
+// Current holders join with their party ID, and always deal; they only receive a new share if they're staying on.
+// Newcomers join with a party ID of zero and an identity key the proposer named, and are given a fresh party ID that
+// never clashes with one that was used before. They don't count as group members until the reshare is complete.
+//
+// Once every recipient and enough dealers have joined, the reshare is locked, so everyone agrees on who's involved.
+// Returns the reshare and our party ID.
+func JoinReshare(db Storage, groupUid string, myPartyID uint16, publicKey string, epoch uint64, receive bool) (FreeonReshare, uint16, error) {
+	group, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return FreeonReshare{}, 0, err
+	}
+
+	var reshare FreeonReshare
+	var partyID uint16
+	err = db.Atomically(func(tx Storage) error {
+		// Newcomers get their party ID in here, so start from scratch if this runs again
+		partyID = myPartyID
+		var err error
+		reshare, err = tx.GetOpenReshare(groupUid)
+		if errors.Is(err, ErrNotFound) {
+			return errors.New("no reshare in progress for this group")
+		} else if err != nil {
+			return err
+		}
+		if reshare.Locked {
+			return errors.New("reshare already has everyone it needs")
+		}
+		resharers, err := tx.GetResharers(reshare.Uid)
+		if err != nil {
+			return err
+		}
+		var dealers, recipients int
+		for _, x := range resharers {
+			if x.Dealer {
+				dealers++
+			}
+			if x.Recipient {
+				recipients++
+			}
+		}
+		if receive && recipients >= int(reshare.Participants) {
+			return errors.New("reshare already has all of its recipients; current holders can still join to deal")
+		}
+
+		resharer := FreeonResharer{ReshareID: reshare.DbId, Recipient: receive}
+		if partyID == 0 {
+			// Somebody new, who has to be expected
+			key, err := ParsePublicKey(publicKey)
+			if err != nil {
+				return err
+			}
+			if !receive {
+				return errors.New("new participants have no share to deal")
+			}
+			publicKey = hex.EncodeToString(key)
+			invites, err := tx.GetReshareInvites(reshare.Uid)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(invites, publicKey) {
+				return fmt.Errorf("%w: the reshare wasn't proposed for this identity key", ErrUnauthorized)
+			}
+			for _, x := range resharers {
+				if x.PublicKey == publicKey {
+					return errors.New("already joined this reshare; abort it to start over")
+				}
+			}
+			max, err := tx.GetMaxPartyID(groupUid)
+			if err != nil {
+				return err
+			}
+			if max == 0xFFFF {
+				return errors.New("cannot add participant: party ID would overflow")
+			}
+			uid, err := UniqueID()
+			if err != nil {
+				return err
+			}
+			partyID = max + 1
+			resharer.ParticipantID, err = tx.InsertParticipant(FreeonParticipant{
+				GroupID:   group.DbId,
+				Uid:       "p_" + uid,
+				PartyID:   partyID,
+				PublicKey: publicKey,
+				Pending:   true,
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			// A current holder
+			if epoch != group.Epoch {
+				return fmt.Errorf("share is from epoch %d, but the group is at epoch %d", epoch, group.Epoch)
+			}
+			for _, x := range resharers {
+				if x.PartyID == partyID {
+					return errors.New("already joined this reshare; abort it to start over")
+				}
+			}
+			participants, err := tx.GetGroupParticipants(groupUid)
+			if err != nil {
+				return err
+			}
+			for _, p := range participants {
+				if p.PartyID == partyID {
+					resharer.ParticipantID = p.DbId
+				}
+			}
+			if resharer.ParticipantID == 0 {
+				return fmt.Errorf("party %d is not a member of this group", partyID)
+			}
+			resharer.Dealer = true
+			dealers++
+		}
+		if receive {
+			recipients++
+		}
+		if _, err := tx.InsertResharer(resharer); err != nil {
+			return err
+		}
+
+		if recipients == int(reshare.Participants) && dealers >= int(group.Threshold) {
+			if err := tx.LockReshare(reshare); err != nil {
+				return err
+			}
+			reshare.Locked = true
+		}
+		return nil
+	})
+	if err != nil {
+		return FreeonReshare{}, 0, err
+	}
+	return reshare, partyID, nil
+}
+
+func PollReshare(db Storage, reshareUid string) (PollReshareResponse, error) {
+	reshare, err := db.GetReshareData(reshareUid)
+	if err != nil {
+		return PollReshareResponse{}, err
+	}
+	group, err := db.GetGroupByID(reshare.GroupID)
+	if err != nil {
+		return PollReshareResponse{}, err
+	}
+	resharers, err := db.GetResharers(reshareUid)
+	if err != nil {
+		return PollReshareResponse{}, err
+	}
+
+	newcomers, err := db.GetReshareInvites(reshareUid)
+	if err != nil {
+		return PollReshareResponse{}, err
+	}
+
+	var dealers, recipients []uint16
+	var confirmed uint16
+	identityKeys := make(map[uint16]string)
+	for _, x := range resharers {
+		identityKeys[x.PartyID] = x.PublicKey
+		if x.Dealer {
+			dealers = append(dealers, x.PartyID)
+		}
+		if x.Recipient {
+			recipients = append(recipients, x.PartyID)
+		}
+		if x.Digest != nil {
+			confirmed++
+		}
+	}
+	var publicKey string
+	if group.PublicKey != nil {
+		publicKey = *group.PublicKey
+	}
+	return PollReshareResponse{
+		ReshareID:    reshare.Uid,
+		GroupID:      group.Uid,
+		PublicKey:    publicKey,
+		Epoch:        reshare.Epoch,
+		OldThreshold: group.Threshold,
+		Threshold:    reshare.Threshold,
+		PartySize:    reshare.Participants,
+		Dealers:      dealers,
+		Recipients:   recipients,
+		Newcomers:    newcomers,
+		IdentityKeys: identityKeys,
+		Locked:       reshare.Locked,
+		Confirmed:    confirmed,
+		Status:       reshare.Status,
+		Verdict:      reshare.Verdict,
+	}, nil
+}
+
+// Add a reshare message to the queue
+func AddReshareMessage(db Storage, reshareUid string, myPartyID uint16, message []byte) (FreeonReshareMessage, error) {
+	reshare, err := db.GetReshareData(reshareUid)
+	if err != nil {
+		return FreeonReshareMessage{}, err
+	}
+	if reshare.Status != GroupStatusOpen {
+		return FreeonReshareMessage{}, errors.New("reshare is no longer in progress")
+	}
+	if !reshare.Locked {
+		return FreeonReshareMessage{}, errors.New("reshare is still waiting for participants")
+	}
+	if err := checkEnvelopeSender(message, myPartyID); err != nil {
+		return FreeonReshareMessage{}, err
+	}
+	resharer, err := getResharer(db, reshareUid, myPartyID)
+	if err != nil {
+		return FreeonReshareMessage{}, err
+	}
+	msg := FreeonReshareMessage{
+		ReshareID: reshare.DbId,
+		Sender:    resharer.ParticipantID,
+		Message:   message,
+	}
+	id, err := db.InsertReshareMessage(msg)
+	if err != nil {
+		return FreeonReshareMessage{}, err
+	}
+	msg.DbId = id
+	return msg, nil
+}
+
+// Record the new public shares a participant ended up with, as a digest.
+//
+// Dealers and recipients all confirm. Once they have, the digests are compared; if they all match, the group is
+// handed over to the recipients. Otherwise the reshare is aborted, and the current holders keep the group.
+func ConfirmReshare(db Storage, reshareUid string, myPartyID uint16, digest string) error {
+	reshare, err := db.GetReshareData(reshareUid)
+	if err != nil {
+		return err
+	}
+	if reshare.Status != GroupStatusOpen {
+		return errors.New("reshare is no longer in progress")
+	}
+	if !reshare.Locked {
+		return errors.New("reshare is still waiting for participants")
+	}
+	if digest == "" {
+		return errors.New("confirmation has no digest")
+	}
+	resharer, err := getResharer(db, reshareUid, myPartyID)
+	if err != nil {
+		return err
+	}
+	if resharer.Digest != nil {
+		return errors.New("already confirmed this reshare")
+	}
+	if err := db.SetResharerDigest(resharer, digest); err != nil {
+		return err
+	}
+
+	resharers, err := db.GetResharers(reshareUid)
+	if err != nil {
+		return err
+	}
+	for _, x := range resharers {
+		if x.Digest == nil {
+			return nil
+		}
+	}
+	for _, x := range resharers {
+		if *x.Digest != digest {
+			return db.AbortReshare(reshare, fmt.Sprintf("party %d and party %d disagree about the new public shares", x.PartyID, myPartyID))
+		}
+	}
+	return db.CompleteReshare(reshare)
+}
+
+// Give up our seat in the reshare in progress for a group, so it doesn't wait on a party that's gone. Newcomers are
+// forgotten entirely, so they can join again. Once the reshare is locked, it's too late, and the reshare has to be
+// aborted instead. Returns the reshare we left.
+func LeaveReshare(db Storage, groupUid string, myPartyID uint16) (FreeonReshare, error) {
+	var reshare FreeonReshare
+	err := db.Atomically(func(tx Storage) error {
+		var err error
+		reshare, err = tx.GetOpenReshare(groupUid)
+		if errors.Is(err, ErrNotFound) {
+			return errors.New("no reshare in progress for this group")
+		} else if err != nil {
+			return err
+		}
+		if reshare.Locked {
+			return errors.New("this reshare already has everyone it needs; abort it instead")
+		}
+		resharer, err := getResharer(tx, reshare.Uid, myPartyID)
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteResharer(resharer); err != nil {
+			return err
+		}
+		// Only newcomers don't deal, and they aren't members until the reshare is complete
+		if !resharer.Dealer {
+			return tx.DeleteParticipant(resharer.ParticipantID)
+		}
+		return nil
+	})
+	if err != nil {
+		return FreeonReshare{}, err
+	}
+	return reshare, nil
+}
+
+// Give up on the reshare in progress for a group. The current holders keep the group.
+// Returns the reshare that was aborted.
+func CancelReshare(db Storage, groupUid string, myPartyID uint16, reason string) (FreeonReshare, error) {
+	reshare, err := db.GetOpenReshare(groupUid)
+	if errors.Is(err, ErrNotFound) {
+		return FreeonReshare{}, errors.New("no reshare in progress for this group")
+	} else if err != nil {
+		return FreeonReshare{}, err
+	}
+	if reason == "" {
+		reason = "no reason given"
+	}
+	verdict := fmt.Sprintf("party %d aborted the reshare: %s", myPartyID, reason)
+	if err := db.AbortReshare(reshare, verdict); err != nil {
+		return FreeonReshare{}, err
+	}
+	return reshare, nil
+}
+
+func getResharer(db Storage, reshareUid string, myPartyID uint16) (FreeonResharer, error) {
+	resharers, err := db.GetResharers(reshareUid)
+	if err != nil {
+		return FreeonResharer{}, err
+	}
+	for _, x := range resharers {
+		if x.PartyID == myPartyID {
+			return x, nil
+		}
+	}
+	return FreeonResharer{}, fmt.Errorf("party %d has not joined this reshare", myPartyID)
+}
+
+// Refreshes and reshares both move the group to a new epoch, so only one can be in progress at a time
+func refuseConcurrentChanges(db Storage, groupUid string) error {
+	if _, err := db.GetOpenRefresh(groupUid); err == nil {
+		return errors.New("a refresh is already in progress for this group")
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if _, err := db.GetOpenReshare(groupUid); err == nil {
+		return errors.New("a reshare is already in progress for this group")
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
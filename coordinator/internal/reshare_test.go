@@ -0,0 +1,208 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReshare(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+
+	newcomers := []string{newTestPublicKey(t), newTestPublicKey(t)}
+
+	// Only current holders can propose a reshare, and only a sensible one
+	_, err := internal.NewReshare(db, g_uid, 7, 4, 3, newcomers)
+	assert.Error(t, err)
+	_, err = internal.NewReshare(db, g_uid, 1, 3, 4, newcomers)
+	assert.Error(t, err)
+	_, err = internal.NewReshare(db, g_uid, 1, 4, 3, []string{newcomers[0], newcomers[0]})
+	assert.Error(t, err)
+	_, err = internal.NewReshare(db, g_uid, 1, 4, 3, []string{"abcd"})
+	assert.Error(t, err)
+	s_uid, err := internal.NewReshare(db, g_uid, 1, 4, 3, newcomers)
+	assert.NoError(t, err)
+	_, err = internal.NewReshare(db, g_uid, 1, 4, 3, newcomers)
+	assert.Error(t, err)
+	_, err = internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.Error(t, err)
+
+	// Parties 1 and 2 stay on, party 3 leaves, and two newcomers join
+	_, me, err := internal.JoinReshare(db, g_uid, 1, "", 0, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1), me)
+	_, _, err = internal.JoinReshare(db, g_uid, 2, "", 1, true)
+	assert.Error(t, err)
+	_, _, err = internal.JoinReshare(db, g_uid, 2, "", 0, true)
+	assert.NoError(t, err)
+	_, _, err = internal.JoinReshare(db, g_uid, 2, "", 0, true)
+	assert.Error(t, err)
+	_, _, err = internal.JoinReshare(db, g_uid, 0, newcomers[0], 0, false)
+	assert.Error(t, err)
+	_, me, err = internal.JoinReshare(db, g_uid, 0, newcomers[0], 0, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(4), me)
+
+	// Only the newcomers that were proposed, and only once each
+	_, _, err = internal.JoinReshare(db, g_uid, 0, newTestPublicKey(t), 0, true)
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	_, _, err = internal.JoinReshare(db, g_uid, 0, newcomers[0], 0, true)
+	assert.Error(t, err)
+
+	// Nothing can be sent until everyone is here
+	_, err = internal.AddReshareMessage(db, s_uid, 1, testEnvelope(1))
+	assert.Error(t, err)
+
+	reshare, me, err := internal.JoinReshare(db, g_uid, 0, newcomers[1], 0, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(5), me)
+	assert.True(t, reshare.Locked)
+	assert.Equal(t, s_uid, reshare.Uid)
+	_, _, err = internal.JoinReshare(db, g_uid, 3, "", 0, false)
+	assert.Error(t, err)
+
+	state, err := internal.PollReshare(db, s_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2}, state.Dealers)
+	assert.Equal(t, []uint16{1, 2, 4, 5}, state.Recipients)
+	assert.Equal(t, newcomers, state.Newcomers)
+	assert.Equal(t, newcomers[1], state.IdentityKeys[5])
+	assert.Equal(t, uint16(2), state.OldThreshold)
+	assert.Equal(t, uint16(3), state.Threshold)
+	assert.Equal(t, "test_pk", state.PublicKey)
+
+	// Newcomers can talk, but they aren't group members yet
+	_, err = internal.AddReshareMessage(db, s_uid, 5, testEnvelope(5))
+	assert.NoError(t, err)
+	_, err = db.GetParticipantID(g_uid, 5)
+	assert.Error(t, err)
+	_, err = internal.AddReshareMessage(db, s_uid, 3, testEnvelope(3))
+	assert.Error(t, err)
+
+	for _, p := range []uint16{1, 2, 4, 5} {
+		group, err := db.GetGroupData(g_uid)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), group.Epoch)
+		assert.NoError(t, internal.ConfirmReshare(db, s_uid, p, "digest"))
+	}
+	state, err = internal.PollReshare(db, s_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusComplete, state.Status)
+
+	// Same key, new members, new threshold
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), group.Epoch)
+	assert.Equal(t, uint16(4), group.Participants)
+	assert.Equal(t, uint16(3), group.Threshold)
+	assert.Equal(t, "test_pk", *group.PublicKey)
+	participants, err := db.GetGroupParticipants(g_uid)
+	assert.NoError(t, err)
+	var parties []uint16
+	for _, p := range participants {
+		parties = append(parties, p.PartyID)
+	}
+	assert.ElementsMatch(t, []uint16{1, 2, 4, 5}, parties)
+
+	// Party 3 is retired, and party 5 can sign
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), 3, 1)
+	assert.Error(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), 5, 1)
+	assert.NoError(t, err)
+}
+
+func TestReshareDisagreement(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+	s_uid, err := internal.NewReshare(db, g_uid, 1, 2, 2, nil)
+	assert.NoError(t, err)
+
+	// Party 3 leaves the group, so parties 1 and 2 are enough
+	_, _, err = internal.JoinReshare(db, g_uid, 1, "", 0, true)
+	assert.NoError(t, err)
+	reshare, _, err := internal.JoinReshare(db, g_uid, 2, "", 0, true)
+	assert.NoError(t, err)
+	assert.True(t, reshare.Locked)
+
+	assert.NoError(t, internal.ConfirmReshare(db, s_uid, 1, "digest"))
+	assert.NoError(t, internal.ConfirmReshare(db, s_uid, 2, "something else"))
+	state, err := internal.PollReshare(db, s_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusAborted, state.Status)
+	assert.Contains(t, *state.Verdict, "disagree")
+
+	// Nobody was retired
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), group.Epoch)
+	assert.Equal(t, uint16(3), group.Participants)
+	_, err = db.GetParticipantID(g_uid, 3)
+	assert.NoError(t, err)
+}
+
+func TestCancelReshare(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+	_, err := internal.CancelReshare(db, g_uid, 1, "")
+	assert.Error(t, err)
+
+	invited := newTestPublicKey(t)
+	s_uid, err := internal.NewReshare(db, g_uid, 1, 4, 3, []string{invited})
+	assert.NoError(t, err)
+	_, newcomer, err := internal.JoinReshare(db, g_uid, 0, invited, 0, true)
+	assert.NoError(t, err)
+	_, err = internal.CancelReshare(db, g_uid, 2, "wrong threshold")
+	assert.NoError(t, err)
+
+	state, err := internal.PollReshare(db, s_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusAborted, state.Status)
+	assert.Equal(t, "party 2 aborted the reshare: wrong threshold", *state.Verdict)
+
+	// The newcomer never made it into the group, and a refresh can go ahead
+	_, err = db.GetParticipantID(g_uid, newcomer)
+	assert.Error(t, err)
+	_, err = internal.JoinRefresh(db, g_uid, 1, 0)
+	assert.NoError(t, err)
+}
+
+func TestLeaveReshare(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+	_, err := internal.LeaveReshare(db, g_uid, 1)
+	assert.Error(t, err)
+
+	invited := newTestPublicKey(t)
+	s_uid, err := internal.NewReshare(db, g_uid, 1, 4, 3, []string{invited})
+	assert.NoError(t, err)
+	_, _, err = internal.JoinReshare(db, g_uid, 1, "", 0, true)
+	assert.NoError(t, err)
+	_, newcomer, err := internal.JoinReshare(db, g_uid, 0, invited, 0, true)
+	assert.NoError(t, err)
+
+	// The newcomer leaves without a trace, and can join again
+	_, err = internal.LeaveReshare(db, g_uid, newcomer)
+	assert.NoError(t, err)
+	_, err = internal.LeaveReshare(db, g_uid, 2)
+	assert.Error(t, err)
+	state, err := internal.PollReshare(db, s_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusOpen, state.Status)
+	assert.Equal(t, []uint16{1}, state.Recipients)
+	max, err := db.GetMaxPartyID(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(3), max)
+	_, _, err = internal.JoinReshare(db, g_uid, 0, invited, 0, true)
+	assert.NoError(t, err)
+
+	// Once the reshare has everyone it needs, it's too late
+	_, _, err = internal.JoinReshare(db, g_uid, 2, "", 0, true)
+	assert.NoError(t, err)
+	_, _, err = internal.JoinReshare(db, g_uid, 3, "", 0, true)
+	assert.NoError(t, err)
+	state, err = internal.PollReshare(db, s_uid)
+	assert.NoError(t, err)
+	assert.True(t, state.Locked)
+	_, err = internal.LeaveReshare(db, g_uid, 3)
+	assert.Error(t, err)
+}
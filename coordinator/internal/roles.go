@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Who may do what to a key group.
+//
+// Members hold shares, and authenticate with the keys they registered at /keygen/join. They can always propose a
+// signing ceremony, since nothing gets signed without enough of them joining anyway. Proposers aren't members (think
+// of a CI pipeline) and authenticate with an API token; all they can do is propose. Administrators can terminate
+// ceremonies and archive the group. A member becomes an administrator when the coordinator's operator says so, and an
+// API token can be issued with either role.
+const (
+	RoleProposer = "proposer"
+	RoleAdmin    = "admin"
+)
+
+// Roles an API token may carry
+var tokenRoles = []string{RoleProposer, RoleAdmin}
+
+// Make a member an administrator of their group
+func GrantMemberRole(db Storage, groupUid string, partyID uint16, role string) error {
+	if role != RoleAdmin {
+		return fmt.Errorf("members can't be given the %q role", role)
+	}
+	if _, err := db.GetParticipantPublicKey(groupUid, partyID); err != nil {
+		return fmt.Errorf("party %d is not a member of group %s", partyID, groupUid)
+	}
+	group, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return err
+	}
+	return db.InsertMemberRole(group.DbId, partyID, role)
+}
+
+func RevokeMemberRole(db Storage, groupUid string, partyID uint16, role string) error {
+	err := db.DeleteMemberRole(groupUid, partyID, role)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("party %d does not have the %q role", partyID, role)
+	}
+	return err
+}
+
+func hasMemberRole(db Storage, groupUid string, partyID uint16, role string) (bool, error) {
+	members, err := db.GetMemberRoles(groupUid)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(members, FreeonMemberRole{PartyID: partyID, Role: role}), nil
+}
+
+// We only keep a hash of each token, so a copy of the database isn't a pile of credentials
+func hashApiToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Issue an API token for a group. This is the only time the token itself is ever seen.
+func IssueApiToken(db Storage, groupUid, label, role string) (string, error) {
+	if label == "" {
+		return "", errors.New("API tokens need a label")
+	}
+	if !slices.Contains(tokenRoles, role) {
+		return "", fmt.Errorf("API tokens can't be given the %q role", role)
+	}
+	group, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return "", err
+	}
+	token, err := UniqueID()
+	if err != nil {
+		return "", err
+	}
+	token = "ft_" + token
+
+	err = db.InsertApiToken(group.DbId, FreeonApiToken{Label: label, Role: role, Created: time.Now().Unix()}, hashApiToken(token))
+	if err != nil {
+		return "", fmt.Errorf("could not issue token %q: %w", label, err)
+	}
+	return token, nil
+}
+
+func RevokeApiToken(db Storage, groupUid, label string) error {
+	err := db.DeleteApiToken(groupUid, label)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("no token labelled %q", label)
+	}
+	return err
+}
+
+// Everyone with a role in a group, except for plain members
+func GetGroupRoles(db Storage, groupUid string) ([]FreeonMemberRole, []FreeonApiToken, error) {
+	members, err := db.GetMemberRoles(groupUid)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := db.GetApiTokens(groupUid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return members, tokens, nil
+}
+
+// Make sure an API token belongs to a group, with one of the given roles
+func authorizeApiToken(db Storage, groupUid, token string, roles ...string) (FreeonApiToken, error) {
+	found, err := db.GetApiToken(groupUid, hashApiToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return FreeonApiToken{}, fmt.Errorf("%w: unknown API token", ErrUnauthorized)
+	}
+	if err != nil {
+		return FreeonApiToken{}, err
+	}
+	if !slices.Contains(roles, found.Role) {
+		return FreeonApiToken{}, fmt.Errorf("%w: this API token is only good for the %s role", ErrUnauthorized, found.Role)
+	}
+	return found, nil
+}
+
+// Make sure whoever is proposing a signing ceremony may do so: either a member, signing the request with their
+// registered key, or someone with an API token. Returns who they are, for signers to see.
+func AuthorizeProposer(db Storage, groupUid string, myPartyID *uint16, token, path string, body []byte, signature string) (string, error) {
+	if token != "" {
+		found, err := authorizeApiToken(db, groupUid, token, RoleProposer, RoleAdmin)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("API token %q", found.Label), nil
+	}
+	if myPartyID == nil {
+		return "", fmt.Errorf("%w: proposing a signing ceremony takes an API token or a member's signature", ErrUnauthorized)
+	}
+	if err := AuthenticateParticipant(db, groupUid, *myPartyID, path, body, signature); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("party %d", *myPartyID), nil
+}
+
+// Make sure a request comes from one of a group's administrators
+func AuthorizeAdmin(db Storage, groupUid string, myPartyID uint16, token, path string, body []byte, signature string) error {
+	if token != "" {
+		_, err := authorizeApiToken(db, groupUid, token, RoleAdmin)
+		return err
+	}
+	if err := AuthenticateParticipant(db, groupUid, myPartyID, path, body, signature); err != nil {
+		return err
+	}
+	admin, err := hasMemberRole(db, groupUid, myPartyID, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return fmt.Errorf("%w: party %d is not an administrator of this group", ErrUnauthorized, myPartyID)
+	}
+	return nil
+}
+
+// Like AuthorizeAdmin, but the group is looked up from a signing ceremony
+func AuthorizeCeremonyAdmin(db Storage, ceremonyUid string, myPartyID uint16, token, path string, body []byte, signature string) error {
+	ceremony, err := db.GetCeremonyData(ceremonyUid)
+	if err != nil {
+		return err
+	}
+	group, err := db.GetGroupByID(ceremony.GroupID)
+	if err != nil {
+		return err
+	}
+	return AuthorizeAdmin(db, group.Uid, myPartyID, token, path, body, signature)
+}
+
+// Retire a group for good: no more signing, refreshing, or resharing. Any ceremonies still open are closed, and their
+// IDs returned so anyone waiting on them can be told.
+func ArchiveGroup(db Storage, groupUid string) ([]string, error) {
+	var closed []string
+	err := db.Atomically(func(tx Storage) error {
+		err := tx.SetGroupStatus(groupUid, GroupStatusComplete, GroupStatusArchived)
+		if errors.Is(err, ErrNotFound) {
+			return errors.New("only a group that finished key generation can be archived")
+		}
+		if err != nil {
+			return err
+		}
+		group, err := tx.GetGroupData(groupUid)
+		if err != nil {
+			return err
+		}
+		closed, err = tx.CloseCeremonies(group.DbId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return closed, nil
+}
@@ -0,0 +1,117 @@
+package internal_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizeProposer(t *testing.T) {
+	db := setupTestDBForSign(t)
+	g_uid, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	pk, sk := newTestKeypair(t)
+	p, err := internal.AddParticipant(db, g_uid, pk)
+	assert.NoError(t, err)
+	body := []byte(`{"group-id":"` + g_uid + `"}`)
+
+	// Members propose as themselves
+	sig := signTestRequest(sk, "/sign/create", body)
+	proposer, err := internal.AuthorizeProposer(db, g_uid, &p.PartyID, "", "/sign/create", body, sig)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("party %d", p.PartyID), proposer)
+	_, err = internal.AuthorizeProposer(db, g_uid, nil, "", "/sign/create", body, sig)
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+
+	// Everyone else needs a token for this group
+	token, err := internal.IssueApiToken(db, g_uid, "ci", internal.RoleProposer)
+	assert.NoError(t, err)
+	proposer, err = internal.AuthorizeProposer(db, g_uid, nil, token, "/sign/create", body, "")
+	assert.NoError(t, err)
+	assert.Equal(t, `API token "ci"`, proposer)
+	other, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	_, err = internal.AuthorizeProposer(db, other, nil, token, "/sign/create", body, "")
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+
+	// Labels are unique, and revoked tokens stop working
+	_, err = internal.IssueApiToken(db, g_uid, "ci", internal.RoleProposer)
+	assert.Error(t, err)
+	_, err = internal.IssueApiToken(db, g_uid, "ci-2", "member")
+	assert.Error(t, err)
+	assert.NoError(t, internal.RevokeApiToken(db, g_uid, "ci"))
+	_, err = internal.AuthorizeProposer(db, g_uid, nil, token, "/sign/create", body, "")
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+	assert.Error(t, internal.RevokeApiToken(db, g_uid, "ci"))
+}
+
+func TestAuthorizeAdmin(t *testing.T) {
+	db := setupTestDBForSign(t)
+	pk, sk := newTestKeypair(t)
+	g_uid, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	p, err := internal.AddParticipant(db, g_uid, pk)
+	assert.NoError(t, err)
+	body := []byte(`{"group-id":"` + g_uid + `"}`)
+	sig := func() string { return signTestRequest(sk, "/archive", body) }
+
+	// Being a member isn't enough
+	assert.ErrorIs(t, internal.AuthorizeAdmin(db, g_uid, p.PartyID, "", "/archive", body, sig()), internal.ErrUnauthorized)
+	assert.NoError(t, internal.GrantMemberRole(db, g_uid, p.PartyID, internal.RoleAdmin))
+	signed := sig()
+	assert.NoError(t, internal.AuthorizeAdmin(db, g_uid, p.PartyID, "", "/archive", body, signed))
+	// The request still has to be signed by them, and only works once
+	assert.ErrorIs(t, internal.AuthorizeAdmin(db, g_uid, p.PartyID, "", "/archive", body, ""), internal.ErrUnauthorized)
+	assert.ErrorIs(t, internal.AuthorizeAdmin(db, g_uid, p.PartyID, "", "/archive", body, signed), internal.ErrReplayed)
+
+	// Only members can be made administrators, and only administrators
+	assert.Error(t, internal.GrantMemberRole(db, g_uid, p.PartyID+1, internal.RoleAdmin))
+	assert.Error(t, internal.GrantMemberRole(db, g_uid, p.PartyID, internal.RoleProposer))
+
+	members, tokens, err := internal.GetGroupRoles(db, g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.FreeonMemberRole{{PartyID: p.PartyID, Role: internal.RoleAdmin}}, members)
+	assert.Empty(t, tokens)
+
+	assert.NoError(t, internal.RevokeMemberRole(db, g_uid, p.PartyID, internal.RoleAdmin))
+	assert.ErrorIs(t, internal.AuthorizeAdmin(db, g_uid, p.PartyID, "", "/archive", body, sig()), internal.ErrUnauthorized)
+
+	// Proposer tokens can't administer anything; admin tokens can
+	proposer, err := internal.IssueApiToken(db, g_uid, "ci", internal.RoleProposer)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, internal.AuthorizeAdmin(db, g_uid, 0, proposer, "/archive", body, ""), internal.ErrUnauthorized)
+	admin, err := internal.IssueApiToken(db, g_uid, "ops", internal.RoleAdmin)
+	assert.NoError(t, err)
+	assert.NoError(t, internal.AuthorizeAdmin(db, g_uid, 0, admin, "/archive", body, ""))
+	_, err = internal.AuthorizeProposer(db, g_uid, nil, admin, "/sign/create", body, "")
+	assert.NoError(t, err)
+}
+
+func TestArchiveGroup(t *testing.T) {
+	db, g_uid := setupRefreshGroup(t)
+	open, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+
+	closed, err := internal.ArchiveGroup(db, g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{open}, closed)
+	group, err := db.GetGroupData(g_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.GroupStatusArchived, group.Status)
+
+	ceremony, err := db.GetCeremonyData(open)
+	assert.NoError(t, err)
+	assert.False(t, ceremony.Active)
+	_, err = internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.Error(t, err)
+
+	// Only once, and only for groups that finished key generation
+	_, err = internal.ArchiveGroup(db, g_uid)
+	assert.Error(t, err)
+	pending, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	_, err = internal.ArchiveGroup(db, pending)
+	assert.Error(t, err)
+}
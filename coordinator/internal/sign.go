@@ -2,11 +2,34 @@ package internal
 
 import (
 	"crypto/subtle"
-	"database/sql"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 )
 
-func NewSignGroup(db *sql.DB, groupUid string, hash string, openssh bool, namespace string) (string, error) {
+// A ceremony's final signature didn't verify, so it was closed without one
+var ErrDisputed = errors.New("ceremony is disputed")
+
+// Create a signing ceremony for a message.
+// The coordinator keeps the message, so it can check the final signature before accepting it.
+// If preferred isn't empty, only those parties may sign.
+func NewSignGroup(db Storage, groupUid string, hash string, message []byte, openssh bool, namespace string, preferred []uint16) (string, error) {
+	groupData, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return "", err
+	}
+	if groupData.Status == GroupStatusArchived {
+		return "", errors.New("group has been archived")
+	}
+	if err := checkPreferredSigners(db, groupData, preferred); err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(HashMessageForSanity(message, groupUid)), []byte(hash)) != 1 {
+		return "", errors.New("hash mismatch")
+	}
+
 	// Unique ID (192 bits entropy)
 	uid, err := UniqueID()
 	if err != nil {
@@ -14,109 +37,360 @@ func NewSignGroup(db *sql.DB, groupUid string, hash string, openssh bool, namesp
 	}
 	uid = "c_" + uid
 
-	groupData, err := GetGroupData(db, groupUid)
+	encoded := hex.EncodeToString(message)
+	_, err = db.InsertCeremony(FreeonCeremonies{
+		GroupID:          groupData.DbId,
+		Uid:              uid,
+		Active:           true,
+		Hash:             hash,
+		Message:          &encoded,
+		OpenSSH:          openssh,
+		OpenSSHNamespace: &namespace,
+		Epoch:            groupData.Epoch,
+		Preferred:        preferred,
+	})
 	if err != nil {
 		return "", err
 	}
 
-	stmt, err := db.Prepare("INSERT INTO ceremonies (uid, groupid, hash, openssh, opensshnamespace) VALUES (?, ?, ?, ?, ?)")
+	return uid, nil
+}
+
+// Create a signing ceremony for a message the coordinator isn't allowed to see.
+// The proposer encrypts the message to the group's members, and the coordinator only hands the ciphertext out. Since it
+// can't check the hash or the final signature itself, the signers do both.
+func NewSealedSignGroup(db Storage, groupUid string, hash string, sealed []byte, openssh bool, namespace string, preferred []uint16) (string, error) {
+	groupData, err := db.GetGroupData(groupUid)
 	if err != nil {
 		return "", err
 	}
-	_, err = stmt.Exec(uid, groupData.DbId, hash, openssh, namespace)
+	if groupData.Status == GroupStatusArchived {
+		return "", errors.New("group has been archived")
+	}
+	if err := checkPreferredSigners(db, groupData, preferred); err != nil {
+		return "", err
+	}
+	if len(sealed) == 0 {
+		return "", errors.New("sealed message is empty")
+	}
+
+	uid, err := UniqueID()
 	if err != nil {
 		return "", err
 	}
+	uid = "c_" + uid
+	encoded := hex.EncodeToString(sealed)
+	_, err = db.InsertCeremony(FreeonCeremonies{
+		GroupID:          groupData.DbId,
+		Uid:              uid,
+		Active:           true,
+		Hash:             hash,
+		SealedMessage:    &encoded,
+		OpenSSH:          openssh,
+		OpenSSHNamespace: &namespace,
+		Epoch:            groupData.Epoch,
+		Preferred:        preferred,
+	})
+	if err != nil {
+		return "", err
+	}
+	return uid, nil
+}
 
+// Create a ceremony that issues an OpenSSH certificate, signed by the group key.
+// Unlike other ceremonies, the coordinator keeps the to-be-signed data, so every signer can inspect it.
+func NewSSHCertCeremony(db Storage, groupUid string, hash string, certificate []byte, preferred []uint16) (string, error) {
+	groupData, err := db.GetGroupData(groupUid)
+	if err != nil {
+		return "", err
+	}
+	if groupData.Status == GroupStatusArchived {
+		return "", errors.New("group has been archived")
+	}
+	if err := checkPreferredSigners(db, groupData, preferred); err != nil {
+		return "", err
+	}
+	if groupData.PublicKey == nil {
+		return "", errors.New("key generation is not complete")
+	}
+	groupKey, err := hex.DecodeString(*groupData.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	if err := CheckSSHCertificate(certificate, groupKey); err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(HashMessageForSanity(certificate, groupUid)), []byte(hash)) != 1 {
+		return "", errors.New("hash mismatch")
+	}
+
+	uid, err := UniqueID()
+	if err != nil {
+		return "", err
+	}
+	uid = "c_" + uid
+	encoded := hex.EncodeToString(certificate)
+	_, err = db.InsertCeremony(FreeonCeremonies{
+		GroupID:        groupData.DbId,
+		Uid:            uid,
+		Active:         true,
+		Hash:           hash,
+		SSHCertificate: &encoded,
+		Epoch:          groupData.Epoch,
+		Preferred:      preferred,
+	})
+	if err != nil {
+		return "", err
+	}
 	return uid, nil
 }
 
-func JoinSignCeremony(db *sql.DB, ceremonyID, hash string, myPartyID uint16) (int64, error) {
-	ceremonyData, err := GetCeremonyData(db, ceremonyID)
+// A preferred signer list has to be made of the group's current participants, and be able to reach the threshold
+func checkPreferredSigners(db Storage, groupData FreeonGroup, preferred []uint16) error {
+	if len(preferred) == 0 {
+		return nil
+	}
+	if uint16(len(preferred)) < groupData.Threshold {
+		return fmt.Errorf("at least %d signers are needed, but only %d were chosen", groupData.Threshold, len(preferred))
+	}
+	participants, err := db.GetGroupParticipants(groupData.Uid)
+	if err != nil {
+		return err
+	}
+	seen := make(map[uint16]bool)
+	for _, p := range preferred {
+		if seen[p] {
+			return fmt.Errorf("party %d was chosen more than once", p)
+		}
+		seen[p] = true
+		if !slices.ContainsFunc(participants, func(x FreeonParticipant) bool { return x.PartyID == p }) {
+			return fmt.Errorf("party %d is not a participant in this group", p)
+		}
+	}
+	return nil
+}
+
+// Get the message a ceremony was asked to sign, if the proposer shared it with the signers
+func GetSignProposal(db Storage, ceremonyUid string) (SignProposal, error) {
+	ceremony, err := db.GetCeremonyData(ceremonyUid)
+	if err != nil {
+		return SignProposal{}, err
+	}
+	proposal := SignProposal{
+		Hash:    ceremony.Hash,
+		OpenSSH: ceremony.OpenSSH,
+	}
+	if ceremony.OpenSSHNamespace != nil {
+		proposal.Namespace = *ceremony.OpenSSHNamespace
+	}
+	switch {
+	case ceremony.SealedMessage != nil:
+		proposal.SealedMessage = *ceremony.SealedMessage
+	case ceremony.Published && ceremony.Message != nil:
+		proposal.Message = *ceremony.Message
+	default:
+		return SignProposal{}, errors.New("the proposer did not share this ceremony's message")
+	}
+	return proposal, nil
+}
+
+// Rolls back the extra seat when a player joins a ceremony twice
+var errAlreadyJoined = errors.New("already joined")
+
+// Enlist a participant as a player in a signing ceremony.
+// The epoch is the one their share is from; shares from before the last refresh or reshare are refused.
+// The first threshold-many players (from the preferred list, if there is one) are the ceremony's signers, and
+// nobody can join after that.
+func JoinSignCeremony(db Storage, ceremonyID, hash string, myPartyID uint16, epoch uint64) (int64, error) {
+	ceremonyData, err := db.GetCeremonyData(ceremonyID)
 	if err != nil {
 		return 0, err
 	}
 	if !ceremonyData.Active {
 		return 0, errors.New("ceremony is not active or does not exist")
 	}
-
-	stmt, err := db.Prepare(`
-		SELECT par.id
-		FROM participants par
-		JOIN keygroups g ON par.groupid = g.id
-		JOIN ceremonies c ON c.groupid = g.id 
-		WHERE c.uid = ? AND par.partyid = ?
-		`)
+	if PastDeadline(ceremonyData.Deadline, time.Now()) {
+		return 0, errors.New("ceremony has expired")
+	}
+	groupData, err := db.GetGroupByID(ceremonyData.GroupID)
 	if err != nil {
 		return 0, err
 	}
-	var participantId int64
-	err = stmt.QueryRow(ceremonyID, myPartyID).Scan(&participantId)
+	if ceremonyData.Epoch != groupData.Epoch {
+		return 0, errors.New("ceremony was created before the group's shares were last refreshed or reshared")
+	}
+	if epoch != groupData.Epoch {
+		return 0, fmt.Errorf("share is from epoch %d, but the group is at epoch %d", epoch, groupData.Epoch)
+	}
+
+	participantId, err := db.GetParticipantID(groupData.Uid, myPartyID)
 	if err != nil {
 		return 0, err
 	}
 	if subtle.ConstantTimeCompare([]byte(ceremonyData.Hash), []byte(hash)) != 1 {
 		return 0, errors.New("hash mismatch")
 	}
-
-	// Now insert the player
-	insert, err := db.Prepare(`INSERT INTO players (ceremonyid, participantid) VALUES (?, ?)`)
-	if err != nil {
-		return 0, err
+	if len(ceremonyData.Preferred) > 0 && !slices.Contains(ceremonyData.Preferred, myPartyID) {
+		return 0, fmt.Errorf("party %d is not one of this ceremony's chosen signers", myPartyID)
 	}
-	_, err = insert.Exec(ceremonyData.DbId, participantId)
-	if err != nil {
+
+	// Now insert the player. Writing before reading anything back keeps concurrent joins from tripping over each
+	// other's locks; if it turns out we shouldn't have, the insert is rolled back.
+	err = db.Atomically(func(tx Storage) error {
+		_, err := tx.InsertPlayer(FreeonPlayers{CeremonyID: ceremonyData.DbId, ParticipantID: participantId})
+		if err != nil {
+			return err
+		}
+		players, err := tx.GetCeremonyPlayers(ceremonyID)
+		if err != nil {
+			return err
+		}
+		// Joining twice doesn't make anyone a signer twice
+		seats := 0
+		for _, p := range players {
+			if p.PartyID == myPartyID {
+				seats++
+			}
+		}
+		if seats > 1 {
+			return errAlreadyJoined
+		}
+		current, err := tx.GetCeremonyData(ceremonyID)
+		if err != nil {
+			return err
+		}
+		if current.Locked {
+			return errors.New("this ceremony already has all the signers it needs")
+		}
+		// With the threshold reached, the signer set is final
+		if uint16(len(players)) >= groupData.Threshold {
+			return tx.LockCeremony(current)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errAlreadyJoined) {
 		return 0, err
 	}
 	return participantId, nil
 }
 
-func PollSignCeremony(db *sql.DB, ceremonyID string, myPartyID uint16) (PollSignResponse, error) {
-	ceremonyData, err := GetCeremonyData(db, ceremonyID)
+// Give up a seat in a signing ceremony, so it doesn't wait on a party that's gone. Once the signers are settled, it's
+// too late: the ceremony can't go ahead without them, and has to be terminated instead.
+func LeaveSignCeremony(db Storage, ceremonyID string, myPartyID uint16) error {
+	return db.Atomically(func(tx Storage) error {
+		ceremonyData, err := tx.GetCeremonyData(ceremonyID)
+		if err != nil {
+			return err
+		}
+		if ceremonyData.Locked {
+			return errors.New("this ceremony's signers are already settled; terminate it instead")
+		}
+		groupData, err := tx.GetGroupByID(ceremonyData.GroupID)
+		if err != nil {
+			return err
+		}
+		participantId, err := tx.GetParticipantID(groupData.Uid, myPartyID)
+		if err != nil {
+			return err
+		}
+		return tx.DeletePlayer(ceremonyID, participantId)
+	})
+}
+
+func PollSignCeremony(db Storage, ceremonyID string, myPartyID uint16) (PollSignResponse, error) {
+	ceremonyData, err := db.GetCeremonyData(ceremonyID)
 	if err != nil {
 		return PollSignResponse{}, err
 	}
 
-	groupData, err := GetGroupByID(db, ceremonyData.GroupID)
+	groupData, err := db.GetGroupByID(ceremonyData.GroupID)
 	if err != nil {
 		return PollSignResponse{}, err
 	}
 
-	players, err := GetCeremonyPlayers(db, ceremonyID)
+	players, err := db.GetCeremonyPlayers(ceremonyID)
 	if err != nil {
 		return PollSignResponse{}, err
 	}
 
 	var otherParties []uint16
+	signers := []uint16{}
 	for _, player := range players {
 		if player.PartyID != myPartyID {
 			otherParties = append(otherParties, player.PartyID)
 		}
+		if ceremonyData.Locked {
+			signers = append(signers, player.PartyID)
+		}
 	}
+	slices.Sort(signers)
 
-	return PollSignResponse{
+	response := PollSignResponse{
 		GroupID:      groupData.Uid,
 		MyPartyID:    myPartyID,
 		Threshold:    groupData.Threshold,
 		OtherParties: otherParties,
-	}, nil
+		Epoch:        groupData.Epoch,
+		Signers:      signers,
+		Preferred:    ceremonyData.Preferred,
+	}
+	switch {
+	case ceremonyData.Active:
+		response.Status = CeremonyStatusOpen
+		response.ExpiresIn = SecondsLeft(ceremonyData.Deadline, time.Now())
+	case ceremonyData.Expired:
+		response.Status = CeremonyStatusExpired
+	case ceremonyData.Signature != nil:
+		response.Status = CeremonyStatusComplete
+	case ceremonyData.Verdict != nil:
+		response.Status = CeremonyStatusDisputed
+		response.Verdict = ceremonyData.Verdict
+	default:
+		response.Status = CeremonyStatusClosed
+	}
+	// Signers can't bring their own copy of a certificate, so they need to see what they're signing
+	if ceremonyData.SSHCertificate != nil {
+		response.SSHCertificate = *ceremonyData.SSHCertificate
+	}
+	if ceremonyData.Proposer != nil {
+		response.Proposer = *ceremonyData.Proposer
+	}
+	if ceremonyData.OpenSSH && ceremonyData.OpenSSHNamespace != nil {
+		response.OpenSSH = true
+		response.Namespace = *ceremonyData.OpenSSHNamespace
+	}
+	return response, nil
 }
 
-func AddSignMessage(db *sql.DB, ceremonyUid string, myPartyID uint16, message []byte) (FreeonSignMessage, error) {
-	ceremony, err := GetCeremonyData(db, ceremonyUid)
+func AddSignMessage(db Storage, ceremonyUid string, myPartyID uint16, message []byte) (FreeonSignMessage, error) {
+	ceremony, err := db.GetCeremonyData(ceremonyUid)
 	if err != nil {
 		return FreeonSignMessage{}, err
 	}
 	if !ceremony.Active {
 		return FreeonSignMessage{}, errors.New("ceremony is not active or does not exist")
 	}
+	if err := checkSignMessageSender(message, myPartyID); err != nil {
+		return FreeonSignMessage{}, err
+	}
+	// Only the settled signers take part, or anyone in the group could slip commitments into the round
+	if !ceremony.Locked {
+		return FreeonSignMessage{}, errors.New("this ceremony's signers aren't settled yet")
+	}
+	players, err := db.GetCeremonyPlayers(ceremonyUid)
+	if err != nil {
+		return FreeonSignMessage{}, err
+	}
+	if !slices.ContainsFunc(players, func(p FreeonPlayers) bool { return p.PartyID == myPartyID }) {
+		return FreeonSignMessage{}, fmt.Errorf("%w: party %d is not one of this ceremony's signers", ErrUnauthorized, myPartyID)
+	}
 
-	group, err := GetGroupByID(db, ceremony.GroupID)
+	group, err := db.GetGroupByID(ceremony.GroupID)
 	if err != nil {
 		return FreeonSignMessage{}, err
 	}
 
-	participant, err := GetParticipantID(db, group.Uid, myPartyID)
+	participant, err := db.GetParticipantID(group.Uid, myPartyID)
 	if err != nil {
 		return FreeonSignMessage{}, err
 	}
@@ -126,7 +400,7 @@ func AddSignMessage(db *sql.DB, ceremonyUid string, myPartyID uint16, message []
 		Sender:     participant,
 		Message:    message,
 	}
-	id, err := InsertSignMessage(db, msg)
+	id, err := db.InsertSignMessage(msg)
 	if err != nil {
 		return FreeonSignMessage{}, err
 	}
@@ -134,8 +408,10 @@ func AddSignMessage(db *sql.DB, ceremonyUid string, myPartyID uint16, message []
 	return msg, nil
 }
 
-func SetSignature(db *sql.DB, ceremonyUid, sig string) error {
-	ceremony, err := GetCeremonyData(db, ceremonyUid)
+// Record the final signature, as reported by one of the ceremony's signers. A signature that doesn't verify disputes
+// the ceremony, so only the signers get to report one; anyone else in the group could kill an honest ceremony.
+func SetSignature(db Storage, ceremonyUid string, myPartyID uint16, sig string) error {
+	ceremony, err := db.GetCeremonyData(ceremonyUid)
 	if err != nil {
 		return err
 	}
@@ -146,17 +422,115 @@ func SetSignature(db *sql.DB, ceremonyUid, sig string) error {
 	if ceremony.Signature != nil {
 		return errors.New("signature is already defined")
 	}
+	if !ceremony.Locked {
+		return errors.New("this ceremony's signers aren't settled yet")
+	}
+	players, err := db.GetCeremonyPlayers(ceremonyUid)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(players, func(p FreeonPlayers) bool { return p.PartyID == myPartyID }) {
+		return fmt.Errorf("%w: party %d is not one of this ceremony's signers", ErrUnauthorized, myPartyID)
+	}
+	group, err := db.GetGroupByID(ceremony.GroupID)
+	if err != nil {
+		return err
+	}
+	// We never saw a sealed message, so there's nothing to check the signature against. GetSignature says so.
+	if ceremony.SealedMessage == nil {
+		if group.PublicKey == nil {
+			return errors.New("group has no public key")
+		}
+		if err := VerifyCeremonySignature(group, ceremony, sig); err != nil {
+			// The shares were checked before they were aggregated, so somebody is lying. Nobody gets a signature.
+			verdict := fmt.Sprintf("the final signature does not verify: %v", err)
+			if err := db.DisputeCeremony(ceremony, verdict); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: %s", ErrDisputed, verdict)
+		}
+	}
 
-	return FinalizeSignature(db, ceremony, sig)
+	return db.FinalizeSignature(ceremony, sig)
 }
 
-func GetSignature(db *sql.DB, ceremonyUid string) (string, error) {
-	ceremony, err := GetCeremonyData(db, ceremonyUid)
+// The final signature, and whether we checked it. Signatures over sealed messages can't be checked, so they're only
+// as good as the signer who reported them.
+func GetSignature(db Storage, ceremonyUid string) (string, bool, error) {
+	ceremony, err := db.GetCeremonyData(ceremonyUid)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 	if ceremony.Signature != nil {
-		return *ceremony.Signature, nil
+		return *ceremony.Signature, ceremony.SealedMessage == nil, nil
+	}
+	if ceremony.Verdict != nil {
+		return "", false, fmt.Errorf("%w: %s", ErrDisputed, *ceremony.Verdict)
+	}
+	return "", false, errors.New("signature not found")
+}
+
+// Record that one player caught others sending invalid signature shares.
+// This aborts the ceremony. Later reports from other honest players are still recorded.
+func ReportBlame(db Storage, ceremonyUid string, myPartyID uint16, accused []uint16, reason string) error {
+	ceremony, err := db.GetCeremonyData(ceremonyUid)
+	if err != nil {
+		return err
+	}
+	if ceremony.Signature != nil {
+		return errors.New("ceremony already produced a signature")
+	}
+	if len(accused) == 0 {
+		return errors.New("blame report does not accuse anyone")
+	}
+
+	players, err := db.GetCeremonyPlayers(ceremonyUid)
+	if err != nil {
+		return err
+	}
+	playerIDs := make(map[uint16]int64)
+	for _, p := range players {
+		playerIDs[p.PartyID] = p.ParticipantID
+	}
+	reporter, ok := playerIDs[myPartyID]
+	if !ok {
+		return errors.New("only players in the ceremony may report blame")
+	}
+	// We don't know anyone's public share, so we can't check the signature shares ourselves. We can at least make sure
+	// nobody is blamed for a share they never sent: every message was checked against its sender when it came in.
+	messages, err := db.GetSignMessagesSince(ceremonyUid, 0)
+	if err != nil {
+		return err
+	}
+	sentShares := signatureShareSenders(messages)
+	var accusedIDs []int64
+	for _, a := range accused {
+		if a == myPartyID {
+			return errors.New("players cannot blame themselves")
+		}
+		participant, ok := playerIDs[a]
+		if !ok {
+			return fmt.Errorf("party %d is not a player in this ceremony", a)
+		}
+		if !sentShares[participant] {
+			return fmt.Errorf("party %d has not sent a signature share", a)
+		}
+		accusedIDs = append(accusedIDs, participant)
+	}
+
+	for _, a := range accusedIDs {
+		_, err := db.InsertBlame(FreeonBlameRecord{
+			CeremonyID: ceremony.DbId,
+			Reporter:   reporter,
+			Accused:    a,
+			Reason:     reason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if ceremony.Active {
+		return db.TerminateCeremony(ceremonyUid)
 	}
-	return "", errors.New("signature not found")
+	return nil
 }
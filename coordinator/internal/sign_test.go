@@ -1,55 +1,71 @@
 package internal_test
 
 import (
-	"database/sql"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
 	"testing"
 
-	_ "github.com/ncruces/go-sqlite3/driver"
-	_ "github.com/ncruces/go-sqlite3/embed"
 	"github.com/soatok/freeon/coordinator/internal"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupTestDBForSign(t *testing.T) *sql.DB {
-	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
-	assert.NoError(t, err)
-	err = internal.DbEnsureTablesExist(db)
-	assert.NoError(t, err)
+func setupTestDBForSign(t *testing.T) internal.Storage {
+	db := internal.NewMemoryStorage()
 	t.Cleanup(func() {
 		db.Close()
 	})
 	return db
 }
 
+var testMessage = []byte("test message")
+
+func testHash(groupUid string) string {
+	return internal.HashMessageForSanity(testMessage, groupUid)
+}
+
+// Have the given parties join a signing ceremony, settling its signers once enough of them have
+func joinTestSigners(t *testing.T, db internal.Storage, groupUid, ceremonyUid string, partyIDs ...uint16) {
+	for _, id := range partyIDs {
+		_, err := internal.JoinSignCeremony(db, ceremonyUid, testHash(groupUid), id, 0)
+		assert.NoError(t, err)
+	}
+}
+
 func TestNewSignGroup(t *testing.T) {
 	db := setupTestDBForSign(t)
 	g_uid, err := internal.NewKeyGroup(db, 2, 2)
 	assert.NoError(t, err)
 
-	c_uid, err := internal.NewSignGroup(db, g_uid, "hash", false, "")
+	// The hash has to match the message
+	_, err = internal.NewSignGroup(db, g_uid, "hash", testMessage, false, "", nil)
+	assert.Error(t, err)
+
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, c_uid)
 
-	c, err := internal.GetCeremonyData(db, c_uid)
+	c, err := db.GetCeremonyData(c_uid)
 	assert.NoError(t, err)
-	assert.Equal(t, "hash", c.Hash)
+	assert.Equal(t, testHash(g_uid), c.Hash)
+	assert.Equal(t, hex.EncodeToString(testMessage), *c.Message)
 }
 
 func TestJoinSignCeremony(t *testing.T) {
 	db := setupTestDBForSign(t)
 	g_uid, err := internal.NewKeyGroup(db, 2, 2)
 	assert.NoError(t, err)
-	p, err := internal.AddParticipant(db, g_uid)
+	p, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
 	assert.NoError(t, err)
-	c_uid, err := internal.NewSignGroup(db, g_uid, "hash", false, "")
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
 	assert.NoError(t, err)
 
-	pid, err := internal.JoinSignCeremony(db, c_uid, "hash", p.PartyID)
+	pid, err := internal.JoinSignCeremony(db, c_uid, testHash(g_uid), p.PartyID, 0)
 	assert.NoError(t, err)
 	assert.Equal(t, p.DbId, pid)
 
 	// Wrong hash
-	_, err = internal.JoinSignCeremony(db, c_uid, "wrong_hash", p.PartyID)
+	_, err = internal.JoinSignCeremony(db, c_uid, "wrong_hash", p.PartyID, 0)
 	assert.Error(t, err)
 }
 
@@ -57,15 +73,15 @@ func TestPollSignCeremony(t *testing.T) {
 	db := setupTestDBForSign(t)
 	g_uid, err := internal.NewKeyGroup(db, 2, 2)
 	assert.NoError(t, err)
-	p1, err := internal.AddParticipant(db, g_uid)
+	p1, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
 	assert.NoError(t, err)
-	p2, err := internal.AddParticipant(db, g_uid)
+	p2, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
 	assert.NoError(t, err)
-	c_uid, err := internal.NewSignGroup(db, g_uid, "hash", false, "")
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
 	assert.NoError(t, err)
-	_, err = internal.JoinSignCeremony(db, c_uid, "hash", p1.PartyID)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), p1.PartyID, 0)
 	assert.NoError(t, err)
-	_, err = internal.JoinSignCeremony(db, c_uid, "hash", p2.PartyID)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), p2.PartyID, 0)
 	assert.NoError(t, err)
 
 	poll, err := internal.PollSignCeremony(db, c_uid, p1.PartyID)
@@ -75,42 +91,329 @@ func TestPollSignCeremony(t *testing.T) {
 	// Ensure party 1 sees party 2
 	assert.Len(t, poll.OtherParties, 1)
 	assert.Equal(t, p2.PartyID, poll.OtherParties[0])
+	assert.False(t, poll.OpenSSH)
+	assert.Empty(t, poll.Proposer)
+
+	// Signers get to see who asked, and for what kind of signature
+	c_uid, err = internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, true, "git", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.SetCeremonyProposer(c_uid, "party 1"))
+	poll, err = internal.PollSignCeremony(db, c_uid, 0)
+	assert.NoError(t, err)
+	assert.True(t, poll.OpenSSH)
+	assert.Equal(t, "git", poll.Namespace)
+	assert.Equal(t, "party 1", poll.Proposer)
+}
+
+func TestSignerSetLocks(t *testing.T) {
+	db := setupTestDBForSign(t)
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
+	assert.NoError(t, err)
+	var parties []internal.FreeonParticipant
+	for i := 0; i < 3; i++ {
+		p, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+		assert.NoError(t, err)
+		parties = append(parties, p)
+	}
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[2].PartyID, 0)
+	assert.NoError(t, err)
+	poll, err := internal.PollSignCeremony(db, c_uid, parties[2].PartyID)
+	assert.NoError(t, err)
+	assert.Empty(t, poll.Signers)
+
+	// Joining twice is harmless
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[2].PartyID, 0)
+	assert.NoError(t, err)
+	poll, err = internal.PollSignCeremony(db, c_uid, parties[2].PartyID)
+	assert.NoError(t, err)
+	assert.Empty(t, poll.Signers)
+	assert.Empty(t, poll.OtherParties)
+
+	// The threshold is reached, so the signers are final
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[0].PartyID, 0)
+	assert.NoError(t, err)
+	poll, err = internal.PollSignCeremony(db, c_uid, parties[1].PartyID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{parties[0].PartyID, parties[2].PartyID}, poll.Signers)
+
+	// Latecomers are turned away, but signers can still rejoin
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[1].PartyID, 0)
+	assert.Error(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[0].PartyID, 0)
+	assert.NoError(t, err)
+	poll, err = internal.PollSignCeremony(db, c_uid, parties[0].PartyID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{parties[0].PartyID, parties[2].PartyID}, poll.Signers)
+	assert.Equal(t, []uint16{parties[2].PartyID}, poll.OtherParties)
+}
+
+func TestLeaveSignCeremony(t *testing.T) {
+	db := setupTestDBForSign(t)
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
+	assert.NoError(t, err)
+	var parties []internal.FreeonParticipant
+	for i := 0; i < 3; i++ {
+		p, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+		assert.NoError(t, err)
+		parties = append(parties, p)
+	}
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+
+	// Party 1 joins, then thinks better of it, so its seat goes to whoever turns up next
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[0].PartyID, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, internal.LeaveSignCeremony(db, c_uid, parties[0].PartyID))
+	assert.ErrorIs(t, internal.LeaveSignCeremony(db, c_uid, parties[0].PartyID), internal.ErrNotFound)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[1].PartyID, 0)
+	assert.NoError(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[2].PartyID, 0)
+	assert.NoError(t, err)
+	poll, err := internal.PollSignCeremony(db, c_uid, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{parties[1].PartyID, parties[2].PartyID}, poll.Signers)
+
+	// Once the signers are settled, leaving would only stall the ceremony
+	assert.Error(t, internal.LeaveSignCeremony(db, c_uid, parties[1].PartyID))
+	poll, err = internal.PollSignCeremony(db, c_uid, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{parties[1].PartyID, parties[2].PartyID}, poll.Signers)
+}
+
+func TestPreferredSigners(t *testing.T) {
+	db := setupTestDBForSign(t)
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
+	assert.NoError(t, err)
+	var parties []internal.FreeonParticipant
+	for i := 0; i < 3; i++ {
+		p, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+		assert.NoError(t, err)
+		parties = append(parties, p)
+	}
+
+	// Too few to reach the threshold, duplicates, and strangers are all refused
+	_, err = internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", []uint16{parties[0].PartyID})
+	assert.Error(t, err)
+	_, err = internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", []uint16{parties[0].PartyID, parties[0].PartyID})
+	assert.Error(t, err)
+	_, err = internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", []uint16{parties[0].PartyID, 99})
+	assert.Error(t, err)
+
+	preferred := []uint16{parties[1].PartyID, parties[2].PartyID}
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", preferred)
+	assert.NoError(t, err)
+	c, err := db.GetCeremonyData(c_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, preferred, c.Preferred)
+
+	// Party 1 wasn't chosen
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[0].PartyID, 0)
+	assert.Error(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[2].PartyID, 0)
+	assert.NoError(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), parties[1].PartyID, 0)
+	assert.NoError(t, err)
+
+	poll, err := internal.PollSignCeremony(db, c_uid, parties[0].PartyID)
+	assert.NoError(t, err)
+	assert.Equal(t, preferred, poll.Signers)
 }
 
 func TestAddSignMessage(t *testing.T) {
 	db := setupTestDBForSign(t)
 	g_uid, err := internal.NewKeyGroup(db, 2, 2)
 	assert.NoError(t, err)
-	p, err := internal.AddParticipant(db, g_uid)
+	p, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	other, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
 	assert.NoError(t, err)
-	c_uid, err := internal.NewSignGroup(db, g_uid, "hash", false, "")
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
 	assert.NoError(t, err)
 
-	msg, err := internal.AddSignMessage(db, c_uid, p.PartyID, []byte("test message"))
+	// Nothing gets said until the signers are settled
+	_, err = internal.AddSignMessage(db, c_uid, p.PartyID, testCommitment(p.PartyID))
+	assert.Error(t, err)
+	joinTestSigners(t, db, g_uid, c_uid, p.PartyID, other.PartyID)
+
+	msg, err := internal.AddSignMessage(db, c_uid, p.PartyID, testCommitment(p.PartyID))
 	assert.NoError(t, err)
 	assert.NotZero(t, msg.DbId)
 
-	msgs, err := internal.GetSignMessagesSince(db, c_uid, 0)
+	msgs, err := db.GetSignMessagesSince(c_uid, 0)
 	assert.NoError(t, err)
 	assert.Len(t, msgs, 1)
-	assert.Equal(t, []byte("test message"), msgs[0].Message)
+	assert.Equal(t, testCommitment(p.PartyID), msgs[0].Message)
 }
 
 func TestSetSignature(t *testing.T) {
 	db := setupTestDBForSign(t)
-	g_uid, err := internal.NewKeyGroup(db, 2, 2)
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
 	assert.NoError(t, err)
-	c_uid, err := internal.NewSignGroup(db, g_uid, "hash", false, "")
+	for i := 0; i < 3; i++ {
+		_, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+		assert.NoError(t, err)
+	}
+	pub, secret, err := ed25519.GenerateKey(rand.Reader)
 	assert.NoError(t, err)
+	newCeremony := func() string {
+		c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+		assert.NoError(t, err)
+		return c_uid
+	}
+	c_uid := newCeremony()
+	sig := hex.EncodeToString(ed25519.Sign(secret, testMessage))
+
+	// Only once the signers are settled, and only from one of them
+	assert.Error(t, internal.SetSignature(db, c_uid, 1, sig))
+	joinTestSigners(t, db, g_uid, c_uid, 1, 2)
 
-	err = internal.SetSignature(db, c_uid, "sig")
+	// Nothing to check it against yet
+	assert.Error(t, internal.SetSignature(db, c_uid, 1, sig))
+	assert.NoError(t, internal.SetGroupPublicKey(db, g_uid, hex.EncodeToString(pub)))
+
+	// Signatures over something else, or from another key, are refused, and nobody gets a signature after that
+	_, otherSecret, err := ed25519.GenerateKey(rand.Reader)
 	assert.NoError(t, err)
+	for _, bad := range []string{
+		hex.EncodeToString(ed25519.Sign(secret, []byte("something else"))),
+		hex.EncodeToString(ed25519.Sign(otherSecret, testMessage)),
+		"sig",
+	} {
+		disputed := newCeremony()
+		joinTestSigners(t, db, g_uid, disputed, 1, 2)
+		assert.ErrorIs(t, internal.SetSignature(db, disputed, 2, bad), internal.ErrDisputed)
+		state, err := internal.PollSignCeremony(db, disputed, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, internal.CeremonyStatusDisputed, state.Status)
+		assert.Contains(t, *state.Verdict, "does not verify")
+		assert.Error(t, internal.SetSignature(db, disputed, 1, sig))
+		_, _, err = internal.GetSignature(db, disputed)
+		assert.ErrorIs(t, err, internal.ErrDisputed)
+	}
 
-	c, err := internal.GetCeremonyData(db, c_uid)
+	// A member who isn't signing can't dispute an honest ceremony with garbage
+	assert.ErrorIs(t, internal.SetSignature(db, c_uid, 3, "sig"), internal.ErrUnauthorized)
+	state, err := internal.PollSignCeremony(db, c_uid, 0)
 	assert.NoError(t, err)
-	assert.Equal(t, "sig", *c.Signature)
+	assert.NotEqual(t, internal.CeremonyStatusDisputed, state.Status)
+	assert.Nil(t, state.Verdict)
+
+	err = internal.SetSignature(db, c_uid, 1, sig)
+	assert.NoError(t, err)
+
+	got, verified, err := internal.GetSignature(db, c_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, sig, got)
+	assert.True(t, verified)
 
 	// Cannot set it again
-	err = internal.SetSignature(db, c_uid, "sig2")
+	err = internal.SetSignature(db, c_uid, 2, sig)
+	assert.Error(t, err)
+}
+
+func TestSignProposal(t *testing.T) {
+	db := setupTestDBForSign(t)
+	g_uid, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	p, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	_, err = internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+
+	// Signers bring their own copy unless the proposer shares it
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, true, "git", nil)
+	assert.NoError(t, err)
+	_, err = internal.GetSignProposal(db, c_uid)
+	assert.Error(t, err)
+
+	assert.NoError(t, db.PublishMessage(c_uid))
+	proposal, err := internal.GetSignProposal(db, c_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, testHash(g_uid), proposal.Hash)
+	assert.Equal(t, hex.EncodeToString(testMessage), proposal.Message)
+	assert.Empty(t, proposal.SealedMessage)
+	assert.True(t, proposal.OpenSSH)
+	assert.Equal(t, "git", proposal.Namespace)
+
+	// Sealed messages are handed out as they are, and their signatures can't be checked
+	sealed := []byte("age ciphertext")
+	c_uid, err = internal.NewSealedSignGroup(db, g_uid, testHash(g_uid), sealed, false, "", nil)
+	assert.NoError(t, err)
+	proposal, err = internal.GetSignProposal(db, c_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sealed), proposal.SealedMessage)
+	assert.Empty(t, proposal.Message)
+	joinTestSigners(t, db, g_uid, c_uid, p.PartyID, p.PartyID+1)
+	assert.NoError(t, internal.SetSignature(db, c_uid, p.PartyID, "sig"))
+	sig, verified, err := internal.GetSignature(db, c_uid)
+	assert.NoError(t, err)
+	assert.Equal(t, "sig", sig)
+	assert.False(t, verified)
+
+	_, err = internal.NewSealedSignGroup(db, g_uid, testHash(g_uid), nil, false, "", nil)
 	assert.Error(t, err)
 }
+
+func TestReportBlame(t *testing.T) {
+	db := setupTestDBForSign(t)
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
+	assert.NoError(t, err)
+	p1, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	p2, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	p3, err := internal.AddParticipant(db, g_uid, newTestPublicKey(t))
+	assert.NoError(t, err)
+	c_uid, err := internal.NewSignGroup(db, g_uid, testHash(g_uid), testMessage, false, "", nil)
+	assert.NoError(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), p1.PartyID, 0)
+	assert.NoError(t, err)
+	_, err = internal.JoinSignCeremony(db, c_uid, testHash(g_uid), p2.PartyID, 0)
+	assert.NoError(t, err)
+
+	// Must accuse somebody, who must be a player other than the reporter
+	err = internal.ReportBlame(db, c_uid, p1.PartyID, nil, "invalid signature share")
+	assert.Error(t, err)
+	err = internal.ReportBlame(db, c_uid, p1.PartyID, []uint16{p1.PartyID}, "invalid signature share")
+	assert.Error(t, err)
+	err = internal.ReportBlame(db, c_uid, p1.PartyID, []uint16{p3.PartyID}, "invalid signature share")
+	assert.Error(t, err)
+
+	// Non-players cannot report
+	err = internal.ReportBlame(db, c_uid, p3.PartyID, []uint16{p2.PartyID}, "invalid signature share")
+	assert.Error(t, err)
+
+	// Only for a signature share the accused actually sent
+	_, err = internal.AddSignMessage(db, c_uid, p2.PartyID, testCommitment(p2.PartyID))
+	assert.NoError(t, err)
+	err = internal.ReportBlame(db, c_uid, p1.PartyID, []uint16{p2.PartyID}, "invalid signature share")
+	assert.Error(t, err)
+	_, err = internal.AddSignMessage(db, c_uid, p2.PartyID, testSignatureShare(p2.PartyID))
+	assert.NoError(t, err)
+
+	err = internal.ReportBlame(db, c_uid, p1.PartyID, []uint16{p2.PartyID}, "invalid signature share")
+	assert.NoError(t, err)
+
+	// The ceremony is aborted
+	c, err := db.GetCeremonyData(c_uid)
+	assert.NoError(t, err)
+	assert.False(t, c.Active)
+	err = internal.SetSignature(db, c_uid, p1.PartyID, "sig")
+	assert.Error(t, err)
+
+	blames, err := db.GetCeremonyBlames(c_uid)
+	assert.NoError(t, err)
+	assert.Len(t, blames, 1)
+	assert.Equal(t, p1.PartyID, blames[0].Reporter)
+	assert.Equal(t, p2.PartyID, blames[0].Accused)
+	assert.Equal(t, "invalid signature share", blames[0].Reason)
+
+	// Aborted ceremonies still show up in the list, along with the blame
+	recent, err := db.GetRecentCeremonies(g_uid, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, recent, 1)
+	assert.Len(t, recent[0].Blame, 1)
+}
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The only certificate type we issue. See PROTOCOL.certkeys in the OpenSSH source tree for the format.
+const SSHCertType = "ssh-ed25519-cert-v01@openssh.com"
+
+var errSSHTruncated = errors.New("truncated SSH encoding")
+
+func putSSHString(buf *bytes.Buffer, s []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.Write(s)
+}
+
+// The wire encoding of an Ed25519 public key
+func sshEd25519KeyBlob(pubKey []byte) []byte {
+	var blob bytes.Buffer
+	putSSHString(&blob, []byte("ssh-ed25519"))
+	putSSHString(&blob, pubKey)
+	return blob.Bytes()
+}
+
+// Split off a length-prefixed string
+func readSSHString(buf []byte) ([]byte, []byte, error) {
+	if len(buf) < 4 {
+		return nil, nil, errSSHTruncated
+	}
+	n := binary.BigEndian.Uint32(buf)
+	if uint64(len(buf)-4) < uint64(n) {
+		return nil, nil, errSSHTruncated
+	}
+	return buf[4 : 4+n], buf[4+n:], nil
+}
+
+func readSSHUint(buf []byte, size int) (uint64, []byte, error) {
+	if len(buf) < size {
+		return 0, nil, errSSHTruncated
+	}
+	var n uint64
+	for _, b := range buf[:size] {
+		n = n<<8 | uint64(b)
+	}
+	return n, buf[size:], nil
+}
+
+// Check that a to-be-signed certificate is something the group key can sign: an Ed25519 certificate, with every
+// field present, issued by the group key.
+//
+// What the certificate grants is up to the signers, who see every field before they join.
+func CheckSSHCertificate(tbs []byte, groupKey []byte) error {
+	var field []byte
+	var err error
+	rest := tbs
+
+	field, rest, err = readSSHString(rest)
+	if err != nil {
+		return err
+	}
+	if string(field) != SSHCertType {
+		return fmt.Errorf("unsupported certificate type: %q", field)
+	}
+	// nonce, public key
+	for range 2 {
+		if field, rest, err = readSSHString(rest); err != nil {
+			return err
+		}
+	}
+	if len(field) != ed25519.PublicKeySize {
+		return errors.New("certificate public key is not an Ed25519 key")
+	}
+	// serial, then type
+	if _, rest, err = readSSHUint(rest, 8); err != nil {
+		return err
+	}
+	certType, rest, err := readSSHUint(rest, 4)
+	if err != nil {
+		return err
+	}
+	if certType != 1 && certType != 2 {
+		return fmt.Errorf("unknown certificate type: %d", certType)
+	}
+	// key ID, principals
+	for range 2 {
+		if _, rest, err = readSSHString(rest); err != nil {
+			return err
+		}
+	}
+	validAfter, rest, err := readSSHUint(rest, 8)
+	if err != nil {
+		return err
+	}
+	validBefore, rest, err := readSSHUint(rest, 8)
+	if err != nil {
+		return err
+	}
+	if validAfter >= validBefore {
+		return errors.New("certificate is never valid")
+	}
+	// critical options, extensions, reserved, signature key
+	for range 4 {
+		if field, rest, err = readSSHString(rest); err != nil {
+			return err
+		}
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data after certificate")
+	}
+
+	if !bytes.Equal(field, sshEd25519KeyBlob(groupKey)) {
+		return errors.New("certificate is not issued by this group's key")
+	}
+	return nil
+}
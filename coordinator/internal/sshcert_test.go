@@ -0,0 +1,88 @@
+package internal_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func putTestString(buf *bytes.Buffer, s []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.Write(s)
+}
+
+// A to-be-signed user certificate for a random key, issued by caKey
+func newTestCertificate(caKey []byte, validAfter, validBefore uint64) []byte {
+	subject, _, _ := ed25519.GenerateKey(rand.Reader)
+	var principals, signatureKey, buf bytes.Buffer
+	putTestString(&principals, []byte("deploy"))
+	putTestString(&signatureKey, []byte("ssh-ed25519"))
+	putTestString(&signatureKey, caKey)
+
+	putTestString(&buf, []byte(internal.SSHCertType))
+	putTestString(&buf, make([]byte, 32))
+	putTestString(&buf, subject)
+	binary.Write(&buf, binary.BigEndian, uint64(1))
+	binary.Write(&buf, binary.BigEndian, uint32(1))
+	putTestString(&buf, []byte("test@example.com"))
+	putTestString(&buf, principals.Bytes())
+	binary.Write(&buf, binary.BigEndian, validAfter)
+	binary.Write(&buf, binary.BigEndian, validBefore)
+	putTestString(&buf, nil)
+	putTestString(&buf, nil)
+	putTestString(&buf, nil)
+	putTestString(&buf, signatureKey.Bytes())
+	return buf.Bytes()
+}
+
+func TestCheckSSHCertificate(t *testing.T) {
+	caKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	cert := newTestCertificate(caKey, 0, 1<<63)
+	assert.NoError(t, internal.CheckSSHCertificate(cert, caKey))
+
+	// Issued by somebody else
+	assert.Error(t, internal.CheckSSHCertificate(cert, otherKey))
+	// Truncated, or with extra data
+	assert.Error(t, internal.CheckSSHCertificate(cert[:len(cert)-1], caKey))
+	assert.Error(t, internal.CheckSSHCertificate(append(cert, 0), caKey))
+	// Never valid
+	assert.Error(t, internal.CheckSSHCertificate(newTestCertificate(caKey, 100, 100), caKey))
+}
+
+func TestNewSSHCertCeremony(t *testing.T) {
+	db := setupTestDBForSign(t)
+	g_uid, err := internal.NewKeyGroup(db, 2, 2)
+	assert.NoError(t, err)
+	caKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	cert := newTestCertificate(caKey, 0, 1<<63)
+	hash := internal.HashMessageForSanity(cert, g_uid)
+
+	// Nothing to issue certificates with until key generation is done
+	_, err = internal.NewSSHCertCeremony(db, g_uid, hash, cert, nil)
+	assert.Error(t, err)
+	assert.NoError(t, internal.SetGroupPublicKey(db, g_uid, hex.EncodeToString(caKey)))
+
+	_, err = internal.NewSSHCertCeremony(db, g_uid, "hash", cert, nil)
+	assert.Error(t, err)
+	c_uid, err := internal.NewSSHCertCeremony(db, g_uid, hash, cert, nil)
+	assert.NoError(t, err)
+
+	// Signers get to see the certificate
+	poll, err := internal.PollSignCeremony(db, c_uid, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(cert), poll.SSHCertificate)
+
+	recent, err := db.GetRecentCeremonies(g_uid, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, recent, 1)
+	assert.True(t, recent[0].SSHCertificate)
+	assert.False(t, recent[0].OpenSSH)
+}
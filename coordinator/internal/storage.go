@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Everything the coordinator remembers goes through a Storage.
+//
+// There are three: SQLite (the default), Postgres (for running one coordinator for several teams on a database you
+// already have), and an in-memory one for tests. Which one the coordinator uses depends on the database setting in its
+// config; see OpenStorage.
+//
+// Lookups that find nothing return ErrNotFound. Methods that take one of our own structs (a FreeonGroup, say) only need
+// its DbId to be right, and inserts return the new row's DbId.
+type Storage interface {
+	// Key groups
+	InsertGroup(g FreeonGroup) (int64, error)
+	GetGroupData(groupUid string) (FreeonGroup, error)
+	GetGroupByID(groupID int64) (FreeonGroup, error)
+	FinalizeGroup(g FreeonGroup) error
+	DisputeGroup(g FreeonGroup, verdict string) error
+	AbortGroup(g FreeonGroup, verdict string) error
+	// Move a group from one status to another. ErrNotFound if it doesn't have the first status (or doesn't exist).
+	SetGroupStatus(groupUid, from, to string) error
+	SetGroupDeadline(groupUid string, deadline time.Time) error
+	// Close key generation for every open group whose deadline has passed, and return their IDs
+	ExpireGroups(now time.Time, verdict string) ([]string, error)
+
+	// Participants. Only active participants count as members; see FreeonParticipant.Pending.
+	InsertParticipant(p FreeonParticipant) (int64, error)
+	GetGroupParticipants(groupUid string) ([]FreeonParticipant, error)
+	GetParticipantID(groupUid string, myPartyID uint16) (int64, error)
+	GetParticipantPublicKey(groupUid string, myPartyID uint16) (string, error)
+	// Forget a participant who left before they took part in anything. ErrNotFound if there's no such participant.
+	DeleteParticipant(participantID int64) error
+	// The highest party ID ever handed out in a group, including to participants who have since left
+	GetMaxPartyID(groupUid string) (uint16, error)
+
+	// Signing ceremonies
+	InsertCeremony(c FreeonCeremonies) (int64, error)
+	GetCeremonyData(ceremonyUid string) (FreeonCeremonies, error)
+	// Newest first, with any blame reports attached
+	GetRecentCeremonies(groupUid string, limit, offset int64) ([]FreeonCeremonySummary, error)
+	LockCeremony(c FreeonCeremonies) error
+	// Let signers download a ceremony's message
+	PublishMessage(ceremonyUid string) error
+	// Remember who asked for a ceremony, so signers can see it
+	SetCeremonyProposer(ceremonyUid, proposer string) error
+	FinalizeSignature(c FreeonCeremonies, sig string) error
+	// Close a ceremony whose final signature didn't verify, and say why
+	DisputeCeremony(c FreeonCeremonies, verdict string) error
+	TerminateCeremony(ceremonyUid string) error
+	// Close every active ceremony for a group, and return their IDs
+	CloseCeremonies(groupID int64) ([]string, error)
+	SetCeremonyDeadline(ceremonyUid string, deadline time.Time) error
+	// Close every active ceremony whose deadline has passed, and return their IDs
+	ExpireCeremonies(now time.Time) ([]string, error)
+
+	// Players in a signing ceremony, in the order they joined
+	InsertPlayer(p FreeonPlayers) (int64, error)
+	GetCeremonyPlayers(ceremonyUid string) ([]FreeonPlayers, error)
+	// Take every seat a participant has in a ceremony. ErrNotFound if they don't have one.
+	DeletePlayer(ceremonyUid string, participantID int64) error
+
+	// Message queues. Messages come back oldest first.
+	InsertKeygenMessage(m FreeonKeygenMessage) (int64, error)
+	GetKeygenMessagesSince(groupUid string, lastSeen int64) ([]FreeonKeygenMessage, error)
+	GetKeygenMessagesFrom(groupUid string, partyID uint16) ([]FreeonKeygenMessage, error)
+	InsertSignMessage(m FreeonSignMessage) (int64, error)
+	GetSignMessagesSince(ceremonyUid string, lastSeen int64) ([]FreeonSignMessage, error)
+	InsertRefreshMessage(m FreeonRefreshMessage) (int64, error)
+	GetRefreshMessagesSince(refreshUid string, lastSeen int64) ([]FreeonRefreshMessage, error)
+	InsertReshareMessage(m FreeonReshareMessage) (int64, error)
+	GetReshareMessagesSince(reshareUid string, lastSeen int64) ([]FreeonReshareMessage, error)
+	// Throw away the messages of key groups and ceremonies that expired before the cutoff
+	DeleteExpiredMessages(cutoff time.Time) error
+
+	// Complaints and key confirmations, from the end of key generation
+	InsertComplaint(c FreeonComplaint) (int64, error)
+	// In party ID order
+	GetComplaintReporters(groupUid string) ([]uint16, error)
+	InsertKeyConfirmation(c FreeonKeyConfirmation) (int64, error)
+	// In party ID order
+	GetKeyConfirmations(groupUid string) ([]FreeonKeyConfirmation, error)
+
+	// Blame reports from signing ceremonies, oldest first
+	InsertBlame(b FreeonBlameRecord) (int64, error)
+	GetCeremonyBlames(ceremonyUid string) ([]FreeonBlame, error)
+
+	// Refreshes. Refreshers come back in party ID order.
+	InsertRefresh(r FreeonRefresh) (int64, error)
+	GetOpenRefresh(groupUid string) (FreeonRefresh, error)
+	GetRefreshData(refreshUid string) (FreeonRefresh, error)
+	InsertRefresher(x FreeonRefresher) (int64, error)
+	GetRefreshers(refreshUid string) ([]FreeonRefresher, error)
+	SetRefresherDigest(x FreeonRefresher, digest string) error
+	DeleteRefresher(x FreeonRefresher) error
+	AbortRefresh(r FreeonRefresh, verdict string) error
+	// Mark a refresh as complete, and move its group to the new epoch
+	CompleteRefresh(r FreeonRefresh) error
+
+	// Reshares. Resharers come back in party ID order.
+	InsertReshare(r FreeonReshare) (int64, error)
+	GetOpenReshare(groupUid string) (FreeonReshare, error)
+	GetReshareData(reshareUid string) (FreeonReshare, error)
+	InsertResharer(x FreeonResharer) (int64, error)
+	GetResharers(reshareUid string) ([]FreeonResharer, error)
+	// The identity keys of the newcomers a reshare was proposed for, in the order they were given
+	InsertReshareInvite(reshareID int64, publicKey string) error
+	GetReshareInvites(reshareUid string) ([]string, error)
+	LockReshare(r FreeonReshare) error
+	SetResharerDigest(x FreeonResharer, digest string) error
+	DeleteResharer(x FreeonResharer) error
+	AbortReshare(r FreeonReshare, verdict string) error
+	// Mark a reshare as complete, and hand the group over to its recipients.
+	// Whoever didn't receive a new share is retired; the public key stays the same.
+	CompleteReshare(r FreeonReshare) error
+
+	// Roles. Granting a role twice is fine; revoking one that isn't there is ErrNotFound.
+	InsertMemberRole(groupID int64, partyID uint16, role string) error
+	DeleteMemberRole(groupUid string, partyID uint16, role string) error
+	// In party ID order
+	GetMemberRoles(groupUid string) ([]FreeonMemberRole, error)
+	// Labels are unique within a group, and token hashes are unique everywhere
+	InsertApiToken(groupID int64, t FreeonApiToken, tokenHash string) error
+	DeleteApiToken(groupUid, label string) error
+	// In the order they were issued
+	GetApiTokens(groupUid string) ([]FreeonApiToken, error)
+	GetApiToken(groupUid, tokenHash string) (FreeonApiToken, error)
+
+	// Signed requests. A nonce can only be used once; using it again is ErrReplayed.
+	UseNonce(nonce string, expires time.Time) error
+	// Forget the nonces that are too old to be accepted anyway
+	DeleteExpiredNonces(now time.Time) error
+
+	// Run fn as a single transaction: if it returns an error, none of its changes stick. Concurrent transactions
+	// behave as though they ran one at a time, so fn may run more than once; it shouldn't do anything but talk to
+	// the Storage it's given.
+	Atomically(fn func(tx Storage) error) error
+	Close() error
+}
+
+// What lookups return when there's nothing to find.
+// It's the same error database/sql uses, so the SQL backends can pass theirs through.
+var ErrNotFound = sql.ErrNoRows
+
+// Open the storage named by the database setting in the coordinator's config.
+// postgres:// and postgresql:// URLs are for Postgres, and anything else is the path to a SQLite database.
+func OpenStorage(database string) (Storage, error) {
+	if strings.HasPrefix(database, "postgres://") || strings.HasPrefix(database, "postgresql://") {
+		db, err := sql.Open("pgx", database)
+		if err != nil {
+			return nil, err
+		}
+		return NewPostgresStorage(db)
+	}
+
+	// Open database (creates file if it doesn't exist)
+	db, err := sql.Open("sqlite3", database)
+	if err != nil {
+		return nil, err
+	}
+	// Ensure foreign keys
+	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return NewSQLiteStorage(db)
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// How long a self-signed certificate lasts. Clients pin its public key, which doesn't change when it's renewed.
+const selfSignedLifetime = 5 * 365 * 24 * time.Hour
+
+// The TLS settings for serving the coordinator, or nil to serve plain HTTP
+func (cfg CoordinatorConfig) TLSConfig() (*tls.Config, error) {
+	if cfg.TLSCert == "" && cfg.TLSKey == "" {
+		if cfg.TLSSelfSigned || cfg.ClientCerts || cfg.ClientCA != "" {
+			return nil, errors.New("tls-cert and tls-key are required for TLS")
+		}
+		return nil, nil
+	}
+	if cfg.TLSCert == "" || cfg.TLSKey == "" {
+		return nil, errors.New("tls-cert and tls-key go together")
+	}
+
+	_, certErr := os.Stat(cfg.TLSCert)
+	_, keyErr := os.Stat(cfg.TLSKey)
+	if cfg.TLSSelfSigned && os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		certPEM, keyPEM, err := NewSelfSignedCertificate(cfg.Hostname, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(cfg.TLSKey, keyPEM, 0600); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(cfg.TLSCert, certPEM, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCA != "" {
+		caPEM, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.ClientCA)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = pool
+	} else if cfg.ClientCerts {
+		// Clients certify their own identity keys, so there's no CA to check them against
+		config.ClientAuth = tls.RequestClientCert
+	}
+	return config, nil
+}
+
+// A certificate for the coordinator's hostname, signed by its own key. Returns the certificate and key, PEM-encoded.
+func NewSelfSignedCertificate(hostname string, now time.Time) ([]byte, []byte, error) {
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host = hostname
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// The hex-encoded SHA-256 hash of a certificate's public key, which is what clients pin
+func SPKIHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(hash[:])
+}
+
+// Make sure a client certificate is for the key that signed the request.
+//
+// The handler then checks the same signature against the participant's registered key, so a request only gets through
+// if the TLS session and the participant it claims to come from share an identity key.
+func VerifyClientCertificate(cert *x509.Certificate, path string, body []byte, signature string) error {
+	publicKey, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: client certificates must be for an Ed25519 identity key", ErrUnauthorized)
+	}
+	err := VerifyRequestSignature(hex.EncodeToString(publicKey), path, body, signature)
+	if err != nil {
+		return fmt.Errorf("%w: request was not signed by the client certificate's key", ErrUnauthorized)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSConfig(t *testing.T) {
+	// No certificate, no TLS
+	config, err := internal.CoordinatorConfig{Hostname: "localhost:8462"}.TLSConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+	_, err = internal.CoordinatorConfig{TLSCert: "cert.pem"}.TLSConfig()
+	assert.Error(t, err)
+	_, err = internal.CoordinatorConfig{ClientCerts: true}.TLSConfig()
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	cfg := internal.CoordinatorConfig{
+		Hostname:      "coordinator.example:8462",
+		TLSCert:       filepath.Join(dir, "cert.pem"),
+		TLSKey:        filepath.Join(dir, "key.pem"),
+		TLSSelfSigned: true,
+		ClientCerts:   true,
+	}
+	config, err = cfg.TLSConfig()
+	assert.NoError(t, err)
+	leaf := config.Certificates[0].Leaf
+	assert.Equal(t, []string{"coordinator.example"}, leaf.DNSNames)
+	assert.NoError(t, leaf.VerifyHostname("coordinator.example"))
+
+	// The second time around, the same certificate is loaded rather than replaced
+	again, err := cfg.TLSConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, internal.SPKIHash(leaf), internal.SPKIHash(again.Certificates[0].Leaf))
+
+	// With a client CA, nobody gets in without a certificate it issued
+	_, err = internal.CoordinatorConfig{ClientCA: writeTestCertificate(t, dir, leaf)}.TLSConfig()
+	assert.Error(t, err)
+	cfg.ClientCA = writeTestCertificate(t, dir, leaf)
+	config, err = cfg.TLSConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+	cfg.ClientCA = filepath.Join(dir, "key.pem")
+	_, err = cfg.TLSConfig()
+	assert.ErrorContains(t, err, "no certificates")
+	cfg.ClientCA = ""
+
+	// Without self-signing, missing files are an error
+	cfg.TLSCert = filepath.Join(dir, "missing.pem")
+	cfg.TLSSelfSigned = false
+	_, err = cfg.TLSConfig()
+	assert.Error(t, err)
+}
+
+// Write a certificate out as PEM
+func writeTestCertificate(t *testing.T, dir string, cert *x509.Certificate) string {
+	path := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644))
+	return path
+}
+
+func newTestClientCertificate(t *testing.T, sk ed25519.PrivateKey) *x509.Certificate {
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, sk.Public(), sk)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
+
+func TestVerifyClientCertificate(t *testing.T) {
+	_, sk := newTestKeypair(t)
+	_, other := newTestKeypair(t)
+	cert := newTestClientCertificate(t, sk)
+	body := []byte(`{"ceremony-id":"c_test"}`)
+
+	assert.NoError(t, internal.VerifyClientCertificate(cert, "/sign/join", body, signTestRequest(sk, "/sign/join", body)))
+	// Signed by somebody else
+	err := internal.VerifyClientCertificate(cert, "/sign/join", body, signTestRequest(other, "/sign/join", body))
+	assert.ErrorIs(t, err, internal.ErrUnauthorized)
+}
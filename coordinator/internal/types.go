@@ -6,14 +6,36 @@ type FreeonGroup struct {
 	Participants uint16
 	Threshold    uint16
 	PublicKey    *string
+	Status       string
+	Verdict      *string
+	// Bumped every time the shares are refreshed. Shares from older epochs are useless.
+	Epoch uint64
+	// Unix time by which key generation has to finish, if there's a limit
+	Deadline *int64
 }
 
+// Key group statuses
+const (
+	GroupStatusOpen     = "open"
+	GroupStatusComplete = "complete"
+	GroupStatusAborted  = "aborted"
+	// The parties finished key generation with different public keys
+	GroupStatusDisputed = "disputed"
+	// Key generation didn't finish before its deadline
+	GroupStatusExpired = "expired"
+	// An administrator retired the group
+	GroupStatusArchived = "archived"
+)
+
 type FreeonParticipant struct {
-	DbId    int64
-	GroupID int64
-	Uid     string
-	PartyID uint16
-	State   []byte
+	DbId      int64
+	GroupID   int64
+	Uid       string
+	PartyID   uint16
+	PublicKey string
+	State     []byte
+	// Joined the group through a reshare that isn't complete yet
+	Pending bool
 }
 
 type FreeonKeygenMessage struct {
@@ -23,6 +45,16 @@ type FreeonKeygenMessage struct {
 	Message []byte
 }
 
+// A row in the complaints table.
+// A party with nothing to complain about files a single row with no accused party.
+type FreeonComplaint struct {
+	DbId     int64
+	GroupID  int64
+	Reporter int64
+	Accused  *int64
+	Evidence *string
+}
+
 type FreeonCeremonies struct {
 	DbId             int64
 	GroupID          int64
@@ -32,6 +64,29 @@ type FreeonCeremonies struct {
 	Signature        *string
 	OpenSSH          bool
 	OpenSSHNamespace *string
+	// Hex-encoded to-be-signed OpenSSH certificate, for ceremonies that issue one
+	SSHCertificate *string
+	// Hex-encoded message, so the final signature can be checked
+	Message *string
+	// The group's epoch when the ceremony was created
+	Epoch uint64
+	// If the requester chose who signs, only these parties may join
+	Preferred []uint16
+	// Once enough parties join, nobody else can
+	Locked bool
+	// Unix time by which the ceremony has to finish, if there's a limit
+	Deadline *int64
+	// Closed because it missed its deadline
+	Expired bool
+	// Signers may download the message, rather than bring their own copy
+	Published bool
+	// Hex-encoded age ciphertext of the message, readable by the group's members, for proposers who don't want the
+	// coordinator to see it. Ceremonies with a sealed message have no Message.
+	SealedMessage *string
+	// Who created the ceremony: a member ("party 3"), or an API token by its label
+	Proposer *string
+	// Why the final signature was refused, if it was
+	Verdict *string
 }
 
 // For public lists of signing ceremonies
@@ -42,6 +97,76 @@ type FreeonCeremonySummary struct {
 	Signature        *string
 	OpenSSH          bool
 	OpenSSHNamespace string
+	SSHCertificate   bool
+	Expired          bool
+	Verdict          *string
+	Blame            []FreeonBlame
+}
+
+// A proactive share refresh for a key group.
+// Refreshes use the same statuses as key groups.
+type FreeonRefresh struct {
+	DbId    int64
+	GroupID int64
+	Uid     string
+	// The epoch the group moves to once the refresh is complete
+	Epoch   uint64
+	Status  string
+	Verdict *string
+}
+
+// A holder taking part in a refresh.
+// Digest is set once they confirm the public shares they ended up with.
+type FreeonRefresher struct {
+	DbId          int64
+	RefreshID     int64
+	ParticipantID int64
+	PartyID       uint16
+	Digest        *string
+}
+
+type FreeonRefreshMessage struct {
+	DbId      int64
+	RefreshID int64
+	Sender    int64
+	Message   []byte
+}
+
+// A reshare hands a group's secret to a new set of participants, possibly with a different threshold.
+// Reshares use the same statuses as key groups.
+type FreeonReshare struct {
+	DbId    int64
+	GroupID int64
+	Uid     string
+	// The epoch the group moves to once the reshare is complete
+	Epoch uint64
+	// The new party size and threshold
+	Participants uint16
+	Threshold    uint16
+	// Set once enough dealers and every recipient have joined. Nobody else can join after that.
+	Locked  bool
+	Status  string
+	Verdict *string
+}
+
+// Someone taking part in a reshare.
+// Dealers are current holders, recipients get a share of the new group. A holder who stays on is both.
+type FreeonResharer struct {
+	DbId          int64
+	ReshareID     int64
+	ParticipantID int64
+	PartyID       uint16
+	PublicKey     string
+	Dealer        bool
+	Recipient     bool
+	Digest        *string
+}
+
+type FreeonReshareMessage struct {
+	DbId      int64
+	ReshareID int64
+	Sender    int64
+	Message   []byte
 }
 
 type FreeonPlayers struct {
@@ -51,6 +176,31 @@ type FreeonPlayers struct {
 	PartyID       uint16
 }
 
+// A row in the keyconfirmations table
+type FreeonKeyConfirmation struct {
+	DbId        int64
+	GroupID     int64
+	Participant int64
+	PartyID     uint16
+	PublicKey   string
+}
+
+// A row in the blames table
+type FreeonBlameRecord struct {
+	DbId       int64
+	CeremonyID int64
+	Reporter   int64
+	Accused    int64
+	Reason     string
+}
+
+// A blame report, as shown to clients
+type FreeonBlame struct {
+	Reporter uint16 `json:"reporter"`
+	Accused  uint16 `json:"accused"`
+	Reason   string `json:"reason"`
+}
+
 type FreeonSignMessage struct {
 	DbId       int64
 	CeremonyID int64
@@ -63,4 +213,92 @@ type PollSignResponse struct {
 	MyPartyID    uint16   `json:"party-id"`
 	Threshold    uint16   `json:"t"`
 	OtherParties []uint16 `json:"parties"`
+	// Only shares from this epoch can sign
+	Epoch uint64 `json:"epoch"`
+	// The to-be-signed certificate, hex-encoded, if this ceremony issues one
+	SSHCertificate string `json:"ssh-certificate,omitempty"`
+	// Exactly who signs, once enough parties have joined. Empty until then.
+	Signers []uint16 `json:"signers"`
+	// If the requester chose who may sign
+	Preferred []uint16 `json:"preferred,omitempty"`
+	// One of the ceremony statuses below
+	Status string `json:"status"`
+	// Why the ceremony is disputed
+	Verdict *string `json:"verdict,omitempty"`
+	// Seconds left before the ceremony expires, while it's still open
+	ExpiresIn *int64 `json:"expires-in,omitempty"`
+	// Who created the ceremony, if the coordinator knows
+	Proposer string `json:"proposer,omitempty"`
+	// What kind of signature the ceremony produces, for signers to review before they join
+	OpenSSH   bool   `json:"openssh"`
+	Namespace string `json:"openssh-namespace,omitempty"`
+}
+
+// What a signing ceremony was asked to sign, for signers who didn't bring their own copy.
+// Exactly one of Message and SealedMessage is set, both hex-encoded.
+type SignProposal struct {
+	Hash          string `json:"hash"`
+	Message       string `json:"message,omitempty"`
+	SealedMessage string `json:"sealed-message,omitempty"`
+	OpenSSH       bool   `json:"openssh"`
+	Namespace     string `json:"openssh-namespace,omitempty"`
+}
+
+// Signing ceremony statuses
+const (
+	CeremonyStatusOpen     = "open"
+	CeremonyStatusComplete = "complete"
+	CeremonyStatusExpired  = "expired"
+	// The final signature didn't verify
+	CeremonyStatusDisputed = "disputed"
+	// Terminated, or aborted because someone misbehaved
+	CeremonyStatusClosed = "closed"
+)
+
+type PollRefreshResponse struct {
+	RefreshID string   `json:"refresh-id"`
+	GroupID   string   `json:"group-id"`
+	Epoch     uint64   `json:"epoch"`
+	Threshold uint16   `json:"t"`
+	PartySize uint16   `json:"n"`
+	Parties   []uint16 `json:"parties"`
+	// How many holders have confirmed their new public shares
+	Confirmed uint16  `json:"confirmed"`
+	Status    string  `json:"status"`
+	Verdict   *string `json:"verdict,omitempty"`
+}
+
+type PollReshareResponse struct {
+	ReshareID string `json:"reshare-id"`
+	GroupID   string `json:"group-id"`
+	PublicKey string `json:"public-key"`
+	Epoch     uint64 `json:"epoch"`
+	// The current threshold, which is how many dealers are needed
+	OldThreshold uint16   `json:"old-t"`
+	Threshold    uint16   `json:"t"`
+	PartySize    uint16   `json:"n"`
+	Dealers      []uint16 `json:"dealers"`
+	Recipients   []uint16 `json:"recipients"`
+	// The identity keys of the newcomers the reshare was proposed for
+	Newcomers []string `json:"newcomers,omitempty"`
+	// Each dealer's and recipient's identity key, by party ID
+	IdentityKeys map[uint16]string `json:"identity-keys,omitempty"`
+	Locked       bool              `json:"locked"`
+	// How many participants have confirmed the new public shares
+	Confirmed uint16  `json:"confirmed"`
+	Status    string  `json:"status"`
+	Verdict   *string `json:"verdict,omitempty"`
+}
+
+// A role given to one of a group's members
+type FreeonMemberRole struct {
+	PartyID uint16
+	Role    string
+}
+
+// An API token, minus the token itself
+type FreeonApiToken struct {
+	Label   string
+	Role    string
+	Created int64
 }
@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha512"
 	"encoding/hex"
+	"strconv"
+	"strings"
 )
 
 // We aren't using UUIDs here because they only have 126 bits of entropy
@@ -14,3 +18,35 @@ func UniqueID() (string, error) {
 	}
 	return hex.EncodeToString(b), nil
 }
+
+// The same message hash the client computes, for the few messages the coordinator gets to see
+func HashMessageForSanity(data []byte, groupID string) string {
+	key := sha512.Sum384([]byte(groupID))
+	mac := hmac.New(sha512.New384, key[:])
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Party IDs are stored as a comma-separated list, e.g. "1,3,4"
+func EncodePartyList(parties []uint16) string {
+	encoded := make([]string, 0, len(parties))
+	for _, p := range parties {
+		encoded = append(encoded, strconv.FormatUint(uint64(p), 10))
+	}
+	return strings.Join(encoded, ",")
+}
+
+func DecodePartyList(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var parties []uint16
+	for _, field := range strings.Split(s, ",") {
+		p, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		parties = append(parties, uint16(p))
+	}
+	return parties, nil
+}
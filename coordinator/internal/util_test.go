@@ -19,3 +19,17 @@ func TestUniqueID(t *testing.T) {
 	// These should never be equal
 	assert.NotEqual(t, id1, id2)
 }
+
+func TestPartyList(t *testing.T) {
+	assert.Equal(t, "1,3,4", internal.EncodePartyList([]uint16{1, 3, 4}))
+	parties, err := internal.DecodePartyList("1,3,4")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 3, 4}, parties)
+
+	parties, err = internal.DecodePartyList("")
+	assert.NoError(t, err)
+	assert.Empty(t, parties)
+
+	_, err = internal.DecodePartyList("1,70000")
+	assert.Error(t, err)
+}
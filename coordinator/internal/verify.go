@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const sshsigBegin = "-----BEGIN SSH SIGNATURE-----"
+const sshsigEnd = "-----END SSH SIGNATURE-----"
+
+// Check a final signature against the group's public key before accepting it.
+//
+// Which format to expect depends on the ceremony: a certificate for certificate ceremonies, an armored SSHSIG for
+// OpenSSH ceremonies, and hex-encoded R || z otherwise.
+func VerifyCeremonySignature(group FreeonGroup, ceremony FreeonCeremonies, sig string) error {
+	if group.PublicKey == nil {
+		return errors.New("group has no public key")
+	}
+	groupKey, err := hex.DecodeString(*group.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	var signedData, rawSig []byte
+	switch {
+	case ceremony.SSHCertificate != nil:
+		tbs, err := hex.DecodeString(*ceremony.SSHCertificate)
+		if err != nil {
+			return err
+		}
+		rawSig, err = unwrapSSHCertificate(sig, tbs)
+		if err != nil {
+			return err
+		}
+		signedData = tbs
+	case ceremony.Message == nil:
+		return errors.New("ceremony has no message to verify the signature against")
+	case ceremony.OpenSSH:
+		message, err := hex.DecodeString(*ceremony.Message)
+		if err != nil {
+			return err
+		}
+		namespace := ""
+		if ceremony.OpenSSHNamespace != nil {
+			namespace = *ceremony.OpenSSHNamespace
+		}
+		rawSig, err = unwrapSSHSIG(sig, groupKey, namespace)
+		if err != nil {
+			return err
+		}
+		signedData = sshsigSignedData(namespace, message)
+	default:
+		signedData, err = hex.DecodeString(*ceremony.Message)
+		if err != nil {
+			return err
+		}
+		rawSig, err = hex.DecodeString(sig)
+		if err != nil {
+			return fmt.Errorf("invalid signature encoding: %w", err)
+		}
+	}
+
+	if len(rawSig) != ed25519.SignatureSize || !ed25519.Verify(groupKey, signedData, rawSig) {
+		return errors.New("signature does not verify under the group's public key")
+	}
+	return nil
+}
+
+// What an SSHSIG signature covers. See PROTOCOL.sshsig in the OpenSSH source tree.
+func sshsigSignedData(namespace string, message []byte) []byte {
+	h := sha512.Sum512(message)
+	var buf bytes.Buffer
+	buf.WriteString("SSHSIG")
+	putSSHString(&buf, []byte(namespace))
+	putSSHString(&buf, nil)
+	putSSHString(&buf, []byte("sha512"))
+	putSSHString(&buf, h[:])
+	return buf.Bytes()
+}
+
+// Get the raw Ed25519 signature out of an ssh-ed25519 signature blob
+func readSSHEd25519Signature(blob []byte) ([]byte, error) {
+	sigType, rest, err := readSSHString(blob)
+	if err != nil {
+		return nil, err
+	}
+	rawSig, rest, err := readSSHString(rest)
+	if err != nil {
+		return nil, err
+	}
+	if string(sigType) != "ssh-ed25519" || len(rest) != 0 {
+		return nil, errors.New("not an Ed25519 signature")
+	}
+	return rawSig, nil
+}
+
+// Parse an armored SSHSIG signature, checking that it is for the group key and the ceremony's namespace
+func unwrapSSHSIG(armored string, groupKey []byte, namespace string) ([]byte, error) {
+	text := strings.TrimSpace(armored)
+	if !strings.HasPrefix(text, sshsigBegin) || !strings.HasSuffix(text, sshsigEnd) {
+		return nil, errors.New("not an SSH signature")
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, sshsigBegin), sshsigEnd)
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH signature encoding: %w", err)
+	}
+	if !bytes.HasPrefix(raw, []byte("SSHSIG\x00\x00\x00\x01")) {
+		return nil, errors.New("not a version 1 SSH signature")
+	}
+
+	// public key, namespace, reserved, hash algorithm, signature
+	fields := make([][]byte, 5)
+	rest := raw[10:]
+	for i := range fields {
+		if fields[i], rest, err = readSSHString(rest); err != nil {
+			return nil, err
+		}
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after SSH signature")
+	}
+	if !bytes.Equal(fields[0], sshEd25519KeyBlob(groupKey)) {
+		return nil, errors.New("SSH signature is not from the group's key")
+	}
+	if string(fields[1]) != namespace {
+		return nil, fmt.Errorf("SSH signature namespace is %q, not %q", fields[1], namespace)
+	}
+	if string(fields[3]) != "sha512" {
+		return nil, fmt.Errorf("unexpected SSH signature hash algorithm: %q", fields[3])
+	}
+	return readSSHEd25519Signature(fields[4])
+}
+
+// Parse a signed certificate line, checking that it is the certificate the signers agreed to
+func unwrapSSHCertificate(line string, tbs []byte) ([]byte, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != SSHCertType {
+		return nil, errors.New("not an OpenSSH certificate")
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate encoding: %w", err)
+	}
+	if !bytes.HasPrefix(blob, tbs) {
+		return nil, errors.New("certificate differs from the one the signers agreed to")
+	}
+	sigBlob, rest, err := readSSHString(blob[len(tbs):])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after certificate")
+	}
+	return readSSHEd25519Signature(sigBlob)
+}
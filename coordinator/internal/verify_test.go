@@ -0,0 +1,74 @@
+package internal_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSSHEd25519Blob(name string, data []byte) []byte {
+	var buf bytes.Buffer
+	putTestString(&buf, []byte(name))
+	putTestString(&buf, data)
+	return buf.Bytes()
+}
+
+// An armored SSHSIG signature, as ssh-keygen -Y sign would produce
+func newTestSSHSIG(pub ed25519.PublicKey, secret ed25519.PrivateKey, namespace string, message []byte) string {
+	h := sha512.Sum512(message)
+	var signed bytes.Buffer
+	signed.WriteString("SSHSIG")
+	putTestString(&signed, []byte(namespace))
+	putTestString(&signed, nil)
+	putTestString(&signed, []byte("sha512"))
+	putTestString(&signed, h[:])
+
+	var blob bytes.Buffer
+	blob.WriteString("SSHSIG\x00\x00\x00\x01")
+	putTestString(&blob, testSSHEd25519Blob("ssh-ed25519", pub))
+	putTestString(&blob, []byte(namespace))
+	putTestString(&blob, nil)
+	putTestString(&blob, []byte("sha512"))
+	putTestString(&blob, testSSHEd25519Blob("ssh-ed25519", ed25519.Sign(secret, signed.Bytes())))
+	return "-----BEGIN SSH SIGNATURE-----\n" + base64.StdEncoding.EncodeToString(blob.Bytes()) + "\n-----END SSH SIGNATURE-----\n"
+}
+
+func TestVerifyCeremonySignature(t *testing.T) {
+	pub, secret, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	otherPub, otherSecret, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	groupKey := hex.EncodeToString(pub)
+	group := internal.FreeonGroup{PublicKey: &groupKey}
+	message := hex.EncodeToString(testMessage)
+	namespace := "git"
+
+	// SSHSIG signatures have to be from the group key, in the ceremony's namespace
+	sshsig := internal.FreeonCeremonies{Message: &message, OpenSSH: true, OpenSSHNamespace: &namespace}
+	assert.NoError(t, internal.VerifyCeremonySignature(group, sshsig, newTestSSHSIG(pub, secret, "git", testMessage)))
+	assert.Error(t, internal.VerifyCeremonySignature(group, sshsig, newTestSSHSIG(pub, secret, "file", testMessage)))
+	assert.Error(t, internal.VerifyCeremonySignature(group, sshsig, newTestSSHSIG(pub, secret, "git", []byte("other"))))
+	assert.Error(t, internal.VerifyCeremonySignature(group, sshsig, newTestSSHSIG(otherPub, otherSecret, "git", testMessage)))
+	assert.Error(t, internal.VerifyCeremonySignature(group, sshsig, hex.EncodeToString(ed25519.Sign(secret, testMessage))))
+
+	// Certificates have to be the one the signers agreed to
+	tbs := newTestCertificate(pub, 0, 1<<63)
+	tbsHex := hex.EncodeToString(tbs)
+	cert := internal.FreeonCeremonies{SSHCertificate: &tbsHex}
+	encode := func(tbs []byte, secret ed25519.PrivateKey) string {
+		var buf bytes.Buffer
+		buf.Write(tbs)
+		putTestString(&buf, testSSHEd25519Blob("ssh-ed25519", ed25519.Sign(secret, tbs)))
+		return internal.SSHCertType + " " + base64.StdEncoding.EncodeToString(buf.Bytes()) + " alice"
+	}
+	assert.NoError(t, internal.VerifyCeremonySignature(group, cert, encode(tbs, secret)))
+	assert.Error(t, internal.VerifyCeremonySignature(group, cert, encode(tbs, otherSecret)))
+	assert.Error(t, internal.VerifyCeremonySignature(group, cert, encode(newTestCertificate(pub, 0, 1<<63), secret)))
+}
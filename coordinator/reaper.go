@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/soatok/freeon/coordinator/internal"
+)
+
+// How often to look for ceremonies that have missed their deadlines
+const reapInterval = time.Minute
+
+// Close expired ceremonies for as long as the coordinator runs
+func reapExpired(retention time.Duration) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		expired, err := internal.ReapExpired(db, time.Now(), retention)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reaper: %s\n", err.Error())
+		}
+		// Let anyone still waiting know it's over
+		for _, id := range expired {
+			events.Notify(id)
+		}
+		<-ticker.C
+	}
+}
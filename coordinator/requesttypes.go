@@ -12,13 +12,20 @@ type ResponseErrorPage struct {
 type InitKeyGenRequest struct {
 	Participants uint16 `json:"n"`
 	Threshold    uint16 `json:"t"`
+	// How many seconds key generation may take. Zero means the coordinator's default.
+	Deadline int64 `json:"deadline,omitempty"`
 }
 type InitKeyGenResponse struct {
 	GroupID string `json:"group-id"`
 }
 
 type JoinKeyGenRequest struct {
-	GroupID string `json:"group-id"`
+	GroupID   string `json:"group-id"`
+	PublicKey string `json:"public-key"`
+}
+type LeaveKeyGenRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
 }
 type JoinKeyGenResponse struct {
 	Status    bool   `json:"status"`
@@ -35,6 +42,132 @@ type PollKeyGenResponse struct {
 	OtherParties []uint16 `json:"parties"`
 	Threshold    uint16   `json:"t"`
 	PartySize    uint16   `json:"n"`
+	Status       string   `json:"status"`
+	Verdict      *string  `json:"verdict,omitempty"`
+	// How many parties have filed a complaint report, and who
+	Reports   uint16   `json:"reports"`
+	Reporters []uint16 `json:"reporters"`
+	// Who has confirmed the group public key
+	Confirmed []uint16 `json:"confirmed"`
+	Epoch     uint64   `json:"epoch"`
+	// Seconds left before key generation expires, while it's still open
+	ExpiresIn *int64 `json:"expires-in,omitempty"`
+	// Each participant's identity key, by party ID, for sealing messages to the group
+	IdentityKeys map[uint16]string `json:"identity-keys,omitempty"`
+}
+
+type KeygenComplaintRequest struct {
+	GroupID   string   `json:"group-id"`
+	MyPartyID uint16   `json:"party-id"`
+	Accused   []uint16 `json:"accused"`
+	// The complainer's ephemeral age identity for this ceremony
+	Evidence string `json:"evidence,omitempty"`
+}
+
+type RefreshJoinRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	// The epoch of the share being refreshed
+	Epoch uint64 `json:"epoch"`
+}
+type RefreshJoinResponse struct {
+	RefreshID string `json:"refresh-id"`
+	Epoch     uint64 `json:"epoch"`
+}
+
+type PollRefreshRequest struct {
+	RefreshID string `json:"refresh-id"`
+}
+
+type RefreshMessageRequest struct {
+	RefreshID string `json:"refresh-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Message   string `json:"message"`
+	LastSeen  int64  `json:"last-seen"`
+}
+type RefreshMessageResponse struct {
+	LatestMessageID int64    `json:"last-seen"`
+	Messages        []string `json:"messages"`
+}
+
+type RefreshConfirmRequest struct {
+	RefreshID string `json:"refresh-id"`
+	MyPartyID uint16 `json:"party-id"`
+	// Hash of the new public shares, which every holder must agree on
+	Digest string `json:"digest"`
+}
+
+type RefreshLeaveRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+}
+
+type RefreshAbortRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Reason    string `json:"reason"`
+}
+
+type InitReshareRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	// The new party size and threshold
+	Participants uint16 `json:"n"`
+	Threshold    uint16 `json:"t"`
+	// Hex-encoded identity keys of the newcomers who may join to receive a share
+	Newcomers []string `json:"newcomers,omitempty"`
+}
+type InitReshareResponse struct {
+	ReshareID string `json:"reshare-id"`
+}
+
+type ReshareJoinRequest struct {
+	GroupID string `json:"group-id"`
+	// Zero for newcomers, who register PublicKey instead
+	MyPartyID uint16 `json:"party-id"`
+	PublicKey string `json:"public-key,omitempty"`
+	// The epoch of the share being dealt, for current holders
+	Epoch uint64 `json:"epoch"`
+	// Whether we want a share of the new group
+	Receive bool `json:"receive"`
+}
+type ReshareJoinResponse struct {
+	ReshareID string `json:"reshare-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Epoch     uint64 `json:"epoch"`
+}
+
+type PollReshareRequest struct {
+	ReshareID string `json:"reshare-id"`
+}
+
+type ReshareMessageRequest struct {
+	ReshareID string `json:"reshare-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Message   string `json:"message"`
+	LastSeen  int64  `json:"last-seen"`
+}
+type ReshareMessageResponse struct {
+	LatestMessageID int64    `json:"last-seen"`
+	Messages        []string `json:"messages"`
+}
+
+type ReshareConfirmRequest struct {
+	ReshareID string `json:"reshare-id"`
+	MyPartyID uint16 `json:"party-id"`
+	// Hash of the new public shares, which every participant must agree on
+	Digest string `json:"digest"`
+}
+
+type ReshareLeaveRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+}
+
+type ReshareAbortRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id"`
+	Reason    string `json:"reason"`
 }
 
 type KeyGenMessageRequest struct {
@@ -51,8 +184,22 @@ type KeyGenMessageResponse struct {
 type InitSignRequest struct {
 	GroupID     string `json:"group-id"`
 	MessageHash string `json:"hash"`
-	OpenSSH     bool   `json:"openssh"`
-	Namespace   string `json:"openssh-namespace"`
+	// Hex-encoded message, so the coordinator can check the final signature
+	Message   string `json:"message"`
+	OpenSSH   bool   `json:"openssh"`
+	Namespace string `json:"openssh-namespace"`
+	// Hex-encoded to-be-signed OpenSSH certificate, to issue a certificate instead of signing a message
+	SSHCertificate string `json:"ssh-certificate,omitempty"`
+	// Only these parties may sign, if any are given. The first threshold-many of them to join are the signers.
+	Signers []uint16 `json:"signers,omitempty"`
+	// How many seconds the ceremony may take. Zero means the coordinator's default.
+	Deadline int64 `json:"deadline,omitempty"`
+	// Members propose as themselves, signing the request. Anyone else needs an API token.
+	MyPartyID *uint16 `json:"party-id,omitempty"`
+	// Let signers download the message, so they don't need their own copy
+	Publish bool `json:"publish,omitempty"`
+	// Hex-encoded age ciphertext of the message, sealed to the group's members, instead of the message itself
+	SealedMessage string `json:"sealed-message,omitempty"`
 }
 type InitSignResponse struct {
 	CeremonyID string `json:"ceremony-id"`
@@ -71,6 +218,7 @@ type JoinSignRequest struct {
 	CeremonyID  string `json:"ceremony-id"`
 	MessageHash string `json:"hash"`
 	MyPartyID   uint16 `json:"party-id"`
+	Epoch       uint64 `json:"epoch"`
 }
 type JoinSignResponse struct {
 	Status    bool   `json:"status"`
@@ -78,11 +226,20 @@ type JoinSignResponse struct {
 	Namespace string `json:"openssh-namespace"`
 }
 
+type LeaveSignRequest struct {
+	CeremonyID string `json:"ceremony-id"`
+	MyPartyID  uint16 `json:"party-id"`
+}
+
 type PollSignRequest struct {
 	CeremonyID string  `json:"ceremony-id"`
 	PartyID    *uint16 `json:"party-id"`
 }
 
+type GetProposalRequest struct {
+	CeremonyID string `json:"ceremony-id"`
+}
+
 type SignMessageRequest struct {
 	CeremonyID string `json:"ceremony-id"`
 	MyPartyID  uint16 `json:"party-id"`
@@ -112,10 +269,27 @@ type GetSignRequest struct {
 
 type GetSignResponse struct {
 	Signature string `json:"signature"`
+	// The message was sealed, so we couldn't check the signature
+	Unverified bool                   `json:"unverified,omitempty"`
+	Blame      []internal.FreeonBlame `json:"blame,omitempty"`
 }
 
+type BlameRequest struct {
+	CeremonyID string   `json:"ceremony-id"`
+	MyPartyID  uint16   `json:"party-id"`
+	Accused    []uint16 `json:"accused"`
+	Reason     string   `json:"reason"`
+}
+
+// Administrators either sign these as a member, or send an API token instead of a party ID
 type TerminateRequest struct {
 	CeremonyID string `json:"ceremony-id"`
+	MyPartyID  uint16 `json:"party-id,omitempty"`
+}
+
+type ArchiveRequest struct {
+	GroupID   string `json:"group-id"`
+	MyPartyID uint16 `json:"party-id,omitempty"`
 }
 
 type VapidResponse struct {
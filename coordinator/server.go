@@ -1,23 +1,28 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
-	_ "github.com/ncruces/go-sqlite3/driver"
-	_ "github.com/ncruces/go-sqlite3/embed"
 	"github.com/soatok/freeon/coordinator/internal"
 )
 
 var sessionManager *scs.SessionManager
-var db *sql.DB
+var db internal.Storage
+
+// Time limits for new ceremonies, from the config
+var deadlines internal.Deadlines
+
+// Wakes up event streams when a ceremony changes
+var events = internal.NewEventHub()
 
 // The Coordinator starts here
 func main() {
@@ -27,22 +32,32 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Database
-	// Open database (creates file if it doesn't exist)
-	db, err = sql.Open("sqlite3", serverConfig.Database)
+	// Database (a SQLite database is created if it doesn't exist)
+	db, err = internal.OpenStorage(serverConfig.Database)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s", err.Error())
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	// Ensure foreign keys
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	// `coordinator admin ...` manages roles instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		code := runAdmin(os.Args[2:])
+		db.Close()
+		os.Exit(code)
+	}
+
+	deadlines, err = serverConfig.Deadlines()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		os.Exit(1)
+	}
+	tlsConfig, err := serverConfig.TLSConfig()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s", err.Error())
 		os.Exit(1)
 	}
-	internal.DbEnsureTablesExist(db)
+	go reapExpired(deadlines.Retention)
 
 	// Session storage
 	sessionManager = scs.New()
@@ -52,34 +67,105 @@ func main() {
 
 	http.HandleFunc("/keygen/create", createKeygen)
 	http.HandleFunc("/keygen/join", joinKeygen)
+	http.HandleFunc("/keygen/leave", leaveKeygen)
 	http.HandleFunc("/keygen/poll", pollKeygen)
 	http.HandleFunc("/keygen/send", sendKeygen)
 	http.HandleFunc("/keygen/get-messages", getKeygenMessages)
+	http.HandleFunc("/keygen/complaint", complainKeygen)
 	http.HandleFunc("/keygen/finalize", finalizeKeygen)
+	http.HandleFunc("/keygen/events", keygenEvents)
+
+	http.HandleFunc("/keygen/refresh/join", joinRefresh)
+	http.HandleFunc("/keygen/refresh/leave", leaveRefresh)
+	http.HandleFunc("/keygen/refresh/poll", pollRefresh)
+	http.HandleFunc("/keygen/refresh/send", sendRefresh)
+	http.HandleFunc("/keygen/refresh/get-messages", getRefreshMessages)
+	http.HandleFunc("/keygen/refresh/confirm", confirmRefresh)
+	http.HandleFunc("/keygen/refresh/abort", abortRefresh)
+	http.HandleFunc("/keygen/refresh/events", refreshEvents)
+
+	http.HandleFunc("/keygen/reshare/create", createReshare)
+	http.HandleFunc("/keygen/reshare/join", joinReshare)
+	http.HandleFunc("/keygen/reshare/leave", leaveReshare)
+	http.HandleFunc("/keygen/reshare/poll", pollReshare)
+	http.HandleFunc("/keygen/reshare/send", sendReshare)
+	http.HandleFunc("/keygen/reshare/get-messages", getReshareMessages)
+	http.HandleFunc("/keygen/reshare/confirm", confirmReshare)
+	http.HandleFunc("/keygen/reshare/abort", abortReshare)
+	http.HandleFunc("/keygen/reshare/events", reshareEvents)
 
 	http.HandleFunc("/sign/create", createSign)
 	http.HandleFunc("/sign/list", listSign)
 	http.HandleFunc("/sign/join", joinSign)
+	http.HandleFunc("/sign/leave", leaveSign)
 	http.HandleFunc("/sign/poll", pollSign)
+	http.HandleFunc("/sign/proposal", getProposal)
 	http.HandleFunc("/sign/send", sendSign)
 	http.HandleFunc("/sign/get-messages", getSignMessages)
 	http.HandleFunc("/sign/finalize", finalizeSign)
 	http.HandleFunc("/sign/get", getSign)
+	http.HandleFunc("/sign/blame", blameSign)
+	http.HandleFunc("/sign/events", signEvents)
 
 	http.HandleFunc("/terminate", terminateSign)
-	http.ListenAndServe(serverConfig.Hostname, sessionManager.LoadAndSave(http.DefaultServeMux))
+	http.HandleFunc("/archive", archiveGroup)
+
+	handler := bindClientCertificates(sessionManager.LoadAndSave(http.DefaultServeMux))
+	if tlsConfig == nil {
+		err = http.ListenAndServe(serverConfig.Hostname, handler)
+	} else {
+		// Clients that pin our certificate need to know what to pin
+		leaf := tlsConfig.Certificates[0].Leaf
+		fmt.Printf("Serving HTTPS. SPKI pin: %s\n", internal.SPKIHash(leaf))
+		server := &http.Server{
+			Addr:      serverConfig.Hostname,
+			Handler:   handler,
+			TLSConfig: tlsConfig,
+		}
+		err = server.ListenAndServeTLS("", "")
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+	os.Exit(1)
 }
 
 // Handler for error pages
 func sendError(w http.ResponseWriter, e error) {
 	// TODO - not disclose this once the code is stable!
 	response := ResponseErrorPage{Error: e.Error()}
-	w.WriteHeader(http.StatusInternalServerError)
+	if errors.Is(e, internal.ErrUnauthorized) {
+		w.WriteHeader(http.StatusForbidden)
+	} else if errors.Is(e, internal.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
 	h := w.Header()
 	h.Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// Read and decode a JSON request body.
+// The raw bytes are returned so the caller can check the request signature against them.
+func readRequest(r *http.Request, req any) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// The API token a request was sent with, if any
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
 // Handler for index page
 func indexPage(w http.ResponseWriter, r *http.Request) {
 	response := ResponseMainPage{Message: "Freeon Coordinator v0.0.0"}
@@ -99,11 +185,20 @@ func createKeygen(w http.ResponseWriter, r *http.Request) {
 		sendError(w, errors.New("threshold cannot exceeed party size"))
 		return
 	}
+	deadline, err := deadlines.For(req.Deadline)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
 	uid, err := internal.NewKeyGroup(db, req.Participants, req.Threshold)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	if err := db.SetGroupDeadline(uid, time.Now().Add(deadline)); err != nil {
+		sendError(w, err)
+		return
+	}
 	response := InitKeyGenResponse{
 		GroupID: uid,
 	}
@@ -114,16 +209,24 @@ func createKeygen(w http.ResponseWriter, r *http.Request) {
 // Join a key ceremony as a participant
 func joinKeygen(w http.ResponseWriter, r *http.Request) {
 	var req JoinKeyGenRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	body, err := readRequest(r, &req)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	participant, err := internal.AddParticipant(db, req.GroupID)
+	// Proof of possession for the key being registered
+	err = internal.AuthenticateRequest(db, req.PublicKey, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	participant, err := internal.AddParticipant(db, req.GroupID, req.PublicKey)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.GroupID)
+
 	response := JoinKeyGenResponse{
 		Status:    true,
 		MyPartyID: participant.PartyID,
@@ -133,6 +236,33 @@ func joinKeygen(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// Give up our seat in a keygen ceremony we joined
+func leaveKeygen(w http.ResponseWriter, r *http.Request) {
+	var req LeaveKeyGenRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.LeaveKeyGen(db, req.GroupID, req.MyPartyID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.GroupID)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // Poll a keygen ceremony to get the status
 func pollKeygen(w http.ResponseWriter, r *http.Request) {
 	var req PollKeyGenRequest
@@ -141,41 +271,76 @@ func pollKeygen(w http.ResponseWriter, r *http.Request) {
 		sendError(w, err)
 		return
 	}
-	group, err := internal.GetGroupData(db, req.GroupID)
+	response, err := getKeygenState(req.GroupID, req.PartyID)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	participants, err := internal.GetGroupParticipants(db, req.GroupID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// The state of a keygen ceremony, from the point of view of one party (if given)
+func getKeygenState(groupID string, partyID *uint16) (PollKeyGenResponse, error) {
+	group, err := db.GetGroupData(groupID)
 	if err != nil {
-		sendError(w, err)
-		return
+		return PollKeyGenResponse{}, err
+	}
+	participants, err := db.GetGroupParticipants(groupID)
+	if err != nil {
+		return PollKeyGenResponse{}, err
 	}
 
 	// Assemble list of "others"
 	var others []uint16
-	if req.PartyID == nil {
+	if partyID == nil {
 		for _, p := range participants {
 			others = append(others, p.PartyID)
 		}
 	} else {
 		for _, p := range participants {
-			if p.PartyID != *req.PartyID {
+			if p.PartyID != *partyID {
 				others = append(others, p.PartyID)
 			}
 		}
 	}
+	identityKeys := make(map[uint16]string)
+	for _, p := range participants {
+		identityKeys[p.PartyID] = p.PublicKey
+	}
+
+	reporters, err := db.GetComplaintReporters(groupID)
+	if err != nil {
+		return PollKeyGenResponse{}, err
+	}
+	confirmations, err := db.GetKeyConfirmations(groupID)
+	if err != nil {
+		return PollKeyGenResponse{}, err
+	}
+	var confirmed []uint16
+	for _, c := range confirmations {
+		confirmed = append(confirmed, c.PartyID)
+	}
 
 	response := PollKeyGenResponse{
 		GroupID:      group.Uid,
-		MyPartyID:    req.PartyID,
+		MyPartyID:    partyID,
 		OtherParties: others,
 		Threshold:    group.Threshold,
 		PartySize:    group.Participants,
+		Status:       group.Status,
+		Verdict:      group.Verdict,
+		Reports:      uint16(len(reporters)),
+		Reporters:    reporters,
+		Confirmed:    confirmed,
+		Epoch:        group.Epoch,
+		IdentityKeys: identityKeys,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if group.Status == internal.GroupStatusOpen {
+		response.ExpiresIn = internal.SecondsLeft(group.Deadline, time.Now())
+	}
+	return response, nil
 }
 
 // Get messages for a keygen ceremony
@@ -186,7 +351,7 @@ func getKeygenMessages(w http.ResponseWriter, r *http.Request) {
 		sendError(w, err)
 		return
 	}
-	inbox, err := internal.GetKeygenMessagesSince(db, req.GroupID, req.LastSeen)
+	inbox, err := db.GetKeygenMessagesSince(req.GroupID, req.LastSeen)
 	if err != nil {
 		sendError(w, err)
 		return
@@ -213,7 +378,12 @@ func getKeygenMessages(w http.ResponseWriter, r *http.Request) {
 // Send a message to participate in a keygen ceremony
 func sendKeygen(w http.ResponseWriter, r *http.Request) {
 	var req KeyGenMessageRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	if err != nil {
 		sendError(w, err)
 		return
@@ -230,10 +400,11 @@ func sendKeygen(w http.ResponseWriter, r *http.Request) {
 		sendError(w, err)
 		return
 	}
+	events.Notify(req.GroupID)
 
 	// Now, get all messages since the client's last seen ID.
 	// This will include the message we just added, and any from other clients.
-	inbox, err := internal.GetKeygenMessagesSince(db, req.GroupID, req.LastSeen)
+	inbox, err := db.GetKeygenMessagesSince(req.GroupID, req.LastSeen)
 	if err != nil {
 		sendError(w, err)
 		return
@@ -257,164 +428,161 @@ func sendKeygen(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&response)
 }
 
-// Create a signing ceremony
-func createSign(w http.ResponseWriter, r *http.Request) {
-	var req InitSignRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+// Join (or start) a proactive refresh of a group's shares
+func joinRefresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshJoinRequest
+	body, err := readRequest(r, &req)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	uid, err := internal.NewSignGroup(db, req.GroupID, req.MessageHash, req.OpenSSH, req.Namespace)
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	response := InitSignResponse{
-		CeremonyID: uid,
+	refresh, err := internal.JoinRefresh(db, req.GroupID, req.MyPartyID, req.Epoch)
+	if err != nil {
+		sendError(w, err)
+		return
 	}
+	events.Notify(refresh.Uid)
 
+	response := RefreshJoinResponse{
+		RefreshID: refresh.Uid,
+		Epoch:     refresh.Epoch,
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// Join an existing signing ceremony
-func joinSign(w http.ResponseWriter, r *http.Request) {
-	var req JoinSignRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+// Give up our seat in a refresh we joined
+func leaveRefresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshLeaveRequest
+	body, err := readRequest(r, &req)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	_, err = internal.JoinSignCeremony(db, req.CeremonyID, req.MessageHash, req.MyPartyID)
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	response := JoinSignResponse{
-		Status: true,
+	refresh, err := internal.LeaveRefresh(db, req.GroupID, req.MyPartyID)
+	if err != nil {
+		sendError(w, err)
+		return
 	}
+	events.Notify(refresh.Uid)
 
+	response := VapidResponse{
+		Status: "OK",
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// Poll the status of a signing ceremony
-func pollSign(w http.ResponseWriter, r *http.Request) {
-	var req PollSignRequest
+// Poll the status of a refresh
+func pollRefresh(w http.ResponseWriter, r *http.Request) {
+	var req PollRefreshRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	var partyID uint16 = 0
-	if req.PartyID != nil {
-		partyID = *req.PartyID
-	}
-	response, err := internal.PollSignCeremony(db, req.CeremonyID, partyID)
+	response, err := internal.PollRefresh(db, req.RefreshID)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(&response)
-
+	json.NewEncoder(w).Encode(response)
 }
 
-// Get messages for a signing ceremony
-func getSignMessages(w http.ResponseWriter, r *http.Request) {
-	var req SignMessageRequest
+// Get messages for a refresh
+func getRefreshMessages(w http.ResponseWriter, r *http.Request) {
+	var req RefreshMessageRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	inbox, err := internal.GetSignMessagesSince(db, req.CeremonyID, req.LastSeen)
+	inbox, err := db.GetRefreshMessagesSince(req.RefreshID, req.LastSeen)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	// Get a new maximum
-	var max = req.LastSeen
+	var latestID = req.LastSeen
 	var messages []string
 	for _, m := range inbox {
-		if m.DbId >= max {
-			max = m.DbId
-		}
 		messages = append(messages, hex.EncodeToString(m.Message))
+		if m.DbId > latestID {
+			latestID = m.DbId
+		}
 	}
 
-	// Let's queue up the messages
-	response := SignMessageResponse{
-		LatestMessageID: max,
+	response := RefreshMessageResponse{
+		LatestMessageID: latestID,
 		Messages:        messages,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// Send a message to a signing ceremony
-func sendSign(w http.ResponseWriter, r *http.Request) {
-	var req SignMessageRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+// Send a message to participate in a refresh
+func sendRefresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshMessageRequest
+	body, err := readRequest(r, &req)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	msg, err := hex.DecodeString(req.Message)
+	err = internal.AuthenticateRefreshParticipant(db, req.RefreshID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-
-	// First, add the new message to the database.
-	_, err = internal.AddSignMessage(db, req.CeremonyID, req.MyPartyID, msg)
+	msg, err := hex.DecodeString(req.Message)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-
-	// Now, get all messages since the client's last seen ID.
-	inbox, err := internal.GetSignMessagesSince(db, req.CeremonyID, req.LastSeen)
+	_, err = internal.AddRefreshMessage(db, req.RefreshID, req.MyPartyID, msg)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	events.Notify(req.RefreshID)
 
-	// Build the response
-	var latestID = req.LastSeen
-	var messages []string
-	for _, m := range inbox {
-		messages = append(messages, hex.EncodeToString(m.Message))
-		if m.DbId > latestID {
-			latestID = m.DbId
-		}
-	}
-
-	response := SignMessageResponse{
-		LatestMessageID: latestID,
-		Messages:        messages,
+	response := VapidResponse{
+		Status: "OK",
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(&response)
+	json.NewEncoder(w).Encode(response)
 }
 
-// Store the final public key for the group
-func finalizeKeygen(w http.ResponseWriter, r *http.Request) {
-	var req KeygenFinalRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+// Confirm the public shares a holder computed at the end of a refresh
+func confirmRefresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshConfirmRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateRefreshParticipant(db, req.RefreshID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	err = internal.SetGroupPublicKey(db, req.GroupID, req.PublicKey)
+	err = internal.ConfirmRefresh(db, req.RefreshID, req.MyPartyID, req.Digest)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	events.Notify(req.RefreshID)
 
-	// Return a vapid response.
 	response := VapidResponse{
 		Status: "OK",
 	}
@@ -422,100 +590,763 @@ func finalizeKeygen(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// Store the final signature for the ceremony
-func finalizeSign(w http.ResponseWriter, r *http.Request) {
-	var req SignFinalRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+// Abort the refresh in progress for a group
+func abortRefresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshAbortRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	err = internal.SetSignature(db, req.CeremonyID, req.Signature)
+	refresh, err := internal.CancelRefresh(db, req.GroupID, req.MyPartyID, req.Reason)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	events.Notify(refresh.Uid)
 
-	// Return a vapid response.
 	response := VapidResponse{
 		Status: "OK",
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-
 }
 
-// List the receent signing ceremonies for a given key group
-func listSign(w http.ResponseWriter, r *http.Request) {
-	var req ListSignRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+// Propose a reshare for a group
+func createReshare(w http.ResponseWriter, r *http.Request) {
+	var req InitReshareRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	uid, err := internal.NewReshare(db, req.GroupID, req.MyPartyID, req.Participants, req.Threshold, req.Newcomers)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
 
-	var limit int64
-	var offset int64
+	response := InitReshareResponse{
+		ReshareID: uid,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-	// Default values
-	if req.Limit == nil {
-		limit = 10
-	} else {
-		limit = *req.Limit
+// Join the reshare in progress for a group, as a current holder or a newcomer
+func joinReshare(w http.ResponseWriter, r *http.Request) {
+	var req ReshareJoinRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
 	}
-	if req.Offset == nil {
-		offset = 0
+	if req.MyPartyID == 0 {
+		// Proof of possession for the key being registered
+		err = internal.AuthenticateRequest(db, req.PublicKey, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	} else {
-		offset = *req.Offset
+		err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
 	}
-
-	list, err := internal.GetRecentCeremonies(db, req.GroupID, limit, offset)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	reshare, myPartyID, err := internal.JoinReshare(db, req.GroupID, req.MyPartyID, req.PublicKey, req.Epoch, req.Receive)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(reshare.Uid)
 
-	// Return a vapid response.
-	response := ListSignResponse{
-		Ceremonies: list,
+	response := ReshareJoinResponse{
+		ReshareID: reshare.Uid,
+		MyPartyID: myPartyID,
+		Epoch:     reshare.Epoch,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func getSign(w http.ResponseWriter, r *http.Request) {
-	var req GetSignRequest
+// Poll the status of a reshare
+func pollReshare(w http.ResponseWriter, r *http.Request) {
+	var req PollReshareRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
-	signature, err := internal.GetSignature(db, req.CeremonyID)
+	response, err := internal.PollReshare(db, req.ReshareID)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
 
-	response := GetSignResponse{
-		Signature: signature,
-	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func terminateSign(w http.ResponseWriter, r *http.Request) {
-	var req TerminateRequest
+// Get messages for a reshare
+func getReshareMessages(w http.ResponseWriter, r *http.Request) {
+	var req ReshareMessageRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	inbox, err := db.GetReshareMessagesSince(req.ReshareID, req.LastSeen)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	var latestID = req.LastSeen
+	var messages []string
+	for _, m := range inbox {
+		messages = append(messages, hex.EncodeToString(m.Message))
+		if m.DbId > latestID {
+			latestID = m.DbId
+		}
+	}
 
-	err = internal.TerminateCeremony(db, req.CeremonyID)
+	response := ReshareMessageResponse{
+		LatestMessageID: latestID,
+		Messages:        messages,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Send a message to participate in a reshare
+func sendReshare(w http.ResponseWriter, r *http.Request) {
+	var req ReshareMessageRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateReshareParticipant(db, req.ReshareID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	msg, err := hex.DecodeString(req.Message)
 	if err != nil {
 		sendError(w, err)
 		return
 	}
+	_, err = internal.AddReshareMessage(db, req.ReshareID, req.MyPartyID, msg)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.ReshareID)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Confirm the public shares a participant computed at the end of a reshare
+func confirmReshare(w http.ResponseWriter, r *http.Request) {
+	var req ReshareConfirmRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateReshareParticipant(db, req.ReshareID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.ConfirmReshare(db, req.ReshareID, req.MyPartyID, req.Digest)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.ReshareID)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Give up our seat in a reshare we joined
+func leaveReshare(w http.ResponseWriter, r *http.Request) {
+	var req ReshareLeaveRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	// Newcomers aren't members yet, so they're only known to the reshare
+	reshare, err := db.GetOpenReshare(req.GroupID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateReshareParticipant(db, reshare.Uid, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	reshare, err = internal.LeaveReshare(db, req.GroupID, req.MyPartyID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(reshare.Uid)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Abort the reshare in progress for a group.
+// Current holders can do this whether or not they've joined it; newcomers only once they have.
+func abortReshare(w http.ResponseWriter, r *http.Request) {
+	var req ReshareAbortRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	signature := r.Header.Get(internal.SignatureHeader)
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, signature)
+	if err != nil {
+		if reshare, openErr := db.GetOpenReshare(req.GroupID); openErr == nil {
+			err = internal.AuthenticateReshareParticipant(db, reshare.Uid, req.MyPartyID, r.URL.Path, body, signature)
+		}
+	}
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	reshare, err := internal.CancelReshare(db, req.GroupID, req.MyPartyID, req.Reason)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(reshare.Uid)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Create a signing ceremony
+func createSign(w http.ResponseWriter, r *http.Request) {
+	var req InitSignRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	proposer, err := internal.AuthorizeProposer(db, req.GroupID, req.MyPartyID, bearerToken(r), r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	deadline, err := deadlines.For(req.Deadline)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	var uid string
+	if req.SSHCertificate != "" {
+		if req.OpenSSH {
+			sendError(w, errors.New("certificates can't be signed in the SSHSIG format"))
+			return
+		}
+		var certificate []byte
+		certificate, err = hex.DecodeString(req.SSHCertificate)
+		if err != nil {
+			sendError(w, err)
+			return
+		}
+		uid, err = internal.NewSSHCertCeremony(db, req.GroupID, req.MessageHash, certificate, req.Signers)
+	} else if req.SealedMessage != "" {
+		if req.Message != "" || req.Publish {
+			sendError(w, errors.New("a sealed message can't be sent or published in the clear"))
+			return
+		}
+		var sealed []byte
+		sealed, err = hex.DecodeString(req.SealedMessage)
+		if err != nil {
+			sendError(w, err)
+			return
+		}
+		uid, err = internal.NewSealedSignGroup(db, req.GroupID, req.MessageHash, sealed, req.OpenSSH, req.Namespace, req.Signers)
+	} else {
+		var message []byte
+		message, err = hex.DecodeString(req.Message)
+		if err != nil {
+			sendError(w, err)
+			return
+		}
+		uid, err = internal.NewSignGroup(db, req.GroupID, req.MessageHash, message, req.OpenSSH, req.Namespace, req.Signers)
+		if err == nil && req.Publish {
+			err = db.PublishMessage(uid)
+		}
+	}
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if err := db.SetCeremonyDeadline(uid, time.Now().Add(deadline)); err != nil {
+		sendError(w, err)
+		return
+	}
+	if err := db.SetCeremonyProposer(uid, proposer); err != nil {
+		sendError(w, err)
+		return
+	}
+	response := InitSignResponse{
+		CeremonyID: uid,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Join an existing signing ceremony
+func joinSign(w http.ResponseWriter, r *http.Request) {
+	var req JoinSignRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateCeremonyParticipant(db, req.CeremonyID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	_, err = internal.JoinSignCeremony(db, req.CeremonyID, req.MessageHash, req.MyPartyID, req.Epoch)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.CeremonyID)
+
+	// Signers need to know what format to produce, since OpenSSH signatures cover different data
+	ceremony, err := db.GetCeremonyData(req.CeremonyID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	response := JoinSignResponse{
+		Status:  true,
+		OpenSSH: ceremony.OpenSSH,
+	}
+	if ceremony.OpenSSHNamespace != nil {
+		response.Namespace = *ceremony.OpenSSHNamespace
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Give up our seat in a signing ceremony we joined
+func leaveSign(w http.ResponseWriter, r *http.Request) {
+	var req LeaveSignRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateCeremonyParticipant(db, req.CeremonyID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.LeaveSignCeremony(db, req.CeremonyID, req.MyPartyID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.CeremonyID)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Poll the status of a signing ceremony
+func pollSign(w http.ResponseWriter, r *http.Request) {
+	var req PollSignRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	var partyID uint16 = 0
+	if req.PartyID != nil {
+		partyID = *req.PartyID
+	}
+	response, err := internal.PollSignCeremony(db, req.CeremonyID, partyID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+
+}
+
+// Hand out the message a ceremony was asked to sign, if the proposer published or sealed it
+func getProposal(w http.ResponseWriter, r *http.Request) {
+	var req GetProposalRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	response, err := internal.GetSignProposal(db, req.CeremonyID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+}
+
+// Get messages for a signing ceremony
+func getSignMessages(w http.ResponseWriter, r *http.Request) {
+	var req SignMessageRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	inbox, err := db.GetSignMessagesSince(req.CeremonyID, req.LastSeen)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	// Get a new maximum
+	var max = req.LastSeen
+	var messages []string
+	for _, m := range inbox {
+		if m.DbId >= max {
+			max = m.DbId
+		}
+		messages = append(messages, hex.EncodeToString(m.Message))
+	}
+
+	// Let's queue up the messages
+	response := SignMessageResponse{
+		LatestMessageID: max,
+		Messages:        messages,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Send a message to a signing ceremony
+func sendSign(w http.ResponseWriter, r *http.Request) {
+	var req SignMessageRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateCeremonyParticipant(db, req.CeremonyID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	msg, err := hex.DecodeString(req.Message)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	// First, add the new message to the database.
+	_, err = internal.AddSignMessage(db, req.CeremonyID, req.MyPartyID, msg)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.CeremonyID)
+
+	// Now, get all messages since the client's last seen ID.
+	inbox, err := db.GetSignMessagesSince(req.CeremonyID, req.LastSeen)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	// Build the response
+	var latestID = req.LastSeen
+	var messages []string
+	for _, m := range inbox {
+		messages = append(messages, hex.EncodeToString(m.Message))
+		if m.DbId > latestID {
+			latestID = m.DbId
+		}
+	}
+
+	response := SignMessageResponse{
+		LatestMessageID: latestID,
+		Messages:        messages,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+}
+
+// File a complaint report after checking round 2 shares
+func complainKeygen(w http.ResponseWriter, r *http.Request) {
+	var req KeygenComplaintRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.FileComplaint(db, req.GroupID, req.MyPartyID, req.Accused, req.Evidence)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.GroupID)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Store the final public key for the group
+func finalizeKeygen(w http.ResponseWriter, r *http.Request) {
+	var req KeygenFinalRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateParticipant(db, req.GroupID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.ConfirmGroupPublicKey(db, req.GroupID, req.MyPartyID, req.PublicKey)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.GroupID)
+
+	// Return a vapid response.
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Store the final signature for the ceremony
+func finalizeSign(w http.ResponseWriter, r *http.Request) {
+	var req SignFinalRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateCeremonyParticipant(db, req.CeremonyID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.SetSignature(db, req.CeremonyID, req.MyPartyID, req.Signature)
+	if errors.Is(err, internal.ErrDisputed) {
+		// Nobody is getting a signature, so don't leave them waiting for one
+		events.Notify(req.CeremonyID)
+	}
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.CeremonyID)
+
+	// Return a vapid response.
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+}
+
+// List the receent signing ceremonies for a given key group
+func listSign(w http.ResponseWriter, r *http.Request) {
+	var req ListSignRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	var limit int64
+	var offset int64
+
+	// Default values
+	if req.Limit == nil {
+		limit = 10
+	} else {
+		limit = *req.Limit
+	}
+	if req.Offset == nil {
+		offset = 0
+	} else {
+		offset = *req.Offset
+	}
+
+	list, err := db.GetRecentCeremonies(req.GroupID, limit, offset)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	// Return a vapid response.
+	response := ListSignResponse{
+		Ceremonies: list,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func getSign(w http.ResponseWriter, r *http.Request) {
+	var req GetSignRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	blame, err := db.GetCeremonyBlames(req.CeremonyID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	signature, verified, err := internal.GetSignature(db, req.CeremonyID)
+	// An aborted ceremony has no signature, but the blame report is still worth returning
+	if err != nil && len(blame) == 0 {
+		sendError(w, err)
+		return
+	}
+
+	response := GetSignResponse{
+		Signature:  signature,
+		Unverified: signature != "" && !verified,
+		Blame:      blame,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Report the parties that sent invalid signature shares, aborting the ceremony
+func blameSign(w http.ResponseWriter, r *http.Request) {
+	var req BlameRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthenticateCeremonyParticipant(db, req.CeremonyID, req.MyPartyID, r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.ReportBlame(db, req.CeremonyID, req.MyPartyID, req.Accused, req.Reason)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.CeremonyID)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func terminateSign(w http.ResponseWriter, r *http.Request) {
+	var req TerminateRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthorizeCeremonyAdmin(db, req.CeremonyID, req.MyPartyID, bearerToken(r), r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	err = db.TerminateCeremony(req.CeremonyID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.CeremonyID)
+
+	response := VapidResponse{
+		Status: "OK",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Retire a key group, closing any ceremonies it still has open
+func archiveGroup(w http.ResponseWriter, r *http.Request) {
+	var req ArchiveRequest
+	body, err := readRequest(r, &req)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	err = internal.AuthorizeAdmin(db, req.GroupID, req.MyPartyID, bearerToken(r), r.URL.Path, body, r.Header.Get(internal.SignatureHeader))
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+
+	closed, err := internal.ArchiveGroup(db, req.GroupID)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	events.Notify(req.GroupID)
+	for _, uid := range closed {
+		events.Notify(uid)
+	}
 
 	response := VapidResponse{
 		Status: "OK",
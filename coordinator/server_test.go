@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/soatok/freeon/coordinator/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Post a request signed the way clients sign them, straight to a handler
+func postSignedTo(t *testing.T, handler http.HandlerFunc, path string, sk ed25519.PrivateKey, req any) *httptest.ResponseRecorder {
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	nonceHex := hex.EncodeToString(nonce)
+	now := time.Now().Unix()
+	sig := ed25519.Sign(sk, internal.RequestSigningPayload(path, now, nonceHex, body))
+
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	r.Header.Set(internal.SignatureHeader, fmt.Sprintf("%d.%s.%s", now, nonceHex, hex.EncodeToString(sig)))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestFinalizeSignFromOutsider(t *testing.T) {
+	db = internal.NewMemoryStorage()
+	defer db.Close()
+
+	// A 2-of-3 group where parties 1 and 2 sign, and party 3 sits it out
+	g_uid, err := internal.NewKeyGroup(db, 3, 2)
+	require.NoError(t, err)
+	var keys []ed25519.PrivateKey
+	for i := 0; i < 3; i++ {
+		pk, sk, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		_, err = internal.AddParticipant(db, g_uid, hex.EncodeToString(pk))
+		require.NoError(t, err)
+		keys = append(keys, sk)
+	}
+	groupKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, internal.SetGroupPublicKey(db, g_uid, hex.EncodeToString(groupKey)))
+	message := []byte("release v1.2.3")
+	hash := internal.HashMessageForSanity(message, g_uid)
+	c_uid, err := internal.NewSignGroup(db, g_uid, hash, message, false, "", nil)
+	require.NoError(t, err)
+	for _, id := range []uint16{1, 2} {
+		_, err := internal.JoinSignCeremony(db, c_uid, hash, id, 0)
+		require.NoError(t, err)
+	}
+
+	// Party 3's garbage is turned away, rather than disputing the ceremony
+	w := postSignedTo(t, finalizeSign, "/sign/finalize", keys[2], SignFinalRequest{CeremonyID: c_uid, MyPartyID: 3, Signature: "garbage"})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	ceremony, err := db.GetCeremonyData(c_uid)
+	require.NoError(t, err)
+	assert.True(t, ceremony.Active)
+	assert.Nil(t, ceremony.Verdict)
+	assert.Nil(t, ceremony.Signature)
+}
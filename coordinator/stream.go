@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/soatok/freeon/coordinator/internal"
+)
+
+// How often to send a comment down an idle stream, so proxies don't hang up on it
+const keepaliveInterval = 15 * time.Second
+
+// Read the optional party-id and last-seen parameters for an event stream.
+// A reconnecting EventSource sends Last-Event-ID instead of last-seen.
+func streamParameters(r *http.Request) (*uint16, int64, error) {
+	q := r.URL.Query()
+	var partyID *uint16
+	if p := q.Get("party-id"); p != "" {
+		id, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid party-id: %w", err)
+		}
+		id16 := uint16(id)
+		partyID = &id16
+	}
+
+	var lastSeen int64
+	last := q.Get("last-seen")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		last = id
+	}
+	if last != "" {
+		var err error
+		lastSeen, err = strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid last-seen: %w", err)
+		}
+	}
+	return partyID, lastSeen, nil
+}
+
+// A protocol message to push down a stream
+type streamMessage struct {
+	ID      int64
+	Message []byte
+}
+
+// Write a single Server-Sent Event
+func writeEvent(w http.ResponseWriter, id string, event string, data []byte) {
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+// Push new protocol messages and state changes down a stream until the client goes away.
+//
+// Each message is sent as a "message" event, with its ID as the event ID. Whenever the state of the ceremony (as
+// returned by the poll endpoint) changes, it is sent as a "state" event.
+func streamEvents(w http.ResponseWriter, r *http.Request, topic string, lastSeen int64, fetch func(lastSeen int64) ([]streamMessage, any, error)) {
+	wakeup, unsubscribe := events.Subscribe(topic)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	var lastState []byte
+	for {
+		messages, state, err := fetch(lastSeen)
+		if err != nil {
+			writeEvent(w, "", "error", []byte(strconv.Quote(err.Error())))
+			rc.Flush()
+			return
+		}
+		for _, m := range messages {
+			writeEvent(w, strconv.FormatInt(m.ID, 10), "message", []byte(hex.EncodeToString(m.Message)))
+			if m.ID > lastSeen {
+				lastSeen = m.ID
+			}
+		}
+		stateJSON, err := json.Marshal(state)
+		if err == nil && !bytes.Equal(stateJSON, lastState) {
+			writeEvent(w, "", "state", stateJSON)
+			lastState = stateJSON
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wakeup:
+		case <-keepalive.C:
+			fmt.Fprintf(w, ": keepalive\n\n")
+		}
+	}
+}
+
+// Stream events for a keygen ceremony
+func keygenEvents(w http.ResponseWriter, r *http.Request) {
+	groupID := r.URL.Query().Get("group-id")
+	partyID, lastSeen, err := streamParameters(r)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if _, err := db.GetGroupData(groupID); err != nil {
+		sendError(w, err)
+		return
+	}
+
+	streamEvents(w, r, groupID, lastSeen, func(lastSeen int64) ([]streamMessage, any, error) {
+		inbox, err := db.GetKeygenMessagesSince(groupID, lastSeen)
+		if err != nil {
+			return nil, nil, err
+		}
+		var messages []streamMessage
+		for _, m := range inbox {
+			messages = append(messages, streamMessage{ID: m.DbId, Message: m.Message})
+		}
+		state, err := getKeygenState(groupID, partyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return messages, state, nil
+	})
+}
+
+// Stream events for a signing ceremony
+func signEvents(w http.ResponseWriter, r *http.Request) {
+	ceremonyID := r.URL.Query().Get("ceremony-id")
+	partyID, lastSeen, err := streamParameters(r)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	var myPartyID uint16 = 0
+	if partyID != nil {
+		myPartyID = *partyID
+	}
+	if _, err := db.GetCeremonyData(ceremonyID); err != nil {
+		sendError(w, err)
+		return
+	}
+
+	streamEvents(w, r, ceremonyID, lastSeen, func(lastSeen int64) ([]streamMessage, any, error) {
+		inbox, err := db.GetSignMessagesSince(ceremonyID, lastSeen)
+		if err != nil {
+			return nil, nil, err
+		}
+		var messages []streamMessage
+		for _, m := range inbox {
+			messages = append(messages, streamMessage{ID: m.DbId, Message: m.Message})
+		}
+		state, err := internal.PollSignCeremony(db, ceremonyID, myPartyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return messages, state, nil
+	})
+}
+
+// Stream events for a refresh
+func refreshEvents(w http.ResponseWriter, r *http.Request) {
+	refreshID := r.URL.Query().Get("refresh-id")
+	_, lastSeen, err := streamParameters(r)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if _, err := db.GetRefreshData(refreshID); err != nil {
+		sendError(w, err)
+		return
+	}
+
+	streamEvents(w, r, refreshID, lastSeen, func(lastSeen int64) ([]streamMessage, any, error) {
+		inbox, err := db.GetRefreshMessagesSince(refreshID, lastSeen)
+		if err != nil {
+			return nil, nil, err
+		}
+		var messages []streamMessage
+		for _, m := range inbox {
+			messages = append(messages, streamMessage{ID: m.DbId, Message: m.Message})
+		}
+		state, err := internal.PollRefresh(db, refreshID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return messages, state, nil
+	})
+}
+
+// Stream events for a reshare
+func reshareEvents(w http.ResponseWriter, r *http.Request) {
+	reshareID := r.URL.Query().Get("reshare-id")
+	_, lastSeen, err := streamParameters(r)
+	if err != nil {
+		sendError(w, err)
+		return
+	}
+	if _, err := db.GetReshareData(reshareID); err != nil {
+		sendError(w, err)
+		return
+	}
+
+	streamEvents(w, r, reshareID, lastSeen, func(lastSeen int64) ([]streamMessage, any, error) {
+		inbox, err := db.GetReshareMessagesSince(reshareID, lastSeen)
+		if err != nil {
+			return nil, nil, err
+		}
+		var messages []streamMessage
+		for _, m := range inbox {
+			messages = append(messages, streamMessage{ID: m.DbId, Message: m.Message})
+		}
+		state, err := internal.PollReshare(db, reshareID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return messages, state, nil
+	})
+}
@@ -1,26 +1,34 @@
 package main_test
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/ed25519"
-	"database/sql"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"math/big"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"filippo.io/age"
-	_ "github.com/ncruces/go-sqlite3/driver"
-	_ "github.com/ncruces/go-sqlite3/embed"
 	"github.com/soatok/freeon/coordinator/internal"
 	"github.com/stretchr/testify/require"
 )
@@ -71,9 +79,10 @@ func getExePath(path string) string {
 
 // coordinator holds the state of a coordinator instance
 type coordinator struct {
-	db       *sql.DB
+	db       internal.Storage
 	proc     *os.Process
 	hostname string
+	config   string
 }
 
 // client holds the state of a client instance
@@ -87,6 +96,12 @@ type client struct {
 // startCoordinator starts a new coordinator instance on a random port
 func startCoordinator(t *testing.T) *coordinator {
 	t.Helper()
+	return startCoordinatorWith(t, nil)
+}
+
+// startCoordinatorWith starts a coordinator with extra settings in its config file
+func startCoordinatorWith(t *testing.T, settings map[string]any) *coordinator {
+	t.Helper()
 
 	// Create a temporary directory for the coordinator's database
 	dir, err := os.MkdirTemp("", "freeon-coordinator-test")
@@ -94,14 +109,9 @@ func startCoordinator(t *testing.T) *coordinator {
 	t.Cleanup(func() { os.RemoveAll(dir) })
 
 	dbFile := filepath.Join(dir, "database.sqlite")
-	db, err := sql.Open("sqlite3", dbFile)
+	db, err := internal.OpenStorage(dbFile)
 	require.NoError(t, err)
 
-	// Ensure foreign keys
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
-	require.NoError(t, err)
-	internal.DbEnsureTablesExist(db)
-
 	// Find an available port
 	port, err := findAvailablePort()
 	require.NoError(t, err)
@@ -110,14 +120,15 @@ func startCoordinator(t *testing.T) *coordinator {
 	// Create a temporary config file for the coordinator
 	configFile, err := os.CreateTemp("", "freeon-coordinator-config-*.json")
 	require.NoError(t, err)
-	defer os.Remove(configFile.Name())
+	t.Cleanup(func() { os.Remove(configFile.Name()) })
 
-	f, err := os.OpenFile(configFile.Name(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	require.NoError(t, err)
-	dbFileForJson := strings.ReplaceAll(dbFile, `\`, `\\`)
-	_, err = f.WriteString(fmt.Sprintf(`{"hostname": "%s", "database": "%s"}`, hostname, dbFileForJson))
+	config := map[string]any{"hostname": hostname, "database": dbFile}
+	for k, v := range settings {
+		config[k] = v
+	}
+	configJSON, err := json.Marshal(config)
 	require.NoError(t, err)
-	f.Close()
+	require.NoError(t, os.WriteFile(configFile.Name(), configJSON, 0644))
 
 	// Start the coordinator
 	cmd := exec.Command(coordinatorBinPath)
@@ -135,9 +146,20 @@ func startCoordinator(t *testing.T) *coordinator {
 		db:       db,
 		proc:     cmd.Process,
 		hostname: hostname,
+		config:   configFile.Name(),
 	}
 }
 
+// admin runs a `coordinator admin` command against the coordinator's database
+func (c *coordinator) admin(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := exec.Command(coordinatorBinPath, append([]string{"admin"}, args...)...)
+	cmd.Env = append(os.Environ(), "FREEON_COORDINATOR_CONFIG="+c.config)
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
 // stop stops the coordinator instance
 func (c *coordinator) stop(t *testing.T) {
 	t.Helper()
@@ -172,14 +194,107 @@ func newClient(t *testing.T) *client {
 // run runs a freeon client command
 func (c *client) run(t *testing.T, args ...string) (string, error) {
 	t.Helper()
+	return c.runWith(t, nil, args...)
+}
+
+// runWith runs a freeon client command with the given standard input, and with FREEON_IDENTITY set
+func (c *client) runWith(t *testing.T, stdin []byte, args ...string) (string, error) {
+	t.Helper()
 
 	cmd := exec.Command(clientBinPath, args...)
-	cmd.Env = append(os.Environ(), "FREEON_HOME="+c.homeDir)
+	cmd.Env = append(os.Environ(), "FREEON_HOME="+c.homeDir, "FREEON_IDENTITY="+c.identityFile)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
 
 	output, err := cmd.CombinedOutput()
 	return string(output), err
 }
 
+// runJSON runs a freeon client command with --output json, keeping stdout and stderr apart
+func (c *client) runJSON(t *testing.T, stdin []byte, args ...string) (string, string, error) {
+	t.Helper()
+
+	cmd := exec.Command(clientBinPath, append([]string{"--output", "json"}, args...)...)
+	cmd.Env = append(os.Environ(), "FREEON_HOME="+c.homeDir, "FREEON_IDENTITY="+c.identityFile)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// start runs a freeon client command in the background, for tests that need to interrupt it
+func (c *client) start(t *testing.T, args ...string) *exec.Cmd {
+	t.Helper()
+
+	cmd := exec.Command(clientBinPath, args...)
+	cmd.Env = append(os.Environ(), "FREEON_HOME="+c.homeDir, "FREEON_IDENTITY="+c.identityFile)
+	require.NoError(t, cmd.Start())
+	return cmd
+}
+
+// waitForJournal waits until a client has journaled a ceremony up to the given round
+func (c *client) waitForJournal(t *testing.T, id, round string) {
+	t.Helper()
+
+	path := filepath.Join(c.homeDir, ".freeon-journal", id+".json")
+	for i := 0; i < 300; i++ {
+		if data, err := os.ReadFile(path); err == nil {
+			var j struct {
+				Round string `json:"round"`
+			}
+			if json.Unmarshal(data, &j) == nil && j.Round == round {
+				return
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("client never journaled %s up to %s", id, round)
+}
+
+// partyID looks up a client's party ID in a group
+func (c *client) partyID(t *testing.T, groupID string) uint16 {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(c.homeDir, ".freeon.json"))
+	require.NoError(t, err)
+	var config struct {
+		Shares []struct {
+			GroupID   string `json:"group-id"`
+			MyPartyID uint16 `json:"my-party-id"`
+		} `json:"shares"`
+	}
+	require.NoError(t, json.Unmarshal(data, &config))
+	for _, share := range config.Shares {
+		if share.GroupID == groupID {
+			return share.MyPartyID
+		}
+	}
+	t.Fatalf("client has no share for %s", groupID)
+	return 0
+}
+
+// mustField picks one field out of a JSON object
+func mustField(t *testing.T, document, field string) json.RawMessage {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(document), &fields), document)
+	require.Contains(t, fields, field, document)
+	return fields[field]
+}
+
+// requireExitCode checks that a client command failed with a specific exit status
+func requireExitCode(t *testing.T, err error, code int, output string) {
+	t.Helper()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr, output)
+	require.Equal(t, code, exitErr.ExitCode(), output)
+}
+
 // waitForCoordinator waits for the coordinator to be ready to accept connections
 func waitForCoordinator(t *testing.T, host string, coordOutput *bytes.Buffer) {
 	t.Helper()
@@ -242,15 +357,33 @@ func TestIntegration(t *testing.T) {
 		require.Len(t, matches, 2)
 		groupID = matches[1]
 
-		// Other clients join the DKG
+		identities := make([]string, numClients)
+		for i, c := range clients {
+			out, err := c.run(t, "identity")
+			require.NoError(t, err, out)
+			identities[i] = strings.TrimSpace(out)
+		}
+
+		// Other clients join the DKG. Client 0 names the others, so it checks the coordinator's keys itself; the rest
+		// are shown the keys to check by hand.
 		var wg sync.WaitGroup
 		for i := 0; i < numClients; i++ {
 			wg.Add(1)
 			time.Sleep(100 * time.Millisecond)
 			go func(i int) {
 				defer wg.Done()
-				out, err := clients[i].run(t, "keygen", "join", "-h", coord.hostname, "-g", groupID, "-r", clients[i].agePubKey)
+				args := []string{"keygen", "join", "-h", coord.hostname, "-g", groupID, "-r", clients[i].agePubKey}
+				if i == 0 {
+					for _, id := range identities[1:] {
+						args = append(args, "--member", id)
+					}
+				}
+				out, err := clients[i].run(t, args...)
 				require.NoError(t, err, out)
+				require.Equal(t, i != 0, strings.Contains(out, "nobody vouched"), out)
+				if i != 0 {
+					require.Contains(t, out, identities[0])
+				}
 			}(i)
 		}
 		wg.Wait()
@@ -277,7 +410,7 @@ func TestIntegration(t *testing.T) {
 			wg.Add(1)
 			go func(i int) {
 				defer wg.Done()
-				output, err := clients[i].run(t, "sign", "join", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile, messageFile)
+				output, err := clients[i].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile, messageFile)
 				require.NoError(t, err, output)
 			}(i)
 		}
@@ -308,5 +441,1008 @@ func TestIntegration(t *testing.T) {
 		// Verify the Ed25519 signature
 		verified := ed25519.Verify(pubKey, []byte(message), signature)
 		require.True(t, verified, "Ed25519 signature verification failed")
+
+		// The client agrees, and tells a bad signature apart from one it can't check
+		output, err = clients[3].run(t, "verify", "-g", groupID, "-s", sigHex, messageFile)
+		require.NoError(t, err, output)
+		require.Contains(t, output, "Good signature for "+groupID)
+		output, err = clients[3].runWith(t, []byte("tampered"), "verify", "-k", pubKeyHex, "-s", sigHex)
+		requireExitCode(t, err, 1, output)
+		output, err = clients[3].run(t, "verify", "-g", "grp_nonexistent", "-s", sigHex, messageFile)
+		requireExitCode(t, err, 2, output)
+	})
+
+	// Signers that crash partway through pick up where they left off, without making new nonces
+	t.Run("Resume", func(t *testing.T) {
+		message := "resumed message"
+		messageFile := filepath.Join(clients[0].homeDir, "resumed.txt")
+		require.NoError(t, os.WriteFile(messageFile, []byte(message), 0644))
+		output, err := clients[0].run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, messageFile)
+		require.NoError(t, err, output)
+		matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		ceremonyID := matches[1]
+
+		// The first signers give up while they're still waiting for everyone else
+		for i := 0; i < threshold-1; i++ {
+			cmd := clients[i].start(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile, messageFile)
+			clients[i].waitForJournal(t, ceremonyID, "joined")
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+
+		// The last one commits to its nonces, then gives up waiting for theirs
+		last := clients[threshold-1]
+		cmd := last.start(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", last.identityFile, messageFile)
+		last.waitForJournal(t, ceremonyID, "committed")
+		cmd.Process.Kill()
+		cmd.Wait()
+
+		var wg sync.WaitGroup
+		signatures := make([]string, threshold)
+		for i := 0; i < threshold; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				output, err := clients[i].run(t, "resume", "-i", clients[i].identityFile, ceremonyID)
+				require.NoError(t, err, output)
+				m := regexp.MustCompile(`Signature:\s*(\S+)`).FindStringSubmatch(output)
+				require.Len(t, m, 2, output)
+				signatures[i] = m[1]
+			}(i)
+		}
+		wg.Wait()
+		for _, sig := range signatures {
+			require.Equal(t, signatures[0], sig)
+		}
+
+		// There's nothing left to resume
+		_, err = clients[0].run(t, "resume", "-i", clients[0].identityFile, ceremonyID)
+		requireExitCode(t, err, 1, "")
+
+		output, err = clients[3].run(t, "verify", "-g", groupID, "-s", signatures[0], messageFile)
+		require.NoError(t, err, output)
+	})
+
+	// Exactly `threshold` parties sign; anyone else sits the ceremony out
+	t.Run("SignerSelection", func(t *testing.T) {
+		messageFile := filepath.Join(clients[0].homeDir, "selected.txt")
+		require.NoError(t, os.WriteFile(messageFile, []byte("selected message"), 0644))
+		createCeremony := func(args ...string) string {
+			args = append([]string{"sign", "create", "-h", coord.hostname, "-g", groupID}, args...)
+			output, err := clients[0].run(t, append(args, messageFile)...)
+			require.NoError(t, err, output)
+			matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+			require.Len(t, matches, 2)
+			return matches[1]
+		}
+
+		// Everyone shows up, but only the first `threshold` of them sign
+		ceremonyID := createCeremony()
+		var wg sync.WaitGroup
+		outputs := make([]string, numClients)
+		for i := 0; i < numClients; i++ {
+			wg.Add(1)
+			time.Sleep(100 * time.Millisecond)
+			go func(i int) {
+				defer wg.Done()
+				output, err := clients[i].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile, messageFile)
+				require.NoError(t, err, output)
+				outputs[i] = output
+			}(i)
+		}
+		wg.Wait()
+		signed, satOut := 0, 0
+		for _, output := range outputs {
+			if strings.Contains(output, "Signature:") {
+				signed++
+			} else if strings.Contains(output, "sitting this one out") {
+				satOut++
+			}
+		}
+		require.Equal(t, threshold, signed, outputs)
+		require.Equal(t, numClients-threshold, satOut, outputs)
+
+		// The requester can leave client 0 out entirely
+		var chosen []string
+		for _, c := range clients[1:] {
+			chosen = append(chosen, fmt.Sprintf("%d", c.partyID(t, groupID)))
+		}
+		ceremonyID = createCeremony("--signers", strings.Join(chosen, ","))
+		output, err := clients[0].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[0].identityFile, messageFile)
+		require.NoError(t, err, output)
+		require.Contains(t, output, "sitting this one out")
+		for i := 1; i < numClients; i++ {
+			wg.Add(1)
+			time.Sleep(100 * time.Millisecond)
+			go func(i int) {
+				defer wg.Done()
+				output, err := clients[i].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile, messageFile)
+				require.NoError(t, err, output)
+				require.Contains(t, output, "Signature:")
+			}(i)
+		}
+		wg.Wait()
+
+		// Too few chosen signers to reach the threshold
+		output, err = clients[0].run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, "--signers", chosen[0], messageFile)
+		require.Error(t, err, output)
+	})
+
+	// Ceremonies can't be joined once their deadline has passed
+	t.Run("Deadlines", func(t *testing.T) {
+		messageFile := filepath.Join(clients[0].homeDir, "late.txt")
+		require.NoError(t, os.WriteFile(messageFile, []byte("late message"), 0644))
+		output, err := clients[0].run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, "--deadline", "1s", messageFile)
+		require.NoError(t, err, output)
+		matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		ceremonyID := matches[1]
+
+		time.Sleep(1500 * time.Millisecond)
+		output, err = clients[1].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[1].identityFile, messageFile)
+		require.Error(t, err, output)
+		require.Contains(t, output, "expired")
+
+		// Nobody gets to keep a ceremony open for a year
+		output, err = clients[0].run(t, "keygen", "create", "-h", coord.hostname, "-n", "2", "-t", "2", "--deadline", "8760h")
+		require.Error(t, err, output)
+	})
+
+	// Sign the way git does, then check the result with ssh-keygen's own calling convention
+	t.Run("SSHKeygen", func(t *testing.T) {
+		output, err := clients[0].run(t, "keygen", "list", "--openssh")
+		require.NoError(t, err, output)
+		matches := regexp.MustCompile(`(ssh-ed25519 \S+) ` + groupID).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		groupKey := matches[1]
+
+		// The first signer starts a ceremony and says how to join it
+		message := []byte("object 0123456789abcdef\ntype commit\ntag v1.0.0\n")
+		sshKeygenSign := func(c *client) []string {
+			keyFile := filepath.Join(c.homeDir, "group.pub")
+			require.NoError(t, os.WriteFile(keyFile, []byte(groupKey+"\n"), 0644))
+			messageFile := filepath.Join(c.homeDir, "tag.txt")
+			require.NoError(t, os.WriteFile(messageFile, message, 0644))
+			return []string{"ssh-keygen", "-Y", "sign", "-n", "git", "-f", keyFile, "-U", messageFile}
+		}
+		first := exec.Command(clientBinPath, sshKeygenSign(clients[0])...)
+		first.Env = append(os.Environ(), "FREEON_HOME="+clients[0].homeDir, "FREEON_IDENTITY="+clients[0].identityFile)
+		hint, err := first.StderrPipe()
+		require.NoError(t, err)
+		require.NoError(t, first.Start())
+		var ceremonyID string
+		scanner := bufio.NewScanner(hint)
+		for ceremonyID == "" && scanner.Scan() {
+			if m := regexp.MustCompile(`freeon sign join --fetch -h \S+ -c (\S+)`).FindStringSubmatch(scanner.Text()); m != nil {
+				ceremonyID = m[1]
+			}
+		}
+		require.NotEmpty(t, ceremonyID)
+		drained := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, hint)
+			close(drained)
+		}()
+
+		// The other signers run the same command and end up in the same ceremony, except the last, who downloads the
+		// message instead of having a copy
+		var wg sync.WaitGroup
+		for i := 1; i < threshold; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i == threshold-1 {
+					out, err := clients[i].runWith(t, []byte("y\n"), "sign", "join", "--fetch", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile)
+					require.NoError(t, err, out)
+					return
+				}
+				out, err := clients[i].runWith(t, nil, sshKeygenSign(clients[i])...)
+				require.NoError(t, err, out)
+			}(i)
+		}
+		wg.Wait()
+		<-drained
+		require.NoError(t, first.Wait())
+
+		sigFile := filepath.Join(clients[0].homeDir, "tag.txt.sig")
+		allowedSigners := filepath.Join(clients[0].homeDir, "allowed_signers")
+		require.NoError(t, os.WriteFile(allowedSigners, []byte("release@example.com "+groupKey+"\n"), 0644))
+
+		output, err = clients[0].runWith(t, nil, "ssh-keygen", "-Y", "find-principals", "-f", allowedSigners, "-s", sigFile)
+		require.NoError(t, err, output)
+		require.Equal(t, "release@example.com\n", output)
+		output, err = clients[0].runWith(t, message, "ssh-keygen", "-Y", "verify", "-n", "git", "-f", allowedSigners, "-I", "release@example.com", "-s", sigFile)
+		require.NoError(t, err, output)
+		require.Contains(t, output, `Good "git" signature for release@example.com`)
+		output, err = clients[0].runWith(t, []byte("tampered"), "ssh-keygen", "-Y", "check-novalidate", "-n", "git", "-s", sigFile)
+		require.Error(t, err, output)
+		output, err = clients[3].runWith(t, message, "verify", "-f", allowedSigners, "-I", "release@example.com", "-n", "git", "-s", sigFile)
+		require.NoError(t, err, output)
+		output, err = clients[3].runWith(t, message, "verify", "-f", allowedSigners, "-s", sigFile)
+		requireExitCode(t, err, 1, output)
+		require.Contains(t, output, "namespace")
+
+		// The real thing should agree, if it's around
+		if _, err := exec.LookPath("ssh-keygen"); err == nil {
+			cmd := exec.Command("ssh-keygen", "-Y", "verify", "-n", "git", "-f", allowedSigners, "-I", "release@example.com", "-s", sigFile)
+			cmd.Stdin = bytes.NewReader(message)
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+		}
+	})
+
+	// Serve the group key from an agent, and have ssh-keygen sign through it
+	t.Run("Agent", func(t *testing.T) {
+		if _, err := exec.LookPath("ssh-keygen"); err != nil {
+			t.Skip("ssh-keygen is not installed")
+		}
+		socket := filepath.Join(clients[0].homeDir, "agent.sock")
+		agentCmd := exec.Command(clientBinPath, "agent", "-a", socket, "-i", clients[0].identityFile)
+		agentCmd.Env = append(os.Environ(), "FREEON_HOME="+clients[0].homeDir)
+		agentLog, err := agentCmd.StderrPipe()
+		require.NoError(t, err)
+		require.NoError(t, agentCmd.Start())
+		defer agentCmd.Process.Kill()
+		lines := make(chan string, 16)
+		go func() {
+			scanner := bufio.NewScanner(agentLog)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+		for i := 0; i < 50; i++ {
+			if _, err := os.Stat(socket); err == nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		keyFile := filepath.Join(clients[0].homeDir, "group.pub")
+		messageFile := filepath.Join(clients[0].homeDir, "deploy.txt")
+		require.NoError(t, os.WriteFile(messageFile, []byte("deploy v1.0.0"), 0644))
+		sign := exec.Command("ssh-keygen", "-Y", "sign", "-n", "file", "-f", keyFile, "-U", messageFile)
+		sign.Env = append(os.Environ(), "SSH_AUTH_SOCK="+socket)
+		var signOutput bytes.Buffer
+		sign.Stdout = &signOutput
+		sign.Stderr = &signOutput
+		require.NoError(t, sign.Start())
+
+		// The agent tells us which ceremony to join, and leaves the message with the coordinator for us
+		var ceremonyID string
+		giveUp := time.After(30 * time.Second)
+		for ceremonyID == "" {
+			select {
+			case line := <-lines:
+				if m := regexp.MustCompile(`ceremony (\S+)$`).FindStringSubmatch(line); m != nil {
+					ceremonyID = m[1]
+				}
+			case <-giveUp:
+				t.Fatal("agent never started a signing ceremony")
+			}
+		}
+		go func() {
+			for range lines {
+			}
+		}()
+		var wg sync.WaitGroup
+		for i := 1; i < threshold; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				out, err := clients[i].runWith(t, []byte("y\n"), "sign", "join", "--fetch", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile)
+				require.NoError(t, err, out)
+			}(i)
+		}
+		wg.Wait()
+		require.NoError(t, sign.Wait(), signOutput.String())
+
+		allowedSigners := filepath.Join(clients[0].homeDir, "allowed_signers")
+		verify := exec.Command("ssh-keygen", "-Y", "verify", "-n", "file", "-f", allowedSigners, "-I", "release@example.com", "-s", messageFile+".sig")
+		verify.Stdin = bytes.NewReader([]byte("deploy v1.0.0"))
+		out, err := verify.CombinedOutput()
+		require.NoError(t, err, string(out))
+	})
+
+	// Issue a user certificate with the group key as the CA
+	t.Run("SSHCert", func(t *testing.T) {
+		subject, _, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		var blob bytes.Buffer
+		for _, field := range [][]byte{[]byte("ssh-ed25519"), subject} {
+			binary.Write(&blob, binary.BigEndian, uint32(len(field)))
+			blob.Write(field)
+		}
+		subjectFile := filepath.Join(clients[3].homeDir, "id_ed25519.pub")
+		subjectKey := "ssh-ed25519 " + base64.StdEncoding.EncodeToString(blob.Bytes()) + " alice@laptop\n"
+		require.NoError(t, os.WriteFile(subjectFile, []byte(subjectKey), 0644))
+
+		output, err := clients[3].run(t, "sign", "ssh-cert", "-h", coord.hostname, "-g", groupID, "-s", filepath.Join(clients[0].homeDir, "group.pub"),
+			"-I", "alice@example.com", "-n", "alice,deploy", "-V", "-5m:+1h", "-O", "no-pty", "-O", "force-command=/usr/bin/true", subjectFile)
+		require.NoError(t, err, output)
+		require.Contains(t, output, "force-command /usr/bin/true")
+		matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		ceremonyID := matches[1]
+
+		// Signers see the certificate, and can turn it down
+		output, err = clients[3].runWith(t, []byte("n\n"), "sign", "join", "--ssh-cert", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[3].identityFile)
+		require.Error(t, err, output)
+		require.Contains(t, output, `Key ID: "alice@example.com"`)
+		require.Contains(t, output, "not approved")
+
+		var wg sync.WaitGroup
+		for i := 0; i < threshold; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				out, err := clients[i].runWith(t, []byte("y\n"), "sign", "join", "--ssh-cert", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile)
+				require.NoError(t, err, out)
+			}(i)
+			time.Sleep(200 * time.Millisecond)
+		}
+		wg.Wait()
+
+		output, err = clients[3].run(t, "sign", "get", "-h", coord.hostname, "-c", ceremonyID)
+		require.NoError(t, err, output)
+		matches = regexp.MustCompile(`(ssh-ed25519-cert-v01@openssh.com \S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		certFile := filepath.Join(clients[3].homeDir, "id_ed25519-cert.pub")
+		require.NoError(t, os.WriteFile(certFile, []byte(matches[1]+"\n"), 0644))
+		output, err = clients[3].run(t, "verify", "-g", groupID, "-s", certFile)
+		require.NoError(t, err, output)
+		require.Contains(t, output, `Good certificate "alice@example.com"`)
+
+		if _, err := exec.LookPath("ssh-keygen"); err == nil {
+			out, err := exec.Command("ssh-keygen", "-L", "-f", certFile).CombinedOutput()
+			require.NoError(t, err, string(out))
+			require.Contains(t, string(out), `Key ID: "alice@example.com"`)
+			require.Contains(t, string(out), "force-command /usr/bin/true")
+			require.NotContains(t, string(out), "permit-pty")
+		}
+	})
+
+	// Signers download the message from the coordinator instead of bringing their own
+	t.Run("SharedMessage", func(t *testing.T) {
+		for _, mode := range []string{"--publish", "--seal"} {
+			message := "shared " + mode
+			messageFile := filepath.Join(clients[0].homeDir, "shared.txt")
+			require.NoError(t, os.WriteFile(messageFile, []byte(message), 0644))
+			output, err := clients[0].run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, mode, messageFile)
+			require.NoError(t, err, output)
+			matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+			require.Len(t, matches, 2)
+			ceremonyID := matches[1]
+
+			output, err = clients[3].runWith(t, []byte("n\n"), "sign", "join", "--fetch", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[3].identityFile)
+			require.Error(t, err, output)
+			require.Contains(t, output, message)
+			require.Contains(t, output, "Proposed by: party")
+			require.Contains(t, output, "not approved")
+
+			var wg sync.WaitGroup
+			for i := 0; i < threshold; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					out, err := clients[i].runWith(t, []byte("y\n"), "sign", "join", "--fetch", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile)
+					require.NoError(t, err, out)
+				}(i)
+				time.Sleep(200 * time.Millisecond)
+			}
+			wg.Wait()
+
+			output, err = clients[0].run(t, "sign", "get", "-h", coord.hostname, "-c", ceremonyID)
+			require.NoError(t, err, output)
+			// The coordinator can only vouch for signatures over messages it has seen
+			require.Equal(t, mode == "--seal", strings.Contains(output, "Unverified"), output)
+			matches = regexp.MustCompile(`Signature:\s*(\S+)`).FindStringSubmatch(output)
+			require.Len(t, matches, 2)
+			output, err = clients[3].run(t, "verify", "-g", groupID, "-s", matches[1], messageFile)
+			require.NoError(t, err, output)
+		}
 	})
+
+	// A share holder's own policy keeps them out of ceremonies they haven't agreed to
+	t.Run("Policy", func(t *testing.T) {
+		configFile := filepath.Join(clients[3].homeDir, ".freeon.json")
+		original, err := os.ReadFile(configFile)
+		require.NoError(t, err)
+		defer os.WriteFile(configFile, original, 0600)
+		var config map[string]any
+		require.NoError(t, json.Unmarshal(original, &config))
+		config["policies"] = map[string]any{groupID: map[string]any{"namespaces": []string{"git"}}}
+		data, err := json.Marshal(config)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(configFile, data, 0600))
+
+		messageFile := filepath.Join(clients[3].homeDir, "policy.txt")
+		require.NoError(t, os.WriteFile(messageFile, []byte("not for git"), 0644))
+		output, err := clients[0].run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, messageFile)
+		require.NoError(t, err, output)
+		matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		ceremonyID := matches[1]
+
+		output, err = clients[3].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[3].identityFile, messageFile)
+		requireExitCode(t, err, 3, output)
+		require.Contains(t, output, "refused by signing policy (namespaces)")
+
+		// We never joined, so nobody else was counted out by our refusal
+		players, err := coord.db.GetCeremonyPlayers(ceremonyID)
+		require.NoError(t, err)
+		require.Empty(t, players)
+
+		decisions, err := os.ReadFile(filepath.Join(clients[3].homeDir, ".freeon-policy.log"))
+		require.NoError(t, err)
+		require.Contains(t, string(decisions), `"ceremony-id":"`+ceremonyID+`"`)
+		require.Contains(t, string(decisions), `"decision":"refused"`)
+	})
+
+	// Scripts get one JSON document per command, and errors they can tell apart
+	t.Run("JSONOutput", func(t *testing.T) {
+		type ceremony struct {
+			CeremonyID string `json:"ceremony-id"`
+			GroupID    string `json:"group-id"`
+			Status     string `json:"status"`
+			Format     string `json:"format"`
+			Signature  string `json:"signature"`
+		}
+		type failure struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+
+		messageFile := filepath.Join(clients[0].homeDir, "json.txt")
+		require.NoError(t, os.WriteFile(messageFile, []byte("scripted"), 0644))
+		stdout, stderr, err := clients[0].runJSON(t, nil, "sign", "create", "-h", coord.hostname, "-g", groupID, messageFile)
+		require.NoError(t, err, stderr)
+		var created ceremony
+		require.NoError(t, json.Unmarshal([]byte(stdout), &created), stdout)
+		require.Equal(t, groupID, created.GroupID)
+		require.Equal(t, "created", created.Status)
+		require.Equal(t, "raw", created.Format)
+
+		// Saying no is a refusal, with its own exit status
+		stdout, stderr, err = clients[3].runJSON(t, []byte("n\n"), "sign", "join", "-h", coord.hostname, "-c", created.CeremonyID, "-i", clients[3].identityFile, messageFile)
+		requireExitCode(t, err, 3, stderr)
+		require.Empty(t, stdout)
+		var refused failure
+		// The review comes first, so the error is the last line
+		lines := strings.Split(strings.TrimSpace(stderr), "\n")
+		require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &refused), stderr)
+		require.Equal(t, "not-approved", refused.Error.Code)
+
+		signatures := make([]ceremony, threshold)
+		var wg sync.WaitGroup
+		for i := 0; i < threshold; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				stdout, stderr, err := clients[i].runJSON(t, nil, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", created.CeremonyID, "-i", clients[i].identityFile, messageFile)
+				require.NoError(t, err, stderr)
+				require.NoError(t, json.Unmarshal([]byte(stdout), &signatures[i]), stdout)
+			}(i)
+			time.Sleep(200 * time.Millisecond)
+		}
+		wg.Wait()
+		for _, sig := range signatures {
+			require.Equal(t, "complete", sig.Status)
+			require.Equal(t, "raw", sig.Format)
+			require.Equal(t, signatures[0].Signature, sig.Signature)
+		}
+
+		stdout, stderr, err = clients[0].runJSON(t, nil, "sign", "get", "-h", coord.hostname, "-c", created.CeremonyID)
+		require.NoError(t, err, stderr)
+		var fetched ceremony
+		require.NoError(t, json.Unmarshal([]byte(stdout), &fetched), stdout)
+		require.Equal(t, signatures[0].Signature, fetched.Signature)
+
+		stdout, stderr, err = clients[3].runJSON(t, nil, "verify", "-g", groupID, "-s", fetched.Signature, messageFile)
+		require.NoError(t, err, stderr)
+		require.JSONEq(t, `true`, string(mustField(t, stdout, "valid")))
+
+		stdout, stderr, err = clients[0].runJSON(t, nil, "sign", "list", "-h", coord.hostname, "-g", groupID, "--limit", "100")
+		require.NoError(t, err, stderr)
+		var list struct {
+			Ceremonies []ceremony `json:"ceremonies"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(stdout), &list), stdout)
+		require.True(t, slices.ContainsFunc(list.Ceremonies, func(c ceremony) bool {
+			return c.CeremonyID == created.CeremonyID && c.Status == "complete"
+		}), stdout)
+
+		stdout, stderr, err = clients[0].runJSON(t, nil, "keygen", "list")
+		require.NoError(t, err, stderr)
+		require.Contains(t, string(mustField(t, stdout, "groups")), groupID)
+
+		// A bad command line is a usage error, and stdout stays empty
+		stdout, stderr, err = clients[0].runJSON(t, nil, "sign", "get", "-h", coord.hostname)
+		requireExitCode(t, err, 2, stderr)
+		require.Empty(t, stdout)
+		var usage failure
+		require.NoError(t, json.Unmarshal([]byte(stderr), &usage), stderr)
+		require.Equal(t, "usage", usage.Error.Code)
+		require.Contains(t, usage.Error.Message, "-c/--ceremony")
+	})
+
+	// Share refresh, followed by a signature from a different quorum
+	t.Run("RefreshAndSign", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < numClients; i++ {
+			wg.Add(1)
+			time.Sleep(100 * time.Millisecond)
+			go func(i int) {
+				defer wg.Done()
+				out, err := clients[i].run(t, "keygen", "refresh", "-h", coord.hostname, "-g", groupID, "-i", clients[i].identityFile, "-r", clients[i].agePubKey)
+				require.NoError(t, err, out)
+				require.Contains(t, out, "epoch 1")
+				// The members' identity keys came from keygen, not the coordinator
+				require.NotContains(t, out, "trusting the coordinator", out)
+			}(i)
+		}
+		wg.Wait()
+
+		message := "refreshed message"
+		messageFile := filepath.Join(clients[1].homeDir, "message.txt")
+		err := os.WriteFile(messageFile, []byte(message), 0644)
+		require.NoError(t, err)
+		output, err := clients[1].run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, messageFile)
+		require.NoError(t, err, output)
+		matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		ceremonyID := matches[1]
+
+		for i := 1; i <= threshold; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				output, err := clients[i].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[i].identityFile, messageFile)
+				require.NoError(t, err, output)
+			}(i)
+		}
+		wg.Wait()
+
+		output, err = clients[1].run(t, "sign", "get", "-h", coord.hostname, "-c", ceremonyID)
+		require.NoError(t, err, output)
+		matches = regexp.MustCompile(`Signature:\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		signature, err := hex.DecodeString(matches[1])
+		require.NoError(t, err)
+
+		// Same public key as before the refresh
+		output, err = clients[1].run(t, "keygen", "list")
+		require.NoError(t, err, output)
+		matches = regexp.MustCompile(groupID + `\s+([a-f0-9]+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		pubKey, err := hex.DecodeString(matches[1])
+		require.NoError(t, err)
+		require.True(t, ed25519.Verify(pubKey, []byte(message), signature), "Ed25519 signature verification failed")
+	})
+
+	// Move to a 2-of-3 group: clients 0 and 1 stay, client 2 deals but leaves, client 3 sits it out, and a newcomer joins
+	t.Run("ReshareAndSign", func(t *testing.T) {
+		newcomer := newClient(t)
+		identity, err := newcomer.run(t, "identity")
+		require.NoError(t, err, identity)
+		identity = strings.TrimSpace(identity)
+
+		// Somebody who wasn't named can't take the newcomer's place
+		stranger := newClient(t)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := clients[0].run(t, "keygen", "reshare", "-h", coord.hostname, "-g", groupID, "-i", clients[0].identityFile, "-r", clients[0].agePubKey, "-n", "3", "-t", "2", "--newcomer", identity)
+			require.NoError(t, err, out)
+			require.Contains(t, out, "epoch 2")
+		}()
+		time.Sleep(500 * time.Millisecond)
+		out, err := stranger.run(t, "keygen", "reshare", "-h", coord.hostname, "-g", groupID, "-r", stranger.agePubKey)
+		require.Error(t, err, out)
+		joins := [][]string{
+			{"-i", clients[1].identityFile, "-r", clients[1].agePubKey, "--newcomer", identity},
+			{"-i", clients[2].identityFile, "--leave"},
+			{"-r", newcomer.agePubKey},
+		}
+		for i, c := range []*client{clients[1], clients[2], newcomer} {
+			wg.Add(1)
+			time.Sleep(100 * time.Millisecond)
+			go func(c *client, extra []string) {
+				defer wg.Done()
+				args := append([]string{"keygen", "reshare", "-h", coord.hostname, "-g", groupID}, extra...)
+				out, err := c.run(t, args...)
+				require.NoError(t, err, out)
+				require.Contains(t, out, "Reshare complete!")
+				require.NotContains(t, out, "trusting the coordinator", out)
+			}(c, joins[i])
+		}
+		wg.Wait()
+
+		message := "reshared message"
+		messageFile := filepath.Join(newcomer.homeDir, "message.txt")
+		err = os.WriteFile(messageFile, []byte(message), 0644)
+		require.NoError(t, err)
+		output, err := newcomer.run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, messageFile)
+		require.NoError(t, err, output)
+		matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		ceremonyID := matches[1]
+
+		// The retired holder can't take part any more
+		output, err = clients[3].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", clients[3].identityFile, messageFile)
+		require.Error(t, err, output)
+
+		for _, c := range []*client{clients[1], newcomer} {
+			wg.Add(1)
+			go func(c *client) {
+				defer wg.Done()
+				output, err := c.run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", c.identityFile, messageFile)
+				require.NoError(t, err, output)
+			}(c)
+		}
+		wg.Wait()
+
+		output, err = newcomer.run(t, "sign", "get", "-h", coord.hostname, "-c", ceremonyID)
+		require.NoError(t, err, output)
+		matches = regexp.MustCompile(`Signature:\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		signature, err := hex.DecodeString(matches[1])
+		require.NoError(t, err)
+
+		// Still the same public key
+		output, err = newcomer.run(t, "keygen", "list")
+		require.NoError(t, err, output)
+		matches = regexp.MustCompile(groupID + `\s+([a-f0-9]+)\s+2`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		pubKey, err := hex.DecodeString(matches[1])
+		require.NoError(t, err)
+		require.True(t, ed25519.Verify(pubKey, []byte(message), signature), "Ed25519 signature verification failed")
+	})
+
+	// A share holder who never goes online takes part in key generation and signing through bundles
+	t.Run("Offline", func(t *testing.T) {
+		online := []*client{newClient(t), newClient(t)}
+		airgapped := newClient(t)
+		usb := t.TempDir()
+		inbound := filepath.Join(usb, "inbound.json")
+		outbound := filepath.Join(usb, "outbound.json")
+
+		// Run the offline command, carrying bundles back and forth until it finishes
+		delivered := make(map[string]bool)
+		shuttle := func(args ...string) string {
+			t.Helper()
+			for trip := 0; trip < 20; trip++ {
+				// Flags have to come before the message file
+				command := append([]string{args[0], args[1], "--offline", "--inbound", inbound, "--outbound", outbound}, args[2:]...)
+				output, err := airgapped.run(t, command...)
+				require.NoError(t, err, output)
+				if !strings.Contains(output, "Waiting for the coordinator") {
+					return output
+				}
+				// Nothing the relay delivered on an earlier trip goes out again
+				var bundle struct {
+					Requests []struct{ Path, Body string } `json:"requests"`
+				}
+				data, err := os.ReadFile(outbound)
+				require.NoError(t, err)
+				require.NoError(t, json.Unmarshal(data, &bundle))
+				for _, r := range bundle.Requests {
+					require.False(t, delivered[r.Path+"\n"+r.Body], "%s was already delivered", r.Path)
+					delivered[r.Path+"\n"+r.Body] = true
+				}
+				relayOutput, err := online[0].run(t, "relay", "-h", coord.hostname, "--outbound", outbound, "--inbound", inbound)
+				require.NoError(t, err, relayOutput)
+				time.Sleep(200 * time.Millisecond)
+			}
+			t.Fatal("offline ceremony never finished")
+			return ""
+		}
+
+		output, err := online[0].run(t, "keygen", "create", "-h", coord.hostname, "-n", "3", "-t", "2")
+		require.NoError(t, err, output)
+		matches := regexp.MustCompile(`Group ID:\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		offlineGroup := matches[1]
+
+		var wg sync.WaitGroup
+		for _, c := range online {
+			wg.Add(1)
+			time.Sleep(100 * time.Millisecond)
+			go func(c *client) {
+				defer wg.Done()
+				out, err := c.run(t, "keygen", "join", "-h", coord.hostname, "-g", offlineGroup, "-r", c.agePubKey)
+				require.NoError(t, err, out)
+			}(c)
+		}
+		time.Sleep(100 * time.Millisecond)
+		output = shuttle("keygen", "join", "-g", offlineGroup, "-r", airgapped.agePubKey, "-i", airgapped.identityFile)
+		require.Contains(t, output, "Group public key:")
+		// Our confirmation of the group key is still on the USB stick
+		_, err = online[0].run(t, "relay", "-h", coord.hostname, "--outbound", outbound, "--inbound", inbound)
+		require.NoError(t, err)
+		wg.Wait()
+		require.NoError(t, os.Remove(inbound))
+
+		message := "signed on an airgapped machine"
+		messageFile := filepath.Join(airgapped.homeDir, "airgapped.txt")
+		require.NoError(t, os.WriteFile(messageFile, []byte(message), 0644))
+		output, err = online[0].run(t, "sign", "create", "-h", coord.hostname, "-g", offlineGroup, messageFile)
+		require.NoError(t, err, output)
+		matches = regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		ceremonyID := matches[1]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := online[0].run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", online[0].identityFile, messageFile)
+			require.NoError(t, err, out)
+		}()
+		output = shuttle("sign", "join", "--auto-confirm", "-c", ceremonyID, "-i", airgapped.identityFile, messageFile)
+		matches = regexp.MustCompile(`Signature:\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2, output)
+		_, err = online[0].run(t, "relay", "-h", coord.hostname, "--outbound", outbound, "--inbound", inbound)
+		require.NoError(t, err)
+		wg.Wait()
+
+		output, err = online[1].run(t, "verify", "-g", offlineGroup, "-s", matches[1], messageFile)
+		require.NoError(t, err, output)
+	})
+	// Outsiders need a token to propose, and only administrators can terminate ceremonies or archive the group
+	t.Run("Roles", func(t *testing.T) {
+		outsider := newClient(t)
+		messageFile := filepath.Join(outsider.homeDir, "release.txt")
+		require.NoError(t, os.WriteFile(messageFile, []byte("release v1.2.3"), 0644))
+		output, err := outsider.run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, messageFile)
+		require.Error(t, err, output)
+		require.Contains(t, output, "API token")
+
+		output, err = coord.admin(t, "token", "-g", groupID, "-l", "ci")
+		require.NoError(t, err, output)
+		proposer := strings.TrimSpace(output)
+		output, err = outsider.run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, "--token", proposer, messageFile)
+		require.NoError(t, err, output)
+		matches := regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+		require.Len(t, matches, 2)
+		ceremonyID := matches[1]
+
+		// Proposing is all a proposer can do, and being a member isn't enough either
+		output, err = outsider.run(t, "terminate", "-h", coord.hostname, "-c", ceremonyID, "--token", proposer)
+		require.Error(t, err, output)
+		output, err = clients[1].run(t, "terminate", "-h", coord.hostname, "-c", ceremonyID)
+		require.Error(t, err, output)
+		require.Contains(t, output, "not an administrator")
+
+		output, err = coord.admin(t, "grant", "-g", groupID, "-p", fmt.Sprint(clients[0].partyID(t, groupID)))
+		require.NoError(t, err, output)
+		output, err = clients[0].run(t, "terminate", "-h", coord.hostname, "-c", ceremonyID)
+		require.NoError(t, err, output)
+		require.Contains(t, output, "Ceremony terminated.")
+
+		output, err = coord.admin(t, "list", "-g", groupID)
+		require.NoError(t, err, output)
+		require.Contains(t, output, "token \"ci\"\tproposer")
+		require.Contains(t, output, fmt.Sprintf("party %d\tadmin", clients[0].partyID(t, groupID)))
+
+		output, err = coord.admin(t, "revoke-token", "-g", groupID, "-l", "ci")
+		require.NoError(t, err, output)
+		output, err = outsider.run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, "--token", proposer, messageFile)
+		require.Error(t, err, output)
+
+		// Once archived, nobody can sign with the group again
+		output, err = coord.admin(t, "token", "-g", groupID, "-l", "ops", "-r", "admin")
+		require.NoError(t, err, output)
+		output, err = outsider.run(t, "archive", "-h", coord.hostname, "-g", groupID, "--token", strings.TrimSpace(output))
+		require.NoError(t, err, output)
+		output, err = clients[0].run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, messageFile)
+		require.Error(t, err, output)
+		require.Contains(t, output, "archived")
+	})
+}
+
+// A coordinator with a self-signed certificate, pinned by its clients, which present certificates of their own
+// Hitting Ctrl-C while waiting for everyone else to join gives our seat back, so the group can still fill up
+func TestLeaveKeyGen(t *testing.T) {
+	coord := startCoordinator(t)
+	defer coord.stop(t)
+	clients := []*client{newClient(t), newClient(t), newClient(t)}
+
+	output, err := clients[0].run(t, "keygen", "create", "-h", coord.hostname, "-n", "2", "-t", "2")
+	require.NoError(t, err, output)
+	matches := regexp.MustCompile(`Group ID:\s*(\S+)`).FindStringSubmatch(output)
+	require.Len(t, matches, 2)
+	groupID := matches[1]
+
+	var leaverOutput bytes.Buffer
+	cmd := exec.Command(clientBinPath, "keygen", "join", "-h", coord.hostname, "-g", groupID, "-r", clients[0].agePubKey)
+	cmd.Env = append(os.Environ(), "FREEON_HOME="+clients[0].homeDir, "FREEON_IDENTITY="+clients[0].identityFile)
+	cmd.Stdout = &leaverOutput
+	cmd.Stderr = &leaverOutput
+	require.NoError(t, cmd.Start())
+	clients[0].waitForJournal(t, groupID, "joined")
+	require.NoError(t, cmd.Process.Signal(os.Interrupt))
+	requireExitCode(t, cmd.Wait(), 1, leaverOutput.String())
+	require.Contains(t, leaverOutput.String(), "Left key generation for group "+groupID)
+
+	// There's nothing to resume, and the two who stay on make the key between them
+	_, err = clients[0].run(t, "resume", "-i", clients[0].identityFile, groupID)
+	requireExitCode(t, err, 1, "")
+	var wg sync.WaitGroup
+	for _, c := range clients[1:] {
+		wg.Add(1)
+		go func(c *client) {
+			defer wg.Done()
+			out, err := c.run(t, "keygen", "join", "-h", coord.hostname, "-g", groupID, "-r", c.agePubKey)
+			require.NoError(t, err, out)
+		}(c)
+	}
+	wg.Wait()
+	require.ElementsMatch(t, []uint16{1, 2}, []uint16{clients[1].partyID(t, groupID), clients[2].partyID(t, groupID)})
+}
+
+func TestTLS(t *testing.T) {
+	certDir := t.TempDir()
+	certFile := filepath.Join(certDir, "coordinator.crt")
+	coord := startCoordinatorWith(t, map[string]any{
+		"tls-cert":        certFile,
+		"tls-key":         filepath.Join(certDir, "coordinator.key"),
+		"tls-self-signed": true,
+		"client-certs":    true,
+	})
+	defer coord.stop(t)
+
+	certPEM, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	pin := internal.SPKIHash(cert)
+
+	clients := []*client{newClient(t), newClient(t)}
+	trust := func(c *client, pin string) {
+		config := map[string]any{
+			"shares": []any{},
+			"coordinators": map[string]any{
+				coord.hostname: map[string]any{"pin-spki": pin, "client-cert": true},
+			},
+		}
+		data, err := json.Marshal(config)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(c.homeDir, ".freeon.json"), data, 0600))
+	}
+
+	// A self-signed certificate isn't trusted without a pin, and the wrong pin is no better
+	output, err := clients[0].run(t, "keygen", "create", "-h", "https://"+coord.hostname, "-n", "2", "-t", "2")
+	require.Error(t, err, output)
+	trust(clients[0], strings.Repeat("00", 32))
+	output, err = clients[0].run(t, "keygen", "create", "-h", coord.hostname, "-n", "2", "-t", "2")
+	require.Error(t, err, output)
+	require.Contains(t, output, "doesn't match its pin")
+
+	for _, c := range clients {
+		trust(c, pin)
+	}
+	output, err = clients[0].run(t, "keygen", "create", "-h", coord.hostname, "-n", "2", "-t", "2")
+	require.NoError(t, err, output)
+	matches := regexp.MustCompile(`Group ID:\s*(\S+)`).FindStringSubmatch(output)
+	require.Len(t, matches, 2)
+	groupID := matches[1]
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		go func(c *client) {
+			defer wg.Done()
+			out, err := c.run(t, "keygen", "join", "-h", coord.hostname, "-g", groupID, "-r", c.agePubKey)
+			require.NoError(t, err, out)
+		}(c)
+	}
+	wg.Wait()
+
+	messageFile := filepath.Join(clients[0].homeDir, "message.txt")
+	require.NoError(t, os.WriteFile(messageFile, []byte("over TLS"), 0644))
+	output, err = clients[0].run(t, "sign", "create", "-h", coord.hostname, "-g", groupID, messageFile)
+	require.NoError(t, err, output)
+	matches = regexp.MustCompile(`created!\s*(\S+)`).FindStringSubmatch(output)
+	require.Len(t, matches, 2)
+	ceremonyID := matches[1]
+	for _, c := range clients {
+		wg.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		go func(c *client) {
+			defer wg.Done()
+			out, err := c.run(t, "sign", "join", "--auto-confirm", "-h", coord.hostname, "-c", ceremonyID, "-i", c.identityFile, messageFile)
+			require.NoError(t, err, out)
+			require.Contains(t, out, "Signature:")
+		}(c)
+	}
+	wg.Wait()
+}
+
+// A coordinator with a client CA turns away anyone without a certificate it issued
+func TestMutualTLS(t *testing.T) {
+	certDir := t.TempDir()
+	caPub, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	caTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "freeon test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, caPub, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	caFile := filepath.Join(certDir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644))
+
+	certFile := filepath.Join(certDir, "coordinator.crt")
+	coord := startCoordinatorWith(t, map[string]any{
+		"tls-cert":        certFile,
+		"tls-key":         filepath.Join(certDir, "coordinator.key"),
+		"tls-self-signed": true,
+		"client-ca":       caFile,
+	})
+	defer coord.stop(t)
+	certPEM, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+
+	c := newClient(t)
+	// Keep the rest of the config, since that's where our identity key lives
+	configFile := filepath.Join(c.homeDir, ".freeon.json")
+	trust := func(settings map[string]any) {
+		settings["pin-spki"] = internal.SPKIHash(cert)
+		config := map[string]any{"shares": []any{}}
+		if data, err := os.ReadFile(configFile); err == nil {
+			require.NoError(t, json.Unmarshal(data, &config))
+		}
+		config["coordinators"] = map[string]any{coord.hostname: settings}
+		data, err := json.Marshal(config)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(configFile, data, 0600))
+	}
+
+	// A self-signed certificate isn't good enough any more
+	trust(map[string]any{"client-cert": true})
+	output, err := c.run(t, "keygen", "create", "-h", coord.hostname, "-n", "2", "-t", "2")
+	require.Error(t, err, output)
+
+	// Have the CA sign our request, and present what it gives back
+	output, err = c.run(t, "identity", "--csr")
+	require.NoError(t, err, output)
+	block, _ = pem.Decode([]byte(output))
+	require.NotNil(t, block)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, csr.CheckSignature())
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, caCert, csr.PublicKey, caKey)
+	require.NoError(t, err)
+	clientCertFile := filepath.Join(c.homeDir, "client.pem")
+	require.NoError(t, os.WriteFile(clientCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	trust(map[string]any{"client-cert-file": clientCertFile})
+	output, err = c.run(t, "keygen", "create", "-h", coord.hostname, "-n", "2", "-t", "2")
+	require.NoError(t, err, output)
+	require.Contains(t, output, "Group ID:")
 }